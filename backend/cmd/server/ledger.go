@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+)
+
+// runLedgerCheck runs the check-ledger subcommand:
+//
+//	server check-ledger [-org <id>] [-repair]
+//
+// It checks the ledger of one organization, or of every organization with
+// items, and prints each issue found. With -repair the repairs are posted as
+// the organization's oldest active admin. It returns the exit code: 1 when
+// the check failed or found issues it did not repair.
+func runLedgerCheck(ctx context.Context, ledger *services.LedgerService, users repository.UserRepository, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("check-ledger", flag.ContinueOnError)
+	flags.SetOutput(out)
+	org := flags.String("org", "", "check only this organization")
+	repair := flags.Bool("repair", false, "post a movement closing each issue found")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var orgIDs []uuid.UUID
+	if *org != "" {
+		orgID, err := uuid.Parse(*org)
+		if err != nil {
+			fmt.Fprintf(out, "invalid organization ID %q\n", *org)
+			return 2
+		}
+		orgIDs = []uuid.UUID{orgID}
+	} else {
+		var err error
+		if orgIDs, err = ledger.ListOrganizations(ctx); err != nil {
+			fmt.Fprintf(out, "failed to list organizations: %v\n", err)
+			return 1
+		}
+	}
+
+	code := 0
+	for _, orgID := range orgIDs {
+		var (
+			check  *domain.LedgerCheck
+			err    error
+			orgCtx = repository.WithOrganization(ctx, orgID)
+		)
+		if *repair {
+			var admin uuid.UUID
+			if admin, err = oldestAdmin(orgCtx, users, orgID); err == nil {
+				check, err = ledger.Repair(orgCtx, orgID, admin)
+			}
+		} else {
+			check, err = ledger.Check(orgCtx, orgID)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "organization %s: %v\n", orgID, err)
+			code = 1
+			continue
+		}
+
+		fmt.Fprintf(out, "organization %s: %d item(s), %d movement(s), %d issue(s)\n",
+			orgID, check.ItemsChecked, check.MovementsChecked, len(check.Issues))
+		for _, issue := range check.Issues {
+			action := "would post"
+			if check.Repaired {
+				action = "posted"
+			}
+			fmt.Fprintf(out, "  %s %s (%s): expected %d, found %d; %s ADJUSTMENT %d -> %d at %s\n",
+				issue.Type, issue.ItemName, issue.ItemID, issue.Expected, issue.Actual,
+				action, issue.Repair.PreviousStock, issue.Repair.NewStock, issue.Repair.CreatedAt.Format(time.RFC3339))
+		}
+		if !check.Repaired && len(check.Issues) > 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+// oldestAdmin returns the organization's longest-standing active admin, who
+// the repairs are posted as
+func oldestAdmin(ctx context.Context, users repository.UserRepository, orgID uuid.UUID) (uuid.UUID, error) {
+	list, err := users.List(ctx, orgID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	// Users are listed newest first
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Role == domain.RoleAdmin && list[i].IsActive && list[i].ID != uuid.Nil {
+			return list[i].ID, nil
+		}
+	}
+	return uuid.Nil, errors.New("no active admin to post the repairs as")
+}
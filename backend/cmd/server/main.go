@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"hasufel.kj/internal/config"
 	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/handlers"
 	"hasufel.kj/internal/middleware"
 	"hasufel.kj/internal/repository"
 	"hasufel.kj/internal/services"
+	"hasufel.kj/migrations"
 	"hasufel.kj/pkg/logger"
 
 	"github.com/go-chi/chi/v5"
@@ -22,6 +26,10 @@ import (
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending migrations and exit")
+	rollback := flag.Int("rollback", 0, "roll back the last N migrations and exit")
+	flag.Parse()
+
 	// Initialize configuration
 	cfg := config.Load()
 
@@ -29,31 +37,120 @@ func main() {
 	log := logger.New(cfg.LogLevel)
 
 	// Initialize database
-	db, err := database.New(cfg.Database.DSN)
+	dialect, err := database.ParseDialect(cfg.Database.Driver)
+	if err != nil {
+		log.Fatal("Unsupported database driver", err)
+	}
+
+	db, err := database.New(dialect, cfg.Database.DSN)
 	if err != nil {
 		log.Fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
-	log.Info("Database connection established")
+	log.Info("Database connection established (" + string(dialect) + ")")
+
+	// Bring the schema up to date before serving requests
+	migrator, err := database.NewMigrator(db, dialect, migrations.FS)
+	if err != nil {
+		log.Fatal("Failed to load migrations", err)
+	}
+
+	if *rollback > 0 {
+		n, err := migrator.Rollback(context.Background(), *rollback)
+		if err != nil {
+			log.Fatal("Failed to roll back migrations", err)
+		}
+		log.Info("Rolled back " + strconv.Itoa(n) + " migration(s)")
+		return
+	}
+
+	n, err := migrator.Up(context.Background())
+	if err != nil {
+		log.Fatal("Failed to apply migrations", err)
+	}
+	version, err := migrator.Version(context.Background())
+	if err != nil {
+		log.Fatal("Failed to read schema version", err)
+	}
+	log.Info("Applied " + strconv.Itoa(n) + " migration(s), schema at version " + strconv.FormatUint(version, 10))
+
+	if *migrateOnly {
+		return
+	}
 
 	// Initialize repositories
-	itemRepo := repository.NewItemRepository(db)
-	categoryRepo := repository.NewCategoryRepository(db)
-	movementRepo := repository.NewMovementRepository(db)
-	alertRepo := repository.NewAlertRepository(db)
-	userRepo := repository.NewUserRepository(db)
+	itemRepo := repository.NewItemRepository(db, dialect)
+	categoryRepo := repository.NewCategoryRepository(db, dialect)
+	movementRepo := repository.NewMovementRepository(db, dialect)
+	alertRepo := repository.NewAlertRepository(db, dialect)
+	userRepo := repository.NewUserRepository(db, dialect)
+	orgRepo := repository.NewOrganizationRepository(db, dialect)
+	idempotencyRepo := repository.NewIdempotencyRepository(db, dialect)
+	locationRepo := repository.NewLocationRepository(db, dialect)
+	stockLevelRepo := repository.NewStockLevelRepository(db, dialect)
+	lotRepo := repository.NewStockLotRepository(db, dialect)
+	unitRepo := repository.NewUnitRepository(db, dialect)
+	reasonRepo := repository.NewMovementReasonRepository(db, dialect)
+	costingRepo := repository.NewCostingRepository(db, dialect)
+	recipeRepo := repository.NewRecipeRepository(db, dialect)
+	posMappingRepo := repository.NewPOSMappingRepository(db, dialect)
+	posImportRepo := repository.NewPOSImportRepository(db, dialect)
+	supplierRepo := repository.NewSupplierRepository(db, dialect)
+	purchaseOrderRepo := repository.NewPurchaseOrderRepository(db, dialect)
+	reorderRepo := repository.NewReorderRepository(db, dialect)
+	stockCountRepo := repository.NewStockCountRepository(db, dialect)
+	reportRepo := repository.NewReportRepository(db, dialect)
+	ledgerRepo := repository.NewLedgerRepository(db, dialect)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db, dialect)
+	invitationRepo := repository.NewInvitationRepository(db, dialect)
+	permissionRepo := repository.NewPermissionRepository(db, dialect)
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, cfg.JWT.Secret)
-	inventoryService := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, db)
-	dashboardService := services.NewDashboardService(itemRepo, movementRepo, alertRepo, db)
+	authService := services.NewAuthService(userRepo, orgRepo, refreshTokenRepo, invitationRepo, db, cfg.JWT.Secret, services.TokenLifetimes{
+		Access:  time.Duration(cfg.JWT.AccessTTLMinutes) * time.Minute,
+		Refresh: time.Duration(cfg.JWT.RefreshTTLHours) * time.Hour,
+	})
+	inventoryService := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, locationRepo, stockLevelRepo, lotRepo, unitRepo, reasonRepo, costingRepo, db)
+	recipeService := services.NewRecipeService(recipeRepo, itemRepo, inventoryService, db)
+	posImportService := services.NewPOSImportService(posMappingRepo, posImportRepo, recipeRepo, recipeService, db)
+	purchasingService := services.NewPurchasingService(supplierRepo, purchaseOrderRepo, itemRepo, inventoryService, db)
+	reorderService := services.NewReorderService(reorderRepo, itemRepo, supplierRepo, alertRepo, inventoryService, db)
+	stockCountService := services.NewStockCountService(stockCountRepo, itemRepo, inventoryService, db)
+	reportService := services.NewReportService(reportRepo, inventoryService, db)
+	dashboardService := services.NewDashboardService(itemRepo, movementRepo, alertRepo, db, dialect)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, db, time.Duration(cfg.Idempotency.RetentionHours)*time.Hour)
+	ledgerService := services.NewLedgerService(ledgerRepo, inventoryService, db)
+	permissionService := services.NewPermissionService(permissionRepo, db)
+	userService := services.NewUserService(userRepo, orgRepo, invitationRepo, authService, db, time.Duration(cfg.Invitation.TTLHours)*time.Hour)
+	orgService := services.NewOrganizationService(orgRepo, userRepo, userService, authService, db)
+
+	// check-ledger checks, and optionally repairs, the ledger instead of
+	// serving requests
+	if flag.Arg(0) == "check-ledger" {
+		os.Exit(runLedgerCheck(context.Background(), ledgerService, userRepo, flag.Args()[1:], os.Stdout))
+	}
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, log)
+	userHandler := handlers.NewUserHandler(userService, log)
+	permissionHandler := handlers.NewPermissionHandler(permissionService, log)
+	orgHandler := handlers.NewOrganizationHandler(orgService, log)
 	inventoryHandler := handlers.NewInventoryHandler(inventoryService, log)
 	dashboardHandler := handlers.NewDashboardHandler(dashboardService, log)
-	movementHandler := handlers.NewMovementHandler(inventoryService, log)
+	reversalPolicies := services.RoleReversalPolicies(
+		time.Duration(cfg.Reversal.AdminHours)*time.Hour,
+		time.Duration(cfg.Reversal.ManagerHours)*time.Hour,
+		time.Duration(cfg.Reversal.UserHours)*time.Hour,
+	)
+	movementHandler := handlers.NewMovementHandler(inventoryService, idempotencyService, reversalPolicies, log)
+	recipeHandler := handlers.NewRecipeHandler(recipeService, log)
+	posHandler := handlers.NewPOSHandler(posImportService, log)
+	purchasingHandler := handlers.NewPurchasingHandler(purchasingService, log)
+	reorderHandler := handlers.NewReorderHandler(reorderService, inventoryService, cfg.Reorder.VelocityDays, log)
+	stockCountHandler := handlers.NewStockCountHandler(stockCountService, log)
+	reportHandler := handlers.NewReportHandler(reportService, log)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService, log)
 
 	// Initialize router
 	r := chi.NewRouter()
@@ -69,8 +166,8 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Link", "ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -87,14 +184,37 @@ func main() {
 		// Public routes
 		r.Post("/auth/login", authHandler.Login)
 		r.Post("/auth/register", authHandler.Register)
+		r.Post("/auth/refresh", authHandler.Refresh)
+		r.Post("/auth/logout", authHandler.Logout)
+		r.Post("/auth/switch-organization", authHandler.SwitchOrganization)
 
 		// Protected routes
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
+			r.Use(middleware.AuthMiddleware(cfg.JWT.Secret, authService))
+			r.Use(middleware.LoadPermissions(permissionService))
 
 			// User profile
 			r.Get("/auth/profile", authHandler.GetProfile)
 			r.Post("/auth/change-password", authHandler.ChangePassword)
+			r.Get("/auth/permissions", permissionHandler.GetMyPermissions)
+
+			// Users and invitations
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Get("/users", userHandler.GetUsers)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Get("/users/invitations", userHandler.GetInvitations)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Post("/users/invitations", userHandler.InviteUser)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Delete("/users/invitations/{id}", userHandler.RevokeInvitation)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Get("/users/{id}", userHandler.GetUser)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Put("/users/{id}", userHandler.UpdateUser)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Delete("/users/{id}", userHandler.DeactivateUser)
+
+			// Organizations
+			r.Get("/organizations", orgHandler.GetOrganizations)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Post("/organizations", orgHandler.CreateOrganization)
+			r.Get("/organizations/current", orgHandler.GetCurrentOrganization)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Put("/organizations/current", orgHandler.UpdateCurrentOrganization)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Delete("/organizations/current", orgHandler.DeleteCurrentOrganization)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Post("/organizations/current/members", orgHandler.AddMember)
+			r.With(middleware.RequirePermission(domain.PermUsersManage)).Delete("/organizations/current/members/{id}", orgHandler.RemoveMember)
 
 			// Dashboard
 			r.Get("/dashboard/metrics", dashboardHandler.GetMetrics)
@@ -102,25 +222,107 @@ func main() {
 			r.Get("/dashboard/stock-trends", dashboardHandler.GetStockTrends)
 			r.Get("/dashboard/category-breakdown", dashboardHandler.GetCategoryBreakdown)
 			r.Get("/dashboard/low-stock", dashboardHandler.GetLowStockItems)
+			r.Get("/dashboard/locations", dashboardHandler.GetLocationBreakdown)
+			r.Get("/dashboard/expiring-lots", dashboardHandler.GetExpiringLots)
 			r.Get("/dashboard/alerts", dashboardHandler.GetAlerts)
 
 			// Categories
 			r.Get("/categories", inventoryHandler.GetCategories)
-			r.Post("/categories", inventoryHandler.CreateCategory)
-			r.Put("/categories/{id}", inventoryHandler.UpdateCategory)
-			r.Delete("/categories/{id}", inventoryHandler.DeleteCategory)
+			r.With(middleware.RequirePermission(domain.PermCategoriesManage)).Post("/categories", inventoryHandler.CreateCategory)
+			r.With(middleware.RequirePermission(domain.PermCategoriesManage)).Put("/categories/{id}", inventoryHandler.UpdateCategory)
+			r.With(middleware.RequirePermission(domain.PermCategoriesManage)).Delete("/categories/{id}", inventoryHandler.DeleteCategory)
+
+			// Locations
+			r.Get("/locations", inventoryHandler.GetLocations)
+			r.With(middleware.RequirePermission(domain.PermLocationsManage)).Post("/locations", inventoryHandler.CreateLocation)
+			r.With(middleware.RequirePermission(domain.PermLocationsManage)).Put("/locations/{id}", inventoryHandler.UpdateLocation)
+			r.With(middleware.RequirePermission(domain.PermLocationsManage)).Delete("/locations/{id}", inventoryHandler.DeleteLocation)
+
+			// Units
+			r.Get("/units", inventoryHandler.GetUnits)
+			r.With(middleware.RequirePermission(domain.PermUnitsManage)).Post("/units", inventoryHandler.CreateUnit)
+			r.With(middleware.RequirePermission(domain.PermUnitsManage)).Put("/units/{id}", inventoryHandler.UpdateUnit)
+			r.With(middleware.RequirePermission(domain.PermUnitsManage)).Delete("/units/{id}", inventoryHandler.DeleteUnit)
+
+			// Settings
+			r.Get("/settings/costing", inventoryHandler.GetCostingSettings)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Put("/settings/costing", inventoryHandler.UpdateCostingSettings)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Get("/settings/permissions", permissionHandler.GetPermissions)
+			r.With(middleware.RequirePermission(domain.PermSettingsManage)).Put("/settings/permissions/{role}", permissionHandler.UpdateRolePermissions)
+
+			// Movement reasons
+			r.Get("/movement-reasons", inventoryHandler.GetMovementReasons)
+			r.With(middleware.RequirePermission(domain.PermReasonsManage)).Post("/movement-reasons", inventoryHandler.CreateMovementReason)
+			r.With(middleware.RequirePermission(domain.PermReasonsManage)).Put("/movement-reasons/{id}", inventoryHandler.UpdateMovementReason)
 
 			// Items
 			r.Get("/items", inventoryHandler.GetItems)
-			r.Post("/items", inventoryHandler.CreateItem)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Post("/items", inventoryHandler.CreateItem)
 			r.Get("/items/{id}", inventoryHandler.GetItem)
-			r.Put("/items/{id}", inventoryHandler.UpdateItem)
-			r.Delete("/items/{id}", inventoryHandler.DeleteItem)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Put("/items/{id}", inventoryHandler.UpdateItem)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Delete("/items/{id}", inventoryHandler.DeleteItem)
+			r.Get("/items/{id}/stock", inventoryHandler.GetItemStock)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Put("/items/{id}/stock/{locationId}", inventoryHandler.UpdateItemStockThreshold)
+			r.Get("/items/{id}/lots", inventoryHandler.GetItemLots)
+			r.Get("/items/{id}/units", inventoryHandler.GetItemUnits)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Put("/items/{id}/units/{unit}", inventoryHandler.SetItemUnit)
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Delete("/items/{id}/units/{unit}", inventoryHandler.DeleteItemUnit)
 
 			// Stock movements
-			r.Post("/movements", movementHandler.CreateMovement)
+			r.With(middleware.RequirePermission(domain.PermMovementsCreate)).Post("/movements", movementHandler.CreateMovement)
+			r.With(middleware.RequirePermission(domain.PermMovementsCreate)).Post("/movements/bulk", movementHandler.BulkCreateMovements)
+			r.With(middleware.RequirePermission(domain.PermMovementsReverse)).Post("/movements/{id}/reverse", movementHandler.ReverseMovement)
 			r.Get("/movements", movementHandler.GetMovements)
 			r.Get("/items/{id}/movements", movementHandler.GetItemMovements)
+
+			// Recipes
+			r.Get("/recipes", recipeHandler.GetRecipes)
+			r.With(middleware.RequirePermission(domain.PermRecipesManage)).Post("/recipes", recipeHandler.CreateRecipe)
+			r.Get("/recipes/{id}", recipeHandler.GetRecipe)
+			r.With(middleware.RequirePermission(domain.PermRecipesManage)).Put("/recipes/{id}", recipeHandler.UpdateRecipe)
+			r.With(middleware.RequirePermission(domain.PermRecipesManage)).Delete("/recipes/{id}", recipeHandler.DeleteRecipe)
+			r.With(middleware.RequirePermission(domain.PermSalesRecord)).Post("/recipes/{id}/sales", recipeHandler.RecordSale)
+
+			// POS sales import
+			r.Get("/pos/mappings", posHandler.GetMappings)
+			r.With(middleware.RequirePermission(domain.PermPOSManage)).Put("/pos/mappings/{code}", posHandler.SetMapping)
+			r.With(middleware.RequirePermission(domain.PermPOSManage)).Delete("/pos/mappings/{code}", posHandler.DeleteMapping)
+			r.With(middleware.RequirePermission(domain.PermSalesRecord)).Post("/pos/imports", posHandler.ImportSales)
+
+			// Purchasing
+			r.Get("/suppliers", purchasingHandler.GetSuppliers)
+			r.With(middleware.RequirePermission(domain.PermSuppliersManage)).Post("/suppliers", purchasingHandler.CreateSupplier)
+			r.With(middleware.RequirePermission(domain.PermSuppliersManage)).Put("/suppliers/{id}", purchasingHandler.UpdateSupplier)
+			r.With(middleware.RequirePermission(domain.PermSuppliersManage)).Delete("/suppliers/{id}", purchasingHandler.DeleteSupplier)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Get("/purchase-orders", purchasingHandler.GetPurchaseOrders)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Post("/purchase-orders", purchasingHandler.CreatePurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Get("/purchase-orders/{id}", purchasingHandler.GetPurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Put("/purchase-orders/{id}", purchasingHandler.UpdatePurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Delete("/purchase-orders/{id}", purchasingHandler.DeletePurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Post("/purchase-orders/{id}/send", purchasingHandler.SendPurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Post("/purchase-orders/{id}/close", purchasingHandler.ClosePurchaseOrder)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Get("/purchase-orders/{id}/receipts", purchasingHandler.GetReceipts)
+			r.With(middleware.RequirePermission(domain.PermPurchasingManage)).Post("/purchase-orders/{id}/receipts", purchasingHandler.ReceivePurchaseOrder)
+
+			// Reordering
+			r.With(middleware.RequirePermission(domain.PermItemsWrite)).Put("/items/{id}/reorder-settings", reorderHandler.UpdateSettings)
+			r.With(middleware.RequirePermission(domain.PermReorderView)).Get("/reorder-suggestions", reorderHandler.GetSuggestions)
+
+			// Stock counts
+			r.Get("/stock-counts", stockCountHandler.GetStockCounts)
+			r.With(middleware.RequirePermission(domain.PermStockCountsManage)).Post("/stock-counts", stockCountHandler.CreateStockCount)
+			r.Get("/stock-counts/{id}", stockCountHandler.GetStockCount)
+			r.With(middleware.RequirePermission(domain.PermStockCountsCount)).Put("/stock-counts/{id}/counts", stockCountHandler.EnterCounts)
+			r.With(middleware.RequirePermission(domain.PermStockCountsManage)).Post("/stock-counts/{id}/approve", stockCountHandler.ApproveStockCount)
+			r.With(middleware.RequirePermission(domain.PermStockCountsManage)).Post("/stock-counts/{id}/cancel", stockCountHandler.CancelStockCount)
+
+			// Reports
+			r.With(middleware.RequirePermission(domain.PermReportsView), middleware.RequirePermission(domain.PermCostsView)).Get("/reports/wastage", reportHandler.GetWastageReport)
+			r.With(middleware.RequirePermission(domain.PermReportsView), middleware.RequirePermission(domain.PermCostsView)).Get("/reports/valuation", reportHandler.GetValuationReport)
+
+			// Ledger integrity
+			r.With(middleware.RequirePermission(domain.PermLedgerManage)).Get("/ledger/check", ledgerHandler.CheckLedger)
+			r.With(middleware.RequirePermission(domain.PermLedgerManage)).Post("/ledger/repair", ledgerHandler.RepairLedger)
 		})
 	})
 
@@ -161,6 +363,34 @@ func main() {
 
 	log.Info("Server starting on port " + cfg.Server.Port)
 
+	// Drop stored idempotent responses once they can no longer be replayed
+	// and refresh tokens once they have expired, alert on lots nearing their
+	// expiry date and on items due for reordering, and snapshot each day's
+	// opening stock. The jobs serve every organization at once.
+	expiryWindow := time.Duration(cfg.Expiry.AlertDays) * 24 * time.Hour
+	go func() {
+		ctx := repository.AllOrganizations(context.Background())
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := idempotencyService.PurgeExpired(ctx); err != nil {
+				log.Error("Failed to purge expired idempotency keys", err)
+			}
+			if _, err := authService.PurgeExpiredRefreshTokens(ctx); err != nil {
+				log.Error("Failed to purge expired refresh tokens", err)
+			}
+			if _, err := inventoryService.RaiseExpiryAlerts(ctx, expiryWindow); err != nil {
+				log.Error("Failed to raise expiry alerts", err)
+			}
+			if _, err := reorderService.RaiseReorderAlerts(ctx, cfg.Reorder.VelocityDays); err != nil {
+				log.Error("Failed to raise reorder alerts", err)
+			}
+			if _, err := reportService.TakeStockSnapshots(ctx, time.Now()); err != nil {
+				log.Error("Failed to take stock snapshots", err)
+			}
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
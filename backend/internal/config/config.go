@@ -18,8 +18,37 @@ type DBCfg struct {
 	DSN    string
 }
 
+// JWTCfg holds the signing secret and how long access tokens, in minutes,
+// and refresh tokens, in hours, are good for
 type JWTCfg struct {
-	Secret string
+	Secret           string
+	AccessTTLMinutes int
+	RefreshTTLHours  int
+}
+
+// InvitationCfg holds how many hours a user invitation can be accepted
+type InvitationCfg struct {
+	TTLHours int
+}
+
+type IdempotencyCfg struct {
+	RetentionHours int
+}
+
+type ExpiryCfg struct {
+	AlertDays int
+}
+
+type ReorderCfg struct {
+	VelocityDays int
+}
+
+// ReversalCfg holds how many hours after it was recorded each role can
+// reverse a movement
+type ReversalCfg struct {
+	AdminHours   int
+	ManagerHours int
+	UserHours    int
 }
 
 type CORS struct {
@@ -30,7 +59,12 @@ type Config struct {
 	Server      ServerCfg
 	Database    DBCfg
 	JWT         JWTCfg
+	Invitation  InvitationCfg
 	CORS        CORS
+	Idempotency IdempotencyCfg
+	Expiry      ExpiryCfg
+	Reorder     ReorderCfg
+	Reversal    ReversalCfg
 	ServeStatic bool
 	LogLevel    string
 }
@@ -41,15 +75,32 @@ func Load() Config {
 	writeTimeout := getEnvAsInt("SERVER_WRITE_TIMEOUT", 15)
 
 	driver := strings.ToLower(getEnv("DATABASE_DRIVER", "sqlite"))
-	if driver == "sqlite3" {
+	switch driver {
+	case "sqlite3":
 		driver = "sqlite"
+	case "postgresql", "pgx":
+		driver = "postgres"
 	}
 
 	defaultDSN := "file:./backend/data/inventory.db?_fk=1"
-	dsn := normalizeSQLiteDSN(getEnv("DATABASE_URL", defaultDSN))
+	dsn := getEnv("DATABASE_URL", defaultDSN)
+	if driver == "sqlite" {
+		dsn = normalizeSQLiteDSN(dsn)
+	}
 
 	jwtSecret := getEnv("JWT_SECRET", "change-me")
+	accessTTL := getEnvAsInt("JWT_ACCESS_TTL_MINUTES", 15)
+	refreshTTL := getEnvAsInt("JWT_REFRESH_TTL_HOURS", 720)
+	invitationTTL := getEnvAsInt("INVITATION_TTL_HOURS", 168)
 	corsOrigins := splitAndTrim(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173"))
+	idempotencyRetention := getEnvAsInt("IDEMPOTENCY_RETENTION_HOURS", 24)
+	expiryAlertDays := getEnvAsInt("EXPIRY_ALERT_DAYS", 2)
+	reorderVelocityDays := getEnvAsInt("REORDER_VELOCITY_DAYS", 28)
+	reversal := ReversalCfg{
+		AdminHours:   getEnvAsInt("REVERSAL_ADMIN_HOURS", 720),
+		ManagerHours: getEnvAsInt("REVERSAL_MANAGER_HOURS", 168),
+		UserHours:    getEnvAsInt("REVERSAL_USER_HOURS", 24),
+	}
 	serveStatic := getEnvAsBool("SERVE_STATIC", true)
 	logLevel := getEnv("LOG_LEVEL", "info")
 
@@ -61,8 +112,13 @@ func Load() Config {
 			Driver: driver,
 			DSN:    dsn,
 		},
-		JWT:         JWTCfg{Secret: jwtSecret},
+		JWT:         JWTCfg{Secret: jwtSecret, AccessTTLMinutes: accessTTL, RefreshTTLHours: refreshTTL},
+		Invitation:  InvitationCfg{TTLHours: invitationTTL},
 		CORS:        CORS{AllowedOrigins: corsOrigins},
+		Idempotency: IdempotencyCfg{RetentionHours: idempotencyRetention},
+		Expiry:      ExpiryCfg{AlertDays: expiryAlertDays},
+		Reorder:     ReorderCfg{VelocityDays: reorderVelocityDays},
+		Reversal:    reversal,
 		ServeStatic: serveStatic,
 		LogLevel:    logLevel,
 	}
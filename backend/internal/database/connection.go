@@ -3,20 +3,23 @@ package database
 import (
 	"database/sql"
 
-	_ "modernc.org/sqlite" // pure-Go sqlite driver
+	_ "github.com/jackc/pgx/v5/stdlib" // Postgres driver registered as "pgx"
+	_ "modernc.org/sqlite"             // pure-Go sqlite driver
 )
 
-// New creates a new database connection
-func New(cfgDSN string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", cfgDSN)
+// New creates a new database connection for the given dialect
+func New(dialect Dialect, cfgDSN string) (*sql.DB, error) {
+	db, err := sql.Open(dialect.DriverName(), cfgDSN)
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable foreign keys support for SQLite
-	if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		db.Close()
-		return nil, err
+	if dialect == DialectSQLite {
+		// Enable foreign keys support for SQLite
+		if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
 	// Set connection pool settings
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour of the configured database
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// ParseDialect maps a DATABASE_DRIVER value to a Dialect
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	case "postgres", "postgresql", "pgx":
+		return DialectPostgres, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// DriverName returns the database/sql driver registered for the dialect
+func (d Dialect) DriverName() string {
+	if d == DialectPostgres {
+		return "pgx"
+	}
+	return "sqlite"
+}
+
+// Rebind rewrites ? placeholders into the dialect's bind syntax.
+// Queries are written once with ? and rebound for Postgres as $1, $2, ...
+// Question marks inside single-quoted literals are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	inLiteral := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inLiteral = !inLiteral
+			b.WriteByte(c)
+		case c == '?' && !inLiteral:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// DateExpr returns an expression formatting a timestamp column as YYYY-MM-DD.
+// SQLite keeps timestamps as text, either as CURRENT_TIMESTAMP writes them or
+// as the driver formats a time.Time, which DATE() cannot parse; both start
+// with the date, and the repositories write UTC times.
+func (d Dialect) DateExpr(column string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("to_char(%s, 'YYYY-MM-DD')", column)
+	}
+	return fmt.Sprintf("substr(%s, 1, 10)", column)
+}
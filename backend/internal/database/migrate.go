@@ -0,0 +1,328 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is one numbered schema change with its up and down scripts
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies the migrations of one dialect and records the current
+// version in schema_migrations. The table layout matches golang-migrate
+// (a single version/dirty row) so databases migrated with the migrate CLI
+// are picked up where they left off.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// migrationLockKey is the Postgres advisory lock migrators hold while they run
+const migrationLockKey int64 = 0x6b6a5f6d696772 // "kj_migr"
+
+// execer runs statements on a transaction or a connection
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// NewMigrator loads the migrations for dialect from the <dialect>/ directory of fsys
+func NewMigrator(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// LoadMigrations reads NNNNNN_name.up.sql / .down.sql pairs, sorted by version
+func LoadMigrations(fsys fs.FS, dialect Dialect) ([]Migration, error) {
+	dir := string(dialect)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations for %s: %w", dialect, err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the loaded migrations in version order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Version returns the applied schema version, 0 for an empty database
+func (m *Migrator) Version(ctx context.Context) (uint64, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	return m.currentVersion(ctx, conn)
+}
+
+// Up applies every pending migration in order and returns how many ran.
+// Each migration runs in its own transaction together with the version bump.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureVersionTable(ctx, conn); err != nil {
+			return err
+		}
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current > 0 && m.indexOf(current) < 0 {
+			return fmt.Errorf("database is at version %d which is not a known migration", current)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Rollback reverts the last steps applied migrations and returns how many
+// ran. Nothing is reverted when one of them has no down script.
+func (m *Migrator) Rollback(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("rollback steps must be positive, got %d", steps)
+	}
+	rolledBack := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureVersionTable(ctx, conn); err != nil {
+			return err
+		}
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+		last := m.indexOf(current)
+		if last < 0 {
+			return fmt.Errorf("database is at version %d which is not a known migration", current)
+		}
+		first := last - steps + 1
+		if first < 0 {
+			first = 0
+		}
+		for _, migration := range m.migrations[first : last+1] {
+			if blankScript(migration.Down) {
+				return fmt.Errorf("migration %d_%s has no down script and can't be rolled back", migration.Version, migration.Name)
+			}
+		}
+
+		for idx := last; idx >= first; idx-- {
+			migration := m.migrations[idx]
+			var target uint64
+			if idx > 0 {
+				target = m.migrations[idx-1].Version
+			}
+			if err := m.apply(ctx, conn, migration.Down, target); err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// locked runs fn on a connection holding the migration lock, so server
+// instances starting together don't apply the same migration twice: the
+// later one waits and then finds the migrations applied. Postgres holds an
+// advisory lock for the run. SQLite has none, so the run is one exclusive
+// transaction, each migration a savepoint in it; migrations applied before
+// one that fails are kept, as on Postgres.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.dialect != DialectSQLite {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		return fn(conn)
+	}
+
+	// Wait for another migrator's run rather than fail on the locked file
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 60000"); err != nil {
+		return fmt.Errorf("failed to set busy timeout: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	runErr := fn(conn)
+	if _, err := conn.ExecContext(context.Background(), "COMMIT"); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		if runErr == nil {
+			runErr = fmt.Errorf("failed to commit migrations: %w", err)
+		}
+	}
+	return runErr
+}
+
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) currentVersion(ctx context.Context, conn *sql.Conn) (uint64, error) {
+	var version uint64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("database is marked dirty at version %d; fix the schema manually and reset the version", version)
+	}
+	return version, nil
+}
+
+// apply runs script and records version in the same transaction; version 0
+// clears the table.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, version uint64) error {
+	return m.step(ctx, conn, func(q execer) error {
+		if _, err := q.ExecContext(ctx, script); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+			return err
+		}
+		if version > 0 {
+			_, err := q.ExecContext(ctx,
+				m.dialect.Rebind("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)"), int64(version), false)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// step runs fn atomically on the locked connection: in a transaction of its
+// own on Postgres, in a savepoint of the run's transaction on SQLite
+func (m *Migrator) step(ctx context.Context, conn *sql.Conn, fn func(q execer) error) error {
+	if m.dialect != DialectSQLite {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := conn.ExecContext(ctx, "SAVEPOINT migration"); err != nil {
+		return fmt.Errorf("failed to begin savepoint: %w", err)
+	}
+	if err := fn(conn); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK TO migration")
+		conn.ExecContext(context.Background(), "RELEASE migration")
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "RELEASE migration")
+	return err
+}
+
+// blankScript reports whether script holds nothing but whitespace and
+// comments
+func blankScript(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Migrator) indexOf(version uint64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,318 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/migrations"
+)
+
+func openMigrateDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := "file:migrate_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "?mode=memory&cache=shared"
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func hasColumn(t *testing.T, db *sql.DB, table, column string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	if err != nil {
+		t.Fatalf("table info: %v", err)
+	}
+	return n > 0
+}
+
+func TestMigrator_UpIsIdempotentAndRollbackReverts(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrateDB(t)
+
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	total := len(m.Migrations())
+	latest := m.Migrations()[total-1].Version
+
+	n, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if n != total {
+		t.Fatalf("expected %d migrations applied, got %d", total, n)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("expected second up to be a no-op, got %d (%v)", n, err)
+	}
+	if v, _ := m.Version(ctx); v != latest {
+		t.Fatalf("expected version %d, got %d", latest, v)
+	}
+	if !hasColumn(t, db, "items", "track_stock") {
+		t.Fatalf("expected items.track_stock after up")
+	}
+
+	// Roll back to the initial schema, which predates items.track_stock
+	if n, err := m.Rollback(ctx, total-1); err != nil || n != total-1 {
+		t.Fatalf("rollback to initial schema: got %d (%v)", n, err)
+	}
+	if hasColumn(t, db, "items", "track_stock") {
+		t.Fatalf("expected items.track_stock to be dropped by rollback")
+	}
+	if v, _ := m.Version(ctx); v != m.Migrations()[0].Version {
+		t.Fatalf("expected version %d after rollback, got %d", m.Migrations()[0].Version, v)
+	}
+
+	if n, err := m.Up(ctx); err != nil || n != total-1 {
+		t.Fatalf("re-apply: got %d (%v)", n, err)
+	}
+
+	if n, err := m.Rollback(ctx, total+5); err != nil || n != total {
+		t.Fatalf("rollback all: expected %d, got %d (%v)", total, n, err)
+	}
+	if v, _ := m.Version(ctx); v != 0 {
+		t.Fatalf("expected version 0, got %d", v)
+	}
+	if hasColumn(t, db, "items", "id") {
+		t.Fatalf("expected items table to be dropped")
+	}
+}
+
+func TestMigrator_RefusesDirtyDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrateDB(t)
+
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL);
+		INSERT INTO schema_migrations (version, dirty) VALUES (1, TRUE);`); err != nil {
+		t.Fatalf("seed schema_migrations: %v", err)
+	}
+
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "dirty") {
+		t.Fatalf("expected dirty error, got %v", err)
+	}
+}
+
+func TestMigrator_FailedMigrationLeavesVersionUntouched(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrateDB(t)
+
+	fsys := fstest.MapFS{
+		"sqlite/000001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id TEXT PRIMARY KEY);")},
+		"sqlite/000001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"sqlite/000002_broken.up.sql":           {Data: []byte("ALTER TABLE widgets ADD COLUMN name TEXT; SELECT * FROM missing_table;")},
+		"sqlite/000002_broken.down.sql":         {Data: []byte("")},
+	}
+	m, err := database.NewMigrator(db, database.DialectSQLite, fsys)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+
+	n, err := m.Up(ctx)
+	if err == nil {
+		t.Fatalf("expected migration 2 to fail")
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 migration applied before the failure, got %d", n)
+	}
+	if v, _ := m.Version(ctx); v != 1 {
+		t.Fatalf("expected version 1, got %d", v)
+	}
+	if hasColumn(t, db, "widgets", "name") {
+		t.Fatalf("expected partial migration 2 to be rolled back")
+	}
+}
+
+func TestMigrator_ConcurrentUpAppliesOnce(t *testing.T) {
+	ctx := context.Background()
+	// Two servers share a database file; each opens its own pool
+	dsn := "file:" + filepath.Join(t.TempDir(), "inventory.db")
+
+	// Counting rows makes a migration applied twice visible
+	fsys := fstest.MapFS{
+		"sqlite/000001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE IF NOT EXISTS widgets (id TEXT);")},
+		"sqlite/000001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"sqlite/000002_add_widget.up.sql":       {Data: []byte("INSERT INTO widgets (id) VALUES ('w1');")},
+		"sqlite/000002_add_widget.down.sql":     {Data: []byte("DELETE FROM widgets;")},
+	}
+
+	const servers = 4
+	var wg sync.WaitGroup
+	applied := make([]int, servers)
+	errs := make([]error, servers)
+	for i := 0; i < servers; i++ {
+		db, err := database.New(database.DialectSQLite, dsn)
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := database.NewMigrator(db, database.DialectSQLite, fsys)
+		if err != nil {
+			t.Fatalf("new migrator: %v", err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			applied[i], errs[i] = m.Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range errs {
+		if errs[i] != nil {
+			t.Fatalf("server %d: %v", i, errs[i])
+		}
+		total += applied[i]
+	}
+	if total != 2 {
+		t.Errorf("expected the 2 migrations applied once between the servers, got %d", total)
+	}
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM widgets").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected 1 widget, got %d (%v)", n, err)
+	}
+}
+
+func TestMigrator_RollbackRefusesMissingDownScript(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrateDB(t)
+
+	fsys := fstest.MapFS{
+		"sqlite/000001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id TEXT PRIMARY KEY);")},
+		"sqlite/000001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"sqlite/000002_add_name.up.sql":         {Data: []byte("ALTER TABLE widgets ADD COLUMN name TEXT;")},
+		"sqlite/000002_add_name.down.sql":       {Data: []byte("-- irreversible\n")},
+		"sqlite/000003_add_size.up.sql":         {Data: []byte("ALTER TABLE widgets ADD COLUMN size INTEGER;")},
+		"sqlite/000003_add_size.down.sql":       {Data: []byte("ALTER TABLE widgets DROP COLUMN size;")},
+	}
+	m, err := database.NewMigrator(db, database.DialectSQLite, fsys)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	if n, err := m.Rollback(ctx, 2); err == nil || n != 0 || !strings.Contains(err.Error(), "no down script") {
+		t.Fatalf("expected the rollback refused, got %d (%v)", n, err)
+	}
+	if v, _ := m.Version(ctx); v != 3 {
+		t.Errorf("expected version 3 kept, got %d", v)
+	}
+	if !hasColumn(t, db, "widgets", "size") {
+		t.Errorf("expected nothing rolled back")
+	}
+	if n, err := m.Rollback(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("expected the last migration rolled back, got %d (%v)", n, err)
+	}
+}
+
+func TestLoadMigrations_RequiresUpScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"postgres/000001_init.down.sql": {Data: []byte("DROP TABLE x;")},
+	}
+	if _, err := database.LoadMigrations(fsys, database.DialectPostgres); err == nil {
+		t.Fatalf("expected error for migration without up script")
+	}
+}
+
+func TestMigrator_OpeningMovementsRebuildKeepsMovementLinks(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrateDB(t)
+
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO organizations (id, name, slug) VALUES ('org', 'Org', 'org');
+		INSERT INTO users (id, organization_id, email, password_hash, first_name, last_name)
+			VALUES ('user', 'org', 'a@example.com', 'x', 'A', 'B');
+		INSERT INTO categories (id, organization_id, name) VALUES ('cat', 'org', 'Dry');
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, current_stock)
+			VALUES ('item', 'org', 'cat', 'Rice', 'kg', 1000);
+		INSERT INTO locations (id, organization_id, name, is_default) VALUES ('loc', 'org', 'Main Store', TRUE);
+		INSERT INTO stock_movements (id, item_id, movement_type, quantity, previous_stock, new_stock, location_id, created_by)
+			VALUES ('opening', 'item', 'OPENING', 1500, 0, 1500, 'loc', 'user'),
+			       ('out', 'item', 'OUT', 500, 1500, 1000, 'loc', 'user');
+		INSERT INTO stock_movements (id, item_id, movement_type, quantity, previous_stock, new_stock, location_id, created_by, reversal_of)
+			VALUES ('undo', 'item', 'IN', 500, 1000, 1500, 'loc', 'user', 'out');
+		INSERT INTO stock_lots (id, item_id, location_id, received_at, initial_quantity, quantity, movement_id)
+			VALUES ('lot', 'item', 'loc', CURRENT_TIMESTAMP, 1500, 1000, 'opening');
+		INSERT INTO stock_movement_lots (movement_id, lot_id, quantity) VALUES ('out', 'lot', 500);
+		INSERT INTO cost_layers (id, item_id, movement_id, received_at, unit_cost, initial_quantity, quantity)
+			VALUES ('layer', 'item', 'opening', CURRENT_TIMESTAMP, 0.5, 1500, 1000);
+	`); err != nil {
+		t.Fatalf("seed movements: %v", err)
+	}
+
+	links := func() string {
+		var lot, layer, reversal, consumed string
+		err := db.QueryRow(`
+			SELECT
+				(SELECT movement_id FROM stock_lots WHERE id = 'lot'),
+				(SELECT movement_id FROM cost_layers WHERE id = 'layer'),
+				(SELECT reversal_of FROM stock_movements WHERE id = 'undo'),
+				(SELECT movement_id FROM stock_movement_lots WHERE lot_id = 'lot')
+		`).Scan(&lot, &layer, &reversal, &consumed)
+		if err != nil {
+			t.Fatalf("read links: %v", err)
+		}
+		return strings.Join([]string{lot, layer, reversal, consumed}, ",")
+	}
+
+	// Rolling back past 17 rebuilds the table without OPENING, and up
+	// rebuilds it again
+	steps := 0
+	for _, migration := range m.Migrations() {
+		if migration.Version >= 17 {
+			steps++
+		}
+	}
+	if n, err := m.Rollback(ctx, steps); err != nil || n != steps {
+		t.Fatalf("rollback: got %d (%v)", n, err)
+	}
+	var movementType string
+	if err := db.QueryRow(`SELECT movement_type FROM stock_movements WHERE id = 'opening'`).Scan(&movementType); err != nil || movementType != "IN" {
+		t.Fatalf("expected the OPENING movement to become IN, got %q (%v)", movementType, err)
+	}
+	if got := links(); got != "opening,opening,out,out" {
+		t.Fatalf("expected the links to movements to survive the rollback, got %s", got)
+	}
+
+	if n, err := m.Up(ctx); err != nil || n != steps {
+		t.Fatalf("up: got %d (%v)", n, err)
+	}
+	if got := links(); got != "opening,opening,out,out" {
+		t.Fatalf("expected the links to movements to survive the rebuild, got %s", got)
+	}
+	if _, err := db.Exec(`INSERT INTO stock_movements (item_id, movement_type, quantity, previous_stock, new_stock, created_by)
+		VALUES ('item', 'OPENING', 0, 0, 0, 'user')`); err != nil {
+		t.Fatalf("expected OPENING to be allowed after up: %v", err)
+	}
+}
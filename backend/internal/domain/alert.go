@@ -11,6 +11,10 @@ type AlertType string
 const (
 	AlertTypeLowStock   AlertType = "LOW_STOCK"
 	AlertTypeOutOfStock AlertType = "OUT_OF_STOCK"
+	// AlertTypeExpiry warns about a stock lot that has expired or is about to
+	AlertTypeExpiry AlertType = "EXPIRY"
+	// AlertTypeReorder suggests ordering an item that reached its reorder point
+	AlertTypeReorder AlertType = "REORDER"
 )
 
 type AlertSeverity string
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CostingMethod is how an organization costs the stock it uses
+type CostingMethod string
+
+const (
+	// CostingFIFO consumes the oldest cost layer first
+	CostingFIFO CostingMethod = "FIFO"
+	// CostingWeightedAverage keeps the item's stock at the moving average of
+	// what it cost, recomputed whenever stock comes in
+	CostingWeightedAverage CostingMethod = "WEIGHTED_AVERAGE"
+)
+
+// CostLayer is stock of an item at the cost it came in at. Stock coming in
+// adds a layer and stock going out consumes layers, so the open layers of an
+// item value its stock. Quantity is in base units and UnitCost is per base
+// unit. A layer without a movement holds the stock the item had when costing
+// started, at the item's unit cost.
+type CostLayer struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ItemID          uuid.UUID  `json:"itemId" db:"item_id"`
+	MovementID      *uuid.UUID `json:"movementId" db:"movement_id"`
+	ReceivedAt      time.Time  `json:"receivedAt" db:"received_at"`
+	UnitCost        float64    `json:"unitCost" db:"unit_cost"`
+	InitialQuantity int        `json:"initialQuantity" db:"initial_quantity"`
+	Quantity        int        `json:"quantity" db:"quantity"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// CostingSettings is how the organization costs its stock
+type CostingSettings struct {
+	Method CostingMethod `json:"method"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key. Keys are scoped to the organization and user that sent them.
+type IdempotencyRecord struct {
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	Key            string    `json:"key" db:"idempotency_key"`
+	RequestHash    string    `json:"requestHash" db:"request_hash"`
+	ResponseStatus int       `json:"responseStatus" db:"response_status"`
+	ResponseBody   []byte    `json:"responseBody" db:"response_body"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
@@ -18,9 +18,16 @@ type Item struct {
 	UnitCost          *float64  `json:"unitCost" db:"unit_cost"`
 	IsActive          bool      `json:"isActive" db:"is_active"`
 	TrackStock        bool      `json:"trackStock" db:"track_stock"`
+	Version           int       `json:"version" db:"version"`
 	CreatedAt         time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt         time.Time `json:"updatedAt" db:"updated_at"`
 
+	// Reorder settings. ParLevel is in base units; LeadTimeDays, when set,
+	// overrides the lead time of the preferred supplier
+	ParLevel            *int       `json:"parLevel" db:"par_level"`
+	LeadTimeDays        *int       `json:"leadTimeDays" db:"lead_time_days"`
+	PreferredSupplierID *uuid.UUID `json:"preferredSupplierId" db:"preferred_supplier_id"`
+
 	// Joined fields
 	Category *Category `json:"category,omitempty"`
 }
@@ -48,12 +55,34 @@ type UpdateItemRequest struct {
 	IsActive          *bool      `json:"isActive"`
 }
 
+// BulkAdjustLine is a single stock movement within a bulk adjustment.
+// Quantity, unit, locations, lot fields, reason and unit cost follow the same
+// rules as CreateMovementRequest: a positive delta for IN/OUT/TRANSFER and the
+// exact new stock at the location for ADJUSTMENT, in base units unless Unit
+// is set.
+type BulkAdjustLine struct {
+	ItemID       uuid.UUID    `json:"itemId" validate:"required"`
+	MovementType MovementType `json:"movementType" validate:"required"`
+	Quantity     int          `json:"quantity" validate:"gte=0"`
+	Unit         *string      `json:"unit"`
+	LocationID   *uuid.UUID   `json:"locationId"`
+	ToLocationID *uuid.UUID   `json:"toLocationId"`
+	LotNumber    *string      `json:"lotNumber"`
+	ReceivedAt   *time.Time   `json:"receivedAt"`
+	ExpiresAt    *time.Time   `json:"expiresAt"`
+	Reference    *string      `json:"reference"`
+	Notes        *string      `json:"notes"`
+	ReasonCode   *string      `json:"reasonCode"`
+	UnitCost     *float64     `json:"unitCost"`
+}
+
 type BulkAdjustRequest struct {
-	Adjustments []struct {
-		ItemID   uuid.UUID `json:"itemId" validate:"required"`
-		Quantity int       `json:"quantity" validate:"required"`
-		Notes    *string   `json:"notes"`
-	} `json:"adjustments" validate:"required,min=1"`
+	// Reference is applied to every line that does not carry its own
+	Reference   *string          `json:"reference"`
+	Adjustments []BulkAdjustLine `json:"adjustments" validate:"required,min=1"`
+	// OccurredAt is when the stock moved, for movements recorded after the
+	// fact such as imported sales; it defaults to now
+	OccurredAt *time.Time `json:"-"`
 }
 
 type PaginatedItemsResponse struct {
@@ -18,25 +18,32 @@ type ItemDisplay struct {
 	UnitCost          *float64 `json:"unitCost"`
 	IsActive          bool     `json:"isActive"`
 	TrackStock        bool     `json:"trackStock"`
+	Version           int      `json:"version"`
 	CreatedAt         string   `json:"createdAt"`
 	UpdatedAt         string   `json:"updatedAt"`
 	Category          *Category `json:"category,omitempty"`
+
+	// Reorder settings; ParLevel is converted to display unit
+	ParLevel            *float64 `json:"parLevel"`
+	LeadTimeDays        *int     `json:"leadTimeDays"`
+	PreferredSupplierID *string  `json:"preferredSupplierId"`
 }
 
-// ToDisplay converts an Item from base units to display units
-func (i *Item) ToDisplay() (*ItemDisplay, error) {
+// ToDisplay converts an Item from base units to display units, resolving
+// its unit in registry; a nil registry knows only the built-in units
+func (i *Item) ToDisplay(registry *units.Registry) (*ItemDisplay, error) {
 	// Convert stock values from base unit to display unit
-	displayStock, err := units.FromBaseUnit(i.CurrentStock, i.UnitOfMeasurement)
+	displayStock, err := registry.FromBaseUnit(i.CurrentStock, i.UnitOfMeasurement)
 	if err != nil {
 		return nil, err
 	}
 
-	displayThreshold, err := units.FromBaseUnit(i.MinimumThreshold, i.UnitOfMeasurement)
+	displayThreshold, err := registry.FromBaseUnit(i.MinimumThreshold, i.UnitOfMeasurement)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ItemDisplay{
+	display := &ItemDisplay{
 		ID:                i.ID.String(),
 		OrganizationID:    i.OrganizationID.String(),
 		CategoryID:        i.CategoryID.String(),
@@ -48,25 +55,41 @@ func (i *Item) ToDisplay() (*ItemDisplay, error) {
 		UnitCost:          i.UnitCost,
 		IsActive:          i.IsActive,
 		TrackStock:        i.TrackStock,
+		Version:           i.Version,
 		CreatedAt:         i.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:         i.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		Category:          i.Category,
-	}, nil
+		LeadTimeDays:      i.LeadTimeDays,
+	}
+
+	if i.ParLevel != nil {
+		displayPar, err := registry.FromBaseUnit(*i.ParLevel, i.UnitOfMeasurement)
+		if err != nil {
+			return nil, err
+		}
+		display.ParLevel = &displayPar
+	}
+	if i.PreferredSupplierID != nil {
+		supplierID := i.PreferredSupplierID.String()
+		display.PreferredSupplierID = &supplierID
+	}
+
+	return display, nil
 }
 
 // GetDisplayStock returns the current stock in display units
-func (i *Item) GetDisplayStock() (float64, error) {
-	return units.FromBaseUnit(i.CurrentStock, i.UnitOfMeasurement)
+func (i *Item) GetDisplayStock(registry *units.Registry) (float64, error) {
+	return registry.FromBaseUnit(i.CurrentStock, i.UnitOfMeasurement)
 }
 
 // GetDisplayThreshold returns the minimum threshold in display units
-func (i *Item) GetDisplayThreshold() (float64, error) {
-	return units.FromBaseUnit(i.MinimumThreshold, i.UnitOfMeasurement)
+func (i *Item) GetDisplayThreshold(registry *units.Registry) (float64, error) {
+	return registry.FromBaseUnit(i.MinimumThreshold, i.UnitOfMeasurement)
 }
 
 // SetStockFromDisplay sets the current stock from a display value
-func (i *Item) SetStockFromDisplay(displayValue float64) error {
-	baseValue, err := units.ToBaseUnit(displayValue, i.UnitOfMeasurement)
+func (i *Item) SetStockFromDisplay(registry *units.Registry, displayValue float64) error {
+	baseValue, err := registry.ToBaseUnit(displayValue, i.UnitOfMeasurement)
 	if err != nil {
 		return err
 	}
@@ -75,8 +98,8 @@ func (i *Item) SetStockFromDisplay(displayValue float64) error {
 }
 
 // SetThresholdFromDisplay sets the minimum threshold from a display value
-func (i *Item) SetThresholdFromDisplay(displayValue float64) error {
-	baseValue, err := units.ToBaseUnit(displayValue, i.UnitOfMeasurement)
+func (i *Item) SetThresholdFromDisplay(registry *units.Registry, displayValue float64) error {
+	baseValue, err := registry.ToBaseUnit(displayValue, i.UnitOfMeasurement)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LedgerIssueType is how an item's movements fail to account for its stock
+type LedgerIssueType string
+
+const (
+	// LedgerIssueGap is stock the ledger does not account for: the first
+	// movement does not start from zero, or an item with stock has none
+	LedgerIssueGap LedgerIssueType = "GAP"
+	// LedgerIssueBreak is a movement that does not start where the one
+	// before it ended
+	LedgerIssueBreak LedgerIssueType = "BREAK"
+	// LedgerIssueMismatch is an item whose current stock is not where its
+	// last movement ended
+	LedgerIssueMismatch LedgerIssueType = "MISMATCH"
+	// LedgerIssueLocationMismatch is an item whose stock levels do not add
+	// up to its current stock
+	LedgerIssueLocationMismatch LedgerIssueType = "LOCATION_MISMATCH"
+)
+
+// LedgerRepairReference is the reference of the movements posted to repair
+// the ledger
+const LedgerRepairReference = "LEDGER_REPAIR"
+
+// LedgerItem is an item whose ledger is checked. LocationStock is the sum of
+// its stock levels.
+type LedgerItem struct {
+	ID             uuid.UUID `db:"id"`
+	OrganizationID uuid.UUID `db:"organization_id"`
+	Name           string    `db:"name"`
+	CurrentStock   int       `db:"current_stock"`
+	LocationStock  int       `db:"location_stock"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// LedgerIssue is one place an item's ledger and stock disagree. Expected is
+// the stock the ledger leads to and Actual the stock found instead, in base
+// units; for LOCATION_MISMATCH they are the item's stock and the sum of its
+// stock levels. MovementID is the movement the issue was found at, and Repair the
+// movement posted to close it.
+type LedgerIssue struct {
+	Type       LedgerIssueType `json:"type"`
+	ItemID     uuid.UUID       `json:"itemId"`
+	ItemName   string          `json:"itemName"`
+	MovementID *uuid.UUID      `json:"movementId"`
+	Expected   int             `json:"expected"`
+	Actual     int             `json:"actual"`
+	Repair     *StockMovement  `json:"repair,omitempty"`
+}
+
+// LedgerCheck is the result of replaying the ledger of every item of an
+// organization
+type LedgerCheck struct {
+	OrganizationID   uuid.UUID      `json:"organizationId"`
+	CheckedAt        time.Time      `json:"checkedAt"`
+	ItemsChecked     int            `json:"itemsChecked"`
+	MovementsChecked int            `json:"movementsChecked"`
+	Repaired         bool           `json:"repaired"`
+	Issues           []*LedgerIssue `json:"issues"`
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Location is a place stock is kept, such as a walk-in cooler, dry store or
+// the line. Every organization has one default location that receives
+// movements which do not name a location.
+type Location struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Name           string    `json:"name" db:"name" validate:"required,min=1,max=100"`
+	Description    *string   `json:"description" db:"description"`
+	IsDefault      bool      `json:"isDefault" db:"is_default"`
+	IsActive       bool      `json:"isActive" db:"is_active"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreateLocationRequest struct {
+	Name        string  `json:"name" validate:"required,min=1,max=100"`
+	Description *string `json:"description"`
+	IsDefault   bool    `json:"isDefault"`
+}
+
+type UpdateLocationRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description"`
+	IsDefault   *bool   `json:"isDefault"`
+	IsActive    *bool   `json:"isActive"`
+}
+
+// StockLevel is the stock of one item at one location, in base units.
+// MinimumThreshold is an optional par for the location; when it is nil the
+// item's own threshold applies.
+type StockLevel struct {
+	ItemID           uuid.UUID `json:"itemId" db:"item_id"`
+	LocationID       uuid.UUID `json:"locationId" db:"location_id"`
+	Quantity         int       `json:"quantity" db:"quantity"`
+	MinimumThreshold *int      `json:"minimumThreshold" db:"minimum_threshold"`
+	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
+
+	// Joined fields
+	LocationName string `json:"locationName,omitempty"`
+}
+
+type UpdateStockLevelRequest struct {
+	MinimumThreshold *int `json:"minimumThreshold" validate:"omitempty,gte=0"`
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StockLot is a quantity of an item received at a location in one delivery.
+// Every IN movement creates a lot; OUT movements consume the lots of their
+// location first-expiry-first-out. Quantity is what is left of the lot, in
+// base units. Stock recorded before lots existed, or added by an upward
+// ADJUSTMENT, is not part of any lot.
+type StockLot struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ItemID          uuid.UUID  `json:"itemId" db:"item_id"`
+	LocationID      uuid.UUID  `json:"locationId" db:"location_id"`
+	LotNumber       *string    `json:"lotNumber" db:"lot_number"`
+	ReceivedAt      time.Time  `json:"receivedAt" db:"received_at"`
+	ExpiresAt       *time.Time `json:"expiresAt" db:"expires_at"`
+	InitialQuantity int        `json:"initialQuantity" db:"initial_quantity"`
+	Quantity        int        `json:"quantity" db:"quantity"`
+	MovementID      *uuid.UUID `json:"movementId" db:"movement_id"`
+	ExpiryAlertedAt *time.Time `json:"-" db:"expiry_alerted_at"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+
+	// Joined fields
+	OrganizationID    uuid.UUID `json:"organizationId,omitempty"`
+	ItemName          string    `json:"itemName,omitempty"`
+	LocationName      string    `json:"locationName,omitempty"`
+	UnitOfMeasurement string    `json:"unitOfMeasurement,omitempty"`
+}
+
+// MovementLot is the part of a movement's quantity taken from or added to
+// one lot
+type MovementLot struct {
+	LotID     uuid.UUID  `json:"lotId"`
+	Quantity  int        `json:"quantity"`
+	LotNumber *string    `json:"lotNumber"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -12,8 +12,19 @@ const (
 	MovementTypeIn         MovementType = "IN"
 	MovementTypeOut        MovementType = "OUT"
 	MovementTypeAdjustment MovementType = "ADJUSTMENT"
+	// MovementTypeTransfer moves stock between two locations of the same
+	// item; the item's total stock does not change
+	MovementTypeTransfer MovementType = "TRANSFER"
+	// MovementTypeOpening brings in the stock an item was created with. It
+	// is posted by item creation only.
+	MovementTypeOpening MovementType = "OPENING"
 )
 
+// UnitConversionReference is the reference of the ADJUSTMENT recording that
+// an item's unit of measurement changed. Stock is kept in base units, which
+// the old and new unit share, so the movement leaves the stock as it was.
+const UnitConversionReference = "UNIT_CONVERSION"
+
 type StockMovement struct {
 	ID            uuid.UUID    `json:"id" db:"id"`
 	ItemID        uuid.UUID    `json:"itemId" db:"item_id"`
@@ -21,19 +32,66 @@ type StockMovement struct {
 	Quantity      int          `json:"quantity" db:"quantity" validate:"required"`
 	PreviousStock int          `json:"previousStock" db:"previous_stock"`
 	NewStock      int          `json:"newStock" db:"new_stock"`
+	LocationID    *uuid.UUID   `json:"locationId" db:"location_id"`
+	ToLocationID  *uuid.UUID   `json:"toLocationId,omitempty" db:"to_location_id"`
 	Reference     *string      `json:"reference" db:"reference"`
 	Notes         *string      `json:"notes" db:"notes"`
+	ReasonCode    *string      `json:"reasonCode" db:"reason_code"`
 	CreatedBy     uuid.UUID    `json:"createdBy" db:"created_by"`
 	CreatedAt     time.Time    `json:"createdAt" db:"created_at"`
 
+	// RecordedAt is when the movement was written. It is later than
+	// CreatedAt for stock that moved before it was recorded, such as sales
+	// imported from the POS; previous and new stock chain in recorded order.
+	RecordedAt time.Time `json:"-" db:"recorded_at"`
+
+	// ReversalOf is the movement a reversal undoes. A reversed movement is
+	// kept and marked voided; voided movements and reversals are left out of
+	// consumption and wastage figures.
+	ReversalOf *uuid.UUID `json:"reversalOf,omitempty" db:"reversal_of"`
+	VoidedAt   *time.Time `json:"voidedAt,omitempty" db:"voided_at"`
+	VoidedBy   *uuid.UUID `json:"voidedBy,omitempty" db:"voided_by"`
+
+	// TotalCost is what the stock the movement brought in or took out cost,
+	// valued at the item's cost layers; for OUT it is the cost of goods used.
+	// Transfers and movements recorded before costing have none.
+	TotalCost *float64 `json:"totalCost,omitempty" db:"total_cost"`
+
+	// Lots received or consumed by the movement, set when it is created
+	Lots []*MovementLot `json:"lots,omitempty"`
+
 	// Joined fields
 	Item *Item `json:"item,omitempty"`
 }
 
+// CreateMovementRequest describes one stock movement in base units, or in
+// whole Units when Unit is set: a unit of the organization or a purchase unit
+// of the item, such as cases of 24 pcs. LocationID defaults to the
+// organization's default location. For TRANSFER, LocationID is the source
+// and ToLocationID the destination. The lot fields only apply to IN, which
+// receives the quantity as a new lot. ReasonCode only applies to OUT and
+// names an active reason of the organization, such as WASTE_SPOILED; OUT
+// without a reason is usage. UnitCost also only applies to IN: the cost per
+// unit of the item's unit of measurement of the stock received, which
+// defaults to the item's unit cost.
 type CreateMovementRequest struct {
 	ItemID       uuid.UUID    `json:"itemId" validate:"required"`
 	MovementType MovementType `json:"movementType" validate:"required"`
 	Quantity     int          `json:"quantity" validate:"required"`
+	Unit         *string      `json:"unit"`
+	LocationID   *uuid.UUID   `json:"locationId"`
+	ToLocationID *uuid.UUID   `json:"toLocationId"`
+	LotNumber    *string      `json:"lotNumber"`
+	ReceivedAt   *time.Time   `json:"receivedAt"`
+	ExpiresAt    *time.Time   `json:"expiresAt"`
 	Reference    *string      `json:"reference"`
 	Notes        *string      `json:"notes"`
+	ReasonCode   *string      `json:"reasonCode"`
+	UnitCost     *float64     `json:"unitCost"`
+}
+
+// ReverseMovementRequest carries the notes recorded on a reversal, such as
+// why the original movement was wrong
+type ReverseMovementRequest struct {
+	Notes *string `json:"notes"`
 }
@@ -12,6 +12,8 @@ type StockMovementDisplay struct {
 	Quantity      float64      `json:"quantity"`      // Converted to display unit
 	PreviousStock float64      `json:"previousStock"` // Converted to display unit
 	NewStock      float64      `json:"newStock"`      // Converted to display unit
+	LocationID    *string      `json:"locationId"`
+	ToLocationID  *string      `json:"toLocationId,omitempty"`
 	Reference     *string      `json:"reference"`
 	Notes         *string      `json:"notes"`
 	CreatedBy     string       `json:"createdBy"`
@@ -20,20 +22,20 @@ type StockMovementDisplay struct {
 }
 
 // ToDisplay converts a StockMovement from base units to display units
-// Requires the unit of measurement to perform conversion
-func (sm *StockMovement) ToDisplay(unitOfMeasurement string) (*StockMovementDisplay, error) {
+// Requires the unit of measurement, resolved in registry, to perform conversion
+func (sm *StockMovement) ToDisplay(registry *units.Registry, unitOfMeasurement string) (*StockMovementDisplay, error) {
 	// Convert quantities from base unit to display unit
-	displayQuantity, err := units.FromBaseUnit(sm.Quantity, unitOfMeasurement)
+	displayQuantity, err := registry.FromBaseUnit(sm.Quantity, unitOfMeasurement)
 	if err != nil {
 		return nil, err
 	}
 
-	displayPreviousStock, err := units.FromBaseUnit(sm.PreviousStock, unitOfMeasurement)
+	displayPreviousStock, err := registry.FromBaseUnit(sm.PreviousStock, unitOfMeasurement)
 	if err != nil {
 		return nil, err
 	}
 
-	displayNewStock, err := units.FromBaseUnit(sm.NewStock, unitOfMeasurement)
+	displayNewStock, err := registry.FromBaseUnit(sm.NewStock, unitOfMeasurement)
 	if err != nil {
 		return nil, err
 	}
@@ -50,10 +52,18 @@ func (sm *StockMovement) ToDisplay(unitOfMeasurement string) (*StockMovementDisp
 		CreatedBy:     sm.CreatedBy.String(),
 		CreatedAt:     sm.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
+	if sm.LocationID != nil {
+		locationID := sm.LocationID.String()
+		display.LocationID = &locationID
+	}
+	if sm.ToLocationID != nil {
+		toLocationID := sm.ToLocationID.String()
+		display.ToLocationID = &toLocationID
+	}
 
 	// Convert joined item if present
 	if sm.Item != nil {
-		itemDisplay, err := sm.Item.ToDisplay()
+		itemDisplay, err := sm.Item.ToDisplay(registry)
 		if err != nil {
 			return nil, err
 		}
@@ -68,6 +78,8 @@ type CreateMovementRequestDisplay struct {
 	ItemID       string       `json:"itemId" validate:"required"`
 	MovementType MovementType `json:"movementType" validate:"required"`
 	Quantity     float64      `json:"quantity" validate:"required"`
+	LocationID   *string      `json:"locationId"`
+	ToLocationID *string      `json:"toLocationId"`
 	Reference    *string      `json:"reference"`
 	Notes        *string      `json:"notes"`
 }
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MovementReason is why stock left other than through sales or production,
+// such as spoilage, a staff meal or theft. OUT movements carry the reason's
+// Code; IsWaste marks the reasons that count as food waste in the wastage
+// report. A reason is deactivated rather than deleted, so movements recorded
+// with it keep their meaning.
+type MovementReason struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Code           string    `json:"code" db:"code"`
+	Name           string    `json:"name" db:"name"`
+	IsWaste        bool      `json:"isWaste" db:"is_waste"`
+	IsActive       bool      `json:"isActive" db:"is_active"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// DefaultMovementReasons are the reasons an organization starts with
+var DefaultMovementReasons = []MovementReason{
+	{Code: "WASTE_SPOILED", Name: "Spoiled", IsWaste: true},
+	{Code: "WASTE_DROPPED", Name: "Dropped or spilled", IsWaste: true},
+	{Code: "STAFF_MEAL", Name: "Staff meal"},
+	{Code: "COMP", Name: "Complimentary"},
+	{Code: "THEFT", Name: "Theft"},
+}
+
+// CreateMovementReasonRequest defines a reason. Codes are upper case letters,
+// digits and underscores.
+type CreateMovementReasonRequest struct {
+	Code    string `json:"code" validate:"required,min=1,max=30"`
+	Name    string `json:"name" validate:"required,min=1,max=100"`
+	IsWaste bool   `json:"isWaste"`
+}
+
+// UpdateMovementReasonRequest renames a reason, changes whether it counts as
+// waste or (de)activates it. The code is fixed once created.
+type UpdateMovementReasonRequest struct {
+	Name     *string `json:"name" validate:"omitempty,min=1,max=100"`
+	IsWaste  *bool   `json:"isWaste"`
+	IsActive *bool   `json:"isActive"`
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is one outlet of the group: it holds its own stock, recipes,
+// suppliers and settings. Users belong to organizations through
+// memberships and work in one of them at a time.
+type Organization struct {
+	ID       uuid.UUID            `json:"id" db:"id"`
+	Name     string               `json:"name" db:"name"`
+	Slug     string               `json:"slug" db:"slug"`
+	Settings OrganizationSettings `json:"settings" db:"settings"`
+	// Role is the caller's role in the organization, set when organizations
+	// are listed for a user
+	Role      UserRole  `json:"role,omitempty" db:"-"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// OrganizationSettings are the organization's preferences. Currency and
+// timezone are kept in the settings column; the costing method has a column
+// of its own, as stock costing reads it.
+type OrganizationSettings struct {
+	// Currency is the ISO 4217 code of the currency costs are in
+	Currency string `json:"currency"`
+	// Timezone is the IANA name of the timezone the organization works in
+	Timezone      string        `json:"timezone"`
+	CostingMethod CostingMethod `json:"costingMethod"`
+}
+
+// DefaultOrganizationSettings are used for the settings an organization
+// leaves unset
+var DefaultOrganizationSettings = OrganizationSettings{
+	Currency:      "INR",
+	Timezone:      "UTC",
+	CostingMethod: CostingFIFO,
+}
+
+// WithDefaults returns the settings with the ones left unset defaulted
+func (s OrganizationSettings) WithDefaults() OrganizationSettings {
+	if s.Currency == "" {
+		s.Currency = DefaultOrganizationSettings.Currency
+	}
+	if s.Timezone == "" {
+		s.Timezone = DefaultOrganizationSettings.Timezone
+	}
+	if s.CostingMethod == "" {
+		s.CostingMethod = DefaultOrganizationSettings.CostingMethod
+	}
+	return s
+}
+
+// Membership makes a user a member of an organization, with a role there.
+// A deactivated member keeps their membership but can't work in the
+// organization.
+type Membership struct {
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	Role           UserRole  `json:"role" db:"role"`
+	IsActive       bool      `json:"isActive" db:"is_active"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// CreateOrganizationRequest creates an organization; the slug is derived
+// from the name unless given, and settings left out are defaulted
+type CreateOrganizationRequest struct {
+	Name     string                      `json:"name" validate:"required"`
+	Slug     string                      `json:"slug"`
+	Settings *UpdateOrganizationSettings `json:"settings"`
+}
+
+// UpdateOrganizationRequest changes the caller's organization; fields left
+// out are kept
+type UpdateOrganizationRequest struct {
+	Name     *string                     `json:"name" validate:"omitempty,min=1"`
+	Slug     *string                     `json:"slug"`
+	Settings *UpdateOrganizationSettings `json:"settings"`
+}
+
+// UpdateOrganizationSettings changes organization settings; fields left out
+// are kept
+type UpdateOrganizationSettings struct {
+	Currency      *string        `json:"currency"`
+	Timezone      *string        `json:"timezone"`
+	CostingMethod *CostingMethod `json:"costingMethod"`
+}
+
+// AddMemberRequest adds an existing user, by email, to the caller's
+// organization with a role, USER unless given. People without an account
+// are invited instead.
+type AddMemberRequest struct {
+	Email string   `json:"email" validate:"required,email"`
+	Role  UserRole `json:"role"`
+}
@@ -0,0 +1,155 @@
+package domain
+
+import "sort"
+
+// Permission is something a role may do. Each role holds a default set of
+// permissions, which an organization can override for every role but ADMIN.
+type Permission string
+
+const (
+	PermItemsWrite        Permission = "items.write"
+	PermCategoriesManage  Permission = "categories.manage"
+	PermLocationsManage   Permission = "locations.manage"
+	PermUnitsManage       Permission = "units.manage"
+	PermReasonsManage     Permission = "reasons.manage"
+	PermMovementsCreate   Permission = "movements.create"
+	PermMovementsAdjust   Permission = "movements.adjust"
+	PermMovementsReverse  Permission = "movements.reverse"
+	PermRecipesManage     Permission = "recipes.manage"
+	PermSalesRecord       Permission = "sales.record"
+	PermPOSManage         Permission = "pos.manage"
+	PermSuppliersManage   Permission = "suppliers.manage"
+	PermPurchasingManage  Permission = "purchasing.manage"
+	PermReorderView       Permission = "reorder.view"
+	PermStockCountsCount  Permission = "stockcounts.count"
+	PermStockCountsManage Permission = "stockcounts.manage"
+	PermCostsView         Permission = "costs.view"
+	PermReportsView       Permission = "reports.view"
+	PermLedgerManage      Permission = "ledger.manage"
+	PermSettingsManage    Permission = "settings.manage"
+	PermUsersManage       Permission = "users.manage"
+)
+
+// Permissions lists every permission with what it allows
+var Permissions = []PermissionInfo{
+	{PermItemsWrite, "Create, change and delete items, their units, thresholds and reorder settings"},
+	{PermCategoriesManage, "Create, change and delete categories"},
+	{PermLocationsManage, "Create, change and delete locations"},
+	{PermUnitsManage, "Create, change and delete units"},
+	{PermReasonsManage, "Create and change movement reasons"},
+	{PermMovementsCreate, "Record stock movements"},
+	{PermMovementsAdjust, "Record ADJUSTMENT movements"},
+	{PermMovementsReverse, "Reverse movements, within the reversal window of the role"},
+	{PermRecipesManage, "Create, change and delete recipes"},
+	{PermSalesRecord, "Record recipe sales and import POS sales"},
+	{PermPOSManage, "Map POS item codes to recipes"},
+	{PermSuppliersManage, "Create, change and delete suppliers"},
+	{PermPurchasingManage, "Manage purchase orders and receive goods"},
+	{PermReorderView, "View reorder suggestions"},
+	{PermStockCountsCount, "Enter counted quantities on stock counts"},
+	{PermStockCountsManage, "Start, approve and cancel stock counts"},
+	{PermCostsView, "See unit costs and the cost of movements and counts"},
+	{PermReportsView, "View wastage and valuation reports"},
+	{PermLedgerManage, "Check and repair the movement ledger"},
+	{PermSettingsManage, "Change organization settings and role permissions"},
+	{PermUsersManage, "Manage users and invitations"},
+}
+
+type PermissionInfo struct {
+	Permission  Permission `json:"permission"`
+	Description string     `json:"description"`
+}
+
+// IsValid reports whether the permission is a known one
+func (p Permission) IsValid() bool {
+	for _, info := range Permissions {
+		if info.Permission == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminOnly reports whether only admins may hold the permission. Either
+// one lets its holder grant themselves anything, so organizations can't
+// give them to other roles.
+func (p Permission) AdminOnly() bool {
+	return p == PermUsersManage || p == PermSettingsManage
+}
+
+// PermissionSet is the set of permissions a role holds
+type PermissionSet map[Permission]bool
+
+// Has reports whether the set grants the permission
+func (s PermissionSet) Has(p Permission) bool {
+	return s[p]
+}
+
+// List returns the permissions granted, sorted
+func (s PermissionSet) List() []Permission {
+	list := make([]Permission, 0, len(s))
+	for p, granted := range s {
+		if granted {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// DefaultPermissions returns the permissions a role holds unless its
+// organization overrides them. Admins hold every permission; managers run
+// the kitchen but not its users, settings or ledger; users record stock.
+func DefaultPermissions(role UserRole) PermissionSet {
+	set := PermissionSet{}
+	switch role {
+	case RoleAdmin:
+		for _, info := range Permissions {
+			set[info.Permission] = true
+		}
+	case RoleManager:
+		for _, info := range Permissions {
+			switch info.Permission {
+			case PermUsersManage, PermSettingsManage, PermLedgerManage:
+			default:
+				set[info.Permission] = true
+			}
+		}
+	case RoleUser:
+		for _, p := range []Permission{
+			PermMovementsCreate, PermMovementsAdjust, PermMovementsReverse,
+			PermSalesRecord, PermStockCountsCount,
+		} {
+			set[p] = true
+		}
+	}
+	return set
+}
+
+// PermissionOverride grants or denies a permission to a role of an
+// organization, whatever the role's default
+type PermissionOverride struct {
+	Role       UserRole   `json:"role" db:"role"`
+	Permission Permission `json:"permission" db:"permission"`
+	Granted    bool       `json:"granted" db:"granted"`
+}
+
+// RolePermissions is the permission set a role of an organization holds
+type RolePermissions struct {
+	Role        UserRole     `json:"role"`
+	Permissions []Permission `json:"permissions"`
+	// Overridden lists the permissions the organization grants or denies
+	// against the role's default
+	Overridden []Permission `json:"overridden,omitempty"`
+}
+
+// PermissionMatrix is the organization's permissions of every role
+type PermissionMatrix struct {
+	Permissions []PermissionInfo   `json:"permissions"`
+	Roles       []*RolePermissions `json:"roles"`
+}
+
+// UpdateRolePermissionsRequest sets every permission a role holds
+type UpdateRolePermissionsRequest struct {
+	Permissions []Permission `json:"permissions"`
+}
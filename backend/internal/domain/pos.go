@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// POSMapping maps a dish code exported by the POS to a recipe. Each unit sold
+// under the code is Portions of the recipe's yield unit, so a half plate can
+// map to 0.5 of a dish.
+type POSMapping struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Code           string    `json:"code" db:"code"`
+	RecipeID       uuid.UUID `json:"recipeId" db:"recipe_id"`
+	Portions       float64   `json:"portions" db:"portions"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+
+	// Joined fields
+	RecipeName string `json:"recipeName,omitempty"`
+}
+
+// SetPOSMappingRequest maps a dish code; Portions defaults to 1
+type SetPOSMappingRequest struct {
+	RecipeID uuid.UUID `json:"recipeId" validate:"required"`
+	Portions *float64  `json:"portions"`
+}
+
+// POSSaleRow is one line of a POS sales export
+type POSSaleRow struct {
+	Line       int
+	BillNumber string
+	Code       string
+	Quantity   float64
+	SoldAt     time.Time
+}
+
+// POSUnmappedCode summarizes the rows of a dish code that has no mapping
+type POSUnmappedCode struct {
+	Code     string  `json:"code"`
+	Rows     int     `json:"rows"`
+	Quantity float64 `json:"quantity"`
+}
+
+// POSImportResult summarizes a sales import or its dry run. Errors lists
+// rows that could not be read and bills whose ingredients could not be
+// depleted; an import with errors posts nothing. SkippedBills were imported
+// before, and HeldBills have codes without a mapping and were left to a later
+// import.
+type POSImportResult struct {
+	DryRun        bool              `json:"dryRun"`
+	Rows          int               `json:"rows"`
+	From          *time.Time        `json:"from"`
+	To            *time.Time        `json:"to"`
+	PostedBills   []string          `json:"postedBills"`
+	SkippedBills  []string          `json:"skippedBills"`
+	HeldBills     []string          `json:"heldBills"`
+	UnmappedCodes []POSUnmappedCode `json:"unmappedCodes"`
+	Errors        []POSImportError  `json:"errors"`
+	Movements     []*StockMovement  `json:"movements"`
+}
+
+// POSImportError describes a row or bill of an import that was rejected
+type POSImportError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// POSImportRequest holds the options of a sales import. A dry run reports
+// what would be posted without posting it; SkipUnmapped posts the bills of a
+// file that also has unmapped codes, holding back those that sell them.
+type POSImportRequest struct {
+	DryRun       bool
+	SkipUnmapped bool
+	LocationID   *uuid.UUID
+}
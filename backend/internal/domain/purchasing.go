@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Supplier is a vendor the organization buys from. LeadTimeDays is how long
+// an order usually takes to arrive.
+type Supplier struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	ContactName    *string   `json:"contactName" db:"contact_name"`
+	Email          *string   `json:"email" db:"email"`
+	Phone          *string   `json:"phone" db:"phone"`
+	LeadTimeDays   int       `json:"leadTimeDays" db:"lead_time_days"`
+	PaymentTerms   *string   `json:"paymentTerms" db:"payment_terms"`
+	Notes          *string   `json:"notes" db:"notes"`
+	IsActive       bool      `json:"isActive" db:"is_active"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreateSupplierRequest struct {
+	Name         string  `json:"name" validate:"required,min=1,max=255"`
+	ContactName  *string `json:"contactName"`
+	Email        *string `json:"email"`
+	Phone        *string `json:"phone"`
+	LeadTimeDays int     `json:"leadTimeDays" validate:"gte=0"`
+	PaymentTerms *string `json:"paymentTerms"`
+	Notes        *string `json:"notes"`
+}
+
+type UpdateSupplierRequest struct {
+	Name         *string `json:"name" validate:"omitempty,min=1,max=255"`
+	ContactName  *string `json:"contactName"`
+	Email        *string `json:"email"`
+	Phone        *string `json:"phone"`
+	LeadTimeDays *int    `json:"leadTimeDays" validate:"omitempty,gte=0"`
+	PaymentTerms *string `json:"paymentTerms"`
+	Notes        *string `json:"notes"`
+	IsActive     *bool   `json:"isActive"`
+}
+
+type PurchaseOrderStatus string
+
+const (
+	PurchaseOrderDraft             PurchaseOrderStatus = "DRAFT"
+	PurchaseOrderSent              PurchaseOrderStatus = "SENT"
+	PurchaseOrderPartiallyReceived PurchaseOrderStatus = "PARTIALLY_RECEIVED"
+	PurchaseOrderReceived          PurchaseOrderStatus = "RECEIVED"
+)
+
+// PurchaseOrder is an order placed with a supplier. It can be edited while
+// DRAFT, is SENT to the supplier, and becomes PARTIALLY_RECEIVED or RECEIVED
+// as goods receipts are posted against it.
+type PurchaseOrder struct {
+	ID             uuid.UUID            `json:"id" db:"id"`
+	OrganizationID uuid.UUID            `json:"organizationId" db:"organization_id"`
+	SupplierID     uuid.UUID            `json:"supplierId" db:"supplier_id"`
+	Number         int                  `json:"number" db:"number"`
+	Status         PurchaseOrderStatus  `json:"status" db:"status"`
+	ExpectedAt     *time.Time           `json:"expectedAt" db:"expected_at"`
+	Notes          *string              `json:"notes" db:"notes"`
+	CreatedBy      uuid.UUID            `json:"createdBy" db:"created_by"`
+	SentAt         *time.Time           `json:"sentAt" db:"sent_at"`
+	ReceivedAt     *time.Time           `json:"receivedAt" db:"received_at"`
+	CreatedAt      time.Time            `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time            `json:"updatedAt" db:"updated_at"`
+	Lines          []*PurchaseOrderLine `json:"lines"`
+
+	// Joined fields
+	SupplierName string `json:"supplierName,omitempty"`
+}
+
+// Reference is how movements received against the order refer to it
+func (po *PurchaseOrder) Reference() string {
+	return fmt.Sprintf("PO-%05d", po.Number)
+}
+
+// PurchaseOrderLine orders one item. Quantities are in base units of the
+// item; Unit is the unit the line was ordered in, UnitFactor the base units
+// in one Unit and UnitPrice the price of one Unit. ShortQuantity is what is
+// still missing, or was never delivered once the order is RECEIVED, and
+// OverQuantity what was delivered beyond the order.
+type PurchaseOrderLine struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	PurchaseOrderID  uuid.UUID `json:"purchaseOrderId" db:"purchase_order_id"`
+	ItemID           uuid.UUID `json:"itemId" db:"item_id"`
+	Unit             string    `json:"unit" db:"unit"`
+	UnitFactor       int       `json:"unitFactor" db:"unit_factor"`
+	OrderedQuantity  int       `json:"orderedQuantity" db:"ordered_quantity"`
+	ReceivedQuantity int       `json:"receivedQuantity" db:"received_quantity"`
+	ShortQuantity    int       `json:"shortQuantity"`
+	OverQuantity     int       `json:"overQuantity"`
+	UnitPrice        float64   `json:"unitPrice" db:"unit_price"`
+	Position         int       `json:"position" db:"position"`
+
+	// Joined fields
+	ItemName string `json:"itemName,omitempty"`
+}
+
+// Tally sets ShortQuantity and OverQuantity from the ordered and received
+// quantities
+func (l *PurchaseOrderLine) Tally() {
+	l.ShortQuantity = max(l.OrderedQuantity-l.ReceivedQuantity, 0)
+	l.OverQuantity = max(l.ReceivedQuantity-l.OrderedQuantity, 0)
+}
+
+// PurchaseOrderLineInput is a line as entered: Quantity and UnitPrice are
+// per Unit, which defaults to the item's unit and may be any unit of the
+// item, including its purchase units
+type PurchaseOrderLineInput struct {
+	ItemID    uuid.UUID `json:"itemId"`
+	Quantity  float64   `json:"quantity"`
+	Unit      string    `json:"unit"`
+	UnitPrice float64   `json:"unitPrice"`
+}
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID uuid.UUID                `json:"supplierId" validate:"required"`
+	ExpectedAt *time.Time               `json:"expectedAt"`
+	Notes      *string                  `json:"notes"`
+	Lines      []PurchaseOrderLineInput `json:"lines" validate:"required,min=1"`
+}
+
+// UpdatePurchaseOrderRequest changes the given fields of a draft order;
+// Lines, when present, replaces all lines
+type UpdatePurchaseOrderRequest struct {
+	SupplierID *uuid.UUID               `json:"supplierId"`
+	ExpectedAt *time.Time               `json:"expectedAt"`
+	Notes      *string                  `json:"notes"`
+	Lines      []PurchaseOrderLineInput `json:"lines"`
+}
+
+// GoodsReceipt is one delivery received against a purchase order. Each of
+// its lines posted an IN movement referencing the order.
+type GoodsReceipt struct {
+	ID              uuid.UUID           `json:"id" db:"id"`
+	PurchaseOrderID uuid.UUID           `json:"purchaseOrderId" db:"purchase_order_id"`
+	ReceivedBy      uuid.UUID           `json:"receivedBy" db:"received_by"`
+	ReceivedAt      time.Time           `json:"receivedAt" db:"received_at"`
+	Notes           *string             `json:"notes" db:"notes"`
+	CreatedAt       time.Time           `json:"createdAt" db:"created_at"`
+	Lines           []*GoodsReceiptLine `json:"lines"`
+}
+
+// GoodsReceiptLine is what one delivery brought of a purchase order line:
+// Quantity in base units, at UnitPrice per unit of the order line
+type GoodsReceiptLine struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	ReceiptID  uuid.UUID `json:"receiptId" db:"receipt_id"`
+	LineID     uuid.UUID `json:"lineId" db:"line_id"`
+	MovementID uuid.UUID `json:"movementId" db:"movement_id"`
+	Quantity   int       `json:"quantity" db:"quantity"`
+	UnitPrice  float64   `json:"unitPrice" db:"unit_price"`
+}
+
+// ReceiveLineInput is what arrived of one order line: Quantity in the
+// line's unit, and the invoiced UnitPrice when it differs from the order.
+// The lot fields apply as for an IN movement.
+type ReceiveLineInput struct {
+	LineID    uuid.UUID  `json:"lineId"`
+	Quantity  float64    `json:"quantity"`
+	UnitPrice *float64   `json:"unitPrice"`
+	LotNumber *string    `json:"lotNumber"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type ReceivePurchaseOrderRequest struct {
+	LocationID *uuid.UUID         `json:"locationId"`
+	ReceivedAt *time.Time         `json:"receivedAt"`
+	Notes      *string            `json:"notes"`
+	Lines      []ReceiveLineInput `json:"lines" validate:"required,min=1"`
+}
+
+// GoodsReceiptResult is a posted receipt with the movements it created and
+// the order as it stands after it
+type GoodsReceiptResult struct {
+	Receipt       *GoodsReceipt    `json:"receipt"`
+	PurchaseOrder *PurchaseOrder   `json:"purchaseOrder"`
+	Movements     []*StockMovement `json:"movements"`
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recipe is the bill of materials of a dish or a preparation. It yields
+// YieldQuantity of YieldUnit, in base units, from its components; a dish
+// usually yields 1 pcs and a preparation such as a gravy base a weight or
+// volume. Selling a recipe depletes the ingredient items of its components,
+// following sub-recipes down to items.
+type Recipe struct {
+	ID             uuid.UUID          `json:"id" db:"id"`
+	OrganizationID uuid.UUID          `json:"organizationId" db:"organization_id"`
+	Name           string             `json:"name" db:"name" validate:"required,min=1,max=255"`
+	Description    *string            `json:"description" db:"description"`
+	YieldQuantity  int                `json:"yieldQuantity" db:"yield_quantity"`
+	YieldUnit      string             `json:"yieldUnit" db:"yield_unit"`
+	IsActive       bool               `json:"isActive" db:"is_active"`
+	CreatedAt      time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time          `json:"updatedAt" db:"updated_at"`
+	Components     []*RecipeComponent `json:"components"`
+}
+
+// RecipeComponent is one line of a recipe: either an ingredient item or a
+// sub-recipe. Quantity is in base units of the item's unit or of the
+// sub-recipe's yield unit; Unit is the unit it was entered in.
+type RecipeComponent struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	RecipeID    uuid.UUID  `json:"recipeId" db:"recipe_id"`
+	ItemID      *uuid.UUID `json:"itemId" db:"item_id"`
+	SubRecipeID *uuid.UUID `json:"subRecipeId" db:"sub_recipe_id"`
+	Quantity    int        `json:"quantity" db:"quantity"`
+	Unit        string     `json:"unit" db:"unit"`
+	Position    int        `json:"position" db:"position"`
+
+	// Joined fields
+	Name string `json:"name,omitempty"`
+}
+
+// RecipeComponentInput is a component as entered: Quantity is in Unit,
+// which must measure the same base unit as the item or sub-recipe yield
+type RecipeComponentInput struct {
+	ItemID      *uuid.UUID `json:"itemId"`
+	SubRecipeID *uuid.UUID `json:"subRecipeId"`
+	Quantity    float64    `json:"quantity"`
+	Unit        string     `json:"unit"`
+}
+
+type CreateRecipeRequest struct {
+	Name          string                 `json:"name" validate:"required,min=1,max=255"`
+	Description   *string                `json:"description"`
+	YieldQuantity float64                `json:"yieldQuantity"`
+	YieldUnit     string                 `json:"yieldUnit"`
+	Components    []RecipeComponentInput `json:"components" validate:"required,min=1"`
+}
+
+// UpdateRecipeRequest changes the given fields; Components, when present,
+// replaces the whole component list
+type UpdateRecipeRequest struct {
+	Name          *string                `json:"name" validate:"omitempty,min=1,max=255"`
+	Description   *string                `json:"description"`
+	YieldQuantity *float64               `json:"yieldQuantity"`
+	YieldUnit     *string                `json:"yieldUnit"`
+	IsActive      *bool                  `json:"isActive"`
+	Components    []RecipeComponentInput `json:"components"`
+}
+
+// RecipeSale is a quantity of a recipe sold, in the recipe's yield unit
+type RecipeSale struct {
+	RecipeID uuid.UUID `json:"recipeId"`
+	Portions float64   `json:"portions"`
+}
+
+type RecordRecipeSaleRequest struct {
+	Portions   float64    `json:"portions"`
+	LocationID *uuid.UUID `json:"locationId"`
+	Reference  *string    `json:"reference"`
+	Notes      *string    `json:"notes"`
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept. Each refresh marks the token used and issues the next one of the
+// same family; a family starts at sign-in.
+type RefreshToken struct {
+	ID     uuid.UUID `json:"id" db:"id"`
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+	// OrganizationID is the organization the session is in; nil is the
+	// user's home organization
+	OrganizationID *uuid.UUID `json:"organizationId,omitempty" db:"organization_id"`
+	FamilyID       uuid.UUID  `json:"familyId" db:"family_id"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt         *time.Time `json:"usedAt,omitempty" db:"used_at"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// AuthTokens are the tokens issued at sign-in and on every refresh: a
+// short-lived access token and the refresh token that replaces it
+type AuthTokens struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReorderSettingsRequest replaces the reorder settings of an item. ParLevel
+// is in Unit, or in the item's unit when Unit is not set; a nil field clears
+// the setting.
+type ReorderSettingsRequest struct {
+	ParLevel            *float64   `json:"parLevel" validate:"omitempty,gte=0"`
+	Unit                *string    `json:"unit"`
+	LeadTimeDays        *int       `json:"leadTimeDays" validate:"omitempty,gte=0"`
+	PreferredSupplierID *uuid.UUID `json:"preferredSupplierId"`
+}
+
+// ReorderCandidate is an active, tracked item together with what the reorder
+// engine needs to know about it. Quantities are in base units; Consumed is
+// the OUT quantity since the start of the velocity window and OnOrder what
+// open purchase orders have yet to deliver.
+type ReorderCandidate struct {
+	ItemID               uuid.UUID
+	OrganizationID       uuid.UUID
+	ItemName             string
+	SKU                  *string
+	UnitOfMeasurement    string
+	CurrentStock         int
+	MinimumThreshold     int
+	ParLevel             *int
+	LeadTimeDays         *int
+	UnitCost             *float64
+	SupplierID           *uuid.UUID
+	SupplierName         *string
+	SupplierLeadTimeDays *int
+	Consumed             int
+	OnOrder              int
+	ReorderAlertedAt     *time.Time
+}
+
+// ReorderSuggestion is the quantity of an item worth ordering now.
+// Quantities are in the item's display unit; DailyUsage is the average OUT
+// quantity per day over the velocity window.
+type ReorderSuggestion struct {
+	ItemID            uuid.UUID `json:"itemId"`
+	ItemName          string    `json:"itemName"`
+	SKU               *string   `json:"sku"`
+	Unit              string    `json:"unit"`
+	CurrentStock      float64   `json:"currentStock"`
+	OnOrder           float64   `json:"onOrder"`
+	MinimumThreshold  float64   `json:"minimumThreshold"`
+	ParLevel          *float64  `json:"parLevel"`
+	DailyUsage        float64   `json:"dailyUsage"`
+	LeadTimeDays      int       `json:"leadTimeDays"`
+	ReorderPoint      float64   `json:"reorderPoint"`
+	SuggestedQuantity float64   `json:"suggestedQuantity"`
+	UnitCost          *float64  `json:"unitCost"`
+	EstimatedCost     *float64  `json:"estimatedCost"`
+}
+
+// ReorderGroup holds the suggestions for one preferred supplier. Items
+// without a preferred supplier are grouped with a nil SupplierID.
+type ReorderGroup struct {
+	SupplierID    *uuid.UUID           `json:"supplierId"`
+	SupplierName  *string              `json:"supplierName"`
+	EstimatedCost float64              `json:"estimatedCost"`
+	Lines         []*ReorderSuggestion `json:"lines"`
+}
+
+// ReorderList is the order list produced by one run of the reorder engine
+type ReorderList struct {
+	GeneratedAt  time.Time       `json:"generatedAt"`
+	VelocityDays int             `json:"velocityDays"`
+	Groups       []*ReorderGroup `json:"groups"`
+}
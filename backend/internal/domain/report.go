@@ -0,0 +1,179 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportPeriod is the length of the periods a report groups by
+type ReportPeriod string
+
+const (
+	ReportPeriodDay   ReportPeriod = "day"
+	ReportPeriodWeek  ReportPeriod = "week"
+	ReportPeriodMonth ReportPeriod = "month"
+)
+
+// WastageReportFilter selects the days, From to To inclusive, a wastage
+// report covers and optionally narrows it to one reason or one item
+type WastageReportFilter struct {
+	From       time.Time
+	To         time.Time
+	Period     ReportPeriod
+	ReasonCode *string
+	ItemID     *uuid.UUID
+}
+
+// OutflowTotal is the OUT quantity, in base units, of one item on one day
+// (YYYY-MM-DD, UTC) recorded with one reason, or without a reason when
+// ReasonCode is nil
+type OutflowTotal struct {
+	Day               string
+	ReasonCode        *string
+	ItemID            uuid.UUID
+	ItemName          string
+	UnitOfMeasurement string
+	UnitCost          *float64
+	Quantity          int
+}
+
+// WastageReport totals the stock lost to each movement reason by reason,
+// item and period and sets it against usage, the OUT movements recorded
+// without a reason such as sales and production. Quantities are in the
+// item's display unit and costs use the item's current unit cost; items
+// without a cost count as costing nothing. Periods are labelled by their
+// first day, or by YYYY-MM for months.
+type WastageReport struct {
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	Period ReportPeriod `json:"period"`
+	// LossCost is the cost of everything recorded with a reason and
+	// WasteCost the part of it whose reason counts as waste
+	LossCost  float64 `json:"lossCost"`
+	WasteCost float64 `json:"wasteCost"`
+	UsageCost float64 `json:"usageCost"`
+	// WastePercent is waste as a share of waste plus usage, nil without
+	// either
+	WastePercent *float64              `json:"wastePercent"`
+	ByReason     []*WastageReasonTotal `json:"byReason"`
+	ByItem       []*WastageItemTotal   `json:"byItem"`
+	ByPeriod     []*WastagePeriodTotal `json:"byPeriod"`
+	Rows         []*WastageRow         `json:"rows"`
+}
+
+// WastageReasonTotal is the cost lost to one reason
+type WastageReasonTotal struct {
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	IsWaste bool    `json:"isWaste"`
+	Cost    float64 `json:"cost"`
+}
+
+// WastageItemTotal is what one item lost to reasons, Quantity and Cost, and
+// what it was used for otherwise
+type WastageItemTotal struct {
+	ItemID        uuid.UUID `json:"itemId"`
+	ItemName      string    `json:"itemName"`
+	Unit          string    `json:"unit"`
+	Quantity      float64   `json:"quantity"`
+	Cost          float64   `json:"cost"`
+	WasteQuantity float64   `json:"wasteQuantity"`
+	WasteCost     float64   `json:"wasteCost"`
+	UsedQuantity  float64   `json:"usedQuantity"`
+	UsedCost      float64   `json:"usedCost"`
+	WastePercent  *float64  `json:"wastePercent"`
+}
+
+// WastagePeriodTotal is the loss, waste and usage cost of one period
+type WastagePeriodTotal struct {
+	Period       string   `json:"period"`
+	LossCost     float64  `json:"lossCost"`
+	WasteCost    float64  `json:"wasteCost"`
+	UsageCost    float64  `json:"usageCost"`
+	WastePercent *float64 `json:"wastePercent"`
+}
+
+// WastageRow is the quantity of one item lost to one reason in one period
+type WastageRow struct {
+	Period     string    `json:"period"`
+	ReasonCode string    `json:"reasonCode"`
+	ItemID     uuid.UUID `json:"itemId"`
+	ItemName   string    `json:"itemName"`
+	Unit       string    `json:"unit"`
+	Quantity   float64   `json:"quantity"`
+	Cost       float64   `json:"cost"`
+}
+
+// ValuationRow is an item's stock and open cost layers now, its snapshot
+// if the organization took one before the valuation date, and the movements
+// from which its stock and value as of that date are worked out: those
+// between the snapshot and the date, or without a snapshot those after the
+// date. Quantities are in base units.
+type ValuationRow struct {
+	ItemID            uuid.UUID
+	ItemName          string
+	CategoryID        uuid.UUID
+	CategoryName      string
+	UnitOfMeasurement string
+	UnitCost          *float64
+	CurrentStock      int
+	// LayerQuantity and LayerValue total the item's open cost layers
+	LayerQuantity int
+	LayerValue    float64
+	// SnapshotQuantity and SnapshotValue are nil when the item has no
+	// snapshot to work forward from
+	SnapshotQuantity *int
+	SnapshotValue    *float64
+	// MovedStock is the stock change of the movements, MovedCost their
+	// signed cost, and MovedUncosted the part of the stock change recorded
+	// without a cost
+	MovedStock    int
+	MovedCost     float64
+	MovedUncosted int
+}
+
+// StockSnapshot is an item's stock and its value at TakenAt. Quantity is in
+// base units.
+type StockSnapshot struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	ItemID         uuid.UUID `json:"itemId" db:"item_id"`
+	TakenAt        time.Time `json:"takenAt" db:"taken_at"`
+	Quantity       int       `json:"quantity" db:"quantity"`
+	Value          float64   `json:"value" db:"value"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+// ValuationReport is what the organization's stock was worth as of AsOf:
+// the end of a day (YYYY-MM-DD, UTC) or an RFC 3339 time. Stock is valued at its cost layers; stock no layer
+// covers, such as stock moved before costing started, is valued at the
+// item's current unit cost. Quantities are in the item's display unit.
+type ValuationReport struct {
+	AsOf       string               `json:"asOf"`
+	Method     CostingMethod        `json:"method"`
+	TotalValue float64              `json:"totalValue"`
+	Categories []*CategoryValuation `json:"categories"`
+	Items      []*ItemValuation     `json:"items"`
+}
+
+// CategoryValuation is the value of the stock of one category
+type CategoryValuation struct {
+	CategoryID   uuid.UUID `json:"categoryId"`
+	CategoryName string    `json:"categoryName"`
+	ItemCount    int       `json:"itemCount"`
+	Value        float64   `json:"value"`
+}
+
+// ItemValuation is the stock of one item and its value. AverageCost is the
+// value per unit of the item's unit of measurement.
+type ItemValuation struct {
+	ItemID       uuid.UUID `json:"itemId"`
+	ItemName     string    `json:"itemName"`
+	CategoryID   uuid.UUID `json:"categoryId"`
+	CategoryName string    `json:"categoryName"`
+	Unit         string    `json:"unit"`
+	Quantity     float64   `json:"quantity"`
+	Value        float64   `json:"value"`
+	AverageCost  float64   `json:"averageCost"`
+}
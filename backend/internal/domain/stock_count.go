@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type StockCountStatus string
+
+const (
+	StockCountOpen      StockCountStatus = "OPEN"
+	StockCountApproved  StockCountStatus = "APPROVED"
+	StockCountCancelled StockCountStatus = "CANCELLED"
+)
+
+// StockCount is a counting session for the items of a location, only those
+// of CategoryID when it is set. Expected stock is snapshotted when the
+// session is opened; staff enter counts while it is OPEN and approving it
+// posts the variances as ADJUSTMENT movements referencing the session.
+type StockCount struct {
+	ID             uuid.UUID         `json:"id" db:"id"`
+	OrganizationID uuid.UUID         `json:"organizationId" db:"organization_id"`
+	LocationID     uuid.UUID         `json:"locationId" db:"location_id"`
+	CategoryID     *uuid.UUID        `json:"categoryId" db:"category_id"`
+	Status         StockCountStatus  `json:"status" db:"status"`
+	Notes          *string           `json:"notes" db:"notes"`
+	CreatedBy      uuid.UUID         `json:"createdBy" db:"created_by"`
+	ApprovedBy     *uuid.UUID        `json:"approvedBy" db:"approved_by"`
+	ApprovedAt     *time.Time        `json:"approvedAt" db:"approved_at"`
+	CreatedAt      time.Time         `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time         `json:"updatedAt" db:"updated_at"`
+	Lines          []*StockCountLine `json:"lines"`
+
+	// Joined fields
+	LocationName string  `json:"locationName,omitempty"`
+	CategoryName *string `json:"categoryName,omitempty"`
+
+	// Review totals, filled in from the lines
+	CountedLines  int      `json:"countedLines"`
+	VarianceLines int      `json:"varianceLines"`
+	VarianceCost  *float64 `json:"varianceCost,omitempty"`
+}
+
+// StockCountLine is the count of one item. The quantities stored are in
+// base units of the item; Expected, Counted and Variance state them in the
+// item's unit for review, and VarianceCost is the variance at the unit cost
+// snapshotted with the expected stock.
+type StockCountLine struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	StockCountID     uuid.UUID  `json:"stockCountId" db:"stock_count_id"`
+	ItemID           uuid.UUID  `json:"itemId" db:"item_id"`
+	ExpectedQuantity int        `json:"-" db:"expected_quantity"`
+	CountedQuantity  *int       `json:"-" db:"counted_quantity"`
+	CountedBy        *uuid.UUID `json:"countedBy" db:"counted_by"`
+	CountedAt        *time.Time `json:"countedAt" db:"counted_at"`
+	UnitCost         *float64   `json:"unitCost,omitempty" db:"unit_cost"`
+	MovementID       *uuid.UUID `json:"movementId" db:"movement_id"`
+	Position         int        `json:"position" db:"position"`
+
+	// Joined fields
+	ItemName string `json:"itemName,omitempty"`
+	Unit     string `json:"unit"`
+
+	// Review fields in Unit
+	Expected     float64  `json:"expected"`
+	Counted      *float64 `json:"counted"`
+	Variance     *float64 `json:"variance"`
+	VarianceCost *float64 `json:"varianceCost,omitempty"`
+}
+
+// VarianceQuantity is the counted quantity less the expected one in base
+// units, or nil while the item has not been counted
+func (l *StockCountLine) VarianceQuantity() *int {
+	if l.CountedQuantity == nil {
+		return nil
+	}
+	variance := *l.CountedQuantity - l.ExpectedQuantity
+	return &variance
+}
+
+// CreateStockCountRequest opens a session. The location defaults to the
+// organization's default location.
+type CreateStockCountRequest struct {
+	LocationID *uuid.UUID `json:"locationId"`
+	CategoryID *uuid.UUID `json:"categoryId"`
+	Notes      *string    `json:"notes"`
+}
+
+// StockCountEntry is a counted quantity of an item in Unit, which defaults
+// to the item's unit. With Add the quantity is added to what was counted so
+// far, so that several people can count the same item in different places;
+// otherwise it replaces it.
+type StockCountEntry struct {
+	ItemID   uuid.UUID `json:"itemId"`
+	Quantity float64   `json:"quantity"`
+	Unit     *string   `json:"unit"`
+	Add      bool      `json:"add"`
+}
+
+type EnterCountsRequest struct {
+	Lines []StockCountEntry `json:"lines"`
+}
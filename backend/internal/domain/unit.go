@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/pkg/units"
+)
+
+// Unit is a unit of measurement an organization defines on top of the
+// built-in kg, gm, ltr and pcs. One unit is Factor of BaseUnit, so a dozen is
+// 12 pcs; a unit that is its own base unit, such as a roll, counts something
+// no built-in unit measures.
+type Unit struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Code           string    `json:"code" db:"code"`
+	Name           string    `json:"name" db:"name"`
+	BaseUnit       string    `json:"baseUnit" db:"base_unit"`
+	Factor         int       `json:"factor" db:"factor"`
+	Precision      int       `json:"precision" db:"display_precision"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Measure returns the unit as the units package converts it
+func (u *Unit) Measure() units.Unit {
+	return units.Unit{
+		Code:       u.Code,
+		Name:       u.Name,
+		BaseUnit:   u.BaseUnit,
+		Factor:     u.Factor,
+		Precision:  u.Precision,
+		AllowFloat: u.Precision > 0,
+	}
+}
+
+// CreateUnitRequest defines a unit; BaseUnit defaults to the unit itself
+// and Factor to 1
+type CreateUnitRequest struct {
+	Code      string  `json:"code" validate:"required,min=1,max=20"`
+	Name      string  `json:"name" validate:"required,min=1,max=100"`
+	BaseUnit  *string `json:"baseUnit"`
+	Factor    *int    `json:"factor"`
+	Precision int     `json:"precision" validate:"gte=0,lte=6"`
+}
+
+// UpdateUnitRequest renames a unit or changes how it is displayed. Its base
+// unit and factor are fixed once created, since stock is kept in base units.
+type UpdateUnitRequest struct {
+	Name      *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Precision *int    `json:"precision" validate:"omitempty,gte=0,lte=6"`
+}
+
+// ItemUnitConversion is a purchase unit of one item, such as a case of 24 pcs
+// or a 25 kg sack. Quantity is how many base units of the item one Unit
+// holds.
+type ItemUnitConversion struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	ItemID    uuid.UUID `json:"itemId" db:"item_id"`
+	Unit      string    `json:"unit" db:"unit"`
+	Quantity  int       `json:"quantity" db:"quantity"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Measure returns the conversion as a unit of baseUnit, the base unit of the
+// item's unit of measurement
+func (c *ItemUnitConversion) Measure(baseUnit string) units.Unit {
+	return units.Unit{
+		Code:       c.Unit,
+		Name:       c.Unit,
+		BaseUnit:   baseUnit,
+		Factor:     c.Quantity,
+		Precision:  2,
+		AllowFloat: true,
+	}
+}
+
+// SetItemUnitConversionRequest sets how much of an item one purchase unit
+// holds: Quantity of Unit, which defaults to the item's unit of measurement
+type SetItemUnitConversionRequest struct {
+	Quantity float64 `json:"quantity" validate:"gt=0"`
+	Unit     *string `json:"unit"`
+}
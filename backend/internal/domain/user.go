@@ -15,6 +15,7 @@ type User struct {
 	LastName       string    `json:"lastName" db:"last_name" validate:"required"`
 	Role           UserRole  `json:"role" db:"role"`
 	IsActive       bool      `json:"isActive" db:"is_active"`
+	TokenVersion   int       `json:"-" db:"token_version"`
 	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
 }
@@ -26,3 +27,67 @@ const (
 	RoleManager UserRole = "MANAGER"
 	RoleUser    UserRole = "USER"
 )
+
+// Roles lists every role a user can have
+var Roles = []UserRole{RoleAdmin, RoleManager, RoleUser}
+
+// UpdateUserRequest changes a user of the caller's organization; fields left
+// out are kept
+type UpdateUserRequest struct {
+	FirstName *string   `json:"firstName" validate:"omitempty,min=1"`
+	LastName  *string   `json:"lastName" validate:"omitempty,min=1"`
+	Role      *UserRole `json:"role"`
+	IsActive  *bool     `json:"isActive"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "PENDING"
+	InvitationAccepted InvitationStatus = "ACCEPTED"
+	InvitationRevoked  InvitationStatus = "REVOKED"
+	InvitationExpired  InvitationStatus = "EXPIRED"
+)
+
+// UserInvitation invites someone, by email, to join the inviter's
+// organization with a role. Only the SHA-256 hash of its token is kept.
+type UserInvitation struct {
+	ID             uuid.UUID        `json:"id" db:"id"`
+	OrganizationID uuid.UUID        `json:"organizationId" db:"organization_id"`
+	Email          string           `json:"email" db:"email"`
+	Role           UserRole         `json:"role" db:"role"`
+	TokenHash      string           `json:"-" db:"token_hash"`
+	InvitedBy      uuid.UUID        `json:"invitedBy" db:"invited_by"`
+	ExpiresAt      time.Time        `json:"expiresAt" db:"expires_at"`
+	AcceptedAt     *time.Time       `json:"acceptedAt,omitempty" db:"accepted_at"`
+	AcceptedBy     *uuid.UUID       `json:"acceptedBy,omitempty" db:"accepted_by"`
+	RevokedAt      *time.Time       `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time        `json:"createdAt" db:"created_at"`
+	Status         InvitationStatus `json:"status" db:"-"`
+}
+
+// StatusAt returns the status of the invitation at the given time
+func (i *UserInvitation) StatusAt(now time.Time) InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+type InviteUserRequest struct {
+	Email string   `json:"email" validate:"required,email"`
+	Role  UserRole `json:"role"`
+}
+
+// CreatedInvitation is the invitation just created, with its token. The
+// token is only ever returned here.
+type CreatedInvitation struct {
+	*UserInvitation
+	Token string `json:"token"`
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -29,17 +28,31 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginResponse carries the tokens of the new session, the access token
+// under "token", and the signed-in user
 type LoginResponse struct {
-	Token string       `json:"token"`
-	User  *domain.User `json:"user"`
+	*domain.AuthTokens
+	User *domain.User `json:"user"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// SwitchOrganizationRequest exchanges the refresh token of a session for
+// tokens in another organization of the user
+type SwitchOrganizationRequest struct {
+	RefreshToken   string `json:"refreshToken" validate:"required"`
+	OrganizationID string `json:"organizationId" validate:"required"`
+}
+
+// RegisterRequest accepts an invitation. The email, organization and role
+// of the account come from the invitation.
 type RegisterRequest struct {
-	Email          string `json:"email" validate:"required,email"`
-	Password       string `json:"password" validate:"required,min=8"`
-	FirstName      string `json:"firstName" validate:"required"`
-	LastName       string `json:"lastName" validate:"required"`
-	OrganizationID string `json:"organizationId" validate:"required,uuid"`
+	InvitationToken string `json:"invitationToken" validate:"required"`
+	Password        string `json:"password" validate:"required,min=8"`
+	FirstName       string `json:"firstName" validate:"required"`
+	LastName        string `json:"lastName" validate:"required"`
 }
 
 type ChangePasswordRequest struct {
@@ -55,7 +68,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.authService.Login(r.Context(), req.Email, req.Password)
+	tokens, user, err := h.authService.Login(r.Context(), req.Email, req.Password)
 	if err != nil {
 		if err == services.ErrInvalidCredentials {
 			utils.RespondError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password", nil)
@@ -71,12 +84,12 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.RespondSuccess(w, http.StatusOK, LoginResponse{
-		Token: token,
-		User:  user,
+		AuthTokens: tokens,
+		User:       user,
 	})
 }
 
-// Register handles user registration
+// Register handles user registration by invitation
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -84,22 +97,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orgID, err := uuid.Parse(req.OrganizationID)
-	fmt.Println(orgID)
-	if err != nil {
-		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+	if req.InvitationToken == "" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_INVITATION", "An invitation token is required", nil)
 		return
 	}
 
 	user := &domain.User{
-		Email:          req.Email,
-		FirstName:      req.FirstName,
-		LastName:       req.LastName,
-		OrganizationID: orgID,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
 	}
 
-	token, err := h.authService.Register(r.Context(), user, req.Password)
+	tokens, err := h.authService.Register(r.Context(), req.InvitationToken, user, req.Password)
 	if err != nil {
+		if err == services.ErrInvalidInvitation {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_INVITATION", "Invitation is invalid or has expired", nil)
+			return
+		}
 		if err == services.ErrEmailExists {
 			utils.RespondError(w, http.StatusConflict, "EMAIL_EXISTS", "Email already exists", nil)
 			return
@@ -110,12 +123,96 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.RespondSuccess(w, http.StatusCreated, LoginResponse{
-		Token: token,
-		User:  user,
+		AuthTokens: tokens,
+		User:       user,
 	})
 }
 
-// GetProfile retrieves the current user's profile
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	tokens, err := h.authService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidRefreshToken:
+			utils.RespondError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token", nil)
+		case services.ErrRefreshTokenReused:
+			utils.RespondError(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token was already used; the session has been revoked", nil)
+		case services.ErrUserInactive:
+			utils.RespondError(w, http.StatusForbidden, "USER_INACTIVE", "User account is inactive", nil)
+		default:
+			h.log.Error("Failed to refresh token", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, tokens)
+}
+
+// SwitchOrganization moves the session of a refresh token to another
+// organization the user belongs to, returning tokens for it and the user as
+// a member of it
+func (h *AuthHandler) SwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	var req SwitchOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	orgID, err := uuid.Parse(req.OrganizationID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	tokens, user, err := h.authService.SwitchOrganization(r.Context(), req.RefreshToken, orgID)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidRefreshToken:
+			utils.RespondError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token", nil)
+		case services.ErrRefreshTokenReused:
+			utils.RespondError(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token was already used; the session has been revoked", nil)
+		case services.ErrUserInactive:
+			utils.RespondError(w, http.StatusForbidden, "USER_INACTIVE", "User account is inactive", nil)
+		case services.ErrNotMember:
+			utils.RespondError(w, http.StatusForbidden, "NOT_A_MEMBER", "You are not an active member of this organization", nil)
+		default:
+			h.log.Error("Failed to switch organization", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, LoginResponse{
+		AuthTokens: tokens,
+		User:       user,
+	})
+}
+
+// Logout ends the session of a refresh token
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), req.RefreshToken); err != nil {
+		h.log.Error("Failed to logout", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// GetProfile retrieves the current user's profile, as a member of the
+// organization the session is in
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	id, err := uuid.Parse(userID)
@@ -123,8 +220,13 @@ func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
 		return
 	}
+	orgID, err := uuid.Parse(r.Context().Value("organization_id").(string))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
 
-	user, err := h.authService.GetUserByID(r.Context(), id)
+	user, err := h.authService.GetMember(r.Context(), orgID, id)
 	if err != nil {
 		if err == services.ErrUserNotFound {
 			utils.RespondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found", nil)
@@ -146,6 +248,11 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
 		return
 	}
+	orgID, err := uuid.Parse(r.Context().Value("organization_id").(string))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
 
 	var req ChangePasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -153,7 +260,8 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.authService.ChangePassword(r.Context(), id, req.OldPassword, req.NewPassword); err != nil {
+	tokens, err := h.authService.ChangePassword(r.Context(), id, orgID, req.OldPassword, req.NewPassword)
+	if err != nil {
 		if err == services.ErrInvalidCredentials {
 			utils.RespondError(w, http.StatusUnauthorized, "INVALID_PASSWORD", "Invalid old password", nil)
 			return
@@ -163,5 +271,7 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
+	// Every session was revoked, the caller's included, so it is handed a
+	// new one
+	utils.RespondSuccess(w, http.StatusOK, tokens)
 }
@@ -10,10 +10,13 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	_ "modernc.org/sqlite"
 
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/handlers"
+	"hasufel.kj/internal/middleware"
 	"hasufel.kj/internal/repository"
 	"hasufel.kj/internal/services"
 	"hasufel.kj/pkg/logger"
@@ -33,6 +36,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 		name TEXT NOT NULL,
 		slug TEXT UNIQUE NOT NULL,
 		settings TEXT DEFAULT '{}',
+		costing_method TEXT NOT NULL DEFAULT 'FIFO',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -46,10 +50,60 @@ func setupTestDB(t *testing.T) *sql.DB {
 		last_name TEXT NOT NULL,
 		role TEXT DEFAULT 'USER',
 		is_active BOOLEAN DEFAULT true,
+		token_version INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (organization_id) REFERENCES organizations(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS organization_members (
+		organization_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'USER',
+		is_active BOOLEAN NOT NULL DEFAULT true,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (organization_id, user_id),
+		FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		organization_id TEXT,
+		family_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS user_invitations (
+		id TEXT PRIMARY KEY,
+		organization_id TEXT NOT NULL,
+		email TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'USER',
+		token_hash TEXT UNIQUE NOT NULL,
+		invited_by TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		accepted_at DATETIME,
+		accepted_by TEXT,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (organization_id) REFERENCES organizations(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		organization_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		granted BOOLEAN NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (organization_id, role, permission)
+	);
 	`
 	if _, err := db.Exec(schema); err != nil {
 		t.Fatalf("create schema: %v", err)
@@ -60,10 +114,37 @@ func setupTestDB(t *testing.T) *sql.DB {
 
 func setupAuthHandler(t *testing.T, db *sql.DB) *handlers.AuthHandler {
 	t.Helper()
-	userRepo := repository.NewUserRepository(db)
-	authService := services.NewAuthService(userRepo, "test-secret-key")
 	log := logger.New("info")
-	return handlers.NewAuthHandler(authService, log)
+	return handlers.NewAuthHandler(setupAuthService(db), log)
+}
+
+func setupAuthService(db *sql.DB) *services.AuthService {
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	orgRepo := repository.NewOrganizationRepository(db, database.DialectSQLite)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db, database.DialectSQLite)
+	invitationRepo := repository.NewInvitationRepository(db, database.DialectSQLite)
+	return services.NewAuthService(userRepo, orgRepo, refreshTokenRepo, invitationRepo, db, "test-secret-key", services.TokenLifetimes{})
+}
+
+func setupUserService(db *sql.DB, authService *services.AuthService) *services.UserService {
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	orgRepo := repository.NewOrganizationRepository(db, database.DialectSQLite)
+	invitationRepo := repository.NewInvitationRepository(db, database.DialectSQLite)
+	return services.NewUserService(userRepo, orgRepo, invitationRepo, authService, db, 0)
+}
+
+// inviteUser invites the email to the organization and returns the
+// invitation token
+func inviteUser(t *testing.T, db *sql.DB, orgID uuid.UUID, email string, role domain.UserRole) string {
+	t.Helper()
+	invitation, err := setupUserService(db, setupAuthService(db)).InviteUser(context.Background(), orgID, uuid.New(), &domain.InviteUserRequest{
+		Email: email,
+		Role:  role,
+	})
+	if err != nil {
+		t.Fatalf("invite %s: %v", email, err)
+	}
+	return invitation.Token
 }
 
 func TestAuthHandler_Register(t *testing.T) {
@@ -79,6 +160,8 @@ func TestAuthHandler_Register(t *testing.T) {
 	}
 
 	handler := setupAuthHandler(t, db)
+	invitationToken := inviteUser(t, db, orgID, "test@example.com", domain.RoleManager)
+	duplicateToken := inviteUser(t, db, orgID, "duplicate@example.com", domain.RoleUser)
 
 	tests := []struct {
 		name           string
@@ -90,11 +173,10 @@ func TestAuthHandler_Register(t *testing.T) {
 		{
 			name: "successful registration",
 			requestBody: handlers.RegisterRequest{
-				Email:          "test@example.com",
-				Password:       "password123",
-				FirstName:      "John",
-				LastName:       "Doe",
-				OrganizationID: orgID.String(),
+				InvitationToken: invitationToken,
+				Password:        "password123",
+				FirstName:       "John",
+				LastName:        "Doe",
 			},
 			expectedStatus: http.StatusCreated,
 			checkResponse: func(t *testing.T, body map[string]interface{}) {
@@ -118,31 +200,43 @@ func TestAuthHandler_Register(t *testing.T) {
 				if user["lastName"] != "Doe" {
 					t.Errorf("expected lastName Doe, got %v", user["lastName"])
 				}
+				if user["organizationId"] != orgID.String() || user["role"] != string(domain.RoleManager) {
+					t.Errorf("expected the organization and role of the invitation, got %v %v", user["organizationId"], user["role"])
+				}
 			},
 		},
+		{
+			name: "invitation already accepted",
+			requestBody: handlers.RegisterRequest{
+				InvitationToken: invitationToken,
+				Password:        "password123",
+				FirstName:       "John",
+				LastName:        "Again",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "INVALID_INVITATION",
+		},
 		{
 			name: "duplicate email",
 			requestBody: handlers.RegisterRequest{
-				Email:          "duplicate@example.com",
-				Password:       "password123",
-				FirstName:      "Jane",
-				LastName:       "Smith",
-				OrganizationID: orgID.String(),
+				InvitationToken: duplicateToken,
+				Password:        "password123",
+				FirstName:       "Jane",
+				LastName:        "Smith",
 			},
 			expectedStatus: http.StatusConflict,
 			expectedError:  "EMAIL_EXISTS",
 		},
 		{
-			name: "invalid organization ID",
+			name: "invalid invitation",
 			requestBody: handlers.RegisterRequest{
-				Email:          "test2@example.com",
-				Password:       "password123",
-				FirstName:      "Bob",
-				LastName:       "Jones",
-				OrganizationID: "invalid-uuid",
+				InvitationToken: "not-an-invitation",
+				Password:        "password123",
+				FirstName:       "Bob",
+				LastName:        "Jones",
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "INVALID_ORG_ID",
+			expectedError:  "INVALID_INVITATION",
 		},
 		{
 			name:           "invalid request body",
@@ -165,7 +259,7 @@ func TestAuthHandler_Register(t *testing.T) {
 					IsActive:       true,
 					Role:           domain.RoleUser,
 				}
-				userRepo := repository.NewUserRepository(db)
+				userRepo := repository.NewUserRepository(db, database.DialectSQLite)
 				_, _ = userRepo.Create(context.Background(), user)
 			}
 
@@ -230,8 +324,7 @@ func TestAuthHandler_Login(t *testing.T) {
 	}
 
 	// Create a test user
-	userRepo := repository.NewUserRepository(db)
-	authService := services.NewAuthService(userRepo, "test-secret-key")
+	authService := setupAuthService(db)
 
 	user := &domain.User{
 		Email:          "login@example.com",
@@ -239,7 +332,7 @@ func TestAuthHandler_Login(t *testing.T) {
 		LastName:       "User",
 		OrganizationID: orgID,
 	}
-	_, err = authService.Register(context.Background(), user, "password123")
+	_, err = authService.Register(context.Background(), inviteUser(t, db, orgID, "login@example.com", domain.RoleUser), user, "password123")
 	if err != nil {
 		t.Fatalf("create test user: %v", err)
 	}
@@ -321,7 +414,162 @@ func TestAuthHandler_Login(t *testing.T) {
 				if data["token"] == nil || data["token"] == "" {
 					t.Error("expected token in response")
 				}
+				if data["refreshToken"] == nil || data["refreshToken"] == "" {
+					t.Error("expected refresh token in response")
+				}
 			}
 		})
 	}
 }
+
+func TestAuthHandler_RefreshRotatesAndRevokes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orgID := uuid.New()
+	if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+		orgID.String(), "Test Org", "test-org"); err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+
+	authService := setupAuthService(db)
+	user := &domain.User{
+		Email:          "refresh@example.com",
+		FirstName:      "Refresh",
+		LastName:       "User",
+		OrganizationID: orgID,
+	}
+	invitationToken := inviteUser(t, db, orgID, "refresh@example.com", domain.RoleUser)
+	if _, err := authService.Register(context.Background(), invitationToken, user, "password123"); err != nil {
+		t.Fatalf("create test user: %v", err)
+	}
+
+	handler := handlers.NewAuthHandler(authService, logger.New("info"))
+	protected := middleware.AuthMiddleware("test-secret-key", authService)(http.HandlerFunc(handler.ChangePassword))
+
+	// post sends a JSON body to a handler and returns the status and the
+	// data or error code of the response
+	post := func(h http.Handler, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth", bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		data, _ := response["data"].(map[string]interface{})
+		code := ""
+		if errorObj, ok := response["error"].(map[string]interface{}); ok {
+			code, _ = errorObj["code"].(string)
+		}
+		return w.Code, data, code
+	}
+	login := func() map[string]interface{} {
+		t.Helper()
+		status, data, code := post(http.HandlerFunc(handler.Login), handlers.LoginRequest{Email: "refresh@example.com", Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login: expected 200, got %d %s", status, code)
+		}
+		return data
+	}
+	refresh := func(token interface{}) (int, map[string]interface{}, string) {
+		t.Helper()
+		return post(http.HandlerFunc(handler.Refresh), map[string]interface{}{"refreshToken": token}, "")
+	}
+
+	session := login()
+	status, rotated, _ := refresh(session["refreshToken"])
+	if status != http.StatusOK || rotated["token"] == "" || rotated["refreshToken"] == session["refreshToken"] {
+		t.Fatalf("expected a new access and refresh token, got %d %v", status, rotated)
+	}
+
+	// Presenting the exchanged token again revokes the whole family
+	if status, _, code := refresh(session["refreshToken"]); status != http.StatusUnauthorized || code != "REFRESH_TOKEN_REUSED" {
+		t.Errorf("expected the reused token to be rejected, got %d %s", status, code)
+	}
+	if status, _, code := refresh(rotated["refreshToken"]); status != http.StatusUnauthorized || code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("expected the rest of the family to be revoked, got %d %s", status, code)
+	}
+
+	// Logging out ends the session, and can be repeated
+	session = login()
+	for i := 0; i < 2; i++ {
+		if status, _, code := post(http.HandlerFunc(handler.Logout), map[string]interface{}{"refreshToken": session["refreshToken"]}, ""); status != http.StatusOK {
+			t.Errorf("expected logout to succeed, got %d %s", status, code)
+		}
+	}
+	if status, _, code := refresh(session["refreshToken"]); status != http.StatusUnauthorized || code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("expected the logged out token to be rejected, got %d %s", status, code)
+	}
+
+	// Changing the password revokes every session at once, the caller's
+	// included, and starts a new one
+	session, other := login(), login()
+	change := handlers.ChangePasswordRequest{OldPassword: "password123", NewPassword: "password456"}
+	status, changed, code := post(protected, change, session["token"].(string))
+	if status != http.StatusOK || changed["token"] == "" {
+		t.Fatalf("expected the password change to return a new session, got %d %s", status, code)
+	}
+	if status, _, _ := post(protected, change, other["token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("expected the old access token to be revoked, got %d", status)
+	}
+	if status, _, code := refresh(other["refreshToken"]); status != http.StatusUnauthorized || code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("expected the old refresh token to be revoked, got %d %s", status, code)
+	}
+	if status, _, _ := refresh(changed["refreshToken"]); status != http.StatusOK {
+		t.Errorf("expected the new session to refresh, got %d", status)
+	}
+	revert := handlers.ChangePasswordRequest{OldPassword: "password456", NewPassword: "password123"}
+	if status, _, code := post(protected, revert, changed["token"].(string)); status != http.StatusOK {
+		t.Errorf("expected the new access token to be accepted, got %d %s", status, code)
+	}
+}
+
+func TestAuthService_ChangePasswordKeepsOldPasswordWhenSessionsStay(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	orgID := uuid.New()
+	if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+		orgID.String(), "Test Org", "test-org"); err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+
+	authService := setupAuthService(db)
+	user := &domain.User{
+		Email:          "change@example.com",
+		FirstName:      "Change",
+		LastName:       "User",
+		OrganizationID: orgID,
+	}
+	invitationToken := inviteUser(t, db, orgID, "change@example.com", domain.RoleUser)
+	if _, err := authService.Register(context.Background(), invitationToken, user, "password123"); err != nil {
+		t.Fatalf("create test user: %v", err)
+	}
+
+	// Sessions that cannot be revoked must not leave the password changed
+	if _, err := db.Exec("ALTER TABLE refresh_tokens RENAME TO refresh_tokens_gone"); err != nil {
+		t.Fatalf("rename refresh tokens: %v", err)
+	}
+	if _, err := authService.ChangePassword(context.Background(), user.ID, orgID, "password123", "password456"); err == nil {
+		t.Fatal("expected the password change to fail")
+	}
+
+	var hash string
+	if err := db.QueryRow("SELECT password_hash FROM users WHERE id = ?", user.ID.String()).Scan(&hash); err != nil {
+		t.Fatalf("read password: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("password123")) != nil {
+		t.Error("expected the old password to still be the one stored")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/middleware"
 	"hasufel.kj/pkg/utils"
 )
 
@@ -25,13 +26,25 @@ func getRoleFromContext(ctx context.Context) domain.UserRole {
 	return ""
 }
 
-func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+// getPermissionsFromContext returns the caller's permissions. Routes are
+// guarded by middleware.RequirePermission; handlers use the permissions for
+// what a route alone can't decide, such as which fields to show.
+func getPermissionsFromContext(ctx context.Context) domain.PermissionSet {
+	if ctx == nil {
+		return domain.PermissionSet{}
+	}
+	return middleware.PermissionsFromContext(ctx)
+}
+
+// requirePermission refuses the request, writing the error response, when
+// the caller lacks the permission
+func requirePermission(w http.ResponseWriter, r *http.Request, permission domain.Permission) bool {
 	if w == nil || r == nil {
 		return false
 	}
 
-	if getRoleFromContext(r.Context()) != domain.RoleAdmin {
-		utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Admin role required", nil)
+	if !getPermissionsFromContext(r.Context()).Has(permission) {
+		utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Permission required: "+string(permission), nil)
 		return false
 	}
 	return true
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/utils"
+)
+
+// Costing settings handlers
+
+// GetCostingSettings returns how the organization costs its stock, FIFO or
+// WEIGHTED_AVERAGE
+func (h *InventoryHandler) GetCostingSettings(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	settings, err := h.inventoryService.GetCostingSettings(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to fetch costing settings", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, settings)
+}
+
+// UpdateCostingSettings changes the costing method; movements already
+// recorded keep their cost
+func (h *InventoryHandler) UpdateCostingSettings(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CostingSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.inventoryService.UpdateCostingSettings(r.Context(), orgUUID, &req); err != nil {
+		if err == services.ErrInvalidCostingMethod {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_COSTING_METHOD", err.Error(), nil)
+			return
+		}
+		h.log.Error("Failed to update costing settings", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, req)
+}
@@ -14,11 +14,13 @@ import (
 
 // DashboardService interface for dependency injection
 type DashboardService interface {
-	GetMetrics(ctx context.Context, orgID uuid.UUID) (*services.DashboardMetrics, error)
+	GetMetrics(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID) (*services.DashboardMetrics, error)
 	GetRecentMovements(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.StockMovement, error)
 	GetStockTrends(ctx context.Context, orgID uuid.UUID, days int) ([]services.StockTrend, error)
 	GetCategoryBreakdown(ctx context.Context, orgID uuid.UUID) ([]services.CategoryBreakdown, error)
-	GetLowStockItems(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Item, error)
+	GetLowStockItems(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID, limit int) ([]*domain.Item, error)
+	GetLocationBreakdown(ctx context.Context, orgID uuid.UUID) ([]services.LocationBreakdown, error)
+	GetExpiringLots(ctx context.Context, orgID uuid.UUID, days int, locationID *uuid.UUID) ([]services.ExpiringLot, error)
 	GetAlerts(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error)
 	MarkAlertAsRead(ctx context.Context, alertID uuid.UUID) error
 }
@@ -43,14 +45,19 @@ func (h *DashboardHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metrics, err := h.dashboardService.GetMetrics(r.Context(), orgUUID)
+	locationID, ok := parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	metrics, err := h.dashboardService.GetMetrics(r.Context(), orgUUID, locationID)
 	if err != nil {
 		h.log.Error("Failed to get metrics", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, metrics)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeDashboardMetricsForPermissions(metrics, getPermissionsFromContext(r.Context())))
 }
 
 func (h *DashboardHandler) GetRecentMovements(w http.ResponseWriter, r *http.Request) {
@@ -73,7 +80,7 @@ func (h *DashboardHandler) GetRecentMovements(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, movements)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeMovementsForPermissions(movements, getPermissionsFromContext(r.Context())))
 }
 
 func (h *DashboardHandler) GetStockTrends(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +121,7 @@ func (h *DashboardHandler) GetCategoryBreakdown(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, breakdown)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeCategoryBreakdownForPermissions(breakdown, getPermissionsFromContext(r.Context())))
 }
 
 func (h *DashboardHandler) GetLowStockItems(w http.ResponseWriter, r *http.Request) {
@@ -130,14 +137,80 @@ func (h *DashboardHandler) GetLowStockItems(w http.ResponseWriter, r *http.Reque
 		limit = 10
 	}
 
-	items, err := h.dashboardService.GetLowStockItems(r.Context(), orgUUID, limit)
+	locationID, ok := parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := h.dashboardService.GetLowStockItems(r.Context(), orgUUID, locationID, limit)
 	if err != nil {
 		h.log.Error("Failed to get low stock items", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, items)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeItemsForPermissions(items, getPermissionsFromContext(r.Context())))
+}
+
+func (h *DashboardHandler) GetLocationBreakdown(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	breakdown, err := h.dashboardService.GetLocationBreakdown(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to get location breakdown", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, sanitizeLocationBreakdownForPermissions(breakdown, getPermissionsFromContext(r.Context())))
+}
+
+func (h *DashboardHandler) GetExpiringLots(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+	}
+
+	locationID, ok := parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	lots, err := h.dashboardService.GetExpiringLots(r.Context(), orgUUID, days, locationID)
+	if err != nil {
+		h.log.Error("Failed to get expiring lots", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, lots)
+}
+
+// parseLocationFilter reads the optional locationId query parameter; nil
+// means all locations
+func parseLocationFilter(w http.ResponseWriter, r *http.Request) (*uuid.UUID, bool) {
+	raw := r.URL.Query().Get("locationId")
+	if raw == "" {
+		return nil, true
+	}
+	locationID, err := uuid.Parse(raw)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_LOCATION_ID", "Invalid location ID", nil)
+		return nil, false
+	}
+	return &locationID, true
 }
 
 func (h *DashboardHandler) GetAlerts(w http.ResponseWriter, r *http.Request) {
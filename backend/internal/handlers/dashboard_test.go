@@ -24,10 +24,15 @@ type mockDashboardService struct {
 	breakdown       []services.CategoryBreakdown
 	lowStockItems   []*domain.Item
 	alerts          []*domain.Alert
+	locations       []services.LocationBreakdown
+	expiringLots    []services.ExpiringLot
+	locationID      *uuid.UUID
+	days            int
 	shouldError     bool
 }
 
-func (m *mockDashboardService) GetMetrics(ctx context.Context, orgID uuid.UUID) (*services.DashboardMetrics, error) {
+func (m *mockDashboardService) GetMetrics(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID) (*services.DashboardMetrics, error) {
+	m.locationID = locationID
 	if m.shouldError {
 		return nil, assert.AnError
 	}
@@ -55,13 +60,29 @@ func (m *mockDashboardService) GetCategoryBreakdown(ctx context.Context, orgID u
 	return m.breakdown, nil
 }
 
-func (m *mockDashboardService) GetLowStockItems(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Item, error) {
+func (m *mockDashboardService) GetLowStockItems(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID, limit int) ([]*domain.Item, error) {
 	if m.shouldError {
 		return nil, assert.AnError
 	}
 	return m.lowStockItems, nil
 }
 
+func (m *mockDashboardService) GetLocationBreakdown(ctx context.Context, orgID uuid.UUID) ([]services.LocationBreakdown, error) {
+	if m.shouldError {
+		return nil, assert.AnError
+	}
+	return m.locations, nil
+}
+
+func (m *mockDashboardService) GetExpiringLots(ctx context.Context, orgID uuid.UUID, days int, locationID *uuid.UUID) ([]services.ExpiringLot, error) {
+	m.days = days
+	m.locationID = locationID
+	if m.shouldError {
+		return nil, assert.AnError
+	}
+	return m.expiringLots, nil
+}
+
 func (m *mockDashboardService) GetAlerts(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error) {
 	if m.shouldError {
 		return nil, assert.AnError
@@ -92,6 +113,7 @@ func TestDashboardHandler_GetMetrics(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/dashboard/metrics", nil)
 	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	req = req.WithContext(context.WithValue(req.Context(), "role", string(domain.RoleAdmin)))
 	w := httptest.NewRecorder()
 
 	handler.GetMetrics(w, req)
@@ -137,6 +159,83 @@ func TestDashboardHandler_GetMetrics_ServiceError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestDashboardHandler_GetMetrics_LocationFilter(t *testing.T) {
+	mockService := &mockDashboardService{metrics: &services.DashboardMetrics{}}
+	handler := NewDashboardHandler(mockService, logger.New("info"))
+	orgID := uuid.New()
+	locationID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/metrics?locationId="+locationID.String(), nil)
+	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	w := httptest.NewRecorder()
+
+	handler.GetMetrics(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, mockService.locationID)
+	assert.Equal(t, locationID, *mockService.locationID)
+
+	req = httptest.NewRequest(http.MethodGet, "/dashboard/metrics?locationId=cooler", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	w = httptest.NewRecorder()
+
+	handler.GetMetrics(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDashboardHandler_GetExpiringLots(t *testing.T) {
+	lotNumber := "B-0412"
+	mockService := &mockDashboardService{
+		expiringLots: []services.ExpiringLot{
+			{
+				LotID:             uuid.New(),
+				ItemID:            uuid.New(),
+				ItemName:          "Paneer",
+				UnitOfMeasurement: "kg",
+				LocationID:        uuid.New(),
+				LocationName:      "Cooler",
+				LotNumber:         &lotNumber,
+				ExpiresAt:         time.Now().Add(36 * time.Hour),
+				Quantity:          2000,
+				DaysLeft:          1,
+			},
+		},
+	}
+	handler := NewDashboardHandler(mockService, logger.New("info"))
+	orgID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/expiring-lots", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	w := httptest.NewRecorder()
+
+	handler.GetExpiringLots(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 7, mockService.days)
+	assert.Nil(t, mockService.locationID)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	data := response["data"].([]interface{})
+	require.Len(t, data, 1)
+	lot := data[0].(map[string]interface{})
+	assert.Equal(t, "Paneer", lot["itemName"])
+	assert.Equal(t, "B-0412", lot["lotNumber"])
+
+	locationID := uuid.New()
+	req = httptest.NewRequest(http.MethodGet, "/dashboard/expiring-lots?days=3&locationId="+locationID.String(), nil)
+	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	w = httptest.NewRecorder()
+
+	handler.GetExpiringLots(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, mockService.days)
+	require.NotNil(t, mockService.locationID)
+	assert.Equal(t, locationID, *mockService.locationID)
+}
+
 func TestDashboardHandler_GetRecentMovements(t *testing.T) {
 	itemID := uuid.New()
 	userID := uuid.New()
@@ -269,6 +368,7 @@ func TestDashboardHandler_GetCategoryBreakdown(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/dashboard/category-breakdown", nil)
 	req = req.WithContext(context.WithValue(req.Context(), "organization_id", orgID.String()))
+	req = req.WithContext(context.WithValue(req.Context(), "role", string(domain.RoleAdmin)))
 	w := httptest.NewRecorder()
 
 	handler.GetCategoryBreakdown(w, req)
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// itemETag formats an item version as a strong entity tag
+func itemETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch reads the item version from the If-Match header. It returns
+// nil when the header is absent or "*". ok is false when the header holds
+// something other than a single tag issued by itemETag, which can never match.
+func parseIfMatch(r *http.Request) (version *int, ok bool) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" || raw == "*" {
+		return nil, true
+	}
+
+	tag := strings.TrimPrefix(raw, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return nil, false
+	}
+	v, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return nil, false
+	}
+	return &v, true
+}
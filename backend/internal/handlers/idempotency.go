@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// hashRequestBody fingerprints a request body so a key reused with a
+// different payload can be told apart from a genuine retry
+func hashRequestBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
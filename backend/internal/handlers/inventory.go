@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -12,7 +13,6 @@ import (
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/services"
 	"hasufel.kj/pkg/logger"
-	"hasufel.kj/pkg/units"
 	"hasufel.kj/pkg/utils"
 )
 
@@ -31,10 +31,6 @@ func NewInventoryHandler(inventoryService *services.InventoryService, log *logge
 // Item handlers
 
 func (h *InventoryHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	orgID := r.Context().Value("organization_id").(string)
 	orgUUID, err := uuid.Parse(orgID)
 	if err != nil {
@@ -42,6 +38,13 @@ func (h *InventoryHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
 	// Decode display request (with float64 values from frontend)
 	var req domain.CreateItemRequestDisplay
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -49,20 +52,26 @@ func (h *InventoryHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate unit
-	if err := units.Validate(req.UnitOfMeasurement); err != nil {
+	// Validate unit against the built-in and organization units
+	registry, err := h.inventoryService.Units(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to load units", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if err := registry.Validate(req.UnitOfMeasurement); err != nil {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", "Invalid unit of measurement", nil)
 		return
 	}
 
 	// Convert display values to base units
-	currentStockBase, err := units.ToBaseUnit(req.CurrentStock, req.UnitOfMeasurement)
+	currentStockBase, err := registry.ToBaseUnit(req.CurrentStock, req.UnitOfMeasurement)
 	if err != nil {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_STOCK", "Invalid stock value", nil)
 		return
 	}
 
-	thresholdBase, err := units.ToBaseUnit(req.MinimumThreshold, req.UnitOfMeasurement)
+	thresholdBase, err := registry.ToBaseUnit(req.MinimumThreshold, req.UnitOfMeasurement)
 	if err != nil {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_THRESHOLD", "Invalid threshold value", nil)
 		return
@@ -92,7 +101,7 @@ func (h *InventoryHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		TrackStock:        trackStock,
 	}
 
-	itemID, err := h.inventoryService.CreateItem(r.Context(), item)
+	itemID, err := h.inventoryService.CreateItem(r.Context(), item, userUUID)
 	if err != nil {
 		if err == services.ErrCategoryNotFound {
 			utils.RespondError(w, http.StatusNotFound, "CATEGORY_NOT_FOUND", "Category not found", nil)
@@ -106,14 +115,14 @@ func (h *InventoryHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	item.ID = itemID
 
 	// Convert to display format for response
-	itemDisplay, err := item.ToDisplay()
+	itemDisplay, err := item.ToDisplay(registry)
 	if err != nil {
 		h.log.Error("Failed to convert item to display", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusCreated, itemDisplay)
+	utils.RespondSuccess(w, http.StatusCreated, sanitizeItemDisplayForPermissions(itemDisplay, getPermissionsFromContext(r.Context())))
 }
 
 func (h *InventoryHandler) GetItem(w http.ResponseWriter, r *http.Request) {
@@ -136,15 +145,22 @@ func (h *InventoryHandler) GetItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert to display format
-	itemDisplay, err := item.ToDisplay()
+	registry, err := h.inventoryService.Units(r.Context(), item.OrganizationID)
+	if err != nil {
+		h.log.Error("Failed to load units", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	itemDisplay, err := item.ToDisplay(registry)
 	if err != nil {
 		h.log.Error("Failed to convert item to display", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	role := getRoleFromContext(r.Context())
-	utils.RespondSuccess(w, http.StatusOK, sanitizeItemDisplayForRole(itemDisplay, role))
+	perms := getPermissionsFromContext(r.Context())
+	w.Header().Set("ETag", itemETag(item.Version))
+	utils.RespondSuccess(w, http.StatusOK, sanitizeItemDisplayForPermissions(itemDisplay, perms))
 }
 
 func (h *InventoryHandler) GetItems(w http.ResponseWriter, r *http.Request) {
@@ -186,8 +202,8 @@ func (h *InventoryHandler) GetItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	role := getRoleFromContext(r.Context())
-	sanitizedItems := sanitizeItemsForRole(paginatedItems.Items, role)
+	perms := getPermissionsFromContext(r.Context())
+	sanitizedItems := sanitizeItemsForPermissions(paginatedItems.Items, perms)
 
 	response := domain.PaginatedItemsResponse{
 		Items: sanitizedItems,
@@ -197,10 +213,6 @@ func (h *InventoryHandler) GetItems(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *InventoryHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	itemID := chi.URLParam(r, "id")
 	id, err := uuid.Parse(itemID)
 	if err != nil {
@@ -208,6 +220,19 @@ func (h *InventoryHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	expectedVersion, ok := parseIfMatch(r)
+	if !ok {
+		utils.RespondError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "If-Match does not match the current item version", nil)
+		return
+	}
+
 	var req domain.UpdateItemRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
@@ -226,6 +251,11 @@ func (h *InventoryHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if expectedVersion != nil && *expectedVersion != item.Version {
+		utils.RespondError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "If-Match does not match the current item version", nil)
+		return
+	}
+
 	// Update fields if provided
 	if req.Name != nil {
 		item.Name = *req.Name
@@ -234,6 +264,16 @@ func (h *InventoryHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		item.SKU = req.SKU
 	}
 	if req.UnitOfMeasurement != nil {
+		registry, err := h.inventoryService.Units(r.Context(), item.OrganizationID)
+		if err != nil {
+			h.log.Error("Failed to load units", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+			return
+		}
+		if err := registry.Validate(*req.UnitOfMeasurement); err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", "Invalid unit of measurement", nil)
+			return
+		}
 		item.UnitOfMeasurement = *req.UnitOfMeasurement
 	}
 	if req.MinimumThreshold != nil {
@@ -252,20 +292,29 @@ func (h *InventoryHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		item.IsActive = *req.IsActive
 	}
 
-	if err := h.inventoryService.UpdateItem(r.Context(), item); err != nil {
+	if err := h.inventoryService.UpdateItem(r.Context(), item, userUUID); err != nil {
+		if err == services.ErrItemNotFound {
+			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+			return
+		}
+		if errors.Is(err, services.ErrIncompatibleUnitChange) {
+			utils.RespondError(w, http.StatusBadRequest, "INCOMPATIBLE_UNIT", services.ErrIncompatibleUnitChange.Error(), nil)
+			return
+		}
+		if errors.Is(err, services.ErrItemConflict) {
+			utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "Item was modified by another request", nil)
+			return
+		}
 		h.log.Error("Failed to update item", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, item)
+	w.Header().Set("ETag", itemETag(item.Version))
+	utils.RespondSuccess(w, http.StatusOK, sanitizeItemForPermissions(item, getPermissionsFromContext(r.Context())))
 }
 
 func (h *InventoryHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	itemID := chi.URLParam(r, "id")
 	id, err := uuid.Parse(itemID)
 	if err != nil {
@@ -278,6 +327,10 @@ func (h *InventoryHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
 			return
 		}
+		if err == services.ErrItemInRecipe {
+			utils.RespondError(w, http.StatusConflict, "ITEM_IN_RECIPE", "Item is an ingredient of a recipe; remove it from the recipe or deactivate the item instead", nil)
+			return
+		}
 		h.log.Error("Failed to delete item", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
@@ -289,10 +342,6 @@ func (h *InventoryHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 // Category handlers
 
 func (h *InventoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	orgID := r.Context().Value("organization_id").(string)
 	orgUUID, err := uuid.Parse(orgID)
 	if err != nil {
@@ -337,10 +386,6 @@ func (h *InventoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *InventoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	orgID := r.Context().Value("organization_id").(string)
 	orgUUID, err := uuid.Parse(orgID)
 	if err != nil {
@@ -367,7 +412,7 @@ func (h *InventoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 	}
 
 	if category.OrganizationID != orgUUID {
-		utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Category does not belong to this organization", nil)
+		utils.RespondError(w, http.StatusNotFound, "CATEGORY_NOT_FOUND", "Category not found", nil)
 		return
 	}
 
@@ -417,10 +462,6 @@ func (h *InventoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 }
 
 func (h *InventoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
-	if !requireAdmin(w, r) {
-		return
-	}
-
 	orgID := r.Context().Value("organization_id").(string)
 	orgUUID, err := uuid.Parse(orgID)
 	if err != nil {
@@ -447,7 +488,7 @@ func (h *InventoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request
 	}
 
 	if category.OrganizationID != orgUUID {
-		utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Category does not belong to this organization", nil)
+		utils.RespondError(w, http.StatusNotFound, "CATEGORY_NOT_FOUND", "Category not found", nil)
 		return
 	}
 
@@ -7,21 +7,23 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/middleware"
 	"hasufel.kj/internal/services"
 	"hasufel.kj/pkg/logger"
 )
 
-func TestInventoryHandler_CreateItem_RequiresAdmin(t *testing.T) {
+func TestInventoryHandler_CreateItem_RequiresItemsWrite(t *testing.T) {
 	itemRepo := &stubItemRepo{}
 	categoryRepo := &stubCategoryRepo{}
 	movementRepo := &stubMovementRepo{}
 	alertRepo := &stubAlertRepo{}
 
-	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, nil)
+	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
 	handler := NewInventoryHandler(service, logger.New("error"))
 
 	body := `{"categoryId":"` + uuid.New().String() + `","name":"Test Item","unit":"pcs","minimumThreshold":1,"currentStock":5}`
@@ -31,14 +33,14 @@ func TestInventoryHandler_CreateItem_RequiresAdmin(t *testing.T) {
 	req = req.WithContext(ctx)
 
 	rr := httptest.NewRecorder()
-	handler.CreateItem(rr, req)
+	middleware.RequirePermission(domain.PermItemsWrite)(http.HandlerFunc(handler.CreateItem)).ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusForbidden {
 		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rr.Code)
 	}
 
 	if itemRepo.createCalled {
-		t.Fatalf("expected create not to be called for non-admin user")
+		t.Fatalf("expected create not to be called for a user without items.write")
 	}
 
 	var resp map[string]interface{}
@@ -65,7 +67,7 @@ func TestInventoryHandler_GetItem_RedactsUnitCostForNonAdmin(t *testing.T) {
 	movementRepo := &stubMovementRepo{}
 	alertRepo := &stubAlertRepo{}
 
-	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, nil)
+	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
 	handler := NewInventoryHandler(service, logger.New("error"))
 
 	req := httptest.NewRequest(http.MethodGet, "/items/"+item.ID.String(), nil)
@@ -96,6 +98,50 @@ func TestInventoryHandler_GetItem_RedactsUnitCostForNonAdmin(t *testing.T) {
 	}
 }
 
+func TestInventoryHandler_GetItem_ShowsUnitCostWhenGranted(t *testing.T) {
+	cost := 12.34
+	item := &domain.Item{
+		ID:                uuid.New(),
+		Name:              "Costly Item",
+		UnitCost:          &cost,
+		CategoryID:        uuid.New(),
+		UnitOfMeasurement: "pcs",
+	}
+
+	service := services.NewInventoryService(&stubItemRepo{getByIDItem: item}, &stubCategoryRepo{}, &stubMovementRepo{}, &stubAlertRepo{}, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
+	handler := NewInventoryHandler(service, logger.New("error"))
+
+	// The organization grants costs.view to its users
+	perms := domain.DefaultPermissions(domain.RoleUser)
+	perms[domain.PermCostsView] = true
+
+	req := httptest.NewRequest(http.MethodGet, "/items/"+item.ID.String(), nil)
+	ctx := context.WithValue(req.Context(), "role", string(domain.RoleUser))
+	ctx = context.WithValue(ctx, "permissions", perms)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", item.ID.String())
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, routeCtx)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler.GetItem(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp struct {
+		Data domain.Item `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if resp.Data.UnitCost == nil || *resp.Data.UnitCost != cost {
+		t.Fatalf("expected unitCost to be shown to a user granted costs.view, got %v", resp.Data.UnitCost)
+	}
+}
+
 func TestInventoryHandler_GetItems_RedactsUnitCostForNonAdmin(t *testing.T) {
 	cost := 55.0
 	item := &domain.Item{
@@ -114,7 +160,7 @@ func TestInventoryHandler_GetItems_RedactsUnitCostForNonAdmin(t *testing.T) {
 	movementRepo := &stubMovementRepo{}
 	alertRepo := &stubAlertRepo{}
 
-	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, nil)
+	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
 	handler := NewInventoryHandler(service, logger.New("error"))
 
 	req := httptest.NewRequest(http.MethodGet, "/items", nil)
@@ -147,13 +193,13 @@ func TestInventoryHandler_GetItems_RedactsUnitCostForNonAdmin(t *testing.T) {
 	}
 }
 
-func TestInventoryHandler_CreateCategory_RequiresAdmin(t *testing.T) {
+func TestInventoryHandler_CreateCategory_RequiresCategoriesManage(t *testing.T) {
 	itemRepo := &stubItemRepo{}
 	categoryRepo := &stubCategoryRepo{}
 	movementRepo := &stubMovementRepo{}
 	alertRepo := &stubAlertRepo{}
 
-	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, nil)
+	service := services.NewInventoryService(itemRepo, categoryRepo, movementRepo, alertRepo, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
 	handler := NewInventoryHandler(service, logger.New("error"))
 
 	body := bytes.NewBufferString(`{"name":"Test Category"}`)
@@ -163,14 +209,14 @@ func TestInventoryHandler_CreateCategory_RequiresAdmin(t *testing.T) {
 	req = req.WithContext(ctx)
 
 	rr := httptest.NewRecorder()
-	handler.CreateCategory(rr, req)
+	middleware.RequirePermission(domain.PermCategoriesManage)(http.HandlerFunc(handler.CreateCategory)).ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusForbidden {
 		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rr.Code)
 	}
 
 	if categoryRepo.createCalled {
-		t.Fatalf("expected category create not to be called for non-admin user")
+		t.Fatalf("expected category create not to be called for a user without categories.manage")
 	}
 }
 
@@ -207,7 +253,7 @@ func (s *stubItemRepo) Update(ctx context.Context, item *domain.Item) error {
 	return nil
 }
 
-func (s *stubItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock int) error {
+func (s *stubItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
 	return nil
 }
 
@@ -219,6 +265,10 @@ func (s *stubItemRepo) ReassignCategory(ctx context.Context, fromCategoryID, toC
 	return nil
 }
 
+func (s *stubItemRepo) UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
 func (s *stubItemRepo) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
@@ -258,6 +308,10 @@ func (s *stubMovementRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.S
 	return nil, nil
 }
 
+func (s *stubMovementRepo) Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error) {
+	return true, nil
+}
+
 func (s *stubMovementRepo) ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
 	return nil, nil
 }
@@ -292,6 +346,191 @@ func (s *stubAlertRepo) MarkAsRead(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *stubAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID) error {
+func (s *stubAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID, types ...domain.AlertType) error {
+	return nil
+}
+
+type stubLocationRepo struct{}
+
+func (s *stubLocationRepo) Create(ctx context.Context, location *domain.Location) (uuid.UUID, error) {
+	location.ID = uuid.New()
+	return location.ID, nil
+}
+
+func (s *stubLocationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Location, error) {
+	return nil, nil
+}
+
+func (s *stubLocationRepo) GetDefault(ctx context.Context, orgID uuid.UUID) (*domain.Location, error) {
+	return nil, nil
+}
+
+func (s *stubLocationRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Location, error) {
+	return nil, nil
+}
+
+func (s *stubLocationRepo) Update(ctx context.Context, location *domain.Location) error {
+	return nil
+}
+
+func (s *stubLocationRepo) ClearDefault(ctx context.Context, orgID uuid.UUID) error {
+	return nil
+}
+
+func (s *stubLocationRepo) HasMovements(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (s *stubLocationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+type stubStockLevelRepo struct{}
+
+func (s *stubStockLevelRepo) Get(ctx context.Context, itemID, locationID uuid.UUID) (*domain.StockLevel, error) {
+	return nil, nil
+}
+
+func (s *stubStockLevelRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLevel, error) {
+	return nil, nil
+}
+
+func (s *stubStockLevelRepo) SetQuantity(ctx context.Context, itemID, locationID uuid.UUID, quantity int) error {
+	return nil
+}
+
+func (s *stubStockLevelRepo) SetThreshold(ctx context.Context, itemID, locationID uuid.UUID, threshold *int) error {
+	return nil
+}
+
+func (s *stubStockLevelRepo) CountStockedAtLocation(ctx context.Context, locationID uuid.UUID) (int, error) {
+	return 0, nil
+}
+
+func (s *stubStockLevelRepo) DeleteByLocation(ctx context.Context, locationID uuid.UUID) error {
+	return nil
+}
+
+type stubStockLotRepo struct{}
+
+func (s *stubStockLotRepo) Create(ctx context.Context, lot *domain.StockLot) (uuid.UUID, error) {
+	lot.ID = uuid.New()
+	return lot.ID, nil
+}
+
+func (s *stubStockLotRepo) ListAvailable(ctx context.Context, itemID, locationID uuid.UUID) ([]*domain.StockLot, error) {
+	return nil, nil
+}
+
+func (s *stubStockLotRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLot, error) {
+	return nil, nil
+}
+
+func (s *stubStockLotRepo) UpdateQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	return nil
+}
+
+func (s *stubStockLotRepo) AddQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	return nil
+}
+
+func (s *stubStockLotRepo) RecordMovement(ctx context.Context, movementID, lotID uuid.UUID, quantity int) error {
+	return nil
+}
+
+func (s *stubStockLotRepo) ListMovementLots(ctx context.Context, movementID uuid.UUID) ([]*domain.MovementLot, error) {
+	return nil, nil
+}
+
+func (s *stubStockLotRepo) ListExpiringUnalerted(ctx context.Context, before time.Time) ([]*domain.StockLot, error) {
+	return nil, nil
+}
+
+func (s *stubStockLotRepo) MarkExpiryAlerted(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return nil
+}
+
+type stubUnitRepo struct{}
+
+func (s *stubUnitRepo) Create(ctx context.Context, unit *domain.Unit) (uuid.UUID, error) {
+	unit.ID = uuid.New()
+	return unit.ID, nil
+}
+
+func (s *stubUnitRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Unit, error) {
+	return nil, nil
+}
+
+func (s *stubUnitRepo) GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.Unit, error) {
+	return nil, nil
+}
+
+func (s *stubUnitRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Unit, error) {
+	return nil, nil
+}
+
+func (s *stubUnitRepo) Update(ctx context.Context, unit *domain.Unit) error {
+	return nil
+}
+
+func (s *stubUnitRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (s *stubUnitRepo) IsInUse(ctx context.Context, orgID uuid.UUID, code string) (bool, error) {
+	return false, nil
+}
+
+func (s *stubUnitRepo) ListItemConversions(ctx context.Context, itemID uuid.UUID) ([]*domain.ItemUnitConversion, error) {
+	return nil, nil
+}
+
+func (s *stubUnitRepo) SetItemConversion(ctx context.Context, conversion *domain.ItemUnitConversion) error {
+	return nil
+}
+
+func (s *stubUnitRepo) DeleteItemConversion(ctx context.Context, itemID uuid.UUID, unit string) error {
+	return nil
+}
+
+type stubMovementReasonRepo struct{}
+
+func (s *stubMovementReasonRepo) Create(ctx context.Context, reason *domain.MovementReason) (bool, error) {
+	reason.ID = uuid.New()
+	return true, nil
+}
+
+func (s *stubMovementReasonRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.MovementReason, error) {
+	return nil, nil
+}
+
+func (s *stubMovementReasonRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error) {
+	return nil, nil
+}
+
+func (s *stubMovementReasonRepo) Update(ctx context.Context, reason *domain.MovementReason) error {
+	return nil
+}
+
+type stubCostingRepo struct{}
+
+func (s *stubCostingRepo) GetMethod(ctx context.Context, orgID uuid.UUID) (domain.CostingMethod, error) {
+	return domain.CostingFIFO, nil
+}
+
+func (s *stubCostingRepo) SetMethod(ctx context.Context, orgID uuid.UUID, method domain.CostingMethod) error {
+	return nil
+}
+
+func (s *stubCostingRepo) CreateLayer(ctx context.Context, layer *domain.CostLayer) (uuid.UUID, error) {
+	layer.ID = uuid.New()
+	return layer.ID, nil
+}
+
+func (s *stubCostingRepo) ListOpenLayers(ctx context.Context, itemID uuid.UUID) ([]*domain.CostLayer, error) {
+	return nil, nil
+}
+
+func (s *stubCostingRepo) UpdateLayer(ctx context.Context, layer *domain.CostLayer) error {
 	return nil
 }
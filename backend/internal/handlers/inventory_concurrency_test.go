@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+)
+
+func newItemRequest(method string, item *domain.Item, body string, role domain.UserRole) *http.Request {
+	req := httptest.NewRequest(method, "/items/"+item.ID.String(), bytes.NewBufferString(body))
+	ctx := context.WithValue(req.Context(), "role", string(role))
+	ctx = context.WithValue(ctx, "organization_id", item.OrganizationID.String())
+	ctx = context.WithValue(ctx, "user_id", uuid.New().String())
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", item.ID.String())
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, routeCtx)
+	return req.WithContext(ctx)
+}
+
+func TestInventoryHandler_GetItem_SetsETag(t *testing.T) {
+	item := &domain.Item{ID: uuid.New(), OrganizationID: uuid.New(), Name: "Sooji", UnitOfMeasurement: "kg", Version: 3}
+	service := services.NewInventoryService(&stubItemRepo{getByIDItem: item}, &stubCategoryRepo{}, &stubMovementRepo{}, &stubAlertRepo{}, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
+	handler := NewInventoryHandler(service, logger.New("error"))
+
+	rr := httptest.NewRecorder()
+	handler.GetItem(rr, newItemRequest(http.MethodGet, item, "", domain.RoleUser))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("ETag"); got != `"3"` {
+		t.Fatalf(`expected ETag "3", got %q`, got)
+	}
+}
+
+func TestInventoryHandler_UpdateItem_StaleIfMatch(t *testing.T) {
+	item := &domain.Item{ID: uuid.New(), OrganizationID: uuid.New(), Name: "Sooji", UnitOfMeasurement: "kg", Version: 3}
+	service := services.NewInventoryService(&stubItemRepo{getByIDItem: item}, &stubCategoryRepo{}, &stubMovementRepo{}, &stubAlertRepo{}, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
+	handler := NewInventoryHandler(service, logger.New("error"))
+
+	tests := []struct {
+		name    string
+		ifMatch string
+	}{
+		{"older version", `"2"`},
+		{"weak older version", `W/"2"`},
+		{"not an issued tag", `"abc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newItemRequest(http.MethodPut, item, `{"name":"Sooji Fine"}`, domain.RoleAdmin)
+			req.Header.Set("If-Match", tt.ifMatch)
+
+			rr := httptest.NewRecorder()
+			handler.UpdateItem(rr, req)
+
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Fatalf("expected status %d, got %d", http.StatusPreconditionFailed, rr.Code)
+			}
+			if item.Name != "Sooji" {
+				t.Fatalf("expected item to be untouched, got name %q", item.Name)
+			}
+		})
+	}
+}
+
+func TestMovementHandler_CreateMovement_MalformedIfMatch(t *testing.T) {
+	item := &domain.Item{ID: uuid.New(), OrganizationID: uuid.New(), Name: "Sooji", UnitOfMeasurement: "kg", Version: 1}
+	service := services.NewInventoryService(&stubItemRepo{getByIDItem: item}, &stubCategoryRepo{}, &stubMovementRepo{}, &stubAlertRepo{}, &stubLocationRepo{}, &stubStockLevelRepo{}, &stubStockLotRepo{}, &stubUnitRepo{}, &stubMovementReasonRepo{}, &stubCostingRepo{}, nil)
+	handler := NewMovementHandler(service, nil, nil, logger.New("error"))
+
+	body := `{"itemId":"` + item.ID.String() + `","movementType":"IN","quantity":5}`
+	req := newItemRequest(http.MethodPost, item, body, domain.RoleUser)
+	req.Header.Set("If-Match", "1")
+
+	rr := httptest.NewRecorder()
+	handler.CreateMovement(rr, req)
+
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status %d, got %d", http.StatusPreconditionFailed, rr.Code)
+	}
+}
@@ -1,34 +1,26 @@
 package handlers
 
-import "hasufel.kj/internal/domain"
+import (
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
 
-// sanitizeItemDisplayForRole removes sensitive fields based on user role
-func sanitizeItemDisplayForRole(item *domain.ItemDisplay, role domain.UserRole) *domain.ItemDisplay {
+// sanitizeItemDisplayForPermissions removes the fields the caller's
+// permissions don't let them see
+func sanitizeItemDisplayForPermissions(item *domain.ItemDisplay, perms domain.PermissionSet) *domain.ItemDisplay {
 	if item == nil {
 		return nil
 	}
 
-	if role != domain.RoleAdmin {
+	if !perms.Has(domain.PermCostsView) {
 		item.UnitCost = nil
 	}
 
 	return item
 }
 
-// sanitizeItemsDisplayForRole sanitizes multiple items
-func sanitizeItemsDisplayForRole(items []*domain.ItemDisplay, role domain.UserRole) []*domain.ItemDisplay {
-	if len(items) == 0 {
-		return items
-	}
-
-	for _, item := range items {
-		sanitizeItemDisplayForRole(item, role)
-	}
-	return items
-}
-
 // Legacy functions for backward compatibility (can be removed if not used)
-func sanitizeItemForRole(item *domain.Item, role domain.UserRole) *domain.Item {
+func sanitizeItemForPermissions(item *domain.Item, perms domain.PermissionSet) *domain.Item {
 	if item == nil {
 		return nil
 	}
@@ -39,21 +31,109 @@ func sanitizeItemForRole(item *domain.Item, role domain.UserRole) *domain.Item {
 		cloned.Category = &categoryCopy
 	}
 
-	if role != domain.RoleAdmin {
+	if !perms.Has(domain.PermCostsView) {
 		cloned.UnitCost = nil
 	}
 
 	return &cloned
 }
 
-func sanitizeItemsForRole(items []*domain.Item, role domain.UserRole) []*domain.Item {
+func sanitizeItemsForPermissions(items []*domain.Item, perms domain.PermissionSet) []*domain.Item {
 	if len(items) == 0 {
 		return items
 	}
 
 	result := make([]*domain.Item, 0, len(items))
 	for _, it := range items {
-		result = append(result, sanitizeItemForRole(it, role))
+		result = append(result, sanitizeItemForPermissions(it, perms))
 	}
 	return result
 }
+
+// sanitizeMovementsForPermissions redacts the joined item of each movement
+// and removes the cost of goods for callers who can't view costs
+func sanitizeMovementsForPermissions(movements []*domain.StockMovement, perms domain.PermissionSet) []*domain.StockMovement {
+	for _, movement := range movements {
+		if movement == nil {
+			continue
+		}
+		if movement.Item != nil {
+			movement.Item = sanitizeItemForPermissions(movement.Item, perms)
+		}
+		if !perms.Has(domain.PermCostsView) {
+			movement.TotalCost = nil
+		}
+	}
+	return movements
+}
+
+// sanitizeStockCountsForPermissions removes the cost snapshot and variance
+// costs of stock counts for callers who can't view costs
+func sanitizeStockCountsForPermissions(counts []*domain.StockCount, perms domain.PermissionSet) []*domain.StockCount {
+	if perms.Has(domain.PermCostsView) {
+		return counts
+	}
+
+	for _, count := range counts {
+		count.VarianceCost = nil
+		for _, line := range count.Lines {
+			line.UnitCost = nil
+			line.VarianceCost = nil
+		}
+	}
+	return counts
+}
+
+// sanitizeReorderListForPermissions removes the unit and estimated costs of
+// the suggestions for callers who can't view costs
+func sanitizeReorderListForPermissions(list *domain.ReorderList, perms domain.PermissionSet) *domain.ReorderList {
+	if list == nil || perms.Has(domain.PermCostsView) {
+		return list
+	}
+
+	for _, group := range list.Groups {
+		group.EstimatedCost = 0
+		for _, line := range group.Lines {
+			line.UnitCost = nil
+			line.EstimatedCost = nil
+		}
+	}
+	return list
+}
+
+// sanitizeDashboardMetricsForPermissions removes the stock value from the
+// metrics for callers who can't view costs
+func sanitizeDashboardMetricsForPermissions(metrics *services.DashboardMetrics, perms domain.PermissionSet) *services.DashboardMetrics {
+	if metrics == nil || perms.Has(domain.PermCostsView) {
+		return metrics
+	}
+
+	metrics.TotalValue = 0
+	return metrics
+}
+
+// sanitizeCategoryBreakdownForPermissions removes the stock value of each
+// category for callers who can't view costs
+func sanitizeCategoryBreakdownForPermissions(breakdown []services.CategoryBreakdown, perms domain.PermissionSet) []services.CategoryBreakdown {
+	if perms.Has(domain.PermCostsView) {
+		return breakdown
+	}
+
+	for i := range breakdown {
+		breakdown[i].TotalValue = 0
+	}
+	return breakdown
+}
+
+// sanitizeLocationBreakdownForPermissions removes the stock value of each
+// location for callers who can't view costs
+func sanitizeLocationBreakdownForPermissions(breakdown []services.LocationBreakdown, perms domain.PermissionSet) []services.LocationBreakdown {
+	if perms.Has(domain.PermCostsView) {
+		return breakdown
+	}
+
+	for i := range breakdown {
+		breakdown[i].TotalValue = 0
+	}
+	return breakdown
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// LedgerHandler checks and repairs the movement ledger
+type LedgerHandler struct {
+	ledgerService *services.LedgerService
+	log           *logger.Logger
+}
+
+func NewLedgerHandler(ledgerService *services.LedgerService, log *logger.Logger) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+		log:           log,
+	}
+}
+
+// CheckLedger replays the ledger of every item and reports the gaps, breaks
+// and mismatches found, with the movement a repair would post for each
+func (h *LedgerHandler) CheckLedger(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	check, err := h.ledgerService.Check(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to check ledger", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, check)
+}
+
+// RepairLedger checks the ledger and posts a movement closing each issue
+// found
+func (h *LedgerHandler) RepairLedger(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	check, err := h.ledgerService.Repair(r.Context(), orgUUID, userUUID)
+	if err != nil {
+		h.log.Error("Failed to repair ledger", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, check)
+}
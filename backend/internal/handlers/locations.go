@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/utils"
+)
+
+// Location handlers
+
+func (h *InventoryHandler) GetLocations(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	locations, err := h.inventoryService.ListLocations(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list locations", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, locations)
+}
+
+func (h *InventoryHandler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CreateLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Location name is required", nil)
+		return
+	}
+
+	location := &domain.Location{
+		OrganizationID: orgUUID,
+		Name:           name,
+		Description:    trimmedOrNil(req.Description),
+		IsDefault:      req.IsDefault,
+	}
+	if _, err := h.inventoryService.CreateLocation(r.Context(), location); err != nil {
+		h.log.Error("Failed to create location", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, location)
+}
+
+func (h *InventoryHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	location, ok := h.orgLocation(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Location name is required", nil)
+			return
+		}
+		location.Name = name
+	}
+	if req.Description != nil {
+		location.Description = trimmedOrNil(req.Description)
+	}
+	if req.IsDefault != nil {
+		location.IsDefault = *req.IsDefault
+	}
+	if req.IsActive != nil {
+		location.IsActive = *req.IsActive
+	}
+
+	if err := h.inventoryService.UpdateLocation(r.Context(), location); err != nil {
+		switch err {
+		case services.ErrLocationNotFound:
+			utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+		case services.ErrDefaultLocation:
+			utils.RespondError(w, http.StatusConflict, "DEFAULT_LOCATION", "Make another location the default first", nil)
+		case services.ErrLocationInactive:
+			utils.RespondError(w, http.StatusBadRequest, "LOCATION_INACTIVE", "An inactive location cannot be the default", nil)
+		default:
+			h.log.Error("Failed to update location", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, location)
+}
+
+func (h *InventoryHandler) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	location, ok := h.orgLocation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.inventoryService.DeleteLocation(r.Context(), location.ID); err != nil {
+		switch err {
+		case services.ErrLocationNotFound:
+			utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+		case services.ErrDefaultLocation:
+			utils.RespondError(w, http.StatusConflict, "DEFAULT_LOCATION", "The default location cannot be deleted", nil)
+		case services.ErrLocationHasStock:
+			utils.RespondError(w, http.StatusConflict, "LOCATION_HAS_STOCK", "Transfer the stock out of this location before deleting it", nil)
+		case services.ErrLocationInUse:
+			utils.RespondError(w, http.StatusConflict, "LOCATION_IN_USE", "Location has movement history; deactivate it instead", nil)
+		default:
+			h.log.Error("Failed to delete location", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Location deleted successfully"})
+}
+
+// orgLocation loads the location named by the id URL parameter and checks it
+// belongs to the caller's organization, writing the error response if not
+func (h *InventoryHandler) orgLocation(w http.ResponseWriter, r *http.Request) (*domain.Location, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	locationID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_LOCATION_ID", "Invalid location ID", nil)
+		return nil, false
+	}
+
+	location, err := h.inventoryService.GetLocation(r.Context(), locationID)
+	if err != nil {
+		if err == services.ErrLocationNotFound {
+			utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch location", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if location.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+		return nil, false
+	}
+
+	return location, true
+}
+
+// Stock level handlers
+
+// GetItemStock lists the stock of an item at each location, in base units
+func (h *InventoryHandler) GetItemStock(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	levels, err := h.inventoryService.ListStockLevels(r.Context(), item.ID)
+	if err != nil {
+		h.log.Error("Failed to list stock levels", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if levels == nil {
+		levels = []*domain.StockLevel{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, levels)
+}
+
+// GetItemLots lists the lots of an item still holding stock
+func (h *InventoryHandler) GetItemLots(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	lots, err := h.inventoryService.ListLots(r.Context(), item.ID)
+	if err != nil {
+		h.log.Error("Failed to list lots", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if lots == nil {
+		lots = []*domain.StockLot{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, lots)
+}
+
+// UpdateItemStockThreshold sets the minimum threshold of an item at one
+// location; null reverts to the item's own threshold
+func (h *InventoryHandler) UpdateItemStockThreshold(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	locationID, err := uuid.Parse(chi.URLParam(r, "locationId"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_LOCATION_ID", "Invalid location ID", nil)
+		return
+	}
+
+	var req domain.UpdateStockLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	if req.MinimumThreshold != nil && *req.MinimumThreshold < 0 {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Minimum threshold cannot be negative", nil)
+		return
+	}
+
+	level, err := h.inventoryService.SetLocationThreshold(r.Context(), item.ID, locationID, req.MinimumThreshold)
+	if err != nil {
+		switch err {
+		case services.ErrItemNotFound:
+			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+		case services.ErrLocationNotFound:
+			utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+		default:
+			h.log.Error("Failed to update stock threshold", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, level)
+}
+
+// orgItem loads the item named by the id URL parameter and checks it belongs
+// to the caller's organization, writing the error response if not
+func (h *InventoryHandler) orgItem(w http.ResponseWriter, r *http.Request) (*domain.Item, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	itemID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ITEM_ID", "Invalid item ID", nil)
+		return nil, false
+	}
+
+	item, err := h.inventoryService.GetItem(r.Context(), itemID)
+	if err != nil {
+		if err == services.ErrItemNotFound {
+			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to get item", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if item.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+		return nil, false
+	}
+
+	return item, true
+}
+
+// trimmedOrNil trims an optional string, treating blank as unset
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
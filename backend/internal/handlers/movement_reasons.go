@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/utils"
+)
+
+// Movement reason handlers
+
+// GetMovementReasons lists the reasons OUT movements can be recorded with;
+// an organization starts with WASTE_SPOILED, WASTE_DROPPED, STAFF_MEAL, COMP
+// and THEFT
+func (h *InventoryHandler) GetMovementReasons(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	list, err := h.inventoryService.ListMovementReasons(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list movement reasons", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if list == nil {
+		list = []*domain.MovementReason{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, list)
+}
+
+func (h *InventoryHandler) CreateMovementReason(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CreateMovementReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	reason, err := h.inventoryService.CreateMovementReason(r.Context(), orgUUID, &req)
+	if err != nil {
+		h.respondMovementReasonError(w, err, "Failed to create movement reason")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, reason)
+}
+
+// UpdateMovementReason renames a reason, changes whether it counts as waste
+// or deactivates it; reasons are never deleted
+func (h *InventoryHandler) UpdateMovementReason(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	reasonID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REASON_ID", "Invalid movement reason ID", nil)
+		return
+	}
+
+	reason, err := h.inventoryService.GetMovementReason(r.Context(), reasonID)
+	if err != nil {
+		h.respondMovementReasonError(w, err, "Failed to fetch movement reason")
+		return
+	}
+	if reason.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "REASON_NOT_FOUND", "Movement reason not found", nil)
+		return
+	}
+
+	var req domain.UpdateMovementReasonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.inventoryService.UpdateMovementReason(r.Context(), reason, &req); err != nil {
+		h.respondMovementReasonError(w, err, "Failed to update movement reason")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, reason)
+}
+
+// respondMovementReasonError maps errors from managing movement reasons to
+// API errors, logging anything unexpected as message
+func (h *InventoryHandler) respondMovementReasonError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case services.ErrMovementReasonNotFound:
+		utils.RespondError(w, http.StatusNotFound, "REASON_NOT_FOUND", "Movement reason not found", nil)
+	case services.ErrReasonCodeTaken:
+		utils.RespondError(w, http.StatusConflict, "REASON_CODE_TAKEN", err.Error(), nil)
+	case services.ErrInvalidReasonCode, services.ErrInvalidReasonName:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	default:
+		h.log.Error(message, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
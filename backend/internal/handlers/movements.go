@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -10,21 +13,31 @@ import (
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/services"
 	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/units"
 	"hasufel.kj/pkg/utils"
 )
 
 type MovementHandler struct {
-	inventoryService *services.InventoryService
+	inventoryService   *services.InventoryService
+	idempotencyService *services.IdempotencyService
+	// reversalPolicies holds which movements each role may reverse; roles
+	// without a policy cannot reverse movements
+	reversalPolicies map[domain.UserRole]services.ReversalPolicy
 	log              *logger.Logger
 }
 
-func NewMovementHandler(inventoryService *services.InventoryService, log *logger.Logger) *MovementHandler {
+func NewMovementHandler(inventoryService *services.InventoryService, idempotencyService *services.IdempotencyService, reversalPolicies map[domain.UserRole]services.ReversalPolicy, log *logger.Logger) *MovementHandler {
 	return &MovementHandler{
-		inventoryService: inventoryService,
-		log:              log,
+		inventoryService:   inventoryService,
+		idempotencyService: idempotencyService,
+		reversalPolicies:   reversalPolicies,
+		log:                log,
 	}
 }
 
+// CreateMovement records a single stock movement. Requests carrying an
+// Idempotency-Key are applied once per organization, user and key; a retry
+// gets the stored response back instead of moving stock again.
 func (h *MovementHandler) CreateMovement(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	userUUID, err := uuid.Parse(userID)
@@ -33,32 +46,262 @@ func (h *MovementHandler) CreateMovement(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	expectedVersion, ok := parseIfMatch(r)
+	if !ok {
+		utils.RespondError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "If-Match does not match the current item version", nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
 	var req domain.CreateMovementRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+	if req.MovementType == domain.MovementTypeAdjustment && !requirePermission(w, r, domain.PermMovementsAdjust) {
+		return
+	}
+
+	perms := getPermissionsFromContext(r.Context())
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || h.idempotencyService == nil {
+		movement, err := h.inventoryService.CreateMovement(r.Context(), &req, userUUID, expectedVersion)
+		if err != nil {
+			h.respondMovementError(w, err)
+			return
+		}
+		if movement.Item != nil {
+			w.Header().Set("ETag", itemETag(movement.Item.Version))
+		}
+		utils.RespondSuccess(w, http.StatusCreated, sanitizeMovementsForPermissions([]*domain.StockMovement{movement}, perms)[0])
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key must be at most 255 characters", nil)
+		return
+	}
+
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var movement *domain.StockMovement
+	record, replayed, err := h.idempotencyService.Do(r.Context(), orgUUID, userUUID, key, hashRequestBody(body),
+		func(ctx context.Context) (int, []byte, error) {
+			created, err := h.inventoryService.CreateMovement(ctx, &req, userUUID, expectedVersion)
+			if err != nil {
+				return 0, nil, err
+			}
+			movement = created
+			data, err := json.Marshal(sanitizeMovementsForPermissions([]*domain.StockMovement{created}, perms)[0])
+			if err != nil {
+				return 0, nil, err
+			}
+			return http.StatusCreated, data, nil
+		})
+	if err != nil {
+		if err == services.ErrIdempotencyKeyReused {
+			utils.RespondError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key was already used for a different request", nil)
+			return
+		}
+		if err == services.ErrIdempotencyKeyInUse {
+			utils.RespondError(w, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", "A request with this Idempotency-Key is already being processed", nil)
+			return
+		}
+		h.respondMovementError(w, err)
+		return
+	}
+
+	if replayed {
+		w.Header().Set(idempotentReplayedHeader, "true")
+	} else if movement.Item != nil {
+		w.Header().Set("ETag", itemETag(movement.Item.Version))
+	}
+	utils.RespondSuccess(w, record.ResponseStatus, json.RawMessage(record.ResponseBody))
+}
+
+// respondMovementError maps errors from creating a movement to API errors
+func (h *MovementHandler) respondMovementError(w http.ResponseWriter, err error) {
+	if err == services.ErrItemNotFound {
+		utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+		return
+	}
+	if err == services.ErrInsufficientStock {
+		utils.RespondError(w, http.StatusBadRequest, "INSUFFICIENT_STOCK", "Insufficient stock", nil)
+		return
+	}
+	if err == services.ErrInvalidQuantity {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_QUANTITY", "Invalid quantity", nil)
+		return
+	}
+	if errors.Is(err, units.ErrInvalidUnit) || errors.Is(err, units.ErrIncompatibleUnits) {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", err.Error(), nil)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidMovementType) {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_MOVEMENT_TYPE", "Invalid movement type", nil)
+		return
+	}
+	if err == services.ErrLocationNotFound {
+		utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+		return
+	}
+	if err == services.ErrLocationInactive {
+		utils.RespondError(w, http.StatusBadRequest, "LOCATION_INACTIVE", "Location is inactive", nil)
+		return
+	}
+	if err == services.ErrInvalidTransfer {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_TRANSFER", "TRANSFER needs a toLocationId different from locationId; other movement types take no toLocationId", nil)
+		return
+	}
+	if err == services.ErrLotNotAllowed || err == services.ErrInvalidLotNumber || err == services.ErrInvalidExpiry {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_LOT", err.Error(), nil)
+		return
+	}
+	if err == services.ErrReasonNotAllowed || err == services.ErrInvalidReason {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REASON", err.Error(), nil)
+		return
+	}
+	if err == services.ErrUnitCostNotAllowed || err == services.ErrInvalidUnitCost {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT_COST", err.Error(), nil)
+		return
+	}
+	if err == services.ErrItemVersionMismatch {
+		utils.RespondError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "If-Match does not match the current item version", nil)
+		return
+	}
+	if errors.Is(err, services.ErrItemConflict) {
+		utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "Item was modified by another request", nil)
+		return
+	}
+	h.log.Error("Failed to create movement", err)
+	utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+}
+
+// BulkCreateMovements applies a batch of stock movements atomically
+func (h *MovementHandler) BulkCreateMovements(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.BulkAdjustRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
 		return
 	}
+	for _, line := range req.Adjustments {
+		if line.MovementType == domain.MovementTypeAdjustment && !requirePermission(w, r, domain.PermMovementsAdjust) {
+			return
+		}
+	}
 
-	movement, err := h.inventoryService.CreateMovement(r.Context(), &req, userUUID)
+	movements, err := h.inventoryService.BulkAdjustStock(r.Context(), orgUUID, &req, userUUID)
 	if err != nil {
-		if err == services.ErrItemNotFound {
-			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+		var bulkErr *services.BulkAdjustError
+		if errors.As(err, &bulkErr) {
+			utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more adjustments are invalid", bulkErr.Lines)
 			return
 		}
-		if err == services.ErrInsufficientStock {
-			utils.RespondError(w, http.StatusBadRequest, "INSUFFICIENT_STOCK", "Insufficient stock", nil)
+		if err == services.ErrNoAdjustments {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "At least one adjustment is required", nil)
 			return
 		}
-		if err == services.ErrInvalidQuantity {
-			utils.RespondError(w, http.StatusBadRequest, "INVALID_QUANTITY", "Invalid quantity", nil)
+		if errors.Is(err, services.ErrItemConflict) {
+			utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "An item was modified by another request", nil)
 			return
 		}
-		h.log.Error("Failed to create movement", err)
+		h.log.Error("Failed to apply bulk movements", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusCreated, movement)
+	perms := getPermissionsFromContext(r.Context())
+	utils.RespondSuccess(w, http.StatusCreated, sanitizeMovementsForPermissions(movements, perms))
+}
+
+// ReverseMovement undoes a movement by posting its inverse and voiding the
+// original. Which movements the caller may reverse depends on their role.
+func (h *MovementHandler) ReverseMovement(w http.ResponseWriter, r *http.Request) {
+	role := getRoleFromContext(r.Context())
+	policy, ok := h.reversalPolicies[role]
+	if !ok {
+		utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Your role cannot reverse movements", nil)
+		return
+	}
+
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	movementID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_MOVEMENT_ID", "Invalid movement ID", nil)
+		return
+	}
+
+	// The body is optional
+	var req domain.ReverseMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	reversal, err := h.inventoryService.ReverseMovement(r.Context(), orgUUID, movementID, userUUID, policy, &req)
+	if err != nil {
+		switch {
+		case err == services.ErrMovementNotFound:
+			utils.RespondError(w, http.StatusNotFound, "MOVEMENT_NOT_FOUND", "Movement not found", nil)
+		case err == services.ErrMovementVoided:
+			utils.RespondError(w, http.StatusConflict, "MOVEMENT_VOIDED", err.Error(), nil)
+		case err == services.ErrReversalOfReversal:
+			utils.RespondError(w, http.StatusConflict, "MOVEMENT_IS_REVERSAL", err.Error(), nil)
+		case err == services.ErrReversalOfLedgerRepair:
+			utils.RespondError(w, http.StatusConflict, "MOVEMENT_IS_LEDGER_REPAIR", err.Error(), nil)
+		case err == services.ErrReversalOfUnitConversion:
+			utils.RespondError(w, http.StatusConflict, "MOVEMENT_IS_UNIT_CONVERSION", err.Error(), nil)
+		case err == services.ErrReversalForbidden:
+			utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", err.Error(), nil)
+		case err == services.ErrReversalTooOld:
+			utils.RespondError(w, http.StatusForbidden, "REVERSAL_WINDOW_EXPIRED", err.Error(), nil)
+		default:
+			h.respondMovementError(w, err)
+		}
+		return
+	}
+
+	if reversal.Item != nil {
+		w.Header().Set("ETag", itemETag(reversal.Item.Version))
+	}
+	utils.RespondSuccess(w, http.StatusCreated, sanitizeMovementsForPermissions([]*domain.StockMovement{reversal}, getPermissionsFromContext(r.Context()))[0])
 }
 
 func (h *MovementHandler) GetMovements(w http.ResponseWriter, r *http.Request) {
@@ -83,7 +326,7 @@ func (h *MovementHandler) GetMovements(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, movements)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeMovementsForPermissions(movements, getPermissionsFromContext(r.Context())))
 }
 
 func (h *MovementHandler) GetItemMovements(w http.ResponseWriter, r *http.Request) {
@@ -103,10 +346,14 @@ func (h *MovementHandler) GetItemMovements(w http.ResponseWriter, r *http.Reques
 
 	movements, err := h.inventoryService.ListMovementsByItem(r.Context(), id, limit, offset)
 	if err != nil {
+		if err == services.ErrItemNotFound {
+			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+			return
+		}
 		h.log.Error("Failed to list item movements", err)
 		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
 		return
 	}
 
-	utils.RespondSuccess(w, http.StatusOK, movements)
+	utils.RespondSuccess(w, http.StatusOK, sanitizeMovementsForPermissions(movements, getPermissionsFromContext(r.Context())))
 }
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/migrations"
+	"hasufel.kj/pkg/logger"
+)
+
+// Default organization seeded by the initial migration
+var seedOrgID = uuid.MustParse("928a9b9f-dd35-4145-a480-9b1be3d7e52e")
+
+func newIdempotentMovementHandler(t *testing.T) (handler *MovementHandler, itemRepo repository.ItemRepository, itemID, userID uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	dsn := "file:idem_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "?mode=memory&cache=shared"
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	userID, err = repository.NewUserRepository(db, database.DialectSQLite).Create(ctx, &domain.User{
+		OrganizationID: seedOrgID,
+		Email:          "tablet@example.com",
+		PasswordHash:   "hash",
+		FirstName:      "Kitchen",
+		LastName:       "Tablet",
+		Role:           domain.RoleAdmin,
+		IsActive:       true,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	itemRepo = repository.NewItemRepository(db, database.DialectSQLite)
+	categoryRepo := repository.NewCategoryRepository(db, database.DialectSQLite)
+	categoryID, err := categoryRepo.Create(ctx, &domain.Category{OrganizationID: seedOrgID, Name: "Idempotency"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	itemID, err = itemRepo.Create(ctx, &domain.Item{
+		OrganizationID:    seedOrgID,
+		CategoryID:        categoryID,
+		Name:              "Paneer",
+		UnitOfMeasurement: "kg",
+		CurrentStock:      1000,
+		IsActive:          true,
+		TrackStock:        true,
+	})
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+
+	inventory := services.NewInventoryService(itemRepo, categoryRepo,
+		repository.NewMovementRepository(db, database.DialectSQLite),
+		repository.NewAlertRepository(db, database.DialectSQLite),
+		repository.NewLocationRepository(db, database.DialectSQLite),
+		repository.NewStockLevelRepository(db, database.DialectSQLite),
+		repository.NewStockLotRepository(db, database.DialectSQLite),
+		repository.NewUnitRepository(db, database.DialectSQLite),
+		repository.NewMovementReasonRepository(db, database.DialectSQLite),
+		repository.NewCostingRepository(db, database.DialectSQLite), db)
+	idempotency := services.NewIdempotencyService(
+		repository.NewIdempotencyRepository(db, database.DialectSQLite), db, time.Hour)
+
+	return NewMovementHandler(inventory, idempotency, nil, logger.New("error")), itemRepo, itemID, userID
+}
+
+func postMovement(handler *MovementHandler, userID uuid.UUID, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/movements", bytes.NewBufferString(body))
+	req.Header.Set("Idempotency-Key", key)
+	ctx := context.WithValue(req.Context(), "role", string(domain.RoleAdmin))
+	ctx = context.WithValue(ctx, "organization_id", seedOrgID.String())
+	ctx = context.WithValue(ctx, "user_id", userID.String())
+	ctx = repository.WithOrganization(ctx, seedOrgID)
+
+	rr := httptest.NewRecorder()
+	handler.CreateMovement(rr, req.WithContext(ctx))
+	return rr
+}
+
+func TestMovementHandler_CreateMovement_ReplaysIdempotentRequest(t *testing.T) {
+	handler, itemRepo, itemID, userID := newIdempotentMovementHandler(t)
+	body := `{"itemId":"` + itemID.String() + `","movementType":"IN","quantity":500,"reference":"DN-42"}`
+
+	first := postMovement(handler, userID, body, "delivery-42")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, first.Code, first.Body.String())
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request must not be marked as replayed")
+	}
+
+	retry := postMovement(handler, userID, body, "delivery-42")
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("expected status %d on replay, got %d: %s", http.StatusCreated, retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replay header on retry")
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected replay to return the original response\nfirst: %s\nretry: %s", first.Body.String(), retry.Body.String())
+	}
+
+	item, err := itemRepo.GetByID(repository.WithOrganization(context.Background(), seedOrgID), itemID)
+	if err != nil || item == nil {
+		t.Fatalf("get item: %+v, %v", item, err)
+	}
+	if item.CurrentStock != 1500 {
+		t.Fatalf("expected delivery to be counted once (1500), got %d", item.CurrentStock)
+	}
+
+	reused := postMovement(handler, userID, strings.Replace(body, "500", "700", 1), "delivery-42")
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d for a reused key, got %d", http.StatusUnprocessableEntity, reused.Code)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// OrganizationHandler serves the organizations the caller belongs to. The
+// organization of the session is "current"; changing it needs
+// settings.manage and managing its members users.manage.
+type OrganizationHandler struct {
+	orgService *services.OrganizationService
+	log        *logger.Logger
+}
+
+func NewOrganizationHandler(orgService *services.OrganizationService, log *logger.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService: orgService,
+		log:        log,
+	}
+}
+
+// Organization handlers
+
+// GetOrganizations lists the organizations the caller is an active member
+// of, with their role in each
+func (h *OrganizationHandler) GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.callerID(w, r)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.orgService.ListOrganizations(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to list organizations", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if orgs == nil {
+		orgs = []*domain.Organization{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, orgs)
+}
+
+// CreateOrganization creates an organization with the caller as its admin.
+// The caller switches to it to work there.
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.callerID(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(r.Context(), userID, &req)
+	if err != nil {
+		h.respondOrganizationError(w, err, "Failed to create organization")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, org)
+}
+
+// GetCurrentOrganization returns the organization of the session with its
+// settings
+func (h *OrganizationHandler) GetCurrentOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := h.currentOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	org, err := h.orgService.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		h.respondOrganizationError(w, err, "Failed to fetch organization")
+		return
+	}
+	org.Role = getRoleFromContext(r.Context())
+
+	utils.RespondSuccess(w, http.StatusOK, org)
+}
+
+// UpdateCurrentOrganization changes the name, slug or settings of the
+// organization of the session
+func (h *OrganizationHandler) UpdateCurrentOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := h.currentOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	org, err := h.orgService.UpdateOrganization(r.Context(), orgID, &req)
+	if err != nil {
+		h.respondOrganizationError(w, err, "Failed to update organization")
+		return
+	}
+	org.Role = getRoleFromContext(r.Context())
+
+	utils.RespondSuccess(w, http.StatusOK, org)
+}
+
+// DeleteCurrentOrganization deletes the organization of the session with
+// everything it holds. The caller gets a session in another organization of
+// theirs, as after signing in.
+func (h *OrganizationHandler) DeleteCurrentOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.callerID(w, r)
+	if !ok {
+		return
+	}
+	orgID, ok := h.currentOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, user, err := h.orgService.DeleteOrganization(r.Context(), orgID, userID)
+	if err != nil {
+		h.respondOrganizationError(w, err, "Failed to delete organization")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, LoginResponse{
+		AuthTokens: tokens,
+		User:       user,
+	})
+}
+
+// Member handlers
+
+// AddMember invites an existing user to the organization of the session;
+// they join when they next sign in
+func (h *OrganizationHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := h.callerID(w, r)
+	if !ok {
+		return
+	}
+	orgID, ok := h.currentOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.AddMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	invitation, err := h.orgService.AddMember(r.Context(), orgID, actorID, &req)
+	if err != nil {
+		h.respondOrganizationError(w, err, "Failed to add member")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusAccepted, invitation)
+}
+
+// RemoveMember removes a user from the organization of the session
+func (h *OrganizationHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := h.callerID(w, r)
+	if !ok {
+		return
+	}
+	orgID, ok := h.currentOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	if err := h.orgService.RemoveMember(r.Context(), orgID, actorID, userID); err != nil {
+		h.respondOrganizationError(w, err, "Failed to remove member")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Member removed successfully"})
+}
+
+// respondOrganizationError maps errors from the organization service to API
+// errors, logging anything unexpected as logMessage
+func (h *OrganizationHandler) respondOrganizationError(w http.ResponseWriter, err error, logMessage string) {
+	switch err {
+	case services.ErrOrganizationNotFound:
+		utils.RespondError(w, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found", nil)
+	case services.ErrUserNotFound:
+		utils.RespondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found", nil)
+	case services.ErrInvalidOrganizationName, services.ErrInvalidSlug, services.ErrInvalidCurrency,
+		services.ErrInvalidTimezone, services.ErrInvalidCostingMethod, services.ErrInvalidEmail, services.ErrInvalidRole:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	case services.ErrSlugExists:
+		utils.RespondError(w, http.StatusConflict, "SLUG_EXISTS", err.Error(), nil)
+	case services.ErrOrganizationHasMembers:
+		utils.RespondError(w, http.StatusConflict, "ORGANIZATION_HAS_MEMBERS", err.Error(), nil)
+	case services.ErrLastOrganization:
+		utils.RespondError(w, http.StatusConflict, "LAST_ORGANIZATION", err.Error(), nil)
+	case services.ErrAlreadyMember:
+		utils.RespondError(w, http.StatusConflict, "ALREADY_MEMBER", err.Error(), nil)
+	case services.ErrRemoveSelf:
+		utils.RespondError(w, http.StatusConflict, "CANNOT_REMOVE_SELF", err.Error(), nil)
+	case services.ErrHomeOrganization:
+		utils.RespondError(w, http.StatusConflict, "HOME_ORGANIZATION", err.Error(), nil)
+	default:
+		h.log.Error(logMessage, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// callerID returns the ID of the calling user, writing the error response
+// if it is invalid
+func (h *OrganizationHandler) callerID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// currentOrgID returns the organization of the session, writing the error
+// response if it is invalid
+func (h *OrganizationHandler) currentOrgID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	orgID, err := uuid.Parse(r.Context().Value("organization_id").(string))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return uuid.Nil, false
+	}
+	return orgID, true
+}
@@ -0,0 +1,270 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/handlers"
+	"hasufel.kj/internal/middleware"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/migrations"
+	"hasufel.kj/pkg/logger"
+)
+
+// TestOrganizationHandler_MembershipAndSwitching has an admin open a second
+// outlet, move their session between the two, bring a cook of the first
+// outlet in as a manager, and close the outlet again
+func TestOrganizationHandler_MembershipAndSwitching(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:orgs_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "?mode=memory&cache=shared"
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	dialect := database.DialectSQLite
+	userRepo := repository.NewUserRepository(db, dialect)
+	orgRepo := repository.NewOrganizationRepository(db, dialect)
+
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, otherOrgID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	admin := &domain.User{OrganizationID: orgID, Email: "admin@example.com", PasswordHash: string(hash),
+		FirstName: "Ada", LastName: "Admin", Role: domain.RoleAdmin, IsActive: true}
+	cook := &domain.User{OrganizationID: orgID, Email: "cook@example.com", PasswordHash: string(hash),
+		FirstName: "Carl", LastName: "Cook", Role: domain.RoleUser, IsActive: true}
+	for _, u := range []*domain.User{admin, cook} {
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	log := logger.New("error")
+	authService := setupAuthService(db)
+	orgService := services.NewOrganizationService(orgRepo, userRepo, setupUserService(db, authService), authService, db)
+	authHandler := handlers.NewAuthHandler(authService, log)
+	orgHandler := handlers.NewOrganizationHandler(orgService, log)
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Post("/auth/refresh", authHandler.Refresh)
+	r.Post("/auth/switch-organization", authHandler.SwitchOrganization)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.Get("/auth/profile", authHandler.GetProfile)
+		r.Get("/organizations", orgHandler.GetOrganizations)
+		r.With(middleware.RequirePermission(domain.PermSettingsManage)).Post("/organizations", orgHandler.CreateOrganization)
+		r.Get("/organizations/current", orgHandler.GetCurrentOrganization)
+		r.With(middleware.RequirePermission(domain.PermSettingsManage)).Put("/organizations/current", orgHandler.UpdateCurrentOrganization)
+		r.With(middleware.RequirePermission(domain.PermSettingsManage)).Delete("/organizations/current", orgHandler.DeleteCurrentOrganization)
+		r.With(middleware.RequirePermission(domain.PermUsersManage)).Post("/organizations/current/members", orgHandler.AddMember)
+		r.With(middleware.RequirePermission(domain.PermUsersManage)).Delete("/organizations/current/members/{id}", orgHandler.RemoveMember)
+	})
+
+	// send makes a request and returns the status, the data and the error
+	// code of the response
+	send := func(method, path string, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		var raw []byte
+		if body != nil {
+			if raw, err = json.Marshal(body); err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data  json.RawMessage `json:"data"`
+			Error interface{}     `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		data := map[string]interface{}{}
+		if len(response.Data) > 0 && response.Data[0] == '{' {
+			json.Unmarshal(response.Data, &data)
+		}
+		if len(response.Data) > 0 && response.Data[0] == '[' {
+			var list []interface{}
+			json.Unmarshal(response.Data, &list)
+			data["list"] = list
+		}
+		code := ""
+		if errorObj, ok := response.Error.(map[string]interface{}); ok {
+			code, _ = errorObj["code"].(string)
+		}
+		return w.Code, data, code
+	}
+	login := func(email string) map[string]interface{} {
+		t.Helper()
+		status, data, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: email, Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s: expected 200, got %d %s", email, status, code)
+		}
+		return data
+	}
+	switchTo := func(refreshToken string, org string) (int, map[string]interface{}, string) {
+		t.Helper()
+		return send(http.MethodPost, "/auth/switch-organization",
+			handlers.SwitchOrganizationRequest{RefreshToken: refreshToken, OrganizationID: org}, "")
+	}
+	session := login(admin.Email)
+
+	// Opening an outlet makes the admin its admin; the session stays put
+	status, outlet, code := send(http.MethodPost, "/organizations", domain.CreateOrganizationRequest{Name: "Koramangala Outlet"}, session["token"].(string))
+	if status != http.StatusCreated || outlet["slug"] != "koramangala-outlet" || outlet["role"] != string(domain.RoleAdmin) {
+		t.Fatalf("expected the outlet with a slug from its name, got %d %s %v", status, code, outlet)
+	}
+	if settings := outlet["settings"].(map[string]interface{}); settings["currency"] != "INR" || settings["timezone"] != "UTC" || settings["costingMethod"] != string(domain.CostingFIFO) {
+		t.Errorf("expected default settings, got %v", settings)
+	}
+	outletID := outlet["id"].(string)
+	if status, _, code := send(http.MethodPost, "/organizations", domain.CreateOrganizationRequest{Name: "Another", Slug: "koramangala-outlet"}, session["token"].(string)); status != http.StatusConflict || code != "SLUG_EXISTS" {
+		t.Errorf("expected a taken slug to be refused, got %d %s", status, code)
+	}
+	if _, orgs, _ := send(http.MethodGet, "/organizations", nil, session["token"].(string)); len(orgs["list"].([]interface{})) != 2 {
+		t.Errorf("expected the admin in 2 organizations, got %v", orgs["list"])
+	}
+	if _, current, _ := send(http.MethodGet, "/organizations/current", nil, session["token"].(string)); current["id"] != orgID.String() {
+		t.Errorf("expected the session still in the home organization, got %v", current)
+	}
+
+	// Switching exchanges the refresh token for a session in the outlet
+	if status, _, code := switchTo(session["refreshToken"].(string), otherOrgID.String()); status != http.StatusForbidden || code != "NOT_A_MEMBER" {
+		t.Errorf("expected a foreign organization to be refused, got %d %s", status, code)
+	}
+	status, session, code = switchTo(session["refreshToken"].(string), outletID)
+	if status != http.StatusOK {
+		t.Fatalf("expected the switch to succeed after a refused one, got %d %s", status, code)
+	}
+	if user := session["user"].(map[string]interface{}); user["organizationId"] != outletID || user["role"] != string(domain.RoleAdmin) {
+		t.Errorf("expected the admin as admin of the outlet, got %v", user)
+	}
+	if _, profile, _ := send(http.MethodGet, "/auth/profile", nil, session["token"].(string)); profile["organizationId"] != outletID {
+		t.Errorf("expected the profile in the outlet, got %v", profile)
+	}
+	status, refreshed, code := send(http.MethodPost, "/auth/refresh", handlers.RefreshRequest{RefreshToken: session["refreshToken"].(string)}, "")
+	if status != http.StatusOK {
+		t.Fatalf("expected the refresh to succeed, got %d %s", status, code)
+	}
+	session["token"], session["refreshToken"] = refreshed["token"], refreshed["refreshToken"]
+	if _, current, _ := send(http.MethodGet, "/organizations/current", nil, session["token"].(string)); current["id"] != outletID {
+		t.Errorf("expected a refresh to keep the session in the outlet, got %v", current)
+	}
+
+	// Settings are typed and validated
+	status, updated, code := send(http.MethodPut, "/organizations/current", map[string]interface{}{
+		"settings": map[string]string{"currency": "usd", "costingMethod": string(domain.CostingWeightedAverage)},
+	}, session["token"].(string))
+	if status != http.StatusOK {
+		t.Fatalf("expected the settings to change, got %d %s", status, code)
+	}
+	if settings := updated["settings"].(map[string]interface{}); settings["currency"] != "USD" || settings["timezone"] != "UTC" || settings["costingMethod"] != string(domain.CostingWeightedAverage) {
+		t.Errorf("expected the currency upper-cased and the timezone kept, got %v", settings)
+	}
+	if status, _, code := send(http.MethodPut, "/organizations/current", map[string]interface{}{
+		"settings": map[string]string{"timezone": "Mars/Olympus"},
+	}, session["token"].(string)); status != http.StatusBadRequest || code != "VALIDATION_FAILED" {
+		t.Errorf("expected an unknown timezone to be refused, got %d %s", status, code)
+	}
+
+	// The cook, signed in at home, is invited to the outlet as a manager,
+	// which reads the same as inviting an email without an account
+	cookHome := login(cook.Email)
+	status, invited, code := send(http.MethodPost, "/organizations/current/members", domain.AddMemberRequest{Email: "Cook@Example.com", Role: domain.RoleManager}, session["token"].(string))
+	if status != http.StatusAccepted || invited["organizationId"] != outletID || invited["email"] != cook.Email ||
+		invited["role"] != string(domain.RoleManager) || invited["status"] != string(domain.InvitationPending) {
+		t.Fatalf("expected the cook invited as a manager, got %d %s %v", status, code, invited)
+	}
+	status, unknown, code := send(http.MethodPost, "/organizations/current/members", domain.AddMemberRequest{Email: "nobody@example.com", Role: domain.RoleManager}, session["token"].(string))
+	if status != http.StatusAccepted || len(unknown) != len(invited) || unknown["status"] != invited["status"] || unknown["token"] != nil {
+		t.Fatalf("expected an unknown email to be invited alike, got %d %s %v", status, code, unknown)
+	}
+	if m, err := orgRepo.GetMember(ctx, uuid.MustParse(outletID), cook.ID); err != nil || m != nil {
+		t.Fatalf("expected the cook not to join before signing in, got %+v (%v)", m, err)
+	}
+
+	// The cook joins when their session refreshes and works there as a
+	// manager
+	if status, _, code := send(http.MethodPost, "/auth/refresh", handlers.RefreshRequest{RefreshToken: cookHome["refreshToken"].(string)}, ""); status != http.StatusOK {
+		t.Fatalf("expected the cook's session to refresh, got %d %s", status, code)
+	}
+	if m, err := orgRepo.GetMember(ctx, uuid.MustParse(outletID), cook.ID); err != nil || m == nil || m.Role != domain.RoleManager {
+		t.Fatalf("expected the cook to join the outlet as a manager, got %+v (%v)", m, err)
+	}
+	cookSession := login(cook.Email)
+	if user := cookSession["user"].(map[string]interface{}); user["organizationId"] != orgID.String() || user["role"] != string(domain.RoleUser) {
+		t.Errorf("expected the cook to sign in at home, got %v", user)
+	}
+	if status, _, code := send(http.MethodPost, "/organizations/current/members", domain.AddMemberRequest{Email: "cook@example.com"}, session["token"].(string)); status != http.StatusConflict || code != "ALREADY_MEMBER" {
+		t.Errorf("expected adding the cook twice to be refused, got %d %s", status, code)
+	}
+	status, cookSession, code = switchTo(cookSession["refreshToken"].(string), outletID)
+	if status != http.StatusOK || cookSession["user"].(map[string]interface{})["role"] != string(domain.RoleManager) {
+		t.Fatalf("expected the cook to switch to the outlet as a manager, got %d %s %v", status, code, cookSession)
+	}
+	if status, _, code := send(http.MethodPut, "/organizations/current", map[string]string{"name": "Taken Over"}, cookSession["token"].(string)); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Errorf("expected a manager not to change the outlet, got %d %s", status, code)
+	}
+
+	// The outlet is closed once the admin is its last member
+	if status, _, code := send(http.MethodDelete, "/organizations/current", nil, session["token"].(string)); status != http.StatusConflict || code != "ORGANIZATION_HAS_MEMBERS" {
+		t.Errorf("expected the outlet kept while the cook belongs to it, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodDelete, "/organizations/current/members/"+admin.ID.String(), nil, session["token"].(string)); status != http.StatusConflict || code != "CANNOT_REMOVE_SELF" {
+		t.Errorf("expected the admin not to remove themselves, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodDelete, "/organizations/current/members/"+cook.ID.String(), nil, session["token"].(string)); status != http.StatusOK {
+		t.Fatalf("expected the cook removed, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPost, "/auth/refresh", handlers.RefreshRequest{RefreshToken: cookSession["refreshToken"].(string)}, ""); status != http.StatusForbidden || code != "USER_INACTIVE" {
+		t.Errorf("expected the cook's session in the outlet to end, got %d %s", status, code)
+	}
+	status, session, code = send(http.MethodDelete, "/organizations/current", nil, session["token"].(string))
+	if status != http.StatusOK || session["user"].(map[string]interface{})["organizationId"] != orgID.String() {
+		t.Fatalf("expected the outlet deleted and a session at home, got %d %s %v", status, code, session)
+	}
+	if _, orgs, _ := send(http.MethodGet, "/organizations", nil, session["token"].(string)); len(orgs["list"].([]interface{})) != 1 {
+		t.Errorf("expected the admin in 1 organization, got %v", orgs["list"])
+	}
+	if status, _, code := send(http.MethodDelete, "/organizations/current", nil, session["token"].(string)); status != http.StatusConflict || code != "ORGANIZATION_HAS_MEMBERS" {
+		t.Errorf("expected the home organization kept while the cook belongs to it, got %d %s", status, code)
+	}
+	if got, err := orgRepo.GetByID(ctx, uuid.MustParse(outletID)); err != nil || got != nil {
+		t.Errorf("expected the outlet gone, got %+v (%v)", got, err)
+	}
+}
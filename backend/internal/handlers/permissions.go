@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// PermissionHandler serves the organization's permission matrix and the
+// caller's own permissions
+type PermissionHandler struct {
+	permissionService *services.PermissionService
+	log               *logger.Logger
+}
+
+func NewPermissionHandler(permissionService *services.PermissionService, log *logger.Logger) *PermissionHandler {
+	return &PermissionHandler{
+		permissionService: permissionService,
+		log:               log,
+	}
+}
+
+// GetMyPermissions returns what the caller's role may do in their
+// organization, so clients can hide what they can't use
+func (h *PermissionHandler) GetMyPermissions(w http.ResponseWriter, r *http.Request) {
+	perms := getPermissionsFromContext(r.Context())
+	utils.RespondSuccess(w, http.StatusOK, &domain.RolePermissions{
+		Role:        getRoleFromContext(r.Context()),
+		Permissions: perms.List(),
+	})
+}
+
+// GetPermissions returns the permissions of every role of the organization
+func (h *PermissionHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	matrix, err := h.permissionService.Matrix(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to fetch permissions", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, matrix)
+}
+
+// UpdateRolePermissions sets every permission the role in the URL holds in
+// the organization
+func (h *PermissionHandler) UpdateRolePermissions(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.UpdateRolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	role := domain.UserRole(chi.URLParam(r, "role"))
+	updated, err := h.permissionService.UpdateRole(r.Context(), orgUUID, role, req.Permissions)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidRole, services.ErrUnknownPermission:
+			utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+		case services.ErrAdminPermissionsFixed, services.ErrPermissionAdminOnly:
+			utils.RespondError(w, http.StatusConflict, "PERMISSION_FIXED", err.Error(), nil)
+		default:
+			h.log.Error("Failed to update permissions", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, updated)
+}
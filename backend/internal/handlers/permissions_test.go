@@ -0,0 +1,282 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/handlers"
+	"hasufel.kj/internal/middleware"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+func TestPermissionHandler_OverridesApplyPerOrganization(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, otherOrgID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	for _, u := range []*domain.User{
+		{OrganizationID: orgID, Email: "admin@example.com", Role: domain.RoleAdmin},
+		{OrganizationID: orgID, Email: "manager@example.com", Role: domain.RoleManager},
+		{OrganizationID: orgID, Email: "cook@example.com", Role: domain.RoleUser},
+		{OrganizationID: otherOrgID, Email: "other-cook@example.com", Role: domain.RoleUser},
+	} {
+		u.PasswordHash, u.FirstName, u.LastName, u.IsActive = string(hash), "Test", "User", true
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	authService := setupAuthService(db)
+	permissionService := services.NewPermissionService(repository.NewPermissionRepository(db, database.DialectSQLite), db)
+	authHandler := handlers.NewAuthHandler(authService, logger.New("error"))
+	permissionHandler := handlers.NewPermissionHandler(permissionService, logger.New("error"))
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.Use(middleware.LoadPermissions(permissionService))
+		r.Get("/auth/permissions", permissionHandler.GetMyPermissions)
+		r.With(middleware.RequirePermission(domain.PermSettingsManage)).Get("/settings/permissions", permissionHandler.GetPermissions)
+		r.With(middleware.RequirePermission(domain.PermSettingsManage)).Put("/settings/permissions/{role}", permissionHandler.UpdateRolePermissions)
+		r.With(middleware.RequirePermission(domain.PermItemsWrite)).Post("/items", func(w http.ResponseWriter, r *http.Request) {
+			utils.RespondSuccess(w, http.StatusCreated, nil)
+		})
+	})
+
+	// send makes a request and returns the status, the data and the error
+	// code of the response
+	send := func(method, path string, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		var raw []byte
+		if body != nil {
+			if raw, err = json.Marshal(body); err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data  map[string]interface{} `json:"data"`
+			Error *utils.ErrorDetail     `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		code := ""
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		return w.Code, response.Data, code
+	}
+	login := func(email string) string {
+		t.Helper()
+		status, data, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: email, Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s: expected 200, got %d %s", email, status, code)
+		}
+		return data["token"].(string)
+	}
+	has := func(data map[string]interface{}, permission domain.Permission) bool {
+		for _, p := range data["permissions"].([]interface{}) {
+			if p == string(permission) {
+				return true
+			}
+		}
+		return false
+	}
+	adminToken, managerToken := login("admin@example.com"), login("manager@example.com")
+	cookToken, otherCookToken := login("cook@example.com"), login("other-cook@example.com")
+
+	// Users start with the defaults of their role
+	if _, mine, _ := send(http.MethodGet, "/auth/permissions", nil, cookToken); has(mine, domain.PermCostsView) || !has(mine, domain.PermMovementsAdjust) {
+		t.Errorf("expected the default permissions of a user, got %v", mine)
+	}
+	if status, _, code := send(http.MethodPost, "/items", nil, cookToken); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Errorf("expected a user not to write items, got %d %s", status, code)
+	}
+	if status, _, _ := send(http.MethodPost, "/items", nil, managerToken); status != http.StatusCreated {
+		t.Errorf("expected a manager to write items, got %d", status)
+	}
+	if status, _, code := send(http.MethodGet, "/settings/permissions", nil, managerToken); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Errorf("expected a manager not to see the permission matrix, got %d %s", status, code)
+	}
+
+	// The organization lets its users write items and see costs, but not
+	// adjust stock
+	status, updated, code := send(http.MethodPut, "/settings/permissions/USER", domain.UpdateRolePermissionsRequest{Permissions: []domain.Permission{
+		domain.PermMovementsCreate, domain.PermMovementsReverse, domain.PermSalesRecord, domain.PermStockCountsCount,
+		domain.PermItemsWrite, domain.PermCostsView,
+	}}, adminToken)
+	if status != http.StatusOK || len(updated["overridden"].([]interface{})) != 3 {
+		t.Fatalf("expected 3 overrides of the user defaults, got %d %s %v", status, code, updated)
+	}
+	if _, mine, _ := send(http.MethodGet, "/auth/permissions", nil, cookToken); !has(mine, domain.PermCostsView) || has(mine, domain.PermMovementsAdjust) {
+		t.Errorf("expected the overrides to apply at once, got %v", mine)
+	}
+	if status, _, _ := send(http.MethodPost, "/items", nil, cookToken); status != http.StatusCreated {
+		t.Errorf("expected a user granted items.write to write items, got %d", status)
+	}
+	if status, _, _ := send(http.MethodPost, "/items", nil, otherCookToken); status != http.StatusForbidden {
+		t.Errorf("expected the overrides not to reach another organization, got %d", status)
+	}
+
+	// Admins keep every permission, and the permissions that let their
+	// holder grant themselves anything stay with admins
+	if status, _, code := send(http.MethodPut, "/settings/permissions/ADMIN", domain.UpdateRolePermissionsRequest{}, adminToken); status != http.StatusConflict || code != "PERMISSION_FIXED" {
+		t.Errorf("expected admin permissions to be fixed, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPut, "/settings/permissions/MANAGER", domain.UpdateRolePermissionsRequest{Permissions: []domain.Permission{domain.PermUsersManage}}, adminToken); status != http.StatusConflict || code != "PERMISSION_FIXED" {
+		t.Errorf("expected users.manage to stay with admins, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPut, "/settings/permissions/USER", domain.UpdateRolePermissionsRequest{Permissions: []domain.Permission{"items.fly"}}, adminToken); status != http.StatusBadRequest || code != "VALIDATION_FAILED" {
+		t.Errorf("expected an unknown permission to be rejected, got %d %s", status, code)
+	}
+
+	status, matrix, _ := send(http.MethodGet, "/settings/permissions", nil, adminToken)
+	if status != http.StatusOK || len(matrix["roles"].([]interface{})) != len(domain.Roles) || len(matrix["permissions"].([]interface{})) != len(domain.Permissions) {
+		t.Errorf("expected every role and permission in the matrix, got %d %v", status, matrix)
+	}
+}
+
+// costlyDashboard answers every dashboard query with stock that has a value
+type costlyDashboard struct {
+	item *domain.Item
+}
+
+func (d costlyDashboard) GetMetrics(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID) (*services.DashboardMetrics, error) {
+	return &services.DashboardMetrics{TotalItems: 1, TotalValue: 1250}, nil
+}
+
+func (d costlyDashboard) GetRecentMovements(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.StockMovement, error) {
+	item := *d.item
+	totalCost := 25.0
+	return []*domain.StockMovement{{ID: uuid.New(), ItemID: item.ID, Item: &item, Quantity: 10, TotalCost: &totalCost}}, nil
+}
+
+func (d costlyDashboard) GetStockTrends(ctx context.Context, orgID uuid.UUID, days int) ([]services.StockTrend, error) {
+	return nil, nil
+}
+
+func (d costlyDashboard) GetCategoryBreakdown(ctx context.Context, orgID uuid.UUID) ([]services.CategoryBreakdown, error) {
+	return []services.CategoryBreakdown{{CategoryID: uuid.New(), CategoryName: "Dairy", ItemCount: 1, TotalValue: 1250}}, nil
+}
+
+func (d costlyDashboard) GetLowStockItems(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID, limit int) ([]*domain.Item, error) {
+	item := *d.item
+	return []*domain.Item{&item}, nil
+}
+
+func (d costlyDashboard) GetLocationBreakdown(ctx context.Context, orgID uuid.UUID) ([]services.LocationBreakdown, error) {
+	return []services.LocationBreakdown{{LocationID: uuid.New(), LocationName: "Cooler", ItemCount: 1, TotalValue: 1250}}, nil
+}
+
+func (d costlyDashboard) GetExpiringLots(ctx context.Context, orgID uuid.UUID, days int, locationID *uuid.UUID) ([]services.ExpiringLot, error) {
+	return nil, nil
+}
+
+func (d costlyDashboard) GetAlerts(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error) {
+	return nil, nil
+}
+
+func (d costlyDashboard) MarkAlertAsRead(ctx context.Context, alertID uuid.UUID) error {
+	return nil
+}
+
+func TestDashboardHandler_ValuesNeedCostsView(t *testing.T) {
+	unitCost := 2.5
+	handler := handlers.NewDashboardHandler(costlyDashboard{item: &domain.Item{ID: uuid.New(), Name: "Milk", UnitCost: &unitCost}}, logger.New("error"))
+
+	// get calls a dashboard route as a caller with the given permissions and
+	// returns the data of the response
+	get := func(route http.HandlerFunc, perms domain.PermissionSet) interface{} {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+		ctx := context.WithValue(req.Context(), "organization_id", uuid.New().String())
+		ctx = context.WithValue(ctx, "role", string(domain.RoleUser))
+		ctx = context.WithValue(ctx, "permissions", perms)
+		w := httptest.NewRecorder()
+		route(w, req.WithContext(ctx))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var response struct {
+			Data interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return response.Data
+	}
+	first := func(data interface{}) map[string]interface{} {
+		t.Helper()
+		list, ok := data.([]interface{})
+		if !ok || len(list) == 0 {
+			t.Fatalf("expected a list, got %v", data)
+		}
+		return list[0].(map[string]interface{})
+	}
+
+	for _, tc := range []struct {
+		name      string
+		perms     domain.PermissionSet
+		seesCosts bool
+	}{
+		{"without costs.view", domain.DefaultPermissions(domain.RoleUser), false},
+		{"with costs.view", domain.PermissionSet{domain.PermCostsView: true}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if metrics := get(handler.GetMetrics, tc.perms).(map[string]interface{}); (metrics["totalValue"] != 0.0) != tc.seesCosts {
+				t.Errorf("expected the total value only with costs.view, got %v", metrics["totalValue"])
+			}
+			if category := first(get(handler.GetCategoryBreakdown, tc.perms)); (category["total_value"] != 0.0) != tc.seesCosts {
+				t.Errorf("expected category values only with costs.view, got %v", category["total_value"])
+			}
+			if location := first(get(handler.GetLocationBreakdown, tc.perms)); (location["totalValue"] != 0.0) != tc.seesCosts {
+				t.Errorf("expected location values only with costs.view, got %v", location["totalValue"])
+			}
+			if item := first(get(handler.GetLowStockItems, tc.perms)); (item["unitCost"] != nil) != tc.seesCosts {
+				t.Errorf("expected low stock unit costs only with costs.view, got %v", item["unitCost"])
+			}
+			movement := first(get(handler.GetRecentMovements, tc.perms))
+			if (movement["totalCost"] != nil) != tc.seesCosts {
+				t.Errorf("expected movement costs only with costs.view, got %v", movement["totalCost"])
+			}
+			if item := movement["item"].(map[string]interface{}); (item["unitCost"] != nil) != tc.seesCosts {
+				t.Errorf("expected the unit cost of the moved item only with costs.view, got %v", item["unitCost"])
+			}
+		})
+	}
+}
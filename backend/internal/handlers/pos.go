@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// maxSalesFileSize caps the size of an uploaded POS sales file
+const maxSalesFileSize = 10 << 20
+
+type POSHandler struct {
+	posService *services.POSImportService
+	log        *logger.Logger
+}
+
+func NewPOSHandler(posService *services.POSImportService, log *logger.Logger) *POSHandler {
+	return &POSHandler{
+		posService: posService,
+		log:        log,
+	}
+}
+
+func (h *POSHandler) GetMappings(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	mappings, err := h.posService.ListMappings(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list POS mappings", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if mappings == nil {
+		mappings = []*domain.POSMapping{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, mappings)
+}
+
+// SetMapping maps the dish code in the URL to a recipe
+func (h *POSHandler) SetMapping(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.SetPOSMappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	mapping, err := h.posService.SetMapping(r.Context(), orgUUID, chi.URLParam(r, "code"), &req)
+	if err != nil {
+		switch {
+		case err == services.ErrInvalidPOSCode:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_POS_CODE", "Dish code is required", nil)
+		case err == services.ErrInvalidPortions:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_PORTIONS", "Portions must be positive", nil)
+		case err == services.ErrRecipeNotFound:
+			utils.RespondError(w, http.StatusNotFound, "RECIPE_NOT_FOUND", "Recipe not found", nil)
+		default:
+			h.log.Error("Failed to set POS mapping", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, mapping)
+}
+
+func (h *POSHandler) DeleteMapping(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	if err := h.posService.DeleteMapping(r.Context(), orgUUID, chi.URLParam(r, "code")); err != nil {
+		if err == services.ErrPOSMappingNotFound {
+			utils.RespondError(w, http.StatusNotFound, "POS_MAPPING_NOT_FOUND", "POS mapping not found", nil)
+			return
+		}
+		h.log.Error("Failed to delete POS mapping", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "POS mapping deleted successfully"})
+}
+
+// ImportSales imports a POS sales file sent either as the "file" field of a
+// multipart form or as the raw CSV body
+func (h *POSHandler) ImportSales(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	locationID, ok := parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+	req := &domain.POSImportRequest{
+		DryRun:       r.URL.Query().Get("dryRun") == "true",
+		SkipUnmapped: r.URL.Query().Get("skipUnmapped") == "true",
+		LocationID:   locationID,
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSalesFileSize)
+	var file io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		part, _, err := r.FormFile("file")
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Multipart body needs a file field", nil)
+			return
+		}
+		defer part.Close()
+		file = part
+	}
+
+	result, err := h.posService.Import(r.Context(), orgUUID, userUUID, file, req)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			utils.RespondError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", "Sales file must be at most 10 MB", nil)
+		case err == services.ErrInvalidSalesFile:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_SALES_FILE", err.Error(), nil)
+		case err == services.ErrEmptySalesFile:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_SALES_FILE", err.Error(), nil)
+		case err == services.ErrUnmappedCodes:
+			utils.RespondError(w, http.StatusUnprocessableEntity, "UNMAPPED_CODES", "Sales file has dish codes without a mapping; map them or import with skipUnmapped=true", result)
+		case err == services.ErrImportRejected:
+			utils.RespondError(w, http.StatusBadRequest, "IMPORT_REJECTED", "One or more rows or bills cannot be imported", result)
+		case errors.Is(err, services.ErrItemConflict):
+			utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "An item was modified by another request", nil)
+		default:
+			h.log.Error("Failed to import POS sales", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if result.DryRun {
+		status = http.StatusOK
+	}
+	result.Movements = sanitizeMovementsForPermissions(result.Movements, getPermissionsFromContext(r.Context()))
+	utils.RespondSuccess(w, status, result)
+}
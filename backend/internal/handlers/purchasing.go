@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// PurchasingHandler serves suppliers and purchase orders. Orders carry
+// prices, so everything but the supplier list needs purchasing.manage.
+type PurchasingHandler struct {
+	purchasingService *services.PurchasingService
+	log               *logger.Logger
+}
+
+func NewPurchasingHandler(purchasingService *services.PurchasingService, log *logger.Logger) *PurchasingHandler {
+	return &PurchasingHandler{
+		purchasingService: purchasingService,
+		log:               log,
+	}
+}
+
+// Supplier handlers
+
+func (h *PurchasingHandler) GetSuppliers(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	suppliers, err := h.purchasingService.ListSuppliers(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list suppliers", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if suppliers == nil {
+		suppliers = []*domain.Supplier{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, suppliers)
+}
+
+func (h *PurchasingHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CreateSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	supplier, err := h.purchasingService.CreateSupplier(r.Context(), orgUUID, &req)
+	if err != nil {
+		h.respondPurchasingError(w, err, "Failed to create supplier")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, supplier)
+}
+
+func (h *PurchasingHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	supplier, ok := h.orgSupplier(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateSupplierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.purchasingService.UpdateSupplier(r.Context(), supplier, &req); err != nil {
+		h.respondPurchasingError(w, err, "Failed to update supplier")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, supplier)
+}
+
+func (h *PurchasingHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	supplier, ok := h.orgSupplier(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchasingService.DeleteSupplier(r.Context(), supplier.ID); err != nil {
+		h.respondPurchasingError(w, err, "Failed to delete supplier")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Supplier deleted successfully"})
+}
+
+// Purchase order handlers
+
+// GetPurchaseOrders lists the organization's purchase orders, optionally
+// only those with the status given in the status query parameter
+func (h *PurchasingHandler) GetPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var status *domain.PurchaseOrderStatus
+	if s := r.URL.Query().Get("status"); s != "" {
+		parsed := domain.PurchaseOrderStatus(s)
+		switch parsed {
+		case domain.PurchaseOrderDraft, domain.PurchaseOrderSent,
+			domain.PurchaseOrderPartiallyReceived, domain.PurchaseOrderReceived:
+			status = &parsed
+		default:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_STATUS", "Status must be DRAFT, SENT, PARTIALLY_RECEIVED or RECEIVED", nil)
+			return
+		}
+	}
+
+	orders, err := h.purchasingService.ListPurchaseOrders(r.Context(), orgUUID, status)
+	if err != nil {
+		h.log.Error("Failed to list purchase orders", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if orders == nil {
+		orders = []*domain.PurchaseOrder{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, orders)
+}
+
+func (h *PurchasingHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, po)
+}
+
+func (h *PurchasingHandler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	var req domain.CreatePurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	po, err := h.purchasingService.CreatePurchaseOrder(r.Context(), orgUUID, userUUID, &req)
+	if err != nil {
+		h.respondPurchasingError(w, err, "Failed to create purchase order")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, po)
+}
+
+func (h *PurchasingHandler) UpdatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdatePurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	updated, err := h.purchasingService.UpdatePurchaseOrder(r.Context(), po, &req)
+	if err != nil {
+		h.respondPurchasingError(w, err, "Failed to update purchase order")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, updated)
+}
+
+func (h *PurchasingHandler) DeletePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchasingService.DeletePurchaseOrder(r.Context(), po); err != nil {
+		h.respondPurchasingError(w, err, "Failed to delete purchase order")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Purchase order deleted successfully"})
+}
+
+// SendPurchaseOrder marks a draft order as sent to the supplier
+func (h *PurchasingHandler) SendPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchasingService.SendPurchaseOrder(r.Context(), po); err != nil {
+		h.respondPurchasingError(w, err, "Failed to send purchase order")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, po)
+}
+
+// ClosePurchaseOrder marks an order as received although lines are still
+// short
+func (h *PurchasingHandler) ClosePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchasingService.ClosePurchaseOrder(r.Context(), po); err != nil {
+		h.respondPurchasingError(w, err, "Failed to close purchase order")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, po)
+}
+
+func (h *PurchasingHandler) GetReceipts(w http.ResponseWriter, r *http.Request) {
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	receipts, err := h.purchasingService.ListReceipts(r.Context(), po.ID)
+	if err != nil {
+		h.log.Error("Failed to list goods receipts", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if receipts == nil {
+		receipts = []*domain.GoodsReceipt{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, receipts)
+}
+
+// ReceivePurchaseOrder posts a delivery against the order, one IN movement
+// per line received
+func (h *PurchasingHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	po, ok := h.orgPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.ReceivePurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	result, err := h.purchasingService.ReceivePurchaseOrder(r.Context(), po.OrganizationID, po.ID, userUUID, &req)
+	if err != nil {
+		h.respondPurchasingError(w, err, "Failed to receive purchase order")
+		return
+	}
+
+	perms := getPermissionsFromContext(r.Context())
+	result.Movements = sanitizeMovementsForPermissions(result.Movements, perms)
+	utils.RespondSuccess(w, http.StatusCreated, result)
+}
+
+// respondPurchasingError maps errors from the purchasing service to API
+// errors, logging anything unexpected as logMessage
+func (h *PurchasingHandler) respondPurchasingError(w http.ResponseWriter, err error, logMessage string) {
+	var poErr *services.PurchaseOrderError
+	if errors.As(err, &poErr) {
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more purchase order fields are invalid", poErr.Lines)
+		return
+	}
+
+	switch {
+	case err == services.ErrSupplierNotFound:
+		utils.RespondError(w, http.StatusNotFound, "SUPPLIER_NOT_FOUND", "Supplier not found", nil)
+	case err == services.ErrSupplierNameTaken:
+		utils.RespondError(w, http.StatusConflict, "SUPPLIER_NAME_TAKEN", "A supplier with this name already exists", nil)
+	case err == services.ErrSupplierInUse:
+		utils.RespondError(w, http.StatusConflict, "SUPPLIER_IN_USE", "Purchase orders were placed with this supplier; deactivate it instead", nil)
+	case err == services.ErrInvalidSupplierName,
+		err == services.ErrInvalidLeadTime,
+		err == services.ErrNoOrderLines,
+		err == services.ErrNoReceiptLines:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	case err == services.ErrPurchaseOrderNotFound:
+		utils.RespondError(w, http.StatusNotFound, "PURCHASE_ORDER_NOT_FOUND", "Purchase order not found", nil)
+	case err == services.ErrPurchaseOrderNotDraft, err == services.ErrPurchaseOrderNotOpen:
+		utils.RespondError(w, http.StatusConflict, "INVALID_PURCHASE_ORDER_STATUS", err.Error(), nil)
+	case errors.Is(err, services.ErrItemConflict):
+		utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "An item was modified by another request", nil)
+	default:
+		h.log.Error(logMessage, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// orgSupplier loads the supplier named by the id URL parameter and checks it
+// belongs to the caller's organization, writing the error response if not
+func (h *PurchasingHandler) orgSupplier(w http.ResponseWriter, r *http.Request) (*domain.Supplier, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	supplierID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_SUPPLIER_ID", "Invalid supplier ID", nil)
+		return nil, false
+	}
+
+	supplier, err := h.purchasingService.GetSupplier(r.Context(), supplierID)
+	if err != nil {
+		if err == services.ErrSupplierNotFound {
+			utils.RespondError(w, http.StatusNotFound, "SUPPLIER_NOT_FOUND", "Supplier not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch supplier", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if supplier.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "SUPPLIER_NOT_FOUND", "Supplier not found", nil)
+		return nil, false
+	}
+
+	return supplier, true
+}
+
+// orgPurchaseOrder loads the purchase order named by the id URL parameter
+// and checks it belongs to the caller's organization, writing the error
+// response if not
+func (h *PurchasingHandler) orgPurchaseOrder(w http.ResponseWriter, r *http.Request) (*domain.PurchaseOrder, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	poID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_PURCHASE_ORDER_ID", "Invalid purchase order ID", nil)
+		return nil, false
+	}
+
+	po, err := h.purchasingService.GetPurchaseOrder(r.Context(), poID)
+	if err != nil {
+		if err == services.ErrPurchaseOrderNotFound {
+			utils.RespondError(w, http.StatusNotFound, "PURCHASE_ORDER_NOT_FOUND", "Purchase order not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch purchase order", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if po.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "PURCHASE_ORDER_NOT_FOUND", "Purchase order not found", nil)
+		return nil, false
+	}
+
+	return po, true
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+type RecipeHandler struct {
+	recipeService *services.RecipeService
+	log           *logger.Logger
+}
+
+func NewRecipeHandler(recipeService *services.RecipeService, log *logger.Logger) *RecipeHandler {
+	return &RecipeHandler{
+		recipeService: recipeService,
+		log:           log,
+	}
+}
+
+func (h *RecipeHandler) GetRecipes(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	recipes, err := h.recipeService.ListRecipes(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list recipes", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, recipes)
+}
+
+func (h *RecipeHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := h.orgRecipe(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, recipe)
+}
+
+func (h *RecipeHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CreateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	recipe, err := h.recipeService.CreateRecipe(r.Context(), orgUUID, &req)
+	if err != nil {
+		h.respondRecipeError(w, err, "Failed to create recipe")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, recipe)
+}
+
+func (h *RecipeHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := h.orgRecipe(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	updated, err := h.recipeService.UpdateRecipe(r.Context(), recipe, &req)
+	if err != nil {
+		h.respondRecipeError(w, err, "Failed to update recipe")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, updated)
+}
+
+func (h *RecipeHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := h.orgRecipe(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.recipeService.DeleteRecipe(r.Context(), recipe.ID); err != nil {
+		h.respondRecipeError(w, err, "Failed to delete recipe")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Recipe deleted successfully"})
+}
+
+// RecordSale depletes the ingredients of portions of a recipe sold, posting
+// one OUT movement per ingredient
+func (h *RecipeHandler) RecordSale(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	recipe, ok := h.orgRecipe(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.RecordRecipeSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	sales := []domain.RecipeSale{{RecipeID: recipe.ID, Portions: req.Portions}}
+	movements, err := h.recipeService.RecordSales(r.Context(), recipe.OrganizationID, sales, req.LocationID, userUUID, req.Reference, req.Notes, nil)
+	if err != nil {
+		h.respondRecipeError(w, err, "Failed to record recipe sale")
+		return
+	}
+	if movements == nil {
+		movements = []*domain.StockMovement{}
+	}
+
+	perms := getPermissionsFromContext(r.Context())
+	utils.RespondSuccess(w, http.StatusCreated, sanitizeMovementsForPermissions(movements, perms))
+}
+
+// respondRecipeError maps errors from the recipe service to API errors
+func (h *RecipeHandler) respondRecipeError(w http.ResponseWriter, err error, logMessage string) {
+	var recipeErr *services.RecipeError
+	if errors.As(err, &recipeErr) {
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more recipe fields are invalid", recipeErr.Lines)
+		return
+	}
+	var bulkErr *services.BulkAdjustError
+	if errors.As(err, &bulkErr) {
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more ingredients cannot be depleted", bulkErr.Lines)
+		return
+	}
+
+	switch {
+	case err == services.ErrRecipeNotFound:
+		utils.RespondError(w, http.StatusNotFound, "RECIPE_NOT_FOUND", "Recipe not found", nil)
+	case err == services.ErrRecipeNameTaken:
+		utils.RespondError(w, http.StatusConflict, "RECIPE_NAME_TAKEN", "A recipe with this name already exists", nil)
+	case err == services.ErrRecipeInUse:
+		utils.RespondError(w, http.StatusConflict, "RECIPE_IN_USE", "Recipe is used as a sub-recipe; remove it from those recipes or deactivate it instead", nil)
+	case err == services.ErrRecipeInactive:
+		utils.RespondError(w, http.StatusBadRequest, "RECIPE_INACTIVE", "Recipe is inactive", nil)
+	case err == services.ErrInvalidPortions:
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_PORTIONS", err.Error(), nil)
+	case err == services.ErrRecipeCycle:
+		utils.RespondError(w, http.StatusConflict, "RECIPE_CYCLE", err.Error(), nil)
+	case errors.Is(err, services.ErrItemConflict):
+		utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "An item was modified by another request", nil)
+	default:
+		h.log.Error(logMessage, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// orgRecipe loads the recipe named by the id URL parameter and checks it
+// belongs to the caller's organization, writing the error response if not
+func (h *RecipeHandler) orgRecipe(w http.ResponseWriter, r *http.Request) (*domain.Recipe, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	recipeID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_RECIPE_ID", "Invalid recipe ID", nil)
+		return nil, false
+	}
+
+	recipe, err := h.recipeService.GetRecipe(r.Context(), recipeID)
+	if err != nil {
+		if err == services.ErrRecipeNotFound {
+			utils.RespondError(w, http.StatusNotFound, "RECIPE_NOT_FOUND", "Recipe not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch recipe", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if recipe.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "RECIPE_NOT_FOUND", "Recipe not found", nil)
+		return nil, false
+	}
+
+	return recipe, true
+}
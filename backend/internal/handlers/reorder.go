@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/units"
+	"hasufel.kj/pkg/utils"
+)
+
+// ReorderHandler serves the reorder settings of items and the suggested
+// order list. Costs on the suggestions are shown to those who can view
+// costs.
+type ReorderHandler struct {
+	reorderService   *services.ReorderService
+	inventoryService *services.InventoryService
+	velocityDays     int
+	log              *logger.Logger
+}
+
+// NewReorderHandler returns a handler that averages consumption over
+// velocityDays unless a request asks for another window
+func NewReorderHandler(reorderService *services.ReorderService, inventoryService *services.InventoryService, velocityDays int, log *logger.Logger) *ReorderHandler {
+	return &ReorderHandler{
+		reorderService:   reorderService,
+		inventoryService: inventoryService,
+		velocityDays:     velocityDays,
+		log:              log,
+	}
+}
+
+// GetSuggestions returns what to order, grouped by preferred supplier.
+// The days query parameter sets the velocity window and format=csv exports
+// the list as a CSV file with one row per item.
+func (h *ReorderHandler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	days := h.velocityDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_DAYS", services.ErrInvalidVelocityDays.Error(), nil)
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_FORMAT", "Format must be json or csv", nil)
+		return
+	}
+
+	list, err := h.reorderService.Suggestions(r.Context(), orgUUID, days)
+	if err != nil {
+		if err == services.ErrInvalidVelocityDays {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_DAYS", err.Error(), nil)
+			return
+		}
+		h.log.Error("Failed to compute reorder suggestions", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	sanitizeReorderListForPermissions(list, getPermissionsFromContext(r.Context()))
+	if format == "csv" {
+		h.writeSuggestionsCSV(w, list)
+		return
+	}
+	utils.RespondSuccess(w, http.StatusOK, list)
+}
+
+// writeSuggestionsCSV writes the order list as CSV, vendor by vendor
+func (h *ReorderHandler) writeSuggestionsCSV(w http.ResponseWriter, list *domain.ReorderList) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reorder-%s.csv"`, list.GeneratedAt.Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return number(*v)
+	}
+
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{
+		"vendor", "item", "sku", "unit", "current_stock", "on_order", "reorder_point",
+		"par_level", "daily_usage", "lead_time_days", "suggested_quantity", "unit_cost", "estimated_cost",
+	})
+	for _, group := range list.Groups {
+		vendor := ""
+		if group.SupplierName != nil {
+			vendor = *group.SupplierName
+		}
+		for _, line := range group.Lines {
+			sku := ""
+			if line.SKU != nil {
+				sku = *line.SKU
+			}
+			_ = out.Write([]string{
+				vendor, line.ItemName, sku, line.Unit,
+				number(line.CurrentStock), number(line.OnOrder), number(line.ReorderPoint),
+				optional(line.ParLevel), number(line.DailyUsage), strconv.Itoa(line.LeadTimeDays),
+				number(line.SuggestedQuantity), optional(line.UnitCost), optional(line.EstimatedCost),
+			})
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		h.log.Error("Failed to write reorder suggestions", err)
+	}
+}
+
+// UpdateSettings replaces the par level, lead time and preferred supplier
+// of an item
+func (h *ReorderHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	itemID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ITEM_ID", "Invalid item ID", nil)
+		return
+	}
+
+	var req domain.ReorderSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	item, err := h.reorderService.UpdateSettings(r.Context(), orgUUID, itemID, &req)
+	if err != nil {
+		switch {
+		case err == services.ErrItemNotFound:
+			utils.RespondError(w, http.StatusNotFound, "ITEM_NOT_FOUND", "Item not found", nil)
+		case err == services.ErrSupplierNotFound:
+			utils.RespondError(w, http.StatusNotFound, "SUPPLIER_NOT_FOUND", "Supplier not found", nil)
+		case err == services.ErrInvalidParLevel, err == services.ErrInvalidLeadTime:
+			utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+		case errors.Is(err, units.ErrInvalidUnit), errors.Is(err, units.ErrIncompatibleUnits):
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", err.Error(), nil)
+		case errors.Is(err, services.ErrItemConflict):
+			utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "Item was modified by another request", nil)
+		default:
+			h.log.Error("Failed to update reorder settings", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	registry, err := h.inventoryService.Units(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to load units", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	itemDisplay, err := item.ToDisplay(registry)
+	if err != nil {
+		h.log.Error("Failed to convert item to display", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	w.Header().Set("ETag", itemETag(item.Version))
+	utils.RespondSuccess(w, http.StatusOK, sanitizeItemDisplayForPermissions(itemDisplay, getPermissionsFromContext(r.Context())))
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// defaultReportDays is how many days, ending today, a report covers when the
+// request does not say
+const defaultReportDays = 30
+
+// ReportHandler serves reports over the movement ledger. Reports carry
+// costs, so they need costs.view as well as reports.view.
+type ReportHandler struct {
+	reportService *services.ReportService
+	log           *logger.Logger
+}
+
+func NewReportHandler(reportService *services.ReportService, log *logger.Logger) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+		log:           log,
+	}
+}
+
+// GetWastageReport totals what was lost to each movement reason by reason,
+// item and period. from and to are inclusive YYYY-MM-DD dates, the last 30
+// days by default; period is day, week or month; reason and itemId narrow
+// the report.
+func (h *ReportHandler) GetWastageReport(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := domain.WastageReportFilter{Period: domain.ReportPeriodDay}
+	filter.To = time.Now().UTC()
+	if raw := query.Get("to"); raw != "" {
+		if filter.To, err = time.Parse("2006-01-02", raw); err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_DATE", "to must be a date as YYYY-MM-DD", nil)
+			return
+		}
+	}
+	filter.From = filter.To.AddDate(0, 0, 1-defaultReportDays)
+	if raw := query.Get("from"); raw != "" {
+		if filter.From, err = time.Parse("2006-01-02", raw); err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_DATE", "from must be a date as YYYY-MM-DD", nil)
+			return
+		}
+	}
+	if raw := query.Get("period"); raw != "" {
+		filter.Period = domain.ReportPeriod(raw)
+	}
+	if raw := query.Get("reason"); raw != "" {
+		filter.ReasonCode = &raw
+	}
+	if raw := query.Get("itemId"); raw != "" {
+		itemID, err := uuid.Parse(raw)
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_ITEM_ID", "Invalid item ID", nil)
+			return
+		}
+		filter.ItemID = &itemID
+	}
+
+	report, err := h.reportService.Wastage(r.Context(), orgUUID, &filter)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidReportRange:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_DATE", err.Error(), nil)
+		case services.ErrInvalidReportPeriod:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_PERIOD", err.Error(), nil)
+		case services.ErrInvalidReason:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_REASON", err.Error(), nil)
+		default:
+			h.log.Error("Failed to build wastage report", err)
+			utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, report)
+}
+
+// GetValuationReport values the stock as of asOf at the organization's cost
+// layers: the end of a YYYY-MM-DD date, today by default, or an RFC 3339
+// time
+func (h *ReportHandler) GetValuationReport(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var report *domain.ValuationReport
+	raw := r.URL.Query().Get("asOf")
+	if raw == "" {
+		report, err = h.reportService.Valuation(r.Context(), orgUUID, time.Now().UTC())
+	} else if day, dayErr := time.Parse("2006-01-02", raw); dayErr == nil {
+		report, err = h.reportService.Valuation(r.Context(), orgUUID, day)
+	} else if at, atErr := time.Parse(time.RFC3339, raw); atErr == nil {
+		report, err = h.reportService.StockAt(r.Context(), orgUUID, at)
+	} else {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_DATE", "asOf must be a date as YYYY-MM-DD or an RFC 3339 time", nil)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to build valuation report", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, report)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/units"
+	"hasufel.kj/pkg/utils"
+)
+
+// StockCountHandler serves stock count sessions. Entering counts needs
+// stockcounts.count; opening, approving and cancelling a session needs
+// stockcounts.manage, and only those who can view costs see its costs.
+type StockCountHandler struct {
+	stockCountService *services.StockCountService
+	log               *logger.Logger
+}
+
+func NewStockCountHandler(stockCountService *services.StockCountService, log *logger.Logger) *StockCountHandler {
+	return &StockCountHandler{
+		stockCountService: stockCountService,
+		log:               log,
+	}
+}
+
+func (h *StockCountHandler) GetStockCounts(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var status *domain.StockCountStatus
+	if s := r.URL.Query().Get("status"); s != "" {
+		parsed := domain.StockCountStatus(s)
+		switch parsed {
+		case domain.StockCountOpen, domain.StockCountApproved, domain.StockCountCancelled:
+			status = &parsed
+		default:
+			utils.RespondError(w, http.StatusBadRequest, "INVALID_STATUS", "Status must be OPEN, APPROVED or CANCELLED", nil)
+			return
+		}
+	}
+
+	counts, err := h.stockCountService.ListStockCounts(r.Context(), orgUUID, status)
+	if err != nil {
+		h.log.Error("Failed to list stock counts", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if counts == nil {
+		counts = []*domain.StockCount{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, sanitizeStockCountsForPermissions(counts, getPermissionsFromContext(r.Context())))
+}
+
+func (h *StockCountHandler) GetStockCount(w http.ResponseWriter, r *http.Request) {
+	count, ok := h.orgStockCount(w, r)
+	if !ok {
+		return
+	}
+	h.respondStockCount(w, r, http.StatusOK, count)
+}
+
+// CreateStockCount opens a session and snapshots the expected stock
+func (h *StockCountHandler) CreateStockCount(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	var req domain.CreateStockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	count, err := h.stockCountService.OpenStockCount(r.Context(), orgUUID, userUUID, &req)
+	if err != nil {
+		h.respondStockCountError(w, err, "Failed to open stock count")
+		return
+	}
+
+	h.respondStockCount(w, r, http.StatusCreated, count)
+}
+
+// EnterCounts records counted quantities; with add set on a line the
+// quantity is added to what was counted before
+func (h *StockCountHandler) EnterCounts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	count, ok := h.orgStockCount(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.EnterCountsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	count, err = h.stockCountService.EnterCounts(r.Context(), count.OrganizationID, count.ID, userUUID, &req)
+	if err != nil {
+		h.respondStockCountError(w, err, "Failed to enter counts")
+		return
+	}
+
+	h.respondStockCount(w, r, http.StatusOK, count)
+}
+
+// ApproveStockCount posts the variances as ADJUSTMENT movements
+func (h *StockCountHandler) ApproveStockCount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return
+	}
+
+	count, ok := h.orgStockCount(w, r)
+	if !ok {
+		return
+	}
+
+	count, err = h.stockCountService.ApproveStockCount(r.Context(), count.OrganizationID, count.ID, userUUID)
+	if err != nil {
+		h.respondStockCountError(w, err, "Failed to approve stock count")
+		return
+	}
+
+	h.respondStockCount(w, r, http.StatusOK, count)
+}
+
+func (h *StockCountHandler) CancelStockCount(w http.ResponseWriter, r *http.Request) {
+	count, ok := h.orgStockCount(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.stockCountService.CancelStockCount(r.Context(), count); err != nil {
+		h.respondStockCountError(w, err, "Failed to cancel stock count")
+		return
+	}
+
+	h.respondStockCount(w, r, http.StatusOK, count)
+}
+
+func (h *StockCountHandler) respondStockCount(w http.ResponseWriter, r *http.Request, status int, count *domain.StockCount) {
+	sanitizeStockCountsForPermissions([]*domain.StockCount{count}, getPermissionsFromContext(r.Context()))
+	utils.RespondSuccess(w, status, count)
+}
+
+func (h *StockCountHandler) respondStockCountError(w http.ResponseWriter, err error, logMessage string) {
+	var countErr *services.StockCountError
+	if errors.As(err, &countErr) {
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more counts are invalid", countErr.Lines)
+		return
+	}
+	var bulkErr *services.BulkAdjustError
+	if errors.As(err, &bulkErr) {
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", "One or more variances cannot be posted", bulkErr.Lines)
+		return
+	}
+
+	switch {
+	case err == services.ErrStockCountNotFound:
+		utils.RespondError(w, http.StatusNotFound, "STOCK_COUNT_NOT_FOUND", "Stock count not found", nil)
+	case err == services.ErrStockCountNotOpen:
+		utils.RespondError(w, http.StatusConflict, "INVALID_STOCK_COUNT_STATUS", err.Error(), nil)
+	case err == services.ErrCategoryNotFound:
+		utils.RespondError(w, http.StatusNotFound, "CATEGORY_NOT_FOUND", "Category not found", nil)
+	case err == services.ErrLocationNotFound:
+		utils.RespondError(w, http.StatusNotFound, "LOCATION_NOT_FOUND", "Location not found", nil)
+	case err == services.ErrLocationInactive:
+		utils.RespondError(w, http.StatusBadRequest, "LOCATION_INACTIVE", err.Error(), nil)
+	case err == services.ErrNothingToCount, err == services.ErrNoCountLines:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	case errors.Is(err, units.ErrInvalidUnit), errors.Is(err, units.ErrIncompatibleUnits):
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", err.Error(), nil)
+	case errors.Is(err, services.ErrItemConflict):
+		utils.RespondError(w, http.StatusConflict, "ITEM_CONFLICT", "An item was modified by another request", nil)
+	default:
+		h.log.Error(logMessage, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// orgStockCount loads the session named by the id URL parameter and checks
+// it belongs to the caller's organization, writing the error response if not
+func (h *StockCountHandler) orgStockCount(w http.ResponseWriter, r *http.Request) (*domain.StockCount, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	countID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_STOCK_COUNT_ID", "Invalid stock count ID", nil)
+		return nil, false
+	}
+
+	count, err := h.stockCountService.GetStockCount(r.Context(), countID)
+	if err != nil {
+		if err == services.ErrStockCountNotFound {
+			utils.RespondError(w, http.StatusNotFound, "STOCK_COUNT_NOT_FOUND", "Stock count not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch stock count", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if count.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "STOCK_COUNT_NOT_FOUND", "Stock count not found", nil)
+		return nil, false
+	}
+
+	return count, true
+}
@@ -0,0 +1,383 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/handlers"
+	"hasufel.kj/internal/middleware"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/migrations"
+	"hasufel.kj/pkg/logger"
+)
+
+// TestTenantIsolation_ForeignIDsAreNotFound has an admin of one organization
+// name every kind of row of another by ID, and expects a 404 each time with
+// the rows left as they were
+func TestTenantIsolation_ForeignIDsAreNotFound(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:tenants_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "?mode=memory&cache=shared"
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	m, err := database.NewMigrator(db, database.DialectSQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	dialect := database.DialectSQLite
+	userRepo := repository.NewUserRepository(db, dialect)
+	itemRepo := repository.NewItemRepository(db, dialect)
+	categoryRepo := repository.NewCategoryRepository(db, dialect)
+	movementRepo := repository.NewMovementRepository(db, dialect)
+	locationRepo := repository.NewLocationRepository(db, dialect)
+	unitRepo := repository.NewUnitRepository(db, dialect)
+	reasonRepo := repository.NewMovementReasonRepository(db, dialect)
+	recipeRepo := repository.NewRecipeRepository(db, dialect)
+	supplierRepo := repository.NewSupplierRepository(db, dialect)
+	orderRepo := repository.NewPurchaseOrderRepository(db, dialect)
+	countRepo := repository.NewStockCountRepository(db, dialect)
+	invitationRepo := repository.NewInvitationRepository(db, dialect)
+	stockLevelRepo := repository.NewStockLevelRepository(db, dialect)
+	mappingRepo := repository.NewPOSMappingRepository(db, dialect)
+
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, otherOrgID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	owner := &domain.User{OrganizationID: orgID, Email: "owner@example.com", PasswordHash: string(hash),
+		FirstName: "Olga", LastName: "Owner", Role: domain.RoleAdmin, IsActive: true}
+	intruder := &domain.User{OrganizationID: otherOrgID, Email: "intruder@example.com", PasswordHash: string(hash),
+		FirstName: "Ivan", LastName: "Intruder", Role: domain.RoleAdmin, IsActive: true}
+	for _, u := range []*domain.User{owner, intruder} {
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	// Everything the owner's organization keeps
+	own := repository.WithOrganization(ctx, orgID)
+	categoryID, err := categoryRepo.Create(own, &domain.Category{OrganizationID: orgID, Name: "Spices"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	itemID, err := itemRepo.Create(own, &domain.Item{OrganizationID: orgID, CategoryID: categoryID, Name: "Saffron",
+		UnitOfMeasurement: "gm", CurrentStock: 50, IsActive: true, TrackStock: true})
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	movementID, err := movementRepo.Create(own, &domain.StockMovement{ItemID: itemID, MovementType: domain.MovementTypeIn,
+		Quantity: 50, PreviousStock: 0, NewStock: 50, CreatedBy: owner.ID})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	locationID, err := locationRepo.Create(own, &domain.Location{OrganizationID: orgID, Name: "Cold Room", IsActive: true})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	unitID, err := unitRepo.Create(own, &domain.Unit{OrganizationID: orgID, Code: "tin", Name: "Tin", BaseUnit: "gm", Factor: 100})
+	if err != nil {
+		t.Fatalf("create unit: %v", err)
+	}
+	reason := &domain.MovementReason{OrganizationID: orgID, Code: "TASTING", Name: "Tasting", IsActive: true}
+	if _, err := reasonRepo.Create(own, reason); err != nil {
+		t.Fatalf("create reason: %v", err)
+	}
+	recipeID, err := recipeRepo.Create(own, &domain.Recipe{OrganizationID: orgID, Name: "Kesar Kheer",
+		YieldQuantity: 1, YieldUnit: "pcs", IsActive: true})
+	if err != nil {
+		t.Fatalf("create recipe: %v", err)
+	}
+	supplierID, err := supplierRepo.Create(own, &domain.Supplier{OrganizationID: orgID, Name: "Spice Route", IsActive: true})
+	if err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+	orderID, err := orderRepo.Create(own, &domain.PurchaseOrder{OrganizationID: orgID, SupplierID: supplierID, Number: 1,
+		Status: domain.PurchaseOrderDraft, CreatedBy: owner.ID})
+	if err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	countID, err := countRepo.Create(own, &domain.StockCount{OrganizationID: orgID, LocationID: locationID,
+		Status: domain.StockCountOpen, CreatedBy: owner.ID})
+	if err != nil {
+		t.Fatalf("create stock count: %v", err)
+	}
+	invitation := &domain.UserInvitation{OrganizationID: orgID, Email: "cook@example.com", Role: domain.RoleUser,
+		TokenHash: "hash", InvitedBy: owner.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := invitationRepo.Create(own, invitation); err != nil {
+		t.Fatalf("create invitation: %v", err)
+	}
+	if err := unitRepo.SetItemConversion(own, &domain.ItemUnitConversion{ItemID: itemID, Unit: "tin", Quantity: 100}); err != nil {
+		t.Fatalf("set item unit: %v", err)
+	}
+	if err := mappingRepo.Upsert(own, &domain.POSMapping{OrganizationID: orgID, Code: "KHEER", RecipeID: recipeID, Portions: 1}); err != nil {
+		t.Fatalf("create POS mapping: %v", err)
+	}
+
+	// The intruder's own pepper, to move into the owner's locations
+	theirs := repository.WithOrganization(ctx, otherOrgID)
+	pantryID, err := locationRepo.Create(theirs, &domain.Location{OrganizationID: otherOrgID, Name: "Pantry", IsDefault: true, IsActive: true})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	otherCategoryID, err := categoryRepo.Create(theirs, &domain.Category{OrganizationID: otherOrgID, Name: "Spices"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	pepperID, err := itemRepo.Create(theirs, &domain.Item{OrganizationID: otherOrgID, CategoryID: otherCategoryID, Name: "Pepper",
+		UnitOfMeasurement: "gm", CurrentStock: 20, IsActive: true, TrackStock: true})
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if err := stockLevelRepo.SetQuantity(theirs, pepperID, pantryID, 20); err != nil {
+		t.Fatalf("set stock level: %v", err)
+	}
+
+	log := logger.New("error")
+	inventory := services.NewInventoryService(itemRepo, categoryRepo, movementRepo,
+		repository.NewAlertRepository(db, dialect), locationRepo,
+		stockLevelRepo,
+		repository.NewStockLotRepository(db, dialect), unitRepo, reasonRepo,
+		repository.NewCostingRepository(db, dialect), db)
+	recipes := services.NewRecipeService(recipeRepo, itemRepo, inventory, db)
+	purchasing := services.NewPurchasingService(supplierRepo, orderRepo, itemRepo, inventory, db)
+	reorder := services.NewReorderService(repository.NewReorderRepository(db, dialect), itemRepo, supplierRepo,
+		repository.NewAlertRepository(db, dialect), inventory, db)
+	counts := services.NewStockCountService(countRepo, itemRepo, inventory, db)
+	pos := services.NewPOSImportService(mappingRepo, repository.NewPOSImportRepository(db, dialect), recipeRepo, recipes, db)
+	idempotency := services.NewIdempotencyService(repository.NewIdempotencyRepository(db, dialect), db, time.Hour)
+	authService := setupAuthService(db)
+
+	authHandler := handlers.NewAuthHandler(authService, log)
+	userHandler := handlers.NewUserHandler(setupUserService(db, authService), log)
+	inventoryHandler := handlers.NewInventoryHandler(inventory, log)
+	movementHandler := handlers.NewMovementHandler(inventory, idempotency,
+		services.RoleReversalPolicies(time.Hour, time.Hour, time.Hour), log)
+	recipeHandler := handlers.NewRecipeHandler(recipes, log)
+	purchasingHandler := handlers.NewPurchasingHandler(purchasing, log)
+	reorderHandler := handlers.NewReorderHandler(reorder, inventory, 28, log)
+	countHandler := handlers.NewStockCountHandler(counts, log)
+	posHandler := handlers.NewPOSHandler(pos, log)
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.Get("/users/{id}", userHandler.GetUser)
+		r.Put("/users/{id}", userHandler.UpdateUser)
+		r.Delete("/users/{id}", userHandler.DeactivateUser)
+		r.Delete("/users/invitations/{id}", userHandler.RevokeInvitation)
+		r.Put("/categories/{id}", inventoryHandler.UpdateCategory)
+		r.Delete("/categories/{id}", inventoryHandler.DeleteCategory)
+		r.Put("/locations/{id}", inventoryHandler.UpdateLocation)
+		r.Delete("/locations/{id}", inventoryHandler.DeleteLocation)
+		r.Put("/units/{id}", inventoryHandler.UpdateUnit)
+		r.Delete("/units/{id}", inventoryHandler.DeleteUnit)
+		r.Put("/movement-reasons/{id}", inventoryHandler.UpdateMovementReason)
+		r.Get("/items/{id}", inventoryHandler.GetItem)
+		r.Put("/items/{id}", inventoryHandler.UpdateItem)
+		r.Delete("/items/{id}", inventoryHandler.DeleteItem)
+		r.Get("/items/{id}/stock", inventoryHandler.GetItemStock)
+		r.Put("/items/{id}/stock/{locationId}", inventoryHandler.UpdateItemStockThreshold)
+		r.Get("/items/{id}/lots", inventoryHandler.GetItemLots)
+		r.Get("/items/{id}/units", inventoryHandler.GetItemUnits)
+		r.Put("/items/{id}/units/{unit}", inventoryHandler.SetItemUnit)
+		r.Delete("/items/{id}/units/{unit}", inventoryHandler.DeleteItemUnit)
+		r.Get("/items/{id}/movements", movementHandler.GetItemMovements)
+		r.Put("/items/{id}/reorder-settings", reorderHandler.UpdateSettings)
+		r.Post("/movements", movementHandler.CreateMovement)
+		r.Post("/movements/bulk", movementHandler.BulkCreateMovements)
+		r.Post("/movements/{id}/reverse", movementHandler.ReverseMovement)
+		r.Get("/recipes/{id}", recipeHandler.GetRecipe)
+		r.Put("/recipes/{id}", recipeHandler.UpdateRecipe)
+		r.Delete("/recipes/{id}", recipeHandler.DeleteRecipe)
+		r.Post("/recipes/{id}/sales", recipeHandler.RecordSale)
+		r.Put("/suppliers/{id}", purchasingHandler.UpdateSupplier)
+		r.Delete("/suppliers/{id}", purchasingHandler.DeleteSupplier)
+		r.Get("/purchase-orders/{id}", purchasingHandler.GetPurchaseOrder)
+		r.Put("/purchase-orders/{id}", purchasingHandler.UpdatePurchaseOrder)
+		r.Delete("/purchase-orders/{id}", purchasingHandler.DeletePurchaseOrder)
+		r.Post("/purchase-orders/{id}/send", purchasingHandler.SendPurchaseOrder)
+		r.Get("/purchase-orders/{id}/receipts", purchasingHandler.GetReceipts)
+		r.Get("/stock-counts/{id}", countHandler.GetStockCount)
+		r.Post("/stock-counts/{id}/approve", countHandler.ApproveStockCount)
+		r.Post("/stock-counts/{id}/cancel", countHandler.CancelStockCount)
+		r.Put("/pos/mappings/{code}", posHandler.SetMapping)
+		r.Delete("/pos/mappings/{code}", posHandler.DeleteMapping)
+	})
+
+	send := func(method, path, body, accessToken string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	login := func(email string) string {
+		t.Helper()
+		w := send(http.MethodPost, "/auth/login", `{"email":"`+email+`","password":"password123"}`, "")
+		var response struct {
+			Data struct {
+				Token string `json:"token"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.Data.Token == "" {
+			t.Fatalf("login %s: %d %v", email, w.Code, err)
+		}
+		return response.Data.Token
+	}
+	intruderToken := login(intruder.Email)
+
+	item, category := itemID.String(), categoryID.String()
+	location, pepper, pantry := locationID.String(), pepperID.String(), pantryID.String()
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, "/users/" + owner.ID.String(), ""},
+		{http.MethodPut, "/users/" + owner.ID.String(), `{"role":"USER"}`},
+		{http.MethodDelete, "/users/" + owner.ID.String(), ""},
+		{http.MethodDelete, "/users/invitations/" + invitation.ID.String(), ""},
+		{http.MethodPut, "/categories/" + category, `{"name":"Stolen"}`},
+		{http.MethodDelete, "/categories/" + category, ""},
+		{http.MethodPut, "/locations/" + locationID.String(), `{"name":"Stolen"}`},
+		{http.MethodDelete, "/locations/" + locationID.String(), ""},
+		{http.MethodPut, "/units/" + unitID.String(), `{"name":"Stolen"}`},
+		{http.MethodDelete, "/units/" + unitID.String(), ""},
+		{http.MethodPut, "/movement-reasons/" + reason.ID.String(), `{"name":"Stolen"}`},
+		{http.MethodGet, "/items/" + item, ""},
+		{http.MethodPut, "/items/" + item, `{"name":"Stolen"}`},
+		{http.MethodDelete, "/items/" + item, ""},
+		{http.MethodGet, "/items/" + item + "/stock", ""},
+		{http.MethodPut, "/items/" + item + "/stock/" + location, `{"minimumThreshold":5}`},
+		{http.MethodPut, "/items/" + pepper + "/stock/" + location, `{"minimumThreshold":5}`},
+		{http.MethodGet, "/items/" + item + "/lots", ""},
+		{http.MethodGet, "/items/" + item + "/units", ""},
+		{http.MethodPut, "/items/" + item + "/units/tin", `{"quantity":1}`},
+		{http.MethodDelete, "/items/" + item + "/units/tin", ""},
+		{http.MethodGet, "/items/" + item + "/movements", ""},
+		{http.MethodPut, "/items/" + item + "/reorder-settings", `{"parLevel":100}`},
+		{http.MethodPost, "/movements", `{"itemId":"` + item + `","movementType":"OUT","quantity":50}`},
+		{http.MethodPost, "/movements", `{"itemId":"` + item + `","movementType":"TRANSFER","quantity":50,"locationId":"` + location + `","toLocationId":"` + pantry + `"}`},
+		{http.MethodPost, "/movements", `{"itemId":"` + pepper + `","movementType":"TRANSFER","quantity":20,"locationId":"` + pantry + `","toLocationId":"` + location + `"}`},
+		{http.MethodPost, "/movements/" + movementID.String() + "/reverse", `{}`},
+		{http.MethodGet, "/recipes/" + recipeID.String(), ""},
+		{http.MethodPut, "/recipes/" + recipeID.String(), `{"name":"Stolen"}`},
+		{http.MethodDelete, "/recipes/" + recipeID.String(), ""},
+		{http.MethodPost, "/recipes/" + recipeID.String() + "/sales", `{"quantity":1}`},
+		{http.MethodPut, "/suppliers/" + supplierID.String(), `{"name":"Stolen"}`},
+		{http.MethodDelete, "/suppliers/" + supplierID.String(), ""},
+		{http.MethodGet, "/purchase-orders/" + orderID.String(), ""},
+		{http.MethodPut, "/purchase-orders/" + orderID.String(), `{"notes":"Stolen"}`},
+		{http.MethodDelete, "/purchase-orders/" + orderID.String(), ""},
+		{http.MethodPost, "/purchase-orders/" + orderID.String() + "/send", ""},
+		{http.MethodGet, "/purchase-orders/" + orderID.String() + "/receipts", ""},
+		{http.MethodGet, "/stock-counts/" + countID.String(), ""},
+		{http.MethodPost, "/stock-counts/" + countID.String() + "/approve", ""},
+		{http.MethodPost, "/stock-counts/" + countID.String() + "/cancel", ""},
+		{http.MethodPut, "/pos/mappings/KHEER", `{"recipeId":"` + recipeID.String() + `"}`},
+		{http.MethodDelete, "/pos/mappings/KHEER", ""},
+	}
+	for _, req := range requests {
+		if w := send(req.method, req.path, req.body, intruderToken); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404 for another organization's row, got %d: %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+
+	// Bulk movements reject the lines naming another organization's rows
+	for _, body := range []string{
+		`{"adjustments":[{"itemId":"` + item + `","movementType":"OUT","quantity":50}]}`,
+		`{"adjustments":[{"itemId":"` + pepper + `","movementType":"TRANSFER","quantity":20,"locationId":"` + pantry + `","toLocationId":"` + location + `"}]}`,
+	} {
+		if w := send(http.MethodPost, "/movements/bulk", body, intruderToken); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "VALIDATION_FAILED") {
+			t.Errorf("POST /movements/bulk %s: expected the line to be rejected, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	// Nothing the intruder named has changed
+	if got, err := itemRepo.GetByID(own, itemID); err != nil || got == nil || got.Name != "Saffron" || got.CurrentStock != 50 || got.ParLevel != nil {
+		t.Errorf("expected the item unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := categoryRepo.GetByID(own, categoryID); err != nil || got == nil || got.Name != "Spices" {
+		t.Errorf("expected the category unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := movementRepo.GetByID(own, movementID); err != nil || got == nil || got.VoidedAt != nil {
+		t.Errorf("expected the movement not reversed, got %+v (%v)", got, err)
+	}
+	if got, err := locationRepo.GetByID(own, locationID); err != nil || got == nil || got.Name != "Cold Room" {
+		t.Errorf("expected the location unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := unitRepo.GetByID(own, unitID); err != nil || got == nil || got.Name != "Tin" {
+		t.Errorf("expected the unit unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := reasonRepo.GetByID(own, reason.ID); err != nil || got == nil || got.Name != "Tasting" {
+		t.Errorf("expected the reason unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := recipeRepo.GetByID(own, recipeID); err != nil || got == nil || got.Name != "Kesar Kheer" {
+		t.Errorf("expected the recipe unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := supplierRepo.GetByID(own, supplierID); err != nil || got == nil || got.Name != "Spice Route" {
+		t.Errorf("expected the supplier unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := orderRepo.GetByID(own, orderID); err != nil || got == nil || got.Status != domain.PurchaseOrderDraft || got.Notes != nil {
+		t.Errorf("expected the purchase order unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := countRepo.GetByID(own, countID); err != nil || got == nil || got.Status != domain.StockCountOpen {
+		t.Errorf("expected the stock count still open, got %+v (%v)", got, err)
+	}
+	if got, err := invitationRepo.GetByID(own, invitation.ID); err != nil || got == nil || got.RevokedAt != nil {
+		t.Errorf("expected the invitation not revoked, got %+v (%v)", got, err)
+	}
+	if got, err := userRepo.GetByID(ctx, owner.ID); err != nil || got == nil || got.Role != domain.RoleAdmin || !got.IsActive {
+		t.Errorf("expected the owner unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := stockLevelRepo.Get(own, itemID, locationID); err != nil || got != nil {
+		t.Errorf("expected no stock level set for the item, got %+v (%v)", got, err)
+	}
+	if got, err := unitRepo.ListItemConversions(own, itemID); err != nil || len(got) != 1 || got[0].Quantity != 100 {
+		t.Errorf("expected the item unit unchanged, got %v (%v)", got, err)
+	}
+	if got, err := mappingRepo.GetByCode(own, orgID, "KHEER"); err != nil || got == nil || got.RecipeID != recipeID {
+		t.Errorf("expected the POS mapping unchanged, got %+v (%v)", got, err)
+	}
+	if got, err := stockLevelRepo.ListByItem(repository.AllOrganizations(ctx), pepperID); err != nil || len(got) != 1 || got[0].LocationID != pantryID || got[0].Quantity != 20 {
+		t.Errorf("expected the pepper left in the pantry, got %v (%v)", got, err)
+	}
+
+	// The owner still reaches them all
+	ownerToken := login(owner.Email)
+	for _, path := range []string{"/items/" + item, "/items/" + item + "/movements", "/recipes/" + recipeID.String(),
+		"/purchase-orders/" + orderID.String(), "/stock-counts/" + countID.String(), "/users/" + owner.ID.String()} {
+		if w := send(http.MethodGet, path, "", ownerToken); w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200 for the owner, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/units"
+	"hasufel.kj/pkg/utils"
+)
+
+// Unit handlers
+
+// GetUnits lists the organization's own units; the built-in kg, gm, ltr and
+// pcs are always available on top of them
+func (h *InventoryHandler) GetUnits(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	list, err := h.inventoryService.ListUnits(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list units", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if list == nil {
+		list = []*domain.Unit{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, list)
+}
+
+func (h *InventoryHandler) CreateUnit(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	var req domain.CreateUnitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	unit, err := h.inventoryService.CreateUnit(r.Context(), orgUUID, &req)
+	if err != nil {
+		h.respondUnitError(w, err, "Failed to create unit")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, unit)
+}
+
+func (h *InventoryHandler) UpdateUnit(w http.ResponseWriter, r *http.Request) {
+	unit, ok := h.orgUnit(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateUnitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.inventoryService.UpdateUnit(r.Context(), unit, &req); err != nil {
+		h.respondUnitError(w, err, "Failed to update unit")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, unit)
+}
+
+func (h *InventoryHandler) DeleteUnit(w http.ResponseWriter, r *http.Request) {
+	unit, ok := h.orgUnit(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.inventoryService.DeleteUnit(r.Context(), unit.ID); err != nil {
+		h.respondUnitError(w, err, "Failed to delete unit")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Unit deleted successfully"})
+}
+
+// orgUnit loads the unit named by the id URL parameter and checks it belongs
+// to the caller's organization, writing the error response if not
+func (h *InventoryHandler) orgUnit(w http.ResponseWriter, r *http.Request) (*domain.Unit, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	unitID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT_ID", "Invalid unit ID", nil)
+		return nil, false
+	}
+
+	unit, err := h.inventoryService.GetUnit(r.Context(), unitID)
+	if err != nil {
+		if err == services.ErrUnitNotFound {
+			utils.RespondError(w, http.StatusNotFound, "UNIT_NOT_FOUND", "Unit not found", nil)
+			return nil, false
+		}
+		h.log.Error("Failed to fetch unit", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return nil, false
+	}
+	if unit.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "UNIT_NOT_FOUND", "Unit not found", nil)
+		return nil, false
+	}
+
+	return unit, true
+}
+
+// respondUnitError maps errors from managing units and item purchase units
+// to API errors, logging anything unexpected as message
+func (h *InventoryHandler) respondUnitError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case err == services.ErrUnitNotFound:
+		utils.RespondError(w, http.StatusNotFound, "UNIT_NOT_FOUND", "Unit not found", nil)
+	case err == services.ErrUnitCodeTaken:
+		utils.RespondError(w, http.StatusConflict, "UNIT_CODE_TAKEN", err.Error(), nil)
+	case err == services.ErrUnitInUse:
+		utils.RespondError(w, http.StatusConflict, "UNIT_IN_USE", "Items, recipes or other units still measure in this unit", nil)
+	case err == services.ErrInvalidUnitCode,
+		err == services.ErrInvalidUnitName,
+		err == services.ErrInvalidBaseUnit,
+		err == services.ErrInvalidFactor,
+		err == services.ErrInvalidPrecision:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	case err == services.ErrInvalidQuantity:
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_QUANTITY", "Quantity must be positive", nil)
+	case errors.Is(err, units.ErrInvalidUnit), errors.Is(err, units.ErrIncompatibleUnits):
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_UNIT", err.Error(), nil)
+	default:
+		h.log.Error(message, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// Item unit handlers
+
+// GetItemUnits lists the purchase units of an item
+func (h *InventoryHandler) GetItemUnits(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	conversions, err := h.inventoryService.ListItemConversions(r.Context(), item.ID)
+	if err != nil {
+		h.log.Error("Failed to list item units", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if conversions == nil {
+		conversions = []*domain.ItemUnitConversion{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, conversions)
+}
+
+// SetItemUnit sets how much of the item the purchase unit in the URL holds
+func (h *InventoryHandler) SetItemUnit(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.SetItemUnitConversionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	conversion, err := h.inventoryService.SetItemConversion(r.Context(), item, chi.URLParam(r, "unit"), &req)
+	if err != nil {
+		h.respondUnitError(w, err, "Failed to set item unit")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, conversion)
+}
+
+func (h *InventoryHandler) DeleteItemUnit(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.orgItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.inventoryService.DeleteItemConversion(r.Context(), item.ID, chi.URLParam(r, "unit")); err != nil {
+		h.respondUnitError(w, err, "Failed to delete item unit")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, map[string]string{"message": "Item unit deleted successfully"})
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/logger"
+	"hasufel.kj/pkg/utils"
+)
+
+// UserHandler lets admins manage the users of their organization and invite
+// new ones. Every route needs users.manage.
+type UserHandler struct {
+	userService *services.UserService
+	log         *logger.Logger
+}
+
+func NewUserHandler(userService *services.UserService, log *logger.Logger) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		log:         log,
+	}
+}
+
+// User handlers
+
+func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	users, err := h.userService.ListUsers(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list users", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if users == nil {
+		users = []*domain.User{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, users)
+}
+
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.orgUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, user)
+}
+
+// UpdateUser changes a user's name, role or active flag
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := h.actorID(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := h.orgUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.userService.UpdateUser(r.Context(), actorID, user, &req); err != nil {
+		h.respondUserError(w, err, "Failed to update user")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, user)
+}
+
+// DeactivateUser deactivates a user. Users are kept, as the movements they
+// posted refer to them, and can be reactivated with UpdateUser.
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	actorID, ok := h.actorID(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := h.orgUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userService.DeactivateUser(r.Context(), actorID, user); err != nil {
+		h.respondUserError(w, err, "Failed to deactivate user")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, user)
+}
+
+// Invitation handlers
+
+func (h *UserHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	invitations, err := h.userService.ListInvitations(r.Context(), orgUUID)
+	if err != nil {
+		h.log.Error("Failed to list invitations", err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+		return
+	}
+	if invitations == nil {
+		invitations = []*domain.UserInvitation{}
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, invitations)
+}
+
+// InviteUser invites an email to the caller's organization. The response
+// carries the invitation token, which is not shown again.
+func (h *UserHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	actorID, ok := h.actorID(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.InviteUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body", nil)
+		return
+	}
+
+	invitation, err := h.userService.InviteUser(r.Context(), orgUUID, actorID, &req)
+	if err != nil {
+		h.respondUserError(w, err, "Failed to invite user")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusCreated, invitation)
+}
+
+func (h *UserHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return
+	}
+
+	invitationID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_INVITATION_ID", "Invalid invitation ID", nil)
+		return
+	}
+
+	invitation, err := h.userService.GetInvitation(r.Context(), invitationID)
+	if err != nil {
+		h.respondUserError(w, err, "Failed to fetch invitation")
+		return
+	}
+	if invitation.OrganizationID != orgUUID {
+		utils.RespondError(w, http.StatusNotFound, "INVITATION_NOT_FOUND", "Invitation not found", nil)
+		return
+	}
+
+	if err := h.userService.RevokeInvitation(r.Context(), invitation); err != nil {
+		h.respondUserError(w, err, "Failed to revoke invitation")
+		return
+	}
+
+	utils.RespondSuccess(w, http.StatusOK, invitation)
+}
+
+// respondUserError maps errors from the user service to API errors, logging
+// anything unexpected as logMessage
+func (h *UserHandler) respondUserError(w http.ResponseWriter, err error, logMessage string) {
+	switch err {
+	case services.ErrUserNotFound:
+		utils.RespondError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found", nil)
+	case services.ErrInvitationNotFound:
+		utils.RespondError(w, http.StatusNotFound, "INVITATION_NOT_FOUND", "Invitation not found", nil)
+	case services.ErrInvalidRole, services.ErrInvalidEmail, services.ErrInvalidName:
+		utils.RespondError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	case services.ErrEmailExists:
+		utils.RespondError(w, http.StatusConflict, "EMAIL_EXISTS", "Email already exists", nil)
+	case services.ErrLastAdmin:
+		utils.RespondError(w, http.StatusConflict, "LAST_ADMIN", err.Error(), nil)
+	case services.ErrDeactivateSelf:
+		utils.RespondError(w, http.StatusConflict, "CANNOT_DEACTIVATE_SELF", err.Error(), nil)
+	case services.ErrInvitationNotPending:
+		utils.RespondError(w, http.StatusConflict, "INVITATION_NOT_PENDING", err.Error(), nil)
+	case services.ErrNameNotEditable:
+		utils.RespondError(w, http.StatusForbidden, "NAME_NOT_EDITABLE", err.Error(), nil)
+	default:
+		h.log.Error(logMessage, err)
+		utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+	}
+}
+
+// actorID returns the ID of the calling user, writing the error response if
+// it is invalid
+func (h *UserHandler) actorID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID := r.Context().Value("user_id").(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return uuid.Nil, false
+	}
+	return userUUID, true
+}
+
+// orgUser loads the user named by the id URL parameter as a member of the
+// caller's organization, writing the error response if they aren't one
+func (h *UserHandler) orgUser(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	orgID := r.Context().Value("organization_id").(string)
+	orgUUID, err := uuid.Parse(orgID)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+		return nil, false
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID", nil)
+		return nil, false
+	}
+
+	user, err := h.userService.GetUser(r.Context(), orgUUID, userID)
+	if err != nil {
+		h.respondUserError(w, err, "Failed to fetch user")
+		return nil, false
+	}
+
+	return user, true
+}
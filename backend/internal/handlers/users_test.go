@@ -0,0 +1,449 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/handlers"
+	"hasufel.kj/internal/middleware"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/logger"
+)
+
+func TestUserHandler_InviteChangeRoleAndDeactivate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, otherOrgID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	admin := &domain.User{OrganizationID: orgID, Email: "admin@example.com", PasswordHash: string(hash),
+		FirstName: "Ada", LastName: "Admin", Role: domain.RoleAdmin, IsActive: true}
+	outsider := &domain.User{OrganizationID: otherOrgID, Email: "outsider@example.com", PasswordHash: string(hash),
+		FirstName: "Otto", LastName: "Outsider", Role: domain.RoleUser, IsActive: true}
+	for _, u := range []*domain.User{admin, outsider} {
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	authService := setupAuthService(db)
+	authHandler := handlers.NewAuthHandler(authService, logger.New("error"))
+	userHandler := handlers.NewUserHandler(setupUserService(db, authService), logger.New("error"))
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Post("/auth/register", authHandler.Register)
+	r.Post("/auth/refresh", authHandler.Refresh)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.Get("/auth/profile", authHandler.GetProfile)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(domain.PermUsersManage))
+			r.Get("/users", userHandler.GetUsers)
+			r.Get("/users/invitations", userHandler.GetInvitations)
+			r.Post("/users/invitations", userHandler.InviteUser)
+			r.Delete("/users/invitations/{id}", userHandler.RevokeInvitation)
+			r.Get("/users/{id}", userHandler.GetUser)
+			r.Put("/users/{id}", userHandler.UpdateUser)
+			r.Delete("/users/{id}", userHandler.DeactivateUser)
+		})
+	})
+
+	// send makes a request and returns the status, the data and the error
+	// code of the response
+	send := func(method, path string, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		var raw []byte
+		if body != nil {
+			if raw, err = json.Marshal(body); err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data  json.RawMessage `json:"data"`
+			Error interface{}     `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		data := map[string]interface{}{}
+		if len(response.Data) > 0 && response.Data[0] == '{' {
+			json.Unmarshal(response.Data, &data)
+		}
+		if len(response.Data) > 0 && response.Data[0] == '[' {
+			var list []interface{}
+			json.Unmarshal(response.Data, &list)
+			data["list"] = list
+		}
+		code := ""
+		if errorObj, ok := response.Error.(map[string]interface{}); ok {
+			code, _ = errorObj["code"].(string)
+		}
+		return w.Code, data, code
+	}
+	login := func(email string) map[string]interface{} {
+		t.Helper()
+		status, data, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: email, Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s: expected 200, got %d %s", email, status, code)
+		}
+		return data
+	}
+	adminToken := login("admin@example.com")["token"].(string)
+
+	// Inviting binds the invitee to the admin's organization and role
+	status, invitation, code := send(http.MethodPost, "/users/invitations", domain.InviteUserRequest{Email: " Cook@Example.com ", Role: domain.RoleManager}, adminToken)
+	if status != http.StatusCreated || invitation["email"] != "cook@example.com" || invitation["status"] != string(domain.InvitationPending) || invitation["token"] == "" {
+		t.Fatalf("expected a pending invitation with its token, got %d %s %v", status, code, invitation)
+	}
+	if status, _, code := send(http.MethodPost, "/users/invitations", domain.InviteUserRequest{Email: "x@example.com", Role: "OWNER"}, adminToken); status != http.StatusBadRequest || code != "VALIDATION_FAILED" {
+		t.Errorf("expected an unknown role to be rejected, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPost, "/users/invitations", domain.InviteUserRequest{Email: "outsider@example.com"}, adminToken); status != http.StatusConflict || code != "EMAIL_EXISTS" {
+		t.Errorf("expected an existing user's email to be rejected, got %d %s", status, code)
+	}
+
+	status, cook, code := send(http.MethodPost, "/auth/register", handlers.RegisterRequest{
+		InvitationToken: invitation["token"].(string), Password: "password123", FirstName: "Carl", LastName: "Cook",
+	}, "")
+	if status != http.StatusCreated {
+		t.Fatalf("expected the invitee to register, got %d %s", status, code)
+	}
+	cookUser := cook["user"].(map[string]interface{})
+	cookID := cookUser["id"].(string)
+	if cookUser["organizationId"] != orgID.String() || cookUser["role"] != string(domain.RoleManager) {
+		t.Errorf("expected the invitee in the admin's organization as a manager, got %v", cookUser)
+	}
+
+	// Only admins manage users, and only those of their organization
+	if status, _, code := send(http.MethodGet, "/users", nil, cook["token"].(string)); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Errorf("expected a manager to be refused, got %d %s", status, code)
+	}
+	if status, users, _ := send(http.MethodGet, "/users", nil, adminToken); status != http.StatusOK || len(users["list"].([]interface{})) != 2 {
+		t.Errorf("expected the 2 users of the organization, got %d %v", status, users)
+	}
+	if status, _, code := send(http.MethodGet, "/users/"+outsider.ID.String(), nil, adminToken); status != http.StatusNotFound || code != "USER_NOT_FOUND" {
+		t.Errorf("expected a user of another organization not to be found, got %d %s", status, code)
+	}
+
+	// A role change expires the user's access tokens; refreshing picks up
+	// the new role
+	status, changed, code := send(http.MethodPut, "/users/"+cookID, map[string]interface{}{"role": "USER"}, adminToken)
+	if status != http.StatusOK || changed["role"] != string(domain.RoleUser) {
+		t.Fatalf("expected the role to change, got %d %s %v", status, code, changed)
+	}
+	if status, _, _ := send(http.MethodGet, "/auth/profile", nil, cook["token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("expected the old access token to be expired, got %d", status)
+	}
+	status, refreshed, code := send(http.MethodPost, "/auth/refresh", map[string]interface{}{"refreshToken": cook["refreshToken"]}, "")
+	if status != http.StatusOK {
+		t.Fatalf("expected the session to stay open, got %d %s", status, code)
+	}
+	if status, profile, _ := send(http.MethodGet, "/auth/profile", nil, refreshed["token"].(string)); status != http.StatusOK || profile["role"] != string(domain.RoleUser) {
+		t.Errorf("expected the refreshed token to be accepted with the new role, got %d %v", status, profile)
+	}
+
+	// Deactivation revokes the user's sessions in the organization at once
+	if status, deactivated, code := send(http.MethodDelete, "/users/"+cookID, nil, adminToken); status != http.StatusOK || deactivated["isActive"] != false {
+		t.Fatalf("expected the user to be deactivated, got %d %s", status, code)
+	}
+	if status, _, _ := send(http.MethodGet, "/auth/profile", nil, refreshed["token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("expected the access token to be revoked, got %d", status)
+	}
+	if status, _, code := send(http.MethodPost, "/auth/refresh", map[string]interface{}{"refreshToken": refreshed["refreshToken"]}, ""); status != http.StatusUnauthorized || code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("expected the refresh token to be revoked, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: "cook@example.com", Password: "password123"}, ""); status != http.StatusForbidden || code != "USER_INACTIVE" {
+		t.Errorf("expected the deactivated user not to sign in, got %d %s", status, code)
+	}
+
+	// The organization keeps an active admin
+	if status, _, code := send(http.MethodPut, "/users/"+admin.ID.String(), map[string]interface{}{"role": "MANAGER"}, adminToken); status != http.StatusConflict || code != "LAST_ADMIN" {
+		t.Errorf("expected the last admin not to be demoted, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodDelete, "/users/"+admin.ID.String(), nil, adminToken); status != http.StatusConflict || code != "CANNOT_DEACTIVATE_SELF" {
+		t.Errorf("expected admins not to deactivate themselves, got %d %s", status, code)
+	}
+
+	// A revoked invitation can't be accepted
+	_, invitation, _ = send(http.MethodPost, "/users/invitations", domain.InviteUserRequest{Email: "late@example.com"}, adminToken)
+	if status, revoked, code := send(http.MethodDelete, "/users/invitations/"+invitation["id"].(string), nil, adminToken); status != http.StatusOK || revoked["status"] != string(domain.InvitationRevoked) {
+		t.Errorf("expected the invitation to be revoked, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodDelete, "/users/invitations/"+invitation["id"].(string), nil, adminToken); status != http.StatusConflict || code != "INVITATION_NOT_PENDING" {
+		t.Errorf("expected a revoked invitation not to be revoked again, got %d %s", status, code)
+	}
+	if status, _, code := send(http.MethodPost, "/auth/register", handlers.RegisterRequest{
+		InvitationToken: invitation["token"].(string), Password: "password123", FirstName: "Lee", LastName: "Late",
+	}, ""); status != http.StatusBadRequest || code != "INVALID_INVITATION" {
+		t.Errorf("expected the revoked invitation to be refused, got %d %s", status, code)
+	}
+	if status, invitations, _ := send(http.MethodGet, "/users/invitations", nil, adminToken); status != http.StatusOK || len(invitations["list"].([]interface{})) != 2 {
+		t.Errorf("expected both invitations listed, got %d %v", status, invitations)
+	}
+}
+
+func TestUserHandler_DeactivationEndsOnlyThatOrganizationsSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	orgID, outletID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, outletID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	outletAdmin := &domain.User{OrganizationID: outletID, Email: "outlet-admin@example.com", PasswordHash: string(hash),
+		FirstName: "Ada", LastName: "Admin", Role: domain.RoleAdmin, IsActive: true}
+	cook := &domain.User{OrganizationID: orgID, Email: "cook@example.com", PasswordHash: string(hash),
+		FirstName: "Carl", LastName: "Cook", Role: domain.RoleUser, IsActive: true}
+	for _, u := range []*domain.User{outletAdmin, cook} {
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	// The cook works at the outlet as well
+	if err := repository.NewOrganizationRepository(db, database.DialectSQLite).AddMember(ctx, &domain.Membership{
+		OrganizationID: outletID, UserID: cook.ID, Role: domain.RoleUser, IsActive: true,
+	}); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	authService := setupAuthService(db)
+	authHandler := handlers.NewAuthHandler(authService, logger.New("error"))
+	userHandler := handlers.NewUserHandler(setupUserService(db, authService), logger.New("error"))
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Post("/auth/refresh", authHandler.Refresh)
+	r.Post("/auth/switch-organization", authHandler.SwitchOrganization)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.Get("/auth/profile", authHandler.GetProfile)
+		r.With(middleware.RequirePermission(domain.PermUsersManage)).Delete("/users/{id}", userHandler.DeactivateUser)
+	})
+
+	// send makes a request and returns the status, the data and the error
+	// code of the response
+	send := func(method, path string, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		var raw []byte
+		if body != nil {
+			if raw, err = json.Marshal(body); err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data  map[string]interface{} `json:"data"`
+			Error interface{}            `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		code := ""
+		if errorObj, ok := response.Error.(map[string]interface{}); ok {
+			code, _ = errorObj["code"].(string)
+		}
+		return w.Code, response.Data, code
+	}
+	login := func(email string) map[string]interface{} {
+		t.Helper()
+		status, data, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: email, Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s: expected 200, got %d %s", email, status, code)
+		}
+		return data
+	}
+
+	// One session of the cook at home and another at the outlet
+	home := login(cook.Email)
+	status, outlet, code := send(http.MethodPost, "/auth/switch-organization",
+		handlers.SwitchOrganizationRequest{RefreshToken: login(cook.Email)["refreshToken"].(string), OrganizationID: outletID.String()}, "")
+	if status != http.StatusOK {
+		t.Fatalf("switch to the outlet: expected 200, got %d %s", status, code)
+	}
+
+	if status, _, code := send(http.MethodDelete, "/users/"+cook.ID.String(), nil, login(outletAdmin.Email)["token"].(string)); status != http.StatusOK {
+		t.Fatalf("expected the outlet admin to deactivate the cook, got %d %s", status, code)
+	}
+
+	// The outlet session ends
+	if status, _, _ := send(http.MethodGet, "/auth/profile", nil, outlet["token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("expected the outlet access token to be revoked, got %d", status)
+	}
+	if status, _, code := send(http.MethodPost, "/auth/refresh", map[string]interface{}{"refreshToken": outlet["refreshToken"]}, ""); status != http.StatusUnauthorized {
+		t.Errorf("expected the outlet refresh token to be revoked, got %d %s", status, code)
+	}
+
+	// The session at home refreshes and carries on
+	if status, _, _ := send(http.MethodGet, "/auth/profile", nil, home["token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("expected the home access token to be expired, got %d", status)
+	}
+	status, refreshed, code := send(http.MethodPost, "/auth/refresh", map[string]interface{}{"refreshToken": home["refreshToken"]}, "")
+	if status != http.StatusOK {
+		t.Fatalf("expected the home session to stay open, got %d %s", status, code)
+	}
+	if status, profile, _ := send(http.MethodGet, "/auth/profile", nil, refreshed["token"].(string)); status != http.StatusOK || profile["organizationId"] != orgID.String() {
+		t.Errorf("expected the refreshed token to be accepted at home, got %d %v", status, profile)
+	}
+}
+
+func TestUserHandler_OnlyTheHomeOrganizationRenames(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	orgID, outletID := uuid.New(), uuid.New()
+	for _, org := range []uuid.UUID{orgID, outletID} {
+		if _, err := db.Exec("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)",
+			org.String(), "Org "+org.String(), org.String()); err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+	}
+
+	userRepo := repository.NewUserRepository(db, database.DialectSQLite)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	homeAdmin := &domain.User{OrganizationID: orgID, Email: "admin@example.com", PasswordHash: string(hash),
+		FirstName: "Ada", LastName: "Admin", Role: domain.RoleAdmin, IsActive: true}
+	outletAdmin := &domain.User{OrganizationID: outletID, Email: "outlet-admin@example.com", PasswordHash: string(hash),
+		FirstName: "Olga", LastName: "Outlet", Role: domain.RoleAdmin, IsActive: true}
+	cook := &domain.User{OrganizationID: orgID, Email: "cook@example.com", PasswordHash: string(hash),
+		FirstName: "Carl", LastName: "Cook", Role: domain.RoleUser, IsActive: true}
+	for _, u := range []*domain.User{homeAdmin, outletAdmin, cook} {
+		if _, err := userRepo.Create(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	// The cook works at the outlet as well
+	if err := repository.NewOrganizationRepository(db, database.DialectSQLite).AddMember(ctx, &domain.Membership{
+		OrganizationID: outletID, UserID: cook.ID, Role: domain.RoleUser, IsActive: true,
+	}); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	authService := setupAuthService(db)
+	authHandler := handlers.NewAuthHandler(authService, logger.New("error"))
+	userHandler := handlers.NewUserHandler(setupUserService(db, authService), logger.New("error"))
+
+	r := chi.NewRouter()
+	r.Post("/auth/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware("test-secret-key", authService))
+		r.With(middleware.RequirePermission(domain.PermUsersManage)).Put("/users/{id}", userHandler.UpdateUser)
+	})
+
+	// send makes a request and returns the status, the data and the error
+	// code of the response
+	send := func(method, path string, body interface{}, accessToken string) (int, map[string]interface{}, string) {
+		t.Helper()
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data  map[string]interface{} `json:"data"`
+			Error interface{}            `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		code := ""
+		if errorObj, ok := response.Error.(map[string]interface{}); ok {
+			code, _ = errorObj["code"].(string)
+		}
+		return w.Code, response.Data, code
+	}
+	token := func(email string) string {
+		t.Helper()
+		status, data, code := send(http.MethodPost, "/auth/login", handlers.LoginRequest{Email: email, Password: "password123"}, "")
+		if status != http.StatusOK {
+			t.Fatalf("login %s: expected 200, got %d %s", email, status, code)
+		}
+		return data["token"].(string)
+	}
+	name := func() string {
+		t.Helper()
+		account, err := userRepo.GetByID(ctx, cook.ID)
+		if err != nil {
+			t.Fatalf("get user: %v", err)
+		}
+		return account.FirstName + " " + account.LastName
+	}
+
+	// The outlet manages the cook's membership but not the account's name
+	outlet := token(outletAdmin.Email)
+	if status, _, code := send(http.MethodPut, "/users/"+cook.ID.String(), map[string]interface{}{"firstName": "Carla"}, outlet); status != http.StatusForbidden || code != "NAME_NOT_EDITABLE" {
+		t.Fatalf("expected the outlet admin to be refused a rename, got %d %s", status, code)
+	}
+	if got := name(); got != "Carl Cook" {
+		t.Fatalf("expected the name to stay Carl Cook, got %s", got)
+	}
+	if status, data, code := send(http.MethodPut, "/users/"+cook.ID.String(), map[string]interface{}{"firstName": "Carl", "role": "MANAGER"}, outlet); status != http.StatusOK || data["role"] != "MANAGER" {
+		t.Fatalf("expected the outlet admin to change the cook's role there, got %d %s %v", status, code, data)
+	}
+
+	// The home organization renames the cook everywhere
+	if status, _, code := send(http.MethodPut, "/users/"+cook.ID.String(), map[string]interface{}{"firstName": "Carla"}, token(homeAdmin.Email)); status != http.StatusOK {
+		t.Fatalf("expected the home admin to rename the cook, got %d %s", status, code)
+	}
+	if got := name(); got != "Carla Cook" {
+		t.Fatalf("expected the cook to be renamed Carla Cook, got %s", got)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/repository"
 )
 
 type Claims struct {
@@ -14,11 +16,20 @@ type Claims struct {
 	Email          string `json:"email"`
 	OrganizationID string `json:"organization_id"`
 	Role           string `json:"role"`
+	TokenVersion   int    `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT tokens and extracts user information
-func AuthMiddleware(jwtSecret string) func(next http.Handler) http.Handler {
+// SessionChecker reports whether an access token issued to the user at the
+// given token version has not been revoked since
+type SessionChecker interface {
+	CheckSession(ctx context.Context, userID string, tokenVersion int) (bool, error)
+}
+
+// AuthMiddleware validates JWT tokens and extracts user information. When
+// sessions is set, tokens whose session has been revoked are rejected as
+// well.
+func AuthMiddleware(jwtSecret string, sessions SessionChecker) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from Authorization header
@@ -52,11 +63,28 @@ func AuthMiddleware(jwtSecret string) func(next http.Handler) http.Handler {
 			}
 
 			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+				if sessions != nil {
+					valid, err := sessions.CheckSession(r.Context(), claims.UserID, claims.TokenVersion)
+					if err != nil {
+						respondError(w, http.StatusInternalServerError, "Internal server error")
+						return
+					}
+					if !valid {
+						respondError(w, http.StatusUnauthorized, "Token revoked")
+						return
+					}
+				}
+
 				// Add user information to context
 				ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 				ctx = context.WithValue(ctx, "email", claims.Email)
 				ctx = context.WithValue(ctx, "organization_id", claims.OrganizationID)
 				ctx = context.WithValue(ctx, "role", claims.Role)
+				// Repository calls reach only the rows of the caller's
+				// organization, whatever IDs the request names
+				if orgID, err := uuid.Parse(claims.OrganizationID); err == nil {
+					ctx = repository.WithOrganization(ctx, orgID)
+				}
 
 				next.ServeHTTP(w, r.WithContext(ctx))
 			} else {
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/pkg/utils"
+)
+
+// PermissionResolver returns the permissions a role of an organization holds
+type PermissionResolver interface {
+	RolePermissions(ctx context.Context, orgID uuid.UUID, role domain.UserRole) (domain.PermissionSet, error)
+}
+
+// LoadPermissions resolves the permissions of the caller's role in their
+// organization and adds them to the context. It runs after AuthMiddleware.
+func LoadPermissions(resolver PermissionResolver) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID, _ := r.Context().Value("organization_id").(string)
+			orgUUID, err := uuid.Parse(orgID)
+			if err != nil {
+				utils.RespondError(w, http.StatusBadRequest, "INVALID_ORG_ID", "Invalid organization ID", nil)
+				return
+			}
+			role, _ := r.Context().Value("role").(string)
+
+			permissions, err := resolver.RolePermissions(r.Context(), orgUUID, domain.UserRole(role))
+			if err != nil {
+				utils.RespondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", nil)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "permissions", permissions)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequirePermission refuses callers whose role lacks the permission
+func RequirePermission(permission domain.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !PermissionsFromContext(r.Context()).Has(permission) {
+				utils.RespondError(w, http.StatusForbidden, "FORBIDDEN", "Permission required: "+string(permission), nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PermissionsFromContext returns the permissions LoadPermissions added to
+// the context. Without them it falls back to the defaults of the caller's
+// role.
+func PermissionsFromContext(ctx context.Context) domain.PermissionSet {
+	if permissions, ok := ctx.Value("permissions").(domain.PermissionSet); ok {
+		return permissions
+	}
+	role, _ := ctx.Value("role").(string)
+	return domain.DefaultPermissions(domain.UserRole(role))
+}
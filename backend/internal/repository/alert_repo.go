@@ -4,21 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 )
 
-func NewAlertRepository(db *sql.DB) AlertRepository {
-	return &alertRepoSQLite{db: db}
+func NewAlertRepository(db *sql.DB, dialect database.Dialect) AlertRepository {
+	return &alertRepo{db: db, dialect: dialect}
 }
 
-type alertRepoSQLite struct {
-	db *sql.DB
+type alertRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
 }
 
-func (r *alertRepoSQLite) Create(ctx context.Context, alert *domain.Alert) (uuid.UUID, error) {
+func (r *alertRepo) Create(ctx context.Context, alert *domain.Alert) (uuid.UUID, error) {
 	if alert == nil {
 		return uuid.Nil, errors.New("alert is nil")
 	}
@@ -36,7 +39,7 @@ func (r *alertRepoSQLite) Create(ctx context.Context, alert *domain.Alert) (uuid
 		itemIDStr = &s
 	}
 
-	_, err := r.db.ExecContext(ctx, `
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
 		INSERT INTO alerts (
 			id, organization_id, item_id, type, severity,
 			title, message, is_read, created_at
@@ -52,12 +55,16 @@ func (r *alertRepoSQLite) Create(ctx context.Context, alert *domain.Alert) (uuid
 	return alert.ID, nil
 }
 
-func (r *alertRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.Alert, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *alertRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Alert, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
 		SELECT id, organization_id, item_id, type, severity,
 		       title, message, is_read, created_at
-		FROM alerts WHERE id = ?
-	`, id.String())
+		FROM alerts WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
 
 	var alert domain.Alert
 	var idStr, orgStr string
@@ -83,8 +90,8 @@ func (r *alertRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.Al
 	return &alert, nil
 }
 
-func (r *alertRepoSQLite) ListUnread(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error) {
-	rows, err := r.db.QueryContext(ctx, `
+func (r *alertRepo) ListUnread(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT id, organization_id, item_id, type, severity,
 		       title, message, is_read, created_at
 		FROM alerts
@@ -100,8 +107,8 @@ func (r *alertRepoSQLite) ListUnread(ctx context.Context, orgID uuid.UUID, limit
 	return r.scanAlerts(rows)
 }
 
-func (r *alertRepoSQLite) List(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.Alert, error) {
-	rows, err := r.db.QueryContext(ctx, `
+func (r *alertRepo) List(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.Alert, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT id, organization_id, item_id, type, severity,
 		       title, message, is_read, created_at
 		FROM alerts
@@ -117,22 +124,38 @@ func (r *alertRepoSQLite) List(ctx context.Context, orgID uuid.UUID, limit, offs
 	return r.scanAlerts(rows)
 }
 
-func (r *alertRepoSQLite) MarkAsRead(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE alerts SET is_read = true WHERE id = ?
-	`, id.String())
+func (r *alertRepo) MarkAsRead(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE alerts SET is_read = true
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
 	return err
 }
 
-func (r *alertRepoSQLite) DeleteByItemID(ctx context.Context, itemID uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, `
-		DELETE FROM alerts WHERE item_id = ?
-	`, itemID.String())
+func (r *alertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID, types ...domain.AlertType) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM alerts WHERE item_id = ? AND organization_id = COALESCE(?, organization_id)`
+	args := []interface{}{itemID.String(), org}
+	if len(types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, query, args...)
 	return err
 }
 
 // scanAlerts is a helper function to scan multiple alert rows
-func (r *alertRepoSQLite) scanAlerts(rows *sql.Rows) ([]*domain.Alert, error) {
+func (r *alertRepo) scanAlerts(rows *sql.Rows) ([]*domain.Alert, error) {
 	var alerts []*domain.Alert
 	for rows.Next() {
 		var alert domain.Alert
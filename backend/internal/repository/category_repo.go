@@ -7,18 +7,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 )
 
-func NewCategoryRepository(db *sql.DB) CategoryRepository {
-	return &categoryRepoSQLite{db: db}
+func NewCategoryRepository(db *sql.DB, dialect database.Dialect) CategoryRepository {
+	return &categoryRepo{db: db, dialect: dialect}
 }
 
-type categoryRepoSQLite struct {
-	db *sql.DB
+type categoryRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
 }
 
-func (r *categoryRepoSQLite) Create(ctx context.Context, category *domain.Category) (uuid.UUID, error) {
+func (r *categoryRepo) Create(ctx context.Context, category *domain.Category) (uuid.UUID, error) {
 	if category == nil {
 		return uuid.Nil, errors.New("category is nil")
 	}
@@ -30,7 +32,7 @@ func (r *categoryRepoSQLite) Create(ctx context.Context, category *domain.Catego
 	category.CreatedAt = now
 	category.UpdatedAt = now
 
-	_, err := r.db.ExecContext(ctx, `
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
 		INSERT INTO categories (
 			id, organization_id, name, description, color,
 			created_at, updated_at
@@ -46,12 +48,16 @@ func (r *categoryRepoSQLite) Create(ctx context.Context, category *domain.Catego
 	return category.ID, nil
 }
 
-func (r *categoryRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.Category, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *categoryRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Category, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
 		SELECT id, organization_id, name, description, color,
 		       created_at, updated_at
-		FROM categories WHERE id = ?
-	`, id.String())
+		FROM categories WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
 
 	var cat domain.Category
 	var (
@@ -81,8 +87,8 @@ func (r *categoryRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain
 	return &cat, nil
 }
 
-func (r *categoryRepoSQLite) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Category, error) {
-	rows, err := r.db.QueryContext(ctx, `
+func (r *categoryRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Category, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT id, organization_id, name, description, color,
 		       created_at, updated_at
 		FROM categories
@@ -123,22 +129,30 @@ func (r *categoryRepoSQLite) List(ctx context.Context, orgID uuid.UUID) ([]*doma
 	return categories, rows.Err()
 }
 
-func (r *categoryRepoSQLite) Update(ctx context.Context, category *domain.Category) error {
+func (r *categoryRepo) Update(ctx context.Context, category *domain.Category) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
 	category.UpdatedAt = time.Now().UTC()
-	_, err := r.db.ExecContext(ctx, `
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
 		UPDATE categories SET
 			name = ?, description = ?, color = ?, updated_at = ?
-		WHERE id = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
 	`,
 		category.Name, category.Description, category.Color,
-		category.UpdatedAt, category.ID.String(),
+		category.UpdatedAt, category.ID.String(), org,
 	)
 	return err
 }
 
-func (r *categoryRepoSQLite) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, `
-		DELETE FROM categories WHERE id = ?
-	`, id.String())
+func (r *categoryRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM categories WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
 	return err
 }
@@ -0,0 +1,2058 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/migrations"
+)
+
+// The contract suite runs the same repository expectations against every
+// supported dialect. SQLite always runs in memory; Postgres runs when
+// TEST_POSTGRES_DSN points at a disposable database, since the suite drops
+// and recreates the schema, or against an embedded server with the
+// embeddedpg build tag. CI provides the database, so there the Postgres half
+// must not be skipped.
+
+type contractEnv struct {
+	db          *sql.DB
+	dialect     database.Dialect
+	items       repository.ItemRepository
+	categories  repository.CategoryRepository
+	movements   repository.MovementRepository
+	alerts      repository.AlertRepository
+	users       repository.UserRepository
+	idempotency repository.IdempotencyRepository
+	locations   repository.LocationRepository
+	stockLevels repository.StockLevelRepository
+	lots        repository.StockLotRepository
+	recipes     repository.RecipeRepository
+	posMappings repository.POSMappingRepository
+	posImports  repository.POSImportRepository
+	units       repository.UnitRepository
+	suppliers   repository.SupplierRepository
+	orders      repository.PurchaseOrderRepository
+	reorder     repository.ReorderRepository
+	stockCounts repository.StockCountRepository
+	reasons     repository.MovementReasonRepository
+	reports     repository.ReportRepository
+	costing     repository.CostingRepository
+	ledger      repository.LedgerRepository
+	permissions repository.PermissionRepository
+	orgs        repository.OrganizationRepository
+}
+
+func TestRepositoryContract(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect database.Dialect
+		open    func(t *testing.T) *sql.DB
+	}{
+		{"sqlite", database.DialectSQLite, openContractSQLite},
+		{"postgres", database.DialectPostgres, openContractPostgres},
+	}
+
+	suite := []struct {
+		name string
+		run  func(t *testing.T, env *contractEnv)
+	}{
+		{"items", contractItems},
+		{"categories", contractCategories},
+		{"movements", contractMovements},
+		{"alerts", contractAlerts},
+		{"users", contractUsers},
+		{"transactions", contractTransactions},
+		{"idempotency", contractIdempotency},
+		{"locations", contractLocations},
+		{"lots", contractLots},
+		{"recipes", contractRecipes},
+		{"pos", contractPOS},
+		{"units", contractUnits},
+		{"purchasing", contractPurchasing},
+		{"reorder", contractReorder},
+		{"stock counts", contractStockCounts},
+		{"movement reasons", contractMovementReasons},
+		{"movement reversals", contractMovementReversals},
+		{"cost layers", contractCostLayers},
+		{"stock snapshots", contractStockSnapshots},
+		{"ledger", contractLedger},
+		{"permissions", contractPermissions},
+		{"organizations", contractOrganizations},
+		{"tenant isolation", contractTenantIsolation},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, s := range suite {
+				t.Run(s.name, func(t *testing.T) {
+					db := tc.open(t)
+					applyMigrations(t, db, tc.dialect)
+					s.run(t, &contractEnv{
+						db:          db,
+						dialect:     tc.dialect,
+						items:       repository.NewItemRepository(db, tc.dialect),
+						categories:  repository.NewCategoryRepository(db, tc.dialect),
+						movements:   repository.NewMovementRepository(db, tc.dialect),
+						alerts:      repository.NewAlertRepository(db, tc.dialect),
+						users:       repository.NewUserRepository(db, tc.dialect),
+						idempotency: repository.NewIdempotencyRepository(db, tc.dialect),
+						locations:   repository.NewLocationRepository(db, tc.dialect),
+						stockLevels: repository.NewStockLevelRepository(db, tc.dialect),
+						lots:        repository.NewStockLotRepository(db, tc.dialect),
+						recipes:     repository.NewRecipeRepository(db, tc.dialect),
+						posMappings: repository.NewPOSMappingRepository(db, tc.dialect),
+						posImports:  repository.NewPOSImportRepository(db, tc.dialect),
+						units:       repository.NewUnitRepository(db, tc.dialect),
+						suppliers:   repository.NewSupplierRepository(db, tc.dialect),
+						orders:      repository.NewPurchaseOrderRepository(db, tc.dialect),
+						reorder:     repository.NewReorderRepository(db, tc.dialect),
+						stockCounts: repository.NewStockCountRepository(db, tc.dialect),
+						reasons:     repository.NewMovementReasonRepository(db, tc.dialect),
+						reports:     repository.NewReportRepository(db, tc.dialect),
+						costing:     repository.NewCostingRepository(db, tc.dialect),
+						ledger:      repository.NewLedgerRepository(db, tc.dialect),
+						permissions: repository.NewPermissionRepository(db, tc.dialect),
+						orgs:        repository.NewOrganizationRepository(db, tc.dialect),
+					})
+				})
+			}
+		})
+	}
+}
+
+func openContractSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := "file:contract_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "?mode=memory&cache=shared"
+	db, err := database.New(database.DialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func openContractPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_POSTGRES_DSN must be set in CI")
+		}
+		t.Skip("TEST_POSTGRES_DSN not set; set it or run with -tags embeddedpg")
+	}
+	db, err := database.New(database.DialectPostgres, dsn)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// applyMigrations resets the schema by rolling back every embedded migration
+// and applying them again.
+func applyMigrations(t *testing.T, db *sql.DB, dialect database.Dialect) {
+	t.Helper()
+	ctx := context.Background()
+
+	m, err := database.NewMigrator(db, dialect, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Rollback(ctx, len(m.Migrations())); err != nil {
+		t.Fatalf("rollback migrations: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+}
+
+// seedOrg creates an organization with one category and one user
+func seedOrg(t *testing.T, env *contractEnv) (orgID, categoryID, userID uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	orgID = uuid.New()
+	if _, err := env.db.Exec(env.dialect.Rebind("INSERT INTO organizations (id, name, slug) VALUES (?, ?, ?)"),
+		orgID.String(), "Contract Org", "contract-"+orgID.String()); err != nil {
+		t.Fatalf("insert organization: %v", err)
+	}
+
+	categoryID, err := env.categories.Create(ctx, &domain.Category{OrganizationID: orgID, Name: "Dry Items"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+
+	userID, err = env.users.Create(ctx, &domain.User{
+		OrganizationID: orgID,
+		Email:          "contract-" + orgID.String() + "@example.com",
+		PasswordHash:   "hash",
+		FirstName:      "Contract",
+		LastName:       "User",
+		Role:           domain.RoleUser,
+		IsActive:       true,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return orgID, categoryID, userID
+}
+
+func createContractItem(t *testing.T, env *contractEnv, orgID, categoryID uuid.UUID, name string, threshold, stock int) uuid.UUID {
+	t.Helper()
+	id, err := env.items.Create(context.Background(), &domain.Item{
+		OrganizationID:    orgID,
+		CategoryID:        categoryID,
+		Name:              name,
+		UnitOfMeasurement: "gm",
+		MinimumThreshold:  threshold,
+		CurrentStock:      stock,
+		IsActive:          true,
+		TrackStock:        true,
+	})
+	if err != nil {
+		t.Fatalf("create item %q: %v", name, err)
+	}
+	return id
+}
+
+func contractItems(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+
+	cost := 12.5
+	sku := "SOO-1"
+	id, err := env.items.Create(ctx, &domain.Item{
+		OrganizationID:    orgID,
+		CategoryID:        categoryID,
+		Name:              "Sooji",
+		SKU:               &sku,
+		UnitOfMeasurement: "kg",
+		MinimumThreshold:  2000,
+		CurrentStock:      5000,
+		UnitCost:          &cost,
+		IsActive:          true,
+		TrackStock:        true,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	createContractItem(t, env, orgID, categoryID, "Badi Elaichi", 50, 20)
+	createContractItem(t, env, orgID, categoryID, "Jeera", 100, 300)
+
+	got, err := env.items.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got == nil || got.Name != "Sooji" || got.SKU == nil || *got.SKU != sku {
+		t.Fatalf("unexpected item: %+v", got)
+	}
+	if got.UnitCost == nil || *got.UnitCost != cost {
+		t.Fatalf("expected unit cost %v, got %v", cost, got.UnitCost)
+	}
+	if got.CategoryID != categoryID {
+		t.Fatalf("expected category %s, got %s", categoryID, got.CategoryID)
+	}
+
+	missing, err := env.items.GetByID(ctx, uuid.New())
+	if err != nil || missing != nil {
+		t.Fatalf("expected nil, nil for missing item, got %+v, %v", missing, err)
+	}
+
+	count, err := env.items.CountWithFilters(ctx, orgID, "JEE", nil, false)
+	if err != nil || count != 1 {
+		t.Fatalf("case-insensitive search: expected 1, got %d (%v)", count, err)
+	}
+	low, err := env.items.ListWithFilters(ctx, orgID, "", &categoryID, true, 10, 0)
+	if err != nil || len(low) != 1 || low[0].Name != "Badi Elaichi" {
+		t.Fatalf("low stock filter: got %d items (%v)", len(low), err)
+	}
+	page, err := env.items.List(ctx, orgID, 2, 2)
+	if err != nil || len(page) != 1 {
+		t.Fatalf("list page: expected 1 item, got %d (%v)", len(page), err)
+	}
+
+	got.Name = "Sooji Fine"
+	got.TrackStock = false
+	if err := env.items.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := env.items.UpdateStock(ctx, id, 4000, got.Version); err != nil {
+		t.Fatalf("update stock: %v", err)
+	}
+	got, _ = env.items.GetByID(ctx, id)
+	if got.Name != "Sooji Fine" || got.TrackStock || got.CurrentStock != 4000 {
+		t.Fatalf("update not persisted: %+v", got)
+	}
+
+	other, err := env.categories.Create(ctx, &domain.Category{OrganizationID: orgID, Name: "Packaging"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	if err := env.items.ReassignCategory(ctx, categoryID, other); err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	if n, _ := env.items.CountByCategory(ctx, other); n != 3 {
+		t.Fatalf("expected 3 reassigned items, got %d", n)
+	}
+
+	if err := env.items.Delete(ctx, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if n, _ := env.items.CountWithFilters(ctx, orgID, "", nil, false); n != 2 {
+		t.Fatalf("expected 2 items after delete, got %d", n)
+	}
+}
+
+func contractCategories(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+
+	color := "#8B4513"
+	cat, err := env.categories.GetByID(ctx, categoryID)
+	if err != nil || cat == nil {
+		t.Fatalf("get: %+v, %v", cat, err)
+	}
+	cat.Color = &color
+	if err := env.categories.Update(ctx, cat); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	list, err := env.categories.List(ctx, orgID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list: expected 1 category, got %d (%v)", len(list), err)
+	}
+	if list[0].Color == nil || *list[0].Color != color {
+		t.Fatalf("expected color %s, got %v", color, list[0].Color)
+	}
+	if err := env.categories.Delete(ctx, categoryID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if cat, _ := env.categories.GetByID(ctx, categoryID); cat != nil {
+		t.Fatalf("expected category to be deleted")
+	}
+}
+
+func contractMovements(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Paneer", 2000, 8000)
+
+	ref := "INV-1"
+	for i, qty := range []int{500, 250} {
+		id, err := env.movements.Create(ctx, &domain.StockMovement{
+			ItemID:        itemID,
+			MovementType:  domain.MovementTypeOut,
+			Quantity:      qty,
+			PreviousStock: 8000 - i*500,
+			NewStock:      8000 - i*500 - qty,
+			Reference:     &ref,
+			CreatedBy:     userID,
+		})
+		if err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+		got, err := env.movements.GetByID(ctx, id)
+		if err != nil || got == nil || got.Quantity != qty || got.Reference == nil || *got.Reference != ref {
+			t.Fatalf("get movement: %+v, %v", got, err)
+		}
+	}
+
+	byItem, err := env.movements.ListByItem(ctx, itemID, 10, 0)
+	if err != nil || len(byItem) != 2 {
+		t.Fatalf("list by item: expected 2, got %d (%v)", len(byItem), err)
+	}
+	byOrg, err := env.movements.ListByOrganization(ctx, orgID, 1, 1)
+	if err != nil || len(byOrg) != 1 {
+		t.Fatalf("list by organization: expected 1, got %d (%v)", len(byOrg), err)
+	}
+	recent, err := env.movements.ListRecent(ctx, orgID, 5)
+	if err != nil || len(recent) != 2 {
+		t.Fatalf("list recent: expected 2, got %d (%v)", len(recent), err)
+	}
+	if recent[0].Item == nil || recent[0].Item.Name != "Paneer" {
+		t.Fatalf("expected joined item on recent movement, got %+v", recent[0].Item)
+	}
+}
+
+func contractAlerts(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Cheese", 2000, 5000)
+
+	id, err := env.alerts.Create(ctx, &domain.Alert{
+		OrganizationID: orgID,
+		ItemID:         &itemID,
+		Type:           domain.AlertTypeLowStock,
+		Severity:       domain.AlertSeverityWarning,
+		Title:          "Low Stock: Cheese",
+		Message:        "Item \"Cheese\" is running low",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got, err := env.alerts.GetByID(ctx, id)
+	if err != nil || got == nil || got.ItemID == nil || *got.ItemID != itemID || got.IsRead {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+
+	unread, err := env.alerts.ListUnread(ctx, orgID, 10)
+	if err != nil || len(unread) != 1 {
+		t.Fatalf("list unread: expected 1, got %d (%v)", len(unread), err)
+	}
+	if err := env.alerts.MarkAsRead(ctx, id); err != nil {
+		t.Fatalf("mark as read: %v", err)
+	}
+	if unread, _ := env.alerts.ListUnread(ctx, orgID, 10); len(unread) != 0 {
+		t.Fatalf("expected no unread alerts, got %d", len(unread))
+	}
+	if all, _ := env.alerts.List(ctx, orgID, 10, 0); len(all) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(all))
+	}
+	expiryID, err := env.alerts.Create(ctx, &domain.Alert{
+		OrganizationID: orgID,
+		ItemID:         &itemID,
+		Type:           domain.AlertTypeExpiry,
+		Severity:       domain.AlertSeverityCritical,
+		Title:          "Expired: Cheese",
+		Message:        "Lot 'C-7' of 'Cheese' at Main Store expired",
+	})
+	if err != nil {
+		t.Fatalf("create expiry alert: %v", err)
+	}
+	if err := env.alerts.DeleteByItemID(ctx, itemID, domain.AlertTypeLowStock, domain.AlertTypeOutOfStock); err != nil {
+		t.Fatalf("delete stock alerts by item: %v", err)
+	}
+	if all, _ := env.alerts.List(ctx, orgID, 10, 0); len(all) != 1 || all[0].ID != expiryID {
+		t.Fatalf("expected only the expiry alert to remain, got %+v", all)
+	}
+	if err := env.alerts.DeleteByItemID(ctx, itemID); err != nil {
+		t.Fatalf("delete by item: %v", err)
+	}
+	if all, _ := env.alerts.List(ctx, orgID, 10, 0); len(all) != 0 {
+		t.Fatalf("expected alerts to be deleted, got %d", len(all))
+	}
+}
+
+func contractUsers(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, _, userID := seedOrg(t, env)
+
+	got, err := env.users.GetByEmail(ctx, "contract-"+orgID.String()+"@example.com")
+	if err != nil || got == nil || got.ID != userID {
+		t.Fatalf("get by email: %+v, %v", got, err)
+	}
+	got.Role = domain.RoleManager
+	got.IsActive = false
+	if err := env.users.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	got, err = env.users.GetByID(ctx, userID)
+	if err != nil || got == nil || got.Role != domain.RoleManager || got.IsActive {
+		t.Fatalf("update not persisted: %+v, %v", got, err)
+	}
+	if missing, err := env.users.GetByEmail(ctx, "nobody@example.com"); err != nil || missing != nil {
+		t.Fatalf("expected nil, nil for missing user, got %+v, %v", missing, err)
+	}
+	list, err := env.users.List(ctx, orgID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list: expected 1 user, got %d (%v)", len(list), err)
+	}
+}
+
+func contractIdempotency(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, _, userID := seedOrg(t, env)
+
+	record := &domain.IdempotencyRecord{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Key:            "tablet-1:delivery-42",
+		RequestHash:    "abc123",
+		ResponseStatus: 201,
+		ResponseBody:   []byte(`{"id":"movement"}`),
+		CreatedAt:      time.Now().UTC().Add(-2 * time.Hour),
+	}
+	if err := env.idempotency.Create(ctx, record); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got, err := env.idempotency.Get(ctx, orgID, userID, record.Key)
+	if err != nil || got == nil || got.RequestHash != "abc123" || got.ResponseStatus != 201 || string(got.ResponseBody) != `{"id":"movement"}` {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+	if err := env.idempotency.Create(ctx, record); !errors.Is(err, repository.ErrIdempotencyKeyExists) {
+		t.Fatalf("expected ErrIdempotencyKeyExists on duplicate, got %v", err)
+	}
+	if other, err := env.idempotency.Get(ctx, orgID, uuid.New(), record.Key); err != nil || other != nil {
+		t.Fatalf("expected keys to be scoped per user, got %+v, %v", other, err)
+	}
+
+	n, err := env.idempotency.DeleteCreatedBefore(ctx, time.Now().UTC().Add(-3*time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("purge before record: expected 0, got %d (%v)", n, err)
+	}
+	n, err = env.idempotency.DeleteCreatedBefore(ctx, time.Now().UTC().Add(-time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("purge after record: expected 1, got %d (%v)", n, err)
+	}
+
+	if err := env.idempotency.Create(ctx, record); err != nil {
+		t.Fatalf("re-create: %v", err)
+	}
+	if err := env.idempotency.Delete(ctx, orgID, userID, record.Key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got, err := env.idempotency.Get(ctx, orgID, userID, record.Key); err != nil || got != nil {
+		t.Fatalf("expected nil, nil after delete, got %+v, %v", got, err)
+	}
+}
+
+func contractLocations(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Paneer", 2000, 8000)
+
+	if def, err := env.locations.GetDefault(ctx, orgID); err != nil || def != nil {
+		t.Fatalf("expected no default location for a new organization, got %+v (%v)", def, err)
+	}
+
+	store := &domain.Location{OrganizationID: orgID, Name: "Main Store", IsDefault: true, IsActive: true}
+	if _, err := env.locations.Create(ctx, store); err != nil {
+		t.Fatalf("create default location: %v", err)
+	}
+	cooler := &domain.Location{OrganizationID: orgID, Name: "Cooler", IsActive: true}
+	if _, err := env.locations.Create(ctx, cooler); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+
+	if def, err := env.locations.GetDefault(ctx, orgID); err != nil || def == nil || def.ID != store.ID {
+		t.Fatalf("get default: %+v, %v", def, err)
+	}
+	list, err := env.locations.List(ctx, orgID)
+	if err != nil || len(list) != 2 || list[0].ID != store.ID {
+		t.Fatalf("expected default location listed first, got %+v (%v)", list, err)
+	}
+
+	if err := env.locations.ClearDefault(ctx, orgID); err != nil {
+		t.Fatalf("clear default: %v", err)
+	}
+	cooler.IsDefault = true
+	if err := env.locations.Update(ctx, cooler); err != nil {
+		t.Fatalf("update location: %v", err)
+	}
+	if def, err := env.locations.GetDefault(ctx, orgID); err != nil || def == nil || def.ID != cooler.ID {
+		t.Fatalf("expected cooler to be the default, got %+v (%v)", def, err)
+	}
+
+	if err := env.stockLevels.SetQuantity(ctx, itemID, store.ID, 6000); err != nil {
+		t.Fatalf("set quantity: %v", err)
+	}
+	if err := env.stockLevels.SetQuantity(ctx, itemID, cooler.ID, 2000); err != nil {
+		t.Fatalf("set quantity: %v", err)
+	}
+	threshold := 500
+	if err := env.stockLevels.SetThreshold(ctx, itemID, cooler.ID, &threshold); err != nil {
+		t.Fatalf("set threshold: %v", err)
+	}
+	if err := env.stockLevels.SetQuantity(ctx, itemID, cooler.ID, 1500); err != nil {
+		t.Fatalf("update quantity: %v", err)
+	}
+	level, err := env.stockLevels.Get(ctx, itemID, cooler.ID)
+	if err != nil || level == nil || level.Quantity != 1500 || level.MinimumThreshold == nil || *level.MinimumThreshold != 500 {
+		t.Fatalf("expected quantity 1500 and threshold 500 at cooler, got %+v (%v)", level, err)
+	}
+	levels, err := env.stockLevels.ListByItem(ctx, itemID)
+	if err != nil || len(levels) != 2 || levels[0].LocationName != "Cooler" {
+		t.Fatalf("list by item: %+v, %v", levels, err)
+	}
+
+	movementID, err := env.movements.Create(ctx, &domain.StockMovement{
+		ItemID:        itemID,
+		MovementType:  domain.MovementTypeTransfer,
+		Quantity:      1500,
+		PreviousStock: 8000,
+		NewStock:      8000,
+		LocationID:    &cooler.ID,
+		ToLocationID:  &store.ID,
+		CreatedBy:     userID,
+	})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if used, err := env.locations.HasMovements(ctx, cooler.ID); err != nil || !used {
+		t.Fatalf("expected cooler to have movement history, got %v (%v)", used, err)
+	}
+	transfer, err := env.movements.GetByID(ctx, movementID)
+	if err != nil || transfer == nil || transfer.LocationID == nil || *transfer.LocationID != cooler.ID ||
+		transfer.ToLocationID == nil || *transfer.ToLocationID != store.ID {
+		t.Fatalf("expected transfer locations to round-trip, got %+v (%v)", transfer, err)
+	}
+
+	if err := env.stockLevels.SetQuantity(ctx, itemID, cooler.ID, 0); err != nil {
+		t.Fatalf("empty cooler: %v", err)
+	}
+	if n, err := env.stockLevels.CountStockedAtLocation(ctx, cooler.ID); err != nil || n != 0 {
+		t.Fatalf("expected no stock at cooler, got %d (%v)", n, err)
+	}
+	if n, err := env.stockLevels.CountStockedAtLocation(ctx, store.ID); err != nil || n != 1 {
+		t.Fatalf("expected one item stocked at store, got %d (%v)", n, err)
+	}
+	if err := env.stockLevels.DeleteByLocation(ctx, store.ID); err != nil {
+		t.Fatalf("delete levels by location: %v", err)
+	}
+	if level, err := env.stockLevels.Get(ctx, itemID, store.ID); err != nil || level != nil {
+		t.Fatalf("expected store level to be gone, got %+v (%v)", level, err)
+	}
+}
+
+func contractLots(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Paneer", 2000, 0)
+
+	cooler := &domain.Location{OrganizationID: orgID, Name: "Cooler", IsDefault: true, IsActive: true}
+	if _, err := env.locations.Create(ctx, cooler); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	movementID, err := env.movements.Create(ctx, &domain.StockMovement{
+		ItemID:       itemID,
+		MovementType: domain.MovementTypeIn,
+		Quantity:     3000,
+		NewStock:     3000,
+		LocationID:   &cooler.ID,
+		CreatedBy:    userID,
+	})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	soon, later := now.Add(24*time.Hour), now.Add(5*24*time.Hour)
+	lotNumber := "B-0412"
+	lots := []*domain.StockLot{
+		{ExpiresAt: &later},
+		{ExpiresAt: nil},
+		{ExpiresAt: &soon, LotNumber: &lotNumber},
+	}
+	for _, lot := range lots {
+		lot.ItemID, lot.LocationID, lot.MovementID = itemID, cooler.ID, &movementID
+		lot.ReceivedAt, lot.InitialQuantity, lot.Quantity = now, 1000, 1000
+		if _, err := env.lots.Create(ctx, lot); err != nil {
+			t.Fatalf("create lot: %v", err)
+		}
+	}
+
+	available, err := env.lots.ListAvailable(ctx, itemID, cooler.ID)
+	if err != nil || len(available) != 3 {
+		t.Fatalf("list available: expected 3, got %d (%v)", len(available), err)
+	}
+	if available[0].ID != lots[2].ID || available[1].ID != lots[0].ID || available[2].ID != lots[1].ID {
+		t.Fatalf("expected lots first-expiry-first-out with undated lots last, got %v, %v, %v",
+			available[0].ExpiresAt, available[1].ExpiresAt, available[2].ExpiresAt)
+	}
+	first := available[0]
+	if first.LotNumber == nil || *first.LotNumber != lotNumber || first.ExpiresAt == nil || !first.ExpiresAt.Equal(soon) ||
+		first.MovementID == nil || *first.MovementID != movementID {
+		t.Fatalf("expected lot fields to round-trip, got %+v", first)
+	}
+
+	if err := env.lots.UpdateQuantity(ctx, lots[0].ID, 0); err != nil {
+		t.Fatalf("update quantity: %v", err)
+	}
+	if err := env.lots.RecordMovement(ctx, movementID, lots[0].ID, 1000); err != nil {
+		t.Fatalf("record movement: %v", err)
+	}
+	byItem, err := env.lots.ListByItem(ctx, itemID)
+	if err != nil || len(byItem) != 2 || byItem[0].LocationName != "Cooler" {
+		t.Fatalf("expected 2 lots with stock left at Cooler, got %+v (%v)", byItem, err)
+	}
+
+	expiring, err := env.lots.ListExpiringUnalerted(ctx, now.Add(2*24*time.Hour))
+	if err != nil || len(expiring) != 1 || expiring[0].ID != lots[2].ID {
+		t.Fatalf("expected the lot expiring tomorrow, got %+v (%v)", expiring, err)
+	}
+	if expiring[0].OrganizationID != orgID || expiring[0].ItemName != "Paneer" || expiring[0].LocationName != "Cooler" {
+		t.Fatalf("expected joined fields on expiring lot, got %+v", expiring[0])
+	}
+	if err := env.lots.MarkExpiryAlerted(ctx, lots[2].ID, now); err != nil {
+		t.Fatalf("mark expiry alerted: %v", err)
+	}
+	if expiring, err := env.lots.ListExpiringUnalerted(ctx, now.Add(2*24*time.Hour)); err != nil || len(expiring) != 0 {
+		t.Fatalf("expected no unalerted lots, got %d (%v)", len(expiring), err)
+	}
+}
+
+func contractRecipes(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+	tomatoID := createContractItem(t, env, orgID, categoryID, "Tomato", 0, 0)
+	paneerID := createContractItem(t, env, orgID, categoryID, "Paneer", 0, 0)
+
+	gravy := &domain.Recipe{
+		OrganizationID: orgID, Name: "Makhani Gravy", YieldQuantity: 2000, YieldUnit: "kg", IsActive: true,
+		Components: []*domain.RecipeComponent{{ItemID: &tomatoID, Quantity: 1500, Unit: "kg"}},
+	}
+	if err := repository.RunInTx(ctx, env.db, func(ctx context.Context) error {
+		_, err := env.recipes.Create(ctx, gravy)
+		return err
+	}); err != nil {
+		t.Fatalf("create gravy: %v", err)
+	}
+
+	description := "Served with naan"
+	dish := &domain.Recipe{
+		OrganizationID: orgID, Name: "Paneer Makhani", Description: &description,
+		YieldQuantity: 1, YieldUnit: "pcs", IsActive: true,
+		Components: []*domain.RecipeComponent{
+			{ItemID: &paneerID, Quantity: 150, Unit: "gm"},
+			{SubRecipeID: &gravy.ID, Quantity: 250, Unit: "gm"},
+		},
+	}
+	if _, err := env.recipes.Create(ctx, dish); err != nil {
+		t.Fatalf("create dish: %v", err)
+	}
+
+	got, err := env.recipes.GetByID(ctx, dish.ID)
+	if err != nil || got == nil {
+		t.Fatalf("get dish: %+v, %v", got, err)
+	}
+	if got.Description == nil || *got.Description != description || got.YieldQuantity != 1 || len(got.Components) != 2 {
+		t.Fatalf("expected recipe fields to round-trip, got %+v", got)
+	}
+	sub := got.Components[1]
+	if sub.SubRecipeID == nil || *sub.SubRecipeID != gravy.ID || sub.ItemID != nil || sub.Name != "Makhani Gravy" ||
+		sub.Quantity != 250 || sub.Unit != "gm" || sub.Position != 1 {
+		t.Fatalf("expected sub-recipe component in position 1, got %+v", sub)
+	}
+	if got.Components[0].Name != "Paneer" {
+		t.Fatalf("expected item name on component, got %q", got.Components[0].Name)
+	}
+
+	if byName, err := env.recipes.GetByName(ctx, orgID, "Makhani Gravy"); err != nil || byName == nil || byName.ID != gravy.ID {
+		t.Fatalf("get by name: %+v, %v", byName, err)
+	}
+	if missing, err := env.recipes.GetByName(ctx, orgID, "Dal Makhani"); err != nil || missing != nil {
+		t.Fatalf("expected nil for unknown name, got %+v, %v", missing, err)
+	}
+
+	listed, err := env.recipes.List(ctx, orgID)
+	if err != nil || len(listed) != 2 || listed[0].Name != "Makhani Gravy" || len(listed[1].Components) != 2 {
+		t.Fatalf("expected both recipes with components, got %+v (%v)", listed, err)
+	}
+
+	if used, err := env.recipes.IsSubRecipe(ctx, gravy.ID); err != nil || !used {
+		t.Fatalf("expected gravy to be a sub-recipe, got %v (%v)", used, err)
+	}
+	if used, err := env.items.UsedInRecipes(ctx, paneerID); err != nil || !used {
+		t.Fatalf("expected paneer to be used in a recipe, got %v (%v)", used, err)
+	}
+
+	dish.Components = dish.Components[:1]
+	dish.Components[0].Quantity = 200
+	if err := env.recipes.Update(ctx, dish); err != nil {
+		t.Fatalf("update dish: %v", err)
+	}
+	got, _ = env.recipes.GetByID(ctx, dish.ID)
+	if len(got.Components) != 1 || got.Components[0].Quantity != 200 {
+		t.Fatalf("expected components to be replaced, got %+v", got.Components)
+	}
+	if used, _ := env.recipes.IsSubRecipe(ctx, gravy.ID); used {
+		t.Fatalf("expected gravy to be unused after update")
+	}
+
+	if err := env.recipes.Delete(ctx, dish.ID); err != nil {
+		t.Fatalf("delete dish: %v", err)
+	}
+	if got, err := env.recipes.GetByID(ctx, dish.ID); err != nil || got != nil {
+		t.Fatalf("expected dish to be gone, got %+v, %v", got, err)
+	}
+	if used, _ := env.items.UsedInRecipes(ctx, paneerID); used {
+		t.Fatalf("expected components to be deleted with the recipe")
+	}
+}
+
+func contractPOS(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	otherOrgID, _, _ := seedOrg(t, env)
+	paneerID := createContractItem(t, env, orgID, categoryID, "Paneer", 0, 0)
+
+	var recipeIDs []uuid.UUID
+	for _, name := range []string{"Paneer Tikka", "Paneer Makhani"} {
+		recipe := &domain.Recipe{
+			OrganizationID: orgID, Name: name, YieldQuantity: 1, YieldUnit: "pcs", IsActive: true,
+			Components: []*domain.RecipeComponent{{ItemID: &paneerID, Quantity: 150, Unit: "gm"}},
+		}
+		id, err := env.recipes.Create(ctx, recipe)
+		if err != nil {
+			t.Fatalf("create recipe: %v", err)
+		}
+		recipeIDs = append(recipeIDs, id)
+	}
+
+	mapping := &domain.POSMapping{OrganizationID: orgID, Code: "PT-H", RecipeID: recipeIDs[0], Portions: 0.5}
+	if err := env.posMappings.Upsert(ctx, mapping); err != nil {
+		t.Fatalf("upsert mapping: %v", err)
+	}
+	got, err := env.posMappings.GetByCode(ctx, orgID, "PT-H")
+	if err != nil || got == nil || got.RecipeID != recipeIDs[0] || got.Portions != 0.5 || got.RecipeName != "Paneer Tikka" {
+		t.Fatalf("expected mapping to round-trip with recipe name, got %+v (%v)", got, err)
+	}
+
+	// Mapping the code again replaces the mapping in place
+	if err := env.posMappings.Upsert(ctx, &domain.POSMapping{OrganizationID: orgID, Code: "PT-H", RecipeID: recipeIDs[1], Portions: 1}); err != nil {
+		t.Fatalf("remap code: %v", err)
+	}
+	got, _ = env.posMappings.GetByCode(ctx, orgID, "PT-H")
+	if got == nil || got.ID != mapping.ID || got.RecipeID != recipeIDs[1] || got.Portions != 1 {
+		t.Fatalf("expected remapped code to keep its ID, got %+v", got)
+	}
+	if missing, err := env.posMappings.GetByCode(ctx, otherOrgID, "PT-H"); err != nil || missing != nil {
+		t.Fatalf("expected codes to be per organization, got %+v (%v)", missing, err)
+	}
+
+	if err := env.posMappings.Upsert(ctx, &domain.POSMapping{OrganizationID: orgID, Code: "PM", RecipeID: recipeIDs[1], Portions: 1}); err != nil {
+		t.Fatalf("upsert second mapping: %v", err)
+	}
+	listed, err := env.posMappings.List(ctx, orgID)
+	if err != nil || len(listed) != 2 || listed[0].Code != "PM" {
+		t.Fatalf("expected mappings ordered by code, got %+v (%v)", listed, err)
+	}
+
+	if err := env.posMappings.Delete(ctx, orgID, "PM"); err != nil {
+		t.Fatalf("delete mapping: %v", err)
+	}
+	if err := env.recipes.Delete(ctx, recipeIDs[1]); err != nil {
+		t.Fatalf("delete recipe: %v", err)
+	}
+	if listed, _ := env.posMappings.List(ctx, orgID); len(listed) != 0 {
+		t.Fatalf("expected mappings to go with their recipe, got %+v", listed)
+	}
+
+	if imported, err := env.posImports.MarkBillImported(ctx, orgID, "B-1001", userID); err != nil || !imported {
+		t.Fatalf("expected first import of bill to be recorded, got %v (%v)", imported, err)
+	}
+	if imported, err := env.posImports.MarkBillImported(ctx, orgID, "B-1001", userID); err != nil || imported {
+		t.Fatalf("expected repeat import of bill to be refused, got %v (%v)", imported, err)
+	}
+	if imported, err := env.posImports.MarkBillImported(ctx, otherOrgID, "B-1001", userID); err != nil || !imported {
+		t.Fatalf("expected bill numbers to be per organization, got %v (%v)", imported, err)
+	}
+}
+
+func contractUnits(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+	otherOrgID, _, _ := seedOrg(t, env)
+
+	roll := &domain.Unit{OrganizationID: orgID, Code: "roll", Name: "Roll", BaseUnit: "roll", Factor: 1}
+	if _, err := env.units.Create(ctx, roll); err != nil {
+		t.Fatalf("create unit: %v", err)
+	}
+	dozen := &domain.Unit{OrganizationID: orgID, Code: "dozen", Name: "Dozen", BaseUnit: "pcs", Factor: 12, Precision: 2}
+	if _, err := env.units.Create(ctx, dozen); err != nil {
+		t.Fatalf("create second unit: %v", err)
+	}
+	if _, err := env.units.Create(ctx, &domain.Unit{OrganizationID: orgID, Code: "roll", Name: "Roll", BaseUnit: "roll", Factor: 1}); err == nil {
+		t.Fatal("expected unit codes to be unique per organization")
+	}
+	if _, err := env.units.Create(ctx, &domain.Unit{OrganizationID: otherOrgID, Code: "roll", Name: "Roll", BaseUnit: "roll", Factor: 1}); err != nil {
+		t.Fatalf("expected another organization to reuse the code: %v", err)
+	}
+
+	got, err := env.units.GetByCode(ctx, orgID, "dozen")
+	if err != nil || got == nil || got.ID != dozen.ID || got.Factor != 12 || got.Precision != 2 {
+		t.Fatalf("expected unit to round-trip, got %+v (%v)", got, err)
+	}
+	listed, err := env.units.List(ctx, orgID)
+	if err != nil || len(listed) != 2 || listed[0].Code != "dozen" {
+		t.Fatalf("expected units ordered by code, got %+v (%v)", listed, err)
+	}
+
+	dozen.Name = "Dozen pieces"
+	dozen.Precision = 0
+	if err := env.units.Update(ctx, dozen); err != nil {
+		t.Fatalf("update unit: %v", err)
+	}
+	if got, _ := env.units.GetByID(ctx, dozen.ID); got == nil || got.Name != "Dozen pieces" || got.Precision != 0 {
+		t.Fatalf("expected unit update to persist, got %+v", got)
+	}
+
+	if used, err := env.units.IsInUse(ctx, orgID, "roll"); err != nil || used {
+		t.Fatalf("expected unused unit, got %v (%v)", used, err)
+	}
+	foilID, err := env.items.Create(ctx, &domain.Item{
+		OrganizationID: orgID, CategoryID: categoryID, Name: "Foil", UnitOfMeasurement: "roll", IsActive: true, TrackStock: true,
+	})
+	if err != nil {
+		t.Fatalf("create item in rolls: %v", err)
+	}
+	if used, err := env.units.IsInUse(ctx, orgID, "roll"); err != nil || !used {
+		t.Fatalf("expected unit of an item to be in use, got %v (%v)", used, err)
+	}
+	if used, err := env.units.IsInUse(ctx, otherOrgID, "roll"); err != nil || used {
+		t.Fatalf("expected use to be per organization, got %v (%v)", used, err)
+	}
+
+	// Setting a pack again replaces its quantity
+	pack := &domain.ItemUnitConversion{ItemID: foilID, Unit: "case", Quantity: 12}
+	if err := env.units.SetItemConversion(ctx, pack); err != nil {
+		t.Fatalf("set conversion: %v", err)
+	}
+	if err := env.units.SetItemConversion(ctx, &domain.ItemUnitConversion{ItemID: foilID, Unit: "case", Quantity: 24}); err != nil {
+		t.Fatalf("replace conversion: %v", err)
+	}
+	conversions, err := env.units.ListItemConversions(ctx, foilID)
+	if err != nil || len(conversions) != 1 || conversions[0].Quantity != 24 {
+		t.Fatalf("expected one case of 24, got %+v (%v)", conversions, err)
+	}
+
+	if err := env.units.DeleteItemConversion(ctx, foilID, "case"); err != nil {
+		t.Fatalf("delete conversion: %v", err)
+	}
+	if conversions, _ := env.units.ListItemConversions(ctx, foilID); len(conversions) != 0 {
+		t.Fatalf("expected conversion to be deleted, got %+v", conversions)
+	}
+
+	if err := env.units.Delete(ctx, dozen.ID); err != nil {
+		t.Fatalf("delete unit: %v", err)
+	}
+	if got, err := env.units.GetByID(ctx, dozen.ID); err != nil || got != nil {
+		t.Fatalf("expected deleted unit to be gone, got %+v (%v)", got, err)
+	}
+}
+
+func contractTransactions(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, _ := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Onion", 10000, 25000)
+
+	errBoom := errors.New("boom")
+	err := repository.RunInTx(ctx, env.db, func(ctx context.Context) error {
+		if err := env.items.UpdateStock(ctx, itemID, 1, 1); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected errBoom, got %v", err)
+	}
+	got, _ := env.items.GetByID(ctx, itemID)
+	if got.CurrentStock != 25000 {
+		t.Fatalf("expected rollback to keep stock at 25000, got %d", got.CurrentStock)
+	}
+}
+
+func contractPurchasing(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	otherOrgID, _, _ := seedOrg(t, env)
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 0)
+	oilID := createContractItem(t, env, orgID, categoryID, "Oil", 0, 0)
+
+	terms := "Net 30"
+	supplier := &domain.Supplier{OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 3, PaymentTerms: &terms, IsActive: true}
+	if _, err := env.suppliers.Create(ctx, supplier); err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+	if _, err := env.suppliers.Create(ctx, &domain.Supplier{OrganizationID: orgID, Name: "Metro Wholesale", IsActive: true}); err == nil {
+		t.Fatal("expected supplier names to be unique per organization")
+	}
+	if _, err := env.suppliers.Create(ctx, &domain.Supplier{OrganizationID: otherOrgID, Name: "Metro Wholesale", IsActive: true}); err != nil {
+		t.Fatalf("expected another organization to reuse the name: %v", err)
+	}
+
+	got, err := env.suppliers.GetByName(ctx, orgID, "Metro Wholesale")
+	if err != nil || got == nil || got.ID != supplier.ID || got.LeadTimeDays != 3 || got.PaymentTerms == nil || *got.PaymentTerms != terms || got.Email != nil {
+		t.Fatalf("expected supplier to round-trip, got %+v (%v)", got, err)
+	}
+	supplier.LeadTimeDays = 5
+	supplier.PaymentTerms = nil
+	if err := env.suppliers.Update(ctx, supplier); err != nil {
+		t.Fatalf("update supplier: %v", err)
+	}
+	if got, _ := env.suppliers.GetByID(ctx, supplier.ID); got == nil || got.LeadTimeDays != 5 || got.PaymentTerms != nil {
+		t.Fatalf("expected supplier update to persist, got %+v", got)
+	}
+
+	number, err := env.orders.NextNumber(ctx, orgID)
+	if err != nil || number != 1 {
+		t.Fatalf("expected the first order to be number 1, got %d (%v)", number, err)
+	}
+	expected := time.Now().UTC().Add(72 * time.Hour).Truncate(time.Second)
+	po := &domain.PurchaseOrder{
+		OrganizationID: orgID,
+		SupplierID:     supplier.ID,
+		Number:         number,
+		Status:         domain.PurchaseOrderDraft,
+		ExpectedAt:     &expected,
+		CreatedBy:      userID,
+		Lines: []*domain.PurchaseOrderLine{
+			{ItemID: riceID, Unit: "kg", UnitFactor: 1000, OrderedQuantity: 25000, UnitPrice: 62.5},
+			{ItemID: oilID, Unit: "gm", UnitFactor: 1, OrderedQuantity: 5000, UnitPrice: 0.15},
+		},
+	}
+	if _, err := env.orders.Create(ctx, po); err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	if number, _ := env.orders.NextNumber(ctx, orgID); number != 2 {
+		t.Fatalf("expected numbers to be sequential, got %d", number)
+	}
+	if number, _ := env.orders.NextNumber(ctx, otherOrgID); number != 1 {
+		t.Fatalf("expected numbers to be per organization, got %d", number)
+	}
+	if used, err := env.suppliers.HasPurchaseOrders(ctx, supplier.ID); err != nil || !used {
+		t.Fatalf("expected the supplier to have orders, got %v (%v)", used, err)
+	}
+
+	loaded, err := env.orders.GetByID(ctx, po.ID)
+	if err != nil || loaded == nil || loaded.SupplierName != "Metro Wholesale" || loaded.Status != domain.PurchaseOrderDraft ||
+		loaded.ExpectedAt == nil || !loaded.ExpectedAt.Equal(expected) || len(loaded.Lines) != 2 {
+		t.Fatalf("expected order to round-trip, got %+v (%v)", loaded, err)
+	}
+	rice := loaded.Lines[0]
+	if rice.ItemName != "Rice" || rice.UnitFactor != 1000 || rice.UnitPrice != 62.5 || rice.ShortQuantity != 25000 {
+		t.Fatalf("expected lines in position order with their item, got %+v", rice)
+	}
+
+	// Replacing the lines of a draft
+	po.Lines = po.Lines[:1]
+	po.Lines[0].ID = uuid.Nil
+	if err := env.orders.ReplaceLines(ctx, po); err != nil {
+		t.Fatalf("replace lines: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	po.Status = domain.PurchaseOrderSent
+	po.SentAt = &now
+	if err := env.orders.Update(ctx, po); err != nil {
+		t.Fatalf("update purchase order: %v", err)
+	}
+
+	sent := domain.PurchaseOrderSent
+	listed, err := env.orders.List(ctx, orgID, &sent)
+	if err != nil || len(listed) != 1 || len(listed[0].Lines) != 1 || listed[0].SentAt == nil {
+		t.Fatalf("expected the sent order with one line, got %+v (%v)", listed, err)
+	}
+	draft := domain.PurchaseOrderDraft
+	if listed, _ := env.orders.List(ctx, orgID, &draft); len(listed) != 0 {
+		t.Fatalf("expected no drafts, got %+v", listed)
+	}
+
+	// A receipt of 10 kg of the 25 kg ordered
+	line := po.Lines[0]
+	movementID, err := env.movements.Create(ctx, &domain.StockMovement{
+		ItemID:       riceID,
+		MovementType: domain.MovementTypeIn,
+		Quantity:     10000,
+		NewStock:     10000,
+		CreatedBy:    userID,
+	})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	if err := env.orders.SetReceivedQuantity(ctx, line.ID, 10000); err != nil {
+		t.Fatalf("set received quantity: %v", err)
+	}
+	receipt := &domain.GoodsReceipt{
+		PurchaseOrderID: po.ID,
+		ReceivedBy:      userID,
+		ReceivedAt:      now,
+		Lines:           []*domain.GoodsReceiptLine{{LineID: line.ID, MovementID: movementID, Quantity: 10000, UnitPrice: 60}},
+	}
+	if _, err := env.orders.CreateReceipt(ctx, receipt); err != nil {
+		t.Fatalf("create receipt: %v", err)
+	}
+
+	receipts, err := env.orders.ListReceipts(ctx, po.ID)
+	if err != nil || len(receipts) != 1 || len(receipts[0].Lines) != 1 || receipts[0].Lines[0].MovementID != movementID || receipts[0].Lines[0].UnitPrice != 60 {
+		t.Fatalf("expected the receipt with its line, got %+v (%v)", receipts, err)
+	}
+	loaded, _ = env.orders.GetByID(ctx, po.ID)
+	if loaded == nil || loaded.Lines[0].ReceivedQuantity != 10000 || loaded.Lines[0].ShortQuantity != 15000 {
+		t.Fatalf("expected 15 kg still short, got %+v", loaded)
+	}
+
+	if err := env.orders.Delete(ctx, po.ID); err != nil {
+		t.Fatalf("delete purchase order: %v", err)
+	}
+	if got, err := env.orders.GetByID(ctx, po.ID); err != nil || got != nil {
+		t.Fatalf("expected deleted order to be gone, got %+v (%v)", got, err)
+	}
+	if receipts, _ := env.orders.ListReceipts(ctx, po.ID); len(receipts) != 0 {
+		t.Fatalf("expected receipts to go with the order, got %+v", receipts)
+	}
+	if err := env.suppliers.Delete(ctx, supplier.ID); err != nil {
+		t.Fatalf("delete supplier: %v", err)
+	}
+}
+
+func contractReorder(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	otherOrgID, otherCategoryID, _ := seedOrg(t, env)
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 500, 2000)
+	oilID := createContractItem(t, env, orgID, categoryID, "Oil", 0, 0)
+	createContractItem(t, env, otherOrgID, otherCategoryID, "Flour", 0, 0)
+
+	supplier := &domain.Supplier{OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 3, IsActive: true}
+	if _, err := env.suppliers.Create(ctx, supplier); err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+
+	rice, err := env.items.GetByID(ctx, riceID)
+	if err != nil || rice == nil || rice.ParLevel != nil || rice.PreferredSupplierID != nil {
+		t.Fatalf("expected rice without reorder settings, got %+v (%v)", rice, err)
+	}
+	par, leadTime := 10000, 2
+	rice.ParLevel = &par
+	rice.LeadTimeDays = &leadTime
+	rice.PreferredSupplierID = &supplier.ID
+	if err := env.items.Update(ctx, rice); err != nil {
+		t.Fatalf("update rice: %v", err)
+	}
+	rice, _ = env.items.GetByID(ctx, riceID)
+	if rice == nil || rice.ParLevel == nil || *rice.ParLevel != par || rice.LeadTimeDays == nil || *rice.LeadTimeDays != leadTime ||
+		rice.PreferredSupplierID == nil || *rice.PreferredSupplierID != supplier.ID {
+		t.Fatalf("expected reorder settings to round-trip, got %+v", rice)
+	}
+
+	// Untracked items are never reordered
+	oil, _ := env.items.GetByID(ctx, oilID)
+	oil.TrackStock = false
+	if err := env.items.Update(ctx, oil); err != nil {
+		t.Fatalf("update oil: %v", err)
+	}
+
+	for _, m := range []struct {
+		movementType domain.MovementType
+		quantity     int
+	}{{domain.MovementTypeOut, 300}, {domain.MovementTypeOut, 200}, {domain.MovementTypeIn, 1000}} {
+		if _, err := env.movements.Create(ctx, &domain.StockMovement{
+			ItemID: riceID, MovementType: m.movementType, Quantity: m.quantity, CreatedBy: userID,
+		}); err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+	}
+
+	po := &domain.PurchaseOrder{
+		OrganizationID: orgID,
+		SupplierID:     supplier.ID,
+		Number:         1,
+		Status:         domain.PurchaseOrderDraft,
+		CreatedBy:      userID,
+		Lines:          []*domain.PurchaseOrderLine{{ItemID: riceID, Unit: "gm", UnitFactor: 1, OrderedQuantity: 5000}},
+	}
+	if _, err := env.orders.Create(ctx, po); err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	if err := env.orders.SetReceivedQuantity(ctx, po.Lines[0].ID, 1000); err != nil {
+		t.Fatalf("set received quantity: %v", err)
+	}
+
+	since := time.Now().UTC().Add(-time.Hour)
+	candidates, err := env.reorder.ListCandidates(ctx, &orgID, since)
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("expected only rice to be a candidate, got %+v (%v)", candidates, err)
+	}
+	c := candidates[0]
+	if c.ItemID != riceID || c.OrganizationID != orgID || c.CurrentStock != 2000 || c.MinimumThreshold != 500 ||
+		c.ParLevel == nil || *c.ParLevel != par || c.LeadTimeDays == nil || *c.LeadTimeDays != leadTime {
+		t.Fatalf("expected rice with its settings, got %+v", c)
+	}
+	if c.SupplierID == nil || *c.SupplierID != supplier.ID || c.SupplierName == nil || *c.SupplierName != "Metro Wholesale" ||
+		c.SupplierLeadTimeDays == nil || *c.SupplierLeadTimeDays != 3 {
+		t.Fatalf("expected the preferred supplier to be joined, got %+v", c)
+	}
+	if c.Consumed != 500 || c.OnOrder != 4000 || c.ReorderAlertedAt != nil {
+		t.Fatalf("expected 500 consumed and 4000 on order, got %d and %d", c.Consumed, c.OnOrder)
+	}
+
+	if candidates, _ := env.reorder.ListCandidates(ctx, &orgID, time.Now().UTC().Add(time.Hour)); len(candidates) != 1 || candidates[0].Consumed != 0 {
+		t.Fatalf("expected no consumption after the window start, got %+v", candidates)
+	}
+	all, err := env.reorder.ListCandidates(ctx, nil, since)
+	if err != nil {
+		t.Fatalf("list candidates of every organization: %v", err)
+	}
+	organizations := make(map[uuid.UUID]bool)
+	for _, c := range all {
+		organizations[c.OrganizationID] = true
+	}
+	if !organizations[orgID] || !organizations[otherOrgID] {
+		t.Fatalf("expected candidates of every organization, got %+v", all)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := env.reorder.MarkAlerted(ctx, riceID, &now); err != nil {
+		t.Fatalf("mark alerted: %v", err)
+	}
+	if candidates, _ := env.reorder.ListCandidates(ctx, &orgID, since); candidates[0].ReorderAlertedAt == nil {
+		t.Fatal("expected the alert mark to be stored")
+	}
+	if err := env.reorder.MarkAlerted(ctx, riceID, nil); err != nil {
+		t.Fatalf("clear alert mark: %v", err)
+	}
+	if candidates, _ := env.reorder.ListCandidates(ctx, &orgID, since); candidates[0].ReorderAlertedAt != nil {
+		t.Fatal("expected the alert mark to be cleared")
+	}
+
+	// Deleting the supplier leaves the item without a preferred supplier
+	if err := env.orders.Delete(ctx, po.ID); err != nil {
+		t.Fatalf("delete purchase order: %v", err)
+	}
+	if err := env.suppliers.Delete(ctx, supplier.ID); err != nil {
+		t.Fatalf("delete supplier: %v", err)
+	}
+	if rice, _ := env.items.GetByID(ctx, riceID); rice == nil || rice.PreferredSupplierID != nil {
+		t.Fatalf("expected the preferred supplier to be cleared, got %+v", rice)
+	}
+}
+
+func contractStockCounts(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 2000)
+	oilID := createContractItem(t, env, orgID, categoryID, "Oil", 0, 500)
+
+	store := &domain.Location{OrganizationID: orgID, Name: "Dry Store", IsActive: true}
+	if _, err := env.locations.Create(ctx, store); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+
+	cost := 0.06
+	count := &domain.StockCount{
+		OrganizationID: orgID,
+		LocationID:     store.ID,
+		CategoryID:     &categoryID,
+		Status:         domain.StockCountOpen,
+		CreatedBy:      userID,
+		Lines: []*domain.StockCountLine{
+			{ItemID: oilID, ExpectedQuantity: 500},
+			{ItemID: riceID, ExpectedQuantity: 2000, UnitCost: &cost},
+		},
+	}
+	if _, err := env.stockCounts.Create(ctx, count); err != nil {
+		t.Fatalf("create stock count: %v", err)
+	}
+
+	got, err := env.stockCounts.GetByID(ctx, count.ID)
+	if err != nil || got == nil {
+		t.Fatalf("get stock count: %v", err)
+	}
+	if got.LocationName != "Dry Store" || got.CategoryName == nil || *got.CategoryName != "Dry Items" || got.Status != domain.StockCountOpen {
+		t.Fatalf("expected the location and category to be joined, got %+v", got)
+	}
+	if len(got.Lines) != 2 || got.Lines[0].ItemName != "Oil" || got.Lines[1].Unit != "gm" || got.Lines[1].UnitCost == nil || *got.Lines[1].UnitCost != cost {
+		t.Fatalf("expected the lines in position order with their items, got %+v", got.Lines)
+	}
+	if got.Lines[0].CountedQuantity != nil || got.Lines[0].MovementID != nil {
+		t.Fatalf("expected the lines to start uncounted, got %+v", got.Lines[0])
+	}
+
+	counted := 1800
+	countedAt := time.Now().UTC().Truncate(time.Second)
+	line := got.Lines[1]
+	line.CountedQuantity = &counted
+	line.CountedBy = &userID
+	line.CountedAt = &countedAt
+	if err := env.stockCounts.SetCounted(ctx, line); err != nil {
+		t.Fatalf("set counted: %v", err)
+	}
+
+	movementID, err := env.movements.Create(ctx, &domain.StockMovement{
+		ItemID: riceID, MovementType: domain.MovementTypeAdjustment, Quantity: 1800, CreatedBy: userID,
+	})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	if err := env.stockCounts.SetMovement(ctx, line.ID, movementID); err != nil {
+		t.Fatalf("set movement: %v", err)
+	}
+
+	approvedAt := time.Now().UTC().Truncate(time.Second)
+	got.Status = domain.StockCountApproved
+	got.ApprovedBy = &userID
+	got.ApprovedAt = &approvedAt
+	if err := env.stockCounts.Update(ctx, got); err != nil {
+		t.Fatalf("update stock count: %v", err)
+	}
+
+	status := domain.StockCountApproved
+	counts, err := env.stockCounts.List(ctx, orgID, &status)
+	if err != nil || len(counts) != 1 {
+		t.Fatalf("expected one approved count, got %d (%v)", len(counts), err)
+	}
+	approved := counts[0]
+	if approved.ApprovedBy == nil || *approved.ApprovedBy != userID || approved.ApprovedAt == nil {
+		t.Fatalf("expected the approval to be stored, got %+v", approved)
+	}
+	rice := approved.Lines[1]
+	if rice.CountedQuantity == nil || *rice.CountedQuantity != 1800 || rice.CountedBy == nil || *rice.CountedBy != userID ||
+		rice.CountedAt == nil || rice.MovementID == nil || *rice.MovementID != movementID {
+		t.Fatalf("expected the count and its movement to be stored, got %+v", rice)
+	}
+
+	open := domain.StockCountOpen
+	if counts, _ := env.stockCounts.List(ctx, orgID, &open); len(counts) != 0 {
+		t.Fatalf("expected no open counts, got %d", len(counts))
+	}
+	if missing, err := env.stockCounts.GetByID(ctx, uuid.New()); err != nil || missing != nil {
+		t.Fatalf("expected nil for an unknown count, got %+v (%v)", missing, err)
+	}
+}
+
+func contractMovementReasons(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 5000)
+
+	spoiled := &domain.MovementReason{OrganizationID: orgID, Code: "WASTE_SPOILED", Name: "Spoiled", IsWaste: true, IsActive: true}
+	if created, err := env.reasons.Create(ctx, spoiled); err != nil || !created {
+		t.Fatalf("create reason: %v", err)
+	}
+	meal := &domain.MovementReason{OrganizationID: orgID, Code: "STAFF_MEAL", Name: "Staff meal", IsActive: true}
+	if created, err := env.reasons.Create(ctx, meal); err != nil || !created {
+		t.Fatalf("create reason: %v", err)
+	}
+	duplicate := &domain.MovementReason{OrganizationID: orgID, Code: "WASTE_SPOILED", Name: "Gone off", IsActive: true}
+	if created, err := env.reasons.Create(ctx, duplicate); err != nil || created {
+		t.Fatalf("expected a taken code to be skipped, got %v (%v)", created, err)
+	}
+
+	meal.Name = "Staff meals"
+	meal.IsActive = false
+	if err := env.reasons.Update(ctx, meal); err != nil {
+		t.Fatalf("update reason: %v", err)
+	}
+	reasons, err := env.reasons.List(ctx, orgID)
+	if err != nil || len(reasons) != 2 {
+		t.Fatalf("expected two reasons, got %d (%v)", len(reasons), err)
+	}
+	if reasons[0].Code != "STAFF_MEAL" || reasons[0].Name != "Staff meals" || reasons[0].IsActive || reasons[0].IsWaste {
+		t.Fatalf("expected the renamed, inactive staff meal first, got %+v", reasons[0])
+	}
+	if got, err := env.reasons.GetByID(ctx, spoiled.ID); err != nil || got == nil || got.Name != "Spoiled" || !got.IsWaste {
+		t.Fatalf("expected the spoiled reason, got %+v (%v)", got, err)
+	}
+
+	day := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	for _, mv := range []*domain.StockMovement{
+		{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 200, ReasonCode: &spoiled.Code, CreatedAt: day},
+		{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 300, ReasonCode: &spoiled.Code, CreatedAt: day.Add(time.Hour)},
+		{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 1000, CreatedAt: day},
+		{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 50, ReasonCode: &meal.Code, CreatedAt: day.AddDate(0, 0, 1)},
+		{ItemID: riceID, MovementType: domain.MovementTypeIn, Quantity: 4000, CreatedAt: day},
+		{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 700, CreatedAt: day.AddDate(0, 0, 2)},
+	} {
+		mv.CreatedBy = userID
+		if _, err := env.movements.Create(ctx, mv); err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+	}
+
+	movements, err := env.movements.ListByItem(ctx, riceID, 10, 0)
+	if err != nil {
+		t.Fatalf("list movements: %v", err)
+	}
+	recorded := 0
+	for _, mv := range movements {
+		if mv.ReasonCode != nil {
+			recorded++
+		}
+	}
+	if recorded != 3 {
+		t.Fatalf("expected three movements with a reason, got %d", recorded)
+	}
+
+	outflows, err := env.reports.ListOutflows(ctx, orgID, day.Truncate(24*time.Hour), day.Truncate(24*time.Hour).AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("list outflows: %v", err)
+	}
+	if len(outflows) != 3 {
+		t.Fatalf("expected spoiled and used rice on the 9th and a staff meal on the 10th, got %d", len(outflows))
+	}
+	totals := make(map[string]int)
+	for _, o := range outflows {
+		if o.ItemID != riceID || o.ItemName != "Rice" || o.UnitOfMeasurement != "gm" {
+			t.Fatalf("expected rice, got %+v", o)
+		}
+		key := o.Day
+		if o.ReasonCode != nil {
+			key += " " + *o.ReasonCode
+		}
+		totals[key] = o.Quantity
+	}
+	if totals["2026-03-09 WASTE_SPOILED"] != 500 || totals["2026-03-09"] != 1000 || totals["2026-03-10 STAFF_MEAL"] != 50 {
+		t.Fatalf("expected OUT totals by day and reason, got %v", totals)
+	}
+}
+
+func contractMovementReversals(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+	itemID := createContractItem(t, env, orgID, categoryID, "Paneer", 0, 1000)
+
+	store := &domain.Location{OrganizationID: orgID, Name: "Store", IsDefault: true, IsActive: true}
+	if _, err := env.locations.Create(ctx, store); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+
+	day := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	create := func(mv *domain.StockMovement) uuid.UUID {
+		t.Helper()
+		mv.ItemID, mv.LocationID, mv.CreatedBy = itemID, &store.ID, userID
+		id, err := env.movements.Create(ctx, mv)
+		if err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+		return id
+	}
+
+	inID := create(&domain.StockMovement{MovementType: domain.MovementTypeIn, Quantity: 1000, NewStock: 1000, CreatedAt: day})
+	lot := &domain.StockLot{ItemID: itemID, LocationID: store.ID, MovementID: &inID, ReceivedAt: day, InitialQuantity: 1000, Quantity: 600}
+	if _, err := env.lots.Create(ctx, lot); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+	outID := create(&domain.StockMovement{MovementType: domain.MovementTypeOut, Quantity: 400, PreviousStock: 1000, NewStock: 600, CreatedAt: day})
+	if err := env.lots.RecordMovement(ctx, outID, lot.ID, 400); err != nil {
+		t.Fatalf("record movement: %v", err)
+	}
+	usedID := create(&domain.StockMovement{MovementType: domain.MovementTypeOut, Quantity: 100, PreviousStock: 600, NewStock: 500, CreatedAt: day})
+
+	taken, err := env.lots.ListMovementLots(ctx, outID)
+	if err != nil || len(taken) != 1 || taken[0].LotID != lot.ID || taken[0].Quantity != 400 {
+		t.Fatalf("expected the OUT to have taken 400 from the lot, got %+v (%v)", taken, err)
+	}
+
+	reversalID := create(&domain.StockMovement{MovementType: domain.MovementTypeIn, Quantity: 400, PreviousStock: 500, NewStock: 900, ReversalOf: &outID, CreatedAt: day})
+	if err := env.lots.AddQuantity(ctx, lot.ID, 400); err != nil {
+		t.Fatalf("add quantity: %v", err)
+	}
+	if voided, err := env.movements.Void(ctx, outID, userID, day); err != nil || !voided {
+		t.Fatalf("expected the OUT to be voided, got %v (%v)", voided, err)
+	}
+	if voided, err := env.movements.Void(ctx, outID, userID, day); err != nil || voided {
+		t.Fatalf("expected a voided movement not to be voided again, got %v (%v)", voided, err)
+	}
+	if _, err := env.movements.Create(ctx, &domain.StockMovement{
+		ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 400, ReversalOf: &outID, CreatedBy: userID,
+	}); err == nil {
+		t.Fatalf("expected a second reversal of the same movement to be rejected")
+	}
+
+	original, err := env.movements.GetByID(ctx, outID)
+	if err != nil || original.VoidedAt == nil || original.VoidedBy == nil || *original.VoidedBy != userID || original.ReversalOf != nil {
+		t.Fatalf("expected the OUT to be voided by the user, got %+v (%v)", original, err)
+	}
+	movements, err := env.movements.ListByItem(ctx, itemID, 10, 0)
+	if err != nil {
+		t.Fatalf("list movements: %v", err)
+	}
+	for _, mv := range movements {
+		if mv.ID == reversalID && (mv.ReversalOf == nil || *mv.ReversalOf != outID || mv.VoidedAt != nil) {
+			t.Fatalf("expected the reversal to point at the OUT, got %+v", mv)
+		}
+	}
+	available, err := env.lots.ListAvailable(ctx, itemID, store.ID)
+	if err != nil || len(available) != 1 || available[0].Quantity != 1000 {
+		t.Fatalf("expected the lot to be back at 1000, got %+v (%v)", available, err)
+	}
+
+	// Only the OUT that was not reversed counts as usage
+	outflows, err := env.reports.ListOutflows(ctx, orgID, day.Truncate(24*time.Hour), day.Truncate(24*time.Hour).AddDate(0, 0, 1))
+	if err != nil || len(outflows) != 1 || outflows[0].Quantity != 100 {
+		t.Fatalf("expected only movement %s in the outflows, got %+v (%v)", usedID, outflows, err)
+	}
+}
+
+func contractCostLayers(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+
+	method, err := env.costing.GetMethod(ctx, orgID)
+	if err != nil || method != domain.CostingFIFO {
+		t.Fatalf("expected organizations to cost FIFO, got %q (%v)", method, err)
+	}
+	if err := env.costing.SetMethod(ctx, orgID, domain.CostingWeightedAverage); err != nil {
+		t.Fatalf("set method: %v", err)
+	}
+	if method, err := env.costing.GetMethod(ctx, orgID); err != nil || method != domain.CostingWeightedAverage {
+		t.Fatalf("expected WEIGHTED_AVERAGE, got %q (%v)", method, err)
+	}
+	if method, err := env.costing.GetMethod(ctx, uuid.New()); err != nil || method != "" {
+		t.Fatalf("expected no method for an unknown organization, got %q (%v)", method, err)
+	}
+
+	// 1000 g of rice from before costing at 0.05, 2000 g bought for 120 on the
+	// day and 1000 g used for 50 the day after
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 2000)
+	createContractItem(t, env, orgID, categoryID, "Salt", 0, 0)
+	day := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	create := func(mv *domain.StockMovement) *domain.StockMovement {
+		t.Helper()
+		mv.ItemID, mv.CreatedBy = riceID, userID
+		if _, err := env.movements.Create(ctx, mv); err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+		return mv
+	}
+	inCost, outCost := 120.0, 50.0
+	in := create(&domain.StockMovement{MovementType: domain.MovementTypeIn, Quantity: 2000, PreviousStock: 1000, NewStock: 3000, TotalCost: &inCost, CreatedAt: day})
+	create(&domain.StockMovement{MovementType: domain.MovementTypeOut, Quantity: 1000, PreviousStock: 3000, NewStock: 2000, TotalCost: &outCost, CreatedAt: day.AddDate(0, 0, 1)})
+
+	got, err := env.movements.GetByID(ctx, in.ID)
+	if err != nil || got.TotalCost == nil || *got.TotalCost != 120 {
+		t.Fatalf("expected the IN to cost 120, got %+v (%v)", got, err)
+	}
+
+	opening := &domain.CostLayer{ItemID: riceID, ReceivedAt: day.AddDate(0, 0, -1), UnitCost: 0.05, InitialQuantity: 1000, Quantity: 1000}
+	bought := &domain.CostLayer{ItemID: riceID, MovementID: &in.ID, ReceivedAt: day, UnitCost: 0.06, InitialQuantity: 2000, Quantity: 2000}
+	for _, layer := range []*domain.CostLayer{bought, opening} {
+		if _, err := env.costing.CreateLayer(ctx, layer); err != nil {
+			t.Fatalf("create layer: %v", err)
+		}
+	}
+	layers, err := env.costing.ListOpenLayers(ctx, riceID)
+	if err != nil || len(layers) != 2 || layers[0].ID != opening.ID || layers[0].MovementID != nil || *layers[1].MovementID != in.ID {
+		t.Fatalf("expected the opening layer before the bought one, got %+v (%v)", layers, err)
+	}
+
+	opening.Quantity = 0
+	if err := env.costing.UpdateLayer(ctx, opening); err != nil {
+		t.Fatalf("update layer: %v", err)
+	}
+	layers, err = env.costing.ListOpenLayers(ctx, riceID)
+	if err != nil || len(layers) != 1 || layers[0].ID != bought.ID || layers[0].Quantity != 2000 || layers[0].UnitCost != 0.06 {
+		t.Fatalf("expected only the bought layer to be open, got %+v (%v)", layers, err)
+	}
+
+	rows, err := env.reports.ListValuation(ctx, orgID, nil, day.Add(-time.Hour))
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected rice and salt, got %d rows (%v)", len(rows), err)
+	}
+	rice := rows[0]
+	if rice.ItemID != riceID || rice.CurrentStock != 2000 || rice.LayerQuantity != 2000 || math.Abs(rice.LayerValue-120) > 1e-9 {
+		t.Errorf("expected 2000 g of rice in layers worth 120, got %+v", rice)
+	}
+	if rice.MovedStock != 1000 || math.Abs(rice.MovedCost-70) > 1e-9 || rice.MovedUncosted != 0 {
+		t.Errorf("expected 1000 g worth 70 to have moved since, got %+v", rice)
+	}
+	if salt := rows[1]; salt.ItemName != "Salt" || salt.CurrentStock != 0 || salt.MovedStock != 0 {
+		t.Errorf("expected salt without stock or movements, got %+v", salt)
+	}
+
+	rows, err = env.reports.ListValuation(ctx, orgID, nil, day.Add(time.Hour))
+	if err != nil || rows[0].MovedStock != -1000 || math.Abs(rows[0].MovedCost+50) > 1e-9 {
+		t.Fatalf("expected only the OUT to follow the IN, got %+v (%v)", rows[0], err)
+	}
+}
+
+func contractStockSnapshots(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 2500)
+	createContractItem(t, env, orgID, categoryID, "Salt", 0, 0)
+	day := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	due, err := env.reports.ListUnsnapshottedOrganizations(ctx, day)
+	if err != nil || !containsUUID(due, orgID) {
+		t.Fatalf("expected the organization to be due a snapshot, got %v (%v)", due, err)
+	}
+	if _, err := env.reports.CreateSnapshot(ctx, &domain.StockSnapshot{
+		OrganizationID: orgID, ItemID: riceID, TakenAt: day, Quantity: 2000, Value: 100,
+	}); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	due, err = env.reports.ListUnsnapshottedOrganizations(ctx, day)
+	if err != nil || containsUUID(due, orgID) {
+		t.Fatalf("expected the organization to be snapshotted, got %v (%v)", due, err)
+	}
+
+	if takenAt, err := env.reports.LatestSnapshotAt(ctx, orgID, day.Add(-time.Hour)); err != nil || takenAt != nil {
+		t.Fatalf("expected no snapshot before the day, got %v (%v)", takenAt, err)
+	}
+	takenAt, err := env.reports.LatestSnapshotAt(ctx, orgID, day.AddDate(0, 0, 5))
+	if err != nil || takenAt == nil || !takenAt.Equal(day) {
+		t.Fatalf("expected the snapshot of %s, got %v (%v)", day, takenAt, err)
+	}
+
+	// 1000 g bought for 60 on the day and 500 g used without a cost two days on
+	inCost := 60.0
+	for _, mv := range []*domain.StockMovement{
+		{MovementType: domain.MovementTypeIn, Quantity: 1000, PreviousStock: 2000, NewStock: 3000, TotalCost: &inCost, CreatedAt: day.Add(10 * time.Hour)},
+		{MovementType: domain.MovementTypeOut, Quantity: 500, PreviousStock: 3000, NewStock: 2500, CreatedAt: day.AddDate(0, 0, 2)},
+	} {
+		mv.ItemID, mv.CreatedBy = riceID, userID
+		if _, err := env.movements.Create(ctx, mv); err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+	}
+
+	rows, err := env.reports.ListValuation(ctx, orgID, takenAt, day.AddDate(0, 0, 1))
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected rice and salt, got %d rows (%v)", len(rows), err)
+	}
+	rice, salt := rows[0], rows[1]
+	if rice.SnapshotQuantity == nil || *rice.SnapshotQuantity != 2000 || *rice.SnapshotValue != 100 {
+		t.Fatalf("expected rice to start from its snapshot, got %+v", rice)
+	}
+	if rice.MovedStock != 1000 || math.Abs(rice.MovedCost-60) > 1e-9 || rice.MovedUncosted != 0 {
+		t.Errorf("expected only the IN between the snapshot and the day after, got %+v", rice)
+	}
+	if salt.SnapshotQuantity != nil || salt.MovedStock != 0 {
+		t.Errorf("expected salt without a snapshot or movements, got %+v", salt)
+	}
+
+	rows, err = env.reports.ListValuation(ctx, orgID, takenAt, day.AddDate(0, 0, 3))
+	if err != nil || rows[0].MovedStock != 500 || math.Abs(rows[0].MovedCost-60) > 1e-9 || rows[0].MovedUncosted != -500 {
+		t.Fatalf("expected both movements since the snapshot, got %+v (%v)", rows[0], err)
+	}
+
+	// 100 g sold the evening before the snapshot and imported after it was
+	// taken is missing from the snapshot, so it counts as moved since
+	imported := &domain.StockMovement{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 100, PreviousStock: 2500, NewStock: 2400, CreatedBy: userID, CreatedAt: day.Add(-2 * time.Hour)}
+	if _, err := env.movements.Create(ctx, imported); err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	rows, err = env.reports.ListValuation(ctx, orgID, takenAt, day.AddDate(0, 0, 3))
+	if err != nil || rows[0].MovedStock != 400 || rows[0].MovedUncosted != -600 {
+		t.Fatalf("expected the late import to count after the snapshot, got %+v (%v)", rows[0], err)
+	}
+}
+
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func contractLedger(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, categoryID, userID := seedOrg(t, env)
+
+	saltID := createContractItem(t, env, orgID, categoryID, "Salt", 0, 0)
+	riceID := createContractItem(t, env, orgID, categoryID, "Rice", 0, 1500)
+
+	// Two locations hold 1200 g of the rice between them
+	for _, quantity := range []int{1000, 200} {
+		location := &domain.Location{OrganizationID: orgID, Name: fmt.Sprintf("Shelf %d", quantity), IsActive: true}
+		if _, err := env.locations.Create(ctx, location); err != nil {
+			t.Fatalf("create location: %v", err)
+		}
+		if err := env.stockLevels.SetQuantity(ctx, riceID, location.ID, quantity); err != nil {
+			t.Fatalf("set stock level: %v", err)
+		}
+	}
+
+	orgIDs, err := env.ledger.ListOrganizations(ctx)
+	if err != nil || !containsUUID(orgIDs, orgID) {
+		t.Fatalf("expected the organization to have a ledger, got %v (%v)", orgIDs, err)
+	}
+	items, err := env.ledger.ListItems(ctx, orgID)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("expected rice and salt, got %d items (%v)", len(items), err)
+	}
+	if items[0].ID != riceID || items[0].CurrentStock != 1500 || items[0].OrganizationID != orgID || items[1].ID != saltID {
+		t.Errorf("expected rice with 1500 g before salt, got %+v, %+v", items[0], items[1])
+	}
+	if items[0].LocationStock != 1200 || items[1].LocationStock != 0 {
+		t.Errorf("expected 1200 g of rice and no salt in stock levels, got %d and %d", items[0].LocationStock, items[1].LocationStock)
+	}
+
+	day := time.Date(2026, 5, 4, 8, 0, 0, 0, time.UTC)
+	later := &domain.StockMovement{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 500, PreviousStock: 2000, NewStock: 1500, CreatedBy: userID, CreatedAt: day.Add(time.Hour), RecordedAt: day.Add(time.Hour)}
+	earlier := &domain.StockMovement{ItemID: riceID, MovementType: domain.MovementTypeIn, Quantity: 2000, PreviousStock: 0, NewStock: 2000, CreatedBy: userID, CreatedAt: day, RecordedAt: day}
+	// A sale imported after the OUT above but dated before it
+	imported := &domain.StockMovement{ItemID: riceID, MovementType: domain.MovementTypeOut, Quantity: 200, PreviousStock: 1500, NewStock: 1300, CreatedBy: userID, CreatedAt: day.Add(30 * time.Minute), RecordedAt: day.Add(2 * time.Hour)}
+	for _, mv := range []*domain.StockMovement{later, earlier, imported} {
+		if _, err := env.movements.Create(ctx, mv); err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+	}
+
+	movements, err := env.ledger.ListMovements(ctx, riceID)
+	if err != nil || len(movements) != 3 || movements[0].ID != earlier.ID || movements[1].ID != later.ID || movements[2].ID != imported.ID {
+		t.Fatalf("expected the rice movements in the order they were recorded, got %+v (%v)", movements, err)
+	}
+	if !movements[2].CreatedAt.Equal(imported.RecordedAt) {
+		t.Errorf("expected the imported sale to be dated when it was recorded, got %v", movements[2].CreatedAt)
+	}
+	if movements[1].PreviousStock != 2000 || movements[1].NewStock != 1500 {
+		t.Errorf("expected the OUT to take 2000 g to 1500 g, got %+v", movements[1])
+	}
+	if movements, err := env.ledger.ListMovements(ctx, saltID); err != nil || len(movements) != 0 {
+		t.Errorf("expected no salt movements, got %+v (%v)", movements, err)
+	}
+}
+
+func contractPermissions(t *testing.T, env *contractEnv) {
+	ctx := repository.AllOrganizations(context.Background())
+	orgID, _, _ := seedOrg(t, env)
+
+	if overrides, err := env.permissions.ListOverrides(ctx, orgID); err != nil || len(overrides) != 0 {
+		t.Fatalf("expected no overrides, got %+v (%v)", overrides, err)
+	}
+
+	replace := func(role domain.UserRole, overrides ...*domain.PermissionOverride) {
+		t.Helper()
+		err := repository.RunInTx(ctx, env.db, func(ctx context.Context) error {
+			return env.permissions.ReplaceRoleOverrides(ctx, orgID, role, overrides)
+		})
+		if err != nil {
+			t.Fatalf("replace %s overrides: %v", role, err)
+		}
+	}
+	replace(domain.RoleUser,
+		&domain.PermissionOverride{Permission: domain.PermCostsView, Granted: true},
+		&domain.PermissionOverride{Permission: domain.PermMovementsAdjust, Granted: false},
+	)
+	replace(domain.RoleManager, &domain.PermissionOverride{Permission: domain.PermReportsView, Granted: false})
+
+	overrides, err := env.permissions.ListRoleOverrides(ctx, orgID, domain.RoleUser)
+	if err != nil || len(overrides) != 2 {
+		t.Fatalf("expected 2 user overrides, got %+v (%v)", overrides, err)
+	}
+	if overrides[0].Permission != domain.PermCostsView || !overrides[0].Granted || overrides[1].Permission != domain.PermMovementsAdjust || overrides[1].Granted {
+		t.Errorf("expected costs.view granted and movements.adjust denied, got %+v, %+v", overrides[0], overrides[1])
+	}
+
+	// Replacing a role's overrides leaves the other roles alone
+	replace(domain.RoleUser, &domain.PermissionOverride{Permission: domain.PermItemsWrite, Granted: true})
+	overrides, err = env.permissions.ListOverrides(ctx, orgID)
+	if err != nil || len(overrides) != 2 {
+		t.Fatalf("expected 2 overrides, got %+v (%v)", overrides, err)
+	}
+	if overrides[0].Role != domain.RoleManager || overrides[1].Role != domain.RoleUser || overrides[1].Permission != domain.PermItemsWrite {
+		t.Errorf("expected the manager override and the new user override, got %+v, %+v", overrides[0], overrides[1])
+	}
+}
+
+// contractTenantIsolation checks that a context scoped to one organization
+// can't reach another's rows by ID, and that an unscoped context reaches
+// none at all
+func contractOrganizations(t *testing.T, env *contractEnv) {
+	ctx := context.Background()
+	homeID, _, userID := seedOrg(t, env)
+
+	// Settings keys the organization doesn't know are kept
+	if _, err := env.db.Exec(env.dialect.Rebind(`UPDATE organizations SET settings = ? WHERE id = ?`),
+		`{"theme":"dark","currency":"EUR"}`, homeID.String()); err != nil {
+		t.Fatalf("seed settings: %v", err)
+	}
+	home, err := env.orgs.GetByID(ctx, homeID)
+	if err != nil || home == nil {
+		t.Fatalf("get by id: %+v, %v", home, err)
+	}
+	want := domain.OrganizationSettings{Currency: "EUR", Timezone: "UTC", CostingMethod: domain.CostingFIFO}
+	if home.Settings != want {
+		t.Errorf("expected stored settings with defaults, got %+v", home.Settings)
+	}
+	home.Name = "Outlet One"
+	home.Settings = domain.OrganizationSettings{Currency: "USD", Timezone: "Asia/Kolkata", CostingMethod: domain.CostingWeightedAverage}
+	if err := env.orgs.Update(ctx, home); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, err := env.orgs.GetBySlug(ctx, home.Slug); err != nil || got == nil || got.Name != "Outlet One" || got.Settings != home.Settings {
+		t.Fatalf("update not persisted: %+v, %v", got, err)
+	}
+	if method, err := env.costing.GetMethod(ctx, homeID); err != nil || method != domain.CostingWeightedAverage {
+		t.Errorf("expected the costing method column to follow, got %q (%v)", method, err)
+	}
+	var raw string
+	if err := env.db.QueryRow(env.dialect.Rebind(`SELECT settings FROM organizations WHERE id = ?`), homeID.String()).Scan(&raw); err != nil || !strings.Contains(raw, `"theme"`) {
+		t.Errorf("expected unknown settings to be kept, got %s (%v)", raw, err)
+	}
+
+	outlet := &domain.Organization{Name: "Outlet Two", Slug: "outlet-two-" + homeID.String()}
+	outletID, err := env.orgs.Create(ctx, outlet)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, _ := env.orgs.GetByID(ctx, outletID); got == nil || got.Settings != domain.DefaultOrganizationSettings {
+		t.Errorf("expected a new organization with default settings, got %+v", got)
+	}
+
+	// The seeded user is a member of their home organization already
+	if m, err := env.orgs.GetMember(ctx, homeID, userID); err != nil || m == nil || m.Role != domain.RoleUser || !m.IsActive {
+		t.Fatalf("expected a home membership, got %+v (%v)", m, err)
+	}
+	if err := env.orgs.AddMember(ctx, &domain.Membership{OrganizationID: outletID, UserID: userID, Role: domain.RoleManager, IsActive: true}); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	orgs, err := env.orgs.ListByUser(ctx, userID)
+	if err != nil || len(orgs) != 2 || orgs[0].ID != homeID || orgs[1].ID != outletID || orgs[1].Role != domain.RoleManager {
+		t.Fatalf("expected both organizations in the order joined, got %+v (%v)", orgs, err)
+	}
+	if member, err := env.users.GetMember(ctx, outletID, userID); err != nil || member == nil || member.OrganizationID != outletID || member.Role != domain.RoleManager {
+		t.Fatalf("expected the user as a manager of the outlet, got %+v (%v)", member, err)
+	}
+	if n, err := env.orgs.CountMembers(ctx, outletID); err != nil || n != 1 {
+		t.Errorf("expected 1 member, got %d (%v)", n, err)
+	}
+
+	// users.role follows the home membership only
+	update := func(m *domain.Membership) {
+		t.Helper()
+		if err := repository.RunInTx(ctx, env.db, func(ctx context.Context) error {
+			return env.orgs.UpdateMember(ctx, m)
+		}); err != nil {
+			t.Fatalf("update member: %v", err)
+		}
+	}
+	update(&domain.Membership{OrganizationID: outletID, UserID: userID, Role: domain.RoleAdmin, IsActive: false})
+	if account, _ := env.users.GetByID(ctx, userID); account == nil || account.Role != domain.RoleUser || account.OrganizationID != homeID {
+		t.Errorf("expected the account untouched by another membership, got %+v", account)
+	}
+	if member, _ := env.users.GetMember(ctx, outletID, userID); member == nil || member.IsActive {
+		t.Errorf("expected the user inactive in the outlet, got %+v", member)
+	}
+	if orgs, _ := env.orgs.ListByUser(ctx, userID); len(orgs) != 1 {
+		t.Errorf("expected inactive memberships not listed, got %d", len(orgs))
+	}
+	update(&domain.Membership{OrganizationID: homeID, UserID: userID, Role: domain.RoleManager, IsActive: true})
+	if account, _ := env.users.GetByID(ctx, userID); account == nil || account.Role != domain.RoleManager {
+		t.Errorf("expected users.role to follow the home membership, got %+v", account)
+	}
+
+	if err := env.users.SetHomeOrganization(ctx, userID, outletID, domain.RoleAdmin); err != nil {
+		t.Fatalf("set home organization: %v", err)
+	}
+	if account, _ := env.users.GetByID(ctx, userID); account == nil || account.OrganizationID != outletID || account.Role != domain.RoleAdmin {
+		t.Errorf("expected the outlet as home organization, got %+v", account)
+	}
+
+	if err := env.orgs.RemoveMember(ctx, homeID, userID); err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	if list, err := env.users.List(ctx, homeID); err != nil || len(list) != 0 {
+		t.Errorf("expected no members left, got %d (%v)", len(list), err)
+	}
+	if err := env.orgs.Delete(ctx, homeID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got, err := env.orgs.GetByID(ctx, homeID); err != nil || got != nil {
+		t.Errorf("expected the organization to be deleted, got %+v (%v)", got, err)
+	}
+}
+
+func contractTenantIsolation(t *testing.T, env *contractEnv) {
+	orgID, categoryID, userID := seedOrg(t, env)
+	otherOrgID, _, _ := seedOrg(t, env)
+	own := repository.WithOrganization(context.Background(), orgID)
+	foreign := repository.WithOrganization(context.Background(), otherOrgID)
+
+	itemID := createContractItem(t, env, orgID, categoryID, "Saffron", 10, 50)
+	movementID, err := env.movements.Create(own, &domain.StockMovement{
+		ItemID:        itemID,
+		MovementType:  domain.MovementTypeIn,
+		Quantity:      50,
+		PreviousStock: 0,
+		NewStock:      50,
+		CreatedBy:     userID,
+	})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	alertID, err := env.alerts.Create(own, &domain.Alert{
+		OrganizationID: orgID,
+		ItemID:         &itemID,
+		Type:           domain.AlertTypeLowStock,
+		Severity:       domain.AlertSeverityWarning,
+		Title:          "Low Stock: Saffron",
+		Message:        "Item \"Saffron\" is running low",
+	})
+	if err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+
+	if _, err := env.items.GetByID(context.Background(), itemID); !errors.Is(err, repository.ErrNoOrganization) {
+		t.Fatalf("expected ErrNoOrganization without a scope, got %v", err)
+	}
+
+	if item, err := env.items.GetByID(foreign, itemID); err != nil || item != nil {
+		t.Fatalf("expected no item from another organization, got %+v (%v)", item, err)
+	}
+	if category, err := env.categories.GetByID(foreign, categoryID); err != nil || category != nil {
+		t.Fatalf("expected no category from another organization, got %+v (%v)", category, err)
+	}
+	if movement, err := env.movements.GetByID(foreign, movementID); err != nil || movement != nil {
+		t.Fatalf("expected no movement from another organization, got %+v (%v)", movement, err)
+	}
+	if movements, err := env.movements.ListByItem(foreign, itemID, 10, 0); err != nil || len(movements) != 0 {
+		t.Fatalf("expected no movements of another organization's item, got %d (%v)", len(movements), err)
+	}
+	if alert, err := env.alerts.GetByID(foreign, alertID); err != nil || alert != nil {
+		t.Fatalf("expected no alert from another organization, got %+v (%v)", alert, err)
+	}
+
+	// Stock levels, lots, cost layers and order lines are reached through
+	// their item, location or order
+	cellar := &domain.Location{OrganizationID: orgID, Name: "Cellar", IsDefault: true, IsActive: true}
+	if _, err := env.locations.Create(own, cellar); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	if err := env.stockLevels.SetQuantity(own, itemID, cellar.ID, 50); err != nil {
+		t.Fatalf("set quantity: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	lot := &domain.StockLot{ItemID: itemID, LocationID: cellar.ID, MovementID: &movementID, ReceivedAt: now, InitialQuantity: 50, Quantity: 50}
+	if _, err := env.lots.Create(own, lot); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+	if err := env.lots.RecordMovement(own, movementID, lot.ID, 50); err != nil {
+		t.Fatalf("record lot movement: %v", err)
+	}
+	if err := env.units.SetItemConversion(own, &domain.ItemUnitConversion{ItemID: itemID, Unit: "tin", Quantity: 100}); err != nil {
+		t.Fatalf("set item conversion: %v", err)
+	}
+	layer := &domain.CostLayer{ItemID: itemID, MovementID: &movementID, ReceivedAt: now, UnitCost: 4, InitialQuantity: 50, Quantity: 50}
+	if _, err := env.costing.CreateLayer(own, layer); err != nil {
+		t.Fatalf("create layer: %v", err)
+	}
+	supplier := &domain.Supplier{OrganizationID: orgID, Name: "Spice Route", IsActive: true}
+	if _, err := env.suppliers.Create(own, supplier); err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+	po := &domain.PurchaseOrder{
+		OrganizationID: orgID, SupplierID: supplier.ID, Number: 1, Status: domain.PurchaseOrderSent, CreatedBy: userID,
+		Lines: []*domain.PurchaseOrderLine{{ItemID: itemID, Unit: "gm", UnitFactor: 1, OrderedQuantity: 50, ReceivedQuantity: 50, UnitPrice: 4}},
+	}
+	if _, err := env.orders.Create(own, po); err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	if _, err := env.orders.CreateReceipt(own, &domain.GoodsReceipt{
+		PurchaseOrderID: po.ID, ReceivedBy: userID, ReceivedAt: now,
+		Lines: []*domain.GoodsReceiptLine{{LineID: po.Lines[0].ID, MovementID: movementID, Quantity: 50, UnitPrice: 4}},
+	}); err != nil {
+		t.Fatalf("create receipt: %v", err)
+	}
+
+	if level, err := env.stockLevels.Get(foreign, itemID, cellar.ID); err != nil || level != nil {
+		t.Fatalf("expected no stock level of another organization, got %+v (%v)", level, err)
+	}
+	if levels, err := env.stockLevels.ListByItem(foreign, itemID); err != nil || len(levels) != 0 {
+		t.Fatalf("expected no stock levels of another organization's item, got %d (%v)", len(levels), err)
+	}
+	if count, err := env.stockLevels.CountStockedAtLocation(foreign, cellar.ID); err != nil || count != 0 {
+		t.Fatalf("expected no stock counted at another organization's location, got %d (%v)", count, err)
+	}
+	if lots, err := env.lots.ListAvailable(foreign, itemID, cellar.ID); err != nil || len(lots) != 0 {
+		t.Fatalf("expected no lots of another organization, got %d (%v)", len(lots), err)
+	}
+	if lots, err := env.lots.ListByItem(foreign, itemID); err != nil || len(lots) != 0 {
+		t.Fatalf("expected no lots of another organization's item, got %d (%v)", len(lots), err)
+	}
+	if lots, err := env.lots.ListMovementLots(foreign, movementID); err != nil || len(lots) != 0 {
+		t.Fatalf("expected no lots of another organization's movement, got %d (%v)", len(lots), err)
+	}
+	if conversions, err := env.units.ListItemConversions(foreign, itemID); err != nil || len(conversions) != 0 {
+		t.Fatalf("expected no unit conversions of another organization's item, got %d (%v)", len(conversions), err)
+	}
+	if layers, err := env.costing.ListOpenLayers(foreign, itemID); err != nil || len(layers) != 0 {
+		t.Fatalf("expected no cost layers of another organization's item, got %d (%v)", len(layers), err)
+	}
+	if movements, err := env.ledger.ListMovements(foreign, itemID); err != nil || len(movements) != 0 {
+		t.Fatalf("expected no ledger of another organization's item, got %d (%v)", len(movements), err)
+	}
+	if receipts, err := env.orders.ListReceipts(foreign, po.ID); err != nil || len(receipts) != 0 {
+		t.Fatalf("expected no receipts of another organization's order, got %d (%v)", len(receipts), err)
+	}
+
+	// Writes by ID leave another organization's rows untouched
+	item, err := env.items.GetByID(own, itemID)
+	if err != nil || item == nil {
+		t.Fatalf("get own item: %+v (%v)", item, err)
+	}
+	item.Name = "Stolen"
+	if err := env.items.Update(foreign, item); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict updating another organization's item, got %v", err)
+	}
+	if err := env.items.UpdateStock(foreign, itemID, 0, item.Version); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict setting another organization's stock, got %v", err)
+	}
+	if voided, err := env.movements.Void(foreign, movementID, userID, time.Now().UTC()); err != nil || voided {
+		t.Fatalf("expected another organization's movement not to be voided, got %v (%v)", voided, err)
+	}
+	if err := env.alerts.MarkAsRead(foreign, alertID); err != nil {
+		t.Fatalf("mark as read: %v", err)
+	}
+	if err := env.items.Delete(foreign, itemID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := env.categories.Delete(foreign, categoryID); err != nil {
+		t.Fatalf("delete category: %v", err)
+	}
+	if err := env.stockLevels.DeleteByLocation(foreign, cellar.ID); err != nil {
+		t.Fatalf("delete stock levels: %v", err)
+	}
+	if err := env.lots.UpdateQuantity(foreign, lot.ID, 0); err != nil {
+		t.Fatalf("update lot: %v", err)
+	}
+	if err := env.lots.AddQuantity(foreign, lot.ID, 10); err != nil {
+		t.Fatalf("add to lot: %v", err)
+	}
+	if err := env.units.DeleteItemConversion(foreign, itemID, "tin"); err != nil {
+		t.Fatalf("delete item conversion: %v", err)
+	}
+	layer.Quantity = 0
+	if err := env.costing.UpdateLayer(foreign, layer); err != nil {
+		t.Fatalf("update layer: %v", err)
+	}
+	if err := env.orders.SetReceivedQuantity(foreign, po.Lines[0].ID, 0); err != nil {
+		t.Fatalf("set received quantity: %v", err)
+	}
+	if err := env.orders.ReplaceLines(foreign, &domain.PurchaseOrder{ID: po.ID}); err != nil {
+		t.Fatalf("replace lines: %v", err)
+	}
+
+	item, err = env.items.GetByID(own, itemID)
+	if err != nil || item == nil || item.Name != "Saffron" || item.CurrentStock != 50 {
+		t.Fatalf("expected the item unchanged, got %+v (%v)", item, err)
+	}
+	if category, err := env.categories.GetByID(own, categoryID); err != nil || category == nil {
+		t.Fatalf("expected the category to remain, got %+v (%v)", category, err)
+	}
+	if movement, err := env.movements.GetByID(own, movementID); err != nil || movement == nil || movement.VoidedAt != nil {
+		t.Fatalf("expected the movement not voided, got %+v (%v)", movement, err)
+	}
+	if alert, err := env.alerts.GetByID(own, alertID); err != nil || alert == nil || alert.IsRead {
+		t.Fatalf("expected the alert unread, got %+v (%v)", alert, err)
+	}
+	if level, err := env.stockLevels.Get(own, itemID, cellar.ID); err != nil || level == nil || level.Quantity != 50 {
+		t.Fatalf("expected the stock level unchanged, got %+v (%v)", level, err)
+	}
+	if lots, err := env.lots.ListByItem(own, itemID); err != nil || len(lots) != 1 || lots[0].Quantity != 50 {
+		t.Fatalf("expected the lot unchanged, got %d (%v)", len(lots), err)
+	}
+	if conversions, err := env.units.ListItemConversions(own, itemID); err != nil || len(conversions) != 1 {
+		t.Fatalf("expected the unit conversion to remain, got %d (%v)", len(conversions), err)
+	}
+	if layers, err := env.costing.ListOpenLayers(own, itemID); err != nil || len(layers) != 1 || layers[0].Quantity != 50 {
+		t.Fatalf("expected the cost layer unchanged, got %d (%v)", len(layers), err)
+	}
+	if order, err := env.orders.GetByID(own, po.ID); err != nil || order == nil || len(order.Lines) != 1 || order.Lines[0].ReceivedQuantity != 50 {
+		t.Fatalf("expected the order lines unchanged, got %+v (%v)", order, err)
+	}
+	if receipts, err := env.orders.ListReceipts(own, po.ID); err != nil || len(receipts) != 1 || len(receipts[0].Lines) != 1 {
+		t.Fatalf("expected the receipt on the order, got %d (%v)", len(receipts), err)
+	}
+
+	// Background jobs span every organization
+	if item, err := env.items.GetByID(repository.AllOrganizations(context.Background()), itemID); err != nil || item == nil {
+		t.Fatalf("expected the item across organizations, got %+v (%v)", item, err)
+	}
+}
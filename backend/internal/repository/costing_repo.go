@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewCostingRepository(db *sql.DB, dialect database.Dialect) CostingRepository {
+	return &costingRepo{db: db, dialect: dialect}
+}
+
+type costingRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const costLayerColumns = `id, item_id, movement_id, received_at, unit_cost, initial_quantity, quantity, created_at`
+
+// GetMethod returns the organization's costing method; it is empty for an
+// organization that does not exist
+func (r *costingRepo) GetMethod(ctx context.Context, orgID uuid.UUID) (domain.CostingMethod, error) {
+	var method domain.CostingMethod
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT costing_method FROM organizations WHERE id = ?
+	`, orgID.String()).Scan(&method)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return method, err
+}
+
+func (r *costingRepo) SetMethod(ctx context.Context, orgID uuid.UUID, method domain.CostingMethod) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE organizations SET costing_method = ? WHERE id = ?
+	`, method, orgID.String())
+	return err
+}
+
+func (r *costingRepo) CreateLayer(ctx context.Context, layer *domain.CostLayer) (uuid.UUID, error) {
+	if layer == nil {
+		return uuid.Nil, errors.New("cost layer is nil")
+	}
+
+	if layer.ID == uuid.Nil {
+		layer.ID = uuid.New()
+	}
+	layer.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO cost_layers (`+costLayerColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		layer.ID.String(), layer.ItemID.String(), nullableUUID(layer.MovementID), layer.ReceivedAt,
+		layer.UnitCost, layer.InitialQuantity, layer.Quantity, layer.CreatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return layer.ID, nil
+}
+
+// ListOpenLayers returns the layers of an item that still hold stock, oldest
+// first
+func (r *costingRepo) ListOpenLayers(ctx context.Context, itemID uuid.UUID) ([]*domain.CostLayer, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+costLayerColumns+` FROM cost_layers
+		WHERE item_id = ? AND quantity > 0 AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY received_at, created_at, id
+	`, itemID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var layers []*domain.CostLayer
+	for rows.Next() {
+		var layer domain.CostLayer
+		var (
+			idStr, itemStr string
+			movementStr    sql.NullString
+		)
+		if err := rows.Scan(
+			&idStr, &itemStr, &movementStr, &layer.ReceivedAt,
+			&layer.UnitCost, &layer.InitialQuantity, &layer.Quantity, &layer.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		layer.ID, _ = uuid.Parse(idStr)
+		layer.ItemID, _ = uuid.Parse(itemStr)
+		layer.MovementID = parseNullableUUID(movementStr)
+		layers = append(layers, &layer)
+	}
+
+	return layers, rows.Err()
+}
+
+// UpdateLayer writes what is left of a layer and its cost, which changes
+// when a weighted average is taken
+func (r *costingRepo) UpdateLayer(ctx context.Context, layer *domain.CostLayer) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE cost_layers SET quantity = ?, unit_cost = ?
+		WHERE id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, layer.Quantity, layer.UnitCost, layer.ID.String(), org)
+	return err
+}
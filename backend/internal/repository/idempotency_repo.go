@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+// ErrIdempotencyKeyExists is returned by Create when a record for the same
+// organization, user and key is already stored
+var ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+func NewIdempotencyRepository(db *sql.DB, dialect database.Dialect) IdempotencyRepository {
+	return &idempotencyRepo{db: db, dialect: dialect}
+}
+
+type idempotencyRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func (r *idempotencyRepo) Get(ctx context.Context, orgID, userID uuid.UUID, key string) (*domain.IdempotencyRecord, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT organization_id, user_id, idempotency_key, request_hash,
+		       response_status, response_body, created_at
+		FROM idempotency_keys
+		WHERE organization_id = ? AND user_id = ? AND idempotency_key = ?
+	`, orgID.String(), userID.String(), key)
+
+	var record domain.IdempotencyRecord
+	var orgStr, userStr, body string
+
+	if err := row.Scan(
+		&orgStr, &userStr, &record.Key, &record.RequestHash,
+		&record.ResponseStatus, &body, &record.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	record.OrganizationID, _ = uuid.Parse(orgStr)
+	record.UserID, _ = uuid.Parse(userStr)
+	record.ResponseBody = []byte(body)
+
+	return &record, nil
+}
+
+func (r *idempotencyRepo) Create(ctx context.Context, record *domain.IdempotencyRecord) error {
+	if record == nil {
+		return errors.New("idempotency record is nil")
+	}
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
+	}
+
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO idempotency_keys (
+			organization_id, user_id, idempotency_key, request_hash,
+			response_status, response_body, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (organization_id, user_id, idempotency_key) DO NOTHING
+	`,
+		record.OrganizationID.String(), record.UserID.String(), record.Key, record.RequestHash,
+		record.ResponseStatus, string(record.ResponseBody), record.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+func (r *idempotencyRepo) Delete(ctx context.Context, orgID, userID uuid.UUID, key string) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE organization_id = ? AND user_id = ? AND idempotency_key = ?
+	`, orgID.String(), userID.String(), key)
+	return err
+}
+
+func (r *idempotencyRepo) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE created_at < ?
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
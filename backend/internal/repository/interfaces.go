@@ -2,11 +2,26 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 	"hasufel.kj/internal/domain"
 )
 
+// Querier is the subset of *sql.DB and *sql.Tx used by the repositories.
+// Repository methods run against the transaction bound to their context by
+// RunInTx, and against the shared connection pool otherwise.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Methods that reach rows by ID, rather than by organization, only reach
+// the rows of the organization their context is scoped to by
+// WithOrganization, and return ErrNoOrganization without a scope.
+
 type ItemRepository interface {
 	Create(ctx context.Context, item *domain.Item) (uuid.UUID, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Item, error)
@@ -14,18 +29,70 @@ type ItemRepository interface {
 	ListWithFilters(ctx context.Context, orgID uuid.UUID, search string, categoryID *uuid.UUID, lowStockOnly bool, limit, offset int) ([]*domain.Item, error)
 	CountWithFilters(ctx context.Context, orgID uuid.UUID, search string, categoryID *uuid.UUID, lowStockOnly bool) (int, error)
 	Update(ctx context.Context, item *domain.Item) error
-	UpdateStock(ctx context.Context, id uuid.UUID, newStock int) error
+	UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error
 	CountByCategory(ctx context.Context, categoryID uuid.UUID) (int, error)
 	ReassignCategory(ctx context.Context, fromCategoryID, toCategoryID uuid.UUID) error
+	UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
+// UserRepository looks users up across organizations, as they sign in
+// before their organization is known. GetByID and GetByEmail return the
+// account, in the user's home organization; List and GetMember return users
+// as members of an organization, with their role there.
 type UserRepository interface {
+	// Create creates the user as a member of their home organization
 	Create(ctx context.Context, user *domain.User) (uuid.UUID, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	List(ctx context.Context, orgID uuid.UUID) ([]*domain.User, error)
+	GetMember(ctx context.Context, orgID, id uuid.UUID) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
+	SetHomeOrganization(ctx context.Context, id, orgID uuid.UUID, role domain.UserRole) error
+	// BumpTokenVersion invalidates every access token issued to the user
+	BumpTokenVersion(ctx context.Context, id uuid.UUID) error
+}
+
+// OrganizationRepository stores organizations and their members. It isn't
+// scoped to the organization of the request, as users reach every
+// organization they belong to; services check the membership.
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *domain.Organization) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*domain.Organization, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.Organization, error)
+	Update(ctx context.Context, org *domain.Organization) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	AddMember(ctx context.Context, m *domain.Membership) error
+	GetMember(ctx context.Context, orgID, userID uuid.UUID) (*domain.Membership, error)
+	CountMembers(ctx context.Context, orgID uuid.UUID) (int, error)
+	UpdateMember(ctx context.Context, m *domain.Membership) error
+	RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error
+}
+
+type InvitationRepository interface {
+	Create(ctx context.Context, inv *domain.UserInvitation) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.UserInvitation, error)
+	// GetByHash finds an invitation of any organization, for the invitee to
+	// accept before signing in
+	GetByHash(ctx context.Context, tokenHash string) (*domain.UserInvitation, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.UserInvitation, error)
+	// ListOpen finds the invitations of any organization open to the email,
+	// for its account to accept when signing in
+	ListOpen(ctx context.Context, email string) ([]*domain.UserInvitation, error)
+	MarkAccepted(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error)
+	Revoke(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeOpen(ctx context.Context, orgID uuid.UUID, email string, at time.Time) error
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *domain.RefreshToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error
+	RevokeUserInOrganization(ctx context.Context, userID, orgID uuid.UUID, at time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
 }
 
 type CategoryRepository interface {
@@ -39,6 +106,7 @@ type CategoryRepository interface {
 type MovementRepository interface {
 	Create(ctx context.Context, movement *domain.StockMovement) (uuid.UUID, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.StockMovement, error)
+	Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error)
 	ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error)
 	ListByOrganization(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error)
 	ListRecent(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.StockMovement, error)
@@ -50,5 +118,153 @@ type AlertRepository interface {
 	ListUnread(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error)
 	List(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.Alert, error)
 	MarkAsRead(ctx context.Context, id uuid.UUID) error
-	DeleteByItemID(ctx context.Context, itemID uuid.UUID) error
+	// DeleteByItemID deletes the item's alerts of the given types, or all of
+	// its alerts when no type is given
+	DeleteByItemID(ctx context.Context, itemID uuid.UUID, types ...domain.AlertType) error
+}
+
+type LocationRepository interface {
+	Create(ctx context.Context, location *domain.Location) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Location, error)
+	GetDefault(ctx context.Context, orgID uuid.UUID) (*domain.Location, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.Location, error)
+	Update(ctx context.Context, location *domain.Location) error
+	ClearDefault(ctx context.Context, orgID uuid.UUID) error
+	HasMovements(ctx context.Context, id uuid.UUID) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type StockLevelRepository interface {
+	Get(ctx context.Context, itemID, locationID uuid.UUID) (*domain.StockLevel, error)
+	ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLevel, error)
+	SetQuantity(ctx context.Context, itemID, locationID uuid.UUID, quantity int) error
+	SetThreshold(ctx context.Context, itemID, locationID uuid.UUID, threshold *int) error
+	CountStockedAtLocation(ctx context.Context, locationID uuid.UUID) (int, error)
+	DeleteByLocation(ctx context.Context, locationID uuid.UUID) error
+}
+
+type StockLotRepository interface {
+	Create(ctx context.Context, lot *domain.StockLot) (uuid.UUID, error)
+	ListAvailable(ctx context.Context, itemID, locationID uuid.UUID) ([]*domain.StockLot, error)
+	ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLot, error)
+	UpdateQuantity(ctx context.Context, id uuid.UUID, quantity int) error
+	AddQuantity(ctx context.Context, id uuid.UUID, quantity int) error
+	RecordMovement(ctx context.Context, movementID, lotID uuid.UUID, quantity int) error
+	ListMovementLots(ctx context.Context, movementID uuid.UUID) ([]*domain.MovementLot, error)
+	ListExpiringUnalerted(ctx context.Context, before time.Time) ([]*domain.StockLot, error)
+	MarkExpiryAlerted(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+type RecipeRepository interface {
+	Create(ctx context.Context, recipe *domain.Recipe) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Recipe, error)
+	GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Recipe, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.Recipe, error)
+	Update(ctx context.Context, recipe *domain.Recipe) error
+	IsSubRecipe(ctx context.Context, id uuid.UUID) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type UnitRepository interface {
+	Create(ctx context.Context, unit *domain.Unit) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Unit, error)
+	GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.Unit, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.Unit, error)
+	Update(ctx context.Context, unit *domain.Unit) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	IsInUse(ctx context.Context, orgID uuid.UUID, code string) (bool, error)
+	ListItemConversions(ctx context.Context, itemID uuid.UUID) ([]*domain.ItemUnitConversion, error)
+	SetItemConversion(ctx context.Context, conversion *domain.ItemUnitConversion) error
+	DeleteItemConversion(ctx context.Context, itemID uuid.UUID, unit string) error
+}
+
+type SupplierRepository interface {
+	Create(ctx context.Context, supplier *domain.Supplier) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Supplier, error)
+	GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Supplier, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.Supplier, error)
+	Update(ctx context.Context, supplier *domain.Supplier) error
+	HasPurchaseOrders(ctx context.Context, id uuid.UUID) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type PurchaseOrderRepository interface {
+	Create(ctx context.Context, po *domain.PurchaseOrder) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error)
+	List(ctx context.Context, orgID uuid.UUID, status *domain.PurchaseOrderStatus) ([]*domain.PurchaseOrder, error)
+	NextNumber(ctx context.Context, orgID uuid.UUID) (int, error)
+	Update(ctx context.Context, po *domain.PurchaseOrder) error
+	ReplaceLines(ctx context.Context, po *domain.PurchaseOrder) error
+	SetReceivedQuantity(ctx context.Context, lineID uuid.UUID, quantity int) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	CreateReceipt(ctx context.Context, receipt *domain.GoodsReceipt) (uuid.UUID, error)
+	ListReceipts(ctx context.Context, poID uuid.UUID) ([]*domain.GoodsReceipt, error)
+}
+
+type ReorderRepository interface {
+	ListCandidates(ctx context.Context, orgID *uuid.UUID, since time.Time) ([]*domain.ReorderCandidate, error)
+	MarkAlerted(ctx context.Context, itemID uuid.UUID, at *time.Time) error
+}
+
+type StockCountRepository interface {
+	Create(ctx context.Context, count *domain.StockCount) (uuid.UUID, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.StockCount, error)
+	List(ctx context.Context, orgID uuid.UUID, status *domain.StockCountStatus) ([]*domain.StockCount, error)
+	Update(ctx context.Context, count *domain.StockCount) error
+	SetCounted(ctx context.Context, line *domain.StockCountLine) error
+	SetMovement(ctx context.Context, lineID, movementID uuid.UUID) error
+}
+
+type MovementReasonRepository interface {
+	Create(ctx context.Context, reason *domain.MovementReason) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.MovementReason, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error)
+	Update(ctx context.Context, reason *domain.MovementReason) error
+}
+
+type ReportRepository interface {
+	ListOutflows(ctx context.Context, orgID uuid.UUID, from, to time.Time) ([]*domain.OutflowTotal, error)
+	ListValuation(ctx context.Context, orgID uuid.UUID, snapshotAt *time.Time, asOf time.Time) ([]*domain.ValuationRow, error)
+	LatestSnapshotAt(ctx context.Context, orgID uuid.UUID, asOf time.Time) (*time.Time, error)
+	ListUnsnapshottedOrganizations(ctx context.Context, takenAt time.Time) ([]uuid.UUID, error)
+	CreateSnapshot(ctx context.Context, snapshot *domain.StockSnapshot) (uuid.UUID, error)
+}
+
+type CostingRepository interface {
+	GetMethod(ctx context.Context, orgID uuid.UUID) (domain.CostingMethod, error)
+	SetMethod(ctx context.Context, orgID uuid.UUID, method domain.CostingMethod) error
+	CreateLayer(ctx context.Context, layer *domain.CostLayer) (uuid.UUID, error)
+	ListOpenLayers(ctx context.Context, itemID uuid.UUID) ([]*domain.CostLayer, error)
+	UpdateLayer(ctx context.Context, layer *domain.CostLayer) error
+}
+
+type LedgerRepository interface {
+	ListOrganizations(ctx context.Context) ([]uuid.UUID, error)
+	ListItems(ctx context.Context, orgID uuid.UUID) ([]*domain.LedgerItem, error)
+	ListMovements(ctx context.Context, itemID uuid.UUID) ([]*domain.StockMovement, error)
+}
+
+type POSMappingRepository interface {
+	Upsert(ctx context.Context, mapping *domain.POSMapping) error
+	GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.POSMapping, error)
+	List(ctx context.Context, orgID uuid.UUID) ([]*domain.POSMapping, error)
+	Delete(ctx context.Context, orgID uuid.UUID, code string) error
+}
+
+type POSImportRepository interface {
+	MarkBillImported(ctx context.Context, orgID uuid.UUID, billNumber string, userID uuid.UUID) (bool, error)
+}
+
+type IdempotencyRepository interface {
+	Get(ctx context.Context, orgID, userID uuid.UUID, key string) (*domain.IdempotencyRecord, error)
+	Create(ctx context.Context, record *domain.IdempotencyRecord) error
+	Delete(ctx context.Context, orgID, userID uuid.UUID, key string) error
+	DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type PermissionRepository interface {
+	ListOverrides(ctx context.Context, orgID uuid.UUID) ([]*domain.PermissionOverride, error)
+	ListRoleOverrides(ctx context.Context, orgID uuid.UUID, role domain.UserRole) ([]*domain.PermissionOverride, error)
+	// ReplaceRoleOverrides swaps every override of the role for overrides
+	ReplaceRoleOverrides(ctx context.Context, orgID uuid.UUID, role domain.UserRole, overrides []*domain.PermissionOverride) error
 }
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewInvitationRepository(db *sql.DB, dialect database.Dialect) InvitationRepository {
+	return &invitationRepo{db: db, dialect: dialect}
+}
+
+type invitationRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const invitationColumns = `id, organization_id, email, role, token_hash, invited_by, expires_at, accepted_at, accepted_by, revoked_at, created_at`
+
+func (r *invitationRepo) Create(ctx context.Context, inv *domain.UserInvitation) error {
+	if inv == nil {
+		return errors.New("invitation is nil")
+	}
+
+	if inv.ID == uuid.Nil {
+		inv.ID = uuid.New()
+	}
+	inv.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO user_invitations (
+			id, organization_id, email, role, token_hash, invited_by,
+			expires_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		inv.ID.String(), inv.OrganizationID.String(), inv.Email, inv.Role,
+		inv.TokenHash, inv.InvitedBy.String(), inv.ExpiresAt, inv.CreatedAt,
+	)
+	return err
+}
+
+func (r *invitationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserInvitation, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM user_invitations WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return scanInvitation(row)
+}
+
+func (r *invitationRepo) GetByHash(ctx context.Context, tokenHash string) (*domain.UserInvitation, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM user_invitations WHERE token_hash = ?
+	`, tokenHash)
+	return scanInvitation(row)
+}
+
+// List returns the organization's invitations, newest first
+func (r *invitationRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.UserInvitation, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM user_invitations
+		WHERE organization_id = ?
+		ORDER BY created_at DESC
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*domain.UserInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// ListOpen returns the invitations to the email that are neither accepted
+// nor revoked, oldest first
+func (r *invitationRepo) ListOpen(ctx context.Context, email string) ([]*domain.UserInvitation, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM user_invitations
+		WHERE email = ? AND accepted_at IS NULL AND revoked_at IS NULL
+		ORDER BY created_at
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*domain.UserInvitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// MarkAccepted records that the user accepted the invitation unless it was
+// already accepted or has been revoked. It reports whether it did, so an
+// invitation can only be accepted once.
+func (r *invitationRepo) MarkAccepted(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error) {
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE user_invitations SET accepted_at = ?, accepted_by = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, at, userID.String(), id.String())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Revoke revokes the invitation unless it was already accepted or revoked
+func (r *invitationRepo) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE user_invitations SET revoked_at = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND organization_id = COALESCE(?, organization_id)
+	`, at, id.String(), org)
+	return err
+}
+
+// RevokeOpen revokes the invitations of the email to the organization that
+// are neither accepted nor revoked
+func (r *invitationRepo) RevokeOpen(ctx context.Context, orgID uuid.UUID, email string, at time.Time) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE user_invitations SET revoked_at = ?
+		WHERE organization_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, at, orgID.String(), email)
+	return err
+}
+
+func scanInvitation(row rowScanner) (*domain.UserInvitation, error) {
+	var inv domain.UserInvitation
+	var idStr, orgStr, invitedByStr string
+	var acceptedAt, revokedAt sql.NullTime
+	var acceptedBy sql.NullString
+
+	if err := row.Scan(
+		&idStr, &orgStr, &inv.Email, &inv.Role, &inv.TokenHash, &invitedByStr,
+		&inv.ExpiresAt, &acceptedAt, &acceptedBy, &revokedAt, &inv.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	inv.ID, _ = uuid.Parse(idStr)
+	inv.OrganizationID, _ = uuid.Parse(orgStr)
+	inv.InvitedBy, _ = uuid.Parse(invitedByStr)
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+	if acceptedBy.Valid {
+		if userID, err := uuid.Parse(acceptedBy.String); err == nil {
+			inv.AcceptedBy = &userID
+		}
+	}
+	if revokedAt.Valid {
+		inv.RevokedAt = &revokedAt.Time
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+// ErrVersionConflict is returned by compare-and-swap writes when the row no
+// longer carries the version the caller read
+var ErrVersionConflict = errors.New("item was modified concurrently")
+
+func NewItemRepository(db *sql.DB, dialect database.Dialect) ItemRepository {
+	return &itemRepo{db: db, dialect: dialect}
+}
+
+type itemRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func (r *itemRepo) Create(ctx context.Context, item *domain.Item) (uuid.UUID, error) {
+	if item == nil {
+		return uuid.Nil, errors.New("item is nil")
+	}
+
+	if item.ID == uuid.Nil {
+		item.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	item.CreatedAt = now
+	item.UpdatedAt = now
+	item.Version = 1
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO items (
+			id, organization_id, category_id, name, sku,
+			unit_of_measurement, minimum_threshold, current_stock,
+			unit_cost, is_active, track_stock, version, created_at, updated_at,
+			par_level, lead_time_days, preferred_supplier_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		item.ID.String(), item.OrganizationID.String(), item.CategoryID.String(),
+		item.Name, item.SKU, item.UnitOfMeasurement, item.MinimumThreshold,
+		item.CurrentStock, item.UnitCost, item.IsActive, item.TrackStock, item.Version, item.CreatedAt, item.UpdatedAt,
+		item.ParLevel, item.LeadTimeDays, nullableUUID(item.PreferredSupplierID),
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return item.ID, nil
+}
+
+func (r *itemRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Item, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT id, organization_id, category_id, name, sku,
+		       unit_of_measurement, minimum_threshold, current_stock,
+		       unit_cost, is_active, track_stock, version, created_at, updated_at,
+		       par_level, lead_time_days, preferred_supplier_id
+	FROM items WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+
+	var it domain.Item
+	var (
+		idStr, orgStr, catStr string
+		sku                   sql.NullString
+		unitCost              sql.NullFloat64
+		parLevel, leadTime    sql.NullInt64
+		preferredSupplier     sql.NullString
+	)
+	if err := row.Scan(&idStr, &orgStr, &catStr, &it.Name, &sku,
+		&it.UnitOfMeasurement, &it.MinimumThreshold, &it.CurrentStock,
+		&unitCost, &it.IsActive, &it.TrackStock, &it.Version, &it.CreatedAt, &it.UpdatedAt,
+		&parLevel, &leadTime, &preferredSupplier,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	it.ID, _ = uuid.Parse(idStr)
+	it.OrganizationID, _ = uuid.Parse(orgStr)
+	it.CategoryID, _ = uuid.Parse(catStr)
+	if sku.Valid {
+		it.SKU = &sku.String
+	}
+	if unitCost.Valid {
+		it.UnitCost = &unitCost.Float64
+	}
+	setReorderSettings(&it, parLevel, leadTime, preferredSupplier)
+
+	return &it, nil
+}
+
+func (r *itemRepo) List(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.Item, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT id, organization_id, category_id, name, sku,
+		       unit_of_measurement, minimum_threshold, current_stock,
+		       unit_cost, is_active, track_stock, version, created_at, updated_at,
+		       par_level, lead_time_days, preferred_supplier_id
+		FROM items
+		WHERE organization_id = ?
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, orgID.String(), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.Item
+	for rows.Next() {
+		var it domain.Item
+		var (
+			idStr, orgStr, catStr string
+			sku                   sql.NullString
+			unitCost              sql.NullFloat64
+			parLevel, leadTime    sql.NullInt64
+			preferredSupplier     sql.NullString
+		)
+		if err := rows.Scan(&idStr, &orgStr, &catStr, &it.Name, &sku,
+			&it.UnitOfMeasurement, &it.MinimumThreshold, &it.CurrentStock,
+			&unitCost, &it.IsActive, &it.TrackStock, &it.Version, &it.CreatedAt, &it.UpdatedAt,
+			&parLevel, &leadTime, &preferredSupplier,
+		); err != nil {
+			return nil, err
+		}
+		it.ID, _ = uuid.Parse(idStr)
+		it.OrganizationID, _ = uuid.Parse(orgStr)
+		it.CategoryID, _ = uuid.Parse(catStr)
+		if sku.Valid {
+			it.SKU = &sku.String
+		}
+		if unitCost.Valid {
+			it.UnitCost = &unitCost.Float64
+		}
+		setReorderSettings(&it, parLevel, leadTime, preferredSupplier)
+		items = append(items, &it)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *itemRepo) ListWithFilters(ctx context.Context, orgID uuid.UUID, search string, categoryID *uuid.UUID, lowStockOnly bool, limit, offset int) ([]*domain.Item, error) {
+	query := `
+		SELECT id, organization_id, category_id, name, sku,
+		       unit_of_measurement, minimum_threshold, current_stock,
+		       unit_cost, is_active, track_stock, version, created_at, updated_at,
+		       par_level, lead_time_days, preferred_supplier_id
+		FROM items
+		WHERE organization_id = ?`
+
+	args := []interface{}{orgID.String()}
+
+	// Add search filter
+	if search != "" {
+		query += ` AND (LOWER(name) LIKE ? OR LOWER(sku) LIKE ?)`
+		searchPattern := "%" + strings.ToLower(search) + "%"
+		args = append(args, searchPattern, searchPattern)
+	}
+
+	// Add category filter
+	if categoryID != nil {
+		query += ` AND category_id = ?`
+		args = append(args, categoryID.String())
+	}
+
+	// Add low stock filter
+	if lowStockOnly {
+		query += ` AND track_stock = TRUE AND current_stock <= minimum_threshold`
+	}
+
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.Item
+	for rows.Next() {
+		var it domain.Item
+		var (
+			idStr, orgStr, catStr string
+			sku                   sql.NullString
+			unitCost              sql.NullFloat64
+			parLevel, leadTime    sql.NullInt64
+			preferredSupplier     sql.NullString
+		)
+		if err := rows.Scan(&idStr, &orgStr, &catStr, &it.Name, &sku,
+			&it.UnitOfMeasurement, &it.MinimumThreshold, &it.CurrentStock,
+			&unitCost, &it.IsActive, &it.TrackStock, &it.Version, &it.CreatedAt, &it.UpdatedAt,
+			&parLevel, &leadTime, &preferredSupplier,
+		); err != nil {
+			return nil, err
+		}
+		it.ID, _ = uuid.Parse(idStr)
+		it.OrganizationID, _ = uuid.Parse(orgStr)
+		it.CategoryID, _ = uuid.Parse(catStr)
+		if sku.Valid {
+			it.SKU = &sku.String
+		}
+		if unitCost.Valid {
+			it.UnitCost = &unitCost.Float64
+		}
+		setReorderSettings(&it, parLevel, leadTime, preferredSupplier)
+		items = append(items, &it)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *itemRepo) CountWithFilters(ctx context.Context, orgID uuid.UUID, search string, categoryID *uuid.UUID, lowStockOnly bool) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM items
+		WHERE organization_id = ?`
+
+	args := []interface{}{orgID.String()}
+
+	// Add search filter
+	if search != "" {
+		query += ` AND (LOWER(name) LIKE ? OR LOWER(sku) LIKE ?)`
+		searchPattern := "%" + strings.ToLower(search) + "%"
+		args = append(args, searchPattern, searchPattern)
+	}
+
+	// Add category filter
+	if categoryID != nil {
+		query += ` AND category_id = ?`
+		args = append(args, categoryID.String())
+	}
+
+	// Add low stock filter
+	if lowStockOnly {
+		query += ` AND track_stock = TRUE AND current_stock <= minimum_threshold`
+	}
+
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, query, args...)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Update overwrites the item if it still carries item.Version and bumps the
+// version; otherwise it returns ErrVersionConflict
+func (r *itemRepo) Update(ctx context.Context, item *domain.Item) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	updatedAt := time.Now().UTC()
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE items SET
+			name = ?, sku = ?, unit_of_measurement = ?,
+			minimum_threshold = ?, current_stock = ?,
+			unit_cost = ?, is_active = ?, track_stock = ?, category_id = ?, updated_at = ?,
+			par_level = ?, lead_time_days = ?, preferred_supplier_id = ?,
+			version = version + 1
+		WHERE id = ? AND version = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		item.Name, item.SKU, item.UnitOfMeasurement,
+		item.MinimumThreshold, item.CurrentStock,
+		item.UnitCost, item.IsActive, item.TrackStock, item.CategoryID.String(), updatedAt,
+		item.ParLevel, item.LeadTimeDays, nullableUUID(item.PreferredSupplierID),
+		item.ID.String(), item.Version, org,
+	)
+	if err := checkVersionedWrite(res, err); err != nil {
+		return err
+	}
+	item.UpdatedAt = updatedAt
+	item.Version++
+	return nil
+}
+
+// UpdateStock sets the stock if the item is still at expectedVersion and
+// bumps the version; otherwise it returns ErrVersionConflict
+func (r *itemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE items SET current_stock = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND organization_id = COALESCE(?, organization_id)
+	`, newStock, time.Now().UTC(), id.String(), expectedVersion, org)
+	return checkVersionedWrite(res, err)
+}
+
+func checkVersionedWrite(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// setReorderSettings copies the nullable reorder columns onto the item
+func setReorderSettings(it *domain.Item, parLevel, leadTime sql.NullInt64, preferredSupplier sql.NullString) {
+	if parLevel.Valid {
+		par := int(parLevel.Int64)
+		it.ParLevel = &par
+	}
+	if leadTime.Valid {
+		days := int(leadTime.Int64)
+		it.LeadTimeDays = &days
+	}
+	it.PreferredSupplierID = parseNullableUUID(preferredSupplier)
+}
+
+func (r *itemRepo) CountByCategory(ctx context.Context, categoryID uuid.UUID) (int, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return 0, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM items
+		WHERE category_id = ? AND organization_id = COALESCE(?, organization_id)
+	`, categoryID.String(), org)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *itemRepo) ReassignCategory(ctx context.Context, fromCategoryID, toCategoryID uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE items
+		SET category_id = ?, updated_at = ?, version = version + 1
+		WHERE category_id = ? AND organization_id = COALESCE(?, organization_id)
+	`, toCategoryID.String(), time.Now().UTC(), fromCategoryID.String(), org)
+	return err
+}
+
+// UsedInRecipes reports whether any recipe lists the item as an ingredient
+func (r *itemRepo) UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT 1 FROM recipe_components WHERE item_id = ? LIMIT 1
+	`, id.String()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *itemRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM items WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
 
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/repository"
 )
@@ -32,8 +33,12 @@ func openInMemoryDB(t *testing.T) *sql.DB {
 	unit_cost REAL,
 	is_active BOOLEAN NOT NULL,
 	track_stock BOOLEAN NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
 	created_at DATETIME NOT NULL,
-	updated_at DATETIME NOT NULL
+	updated_at DATETIME NOT NULL,
+	par_level INTEGER,
+	lead_time_days INTEGER,
+	preferred_supplier_id TEXT
 	);
 	`
 	if _, err := db.Exec(schema); err != nil {
@@ -46,8 +51,8 @@ func TestItemRepository_Create_Get_List(t *testing.T) {
 	db := openInMemoryDB(t)
 	defer db.Close()
 
-	ctx := context.Background()
-	repo := repository.NewItemRepository(db)
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
 
 	orgID := uuid.New()
 	catID := uuid.New()
@@ -91,8 +96,8 @@ func TestItemRepository_UpdateStock(t *testing.T) {
 	db := openInMemoryDB(t)
 	defer db.Close()
 
-	ctx := context.Background()
-	repo := repository.NewItemRepository(db)
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
 
 	item := &domain.Item{
 		OrganizationID:    uuid.New(),
@@ -106,21 +111,41 @@ func TestItemRepository_UpdateStock(t *testing.T) {
 	}
 	id, _ := repo.Create(ctx, item)
 
-	if err := repo.UpdateStock(ctx, id, 20); err != nil {
+	if err := repo.UpdateStock(ctx, id, 20, 1); err != nil {
 		t.Fatalf("update: %v", err)
 	}
 	got, _ := repo.GetByID(ctx, id)
 	if got.CurrentStock != 20 {
 		t.Fatalf("expected stock 20, got %d", got.CurrentStock)
 	}
+	if got.Version != 2 {
+		t.Fatalf("expected version 2, got %d", got.Version)
+	}
+
+	// A writer still holding version 1 must not overwrite the change
+	if err := repo.UpdateStock(ctx, id, 5, 1); err != repository.ErrVersionConflict {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	stale := *got
+	stale.Version = 1
+	stale.Name = "Stale"
+	if err := repo.Update(ctx, &stale); err != repository.ErrVersionConflict {
+		t.Fatalf("expected ErrVersionConflict on update, got %v", err)
+	}
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got.Version != 3 {
+		t.Fatalf("expected update to bump version to 3, got %d", got.Version)
+	}
 }
 
 func TestItemRepository_ListWithFilters_Pagination(t *testing.T) {
 	db := openInMemoryDB(t)
 	defer db.Close()
 
-	ctx := context.Background()
-	repo := repository.NewItemRepository(db)
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
 
 	orgID := uuid.New()
 	catID := uuid.New()
@@ -174,8 +199,8 @@ func TestItemRepository_CountWithFilters(t *testing.T) {
 	db := openInMemoryDB(t)
 	defer db.Close()
 
-	ctx := context.Background()
-	repo := repository.NewItemRepository(db)
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
 
 	orgID := uuid.New()
 	catID1 := uuid.New()
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewLedgerRepository(db *sql.DB, dialect database.Dialect) LedgerRepository {
+	return &ledgerRepo{
+		db:        db,
+		dialect:   dialect,
+		movements: &movementRepo{db: db, dialect: dialect},
+	}
+}
+
+type ledgerRepo struct {
+	db        *sql.DB
+	dialect   database.Dialect
+	movements *movementRepo
+}
+
+// ListOrganizations returns the organizations that have items
+func (r *ledgerRepo) ListOrganizations(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT DISTINCT organization_id FROM items ORDER BY organization_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgIDs []uuid.UUID
+	for rows.Next() {
+		var orgStr string
+		if err := rows.Scan(&orgStr); err != nil {
+			return nil, err
+		}
+		orgID, _ := uuid.Parse(orgStr)
+		orgIDs = append(orgIDs, orgID)
+	}
+
+	return orgIDs, rows.Err()
+}
+
+// ListItems returns every item of the organization, active or not, with
+// the sum of its stock levels
+func (r *ledgerRepo) ListItems(ctx context.Context, orgID uuid.UUID) ([]*domain.LedgerItem, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT i.id, i.organization_id, i.name, i.current_stock,
+		       COALESCE((SELECT SUM(sl.quantity) FROM stock_levels sl WHERE sl.item_id = i.id), 0),
+		       i.created_at
+		FROM items i
+		WHERE i.organization_id = ?
+		ORDER BY i.name, i.id
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.LedgerItem
+	for rows.Next() {
+		var item domain.LedgerItem
+		var idStr, orgStr string
+		if err := rows.Scan(&idStr, &orgStr, &item.Name, &item.CurrentStock, &item.LocationStock, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		item.ID, _ = uuid.Parse(idStr)
+		item.OrganizationID, _ = uuid.Parse(orgStr)
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// ListMovements returns every movement of the item in the order they were
+// recorded, each dated when it was recorded rather than when the stock moved
+func (r *ledgerRepo) ListMovements(ctx context.Context, itemID uuid.UUID) ([]*domain.StockMovement, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT id, item_id, movement_type, quantity,
+		       previous_stock, new_stock, location_id, to_location_id,
+		       reference, notes, reason_code, created_by, recorded_at,
+		       reversal_of, voided_at, voided_by, total_cost
+		FROM stock_movements
+		WHERE item_id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY recorded_at, id
+	`, itemID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.movements.scanMovements(rows)
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewLocationRepository(db *sql.DB, dialect database.Dialect) LocationRepository {
+	return &locationRepo{db: db, dialect: dialect}
+}
+
+type locationRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const locationColumns = `id, organization_id, name, description, is_default, is_active, created_at, updated_at`
+
+func (r *locationRepo) Create(ctx context.Context, location *domain.Location) (uuid.UUID, error) {
+	if location == nil {
+		return uuid.Nil, errors.New("location is nil")
+	}
+
+	if location.ID == uuid.Nil {
+		location.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	location.CreatedAt = now
+	location.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO locations (`+locationColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		location.ID.String(), location.OrganizationID.String(),
+		location.Name, location.Description, location.IsDefault, location.IsActive,
+		location.CreatedAt, location.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return location.ID, nil
+}
+
+func (r *locationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Location, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+locationColumns+` FROM locations WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return scanLocation(row)
+}
+
+func (r *locationRepo) GetDefault(ctx context.Context, orgID uuid.UUID) (*domain.Location, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+locationColumns+` FROM locations
+		WHERE organization_id = ? AND is_default = TRUE
+	`, orgID.String())
+	return scanLocation(row)
+}
+
+func (r *locationRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Location, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+locationColumns+` FROM locations
+		WHERE organization_id = ?
+		ORDER BY is_default DESC, name
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []*domain.Location
+	for rows.Next() {
+		location, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+func (r *locationRepo) Update(ctx context.Context, location *domain.Location) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	location.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE locations SET
+			name = ?, description = ?, is_default = ?, is_active = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		location.Name, location.Description, location.IsDefault, location.IsActive,
+		location.UpdatedAt, location.ID.String(), org,
+	)
+	return err
+}
+
+func (r *locationRepo) ClearDefault(ctx context.Context, orgID uuid.UUID) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE locations SET is_default = FALSE, updated_at = ?
+		WHERE organization_id = ? AND is_default = TRUE
+	`, time.Now().UTC(), orgID.String())
+	return err
+}
+
+// HasMovements reports whether any movement was recorded at the location
+func (r *locationRepo) HasMovements(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT 1 FROM stock_movements WHERE location_id = ? OR to_location_id = ? LIMIT 1
+	`, id.String(), id.String()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *locationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM locations WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLocation(row rowScanner) (*domain.Location, error) {
+	var location domain.Location
+	var (
+		idStr, orgStr string
+		description   sql.NullString
+	)
+
+	if err := row.Scan(
+		&idStr, &orgStr, &location.Name, &description, &location.IsDefault, &location.IsActive,
+		&location.CreatedAt, &location.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	location.ID, _ = uuid.Parse(idStr)
+	location.OrganizationID, _ = uuid.Parse(orgStr)
+	if description.Valid {
+		location.Description = &description.String
+	}
+
+	return &location, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewMovementReasonRepository(db *sql.DB, dialect database.Dialect) MovementReasonRepository {
+	return &movementReasonRepo{db: db, dialect: dialect}
+}
+
+type movementReasonRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const movementReasonColumns = `id, organization_id, code, name, is_waste, is_active, created_at, updated_at`
+
+// Create stores the reason; a reason whose code the organization already
+// has is left as it is and reported as created = false
+func (r *movementReasonRepo) Create(ctx context.Context, reason *domain.MovementReason) (bool, error) {
+	if reason == nil {
+		return false, errors.New("movement reason is nil")
+	}
+
+	if reason.ID == uuid.Nil {
+		reason.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	reason.CreatedAt = now
+	reason.UpdatedAt = now
+
+	result, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO movement_reasons (`+movementReasonColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (organization_id, code) DO NOTHING
+	`,
+		reason.ID.String(), reason.OrganizationID.String(), reason.Code, reason.Name,
+		reason.IsWaste, reason.IsActive, reason.CreatedAt, reason.UpdatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	created, err := result.RowsAffected()
+	return created > 0, err
+}
+
+func (r *movementReasonRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.MovementReason, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+movementReasonColumns+` FROM movement_reasons WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return scanMovementReason(row)
+}
+
+func (r *movementReasonRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+movementReasonColumns+` FROM movement_reasons
+		WHERE organization_id = ?
+		ORDER BY code
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*domain.MovementReason
+	for rows.Next() {
+		reason, err := scanMovementReason(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, reason)
+	}
+
+	return list, rows.Err()
+}
+
+// Update writes the reason's name, waste flag and active flag; its code
+// never changes
+func (r *movementReasonRepo) Update(ctx context.Context, reason *domain.MovementReason) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	reason.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE movement_reasons SET name = ?, is_waste = ?, is_active = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, reason.Name, reason.IsWaste, reason.IsActive, reason.UpdatedAt, reason.ID.String(), org)
+	return err
+}
+
+func scanMovementReason(row rowScanner) (*domain.MovementReason, error) {
+	var reason domain.MovementReason
+	var idStr, orgStr string
+
+	if err := row.Scan(
+		&idStr, &orgStr, &reason.Code, &reason.Name, &reason.IsWaste,
+		&reason.IsActive, &reason.CreatedAt, &reason.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	reason.ID, _ = uuid.Parse(idStr)
+	reason.OrganizationID, _ = uuid.Parse(orgStr)
+
+	return &reason, nil
+}
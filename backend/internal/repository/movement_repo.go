@@ -7,18 +7,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 )
 
-func NewMovementRepository(db *sql.DB) MovementRepository {
-	return &movementRepoSQLite{db: db}
+func NewMovementRepository(db *sql.DB, dialect database.Dialect) MovementRepository {
+	return &movementRepo{db: db, dialect: dialect}
 }
 
-type movementRepoSQLite struct {
-	db *sql.DB
+type movementRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
 }
 
-func (r *movementRepoSQLite) Create(ctx context.Context, movement *domain.StockMovement) (uuid.UUID, error) {
+func (r *movementRepo) Create(ctx context.Context, movement *domain.StockMovement) (uuid.UUID, error) {
 	if movement == nil {
 		return uuid.Nil, errors.New("movement is nil")
 	}
@@ -26,22 +28,29 @@ func (r *movementRepoSQLite) Create(ctx context.Context, movement *domain.StockM
 	if movement.ID == uuid.Nil {
 		movement.ID = uuid.New()
 	}
+	now := time.Now().UTC()
 	if movement.CreatedAt.IsZero() {
-		movement.CreatedAt = time.Now().UTC()
+		movement.CreatedAt = now
+	}
+	if movement.RecordedAt.IsZero() {
+		movement.RecordedAt = now
 	}
 
-	_, err := r.db.ExecContext(ctx, `
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
 		INSERT INTO stock_movements (
 			id, item_id, movement_type, quantity,
-			previous_stock, new_stock, reference, notes,
-			created_by, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			previous_stock, new_stock, location_id, to_location_id,
+			reference, notes, reason_code, created_by, created_at, reversal_of,
+			total_cost, recorded_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		movement.ID.String(), movement.ItemID.String(),
 		movement.MovementType, movement.Quantity,
 		movement.PreviousStock, movement.NewStock,
-		movement.Reference, movement.Notes,
-		movement.CreatedBy.String(), movement.CreatedAt,
+		nullableUUID(movement.LocationID), nullableUUID(movement.ToLocationID),
+		movement.Reference, movement.Notes, movement.ReasonCode,
+		movement.CreatedBy.String(), movement.CreatedAt, nullableUUID(movement.ReversalOf),
+		movement.TotalCost, movement.RecordedAt,
 	)
 	if err != nil {
 		return uuid.Nil, err
@@ -49,24 +58,37 @@ func (r *movementRepoSQLite) Create(ctx context.Context, movement *domain.StockM
 	return movement.ID, nil
 }
 
-func (r *movementRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.StockMovement, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *movementRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.StockMovement, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
 		SELECT id, item_id, movement_type, quantity,
-		       previous_stock, new_stock, reference, notes,
-		       created_by, created_at
-		FROM stock_movements WHERE id = ?
-	`, id.String())
+		       previous_stock, new_stock, location_id, to_location_id,
+		       reference, notes, reason_code, created_by, created_at,
+		       reversal_of, voided_at, voided_by, total_cost
+		FROM stock_movements
+		WHERE id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, id.String(), org)
 
 	var mv domain.StockMovement
 	var (
 		idStr, itemStr, createdByStr string
-		reference, notes             sql.NullString
+		reference, notes, reasonCode sql.NullString
+		locationStr, toLocationStr   sql.NullString
+		reversalOf, voidedBy         sql.NullString
+		voidedAt                     sql.NullTime
+		totalCost                    sql.NullFloat64
 	)
 
 	if err := row.Scan(
 		&idStr, &itemStr, &mv.MovementType, &mv.Quantity,
-		&mv.PreviousStock, &mv.NewStock, &reference, &notes,
-		&createdByStr, &mv.CreatedAt,
+		&mv.PreviousStock, &mv.NewStock, &locationStr, &toLocationStr,
+		&reference, &notes, &reasonCode, &createdByStr, &mv.CreatedAt,
+		&reversalOf, &voidedAt, &voidedBy, &totalCost,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -77,26 +99,65 @@ func (r *movementRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain
 	mv.ID, _ = uuid.Parse(idStr)
 	mv.ItemID, _ = uuid.Parse(itemStr)
 	mv.CreatedBy, _ = uuid.Parse(createdByStr)
+	mv.LocationID = parseNullableUUID(locationStr)
+	mv.ToLocationID = parseNullableUUID(toLocationStr)
 	if reference.Valid {
 		mv.Reference = &reference.String
 	}
 	if notes.Valid {
 		mv.Notes = &notes.String
 	}
+	if reasonCode.Valid {
+		mv.ReasonCode = &reasonCode.String
+	}
+	setMovementVoid(&mv, reversalOf, voidedAt, voidedBy)
+	if totalCost.Valid {
+		mv.TotalCost = &totalCost.Float64
+	}
 
 	return &mv, nil
 }
 
-func (r *movementRepoSQLite) ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
-	rows, err := r.db.QueryContext(ctx, `
+// Void marks a movement voided by a reversal. It reports false when the
+// movement was already voided.
+func (r *movementRepo) Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return false, err
+	}
+	result, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_movements SET voided_at = ?, voided_by = ?
+		WHERE id = ? AND voided_at IS NULL AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, at, voidedBy.String(), id.String(), org)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *movementRepo) ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT id, item_id, movement_type, quantity,
-		       previous_stock, new_stock, reference, notes,
-		       created_by, created_at
+		       previous_stock, new_stock, location_id, to_location_id,
+		       reference, notes, reason_code, created_by, created_at,
+		       reversal_of, voided_at, voided_by, total_cost
 		FROM stock_movements
-		WHERE item_id = ?
+		WHERE item_id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
-	`, itemID.String(), limit, offset)
+	`, itemID.String(), org, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -105,11 +166,12 @@ func (r *movementRepoSQLite) ListByItem(ctx context.Context, itemID uuid.UUID, l
 	return r.scanMovements(rows)
 }
 
-func (r *movementRepoSQLite) ListByOrganization(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
-	rows, err := r.db.QueryContext(ctx, `
+func (r *movementRepo) ListByOrganization(ctx context.Context, orgID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT sm.id, sm.item_id, sm.movement_type, sm.quantity,
-		       sm.previous_stock, sm.new_stock, sm.reference, sm.notes,
-		       sm.created_by, sm.created_at
+		       sm.previous_stock, sm.new_stock, sm.location_id, sm.to_location_id,
+		       sm.reference, sm.notes, sm.reason_code, sm.created_by, sm.created_at,
+		       sm.reversal_of, sm.voided_at, sm.voided_by, sm.total_cost
 		FROM stock_movements sm
 		JOIN items i ON sm.item_id = i.id
 		WHERE i.organization_id = ?
@@ -124,11 +186,12 @@ func (r *movementRepoSQLite) ListByOrganization(ctx context.Context, orgID uuid.
 	return r.scanMovements(rows)
 }
 
-func (r *movementRepoSQLite) ListRecent(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.StockMovement, error) {
-	rows, err := r.db.QueryContext(ctx, `
+func (r *movementRepo) ListRecent(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.StockMovement, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
 		SELECT sm.id, sm.item_id, sm.movement_type, sm.quantity,
-		       sm.previous_stock, sm.new_stock, sm.reference, sm.notes,
-		       sm.created_by, sm.created_at,
+		       sm.previous_stock, sm.new_stock, sm.location_id, sm.to_location_id,
+		       sm.reference, sm.notes, sm.reason_code, sm.created_by, sm.created_at,
+		       sm.reversal_of, sm.voided_at, sm.voided_by, sm.total_cost,
 		       i.id, i.organization_id, i.category_id, i.name, i.sku,
 		       i.unit_of_measurement, i.minimum_threshold, i.current_stock,
 		       i.unit_cost, i.is_active, i.track_stock, i.created_at, i.updated_at
@@ -147,19 +210,24 @@ func (r *movementRepoSQLite) ListRecent(ctx context.Context, orgID uuid.UUID, li
 }
 
 // scanMovements is a helper function to scan multiple movement rows
-func (r *movementRepoSQLite) scanMovements(rows *sql.Rows) ([]*domain.StockMovement, error) {
+func (r *movementRepo) scanMovements(rows *sql.Rows) ([]*domain.StockMovement, error) {
 	var movements []*domain.StockMovement
 	for rows.Next() {
 		var mv domain.StockMovement
 		var (
 			idStr, itemStr, createdByStr string
-			reference, notes             sql.NullString
+			reference, notes, reasonCode sql.NullString
+			locationStr, toLocationStr   sql.NullString
+			reversalOf, voidedBy         sql.NullString
+			voidedAt                     sql.NullTime
+			totalCost                    sql.NullFloat64
 		)
 
 		if err := rows.Scan(
 			&idStr, &itemStr, &mv.MovementType, &mv.Quantity,
-			&mv.PreviousStock, &mv.NewStock, &reference, &notes,
-			&createdByStr, &mv.CreatedAt,
+			&mv.PreviousStock, &mv.NewStock, &locationStr, &toLocationStr,
+			&reference, &notes, &reasonCode, &createdByStr, &mv.CreatedAt,
+			&reversalOf, &voidedAt, &voidedBy, &totalCost,
 		); err != nil {
 			return nil, err
 		}
@@ -167,12 +235,21 @@ func (r *movementRepoSQLite) scanMovements(rows *sql.Rows) ([]*domain.StockMovem
 		mv.ID, _ = uuid.Parse(idStr)
 		mv.ItemID, _ = uuid.Parse(itemStr)
 		mv.CreatedBy, _ = uuid.Parse(createdByStr)
+		mv.LocationID = parseNullableUUID(locationStr)
+		mv.ToLocationID = parseNullableUUID(toLocationStr)
 		if reference.Valid {
 			mv.Reference = &reference.String
 		}
 		if notes.Valid {
 			mv.Notes = &notes.String
 		}
+		if reasonCode.Valid {
+			mv.ReasonCode = &reasonCode.String
+		}
+		setMovementVoid(&mv, reversalOf, voidedAt, voidedBy)
+		if totalCost.Valid {
+			mv.TotalCost = &totalCost.Float64
+		}
 		movements = append(movements, &mv)
 	}
 
@@ -180,23 +257,29 @@ func (r *movementRepoSQLite) scanMovements(rows *sql.Rows) ([]*domain.StockMovem
 }
 
 // scanMovementsWithItems is a helper function to scan movement rows with joined item data
-func (r *movementRepoSQLite) scanMovementsWithItems(rows *sql.Rows) ([]*domain.StockMovement, error) {
+func (r *movementRepo) scanMovementsWithItems(rows *sql.Rows) ([]*domain.StockMovement, error) {
 	var movements []*domain.StockMovement
 	for rows.Next() {
 		var mv domain.StockMovement
 		var item domain.Item
 		var (
-			mvIDStr, itemIDStr, createdByStr                     string
-			itemOrgIDStr, itemCatIDStr                           string
-			reference, notes, itemSKU                            sql.NullString
-			itemUnitCost                                         sql.NullFloat64
-			itemIsActive, itemTrackStock                         bool
+			mvIDStr, itemIDStr, createdByStr string
+			itemOrgIDStr, itemCatIDStr       string
+			reference, notes, itemSKU        sql.NullString
+			reasonCode                       sql.NullString
+			locationStr, toLocationStr       sql.NullString
+			reversalOf, voidedBy             sql.NullString
+			voidedAt                         sql.NullTime
+			totalCost                        sql.NullFloat64
+			itemUnitCost                     sql.NullFloat64
+			itemIsActive, itemTrackStock     bool
 		)
 
 		if err := rows.Scan(
 			&mvIDStr, &itemIDStr, &mv.MovementType, &mv.Quantity,
-			&mv.PreviousStock, &mv.NewStock, &reference, &notes,
-			&createdByStr, &mv.CreatedAt,
+			&mv.PreviousStock, &mv.NewStock, &locationStr, &toLocationStr,
+			&reference, &notes, &reasonCode, &createdByStr, &mv.CreatedAt,
+			&reversalOf, &voidedAt, &voidedBy, &totalCost,
 			&itemIDStr, &itemOrgIDStr, &itemCatIDStr, &item.Name, &itemSKU,
 			&item.UnitOfMeasurement, &item.MinimumThreshold, &item.CurrentStock,
 			&itemUnitCost, &itemIsActive, &itemTrackStock, &item.CreatedAt, &item.UpdatedAt,
@@ -207,12 +290,21 @@ func (r *movementRepoSQLite) scanMovementsWithItems(rows *sql.Rows) ([]*domain.S
 		mv.ID, _ = uuid.Parse(mvIDStr)
 		mv.ItemID, _ = uuid.Parse(itemIDStr)
 		mv.CreatedBy, _ = uuid.Parse(createdByStr)
+		mv.LocationID = parseNullableUUID(locationStr)
+		mv.ToLocationID = parseNullableUUID(toLocationStr)
 		if reference.Valid {
 			mv.Reference = &reference.String
 		}
 		if notes.Valid {
 			mv.Notes = &notes.String
 		}
+		if reasonCode.Valid {
+			mv.ReasonCode = &reasonCode.String
+		}
+		setMovementVoid(&mv, reversalOf, voidedAt, voidedBy)
+		if totalCost.Valid {
+			mv.TotalCost = &totalCost.Float64
+		}
 
 		// Parse item fields
 		item.ID, _ = uuid.Parse(itemIDStr)
@@ -233,3 +325,33 @@ func (r *movementRepoSQLite) scanMovementsWithItems(rows *sql.Rows) ([]*domain.S
 
 	return movements, rows.Err()
 }
+
+// setMovementVoid sets the reversal columns of a scanned movement
+func setMovementVoid(mv *domain.StockMovement, reversalOf sql.NullString, voidedAt sql.NullTime, voidedBy sql.NullString) {
+	mv.ReversalOf = parseNullableUUID(reversalOf)
+	if voidedAt.Valid {
+		mv.VoidedAt = &voidedAt.Time
+	}
+	mv.VoidedBy = parseNullableUUID(voidedBy)
+}
+
+// nullableUUID converts an optional ID to a value for a nullable TEXT/UUID column
+func nullableUUID(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
+// parseNullableUUID is the inverse of nullableUUID
+func parseNullableUUID(s sql.NullString) *uuid.UUID {
+	if !s.Valid {
+		return nil
+	}
+	id, err := uuid.Parse(s.String)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
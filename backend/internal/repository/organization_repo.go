@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewOrganizationRepository(db *sql.DB, dialect database.Dialect) OrganizationRepository {
+	return &organizationRepo{db: db, dialect: dialect}
+}
+
+type organizationRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const organizationColumns = `o.id, o.name, o.slug, o.settings, o.costing_method, o.created_at, o.updated_at`
+
+const membershipColumns = `organization_id, user_id, role, is_active, created_at, updated_at`
+
+func (r *organizationRepo) Create(ctx context.Context, org *domain.Organization) (uuid.UUID, error) {
+	if org == nil {
+		return uuid.Nil, errors.New("organization is nil")
+	}
+
+	if org.ID == uuid.Nil {
+		org.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	org.CreatedAt = now
+	org.UpdatedAt = now
+	org.Settings = org.Settings.WithDefaults()
+
+	settings, err := mergeSettings(nil, org.Settings)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO organizations (
+			id, name, slug, settings, costing_method, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		org.ID.String(), org.Name, org.Slug, settings,
+		org.Settings.CostingMethod, org.CreatedAt, org.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return org.ID, nil
+}
+
+func (r *organizationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Organization, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+organizationColumns+` FROM organizations o WHERE o.id = ?
+	`, id.String())
+	return scanOrganization(row)
+}
+
+func (r *organizationRepo) GetBySlug(ctx context.Context, slug string) (*domain.Organization, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+organizationColumns+` FROM organizations o WHERE o.slug = ?
+	`, slug)
+	return scanOrganization(row)
+}
+
+// ListByUser lists the organizations the user is an active member of, with
+// their role in each, in the order they joined them
+func (r *organizationRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.Organization, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+organizationColumns+`, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ? AND m.is_active = TRUE
+		ORDER BY m.created_at, o.name
+	`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*domain.Organization
+	for rows.Next() {
+		var role domain.UserRole
+		org, err := scanOrganizationRow(rows, &role)
+		if err != nil {
+			return nil, err
+		}
+		org.Role = role
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// Update changes the organization's name, slug and settings. Keys of the
+// settings column other than the ones OrganizationSettings knows are kept.
+func (r *organizationRepo) Update(ctx context.Context, org *domain.Organization) error {
+	q := conn(ctx, r.db, r.dialect)
+
+	var raw []byte
+	if err := q.QueryRowContext(ctx, `
+		SELECT settings FROM organizations WHERE id = ?
+	`, org.ID.String()).Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	settings, err := mergeSettings(raw, org.Settings)
+	if err != nil {
+		return err
+	}
+
+	org.UpdatedAt = time.Now().UTC()
+	_, err = q.ExecContext(ctx, `
+		UPDATE organizations SET
+			name = ?, slug = ?, settings = ?, costing_method = ?, updated_at = ?
+		WHERE id = ?
+	`,
+		org.Name, org.Slug, settings, org.Settings.CostingMethod, org.UpdatedAt,
+		org.ID.String(),
+	)
+	return err
+}
+
+// Delete deletes the organization with everything it holds
+func (r *organizationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM organizations WHERE id = ?
+	`, id.String())
+	return err
+}
+
+func (r *organizationRepo) AddMember(ctx context.Context, m *domain.Membership) error {
+	if m == nil {
+		return errors.New("membership is nil")
+	}
+
+	now := time.Now().UTC()
+	m.CreatedAt = now
+	m.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO organization_members (`+membershipColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		m.OrganizationID.String(), m.UserID.String(), m.Role, m.IsActive,
+		m.CreatedAt, m.UpdatedAt,
+	)
+	return err
+}
+
+func (r *organizationRepo) GetMember(ctx context.Context, orgID, userID uuid.UUID) (*domain.Membership, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+membershipColumns+` FROM organization_members
+		WHERE organization_id = ? AND user_id = ?
+	`, orgID.String(), userID.String())
+
+	var m domain.Membership
+	var orgStr, userStr string
+	if err := row.Scan(&orgStr, &userStr, &m.Role, &m.IsActive, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	m.OrganizationID, _ = uuid.Parse(orgStr)
+	m.UserID, _ = uuid.Parse(userStr)
+	return &m, nil
+}
+
+// CountMembers counts the organization's members, deactivated ones included
+func (r *organizationRepo) CountMembers(ctx context.Context, orgID uuid.UUID) (int, error) {
+	var n int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM organization_members WHERE organization_id = ?
+	`, orgID.String()).Scan(&n)
+	return n, err
+}
+
+// UpdateMember changes the member's role and whether they are active. When
+// the organization is the user's home organization, users.role follows.
+// Callers run it in a transaction.
+func (r *organizationRepo) UpdateMember(ctx context.Context, m *domain.Membership) error {
+	q := conn(ctx, r.db, r.dialect)
+
+	m.UpdatedAt = time.Now().UTC()
+	if _, err := q.ExecContext(ctx, `
+		UPDATE organization_members SET role = ?, is_active = ?, updated_at = ?
+		WHERE organization_id = ? AND user_id = ?
+	`, m.Role, m.IsActive, m.UpdatedAt, m.OrganizationID.String(), m.UserID.String()); err != nil {
+		return err
+	}
+
+	_, err := q.ExecContext(ctx, `
+		UPDATE users SET role = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, m.Role, m.UpdatedAt, m.UserID.String(), m.OrganizationID.String())
+	return err
+}
+
+func (r *organizationRepo) RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?
+	`, orgID.String(), userID.String())
+	return err
+}
+
+// mergeSettings writes the settings kept in the settings column over the
+// JSON object raw holds
+func mergeSettings(raw []byte, settings domain.OrganizationSettings) (string, error) {
+	values := map[string]interface{}{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return "", err
+		}
+	}
+	values["currency"] = settings.Currency
+	values["timezone"] = settings.Timezone
+
+	out, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func scanOrganization(row *sql.Row) (*domain.Organization, error) {
+	org, err := scanOrganizationRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return org, err
+}
+
+// scanOrganizationRow scans the organization columns, followed by the
+// columns selected after them into extra
+func scanOrganizationRow(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*domain.Organization, error) {
+	var org domain.Organization
+	var idStr string
+	var raw []byte
+
+	dest := []interface{}{
+		&idStr, &org.Name, &org.Slug, &raw, &org.Settings.CostingMethod,
+		&org.CreatedAt, &org.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	org.ID, _ = uuid.Parse(idStr)
+	if len(raw) > 0 {
+		var stored struct {
+			Currency string `json:"currency"`
+			Timezone string `json:"timezone"`
+		}
+		if err := json.Unmarshal(raw, &stored); err != nil {
+			return nil, err
+		}
+		org.Settings.Currency = stored.Currency
+		org.Settings.Timezone = stored.Timezone
+	}
+	org.Settings = org.Settings.WithDefaults()
+
+	return &org, nil
+}
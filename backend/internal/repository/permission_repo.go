@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewPermissionRepository(db *sql.DB, dialect database.Dialect) PermissionRepository {
+	return &permissionRepo{db: db, dialect: dialect}
+}
+
+type permissionRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const permissionOverrideColumns = `role, permission, granted`
+
+func (r *permissionRepo) ListOverrides(ctx context.Context, orgID uuid.UUID) ([]*domain.PermissionOverride, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+permissionOverrideColumns+` FROM role_permissions
+		WHERE organization_id = ?
+		ORDER BY role, permission
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissionOverrides(rows)
+}
+
+func (r *permissionRepo) ListRoleOverrides(ctx context.Context, orgID uuid.UUID, role domain.UserRole) ([]*domain.PermissionOverride, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+permissionOverrideColumns+` FROM role_permissions
+		WHERE organization_id = ? AND role = ?
+		ORDER BY permission
+	`, orgID.String(), role)
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissionOverrides(rows)
+}
+
+// ReplaceRoleOverrides deletes the role's overrides and inserts the given
+// ones. Callers run it in a transaction.
+func (r *permissionRepo) ReplaceRoleOverrides(ctx context.Context, orgID uuid.UUID, role domain.UserRole, overrides []*domain.PermissionOverride) error {
+	q := conn(ctx, r.db, r.dialect)
+	if _, err := q.ExecContext(ctx, `
+		DELETE FROM role_permissions WHERE organization_id = ? AND role = ?
+	`, orgID.String(), role); err != nil {
+		return err
+	}
+
+	for _, o := range overrides {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO role_permissions (organization_id, `+permissionOverrideColumns+`)
+			VALUES (?, ?, ?, ?)
+		`, orgID.String(), role, o.Permission, o.Granted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanPermissionOverrides(rows *sql.Rows) ([]*domain.PermissionOverride, error) {
+	defer rows.Close()
+
+	var overrides []*domain.PermissionOverride
+	for rows.Next() {
+		var o domain.PermissionOverride
+		if err := rows.Scan(&o.Role, &o.Permission, &o.Granted); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, &o)
+	}
+	return overrides, rows.Err()
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+)
+
+func NewPOSImportRepository(db *sql.DB, dialect database.Dialect) POSImportRepository {
+	return &posImportRepo{db: db, dialect: dialect}
+}
+
+type posImportRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// MarkBillImported records that the bill's sales were posted. It returns
+// false when the bill was already imported, including by a concurrent import
+// that committed first.
+func (r *posImportRepo) MarkBillImported(ctx context.Context, orgID uuid.UUID, billNumber string, userID uuid.UUID) (bool, error) {
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO pos_imported_bills (organization_id, bill_number, imported_by, imported_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (organization_id, bill_number) DO NOTHING
+	`, orgID.String(), billNumber, userID.String(), time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
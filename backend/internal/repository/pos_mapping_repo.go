@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewPOSMappingRepository(db *sql.DB, dialect database.Dialect) POSMappingRepository {
+	return &posMappingRepo{db: db, dialect: dialect}
+}
+
+type posMappingRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const posMappingColumns = `m.id, m.organization_id, m.code, m.recipe_id, m.portions, m.created_at, m.updated_at, r.name`
+
+// Upsert maps the code to the mapping's recipe, replacing any previous
+// mapping of the code in the organization
+func (r *posMappingRepo) Upsert(ctx context.Context, mapping *domain.POSMapping) error {
+	if mapping == nil {
+		return errors.New("mapping is nil")
+	}
+
+	if mapping.ID == uuid.Nil {
+		mapping.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO pos_mappings (id, organization_id, code, recipe_id, portions, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (organization_id, code) DO UPDATE SET
+			recipe_id = EXCLUDED.recipe_id, portions = EXCLUDED.portions, updated_at = EXCLUDED.updated_at
+	`,
+		mapping.ID.String(), mapping.OrganizationID.String(), mapping.Code,
+		mapping.RecipeID.String(), mapping.Portions, now, now,
+	)
+	return err
+}
+
+func (r *posMappingRepo) GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.POSMapping, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+posMappingColumns+`
+		FROM pos_mappings m
+		JOIN recipes r ON m.recipe_id = r.id
+		WHERE m.organization_id = ? AND m.code = ?
+	`, orgID.String(), code)
+	return scanPOSMapping(row)
+}
+
+func (r *posMappingRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.POSMapping, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+posMappingColumns+`
+		FROM pos_mappings m
+		JOIN recipes r ON m.recipe_id = r.id
+		WHERE m.organization_id = ?
+		ORDER BY m.code
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*domain.POSMapping
+	for rows.Next() {
+		mapping, err := scanPOSMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+func (r *posMappingRepo) Delete(ctx context.Context, orgID uuid.UUID, code string) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM pos_mappings WHERE organization_id = ? AND code = ?
+	`, orgID.String(), code)
+	return err
+}
+
+func scanPOSMapping(row rowScanner) (*domain.POSMapping, error) {
+	var mapping domain.POSMapping
+	var idStr, orgStr, recipeStr string
+
+	if err := row.Scan(
+		&idStr, &orgStr, &mapping.Code, &recipeStr, &mapping.Portions,
+		&mapping.CreatedAt, &mapping.UpdatedAt, &mapping.RecipeName,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	mapping.ID, _ = uuid.Parse(idStr)
+	mapping.OrganizationID, _ = uuid.Parse(orgStr)
+	mapping.RecipeID, _ = uuid.Parse(recipeStr)
+
+	return &mapping, nil
+}
@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewPurchaseOrderRepository(db *sql.DB, dialect database.Dialect) PurchaseOrderRepository {
+	return &purchaseOrderRepo{db: db, dialect: dialect}
+}
+
+type purchaseOrderRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const purchaseOrderColumns = `id, organization_id, supplier_id, number, status, expected_at, notes, created_by, sent_at, received_at, created_at, updated_at`
+
+// purchaseOrderQuery selects orders with the name of their supplier; callers
+// append the WHERE clause
+const purchaseOrderQuery = `
+	SELECT po.id, po.organization_id, po.supplier_id, po.number, po.status, po.expected_at, po.notes,
+		po.created_by, po.sent_at, po.received_at, po.created_at, po.updated_at, s.name
+	FROM purchase_orders po
+	JOIN suppliers s ON po.supplier_id = s.id
+`
+
+// purchaseOrderLineQuery selects lines with the name of their item; callers
+// append the WHERE clause
+const purchaseOrderLineQuery = `
+	SELECT l.id, l.purchase_order_id, l.item_id, l.unit, l.unit_factor, l.ordered_quantity,
+		l.received_quantity, l.unit_price, l.position, i.name
+	FROM purchase_order_lines l
+	JOIN purchase_orders po ON l.purchase_order_id = po.id
+	JOIN items i ON l.item_id = i.id
+`
+
+// Create inserts the order and its lines. Run it inside RunInTx so a failing
+// line leaves no partial order behind.
+func (r *purchaseOrderRepo) Create(ctx context.Context, po *domain.PurchaseOrder) (uuid.UUID, error) {
+	if po == nil {
+		return uuid.Nil, errors.New("purchase order is nil")
+	}
+
+	if po.ID == uuid.Nil {
+		po.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	po.CreatedAt = now
+	po.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO purchase_orders (`+purchaseOrderColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		po.ID.String(), po.OrganizationID.String(), po.SupplierID.String(), po.Number, po.Status,
+		po.ExpectedAt, po.Notes, po.CreatedBy.String(), po.SentAt, po.ReceivedAt,
+		po.CreatedAt, po.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := r.insertLines(ctx, po); err != nil {
+		return uuid.Nil, err
+	}
+	return po.ID, nil
+}
+
+func (r *purchaseOrderRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, purchaseOrderQuery+`
+		WHERE po.id = ? AND po.organization_id = COALESCE(?, po.organization_id)
+	`, id.String(), org)
+	po, err := scanPurchaseOrder(row)
+	if err != nil || po == nil {
+		return po, err
+	}
+
+	lines, err := r.listLines(ctx, `
+		WHERE l.purchase_order_id = ? AND po.organization_id = COALESCE(?, po.organization_id)
+	`, id.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	po.Lines = lines[po.ID]
+	return po, nil
+}
+
+// List lists the organization's orders with their lines, newest first, only
+// those in status when it is given
+func (r *purchaseOrderRepo) List(ctx context.Context, orgID uuid.UUID, status *domain.PurchaseOrderStatus) ([]*domain.PurchaseOrder, error) {
+	where := `WHERE po.organization_id = ?`
+	args := []interface{}{orgID.String()}
+	if status != nil {
+		where += ` AND po.status = ?`
+		args = append(args, *status)
+	}
+
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, purchaseOrderQuery+where+`
+		ORDER BY po.number DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*domain.PurchaseOrder
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, po)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lines, err := r.listLines(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, po := range orders {
+		po.Lines = lines[po.ID]
+	}
+	return orders, nil
+}
+
+// NextNumber returns the number for the organization's next order
+func (r *purchaseOrderRepo) NextNumber(ctx context.Context, orgID uuid.UUID) (int, error) {
+	var number int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(number), 0) + 1 FROM purchase_orders WHERE organization_id = ?
+	`, orgID.String()).Scan(&number)
+	return number, err
+}
+
+// Update writes the order's own fields; its lines are left as they are
+func (r *purchaseOrderRepo) Update(ctx context.Context, po *domain.PurchaseOrder) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	po.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE purchase_orders SET
+			supplier_id = ?, status = ?, expected_at = ?, notes = ?, sent_at = ?, received_at = ?,
+			updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		po.SupplierID.String(), po.Status, po.ExpectedAt, po.Notes, po.SentAt, po.ReceivedAt,
+		po.UpdatedAt, po.ID.String(), org,
+	)
+	return err
+}
+
+// ReplaceLines deletes the order's lines and inserts po.Lines instead. Run it
+// inside RunInTx.
+func (r *purchaseOrderRepo) ReplaceLines(ctx context.Context, po *domain.PurchaseOrder) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM purchase_order_lines WHERE purchase_order_id = ? AND purchase_order_id IN (
+			SELECT id FROM purchase_orders WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, po.ID.String(), org)
+	if err != nil {
+		return err
+	}
+	return r.insertLines(ctx, po)
+}
+
+// SetReceivedQuantity records how much of the line has been received in all
+func (r *purchaseOrderRepo) SetReceivedQuantity(ctx context.Context, lineID uuid.UUID, quantity int) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE purchase_order_lines SET received_quantity = ?
+		WHERE id = ? AND purchase_order_id IN (
+			SELECT id FROM purchase_orders WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, quantity, lineID.String(), org)
+	return err
+}
+
+func (r *purchaseOrderRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM purchase_orders WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
+
+// CreateReceipt inserts a goods receipt and its lines. Run it inside RunInTx
+// together with the movements it records.
+func (r *purchaseOrderRepo) CreateReceipt(ctx context.Context, receipt *domain.GoodsReceipt) (uuid.UUID, error) {
+	if receipt == nil {
+		return uuid.Nil, errors.New("goods receipt is nil")
+	}
+
+	if receipt.ID == uuid.Nil {
+		receipt.ID = uuid.New()
+	}
+	receipt.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO goods_receipts (id, purchase_order_id, received_by, received_at, notes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		receipt.ID.String(), receipt.PurchaseOrderID.String(), receipt.ReceivedBy.String(),
+		receipt.ReceivedAt, receipt.Notes, receipt.CreatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, line := range receipt.Lines {
+		if line.ID == uuid.Nil {
+			line.ID = uuid.New()
+		}
+		line.ReceiptID = receipt.ID
+
+		_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+			INSERT INTO goods_receipt_lines (id, receipt_id, line_id, movement_id, quantity, unit_price)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`,
+			line.ID.String(), line.ReceiptID.String(), line.LineID.String(), line.MovementID.String(),
+			line.Quantity, line.UnitPrice,
+		)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return receipt.ID, nil
+}
+
+// ListReceipts lists the receipts posted against the order with their
+// lines, oldest first
+func (r *purchaseOrderRepo) ListReceipts(ctx context.Context, poID uuid.UUID) ([]*domain.GoodsReceipt, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT id, purchase_order_id, received_by, received_at, notes, created_at
+		FROM goods_receipts
+		WHERE purchase_order_id = ? AND purchase_order_id IN (
+			SELECT id FROM purchase_orders WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY received_at, created_at
+	`, poID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipts []*domain.GoodsReceipt
+	byID := make(map[uuid.UUID]*domain.GoodsReceipt)
+	for rows.Next() {
+		var receipt domain.GoodsReceipt
+		var (
+			idStr, poStr, userStr string
+			notes                 sql.NullString
+		)
+		if err := rows.Scan(&idStr, &poStr, &userStr, &receipt.ReceivedAt, &notes, &receipt.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		receipt.ID, _ = uuid.Parse(idStr)
+		receipt.PurchaseOrderID, _ = uuid.Parse(poStr)
+		receipt.ReceivedBy, _ = uuid.Parse(userStr)
+		if notes.Valid {
+			receipt.Notes = &notes.String
+		}
+		receipts = append(receipts, &receipt)
+		byID[receipt.ID] = &receipt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lineRows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT rl.id, rl.receipt_id, rl.line_id, rl.movement_id, rl.quantity, rl.unit_price
+		FROM goods_receipt_lines rl
+		JOIN goods_receipts gr ON rl.receipt_id = gr.id
+		JOIN purchase_order_lines l ON rl.line_id = l.id
+		WHERE gr.purchase_order_id = ? AND gr.purchase_order_id IN (
+			SELECT id FROM purchase_orders WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY l.position
+	`, poID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+
+	for lineRows.Next() {
+		var line domain.GoodsReceiptLine
+		var idStr, receiptStr, lineStr, movementStr string
+		if err := lineRows.Scan(&idStr, &receiptStr, &lineStr, &movementStr, &line.Quantity, &line.UnitPrice); err != nil {
+			return nil, err
+		}
+
+		line.ID, _ = uuid.Parse(idStr)
+		line.ReceiptID, _ = uuid.Parse(receiptStr)
+		line.LineID, _ = uuid.Parse(lineStr)
+		line.MovementID, _ = uuid.Parse(movementStr)
+		if receipt := byID[line.ReceiptID]; receipt != nil {
+			receipt.Lines = append(receipt.Lines, &line)
+		}
+	}
+
+	return receipts, lineRows.Err()
+}
+
+func (r *purchaseOrderRepo) insertLines(ctx context.Context, po *domain.PurchaseOrder) error {
+	for i, line := range po.Lines {
+		if line.ID == uuid.Nil {
+			line.ID = uuid.New()
+		}
+		line.PurchaseOrderID = po.ID
+		line.Position = i
+
+		_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+			INSERT INTO purchase_order_lines (
+				id, purchase_order_id, item_id, unit, unit_factor, ordered_quantity,
+				received_quantity, unit_price, position
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			line.ID.String(), line.PurchaseOrderID.String(), line.ItemID.String(), line.Unit,
+			line.UnitFactor, line.OrderedQuantity, line.ReceivedQuantity, line.UnitPrice, line.Position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listLines returns the lines matching where, grouped by order and in
+// position order
+func (r *purchaseOrderRepo) listLines(ctx context.Context, where string, args ...interface{}) (map[uuid.UUID][]*domain.PurchaseOrderLine, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, purchaseOrderLineQuery+where+`
+		ORDER BY l.purchase_order_id, l.position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[uuid.UUID][]*domain.PurchaseOrderLine)
+	for rows.Next() {
+		var line domain.PurchaseOrderLine
+		var idStr, poStr, itemStr string
+		if err := rows.Scan(
+			&idStr, &poStr, &itemStr, &line.Unit, &line.UnitFactor, &line.OrderedQuantity,
+			&line.ReceivedQuantity, &line.UnitPrice, &line.Position, &line.ItemName,
+		); err != nil {
+			return nil, err
+		}
+
+		line.ID, _ = uuid.Parse(idStr)
+		line.PurchaseOrderID, _ = uuid.Parse(poStr)
+		line.ItemID, _ = uuid.Parse(itemStr)
+		line.Tally()
+		lines[line.PurchaseOrderID] = append(lines[line.PurchaseOrderID], &line)
+	}
+
+	return lines, rows.Err()
+}
+
+func scanPurchaseOrder(row rowScanner) (*domain.PurchaseOrder, error) {
+	var po domain.PurchaseOrder
+	var (
+		idStr, orgStr, supplierStr, userStr string
+		notes                               sql.NullString
+		expectedAt, sentAt, receivedAt      sql.NullTime
+	)
+
+	if err := row.Scan(
+		&idStr, &orgStr, &supplierStr, &po.Number, &po.Status, &expectedAt, &notes,
+		&userStr, &sentAt, &receivedAt, &po.CreatedAt, &po.UpdatedAt, &po.SupplierName,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	po.ID, _ = uuid.Parse(idStr)
+	po.OrganizationID, _ = uuid.Parse(orgStr)
+	po.SupplierID, _ = uuid.Parse(supplierStr)
+	po.CreatedBy, _ = uuid.Parse(userStr)
+	if expectedAt.Valid {
+		po.ExpectedAt = &expectedAt.Time
+	}
+	if notes.Valid {
+		po.Notes = &notes.String
+	}
+	if sentAt.Valid {
+		po.SentAt = &sentAt.Time
+	}
+	if receivedAt.Valid {
+		po.ReceivedAt = &receivedAt.Time
+	}
+
+	return &po, nil
+}
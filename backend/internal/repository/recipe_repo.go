@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewRecipeRepository(db *sql.DB, dialect database.Dialect) RecipeRepository {
+	return &recipeRepo{db: db, dialect: dialect}
+}
+
+type recipeRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const recipeColumns = `id, organization_id, name, description, yield_quantity, yield_unit, is_active, created_at, updated_at`
+
+// recipeComponentQuery selects components with the name of their item or
+// sub-recipe; callers append the WHERE clause
+const recipeComponentQuery = `
+	SELECT rc.id, rc.recipe_id, rc.item_id, rc.sub_recipe_id, rc.quantity, rc.unit, rc.position,
+		COALESCE(i.name, sr.name, '')
+	FROM recipe_components rc
+	JOIN recipes r ON rc.recipe_id = r.id
+	LEFT JOIN items i ON rc.item_id = i.id
+	LEFT JOIN recipes sr ON rc.sub_recipe_id = sr.id
+`
+
+// Create inserts the recipe and its components. Run it inside RunInTx so a
+// failing component leaves no partial recipe behind.
+func (r *recipeRepo) Create(ctx context.Context, recipe *domain.Recipe) (uuid.UUID, error) {
+	if recipe == nil {
+		return uuid.Nil, errors.New("recipe is nil")
+	}
+
+	if recipe.ID == uuid.Nil {
+		recipe.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	recipe.CreatedAt = now
+	recipe.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO recipes (`+recipeColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		recipe.ID.String(), recipe.OrganizationID.String(), recipe.Name, recipe.Description,
+		recipe.YieldQuantity, recipe.YieldUnit, recipe.IsActive, recipe.CreatedAt, recipe.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := r.insertComponents(ctx, recipe); err != nil {
+		return uuid.Nil, err
+	}
+	return recipe.ID, nil
+}
+
+func (r *recipeRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Recipe, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+recipeColumns+` FROM recipes WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	recipe, err := scanRecipe(row)
+	if err != nil || recipe == nil {
+		return recipe, err
+	}
+
+	components, err := r.listComponents(ctx, `WHERE rc.recipe_id = ?`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	recipe.Components = components[recipe.ID]
+	return recipe, nil
+}
+
+// GetByName finds a recipe of the organization by exact name
+func (r *recipeRepo) GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Recipe, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+recipeColumns+` FROM recipes WHERE organization_id = ? AND name = ?
+	`, orgID.String(), name)
+	return scanRecipe(row)
+}
+
+// List lists the organization's recipes with their components
+func (r *recipeRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Recipe, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+recipeColumns+` FROM recipes
+		WHERE organization_id = ?
+		ORDER BY name
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipes []*domain.Recipe
+	for rows.Next() {
+		recipe, err := scanRecipe(rows)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	components, err := r.listComponents(ctx, `WHERE r.organization_id = ?`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, recipe := range recipes {
+		recipe.Components = components[recipe.ID]
+	}
+	return recipes, nil
+}
+
+// Update writes the recipe's fields and replaces its components. Run it
+// inside RunInTx.
+func (r *recipeRepo) Update(ctx context.Context, recipe *domain.Recipe) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	recipe.UpdatedAt = time.Now().UTC()
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE recipes SET
+			name = ?, description = ?, yield_quantity = ?, yield_unit = ?, is_active = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		recipe.Name, recipe.Description, recipe.YieldQuantity, recipe.YieldUnit, recipe.IsActive,
+		recipe.UpdatedAt, recipe.ID.String(), org,
+	)
+	if err != nil {
+		return err
+	}
+	// The components of a recipe out of scope are left alone
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM recipe_components WHERE recipe_id = ?
+	`, recipe.ID.String())
+	if err != nil {
+		return err
+	}
+	return r.insertComponents(ctx, recipe)
+}
+
+// IsSubRecipe reports whether another recipe uses the recipe as a component
+func (r *recipeRepo) IsSubRecipe(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT 1 FROM recipe_components WHERE sub_recipe_id = ? LIMIT 1
+	`, id.String()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *recipeRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM recipes WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
+
+func (r *recipeRepo) insertComponents(ctx context.Context, recipe *domain.Recipe) error {
+	for i, component := range recipe.Components {
+		if component.ID == uuid.Nil {
+			component.ID = uuid.New()
+		}
+		component.RecipeID = recipe.ID
+		component.Position = i
+
+		_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+			INSERT INTO recipe_components (id, recipe_id, item_id, sub_recipe_id, quantity, unit, position)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`,
+			component.ID.String(), component.RecipeID.String(),
+			nullableUUID(component.ItemID), nullableUUID(component.SubRecipeID),
+			component.Quantity, component.Unit, component.Position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listComponents returns the components matching where, grouped by recipe
+// and in position order
+func (r *recipeRepo) listComponents(ctx context.Context, where string, args ...interface{}) (map[uuid.UUID][]*domain.RecipeComponent, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, recipeComponentQuery+where+`
+		ORDER BY rc.recipe_id, rc.position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	components := make(map[uuid.UUID][]*domain.RecipeComponent)
+	for rows.Next() {
+		var component domain.RecipeComponent
+		var (
+			idStr, recipeStr      string
+			itemStr, subRecipeStr sql.NullString
+		)
+		if err := rows.Scan(
+			&idStr, &recipeStr, &itemStr, &subRecipeStr, &component.Quantity, &component.Unit,
+			&component.Position, &component.Name,
+		); err != nil {
+			return nil, err
+		}
+
+		component.ID, _ = uuid.Parse(idStr)
+		component.RecipeID, _ = uuid.Parse(recipeStr)
+		component.ItemID = parseNullableUUID(itemStr)
+		component.SubRecipeID = parseNullableUUID(subRecipeStr)
+		components[component.RecipeID] = append(components[component.RecipeID], &component)
+	}
+
+	return components, rows.Err()
+}
+
+func scanRecipe(row rowScanner) (*domain.Recipe, error) {
+	var recipe domain.Recipe
+	var (
+		idStr, orgStr string
+		description   sql.NullString
+	)
+
+	if err := row.Scan(
+		&idStr, &orgStr, &recipe.Name, &description, &recipe.YieldQuantity, &recipe.YieldUnit,
+		&recipe.IsActive, &recipe.CreatedAt, &recipe.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	recipe.ID, _ = uuid.Parse(idStr)
+	recipe.OrganizationID, _ = uuid.Parse(orgStr)
+	if description.Valid {
+		recipe.Description = &description.String
+	}
+
+	return &recipe, nil
+}
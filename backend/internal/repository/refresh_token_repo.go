@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewRefreshTokenRepository(db *sql.DB, dialect database.Dialect) RefreshTokenRepository {
+	return &refreshTokenRepo{db: db, dialect: dialect}
+}
+
+type refreshTokenRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func (r *refreshTokenRepo) Create(ctx context.Context, token *domain.RefreshToken) error {
+	if token == nil {
+		return errors.New("refresh token is nil")
+	}
+
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	token.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO refresh_tokens (
+			id, user_id, organization_id, family_id, token_hash, expires_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		token.ID.String(), token.UserID.String(), nullableUUID(token.OrganizationID), token.FamilyID.String(),
+		token.TokenHash, token.ExpiresAt, token.CreatedAt,
+	)
+	return err
+}
+
+func (r *refreshTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT id, user_id, organization_id, family_id, token_hash, expires_at,
+		       used_at, revoked_at, created_at
+		FROM refresh_tokens WHERE token_hash = ?
+	`, tokenHash)
+
+	var token domain.RefreshToken
+	var idStr, userStr, familyStr string
+	var orgStr sql.NullString
+	var usedAt, revokedAt sql.NullTime
+
+	if err := row.Scan(
+		&idStr, &userStr, &orgStr, &familyStr, &token.TokenHash, &token.ExpiresAt,
+		&usedAt, &revokedAt, &token.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	token.ID, _ = uuid.Parse(idStr)
+	token.UserID, _ = uuid.Parse(userStr)
+	token.FamilyID, _ = uuid.Parse(familyStr)
+	if orgStr.Valid {
+		if orgID, err := uuid.Parse(orgStr.String); err == nil {
+			token.OrganizationID = &orgID
+		}
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// MarkUsed marks the token used unless it already was or has been revoked.
+// It reports whether it did, so two refreshes racing with the same token
+// cannot both succeed.
+func (r *refreshTokenRepo) MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = ?
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+	`, at, id.String())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RevokeFamily revokes every token of the family not already revoked
+func (r *refreshTokenRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE family_id = ? AND revoked_at IS NULL
+	`, at, familyID.String())
+	return err
+}
+
+// RevokeUser revokes every token of the user not already revoked
+func (r *refreshTokenRepo) RevokeUser(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+	`, at, userID.String())
+	return err
+}
+
+// RevokeUserInOrganization revokes the tokens of the user's sessions in the
+// organization not already revoked. Tokens without an organization belong
+// to the user's home organization.
+func (r *refreshTokenRepo) RevokeUserInOrganization(ctx context.Context, userID, orgID uuid.UUID, at time.Time) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL AND COALESCE(
+			organization_id, (SELECT organization_id FROM users WHERE users.id = refresh_tokens.user_id)
+		) = ?
+	`, at, userID.String(), orgID.String())
+	return err
+}
+
+func (r *refreshTokenRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM refresh_tokens WHERE expires_at < ?
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewReorderRepository(db *sql.DB, dialect database.Dialect) ReorderRepository {
+	return &reorderRepo{db: db, dialect: dialect}
+}
+
+type reorderRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// ListCandidates lists the active, tracked items of the organization, or of
+// every organization when orgID is nil, with their OUT quantity since the
+// given time and the quantity still outstanding on open purchase orders.
+// Reversed movements and reversals do not count as consumption. Draft orders
+// count as on order so that drafting an order stops the item from being
+// suggested again.
+func (r *reorderRepo) ListCandidates(ctx context.Context, orgID *uuid.UUID, since time.Time) ([]*domain.ReorderCandidate, error) {
+	query := `
+		SELECT i.id, i.organization_id, i.name, i.sku, i.unit_of_measurement,
+		       i.current_stock, i.minimum_threshold, i.par_level, i.lead_time_days,
+		       i.unit_cost, i.reorder_alerted_at, s.id, s.name, s.lead_time_days,
+		       COALESCE((
+		           SELECT SUM(sm.quantity) FROM stock_movements sm
+		           WHERE sm.item_id = i.id AND sm.movement_type = 'OUT' AND sm.created_at >= ?
+		           AND sm.voided_at IS NULL AND sm.reversal_of IS NULL
+		       ), 0),
+		       COALESCE((
+		           SELECT SUM(pol.ordered_quantity - pol.received_quantity)
+		           FROM purchase_order_lines pol
+		           JOIN purchase_orders po ON pol.purchase_order_id = po.id
+		           WHERE pol.item_id = i.id
+		           AND pol.received_quantity < pol.ordered_quantity
+		           AND po.status IN ('DRAFT', 'SENT', 'PARTIALLY_RECEIVED')
+		       ), 0)
+		FROM items i
+		LEFT JOIN suppliers s ON i.preferred_supplier_id = s.id
+		WHERE i.is_active = TRUE AND i.track_stock = TRUE`
+
+	args := []interface{}{since}
+	if orgID != nil {
+		query += ` AND i.organization_id = ?`
+		args = append(args, orgID.String())
+	}
+	query += ` ORDER BY i.name`
+
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*domain.ReorderCandidate
+	for rows.Next() {
+		var c domain.ReorderCandidate
+		var (
+			idStr, orgStr                  string
+			sku, supplierStr, supplierName sql.NullString
+			parLevel, leadTime             sql.NullInt64
+			supplierLeadTime               sql.NullInt64
+			unitCost                       sql.NullFloat64
+			alertedAt                      sql.NullTime
+		)
+		if err := rows.Scan(
+			&idStr, &orgStr, &c.ItemName, &sku, &c.UnitOfMeasurement,
+			&c.CurrentStock, &c.MinimumThreshold, &parLevel, &leadTime,
+			&unitCost, &alertedAt, &supplierStr, &supplierName, &supplierLeadTime,
+			&c.Consumed, &c.OnOrder,
+		); err != nil {
+			return nil, err
+		}
+
+		c.ItemID, _ = uuid.Parse(idStr)
+		c.OrganizationID, _ = uuid.Parse(orgStr)
+		if sku.Valid {
+			c.SKU = &sku.String
+		}
+		if parLevel.Valid {
+			par := int(parLevel.Int64)
+			c.ParLevel = &par
+		}
+		if leadTime.Valid {
+			days := int(leadTime.Int64)
+			c.LeadTimeDays = &days
+		}
+		if unitCost.Valid {
+			c.UnitCost = &unitCost.Float64
+		}
+		if alertedAt.Valid {
+			c.ReorderAlertedAt = &alertedAt.Time
+		}
+		c.SupplierID = parseNullableUUID(supplierStr)
+		if supplierName.Valid {
+			c.SupplierName = &supplierName.String
+		}
+		if supplierLeadTime.Valid {
+			days := int(supplierLeadTime.Int64)
+			c.SupplierLeadTimeDays = &days
+		}
+		candidates = append(candidates, &c)
+	}
+
+	return candidates, rows.Err()
+}
+
+// MarkAlerted records when a reorder alert was raised for the item; a nil
+// time clears the mark once the item no longer needs reordering
+func (r *reorderRepo) MarkAlerted(ctx context.Context, itemID uuid.UUID, at *time.Time) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE items SET reorder_alerted_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, at, itemID.String(), org)
+	return err
+}
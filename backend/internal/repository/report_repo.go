@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewReportRepository(db *sql.DB, dialect database.Dialect) ReportRepository {
+	return &reportRepo{db: db, dialect: dialect}
+}
+
+type reportRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// ListOutflows totals the OUT movements of the organization's items created
+// in [from, to) by day, reason and item. Reversed movements and reversals
+// are left out.
+func (r *reportRepo) ListOutflows(ctx context.Context, orgID uuid.UUID, from, to time.Time) ([]*domain.OutflowTotal, error) {
+	day := r.dialect.DateExpr("sm.created_at")
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+day+`, sm.reason_code, i.id, i.name, i.unit_of_measurement, i.unit_cost,
+		       SUM(sm.quantity)
+		FROM stock_movements sm
+		JOIN items i ON sm.item_id = i.id
+		WHERE i.organization_id = ?
+		AND sm.movement_type = 'OUT'
+		AND sm.voided_at IS NULL AND sm.reversal_of IS NULL
+		AND sm.created_at >= ? AND sm.created_at < ?
+		GROUP BY `+day+`, sm.reason_code, i.id, i.name, i.unit_of_measurement, i.unit_cost
+		ORDER BY 1, i.name
+	`, orgID.String(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []*domain.OutflowTotal
+	for rows.Next() {
+		var t domain.OutflowTotal
+		var (
+			itemStr    string
+			reasonCode sql.NullString
+			unitCost   sql.NullFloat64
+		)
+		if err := rows.Scan(
+			&t.Day, &reasonCode, &itemStr, &t.ItemName, &t.UnitOfMeasurement, &unitCost,
+			&t.Quantity,
+		); err != nil {
+			return nil, err
+		}
+
+		t.ItemID, _ = uuid.Parse(itemStr)
+		if reasonCode.Valid {
+			t.ReasonCode = &reasonCode.String
+		}
+		if unitCost.Valid {
+			t.UnitCost = &unitCost.Float64
+		}
+		totals = append(totals, &t)
+	}
+
+	return totals, rows.Err()
+}
+
+// ListValuation returns, for every item of the organization, its stock and
+// open cost layers now, its snapshot taken at snapshotAt, and the movements
+// between the snapshot and asOf. Movements dated before the snapshot but
+// recorded after it was made, such as sales imported late, count as after
+// it. Items without that snapshot get the movements after asOf instead.
+// snapshotAt is nil when the organization has no snapshot to work from.
+func (r *reportRepo) ListValuation(ctx context.Context, orgID uuid.UUID, snapshotAt *time.Time, asOf time.Time) ([]*domain.ValuationRow, error) {
+	var taken sql.NullTime
+	if snapshotAt != nil {
+		taken = sql.NullTime{Time: *snapshotAt, Valid: true}
+	}
+
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT i.id, i.name, c.id, c.name, i.unit_of_measurement, i.unit_cost, i.current_stock,
+		       COALESCE(cl.quantity, 0), COALESCE(cl.value, 0),
+		       s.quantity, s.value,
+		       COALESCE(mv.stock, 0), COALESCE(mv.cost, 0), COALESCE(mv.uncosted, 0)
+		FROM items i
+		JOIN categories c ON i.category_id = c.id
+		LEFT JOIN (
+			SELECT item_id, SUM(quantity) AS quantity, SUM(quantity * unit_cost) AS value
+			FROM cost_layers
+			GROUP BY item_id
+		) cl ON cl.item_id = i.id
+		LEFT JOIN stock_snapshots s ON s.item_id = i.id AND s.taken_at = ?
+		LEFT JOIN (
+			SELECT sm.item_id,
+			       SUM(sm.new_stock - sm.previous_stock) AS stock,
+			       SUM(CASE WHEN sm.total_cost IS NULL THEN 0
+			                WHEN sm.new_stock < sm.previous_stock THEN -sm.total_cost
+			                ELSE sm.total_cost END) AS cost,
+			       SUM(CASE WHEN sm.total_cost IS NULL THEN sm.new_stock - sm.previous_stock
+			                ELSE 0 END) AS uncosted
+			FROM stock_movements sm
+			LEFT JOIN stock_snapshots ss ON ss.item_id = sm.item_id AND ss.taken_at = ?
+			WHERE (ss.id IS NULL AND sm.created_at > ?)
+			OR (ss.id IS NOT NULL AND sm.created_at <= ?
+			    AND (sm.created_at > ss.taken_at OR sm.recorded_at > ss.created_at))
+			GROUP BY sm.item_id
+		) mv ON mv.item_id = i.id
+		WHERE i.organization_id = ?
+		ORDER BY c.name, i.name
+	`, taken, taken, asOf, asOf, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*domain.ValuationRow
+	for rows.Next() {
+		var v domain.ValuationRow
+		var (
+			itemStr, categoryStr string
+			unitCost             sql.NullFloat64
+			snapshotQuantity     sql.NullInt64
+			snapshotValue        sql.NullFloat64
+		)
+		if err := rows.Scan(
+			&itemStr, &v.ItemName, &categoryStr, &v.CategoryName, &v.UnitOfMeasurement, &unitCost, &v.CurrentStock,
+			&v.LayerQuantity, &v.LayerValue,
+			&snapshotQuantity, &snapshotValue,
+			&v.MovedStock, &v.MovedCost, &v.MovedUncosted,
+		); err != nil {
+			return nil, err
+		}
+
+		v.ItemID, _ = uuid.Parse(itemStr)
+		v.CategoryID, _ = uuid.Parse(categoryStr)
+		if unitCost.Valid {
+			v.UnitCost = &unitCost.Float64
+		}
+		if snapshotQuantity.Valid && snapshotValue.Valid {
+			quantity := int(snapshotQuantity.Int64)
+			v.SnapshotQuantity = &quantity
+			v.SnapshotValue = &snapshotValue.Float64
+		}
+		list = append(list, &v)
+	}
+
+	return list, rows.Err()
+}
+
+// LatestSnapshotAt returns when the organization's last snapshot at or
+// before asOf was taken, or nil when there is none
+func (r *reportRepo) LatestSnapshotAt(ctx context.Context, orgID uuid.UUID, asOf time.Time) (*time.Time, error) {
+	var takenAt time.Time
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT taken_at FROM stock_snapshots
+		WHERE organization_id = ? AND taken_at <= ?
+		ORDER BY taken_at DESC
+		LIMIT 1
+	`, orgID.String(), asOf).Scan(&takenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &takenAt, nil
+}
+
+// ListUnsnapshottedOrganizations returns the organizations with items that
+// have no snapshot taken at takenAt yet
+func (r *reportRepo) ListUnsnapshottedOrganizations(ctx context.Context, takenAt time.Time) ([]uuid.UUID, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT DISTINCT i.organization_id
+		FROM items i
+		WHERE NOT EXISTS (
+			SELECT 1 FROM stock_snapshots s
+			WHERE s.organization_id = i.organization_id AND s.taken_at = ?
+		)
+	`, takenAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgIDs []uuid.UUID
+	for rows.Next() {
+		var orgStr string
+		if err := rows.Scan(&orgStr); err != nil {
+			return nil, err
+		}
+		orgID, _ := uuid.Parse(orgStr)
+		orgIDs = append(orgIDs, orgID)
+	}
+
+	return orgIDs, rows.Err()
+}
+
+func (r *reportRepo) CreateSnapshot(ctx context.Context, snapshot *domain.StockSnapshot) (uuid.UUID, error) {
+	if snapshot == nil {
+		return uuid.Nil, errors.New("stock snapshot is nil")
+	}
+
+	if snapshot.ID == uuid.Nil {
+		snapshot.ID = uuid.New()
+	}
+	snapshot.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_snapshots (id, organization_id, item_id, taken_at, quantity, value, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		snapshot.ID.String(), snapshot.OrganizationID.String(), snapshot.ItemID.String(), snapshot.TakenAt,
+		snapshot.Quantity, snapshot.Value, snapshot.CreatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return snapshot.ID, nil
+}
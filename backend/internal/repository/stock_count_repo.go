@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewStockCountRepository(db *sql.DB, dialect database.Dialect) StockCountRepository {
+	return &stockCountRepo{db: db, dialect: dialect}
+}
+
+type stockCountRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// stockCountQuery selects sessions with the names of their location and
+// category; callers append the WHERE clause
+const stockCountQuery = `
+	SELECT sc.id, sc.organization_id, sc.location_id, sc.category_id, sc.status, sc.notes,
+		sc.created_by, sc.approved_by, sc.approved_at, sc.created_at, sc.updated_at, l.name, c.name
+	FROM stock_counts sc
+	JOIN locations l ON sc.location_id = l.id
+	LEFT JOIN categories c ON sc.category_id = c.id
+`
+
+// stockCountLineQuery selects lines with the name and unit of their item;
+// callers append the WHERE clause
+const stockCountLineQuery = `
+	SELECT scl.id, scl.stock_count_id, scl.item_id, scl.expected_quantity, scl.counted_quantity,
+		scl.counted_by, scl.counted_at, scl.unit_cost, scl.movement_id, scl.position,
+		i.name, i.unit_of_measurement
+	FROM stock_count_lines scl
+	JOIN stock_counts sc ON scl.stock_count_id = sc.id
+	JOIN items i ON scl.item_id = i.id
+`
+
+// Create inserts the session and its lines. Run it inside RunInTx so a
+// failing line leaves no partial session behind.
+func (r *stockCountRepo) Create(ctx context.Context, count *domain.StockCount) (uuid.UUID, error) {
+	if count == nil {
+		return uuid.Nil, errors.New("stock count is nil")
+	}
+
+	if count.ID == uuid.Nil {
+		count.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	count.CreatedAt = now
+	count.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_counts (
+			id, organization_id, location_id, category_id, status, notes, created_by,
+			approved_by, approved_at, created_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		count.ID.String(), count.OrganizationID.String(), count.LocationID.String(),
+		nullableUUID(count.CategoryID), count.Status, count.Notes, count.CreatedBy.String(),
+		nullableUUID(count.ApprovedBy), count.ApprovedAt, count.CreatedAt, count.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	for i, line := range count.Lines {
+		if line.ID == uuid.Nil {
+			line.ID = uuid.New()
+		}
+		line.StockCountID = count.ID
+		line.Position = i
+
+		_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+			INSERT INTO stock_count_lines (
+				id, stock_count_id, item_id, expected_quantity, counted_quantity, counted_by,
+				counted_at, unit_cost, movement_id, position
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			line.ID.String(), line.StockCountID.String(), line.ItemID.String(), line.ExpectedQuantity,
+			line.CountedQuantity, nullableUUID(line.CountedBy), line.CountedAt, line.UnitCost,
+			nullableUUID(line.MovementID), line.Position,
+		)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return count.ID, nil
+}
+
+func (r *stockCountRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.StockCount, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, stockCountQuery+`
+		WHERE sc.id = ? AND sc.organization_id = COALESCE(?, sc.organization_id)
+	`, id.String(), org)
+	count, err := scanStockCount(row)
+	if err != nil || count == nil {
+		return count, err
+	}
+
+	lines, err := r.listLines(ctx, `WHERE scl.stock_count_id = ?`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	count.Lines = lines[count.ID]
+	return count, nil
+}
+
+// List lists the organization's sessions with their lines, newest first,
+// only those in status when it is given
+func (r *stockCountRepo) List(ctx context.Context, orgID uuid.UUID, status *domain.StockCountStatus) ([]*domain.StockCount, error) {
+	where := `WHERE sc.organization_id = ?`
+	args := []interface{}{orgID.String()}
+	if status != nil {
+		where += ` AND sc.status = ?`
+		args = append(args, *status)
+	}
+
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, stockCountQuery+where+`
+		ORDER BY sc.created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*domain.StockCount
+	for rows.Next() {
+		count, err := scanStockCount(rows)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lines, err := r.listLines(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		count.Lines = lines[count.ID]
+	}
+	return counts, nil
+}
+
+// Update writes the session's own fields; its lines are left as they are
+func (r *stockCountRepo) Update(ctx context.Context, count *domain.StockCount) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	count.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_counts SET
+			status = ?, notes = ?, approved_by = ?, approved_at = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		count.Status, count.Notes, nullableUUID(count.ApprovedBy), count.ApprovedAt,
+		count.UpdatedAt, count.ID.String(), org,
+	)
+	return err
+}
+
+// SetCounted records the counted quantity of a line and who counted it
+func (r *stockCountRepo) SetCounted(ctx context.Context, line *domain.StockCountLine) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_count_lines SET counted_quantity = ?, counted_by = ?, counted_at = ? WHERE id = ?
+	`, line.CountedQuantity, nullableUUID(line.CountedBy), line.CountedAt, line.ID.String())
+	return err
+}
+
+// SetMovement records the ADJUSTMENT posted for a line
+func (r *stockCountRepo) SetMovement(ctx context.Context, lineID, movementID uuid.UUID) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_count_lines SET movement_id = ? WHERE id = ?
+	`, movementID.String(), lineID.String())
+	return err
+}
+
+// listLines returns the lines matching where, grouped by session and in
+// position order
+func (r *stockCountRepo) listLines(ctx context.Context, where string, args ...interface{}) (map[uuid.UUID][]*domain.StockCountLine, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, stockCountLineQuery+where+`
+		ORDER BY scl.stock_count_id, scl.position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[uuid.UUID][]*domain.StockCountLine)
+	for rows.Next() {
+		var line domain.StockCountLine
+		var (
+			idStr, countStr, itemStr string
+			countedBy, movementStr   sql.NullString
+			counted                  sql.NullInt64
+			countedAt                sql.NullTime
+			unitCost                 sql.NullFloat64
+		)
+		if err := rows.Scan(
+			&idStr, &countStr, &itemStr, &line.ExpectedQuantity, &counted,
+			&countedBy, &countedAt, &unitCost, &movementStr, &line.Position,
+			&line.ItemName, &line.Unit,
+		); err != nil {
+			return nil, err
+		}
+
+		line.ID, _ = uuid.Parse(idStr)
+		line.StockCountID, _ = uuid.Parse(countStr)
+		line.ItemID, _ = uuid.Parse(itemStr)
+		if counted.Valid {
+			quantity := int(counted.Int64)
+			line.CountedQuantity = &quantity
+		}
+		line.CountedBy = parseNullableUUID(countedBy)
+		if countedAt.Valid {
+			line.CountedAt = &countedAt.Time
+		}
+		if unitCost.Valid {
+			line.UnitCost = &unitCost.Float64
+		}
+		line.MovementID = parseNullableUUID(movementStr)
+		lines[line.StockCountID] = append(lines[line.StockCountID], &line)
+	}
+
+	return lines, rows.Err()
+}
+
+func scanStockCount(row rowScanner) (*domain.StockCount, error) {
+	var count domain.StockCount
+	var (
+		idStr, orgStr, locationStr, userStr string
+		categoryStr, approvedBy             sql.NullString
+		notes, categoryName                 sql.NullString
+		approvedAt                          sql.NullTime
+	)
+
+	if err := row.Scan(
+		&idStr, &orgStr, &locationStr, &categoryStr, &count.Status, &notes,
+		&userStr, &approvedBy, &approvedAt, &count.CreatedAt, &count.UpdatedAt,
+		&count.LocationName, &categoryName,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	count.ID, _ = uuid.Parse(idStr)
+	count.OrganizationID, _ = uuid.Parse(orgStr)
+	count.LocationID, _ = uuid.Parse(locationStr)
+	count.CategoryID = parseNullableUUID(categoryStr)
+	count.CreatedBy, _ = uuid.Parse(userStr)
+	count.ApprovedBy = parseNullableUUID(approvedBy)
+	if approvedAt.Valid {
+		count.ApprovedAt = &approvedAt.Time
+	}
+	if notes.Valid {
+		count.Notes = &notes.String
+	}
+	if categoryName.Valid {
+		count.CategoryName = &categoryName.String
+	}
+
+	return &count, nil
+}
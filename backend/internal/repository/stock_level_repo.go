@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewStockLevelRepository(db *sql.DB, dialect database.Dialect) StockLevelRepository {
+	return &stockLevelRepo{db: db, dialect: dialect}
+}
+
+type stockLevelRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func (r *stockLevelRepo) Get(ctx context.Context, itemID, locationID uuid.UUID) (*domain.StockLevel, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT sl.item_id, sl.location_id, sl.quantity, sl.minimum_threshold, sl.updated_at, l.name
+		FROM stock_levels sl
+		JOIN locations l ON sl.location_id = l.id
+		WHERE sl.item_id = ? AND sl.location_id = ? AND l.organization_id = COALESCE(?, l.organization_id)
+	`, itemID.String(), locationID.String(), org)
+
+	level, err := scanStockLevel(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return level, err
+}
+
+func (r *stockLevelRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLevel, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT sl.item_id, sl.location_id, sl.quantity, sl.minimum_threshold, sl.updated_at, l.name
+		FROM stock_levels sl
+		JOIN locations l ON sl.location_id = l.id
+		WHERE sl.item_id = ? AND l.organization_id = COALESCE(?, l.organization_id)
+		ORDER BY l.is_default DESC, l.name
+	`, itemID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var levels []*domain.StockLevel
+	for rows.Next() {
+		level, err := scanStockLevel(rows)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, rows.Err()
+}
+
+// SetQuantity stores the quantity of an item at a location, creating the
+// row on first use and leaving its threshold untouched
+func (r *stockLevelRepo) SetQuantity(ctx context.Context, itemID, locationID uuid.UUID, quantity int) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_levels (item_id, location_id, quantity, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (item_id, location_id) DO UPDATE SET
+			quantity = excluded.quantity, updated_at = excluded.updated_at
+	`, itemID.String(), locationID.String(), quantity, time.Now().UTC())
+	return err
+}
+
+// SetThreshold stores the per-location threshold; nil falls back to the
+// item's threshold
+func (r *stockLevelRepo) SetThreshold(ctx context.Context, itemID, locationID uuid.UUID, threshold *int) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_levels (item_id, location_id, quantity, minimum_threshold, updated_at)
+		VALUES (?, ?, 0, ?, ?)
+		ON CONFLICT (item_id, location_id) DO UPDATE SET
+			minimum_threshold = excluded.minimum_threshold, updated_at = excluded.updated_at
+	`, itemID.String(), locationID.String(), threshold, time.Now().UTC())
+	return err
+}
+
+// CountStockedAtLocation counts the items holding stock at a location
+func (r *stockLevelRepo) CountStockedAtLocation(ctx context.Context, locationID uuid.UUID) (int, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM stock_levels
+		WHERE location_id = ? AND quantity > 0 AND location_id IN (
+			SELECT id FROM locations WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, locationID.String(), org).Scan(&count)
+	return count, err
+}
+
+// DeleteByLocation removes the empty stock rows of a location
+func (r *stockLevelRepo) DeleteByLocation(ctx context.Context, locationID uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM stock_levels WHERE location_id = ? AND location_id IN (
+			SELECT id FROM locations WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, locationID.String(), org)
+	return err
+}
+
+func scanStockLevel(row rowScanner) (*domain.StockLevel, error) {
+	var level domain.StockLevel
+	var (
+		itemStr, locationStr string
+		threshold            sql.NullInt64
+	)
+
+	if err := row.Scan(
+		&itemStr, &locationStr, &level.Quantity, &threshold, &level.UpdatedAt, &level.LocationName,
+	); err != nil {
+		return nil, err
+	}
+
+	level.ItemID, _ = uuid.Parse(itemStr)
+	level.LocationID, _ = uuid.Parse(locationStr)
+	if threshold.Valid {
+		t := int(threshold.Int64)
+		level.MinimumThreshold = &t
+	}
+
+	return &level, nil
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewStockLotRepository(db *sql.DB, dialect database.Dialect) StockLotRepository {
+	return &stockLotRepo{db: db, dialect: dialect}
+}
+
+type stockLotRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const stockLotColumns = `sl.id, sl.item_id, sl.location_id, sl.lot_number, sl.received_at, sl.expires_at,
+	sl.initial_quantity, sl.quantity, sl.movement_id, sl.expiry_alerted_at, sl.created_at`
+
+// fefoOrder sorts lots first-expiry-first-out; lots without an expiry go
+// last, oldest delivery first
+const fefoOrder = `sl.expires_at IS NULL, sl.expires_at, sl.received_at, sl.created_at`
+
+func (r *stockLotRepo) Create(ctx context.Context, lot *domain.StockLot) (uuid.UUID, error) {
+	if lot == nil {
+		return uuid.Nil, errors.New("lot is nil")
+	}
+
+	if lot.ID == uuid.Nil {
+		lot.ID = uuid.New()
+	}
+	lot.CreatedAt = time.Now().UTC()
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_lots (
+			id, item_id, location_id, lot_number, received_at, expires_at,
+			initial_quantity, quantity, movement_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		lot.ID.String(), lot.ItemID.String(), lot.LocationID.String(),
+		lot.LotNumber, lot.ReceivedAt, lot.ExpiresAt,
+		lot.InitialQuantity, lot.Quantity, nullableUUID(lot.MovementID), lot.CreatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return lot.ID, nil
+}
+
+// ListAvailable lists the lots of an item at a location that still hold
+// stock, in the order they should be consumed
+func (r *stockLotRepo) ListAvailable(ctx context.Context, itemID, locationID uuid.UUID) ([]*domain.StockLot, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+stockLotColumns+`
+		FROM stock_lots sl
+		WHERE sl.item_id = ? AND sl.location_id = ? AND sl.quantity > 0 AND sl.item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY `+fefoOrder+`
+	`, itemID.String(), locationID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*domain.StockLot
+	for rows.Next() {
+		lot, err := scanStockLot(rows)
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
+// ListByItem lists the lots of an item that still hold stock across all
+// locations, in consumption order
+func (r *stockLotRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLot, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+stockLotColumns+`, l.name
+		FROM stock_lots sl
+		JOIN locations l ON sl.location_id = l.id
+		WHERE sl.item_id = ? AND sl.quantity > 0 AND l.organization_id = COALESCE(?, l.organization_id)
+		ORDER BY `+fefoOrder+`
+	`, itemID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*domain.StockLot
+	for rows.Next() {
+		var locationName string
+		lot, err := scanStockLot(rows, &locationName)
+		if err != nil {
+			return nil, err
+		}
+		lot.LocationName = locationName
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
+func (r *stockLotRepo) UpdateQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_lots SET quantity = ?
+		WHERE id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, quantity, id.String(), org)
+	return err
+}
+
+// AddQuantity puts quantity back into a lot, such as when the movement that
+// took it is reversed
+func (r *stockLotRepo) AddQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_lots SET quantity = quantity + ?
+		WHERE id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, quantity, id.String(), org)
+	return err
+}
+
+// RecordMovement records the quantity a movement took from or added to a lot
+func (r *stockLotRepo) RecordMovement(ctx context.Context, movementID, lotID uuid.UUID, quantity int) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO stock_movement_lots (movement_id, lot_id, quantity)
+		VALUES (?, ?, ?)
+	`, movementID.String(), lotID.String(), quantity)
+	return err
+}
+
+// ListMovementLots lists the lots a movement received or took from, with the
+// quantity of each
+func (r *stockLotRepo) ListMovementLots(ctx context.Context, movementID uuid.UUID) ([]*domain.MovementLot, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT sml.lot_id, sml.quantity, sl.lot_number, sl.expires_at
+		FROM stock_movement_lots sml
+		JOIN stock_lots sl ON sml.lot_id = sl.id
+		WHERE sml.movement_id = ? AND sl.item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY `+fefoOrder+`
+	`, movementID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*domain.MovementLot
+	for rows.Next() {
+		var (
+			lot       domain.MovementLot
+			lotStr    string
+			lotNumber sql.NullString
+			expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&lotStr, &lot.Quantity, &lotNumber, &expiresAt); err != nil {
+			return nil, err
+		}
+		lot.LotID, _ = uuid.Parse(lotStr)
+		if lotNumber.Valid {
+			lot.LotNumber = &lotNumber.String
+		}
+		if expiresAt.Valid {
+			lot.ExpiresAt = &expiresAt.Time
+		}
+		lots = append(lots, &lot)
+	}
+
+	return lots, rows.Err()
+}
+
+// ListExpiringUnalerted lists lots of active items, across all
+// organizations, that still hold stock, expire at or before the given time
+// and have not been alerted on yet
+func (r *stockLotRepo) ListExpiringUnalerted(ctx context.Context, before time.Time) ([]*domain.StockLot, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+stockLotColumns+`, i.organization_id, i.name, i.unit_of_measurement, l.name
+		FROM stock_lots sl
+		JOIN items i ON sl.item_id = i.id
+		JOIN locations l ON sl.location_id = l.id
+		WHERE sl.quantity > 0
+		AND sl.expires_at IS NOT NULL
+		AND sl.expires_at <= ?
+		AND sl.expiry_alerted_at IS NULL
+		AND i.is_active = TRUE
+		ORDER BY sl.expires_at
+	`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*domain.StockLot
+	for rows.Next() {
+		var orgStr, itemName, unit, locationName string
+		lot, err := scanStockLot(rows, &orgStr, &itemName, &unit, &locationName)
+		if err != nil {
+			return nil, err
+		}
+		lot.OrganizationID, _ = uuid.Parse(orgStr)
+		lot.ItemName = itemName
+		lot.UnitOfMeasurement = unit
+		lot.LocationName = locationName
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
+func (r *stockLotRepo) MarkExpiryAlerted(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE stock_lots SET expiry_alerted_at = ? WHERE id = ?
+	`, at, id.String())
+	return err
+}
+
+// scanStockLot scans the stock lot columns followed by any extra joined
+// columns into extra
+func scanStockLot(row rowScanner, extra ...interface{}) (*domain.StockLot, error) {
+	var lot domain.StockLot
+	var (
+		idStr, itemStr, locationStr string
+		lotNumber, movementStr      sql.NullString
+		expiresAt, alertedAt        sql.NullTime
+	)
+
+	dest := []interface{}{
+		&idStr, &itemStr, &locationStr, &lotNumber, &lot.ReceivedAt, &expiresAt,
+		&lot.InitialQuantity, &lot.Quantity, &movementStr, &alertedAt, &lot.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	lot.ID, _ = uuid.Parse(idStr)
+	lot.ItemID, _ = uuid.Parse(itemStr)
+	lot.LocationID, _ = uuid.Parse(locationStr)
+	if lotNumber.Valid {
+		lot.LotNumber = &lotNumber.String
+	}
+	if expiresAt.Valid {
+		lot.ExpiresAt = &expiresAt.Time
+	}
+	lot.MovementID = parseNullableUUID(movementStr)
+	if alertedAt.Valid {
+		lot.ExpiryAlertedAt = &alertedAt.Time
+	}
+
+	return &lot, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewSupplierRepository(db *sql.DB, dialect database.Dialect) SupplierRepository {
+	return &supplierRepo{db: db, dialect: dialect}
+}
+
+type supplierRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const supplierColumns = `id, organization_id, name, contact_name, email, phone, lead_time_days, payment_terms, notes, is_active, created_at, updated_at`
+
+func (r *supplierRepo) Create(ctx context.Context, supplier *domain.Supplier) (uuid.UUID, error) {
+	if supplier == nil {
+		return uuid.Nil, errors.New("supplier is nil")
+	}
+
+	if supplier.ID == uuid.Nil {
+		supplier.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	supplier.CreatedAt = now
+	supplier.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO suppliers (`+supplierColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		supplier.ID.String(), supplier.OrganizationID.String(), supplier.Name,
+		supplier.ContactName, supplier.Email, supplier.Phone, supplier.LeadTimeDays,
+		supplier.PaymentTerms, supplier.Notes, supplier.IsActive,
+		supplier.CreatedAt, supplier.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return supplier.ID, nil
+}
+
+func (r *supplierRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Supplier, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+supplierColumns+` FROM suppliers WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return scanSupplier(row)
+}
+
+// GetByName finds a supplier of the organization by exact name
+func (r *supplierRepo) GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Supplier, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+supplierColumns+` FROM suppliers WHERE organization_id = ? AND name = ?
+	`, orgID.String(), name)
+	return scanSupplier(row)
+}
+
+func (r *supplierRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Supplier, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+supplierColumns+` FROM suppliers
+		WHERE organization_id = ?
+		ORDER BY name
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*domain.Supplier
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	return suppliers, rows.Err()
+}
+
+func (r *supplierRepo) Update(ctx context.Context, supplier *domain.Supplier) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	supplier.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE suppliers SET
+			name = ?, contact_name = ?, email = ?, phone = ?, lead_time_days = ?,
+			payment_terms = ?, notes = ?, is_active = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`,
+		supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.LeadTimeDays,
+		supplier.PaymentTerms, supplier.Notes, supplier.IsActive, supplier.UpdatedAt,
+		supplier.ID.String(), org,
+	)
+	return err
+}
+
+// HasPurchaseOrders reports whether any purchase order was placed with the
+// supplier
+func (r *supplierRepo) HasPurchaseOrders(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT 1 FROM purchase_orders WHERE supplier_id = ? LIMIT 1
+	`, id.String()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *supplierRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM suppliers WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
+
+func scanSupplier(row rowScanner) (*domain.Supplier, error) {
+	var supplier domain.Supplier
+	var (
+		idStr, orgStr                           string
+		contactName, email, phone, terms, notes sql.NullString
+	)
+
+	if err := row.Scan(
+		&idStr, &orgStr, &supplier.Name, &contactName, &email, &phone, &supplier.LeadTimeDays,
+		&terms, &notes, &supplier.IsActive, &supplier.CreatedAt, &supplier.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	supplier.ID, _ = uuid.Parse(idStr)
+	supplier.OrganizationID, _ = uuid.Parse(orgStr)
+	if contactName.Valid {
+		supplier.ContactName = &contactName.String
+	}
+	if email.Valid {
+		supplier.Email = &email.String
+	}
+	if phone.Valid {
+		supplier.Phone = &phone.String
+	}
+	if terms.Valid {
+		supplier.PaymentTerms = &terms.String
+	}
+	if notes.Valid {
+		supplier.Notes = &notes.String
+	}
+
+	return &supplier, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoOrganization is returned by repository calls that reach rows by ID
+// when their context isn't scoped to an organization
+var ErrNoOrganization = errors.New("repository call is not scoped to an organization")
+
+type orgCtxKey struct{}
+
+// orgScope is the organization repository calls are scoped to; all spans
+// every organization
+type orgScope struct {
+	id  uuid.UUID
+	all bool
+}
+
+// WithOrganization returns a copy of ctx that scopes repository calls to
+// the organization. Rows of other organizations are then out of reach:
+// lookups by ID find nothing and writes by ID change nothing.
+func WithOrganization(ctx context.Context, orgID uuid.UUID) context.Context {
+	return context.WithValue(ctx, orgCtxKey{}, orgScope{id: orgID})
+}
+
+// AllOrganizations returns a copy of ctx that lets repository calls reach
+// the rows of every organization, for the background jobs serving them all
+func AllOrganizations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, orgCtxKey{}, orgScope{all: true})
+}
+
+// OrganizationFromContext returns the organization ctx is scoped to, if any
+func OrganizationFromContext(ctx context.Context) (uuid.UUID, bool) {
+	scope, ok := ctx.Value(orgCtxKey{}).(orgScope)
+	return scope.id, ok && !scope.all
+}
+
+// orgArg returns the argument binding the tenant condition of a query to
+// the organization ctx is scoped to: its ID, or nil when ctx spans every
+// organization. The condition reads
+//
+//	organization_id = COALESCE(?, organization_id)
+//
+// so that a nil argument matches every row.
+func orgArg(ctx context.Context) (interface{}, error) {
+	scope, ok := ctx.Value(orgCtxKey{}).(orgScope)
+	switch {
+	case !ok:
+		return nil, ErrNoOrganization
+	case scope.all:
+		return nil, nil
+	}
+	return scope.id.String(), nil
+}
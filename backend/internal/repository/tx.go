@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"hasufel.kj/internal/database"
+)
+
+type txCtxKey struct{}
+
+// WithTx returns a copy of ctx that scopes repository calls to tx
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txCtxKey{}, tx)
+}
+
+// TxFromContext returns the transaction bound to ctx, if any
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txCtxKey{}).(*sql.Tx)
+	return tx, ok && tx != nil
+}
+
+// RunInTx runs fn inside a transaction and commits it when fn succeeds.
+// Repository calls made with the context passed to fn share the transaction.
+// When ctx already carries a transaction, fn joins it and the outermost
+// caller decides whether to commit.
+func RunInTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(WithTx(ctx, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// getQuerier returns the transaction bound to ctx, or db when there is none
+func getQuerier(ctx context.Context, db *sql.DB) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// conn returns the querier for ctx with placeholders rebound for dialect
+func conn(ctx context.Context, db *sql.DB, dialect database.Dialect) Querier {
+	q := getQuerier(ctx, db)
+	if dialect == database.DialectSQLite {
+		return q
+	}
+	return rebindQuerier{q: q, dialect: dialect}
+}
+
+// rebindQuerier rewrites ? placeholders before delegating to the wrapped querier
+type rebindQuerier struct {
+	q       Querier
+	dialect database.Dialect
+}
+
+func (r rebindQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.q.ExecContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r rebindQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.q.QueryContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r rebindQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.q.QueryRowContext(ctx, r.dialect.Rebind(query), args...)
+}
@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+func TestRunInTx_RollsBackOnError(t *testing.T) {
+	db := openInMemoryDB(t)
+	defer db.Close()
+
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
+
+	item := &domain.Item{
+		OrganizationID:    uuid.New(),
+		CategoryID:        uuid.New(),
+		Name:              "Thing",
+		UnitOfMeasurement: "pcs",
+		CurrentStock:      3,
+		IsActive:          true,
+		TrackStock:        true,
+	}
+	id, err := repo.Create(ctx, item)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	errBoom := errors.New("boom")
+	err = repository.RunInTx(ctx, db, func(ctx context.Context) error {
+		if err := repo.UpdateStock(ctx, id, 99, 1); err != nil {
+			return err
+		}
+
+		// Reads inside the transaction see its own writes
+		got, err := repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if got.CurrentStock != 99 {
+			t.Errorf("expected stock 99 inside transaction, got %d", got.CurrentStock)
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected errBoom, got %v", err)
+	}
+
+	got, _ := repo.GetByID(ctx, id)
+	if got.CurrentStock != 3 {
+		t.Fatalf("expected stock to be rolled back to 3, got %d", got.CurrentStock)
+	}
+}
+
+func TestRunInTx_CommitsAndJoinsOuterTransaction(t *testing.T) {
+	db := openInMemoryDB(t)
+	defer db.Close()
+
+	ctx := repository.AllOrganizations(context.Background())
+	repo := repository.NewItemRepository(db, database.DialectSQLite)
+
+	item := &domain.Item{
+		OrganizationID:    uuid.New(),
+		CategoryID:        uuid.New(),
+		Name:              "Thing",
+		UnitOfMeasurement: "pcs",
+		CurrentStock:      3,
+		IsActive:          true,
+		TrackStock:        true,
+	}
+	id, _ := repo.Create(ctx, item)
+
+	err := repository.RunInTx(ctx, db, func(ctx context.Context) error {
+		outer, _ := repository.TxFromContext(ctx)
+		return repository.RunInTx(ctx, db, func(ctx context.Context) error {
+			if inner, _ := repository.TxFromContext(ctx); inner != outer {
+				t.Errorf("expected nested call to join the outer transaction")
+			}
+			return repo.UpdateStock(ctx, id, 7, 1)
+		})
+	})
+	if err != nil {
+		t.Fatalf("RunInTx: %v", err)
+	}
+
+	got, _ := repo.GetByID(ctx, id)
+	if got.CurrentStock != 7 {
+		t.Fatalf("expected committed stock 7, got %d", got.CurrentStock)
+	}
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
+	"hasufel.kj/internal/domain"
+)
+
+func NewUnitRepository(db *sql.DB, dialect database.Dialect) UnitRepository {
+	return &unitRepo{db: db, dialect: dialect}
+}
+
+type unitRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+const unitColumns = `id, organization_id, code, name, base_unit, factor, display_precision, created_at, updated_at`
+
+const itemUnitConversionColumns = `id, item_id, unit, quantity, created_at, updated_at`
+
+func (r *unitRepo) Create(ctx context.Context, unit *domain.Unit) (uuid.UUID, error) {
+	if unit == nil {
+		return uuid.Nil, errors.New("unit is nil")
+	}
+
+	if unit.ID == uuid.Nil {
+		unit.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	unit.CreatedAt = now
+	unit.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO units (`+unitColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		unit.ID.String(), unit.OrganizationID.String(), unit.Code, unit.Name,
+		unit.BaseUnit, unit.Factor, unit.Precision, unit.CreatedAt, unit.UpdatedAt,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return unit.ID, nil
+}
+
+func (r *unitRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Unit, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+unitColumns+` FROM units WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return scanUnit(row)
+}
+
+func (r *unitRepo) GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.Unit, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+unitColumns+` FROM units WHERE organization_id = ? AND code = ?
+	`, orgID.String(), code)
+	return scanUnit(row)
+}
+
+func (r *unitRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Unit, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+unitColumns+` FROM units
+		WHERE organization_id = ?
+		ORDER BY code
+	`, orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*domain.Unit
+	for rows.Next() {
+		unit, err := scanUnit(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, unit)
+	}
+
+	return list, rows.Err()
+}
+
+// Update writes the unit's name and precision; its code, base unit and
+// factor never change
+func (r *unitRepo) Update(ctx context.Context, unit *domain.Unit) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	unit.UpdatedAt = time.Now().UTC()
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE units SET name = ?, display_precision = ?, updated_at = ?
+		WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, unit.Name, unit.Precision, unit.UpdatedAt, unit.ID.String(), org)
+	return err
+}
+
+func (r *unitRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM units WHERE id = ? AND organization_id = COALESCE(?, organization_id)
+	`, id.String(), org)
+	return err
+}
+
+// IsInUse reports whether an item, a recipe or another unit of the
+// organization measures in the unit
+func (r *unitRepo) IsInUse(ctx context.Context, orgID uuid.UUID, code string) (bool, error) {
+	var exists int
+	err := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT 1 FROM items WHERE organization_id = ? AND unit_of_measurement = ?
+		UNION ALL
+		SELECT 1 FROM recipes WHERE organization_id = ? AND yield_unit = ?
+		UNION ALL
+		SELECT 1 FROM recipe_components rc
+		JOIN recipes r ON rc.recipe_id = r.id
+		WHERE r.organization_id = ? AND rc.unit = ?
+		UNION ALL
+		SELECT 1 FROM units WHERE organization_id = ? AND base_unit = ? AND code <> ?
+		LIMIT 1
+	`,
+		orgID.String(), code, orgID.String(), code, orgID.String(), code,
+		orgID.String(), code, code,
+	).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *unitRepo) ListItemConversions(ctx context.Context, itemID uuid.UUID) ([]*domain.ItemUnitConversion, error) {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+itemUnitConversionColumns+` FROM item_unit_conversions
+		WHERE item_id = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+		ORDER BY unit
+	`, itemID.String(), org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversions []*domain.ItemUnitConversion
+	for rows.Next() {
+		var conversion domain.ItemUnitConversion
+		var idStr, itemStr string
+		if err := rows.Scan(
+			&idStr, &itemStr, &conversion.Unit, &conversion.Quantity,
+			&conversion.CreatedAt, &conversion.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		conversion.ID, _ = uuid.Parse(idStr)
+		conversion.ItemID, _ = uuid.Parse(itemStr)
+		conversions = append(conversions, &conversion)
+	}
+
+	return conversions, rows.Err()
+}
+
+// SetItemConversion stores the conversion, replacing any previous one of the
+// same item and unit
+func (r *unitRepo) SetItemConversion(ctx context.Context, conversion *domain.ItemUnitConversion) error {
+	if conversion == nil {
+		return errors.New("conversion is nil")
+	}
+
+	if conversion.ID == uuid.Nil {
+		conversion.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	conversion.CreatedAt = now
+	conversion.UpdatedAt = now
+
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		INSERT INTO item_unit_conversions (`+itemUnitConversionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (item_id, unit) DO UPDATE SET
+			quantity = EXCLUDED.quantity, updated_at = EXCLUDED.updated_at
+	`,
+		conversion.ID.String(), conversion.ItemID.String(), conversion.Unit,
+		conversion.Quantity, conversion.CreatedAt, conversion.UpdatedAt,
+	)
+	return err
+}
+
+func (r *unitRepo) DeleteItemConversion(ctx context.Context, itemID uuid.UUID, unit string) error {
+	org, err := orgArg(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		DELETE FROM item_unit_conversions WHERE item_id = ? AND unit = ? AND item_id IN (
+			SELECT id FROM items WHERE organization_id = COALESCE(?, organization_id)
+		)
+	`, itemID.String(), unit, org)
+	return err
+}
+
+func scanUnit(row rowScanner) (*domain.Unit, error) {
+	var unit domain.Unit
+	var idStr, orgStr string
+
+	if err := row.Scan(
+		&idStr, &orgStr, &unit.Code, &unit.Name, &unit.BaseUnit, &unit.Factor,
+		&unit.Precision, &unit.CreatedAt, &unit.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	unit.ID, _ = uuid.Parse(idStr)
+	unit.OrganizationID, _ = uuid.Parse(orgStr)
+
+	return &unit, nil
+}
@@ -7,18 +7,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 )
 
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepoSQLite{db: db}
+func NewUserRepository(db *sql.DB, dialect database.Dialect) UserRepository {
+	return &userRepo{db: db, dialect: dialect}
 }
 
-type userRepoSQLite struct {
-	db *sql.DB
+type userRepo struct {
+	db      *sql.DB
+	dialect database.Dialect
 }
 
-func (r *userRepoSQLite) Create(ctx context.Context, user *domain.User) (uuid.UUID, error) {
+func (r *userRepo) Create(ctx context.Context, user *domain.User) (uuid.UUID, error) {
 	if user == nil {
 		return uuid.Nil, errors.New("user is nil")
 	}
@@ -30,28 +32,43 @@ func (r *userRepoSQLite) Create(ctx context.Context, user *domain.User) (uuid.UU
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO users (
-			id, organization_id, email, password_hash,
-			first_name, last_name, role, is_active,
-			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`,
-		user.ID.String(), user.OrganizationID.String(), user.Email,
-		user.PasswordHash, user.FirstName, user.LastName,
-		user.Role, user.IsActive, user.CreatedAt, user.UpdatedAt,
-	)
+	// The user is a member of their home organization from the start
+	err := RunInTx(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db, r.dialect)
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO users (
+				id, organization_id, email, password_hash,
+				first_name, last_name, role, is_active,
+				created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			user.ID.String(), user.OrganizationID.String(), user.Email,
+			user.PasswordHash, user.FirstName, user.LastName,
+			user.Role, user.IsActive, user.CreatedAt, user.UpdatedAt,
+		); err != nil {
+			return err
+		}
+
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO organization_members (`+membershipColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`,
+			user.OrganizationID.String(), user.ID.String(), user.Role, user.IsActive,
+			user.CreatedAt, user.UpdatedAt,
+		)
+		return err
+	})
 	if err != nil {
 		return uuid.Nil, err
 	}
 	return user.ID, nil
 }
 
-func (r *userRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
 		SELECT id, organization_id, email, password_hash,
 		       first_name, last_name, role, is_active,
-		       created_at, updated_at
+		       token_version, created_at, updated_at
 		FROM users WHERE id = ?
 	`, id.String())
 
@@ -61,7 +78,7 @@ func (r *userRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.Use
 	if err := row.Scan(
 		&idStr, &orgStr, &user.Email, &user.PasswordHash,
 		&user.FirstName, &user.LastName, &user.Role, &user.IsActive,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.TokenVersion, &user.CreatedAt, &user.UpdatedAt,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -75,11 +92,11 @@ func (r *userRepoSQLite) GetByID(ctx context.Context, id uuid.UUID) (*domain.Use
 	return &user, nil
 }
 
-func (r *userRepoSQLite) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
 		SELECT id, organization_id, email, password_hash,
 		       first_name, last_name, role, is_active,
-		       created_at, updated_at
+		       token_version, created_at, updated_at
 		FROM users WHERE email = ?
 	`, email)
 
@@ -89,7 +106,7 @@ func (r *userRepoSQLite) GetByEmail(ctx context.Context, email string) (*domain.
 	if err := row.Scan(
 		&idStr, &orgStr, &user.Email, &user.PasswordHash,
 		&user.FirstName, &user.LastName, &user.Role, &user.IsActive,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.TokenVersion, &user.CreatedAt, &user.UpdatedAt,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -103,14 +120,21 @@ func (r *userRepoSQLite) GetByEmail(ctx context.Context, email string) (*domain.
 	return &user, nil
 }
 
-func (r *userRepoSQLite) List(ctx context.Context, orgID uuid.UUID) ([]*domain.User, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, organization_id, email, password_hash,
-		       first_name, last_name, role, is_active,
-		       created_at, updated_at
-		FROM users
-		WHERE organization_id = ?
-		ORDER BY created_at DESC
+// memberColumns selects a user as a member of an organization: with the
+// organization, role and active flag of the membership
+const memberColumns = `u.id, m.organization_id, u.email, u.password_hash,
+		       u.first_name, u.last_name, m.role, u.is_active AND m.is_active,
+		       u.token_version, u.created_at, u.updated_at`
+
+// List lists the members of the organization, newest first, each as a
+// member of it
+func (r *userRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.User, error) {
+	rows, err := conn(ctx, r.db, r.dialect).QueryContext(ctx, `
+		SELECT `+memberColumns+`
+		FROM users u
+		JOIN organization_members m ON m.user_id = u.id
+		WHERE m.organization_id = ?
+		ORDER BY m.created_at DESC
 	`, orgID.String())
 	if err != nil {
 		return nil, err
@@ -125,7 +149,7 @@ func (r *userRepoSQLite) List(ctx context.Context, orgID uuid.UUID) ([]*domain.U
 		if err := rows.Scan(
 			&idStr, &orgStr, &user.Email, &user.PasswordHash,
 			&user.FirstName, &user.LastName, &user.Role, &user.IsActive,
-			&user.CreatedAt, &user.UpdatedAt,
+			&user.TokenVersion, &user.CreatedAt, &user.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -138,17 +162,65 @@ func (r *userRepoSQLite) List(ctx context.Context, orgID uuid.UUID) ([]*domain.U
 	return users, rows.Err()
 }
 
-func (r *userRepoSQLite) Update(ctx context.Context, user *domain.User) error {
+// GetMember returns the user as a member of the organization, or nil when
+// they aren't one
+func (r *userRepo) GetMember(ctx context.Context, orgID, id uuid.UUID) (*domain.User, error) {
+	row := conn(ctx, r.db, r.dialect).QueryRowContext(ctx, `
+		SELECT `+memberColumns+`
+		FROM users u
+		JOIN organization_members m ON m.user_id = u.id
+		WHERE m.organization_id = ? AND u.id = ?
+	`, orgID.String(), id.String())
+
+	var user domain.User
+	var idStr, orgStr string
+
+	if err := row.Scan(
+		&idStr, &orgStr, &user.Email, &user.PasswordHash,
+		&user.FirstName, &user.LastName, &user.Role, &user.IsActive,
+		&user.TokenVersion, &user.CreatedAt, &user.UpdatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	user.ID, _ = uuid.Parse(idStr)
+	user.OrganizationID, _ = uuid.Parse(orgStr)
+
+	return &user, nil
+}
+
+func (r *userRepo) Update(ctx context.Context, user *domain.User) error {
 	user.UpdatedAt = time.Now().UTC()
-	_, err := r.db.ExecContext(ctx, `
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
 		UPDATE users SET
-			email = ?, first_name = ?, last_name = ?,
+			email = ?, password_hash = ?, first_name = ?, last_name = ?,
 			role = ?, is_active = ?, updated_at = ?
 		WHERE id = ?
 	`,
-		user.Email, user.FirstName, user.LastName,
+		user.Email, user.PasswordHash, user.FirstName, user.LastName,
 		user.Role, user.IsActive, user.UpdatedAt,
 		user.ID.String(),
 	)
 	return err
 }
+
+func (r *userRepo) BumpTokenVersion(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE users SET token_version = token_version + 1, updated_at = ?
+		WHERE id = ?
+	`, time.Now().UTC(), id.String())
+	return err
+}
+
+// SetHomeOrganization makes the organization the user's home organization,
+// with their role there
+func (r *userRepo) SetHomeOrganization(ctx context.Context, id, orgID uuid.UUID, role domain.UserRole) error {
+	_, err := conn(ctx, r.db, r.dialect).ExecContext(ctx, `
+		UPDATE users SET organization_id = ?, role = ?, updated_at = ?
+		WHERE id = ?
+	`, orgID.String(), role, time.Now().UTC(), id.String())
+	return err
+}
@@ -2,6 +2,11 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -17,6 +22,19 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrUserInactive       = errors.New("user is inactive")
 	ErrEmailExists        = errors.New("email already exists")
+	// ErrInvalidRefreshToken is returned for a refresh token that is
+	// unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was
+	// already exchanged is presented again. Its whole family is revoked, as
+	// either the token or the one it was exchanged for has leaked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrInvalidInvitation is returned when registering with an invitation
+	// token that is unknown, expired, revoked or already accepted
+	ErrInvalidInvitation = errors.New("invitation is invalid or has expired")
+	// ErrNotMember is returned when switching to an organization the user
+	// isn't an active member of
+	ErrNotMember = errors.New("user is not an active member of the organization")
 )
 
 type Claims struct {
@@ -24,87 +42,378 @@ type Claims struct {
 	Email          string `json:"email"`
 	OrganizationID string `json:"organization_id"`
 	Role           string `json:"role"`
+	// TokenVersion is the user's token version when the token was issued.
+	// The token is revoked once the version moves on.
+	TokenVersion int `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
+// TokenLifetimes holds how long access and refresh tokens are good for
+type TokenLifetimes struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+// DefaultTokenLifetimes are used for the lifetimes left unset
+var DefaultTokenLifetimes = TokenLifetimes{
+	Access:  15 * time.Minute,
+	Refresh: 30 * 24 * time.Hour,
+}
+
+// AuthService signs users in and keeps their sessions. A session is in one
+// organization at a time: sign-in starts it in the user's home organization,
+// or the first other one they are an active member of, and switching moves
+// it to another. Tokens carry the organization and the user's role there.
 type AuthService struct {
-	userRepo  repository.UserRepository
-	jwtSecret string
+	userRepo         repository.UserRepository
+	orgRepo          repository.OrganizationRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	invitationRepo   repository.InvitationRepository
+	db               *sql.DB
+	jwtSecret        string
+	lifetimes        TokenLifetimes
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, refreshTokenRepo repository.RefreshTokenRepository, invitationRepo repository.InvitationRepository, db *sql.DB, jwtSecret string, lifetimes TokenLifetimes) *AuthService {
+	if lifetimes.Access <= 0 {
+		lifetimes.Access = DefaultTokenLifetimes.Access
+	}
+	if lifetimes.Refresh <= 0 {
+		lifetimes.Refresh = DefaultTokenLifetimes.Refresh
+	}
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:         userRepo,
+		orgRepo:          orgRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		invitationRepo:   invitationRepo,
+		db:               db,
+		jwtSecret:        jwtSecret,
+		lifetimes:        lifetimes,
 	}
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, *domain.User, error) {
+// Login authenticates a user and starts a session: an access token and the
+// first refresh token of a new family. The user is returned as a member of
+// the organization the session starts in.
+func (s *AuthService) Login(ctx context.Context, email, password string) (*domain.AuthTokens, *domain.User, error) {
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 	if user == nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
 	}
 
 	if !user.IsActive {
-		return "", nil, ErrUserInactive
+		return nil, nil, ErrUserInactive
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	if err := s.acceptInvitations(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	member, err := s.signInMember(ctx, user)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user)
+	tokens, err := s.issueTokens(ctx, member, uuid.New())
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	return tokens, member, nil
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(ctx context.Context, user *domain.User, password string) (string, error) {
-	// Check if email already exists
-	existing, err := s.userRepo.GetByEmail(ctx, user.Email)
+// acceptInvitations makes the user a member of each organization with an
+// invitation pending for their email, with the role it gives, and marks the
+// invitation accepted. Organizations invite existing users this way, so
+// they only join when they sign in or refresh their session. A membership
+// the user already has is left as it is.
+func (s *AuthService) acceptInvitations(ctx context.Context, user *domain.User) error {
+	invitations, err := s.invitationRepo.ListOpen(ctx, user.Email)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, inv := range invitations {
+		if inv.StatusAt(now) != domain.InvitationPending {
+			continue
+		}
+		err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+			accepted, err := s.invitationRepo.MarkAccepted(ctx, inv.ID, user.ID, now)
+			if err != nil || !accepted {
+				return err
+			}
+			existing, err := s.orgRepo.GetMember(ctx, inv.OrganizationID, user.ID)
+			if err != nil || existing != nil {
+				return err
+			}
+			return s.orgRepo.AddMember(ctx, &domain.Membership{
+				OrganizationID: inv.OrganizationID,
+				UserID:         user.ID,
+				Role:           inv.Role,
+				IsActive:       true,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signInMember returns the user as a member of the organization a new
+// session starts in: their home organization, or the first other one they
+// are an active member of. A user active in none is inactive.
+func (s *AuthService) signInMember(ctx context.Context, user *domain.User) (*domain.User, error) {
+	member, err := s.member(ctx, user.OrganizationID, user.ID)
+	if err != ErrNotMember {
+		return member, err
+	}
+
+	orgs, err := s.orgRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orgs) == 0 {
+		return nil, ErrUserInactive
+	}
+	return s.member(ctx, orgs[0].ID, user.ID)
+}
+
+// member returns the user as an active member of the organization, or
+// ErrNotMember
+func (s *AuthService) member(ctx context.Context, orgID, userID uuid.UUID) (*domain.User, error) {
+	member, err := s.userRepo.GetMember(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
 	}
-	if existing != nil {
-		return "", ErrEmailExists
+	if member == nil || !member.IsActive {
+		return nil, ErrNotMember
+	}
+	return member, nil
+}
+
+// Register accepts an invitation: it creates the account of the invitee,
+// with the email, organization and role of the invitation, and starts a
+// session for it
+func (s *AuthService) Register(ctx context.Context, invitationToken string, user *domain.User, password string) (*domain.AuthTokens, error) {
+	now := time.Now().UTC()
+	inv, err := s.invitationRepo.GetByHash(ctx, hashToken(invitationToken))
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || inv.StatusAt(now) != domain.InvitationPending {
+		return nil, ErrInvalidInvitation
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	user.PasswordHash = string(hashedPassword)
 
-	// Set defaults
+	user.Email = inv.Email
+	user.OrganizationID = inv.OrganizationID
+	user.Role = inv.Role
 	user.IsActive = true
-	if user.Role == "" {
-		user.Role = domain.RoleUser
+
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		// Check if email already exists
+		existing, err := s.userRepo.GetByEmail(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrEmailExists
+		}
+
+		// Create user
+		userID, err := s.userRepo.Create(ctx, user)
+		if err != nil {
+			return err
+		}
+		user.ID = userID
+
+		accepted, err := s.invitationRepo.MarkAccepted(ctx, inv.ID, userID, now)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvalidInvitation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, uuid.New())
+}
+
+// Refresh exchanges a refresh token for a new access token and the next
+// refresh token of its family, in the organization the session is in. Each
+// refresh token can be exchanged once; presenting it again revokes the
+// family and returns ErrRefreshTokenReused.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain.AuthTokens, error) {
+	tokens, _, err := s.exchange(ctx, refreshToken, nil)
+	return tokens, err
+}
+
+// SwitchOrganization exchanges a refresh token like Refresh does, but for
+// tokens in another organization the user is an active member of; the
+// session carries on there. The user is returned as a member of it. The
+// refresh token is left alone when the user can't switch.
+func (s *AuthService) SwitchOrganization(ctx context.Context, refreshToken string, orgID uuid.UUID) (*domain.AuthTokens, *domain.User, error) {
+	return s.exchange(ctx, refreshToken, &orgID)
+}
+
+// exchange exchanges a refresh token for the next tokens of its family, in
+// the organization switchTo names or else the one the session is in
+func (s *AuthService) exchange(ctx context.Context, refreshToken string, switchTo *uuid.UUID) (*domain.AuthTokens, *domain.User, error) {
+	now := time.Now().UTC()
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil || token.RevokedAt != nil || !now.Before(token.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if token.UsedAt != nil {
+		return nil, nil, s.revokeReusedFamily(ctx, token, now)
 	}
 
-	// Create user
-	userID, err := s.userRepo.Create(ctx, user)
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+	if user == nil || !user.IsActive {
+		if err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+			return nil, nil, err
+		}
+		if user == nil {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, ErrUserInactive
+	}
+	if err := s.acceptInvitations(ctx, user); err != nil {
+		return nil, nil, err
 	}
-	user.ID = userID
 
-	// Generate JWT token
-	token, err := s.generateToken(user)
+	orgID := user.OrganizationID
+	switch {
+	case switchTo != nil:
+		orgID = *switchTo
+	case token.OrganizationID != nil:
+		orgID = *token.OrganizationID
+	}
+	member, err := s.member(ctx, orgID, user.ID)
+	if err == ErrNotMember && switchTo == nil {
+		// The user was removed from the session's organization or
+		// deactivated there, which ends the session
+		if err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrUserInactive
+	}
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+
+	// Marking the token used only succeeds once, so of two refreshes racing
+	// with the same token the second is treated as reuse
+	marked, err := s.refreshTokenRepo.MarkUsed(ctx, token.ID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !marked {
+		return nil, nil, s.revokeReusedFamily(ctx, token, now)
 	}
 
-	return token, nil
+	tokens, err := s.issueTokens(ctx, member, token.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, member, nil
+}
+
+// revokeReusedFamily revokes the family of a refresh token presented after
+// it was exchanged
+func (s *AuthService) revokeReusedFamily(ctx context.Context, token *domain.RefreshToken, now time.Time) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout ends the session a refresh token belongs to by revoking its family.
+// Access tokens already issued stay good until they expire. Unknown tokens
+// are ignored, so logging out twice is not an error.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if token == nil || token.RevokedAt != nil {
+		return nil
+	}
+	return s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID, time.Now().UTC())
+}
+
+// RevokeSessions ends every session of the user at once: the access tokens
+// issued so far stop being accepted and every refresh token is revoked
+func (s *AuthService) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := s.ExpireAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeUser(ctx, userID, time.Now().UTC())
+}
+
+// RevokeOrganizationSessions ends the user's sessions in the organization:
+// their refresh tokens there are revoked, and the access tokens issued so
+// far stop being accepted, so sessions in other organizations refresh and
+// carry on
+func (s *AuthService) RevokeOrganizationSessions(ctx context.Context, userID, orgID uuid.UUID) error {
+	if err := s.ExpireAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeUserInOrganization(ctx, userID, orgID, time.Now().UTC())
+}
+
+// ExpireAccessTokens stops the access tokens issued to the user so far from
+// being accepted while keeping the sessions open, so that clients refresh
+// them and pick up changes to the user such as a new role
+func (s *AuthService) ExpireAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.userRepo.BumpTokenVersion(ctx, userID)
+}
+
+// CheckSession reports whether an access token issued to the user at the
+// given token version is still good: the user must still exist, be active
+// and not have had their sessions revoked since
+func (s *AuthService) CheckSession(ctx context.Context, userID string, tokenVersion int) (bool, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return user != nil && user.IsActive && user.TokenVersion == tokenVersion, nil
+}
+
+// PurgeExpiredRefreshTokens deletes the refresh tokens past their expiry.
+// Used tokens are kept until then so that their reuse is still detected.
+func (s *AuthService) PurgeExpiredRefreshTokens(ctx context.Context) (int64, error) {
+	return s.refreshTokenRepo.DeleteExpired(ctx, time.Now().UTC())
 }
 
 // ValidateToken validates a JWT token and returns the claims
@@ -140,52 +449,137 @@ func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*domai
 	return user, nil
 }
 
-// ChangePassword changes a user's password
-func (s *AuthService) ChangePassword(ctx context.Context, userID uuid.UUID, oldPassword, newPassword string) error {
+// GetMember retrieves a user as a member of the organization
+func (s *AuthService) GetMember(ctx context.Context, orgID, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.userRepo.GetMember(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ChangePassword changes a user's password. Every session of the user is
+// revoked, and a new one is started for the caller in the organization
+// they are in.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, orgID uuid.UUID, oldPassword, newPassword string) (*domain.AuthTokens, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if user == nil {
-		return ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 
 	// Verify old password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)); err != nil {
-		return ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
 	}
 
 	// Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	user.PasswordHash = string(hashedPassword)
 
-	// Update user
-	return s.userRepo.Update(ctx, user)
+	// The new password, the revoked sessions and the session that replaces
+	// them commit together, so old sessions never outlive the old password
+	var tokens *domain.AuthTokens
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := s.RevokeSessions(ctx, userID); err != nil {
+			return err
+		}
+
+		member, err := s.member(ctx, orgID, userID)
+		if err != nil {
+			return err
+		}
+		tokens, err = s.issueTokens(ctx, member, uuid.New())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// issueTokens issues an access token for the user, as a member of the
+// organization the session is in, and the next refresh token of the family
+func (s *AuthService) issueTokens(ctx context.Context, user *domain.User, familyID uuid.UUID) (*domain.AuthTokens, error) {
+	now := time.Now().UTC()
+	accessToken, expiresAt, err := s.generateToken(user, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	orgID := user.OrganizationID
+	if err := s.refreshTokenRepo.Create(ctx, &domain.RefreshToken{
+		UserID:         user.ID,
+		OrganizationID: &orgID,
+		FamilyID:       familyID,
+		TokenHash:      hashToken(refreshToken),
+		ExpiresAt:      now.Add(s.lifetimes.Refresh),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &domain.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
 }
 
-// generateToken creates a JWT token for a user
-func (s *AuthService) generateToken(user *domain.User) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// generateToken creates a JWT access token for a user and returns when it
+// expires
+func (s *AuthService) generateToken(user *domain.User, now time.Time) (string, time.Time, error) {
+	expirationTime := now.Add(s.lifetimes.Access)
 
 	claims := &Claims{
 		UserID:         user.ID.String(),
 		Email:          user.Email,
 		OrganizationID: user.OrganizationID.String(),
 		Role:           string(user.Role),
+		TokenVersion:   user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(s.jwtSecret))
 	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expirationTime, nil
+}
+
+// newToken returns a random, URL-safe token for a refresh token or an
+// invitation
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
 
-	return tokenString, nil
+// hashToken returns the hex SHA-256 hash refresh and invitation tokens are
+// stored as
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -3,10 +3,17 @@ package services
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
 )
 
 type DashboardMetrics struct {
@@ -30,11 +37,37 @@ type CategoryBreakdown struct {
 	TotalValue   float64   `json:"total_value"`
 }
 
+type LocationBreakdown struct {
+	LocationID      uuid.UUID `json:"locationId"`
+	LocationName    string    `json:"locationName"`
+	IsDefault       bool      `json:"isDefault"`
+	ItemCount       int       `json:"itemCount"`
+	TotalValue      float64   `json:"totalValue"`
+	LowStockCount   int       `json:"lowStockCount"`
+	OutOfStockCount int       `json:"outOfStockCount"`
+}
+
+// ExpiringLot is a lot with stock left that has expired or expires soon.
+// DaysLeft is negative once the lot has expired.
+type ExpiringLot struct {
+	LotID             uuid.UUID `json:"lotId"`
+	ItemID            uuid.UUID `json:"itemId"`
+	ItemName          string    `json:"itemName"`
+	UnitOfMeasurement string    `json:"unitOfMeasurement"`
+	LocationID        uuid.UUID `json:"locationId"`
+	LocationName      string    `json:"locationName"`
+	LotNumber         *string   `json:"lotNumber"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+	Quantity          int       `json:"quantity"`
+	DaysLeft          int       `json:"daysLeft"`
+}
+
 type DashboardService struct {
 	itemRepo     repository.ItemRepository
 	movementRepo repository.MovementRepository
 	alertRepo    repository.AlertRepository
 	db           *sql.DB
+	dialect      database.Dialect
 }
 
 func NewDashboardService(
@@ -42,31 +75,51 @@ func NewDashboardService(
 	movementRepo repository.MovementRepository,
 	alertRepo repository.AlertRepository,
 	db *sql.DB,
+	dialect database.Dialect,
 ) *DashboardService {
 	return &DashboardService{
 		itemRepo:     itemRepo,
 		movementRepo: movementRepo,
 		alertRepo:    alertRepo,
 		db:           db,
+		dialect:      dialect,
 	}
 }
 
-// GetMetrics retrieves dashboard metrics for an organization
-func (s *DashboardService) GetMetrics(ctx context.Context, orgID uuid.UUID) (*DashboardMetrics, error) {
+// GetMetrics retrieves dashboard metrics for an organization. With a
+// locationID the stock figures and movement count cover that location only;
+// otherwise they are totals across all locations.
+func (s *DashboardService) GetMetrics(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID) (*DashboardMetrics, error) {
 	metrics := &DashboardMetrics{}
 
 	// Get total items and value
 	query := `
 		SELECT
 			COUNT(*) as total_items,
-			COALESCE(SUM(current_stock * COALESCE(unit_cost, 0)), 0) as total_value,
-			COALESCE(SUM(CASE WHEN track_stock = 1 AND current_stock < minimum_threshold AND current_stock > 0 THEN 1 ELSE 0 END), 0) as low_stock,
-			COALESCE(SUM(CASE WHEN track_stock = 1 AND current_stock = 0 THEN 1 ELSE 0 END), 0) as out_of_stock
-		FROM items
-		WHERE organization_id = ? AND is_active = 1
+			COALESCE(SUM(` + itemValue + `), 0) as total_value,
+			COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND i.current_stock < i.minimum_threshold AND i.current_stock > 0 THEN 1 ELSE 0 END), 0) as low_stock,
+			COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND i.current_stock = 0 THEN 1 ELSE 0 END), 0) as out_of_stock
+		FROM items i
+		` + itemValueJoins + `
+		WHERE i.organization_id = ? AND i.is_active = TRUE
 	`
+	args := []interface{}{orgID.String()}
+	if locationID != nil {
+		query = `
+			SELECT
+				COUNT(*) as total_items,
+				COALESCE(SUM(` + levelValue + `), 0) as total_value,
+				COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND sl.quantity < ` + locationThreshold + ` AND sl.quantity > 0 THEN 1 ELSE 0 END), 0) as low_stock,
+				COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND sl.quantity = 0 THEN 1 ELSE 0 END), 0) as out_of_stock
+			FROM stock_levels sl
+			JOIN items i ON sl.item_id = i.id
+			` + itemValueJoins + `
+			WHERE i.organization_id = ? AND i.is_active = TRUE AND sl.location_id = ?
+		`
+		args = append(args, locationID.String())
+	}
 
-	err := s.db.QueryRowContext(ctx, query, orgID.String()).Scan(
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind(query), args...).Scan(
 		&metrics.TotalItems,
 		&metrics.TotalValue,
 		&metrics.LowStockCount,
@@ -82,10 +135,16 @@ func (s *DashboardService) GetMetrics(ctx context.Context, orgID uuid.UUID) (*Da
 		FROM stock_movements sm
 		JOIN items i ON sm.item_id = i.id
 		WHERE i.organization_id = ?
-		AND sm.created_at >= datetime('now', '-7 days')
+		AND sm.created_at >= ?
 	`
+	since := time.Now().UTC().AddDate(0, 0, -7)
+	args = []interface{}{orgID.String(), since}
+	if locationID != nil {
+		movementQuery += ` AND (sm.location_id = ? OR sm.to_location_id = ?)`
+		args = append(args, locationID.String(), locationID.String())
+	}
 
-	err = s.db.QueryRowContext(ctx, movementQuery, orgID.String()).Scan(&metrics.RecentMovements)
+	err = s.db.QueryRowContext(ctx, s.dialect.Rebind(movementQuery), args...).Scan(&metrics.RecentMovements)
 	if err != nil {
 		return nil, err
 	}
@@ -100,20 +159,22 @@ func (s *DashboardService) GetRecentMovements(ctx context.Context, orgID uuid.UU
 
 // GetStockTrends retrieves stock movement trends for the last N days
 func (s *DashboardService) GetStockTrends(ctx context.Context, orgID uuid.UUID, days int) ([]StockTrend, error) {
+	day := s.dialect.DateExpr("sm.created_at")
 	query := `
 		SELECT
-			DATE(sm.created_at) as date,
+			` + day + ` as date,
 			SUM(CASE WHEN sm.movement_type = 'IN' THEN sm.quantity ELSE 0 END) as in_count,
 			SUM(CASE WHEN sm.movement_type = 'OUT' THEN sm.quantity ELSE 0 END) as out_count
 		FROM stock_movements sm
 		JOIN items i ON sm.item_id = i.id
 		WHERE i.organization_id = ?
-		AND sm.created_at >= datetime('now', '-' || ? || ' days')
-		GROUP BY DATE(sm.created_at)
+		AND sm.created_at >= ?
+		GROUP BY ` + day + `
 		ORDER BY date DESC
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, orgID.String(), days)
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), orgID.String(), since)
 	if err != nil {
 		return nil, err
 	}
@@ -138,15 +199,16 @@ func (s *DashboardService) GetCategoryBreakdown(ctx context.Context, orgID uuid.
 			c.id as category_id,
 			c.name as category_name,
 			COUNT(i.id) as item_count,
-			COALESCE(SUM(i.current_stock * COALESCE(i.unit_cost, 0)), 0) as total_value
+			COALESCE(SUM(` + itemValue + `), 0) as total_value
 		FROM categories c
-		LEFT JOIN items i ON c.id = i.category_id AND i.is_active = 1
+		LEFT JOIN items i ON c.id = i.category_id AND i.is_active = TRUE
+		` + itemValueJoins + `
 		WHERE c.organization_id = ?
 		GROUP BY c.id, c.name
 		ORDER BY total_value DESC
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, orgID.String())
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), orgID.String())
 	if err != nil {
 		return nil, err
 	}
@@ -166,22 +228,83 @@ func (s *DashboardService) GetCategoryBreakdown(ctx context.Context, orgID uuid.
 	return breakdown, rows.Err()
 }
 
-// GetLowStockItems retrieves items below their minimum threshold
-func (s *DashboardService) GetLowStockItems(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Item, error) {
+// itemValueJoins joins the open cost layers of each item i as cl and its
+// unit of measurement, when it is a unit of the organization, as u
+const itemValueJoins = `LEFT JOIN (
+			SELECT item_id, SUM(quantity) AS quantity, SUM(quantity * unit_cost) AS value
+			FROM cost_layers
+			GROUP BY item_id
+		) cl ON cl.item_id = i.id
+		LEFT JOIN units u ON u.organization_id = i.organization_id AND u.code = i.unit_of_measurement`
+
+// itemValue is what the stock of item i cost: its open cost layers, and
+// stock no layer covers at the item's unit cost. It needs itemValueJoins.
+var itemValue = `(COALESCE(cl.value, 0) + CASE WHEN i.current_stock > COALESCE(cl.quantity, 0)
+			THEN (i.current_stock - COALESCE(cl.quantity, 0)) * COALESCE(i.unit_cost, 0) / ` + unitFactor() + `
+			ELSE 0 END)`
+
+// levelValue is the share of itemValue held in stock level sl
+var levelValue = `CASE WHEN i.current_stock > 0 THEN sl.quantity * ` + itemValue + ` / i.current_stock ELSE 0 END`
+
+// unitFactor is the SQL for how many base units the unit of measurement of
+// item i holds: the factor of the organization's unit u, or of the built-in
+// unit
+func unitFactor() string {
+	codes := make([]string, 0, len(units.SupportedUnits))
+	for code := range units.SupportedUnits {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var b strings.Builder
+	b.WriteString("COALESCE(u.factor, CASE i.unit_of_measurement")
+	for _, code := range codes {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", code, units.SupportedUnits[code].Factor)
+	}
+	b.WriteString(" ELSE 1 END)")
+	return b.String()
+}
+
+// locationThreshold is the minimum threshold that applies to a stock level:
+// its own when set, otherwise the item's
+const locationThreshold = `COALESCE(sl.minimum_threshold, i.minimum_threshold)`
+
+// GetLowStockItems retrieves items below their minimum threshold. With a
+// locationID the stock and threshold of each returned item are those at that
+// location.
+func (s *DashboardService) GetLowStockItems(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID, limit int) ([]*domain.Item, error) {
 	query := `
 		SELECT id, organization_id, category_id, name, sku, unit_of_measurement,
 		       minimum_threshold, current_stock, unit_cost, is_active, track_stock, created_at, updated_at
 		FROM items
 		WHERE organization_id = ?
-		AND is_active = 1
-		AND track_stock = 1
+		AND is_active = TRUE
+		AND track_stock = TRUE
 		AND current_stock < minimum_threshold
 		AND current_stock > 0
 		ORDER BY (minimum_threshold - current_stock) DESC
 		LIMIT ?
 	`
+	args := []interface{}{orgID.String(), limit}
+	if locationID != nil {
+		query = `
+			SELECT i.id, i.organization_id, i.category_id, i.name, i.sku, i.unit_of_measurement,
+			       ` + locationThreshold + `, sl.quantity, i.unit_cost, i.is_active, i.track_stock, i.created_at, i.updated_at
+			FROM stock_levels sl
+			JOIN items i ON sl.item_id = i.id
+			WHERE i.organization_id = ?
+			AND sl.location_id = ?
+			AND i.is_active = TRUE
+			AND i.track_stock = TRUE
+			AND sl.quantity < ` + locationThreshold + `
+			AND sl.quantity > 0
+			ORDER BY (` + locationThreshold + ` - sl.quantity) DESC
+			LIMIT ?
+		`
+		args = []interface{}{orgID.String(), locationID.String(), limit}
+	}
 
-	rows, err := s.db.QueryContext(ctx, query, orgID.String(), limit)
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -207,6 +330,103 @@ func (s *DashboardService) GetLowStockItems(ctx context.Context, orgID uuid.UUID
 	return items, rows.Err()
 }
 
+// GetLocationBreakdown retrieves item count, value and stock health by location
+func (s *DashboardService) GetLocationBreakdown(ctx context.Context, orgID uuid.UUID) ([]LocationBreakdown, error) {
+	query := `
+		SELECT
+			l.id as location_id,
+			l.name as location_name,
+			l.is_default,
+			COUNT(i.id) as item_count,
+			COALESCE(SUM(` + levelValue + `), 0) as total_value,
+			COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND sl.quantity < ` + locationThreshold + ` AND sl.quantity > 0 THEN 1 ELSE 0 END), 0) as low_stock,
+			COALESCE(SUM(CASE WHEN i.track_stock = TRUE AND sl.quantity = 0 THEN 1 ELSE 0 END), 0) as out_of_stock
+		FROM locations l
+		LEFT JOIN stock_levels sl ON sl.location_id = l.id
+		LEFT JOIN items i ON sl.item_id = i.id AND i.is_active = TRUE
+		` + itemValueJoins + `
+		WHERE l.organization_id = ? AND l.is_active = TRUE
+		GROUP BY l.id, l.name, l.is_default
+		ORDER BY l.is_default DESC, l.name
+	`
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), orgID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breakdown []LocationBreakdown
+	for rows.Next() {
+		var loc LocationBreakdown
+		var locationIDStr string
+		if err := rows.Scan(
+			&locationIDStr, &loc.LocationName, &loc.IsDefault, &loc.ItemCount,
+			&loc.TotalValue, &loc.LowStockCount, &loc.OutOfStockCount,
+		); err != nil {
+			return nil, err
+		}
+		loc.LocationID, _ = uuid.Parse(locationIDStr)
+		breakdown = append(breakdown, loc)
+	}
+
+	return breakdown, rows.Err()
+}
+
+// GetExpiringLots retrieves lots with stock left that expire within the next
+// days, including lots that have already expired, soonest first. With a
+// locationID only lots at that location are returned.
+func (s *DashboardService) GetExpiringLots(ctx context.Context, orgID uuid.UUID, days int, locationID *uuid.UUID) ([]ExpiringLot, error) {
+	query := `
+		SELECT sl.id, sl.item_id, i.name, i.unit_of_measurement, sl.location_id, l.name,
+		       sl.lot_number, sl.expires_at, sl.quantity
+		FROM stock_lots sl
+		JOIN items i ON sl.item_id = i.id
+		JOIN locations l ON sl.location_id = l.id
+		WHERE i.organization_id = ?
+		AND i.is_active = TRUE
+		AND sl.quantity > 0
+		AND sl.expires_at IS NOT NULL
+		AND sl.expires_at <= ?
+	`
+	now := time.Now().UTC()
+	args := []interface{}{orgID.String(), now.AddDate(0, 0, days)}
+	if locationID != nil {
+		query += ` AND sl.location_id = ?`
+		args = append(args, locationID.String())
+	}
+	query += ` ORDER BY sl.expires_at, i.name`
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []ExpiringLot{}
+	for rows.Next() {
+		var lot ExpiringLot
+		var lotIDStr, itemIDStr, locationIDStr string
+		var lotNumber sql.NullString
+		if err := rows.Scan(
+			&lotIDStr, &itemIDStr, &lot.ItemName, &lot.UnitOfMeasurement, &locationIDStr, &lot.LocationName,
+			&lotNumber, &lot.ExpiresAt, &lot.Quantity,
+		); err != nil {
+			return nil, err
+		}
+		lot.LotID, _ = uuid.Parse(lotIDStr)
+		lot.ItemID, _ = uuid.Parse(itemIDStr)
+		lot.LocationID, _ = uuid.Parse(locationIDStr)
+		if lotNumber.Valid {
+			lot.LotNumber = &lotNumber.String
+		}
+		lot.DaysLeft = int(math.Floor(lot.ExpiresAt.Sub(now).Hours() / 24))
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
 // GetAlerts retrieves unread alerts
 func (s *DashboardService) GetAlerts(ctx context.Context, orgID uuid.UUID, limit int) ([]*domain.Alert, error) {
 	return s.alertRepo.ListUnread(ctx, orgID, limit)
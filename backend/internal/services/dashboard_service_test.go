@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"hasufel.kj/internal/database"
 	"hasufel.kj/internal/domain"
 	_ "modernc.org/sqlite"
 )
@@ -44,7 +45,7 @@ func (m *mockItemRepo) CountWithFilters(ctx context.Context, orgID uuid.UUID, se
 	return 0, nil
 }
 
-func (m *mockItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock int) error {
+func (m *mockItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
 	return nil
 }
 
@@ -56,6 +57,10 @@ func (m *mockItemRepo) ReassignCategory(ctx context.Context, fromCategoryID, toC
 	return nil
 }
 
+func (m *mockItemRepo) UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
 type mockMovementRepo struct {
 	movements []*domain.StockMovement
 }
@@ -68,6 +73,10 @@ func (m *mockMovementRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.S
 	return nil, nil
 }
 
+func (m *mockMovementRepo) Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error) {
+	return true, nil
+}
+
 func (m *mockMovementRepo) ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
 	return []*domain.StockMovement{}, nil
 }
@@ -104,7 +113,7 @@ func (m *mockAlertRepo) MarkAsRead(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (m *mockAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID) error {
+func (m *mockAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID, types ...domain.AlertType) error {
 	return nil
 }
 
@@ -138,6 +147,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 			quantity INTEGER NOT NULL,
 			previous_stock INTEGER NOT NULL,
 			new_stock INTEGER NOT NULL,
+			location_id TEXT,
+			to_location_id TEXT,
 			reference TEXT,
 			notes TEXT,
 			created_by TEXT NOT NULL,
@@ -145,6 +156,33 @@ func setupTestDB(t *testing.T) *sql.DB {
 			FOREIGN KEY (item_id) REFERENCES items(id)
 		);
 
+		CREATE TABLE locations (
+			id TEXT PRIMARY KEY,
+			organization_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			is_default INTEGER NOT NULL DEFAULT 0,
+			is_active INTEGER NOT NULL DEFAULT 1
+		);
+
+		CREATE TABLE stock_levels (
+			item_id TEXT NOT NULL,
+			location_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL DEFAULT 0,
+			minimum_threshold INTEGER,
+			PRIMARY KEY (item_id, location_id)
+		);
+
+		CREATE TABLE stock_lots (
+			id TEXT PRIMARY KEY,
+			item_id TEXT NOT NULL,
+			location_id TEXT NOT NULL,
+			lot_number TEXT,
+			received_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP,
+			initial_quantity INTEGER NOT NULL,
+			quantity INTEGER NOT NULL
+		);
+
 		CREATE TABLE categories (
 			id TEXT PRIMARY KEY,
 			organization_id TEXT NOT NULL,
@@ -153,6 +191,23 @@ func setupTestDB(t *testing.T) *sql.DB {
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
+
+		CREATE TABLE units (
+			id TEXT PRIMARY KEY,
+			organization_id TEXT NOT NULL,
+			code TEXT NOT NULL,
+			factor INTEGER NOT NULL
+		);
+
+		CREATE TABLE cost_layers (
+			id TEXT PRIMARY KEY,
+			item_id TEXT NOT NULL,
+			movement_id TEXT,
+			received_at TIMESTAMP NOT NULL,
+			unit_cost REAL NOT NULL,
+			initial_quantity INTEGER NOT NULL,
+			quantity INTEGER NOT NULL
+		);
 	`
 
 	_, err = db.Exec(schema)
@@ -165,7 +220,7 @@ func TestDashboardService_GetMetrics(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	// Insert test data
@@ -209,7 +264,7 @@ func TestDashboardService_GetMetrics(t *testing.T) {
 
 	// Get metrics
 	ctx := context.Background()
-	metrics, err := service.GetMetrics(ctx, orgID)
+	metrics, err := service.GetMetrics(ctx, orgID, nil)
 
 	// Assertions
 	require.NoError(t, err)
@@ -225,11 +280,11 @@ func TestDashboardService_GetMetrics_NoItems(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	ctx := context.Background()
-	metrics, err := service.GetMetrics(ctx, orgID)
+	metrics, err := service.GetMetrics(ctx, orgID, nil)
 
 	require.NoError(t, err)
 	assert.NotNil(t, metrics)
@@ -270,7 +325,7 @@ func TestDashboardService_GetRecentMovements(t *testing.T) {
 	}
 
 	movementRepo := &mockMovementRepo{movements: movements}
-	service := NewDashboardService(&mockItemRepo{}, movementRepo, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, movementRepo, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	ctx := context.Background()
@@ -288,7 +343,7 @@ func TestDashboardService_GetStockTrends(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	// Insert test data
@@ -329,7 +384,7 @@ func TestDashboardService_GetCategoryBreakdown(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	// Insert categories
@@ -382,7 +437,7 @@ func TestDashboardService_GetLowStockItems(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	catID := uuid.New()
@@ -413,7 +468,7 @@ func TestDashboardService_GetLowStockItems(t *testing.T) {
 	require.NoError(t, err)
 
 	ctx := context.Background()
-	items, err := service.GetLowStockItems(ctx, orgID, 10)
+	items, err := service.GetLowStockItems(ctx, orgID, nil, 10)
 
 	require.NoError(t, err)
 	assert.Len(t, items, 2)
@@ -423,6 +478,184 @@ func TestDashboardService_GetLowStockItems(t *testing.T) {
 	assert.Equal(t, 50, items[0].MinimumThreshold)
 }
 
+func TestDashboardService_PerLocation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
+	orgID := uuid.New()
+	catID := uuid.New()
+	storeID, coolerID := uuid.New(), uuid.New()
+
+	_, err := db.Exec(`INSERT INTO categories (id, organization_id, name) VALUES (?, ?, 'Dairy')`, catID.String(), orgID.String())
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO locations (id, organization_id, name, is_default) VALUES (?, ?, 'Main Store', 1), (?, ?, 'Cooler', 0)
+	`, storeID.String(), orgID.String(), coolerID.String(), orgID.String())
+	require.NoError(t, err)
+
+	// Paneer: 50 in total, healthy overall but only 5 in the cooler where the par is 10
+	paneerID := uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, minimum_threshold, current_stock, unit_cost)
+		VALUES (?, ?, ?, 'Paneer', 'pcs', 20, 50, 2.0)
+	`, paneerID.String(), orgID.String(), catID.String())
+	require.NoError(t, err)
+	// Butter: everything is in the store, none left in the cooler
+	butterID := uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, minimum_threshold, current_stock, unit_cost)
+		VALUES (?, ?, ?, 'Butter', 'pcs', 5, 30, 1.0)
+	`, butterID.String(), orgID.String(), catID.String())
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		INSERT INTO stock_levels (item_id, location_id, quantity, minimum_threshold) VALUES
+			(?, ?, 45, NULL), (?, ?, 5, 10), (?, ?, 30, NULL), (?, ?, 0, NULL)
+	`, paneerID.String(), storeID.String(), paneerID.String(), coolerID.String(),
+		butterID.String(), storeID.String(), butterID.String(), coolerID.String())
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		INSERT INTO stock_movements (id, item_id, movement_type, quantity, previous_stock, new_stock, location_id, to_location_id, created_by, created_at)
+		VALUES (?, ?, 'TRANSFER', 5, 50, 50, ?, ?, ?, datetime('now'))
+	`, uuid.New().String(), paneerID.String(), storeID.String(), coolerID.String(), uuid.New().String())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	total, err := service.GetMetrics(ctx, orgID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total.TotalItems)
+	assert.Equal(t, 0, total.LowStockCount)
+	assert.Equal(t, float64(130), total.TotalValue) // (50*2) + (30*1)
+
+	cooler, err := service.GetMetrics(ctx, orgID, &coolerID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cooler.TotalItems)
+	assert.Equal(t, 1, cooler.LowStockCount)
+	assert.Equal(t, 1, cooler.OutOfStockCount)
+	assert.Equal(t, float64(10), cooler.TotalValue)
+	assert.Equal(t, 1, cooler.RecentMovements)
+
+	low, err := service.GetLowStockItems(ctx, orgID, &coolerID, 10)
+	require.NoError(t, err)
+	require.Len(t, low, 1)
+	assert.Equal(t, "Paneer", low[0].Name)
+	assert.Equal(t, 5, low[0].CurrentStock)
+	assert.Equal(t, 10, low[0].MinimumThreshold)
+
+	breakdown, err := service.GetLocationBreakdown(ctx, orgID)
+	require.NoError(t, err)
+	require.Len(t, breakdown, 2)
+	assert.Equal(t, storeID, breakdown[0].LocationID)
+	assert.Equal(t, float64(120), breakdown[0].TotalValue) // (45*2) + (30*1)
+	assert.Equal(t, 0, breakdown[0].LowStockCount)
+	assert.Equal(t, 1, breakdown[1].LowStockCount)
+}
+
+func TestDashboardService_GetMetrics_ValuesCostLayers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewDashboardService(nil, nil, nil, db, database.DialectSQLite)
+	orgID, catID := uuid.New(), uuid.New()
+
+	_, err := db.Exec(`INSERT INTO categories (id, organization_id, name) VALUES (?, ?, 'Dry Goods')`, catID.String(), orgID.String())
+	require.NoError(t, err)
+
+	// 3 kg of rice now priced at 80/kg: 1 kg bought at 50, 1 kg at 60 and
+	// 1 kg from before costing started
+	riceID := uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, minimum_threshold, current_stock, unit_cost)
+		VALUES (?, ?, ?, 'Rice', 'kg', 0, 3000, 80.0)
+	`, riceID.String(), orgID.String(), catID.String())
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO cost_layers (id, item_id, received_at, unit_cost, initial_quantity, quantity) VALUES
+			(?, ?, datetime('now', '-2 days'), 0.05, 2000, 1000),
+			(?, ?, datetime('now', '-1 day'), 0.06, 1000, 1000)
+	`, uuid.New().String(), riceID.String(), uuid.New().String(), riceID.String())
+	require.NoError(t, err)
+
+	// Sacks are an organization unit of 25 kg
+	flourID := uuid.New()
+	_, err = db.Exec(`INSERT INTO units (id, organization_id, code, factor) VALUES (?, ?, 'sack', 25000)`, uuid.New().String(), orgID.String())
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, minimum_threshold, current_stock, unit_cost)
+		VALUES (?, ?, ?, 'Flour', 'sack', 0, 50000, 500.0)
+	`, flourID.String(), orgID.String(), catID.String())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	metrics, err := service.GetMetrics(ctx, orgID, nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 1190, metrics.TotalValue, 0.001) // 50 + 60 + 80 + 2*500
+
+	breakdown, err := service.GetCategoryBreakdown(ctx, orgID)
+	require.NoError(t, err)
+	require.Len(t, breakdown, 1)
+	assert.InDelta(t, 1190, breakdown[0].TotalValue, 0.001)
+}
+
+func TestDashboardService_GetExpiringLots(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	catID := uuid.New()
+	storeID, coolerID := uuid.New(), uuid.New()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, organization_id, name, is_default) VALUES (?, ?, 'Main Store', 1), (?, ?, 'Cooler', 0)
+	`, storeID.String(), orgID.String(), coolerID.String(), orgID.String())
+	require.NoError(t, err)
+
+	paneerID, otherID := uuid.New(), uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO items (id, organization_id, category_id, name, unit_of_measurement, minimum_threshold, current_stock)
+		VALUES (?, ?, ?, 'Paneer', 'kg', 0, 5000), (?, ?, ?, 'Paneer', 'kg', 0, 1000)
+	`, paneerID.String(), orgID.String(), catID.String(), otherID.String(), otherOrgID.String(), catID.String())
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	insertLot := func(itemID, locationID uuid.UUID, lotNumber, expiresAt interface{}, quantity int) {
+		_, err := db.Exec(`
+			INSERT INTO stock_lots (id, item_id, location_id, lot_number, received_at, expires_at, initial_quantity, quantity)
+			VALUES (?, ?, ?, ?, ?, ?, 1000, ?)
+		`, uuid.New().String(), itemID.String(), locationID.String(), lotNumber, now.Add(-72*time.Hour), expiresAt, quantity)
+		require.NoError(t, err)
+	}
+	insertLot(paneerID, coolerID, "B-0412", now.Add(36*time.Hour), 1000) // expires in a day and a half
+	insertLot(paneerID, storeID, nil, now.Add(-30*time.Hour), 400)       // expired yesterday
+	insertLot(paneerID, storeID, nil, now.Add(-10*time.Hour), 0)         // expired but used up
+	insertLot(paneerID, storeID, nil, now.Add(20*24*time.Hour), 1000)    // well within date
+	insertLot(paneerID, storeID, nil, nil, 1000)                         // does not expire
+	insertLot(otherID, storeID, nil, now.Add(time.Hour), 1000)           // another organization
+
+	ctx := context.Background()
+
+	lots, err := service.GetExpiringLots(ctx, orgID, 7, nil)
+	require.NoError(t, err)
+	require.Len(t, lots, 2)
+	assert.Equal(t, "Main Store", lots[0].LocationName)
+	assert.Equal(t, 400, lots[0].Quantity)
+	assert.Equal(t, -2, lots[0].DaysLeft)
+	assert.Nil(t, lots[0].LotNumber)
+	assert.Equal(t, "Cooler", lots[1].LocationName)
+	assert.Equal(t, 1, lots[1].DaysLeft)
+	require.NotNil(t, lots[1].LotNumber)
+	assert.Equal(t, "B-0412", *lots[1].LotNumber)
+
+	cooler, err := service.GetExpiringLots(ctx, orgID, 7, &coolerID)
+	require.NoError(t, err)
+	require.Len(t, cooler, 1)
+	assert.Equal(t, coolerID, cooler[0].LocationID)
+}
+
 func TestDashboardService_GetAlerts(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -443,7 +676,7 @@ func TestDashboardService_GetAlerts(t *testing.T) {
 	}
 
 	alertRepo := &mockAlertRepo{alerts: alerts}
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, alertRepo, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, alertRepo, db, database.DialectSQLite)
 	orgID := uuid.New()
 
 	ctx := context.Background()
@@ -459,7 +692,7 @@ func TestDashboardService_MarkAlertAsRead(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db)
+	service := NewDashboardService(&mockItemRepo{}, &mockMovementRepo{}, &mockAlertRepo{}, db, database.DialectSQLite)
 	alertID := uuid.New()
 
 	ctx := context.Background()
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+// DefaultIdempotencyRetention is how long a stored response can be replayed
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+var (
+	// ErrIdempotencyKeyReused means the key was already used with a different request body
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyKeyInUse means another request with the same key committed first
+	ErrIdempotencyKeyInUse = errors.New("idempotency key is already in use")
+)
+
+type IdempotencyService struct {
+	repo      repository.IdempotencyRepository
+	db        *sql.DB
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, db *sql.DB, retention time.Duration) *IdempotencyService {
+	if retention <= 0 {
+		retention = DefaultIdempotencyRetention
+	}
+	return &IdempotencyService{
+		repo:      repo,
+		db:        db,
+		retention: retention,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Do runs fn at most once per organization, user and key within the
+// retention window. fn returns the status and body to store; it runs in the
+// same transaction as the stored record, so either both commit or neither
+// does. When a stored response exists it is returned with replayed set and
+// fn is not called. Errors from fn are returned as is and nothing is stored,
+// so a failed request can be retried with the same key.
+func (s *IdempotencyService) Do(
+	ctx context.Context,
+	orgID, userID uuid.UUID,
+	key, requestHash string,
+	fn func(ctx context.Context) (int, []byte, error),
+) (record *domain.IdempotencyRecord, replayed bool, err error) {
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.repo.Get(ctx, orgID, userID, key)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.CreatedAt.After(s.now().Add(-s.retention)) {
+				if existing.RequestHash != requestHash {
+					return ErrIdempotencyKeyReused
+				}
+				record, replayed = existing, true
+				return nil
+			}
+			// Expired; the key is free to be used again
+			if err := s.repo.Delete(ctx, orgID, userID, key); err != nil {
+				return err
+			}
+		}
+
+		status, body, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+
+		record = &domain.IdempotencyRecord{
+			OrganizationID: orgID,
+			UserID:         userID,
+			Key:            key,
+			RequestHash:    requestHash,
+			ResponseStatus: status,
+			ResponseBody:   body,
+			CreatedAt:      s.now(),
+		}
+		if err := s.repo.Create(ctx, record); err != nil {
+			if errors.Is(err, repository.ErrIdempotencyKeyExists) {
+				return ErrIdempotencyKeyInUse
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, replayed, nil
+}
+
+// PurgeExpired deletes stored responses older than the retention window
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteCreatedBefore(ctx, s.now().Add(-s.retention))
+}
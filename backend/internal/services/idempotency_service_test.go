@@ -0,0 +1,285 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/internal/services"
+)
+
+// mockIdempotencyRepo keeps records in memory keyed by org, user and key
+type mockIdempotencyRepo struct {
+	records   map[string]*domain.IdempotencyRecord
+	createErr error
+}
+
+func newMockIdempotencyRepo() *mockIdempotencyRepo {
+	return &mockIdempotencyRepo{records: make(map[string]*domain.IdempotencyRecord)}
+}
+
+func idempotencyMapKey(orgID, userID uuid.UUID, key string) string {
+	return orgID.String() + "/" + userID.String() + "/" + key
+}
+
+func (m *mockIdempotencyRepo) Get(ctx context.Context, orgID, userID uuid.UUID, key string) (*domain.IdempotencyRecord, error) {
+	return m.records[idempotencyMapKey(orgID, userID, key)], nil
+}
+
+func (m *mockIdempotencyRepo) Create(ctx context.Context, record *domain.IdempotencyRecord) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	k := idempotencyMapKey(record.OrganizationID, record.UserID, record.Key)
+	if _, ok := m.records[k]; ok {
+		return repository.ErrIdempotencyKeyExists
+	}
+	m.records[k] = record
+	return nil
+}
+
+func (m *mockIdempotencyRepo) Delete(ctx context.Context, orgID, userID uuid.UUID, key string) error {
+	delete(m.records, idempotencyMapKey(orgID, userID, key))
+	return nil
+}
+
+func (m *mockIdempotencyRepo) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	for k, record := range m.records {
+		if record.CreatedAt.Before(before) {
+			delete(m.records, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestIdempotencyService_ReplaysStoredResponse(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := services.NewIdempotencyService(newMockIdempotencyRepo(), db, time.Hour)
+
+	calls := 0
+	fn := func(ctx context.Context) (int, []byte, error) {
+		calls++
+		return http.StatusCreated, []byte(`{"id":"first"}`), nil
+	}
+
+	record, replayed, err := service.Do(ctx, orgID, userID, "delivery-42", "hash", fn)
+	if err != nil {
+		t.Fatalf("first Do failed: %v", err)
+	}
+	if replayed {
+		t.Fatalf("expected first call not to be a replay")
+	}
+
+	again, replayed, err := service.Do(ctx, orgID, userID, "delivery-42", "hash", fn)
+	if err != nil {
+		t.Fatalf("second Do failed: %v", err)
+	}
+	if !replayed {
+		t.Fatalf("expected second call to be a replay")
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to run once, ran %d times", calls)
+	}
+	if again.ResponseStatus != record.ResponseStatus || string(again.ResponseBody) != string(record.ResponseBody) {
+		t.Fatalf("expected replay to return the stored response, got %d %s", again.ResponseStatus, again.ResponseBody)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIdempotencyService_KeysAreScopedPerUser(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := services.NewIdempotencyService(newMockIdempotencyRepo(), db, time.Hour)
+
+	calls := 0
+	fn := func(ctx context.Context) (int, []byte, error) {
+		calls++
+		return http.StatusCreated, []byte(`{}`), nil
+	}
+
+	for _, userID := range []uuid.UUID{uuid.New(), uuid.New()} {
+		if _, replayed, err := service.Do(ctx, orgID, userID, "same-key", "hash", fn); err != nil || replayed {
+			t.Fatalf("expected a fresh request, got replayed=%v err=%v", replayed, err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected fn to run for each user, ran %d times", calls)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIdempotencyService_RejectsKeyReusedForDifferentRequest(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	repo := newMockIdempotencyRepo()
+	repo.records[idempotencyMapKey(orgID, userID, "k")] = &domain.IdempotencyRecord{
+		OrganizationID: orgID, UserID: userID, Key: "k", RequestHash: "original",
+		ResponseStatus: http.StatusCreated, ResponseBody: []byte(`{}`), CreatedAt: time.Now().UTC(),
+	}
+	service := services.NewIdempotencyService(repo, db, time.Hour)
+
+	_, _, err = service.Do(ctx, orgID, userID, "k", "different", func(ctx context.Context) (int, []byte, error) {
+		t.Fatalf("fn must not run for a reused key")
+		return 0, nil, nil
+	})
+	if err != services.ErrIdempotencyKeyReused {
+		t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIdempotencyService_FailedRequestIsNotStored(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	repo := newMockIdempotencyRepo()
+	service := services.NewIdempotencyService(repo, db, time.Hour)
+
+	_, _, err = service.Do(ctx, orgID, userID, "k", "hash", func(ctx context.Context) (int, []byte, error) {
+		return 0, nil, services.ErrInsufficientStock
+	})
+	if err != services.ErrInsufficientStock {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+	if len(repo.records) != 0 {
+		t.Fatalf("expected nothing to be stored, got %d record(s)", len(repo.records))
+	}
+
+	_, replayed, err := service.Do(ctx, orgID, userID, "k", "hash", func(ctx context.Context) (int, []byte, error) {
+		return http.StatusCreated, []byte(`{}`), nil
+	})
+	if err != nil || replayed {
+		t.Fatalf("expected retry to run, got replayed=%v err=%v", replayed, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIdempotencyService_ExpiredKeyRunsAgain(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	repo := newMockIdempotencyRepo()
+	repo.records[idempotencyMapKey(orgID, userID, "k")] = &domain.IdempotencyRecord{
+		OrganizationID: orgID, UserID: userID, Key: "k", RequestHash: "hash",
+		ResponseStatus: http.StatusCreated, ResponseBody: []byte(`{"id":"old"}`),
+		CreatedAt: time.Now().UTC().Add(-2 * time.Hour),
+	}
+	service := services.NewIdempotencyService(repo, db, time.Hour)
+
+	record, replayed, err := service.Do(ctx, orgID, userID, "k", "hash", func(ctx context.Context) (int, []byte, error) {
+		return http.StatusCreated, []byte(`{"id":"new"}`), nil
+	})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if replayed || string(record.ResponseBody) != `{"id":"new"}` {
+		t.Fatalf("expected the expired response to be replaced, got replayed=%v body=%s", replayed, record.ResponseBody)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIdempotencyService_ConcurrentDuplicateRollsBack(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	repo := newMockIdempotencyRepo()
+	repo.createErr = repository.ErrIdempotencyKeyExists
+	service := services.NewIdempotencyService(repo, db, time.Hour)
+
+	_, _, err = service.Do(ctx, uuid.New(), uuid.New(), "k", "hash", func(ctx context.Context) (int, []byte, error) {
+		return http.StatusCreated, []byte(`{}`), nil
+	})
+	if !errors.Is(err, services.ErrIdempotencyKeyInUse) {
+		t.Fatalf("expected ErrIdempotencyKeyInUse, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
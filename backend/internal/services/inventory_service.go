@@ -5,26 +5,162 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"hasufel.kj/internal/domain"
 	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
 )
 
 var (
-	ErrItemNotFound      = errors.New("item not found")
-	ErrCategoryNotFound  = errors.New("category not found")
-	ErrCategoryHasItems  = errors.New("category has items")
-	ErrInsufficientStock = errors.New("insufficient stock")
-	ErrInvalidQuantity   = errors.New("invalid quantity")
+	ErrItemNotFound        = errors.New("item not found")
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrCategoryHasItems    = errors.New("category has items")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidQuantity     = errors.New("invalid quantity")
+	ErrInvalidMovementType = errors.New("invalid movement type")
+	ErrNoAdjustments       = errors.New("no adjustments provided")
+	ErrLocationNotFound    = errors.New("location not found")
+	ErrLocationInactive    = errors.New("location is inactive")
+	ErrLocationHasStock    = errors.New("location has stock")
+	// ErrLocationInUse means movements reference the location; deactivate it instead
+	ErrLocationInUse = errors.New("location has movement history")
+	// ErrDefaultLocation means the default location cannot be deactivated or deleted
+	ErrDefaultLocation = errors.New("default location cannot be removed")
+	// ErrInvalidTransfer means a TRANSFER lacks a distinct destination, or a
+	// destination was given for another movement type
+	ErrInvalidTransfer = errors.New("transfer needs a destination location different from the source")
+	// ErrLotNotAllowed means lot details were given for a movement that does not receive stock
+	ErrLotNotAllowed = errors.New("lot details only apply to IN movements")
+	// ErrInvalidLotNumber means the supplier lot number is too long
+	ErrInvalidLotNumber = errors.New("lot number must be at most 100 characters")
+	// ErrInvalidExpiry means a lot would expire before it was received
+	ErrInvalidExpiry = errors.New("expiry date is before the received date")
+	// ErrItemInRecipe means a recipe lists the item as an ingredient
+	ErrItemInRecipe = errors.New("item is used in a recipe")
+	// ErrItemVersionMismatch means the caller's expected version (If-Match) is stale
+	ErrItemVersionMismatch = errors.New("item version does not match")
+	// ErrItemConflict means the item changed between read and write
+	ErrItemConflict = repository.ErrVersionConflict
+	ErrUnitNotFound = errors.New("unit not found")
+	// ErrInvalidUnitCode means a unit code is malformed or names a built-in
+	// unit or base unit
+	ErrInvalidUnitCode = errors.New("unit code must be 1 to 20 characters without spaces and cannot be a built-in unit or base unit")
+	// ErrUnitCodeTaken means the organization already has a unit of the code
+	ErrUnitCodeTaken   = errors.New("a unit with this code already exists")
+	ErrInvalidUnitName = errors.New("unit name must be 1 to 100 characters")
+	// ErrInvalidBaseUnit means a unit is based on something no unit measures
+	ErrInvalidBaseUnit = errors.New("base unit must be g, ml, pcs, the base unit of another unit, or the unit itself")
+	// ErrInvalidFactor means a unit is not a positive whole number of its
+	// base unit, or a unit that is its own base unit is not 1 of itself
+	ErrInvalidFactor    = errors.New("factor must be a positive whole number of base units, and 1 for a unit that is its own base unit")
+	ErrInvalidPrecision = errors.New("precision must be 0 to 6 decimal places")
+	// ErrUnitInUse means items, recipes or other units measure in the unit
+	ErrUnitInUse = errors.New("unit is in use")
+	// ErrIncompatibleUnitChange means an item's unit would change to one of
+	// another base unit, such as from kg to pcs, which its stock cannot be
+	// converted to
+	ErrIncompatibleUnitChange = errors.New("an item's unit can only change to a unit of the same base unit")
+
+	ErrMovementReasonNotFound = errors.New("movement reason not found")
+	ErrInvalidReasonCode      = errors.New("reason code must be 1 to 30 upper case letters, digits and underscores, starting with a letter")
+	ErrReasonCodeTaken        = errors.New("a reason with this code already exists")
+	ErrInvalidReasonName      = errors.New("reason name must be 1 to 100 characters")
+	// ErrReasonNotAllowed means a reason was given for a movement other than OUT
+	ErrReasonNotAllowed = errors.New("reason codes only apply to OUT movements")
+	// ErrInvalidReason means a movement names a reason the organization does
+	// not have or has deactivated
+	ErrInvalidReason = errors.New("reason is not an active reason of the organization")
+
+	ErrMovementNotFound = errors.New("movement not found")
+	// ErrMovementVoided means the movement was already reversed
+	ErrMovementVoided = errors.New("movement has already been reversed")
+	// ErrReversalOfReversal means the movement is itself a reversal; a wrong
+	// reversal is fixed by posting the original movement again
+	ErrReversalOfReversal = errors.New("a reversal cannot be reversed")
+	// ErrReversalOfLedgerRepair means the movement repairs the ledger; it
+	// records stock that had already moved, so there is nothing to undo
+	ErrReversalOfLedgerRepair = errors.New("a ledger repair cannot be reversed")
+	// ErrReversalOfUnitConversion means the movement records a change of the
+	// item's unit, which is undone by changing the unit back
+	ErrReversalOfUnitConversion = errors.New("a unit conversion cannot be reversed")
+	// ErrReversalForbidden means the caller's role may only reverse
+	// movements it recorded
+	ErrReversalForbidden = errors.New("movements recorded by other users cannot be reversed")
+	ErrReversalTooOld    = errors.New("movement is too old to be reversed")
+
+	// ErrUnitCostNotAllowed means a unit cost was given for a movement other
+	// than IN
+	ErrUnitCostNotAllowed   = errors.New("unit cost only applies to IN movements")
+	ErrInvalidUnitCost      = errors.New("unit cost must not be negative")
+	ErrInvalidCostingMethod = errors.New("costing method must be FIFO or WEIGHTED_AVERAGE")
 )
 
+// ReversalPolicy limits which movements a caller may reverse
+type ReversalPolicy struct {
+	// MaxAge is how long after it was recorded a movement can be reversed;
+	// zero means there is no limit
+	MaxAge time.Duration
+	// OwnOnly limits the caller to movements it recorded
+	OwnOnly bool
+}
+
+// RoleReversalPolicies gives the reversal policy of each role. Admins and
+// managers may reverse any movement and users only their own, each within
+// their window.
+func RoleReversalPolicies(admin, manager, user time.Duration) map[domain.UserRole]ReversalPolicy {
+	return map[domain.UserRole]ReversalPolicy{
+		domain.RoleAdmin:   {MaxAge: admin},
+		domain.RoleManager: {MaxAge: manager},
+		domain.RoleUser:    {MaxAge: user, OwnOnly: true},
+	}
+}
+
+func (p ReversalPolicy) check(movement *domain.StockMovement, userID uuid.UUID, now time.Time) error {
+	if p.OwnOnly && movement.CreatedBy != userID {
+		return ErrReversalForbidden
+	}
+	if p.MaxAge > 0 && now.Sub(movement.CreatedAt) > p.MaxAge {
+		return ErrReversalTooOld
+	}
+	return nil
+}
+
+// BulkAdjustLineError describes why a single line of a bulk adjustment was rejected
+type BulkAdjustLineError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// BulkAdjustError is returned when one or more lines of a bulk adjustment fail validation
+type BulkAdjustError struct {
+	Lines []BulkAdjustLineError
+}
+
+func (e *BulkAdjustError) Error() string {
+	return fmt.Sprintf("bulk adjustment rejected: %d invalid line(s)", len(e.Lines))
+}
+
+func (e *BulkAdjustError) add(field string, err error) {
+	e.Lines = append(e.Lines, BulkAdjustLineError{Field: field, Message: err.Error()})
+}
+
 type InventoryService struct {
-	itemRepo     repository.ItemRepository
-	categoryRepo repository.CategoryRepository
-	movementRepo repository.MovementRepository
-	alertRepo    repository.AlertRepository
-	db           *sql.DB
+	itemRepo       repository.ItemRepository
+	categoryRepo   repository.CategoryRepository
+	movementRepo   repository.MovementRepository
+	alertRepo      repository.AlertRepository
+	locationRepo   repository.LocationRepository
+	stockLevelRepo repository.StockLevelRepository
+	lotRepo        repository.StockLotRepository
+	unitRepo       repository.UnitRepository
+	reasonRepo     repository.MovementReasonRepository
+	costingRepo    repository.CostingRepository
+	db             *sql.DB
 }
 
 func NewInventoryService(
@@ -32,39 +168,79 @@ func NewInventoryService(
 	categoryRepo repository.CategoryRepository,
 	movementRepo repository.MovementRepository,
 	alertRepo repository.AlertRepository,
+	locationRepo repository.LocationRepository,
+	stockLevelRepo repository.StockLevelRepository,
+	lotRepo repository.StockLotRepository,
+	unitRepo repository.UnitRepository,
+	reasonRepo repository.MovementReasonRepository,
+	costingRepo repository.CostingRepository,
 	db *sql.DB,
 ) *InventoryService {
 	return &InventoryService{
-		itemRepo:     itemRepo,
-		categoryRepo: categoryRepo,
-		movementRepo: movementRepo,
-		alertRepo:    alertRepo,
-		db:           db,
+		itemRepo:       itemRepo,
+		categoryRepo:   categoryRepo,
+		movementRepo:   movementRepo,
+		alertRepo:      alertRepo,
+		locationRepo:   locationRepo,
+		stockLevelRepo: stockLevelRepo,
+		lotRepo:        lotRepo,
+		unitRepo:       unitRepo,
+		reasonRepo:     reasonRepo,
+		costingRepo:    costingRepo,
+		db:             db,
 	}
 }
 
 // CreateItem creates a new inventory item
-func (s *InventoryService) CreateItem(ctx context.Context, item *domain.Item) (uuid.UUID, error) {
-	// Verify category exists
-	category, err := s.categoryRepo.GetByID(ctx, item.CategoryID)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	if category == nil {
-		return uuid.Nil, ErrCategoryNotFound
-	}
+func (s *InventoryService) CreateItem(ctx context.Context, item *domain.Item, userID uuid.UUID) (uuid.UUID, error) {
+	var itemID uuid.UUID
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		// Verify category exists
+		category, err := s.categoryRepo.GetByID(ctx, item.CategoryID)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			return ErrCategoryNotFound
+		}
+
+		// The item starts empty and its initial stock comes in through an
+		// OPENING movement at the default location
+		opening := item.CurrentStock
+		item.CurrentStock = 0
+		item.IsActive = true
+		itemID, err = s.itemRepo.Create(ctx, item)
+		if err != nil {
+			return err
+		}
+
+		if opening <= 0 {
+			// Check if initial stock is below threshold and create alert
+			if item.TrackStock && item.CurrentStock < item.MinimumThreshold {
+				return s.createLowStockAlert(ctx, itemID, item.OrganizationID, item.Name, item.CurrentStock, item.MinimumThreshold)
+			}
+			return nil
+		}
 
-	item.IsActive = true
-	itemID, err := s.itemRepo.Create(ctx, item)
+		plan := s.newStockPlan(item.OrganizationID)
+		if err := plan.addItem(ctx, item); err != nil {
+			return err
+		}
+		movement, _, err := plan.add(ctx, &domain.CreateMovementRequest{
+			ItemID:       itemID,
+			MovementType: domain.MovementTypeOpening,
+			Quantity:     opening,
+		})
+		if err != nil {
+			return err
+		}
+		movement.CreatedBy = userID
+		return plan.apply(ctx)
+	})
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	// Check if initial stock is below threshold and create alert
-	if item.TrackStock && item.CurrentStock < item.MinimumThreshold {
-		s.createLowStockAlert(ctx, itemID, item.OrganizationID, item.Name, item.CurrentStock, item.MinimumThreshold)
-	}
-
 	return itemID, nil
 }
 
@@ -108,47 +284,133 @@ func (s *InventoryService) ListItemsWithFiltersPaginated(ctx context.Context, or
 	}, nil
 }
 
-// UpdateItem updates an existing item
-func (s *InventoryService) UpdateItem(ctx context.Context, item *domain.Item) error {
-	existing, err := s.itemRepo.GetByID(ctx, item.ID)
-	if err != nil {
-		return err
-	}
-	if existing == nil {
-		return ErrItemNotFound
-	}
-
-	// Validate category change if requested
-	if existing.CategoryID != item.CategoryID {
-		category, err := s.categoryRepo.GetByID(ctx, item.CategoryID)
+// UpdateItem updates an existing item. A change of unit is converted through
+// the item's units and recorded, as userID, by an ADJUSTMENT referenced
+// UNIT_CONVERSION; a unit cost left as it was is rescaled to the new unit. It
+// fails with ErrIncompatibleUnitChange when the new unit measures another
+// base unit.
+func (s *InventoryService) UpdateItem(ctx context.Context, item *domain.Item, userID uuid.UUID) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.itemRepo.GetByID(ctx, item.ID)
 		if err != nil {
 			return err
 		}
-		if category == nil {
-			return ErrCategoryNotFound
+		if existing == nil {
+			return ErrItemNotFound
 		}
-		if category.OrganizationID != existing.OrganizationID {
-			return fmt.Errorf("category does not belong to organization")
+		if existing.Version != item.Version {
+			return ErrItemConflict
 		}
-	}
 
-	trackStatusChanged := existing.TrackStock != item.TrackStock
+		// Validate category change if requested
+		if existing.CategoryID != item.CategoryID {
+			category, err := s.categoryRepo.GetByID(ctx, item.CategoryID)
+			if err != nil {
+				return err
+			}
+			if category == nil {
+				return ErrCategoryNotFound
+			}
+			if category.OrganizationID != existing.OrganizationID {
+				return fmt.Errorf("category does not belong to organization")
+			}
+		}
 
-	if err := s.itemRepo.Update(ctx, item); err != nil {
-		return err
+		var conversion *domain.StockMovement
+		if existing.UnitOfMeasurement != item.UnitOfMeasurement {
+			var unitCost *float64
+			conversion, unitCost, err = s.unitConversion(ctx, existing, item.UnitOfMeasurement)
+			if err != nil {
+				return err
+			}
+			conversion.CreatedBy = userID
+			if item.UnitCost != nil && existing.UnitCost != nil && *item.UnitCost == *existing.UnitCost {
+				item.UnitCost = unitCost
+			}
+		}
+
+		trackStatusChanged := existing.TrackStock != item.TrackStock
+
+		if err := s.itemRepo.Update(ctx, item); err != nil {
+			return err
+		}
+		if conversion != nil {
+			if _, err := s.movementRepo.Create(ctx, conversion); err != nil {
+				return fmt.Errorf("failed to create movement: %w", err)
+			}
+		}
+
+		if trackStatusChanged {
+			if !item.TrackStock {
+				// Remove alerts when tracking is disabled
+				return s.alertRepo.DeleteByItemID(ctx, item.ID)
+			} else if item.CurrentStock < item.MinimumThreshold {
+				// Re-evaluate alerts when tracking is re-enabled
+				return s.createLowStockAlert(ctx, item.ID, item.OrganizationID, item.Name, item.CurrentStock, item.MinimumThreshold)
+			}
+		}
+
+		return nil
+	})
+}
+
+// unitConversion converts the stock of item to unit, which must measure the
+// same base unit as the item's current unit, and returns the movement
+// recording the conversion along with the item's unit cost per unit. Stock is
+// held in that base unit, so it is the same after the conversion; the
+// movement notes what it reads as, and costs, in each unit.
+func (s *InventoryService) unitConversion(ctx context.Context, item *domain.Item, unit string) (*domain.StockMovement, *float64, error) {
+	registry, err := s.ItemUnits(ctx, item)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := registry.FromBaseUnit(item.CurrentStock, item.UnitOfMeasurement)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIncompatibleUnitChange, err)
+	}
+	to, err := registry.ConvertBetweenUnits(from, item.UnitOfMeasurement, unit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIncompatibleUnitChange, err)
 	}
 
-	if trackStatusChanged {
-		if !item.TrackStock {
-			// Remove alerts when tracking is disabled
-			_ = s.alertRepo.DeleteByItemID(ctx, item.ID)
-		} else if item.CurrentStock < item.MinimumThreshold {
-			// Re-evaluate alerts when tracking is re-enabled
-			s.createLowStockAlert(ctx, item.ID, item.OrganizationID, item.Name, item.CurrentStock, item.MinimumThreshold)
+	reference := domain.UnitConversionReference
+	notes := fmt.Sprintf("Unit changed from %s to %s: %s %s is %s %s",
+		item.UnitOfMeasurement, unit,
+		strconv.FormatFloat(from, 'f', -1, 64), item.UnitOfMeasurement,
+		strconv.FormatFloat(to, 'f', -1, 64), unit)
+
+	var unitCost *float64
+	if item.UnitCost != nil {
+		oldUnit, err := registry.GetUnit(item.UnitOfMeasurement)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrIncompatibleUnitChange, err)
+		}
+		newUnit, err := registry.GetUnit(unit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrIncompatibleUnitChange, err)
 		}
+		cost := *item.UnitCost * float64(newUnit.Factor) / float64(oldUnit.Factor)
+		unitCost = &cost
+		notes += fmt.Sprintf("; unit cost %s per %s is %s per %s",
+			strconv.FormatFloat(*item.UnitCost, 'f', -1, 64), item.UnitOfMeasurement,
+			strconv.FormatFloat(cost, 'f', -1, 64), unit)
 	}
 
-	return nil
+	return &domain.StockMovement{
+		ItemID:        item.ID,
+		MovementType:  domain.MovementTypeAdjustment,
+		Quantity:      item.CurrentStock,
+		PreviousStock: item.CurrentStock,
+		NewStock:      item.CurrentStock,
+		Reference:     &reference,
+		Notes:         &notes,
+	}, unitCost, nil
+}
+
+// isUnitConversion reports whether a movement records a change of the item's
+// unit
+func isUnitConversion(mv *domain.StockMovement) bool {
+	return mv.LocationID == nil && mv.Reference != nil && *mv.Reference == domain.UnitConversionReference
 }
 
 // DeleteItem soft deletes an item
@@ -161,211 +423,1748 @@ func (s *InventoryService) DeleteItem(ctx context.Context, id uuid.UUID) error {
 		return ErrItemNotFound
 	}
 
+	used, err := s.itemRepo.UsedInRecipes(ctx, id)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrItemInRecipe
+	}
+
 	return s.itemRepo.Delete(ctx, id)
 }
 
-// AdjustStock adjusts the stock for an item with transaction support
+// AdjustStock adjusts the stock for an item at the organization's default
+// location. The stock update, the movement record and any alert changes
+// commit or roll back together.
 func (s *InventoryService) AdjustStock(ctx context.Context, itemID uuid.UUID, movementType domain.MovementType, quantity int, userID uuid.UUID, reference, notes *string) (*domain.StockMovement, error) {
-	// For ADJUSTMENT type, quantity represents the exact new stock value (can be 0 or positive)
-	// For IN/OUT types, quantity must be positive
-	if movementType != domain.MovementTypeAdjustment && quantity <= 0 {
-		return nil, ErrInvalidQuantity
+	return s.adjustStock(ctx, &domain.CreateMovementRequest{
+		ItemID:       itemID,
+		MovementType: movementType,
+		Quantity:     quantity,
+		Reference:    reference,
+		Notes:        notes,
+	}, userID, nil)
+}
+
+// TransferStock moves quantity of an item from one location to another.
+// The item's total stock is unchanged.
+func (s *InventoryService) TransferStock(ctx context.Context, itemID, fromLocationID, toLocationID uuid.UUID, quantity int, userID uuid.UUID, reference, notes *string) (*domain.StockMovement, error) {
+	return s.adjustStock(ctx, &domain.CreateMovementRequest{
+		ItemID:       itemID,
+		MovementType: domain.MovementTypeTransfer,
+		Quantity:     quantity,
+		LocationID:   &fromLocationID,
+		ToLocationID: &toLocationID,
+		Reference:    reference,
+		Notes:        notes,
+	}, userID, nil)
+}
+
+// adjustStock applies a movement, optionally requiring the item to be at
+// expectedVersion. The stock write is a compare-and-swap on the version read
+// here, so a concurrent writer makes it fail with ErrItemConflict.
+func (s *InventoryService) adjustStock(ctx context.Context, req *domain.CreateMovementRequest, userID uuid.UUID, expectedVersion *int) (*domain.StockMovement, error) {
+	if err := validateMovementType(req.MovementType); err != nil {
+		return nil, err
 	}
-	if movementType == domain.MovementTypeAdjustment && quantity < 0 {
-		return nil, ErrInvalidQuantity
+	if err := validateMovementQuantity(req.MovementType, req.Quantity); err != nil {
+		return nil, err
 	}
 
-	// Start transaction
-	tx, err := s.db.BeginTx(ctx, nil)
+	var movement *domain.StockMovement
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		// Get current item
+		item, err := s.itemRepo.GetByID(ctx, req.ItemID)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrItemNotFound
+		}
+		if expectedVersion != nil && item.Version != *expectedVersion {
+			return ErrItemVersionMismatch
+		}
+
+		plan := s.newStockPlan(item.OrganizationID)
+		if err := plan.addItem(ctx, item); err != nil {
+			return err
+		}
+		movement, _, err = plan.add(ctx, req)
+		if err != nil {
+			return err
+		}
+		movement.Reference = req.Reference
+		movement.Notes = req.Notes
+		movement.CreatedBy = userID
+
+		return plan.apply(ctx)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
+	}
+
+	return movement, nil
+}
+
+// BulkAdjustStock applies several stock movements in a single transaction.
+// Every line is validated against the running stock of its item and location
+// before anything is written, and validation failures are reported together
+// as a *BulkAdjustError. Either all lines are applied or none are.
+func (s *InventoryService) BulkAdjustStock(ctx context.Context, orgID uuid.UUID, req *domain.BulkAdjustRequest, userID uuid.UUID) ([]*domain.StockMovement, error) {
+	if req == nil || len(req.Adjustments) == 0 {
+		return nil, ErrNoAdjustments
 	}
-	defer tx.Rollback()
 
-	// Get current item
-	item, err := s.itemRepo.GetByID(ctx, itemID)
+	var movements []*domain.StockMovement
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		plan := s.newStockPlan(orgID)
+		bulkErr := &BulkAdjustError{}
+
+		for i, line := range req.Adjustments {
+			field := fmt.Sprintf("adjustments[%d]", i)
+
+			if err := validateMovementType(line.MovementType); err != nil {
+				bulkErr.add(field+".movementType", err)
+				continue
+			}
+			if err := validateMovementQuantity(line.MovementType, line.Quantity); err != nil {
+				bulkErr.add(field+".quantity", err)
+				continue
+			}
+
+			if _, ok := plan.items[line.ItemID]; !ok {
+				item, err := s.itemRepo.GetByID(ctx, line.ItemID)
+				if err != nil {
+					return err
+				}
+				if item == nil || item.OrganizationID != orgID {
+					bulkErr.add(field+".itemId", ErrItemNotFound)
+					continue
+				}
+				if err := plan.addItem(ctx, item); err != nil {
+					return err
+				}
+			}
+
+			movement, lineField, err := plan.add(ctx, &domain.CreateMovementRequest{
+				ItemID:       line.ItemID,
+				MovementType: line.MovementType,
+				Quantity:     line.Quantity,
+				Unit:         line.Unit,
+				LocationID:   line.LocationID,
+				ToLocationID: line.ToLocationID,
+				LotNumber:    line.LotNumber,
+				ReceivedAt:   line.ReceivedAt,
+				ExpiresAt:    line.ExpiresAt,
+				ReasonCode:   line.ReasonCode,
+				UnitCost:     line.UnitCost,
+			})
+			if err != nil {
+				if lineField == "" {
+					return err
+				}
+				bulkErr.add(field+"."+lineField, err)
+				continue
+			}
+
+			movement.Reference = line.Reference
+			if movement.Reference == nil {
+				movement.Reference = req.Reference
+			}
+			movement.Notes = line.Notes
+			movement.CreatedBy = userID
+			if req.OccurredAt != nil {
+				movement.CreatedAt = req.OccurredAt.UTC()
+			}
+		}
+
+		if len(bulkErr.Lines) > 0 {
+			return bulkErr
+		}
+
+		movements = plan.movements
+		return plan.apply(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if item == nil {
-		return nil, ErrItemNotFound
+
+	return movements, nil
+}
+
+// stockKey identifies the stock of one item at one location
+type stockKey struct {
+	itemID     uuid.UUID
+	locationID uuid.UUID
+}
+
+// stockPlan validates a sequence of movements against the running stock of
+// each item and location, then writes them in order. Item stock stays the
+// total across locations; stock levels hold the per-location split, and lots
+// the part of each level that was received with a lot.
+type stockPlan struct {
+	s               *InventoryService
+	orgID           uuid.UUID
+	items           map[uuid.UUID]*domain.Item
+	openingStock    map[uuid.UUID]int
+	levels          map[stockKey]int
+	locations       map[uuid.UUID]*domain.Location
+	defaultLocation *domain.Location
+	movements       []*domain.StockMovement
+	// touched holds the levels changed by the planned movements
+	touched map[stockKey]bool
+	// receipts holds the lot each IN movement creates
+	receipts map[*domain.StockMovement]*domain.StockLot
+	// drops holds how much each movement takes from its source location
+	drops map[*domain.StockMovement]int
+	// preferred holds, for a reversal, the movement whose lots it drops
+	// from before any others
+	preferred map[*domain.StockMovement]uuid.UUID
+	// restores holds, for a reversal, the lots it puts stock back into
+	restores map[*domain.StockMovement][]*domain.MovementLot
+	// registries holds the units of each item movements were entered in
+	registries map[uuid.UUID]*units.Registry
+	// reasons holds the organization's movement reasons by code, loaded by
+	// the first movement that carries one
+	reasons map[string]*domain.MovementReason
+	// method is the organization's costing method, loaded with the first
+	// cost layers
+	method domain.CostingMethod
+	// layers holds the open cost layers of each item in the order they are
+	// consumed, loaded by the item's first costed movement
+	layers map[uuid.UUID][]*domain.CostLayer
+	// openings holds the layers created for stock the item had before
+	// costing started
+	openings []*domain.CostLayer
+	// costLayers holds the layer each movement that adds stock creates
+	costLayers map[*domain.StockMovement]*domain.CostLayer
+	// costed holds the existing layers the planned movements change
+	costed map[*domain.CostLayer]bool
+	// reversing is the movement the reversal being planned undoes
+	reversing *domain.StockMovement
+	// booked holds the ledger repairs that account for stock the item
+	// already has, which are recorded without changing it
+	booked map[*domain.StockMovement]bool
+}
+
+func (s *InventoryService) newStockPlan(orgID uuid.UUID) *stockPlan {
+	return &stockPlan{
+		s:            s,
+		orgID:        orgID,
+		items:        make(map[uuid.UUID]*domain.Item),
+		openingStock: make(map[uuid.UUID]int),
+		levels:       make(map[stockKey]int),
+		locations:    make(map[uuid.UUID]*domain.Location),
+		touched:      make(map[stockKey]bool),
+		receipts:     make(map[*domain.StockMovement]*domain.StockLot),
+		drops:        make(map[*domain.StockMovement]int),
+		preferred:    make(map[*domain.StockMovement]uuid.UUID),
+		restores:     make(map[*domain.StockMovement][]*domain.MovementLot),
+		registries:   make(map[uuid.UUID]*units.Registry),
+		layers:       make(map[uuid.UUID][]*domain.CostLayer),
+		costLayers:   make(map[*domain.StockMovement]*domain.CostLayer),
+		costed:       make(map[*domain.CostLayer]bool),
+		booked:       make(map[*domain.StockMovement]bool),
 	}
+}
 
-	previousStock := item.CurrentStock
-	var newStock int
+// addItem loads the per-location stock of an item. Stock not yet assigned to
+// any location, such as stock recorded before locations existed, counts
+// towards the default location.
+func (p *stockPlan) addItem(ctx context.Context, item *domain.Item) error {
+	levels, err := p.s.stockLevelRepo.ListByItem(ctx, item.ID)
+	if err != nil {
+		return err
+	}
 
-	// Calculate new stock based on movement type
-	switch movementType {
-	case domain.MovementTypeIn:
-		newStock = previousStock + quantity
-	case domain.MovementTypeOut:
-		if previousStock < quantity {
-			return nil, ErrInsufficientStock
+	assigned := 0
+	for _, level := range levels {
+		p.levels[stockKey{item.ID, level.LocationID}] = level.Quantity
+		assigned += level.Quantity
+	}
+	if unassigned := item.CurrentStock - assigned; unassigned > 0 {
+		defaultLocation, err := p.location(ctx, nil)
+		if err != nil {
+			return err
 		}
-		newStock = previousStock - quantity
-	case domain.MovementTypeAdjustment:
-		// For adjustments, quantity is the exact new stock value, not a delta
-		newStock = quantity
-	default:
-		return nil, fmt.Errorf("invalid movement type: %s", movementType)
+		p.levels[stockKey{item.ID, defaultLocation.ID}] += unassigned
 	}
 
-	// Update item stock
-	if err := s.itemRepo.UpdateStock(ctx, itemID, newStock); err != nil {
-		return nil, fmt.Errorf("failed to update stock: %w", err)
+	p.items[item.ID] = item
+	p.openingStock[item.ID] = item.CurrentStock
+	return nil
+}
+
+// location resolves a movement location; nil means the default location
+func (p *stockPlan) location(ctx context.Context, id *uuid.UUID) (*domain.Location, error) {
+	if id == nil {
+		if p.defaultLocation == nil {
+			location, err := p.s.ensureDefaultLocation(ctx, p.orgID)
+			if err != nil {
+				return nil, err
+			}
+			p.defaultLocation = location
+			p.locations[location.ID] = location
+		}
+		return p.defaultLocation, nil
 	}
 
-	// Create movement record
-	movement := &domain.StockMovement{
-		ItemID:        itemID,
-		MovementType:  movementType,
-		Quantity:      quantity,
-		PreviousStock: previousStock,
-		NewStock:      newStock,
-		Reference:     reference,
-		Notes:         notes,
-		CreatedBy:     userID,
+	if location, ok := p.locations[*id]; ok {
+		return location, nil
+	}
+	location, err := p.s.locationRepo.GetByID(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil || location.OrganizationID != p.orgID {
+		return nil, ErrLocationNotFound
+	}
+	p.locations[location.ID] = location
+	return location, nil
+}
+
+// add validates one movement of an item already added to the plan and
+// records it. On failure the returned field names the offending input; it is
+// empty for errors that are not the caller's fault.
+func (p *stockPlan) add(ctx context.Context, req *domain.CreateMovementRequest) (*domain.StockMovement, string, error) {
+	itemID, movementType, quantity := req.ItemID, req.MovementType, req.Quantity
+	item := p.items[itemID]
+	if req.Unit != nil {
+		var err error
+		quantity, err = p.baseQuantity(ctx, item, quantity, *req.Unit)
+		if err != nil {
+			if errors.Is(err, units.ErrInvalidUnit) || errors.Is(err, units.ErrIncompatibleUnits) {
+				return nil, "unit", err
+			}
+			return nil, "", err
+		}
 	}
 
-	movementID, err := s.movementRepo.Create(ctx, movement)
+	lot, field, err := receivedLot(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create movement: %w", err)
+		return nil, field, err
 	}
-	movement.ID = movementID
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if req.UnitCost != nil {
+		if movementType != domain.MovementTypeIn {
+			return nil, "unitCost", ErrUnitCostNotAllowed
+		}
+		if *req.UnitCost < 0 {
+			return nil, "unitCost", ErrInvalidUnitCost
+		}
 	}
 
-	// Check for low stock alert (outside transaction)
-	if item.TrackStock {
-		if newStock < item.MinimumThreshold {
-			s.createLowStockAlert(ctx, itemID, item.OrganizationID, item.Name, newStock, item.MinimumThreshold)
-		} else if previousStock < item.MinimumThreshold && newStock >= item.MinimumThreshold {
-			// Stock is now above threshold, delete any existing alerts
-			s.alertRepo.DeleteByItemID(ctx, itemID)
+	if req.ReasonCode != nil {
+		if movementType != domain.MovementTypeOut {
+			return nil, "reasonCode", ErrReasonNotAllowed
+		}
+		reason, err := p.reason(ctx, *req.ReasonCode)
+		if err != nil {
+			return nil, "", err
+		}
+		if reason == nil || !reason.IsActive {
+			return nil, "reasonCode", ErrInvalidReason
 		}
-	} else {
-		// Ensure no lingering alerts for untracked items
-		s.alertRepo.DeleteByItemID(ctx, itemID)
 	}
 
-	return movement, nil
-}
+	from, err := p.activeLocation(ctx, req.LocationID)
+	if err != nil {
+		return nil, locationField(err, "locationId"), err
+	}
 
-// BulkAdjustStock performs multiple stock adjustments in a single transaction
-func (s *InventoryService) BulkAdjustStock(ctx context.Context, adjustments []domain.BulkAdjustRequest, userID uuid.UUID) error {
-	if len(adjustments) == 0 {
-		return errors.New("no adjustments provided")
+	var to *domain.Location
+	if movementType == domain.MovementTypeTransfer {
+		if req.ToLocationID == nil || *req.ToLocationID == from.ID {
+			return nil, "toLocationId", ErrInvalidTransfer
+		}
+		to, err = p.activeLocation(ctx, req.ToLocationID)
+		if err != nil {
+			return nil, locationField(err, "toLocationId"), err
+		}
+	} else if req.ToLocationID != nil {
+		return nil, "toLocationId", ErrInvalidTransfer
 	}
 
-	// Start transaction
-	tx, err := s.db.BeginTx(ctx, nil)
+	fromKey := stockKey{itemID, from.ID}
+	previousLevel := p.levels[fromKey]
+	newLevel, err := calculateNewStock(movementType, previousLevel, quantity)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		if errors.Is(err, ErrInvalidMovementType) {
+			return nil, "movementType", err
+		}
+		return nil, "quantity", err
 	}
-	defer tx.Rollback()
+	p.levels[fromKey] = newLevel
+	p.touched[fromKey] = true
 
-	// Process each adjustment
-	for range adjustments {
-		// This would need to be refactored to work within the same transaction
-		// For now, we'll use the individual AdjustStock method
-		// In production, you'd want to implement a transaction-aware version
+	previousStock := item.CurrentStock
+	newStock := previousStock + newLevel - previousLevel
+	movement := &domain.StockMovement{
+		ItemID:        itemID,
+		MovementType:  movementType,
+		Quantity:      quantity,
+		PreviousStock: previousStock,
+		NewStock:      newStock,
+		LocationID:    &from.ID,
+		ReasonCode:    req.ReasonCode,
+	}
+	if to != nil {
+		toKey := stockKey{itemID, to.ID}
+		p.levels[toKey] += quantity
+		p.touched[toKey] = true
+		movement.ToLocationID = &to.ID
+		movement.NewStock = previousStock
+	}
+	item.CurrentStock = movement.NewStock
+	if err := p.cost(ctx, item, movement, req.UnitCost); err != nil {
+		return nil, "", err
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if lot != nil {
+		lot.ItemID = itemID
+		lot.LocationID = from.ID
+		lot.InitialQuantity = quantity
+		lot.Quantity = quantity
+		p.receipts[movement] = lot
+	}
+	if drop := previousLevel - newLevel; drop > 0 {
+		p.drops[movement] = drop
 	}
 
-	return nil
+	p.movements = append(p.movements, movement)
+	return movement, "", nil
 }
 
-// Category methods
-
-// CreateCategory creates a new category
-func (s *InventoryService) CreateCategory(ctx context.Context, category *domain.Category) (uuid.UUID, error) {
-	return s.categoryRepo.Create(ctx, category)
-}
+// reverse plans the movement that undoes original, an earlier movement of an
+// item already added to the plan. The reversal takes stock back from where
+// the original put it, so it fails with ErrInsufficientStock when that stock
+// has been used since. Stock the original took from lots goes back into the
+// same lots, and stock it put into lots is taken from those lots first.
+func (p *stockPlan) reverse(ctx context.Context, original *domain.StockMovement) (*domain.StockMovement, error) {
+	req := &domain.CreateMovementRequest{
+		ItemID:       original.ItemID,
+		MovementType: original.MovementType,
+		Quantity:     original.Quantity,
+		LocationID:   original.LocationID,
+	}
+	switch original.MovementType {
+	case domain.MovementTypeIn, domain.MovementTypeOpening:
+		req.MovementType = domain.MovementTypeOut
+	case domain.MovementTypeOut:
+		req.MovementType = domain.MovementTypeIn
+	case domain.MovementTypeTransfer:
+		req.LocationID, req.ToLocationID = original.ToLocationID, original.LocationID
+	case domain.MovementTypeAdjustment:
+		// An adjustment sets the level at its location; its reversal takes
+		// the change back off whatever the level is now
+		location, err := p.location(ctx, original.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		level := p.levels[stockKey{original.ItemID, location.ID}] - (original.NewStock - original.PreviousStock)
+		if level < 0 {
+			return nil, ErrInsufficientStock
+		}
+		req.Quantity = level
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMovementType, original.MovementType)
+	}
 
-// GetCategory retrieves a category by ID
-func (s *InventoryService) GetCategory(ctx context.Context, id uuid.UUID) (*domain.Category, error) {
-	category, err := s.categoryRepo.GetByID(ctx, id)
+	// Stock coming back is costed at what the original took out, and stock
+	// taken back comes from the layer the original added first
+	p.reversing = original
+	movement, _, err := p.add(ctx, req)
+	p.reversing = nil
 	if err != nil {
 		return nil, err
 	}
-	if category == nil {
-		return nil, ErrCategoryNotFound
-	}
-	return category, nil
-}
+	movement.ReversalOf = &original.ID
 
-// ListCategories retrieves all categories for an organization
-func (s *InventoryService) ListCategories(ctx context.Context, orgID uuid.UUID) ([]*domain.Category, error) {
-	return s.categoryRepo.List(ctx, orgID)
+	// Stock coming back is restored to the lots it was taken from rather
+	// than received as a new lot
+	delete(p.receipts, movement)
+	p.preferred[movement] = original.ID
+	if original.MovementType != domain.MovementTypeIn {
+		lots, err := p.s.lotRepo.ListMovementLots(ctx, original.ID)
+		if err != nil {
+			return nil, err
+		}
+		p.restores[movement] = lots
+	}
+	return movement, nil
 }
 
-// UpdateCategory updates an existing category
-func (s *InventoryService) UpdateCategory(ctx context.Context, category *domain.Category) error {
-	existing, err := s.categoryRepo.GetByID(ctx, category.ID)
+// closeLedger plans a ledger repair of an item already added to the plan:
+// an ADJUSTMENT, dated where the ledger needs it, that accounts for stock the
+// item already has. It is booked at the default location and changes
+// neither the item's stock nor its levels; reconcile brings those in line.
+func (p *stockPlan) closeLedger(ctx context.Context, repair *domain.StockMovement) error {
+	location, err := p.location(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if existing == nil {
-		return ErrCategoryNotFound
-	}
-
-	return s.categoryRepo.Update(ctx, category)
+	repair.LocationID = &location.ID
+	p.booked[repair] = true
+	p.movements = append(p.movements, repair)
+	return nil
 }
 
-// DeleteCategory deletes a category with optional reassignment
-func (s *InventoryService) DeleteCategory(ctx context.Context, id uuid.UUID, targetCategoryID *uuid.UUID) error {
-	category, err := s.categoryRepo.GetByID(ctx, id)
+// reconcile plans the ADJUSTMENTs that bring the stock levels and cost
+// layers of an item already added to the plan in line with its current
+// stock, which they leave as it is. Stock the levels lack is put at the
+// default location; stock they hold beyond it is taken off the default
+// location first, then the others, with an ADJUSTMENT at each location it
+// comes off. Stock the cost layers lack gets an opening layer at the item's
+// unit cost, and layers beyond it are consumed oldest first; the first
+// ADJUSTMENT carries the change in value.
+func (p *stockPlan) reconcile(ctx context.Context, itemID uuid.UUID) ([]*domain.StockMovement, error) {
+	item := p.items[itemID]
+	location, err := p.location(ctx, nil)
 	if err != nil {
-		return err
-	}
-	if category == nil {
-		return ErrCategoryNotFound
+		return nil, err
 	}
 
-	count, err := s.itemRepo.CountByCategory(ctx, id)
-	if err != nil {
-		return err
+	// The plan already counts stock the levels lack at the default location
+	defaultKey := stockKey{itemID, location.ID}
+	keys := []stockKey{defaultKey}
+	excess := p.levels[defaultKey] - item.CurrentStock
+	for key, quantity := range p.levels {
+		if key.itemID == itemID && key != defaultKey {
+			keys = append(keys, key)
+			excess += quantity
+		}
 	}
+	sort.Slice(keys[1:], func(i, j int) bool {
+		return keys[1+i].locationID.String() < keys[1+j].locationID.String()
+	})
 
-	if count > 0 {
-		if targetCategoryID == nil {
-			return ErrCategoryHasItems
+	adjustment := func(key stockKey) *domain.StockMovement {
+		p.touched[key] = true
+		return &domain.StockMovement{
+			ItemID:        itemID,
+			MovementType:  domain.MovementTypeAdjustment,
+			Quantity:      p.levels[key],
+			PreviousStock: item.CurrentStock,
+			NewStock:      item.CurrentStock,
+			LocationID:    &key.locationID,
 		}
-		if targetCategoryID != nil && *targetCategoryID == id {
-			return errors.New("cannot reassign items to the same category")
+	}
+	var movements []*domain.StockMovement
+	for _, key := range keys {
+		taken := min(p.levels[key], max(excess, 0))
+		if taken == 0 {
+			continue
 		}
+		p.levels[key] -= taken
+		excess -= taken
+		movement := adjustment(key)
+		p.drops[movement] = taken
+		movements = append(movements, movement)
+	}
+	if len(movements) == 0 {
+		movements = append(movements, adjustment(defaultKey))
+	}
 
-		targetCategory, err := s.categoryRepo.GetByID(ctx, *targetCategoryID)
-		if err != nil {
-			return err
-		}
-		if targetCategory == nil {
-			return ErrCategoryNotFound
+	layers, err := p.openLayers(ctx, item, item.CurrentStock)
+	if err != nil {
+		return nil, err
+	}
+	value := 0.0
+	for _, opening := range p.openings {
+		if opening.ItemID == itemID {
+			value += float64(opening.Quantity) * opening.UnitCost
 		}
-		if targetCategory.OrganizationID != category.OrganizationID {
-			return fmt.Errorf("target category must belong to the same organization")
+	}
+	covered := 0
+	for _, layer := range layers {
+		covered += layer.Quantity
+	}
+	if covered > item.CurrentStock {
+		if p.method == domain.CostingWeightedAverage {
+			p.average(itemID)
 		}
-
-		if err := s.itemRepo.ReassignCategory(ctx, id, *targetCategoryID); err != nil {
-			return err
+		consumed, err := p.consume(ctx, item, covered-item.CurrentStock)
+		if err != nil {
+			return nil, err
 		}
+		value -= consumed
 	}
+	movements[0].TotalCost = &value
 
-	return s.categoryRepo.Delete(ctx, id)
+	p.movements = append(p.movements, movements...)
+	return movements, nil
+}
+
+// baseQuantity converts quantity of unit, any unit of the item, to the
+// item's base units
+func (p *stockPlan) baseQuantity(ctx context.Context, item *domain.Item, quantity int, unit string) (int, error) {
+	registry, err := p.units(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+
+	from, err := registry.GetUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	measure, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil || from.BaseUnit != measure.BaseUnit {
+		return 0, fmt.Errorf("%w: %s and %s", units.ErrIncompatibleUnits, unit, item.UnitOfMeasurement)
+	}
+	return registry.ToBaseUnit(float64(quantity), unit)
+}
+
+// units returns the units quantities of the item can be entered in
+func (p *stockPlan) units(ctx context.Context, item *domain.Item) (*units.Registry, error) {
+	if registry, ok := p.registries[item.ID]; ok {
+		return registry, nil
+	}
+	registry, err := p.s.ItemUnits(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	p.registries[item.ID] = registry
+	return registry, nil
+}
+
+// cost values a planned movement at the item's cost layers and records its
+// TotalCost. Stock coming in adds a layer at unitCost, a cost per unit of the
+// item's unit of measurement that defaults to the item's unit cost; an
+// ADJUSTMENT up adds it at the current average cost instead. Stock going out
+// consumes layers oldest first. Under WEIGHTED_AVERAGE the layers are kept
+// merged into one at their average cost. A TRANSFER has no cost.
+func (p *stockPlan) cost(ctx context.Context, item *domain.Item, movement *domain.StockMovement, unitCost *float64) error {
+	if movement.MovementType == domain.MovementTypeTransfer {
+		return nil
+	}
+	layers, err := p.openLayers(ctx, item, movement.PreviousStock)
+	if err != nil {
+		return err
+	}
+
+	change := movement.NewStock - movement.PreviousStock
+	if change < 0 {
+		if p.method == domain.CostingWeightedAverage {
+			p.average(item.ID)
+		}
+		total, err := p.consume(ctx, item, -change)
+		if err != nil {
+			return err
+		}
+		movement.TotalCost = &total
+		return nil
+	}
+
+	perBase, err := p.incomingCost(ctx, item, movement, layers, unitCost)
+	if err != nil {
+		return err
+	}
+	total := float64(change) * perBase
+	movement.TotalCost = &total
+	if change == 0 {
+		return nil
+	}
+
+	layer := &domain.CostLayer{
+		ItemID:          item.ID,
+		ReceivedAt:      time.Now().UTC(),
+		UnitCost:        perBase,
+		InitialQuantity: change,
+		Quantity:        change,
+	}
+	p.costLayers[movement] = layer
+	p.layers[item.ID] = append(layers, layer)
+	if p.method == domain.CostingWeightedAverage {
+		p.average(item.ID)
+	}
+	return nil
+}
+
+// openLayers loads the open cost layers of an item whose stock before the
+// movement being planned is stock. Stock the layers do not cover, such as
+// stock recorded before costing started, gets an opening layer at the
+// item's unit cost.
+func (p *stockPlan) openLayers(ctx context.Context, item *domain.Item, stock int) ([]*domain.CostLayer, error) {
+	if layers, ok := p.layers[item.ID]; ok {
+		return layers, nil
+	}
+	if p.method == "" {
+		method, err := p.s.costingMethod(ctx, p.orgID)
+		if err != nil {
+			return nil, err
+		}
+		p.method = method
+	}
+
+	layers, err := p.s.costingRepo.ListOpenLayers(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	covered := 0
+	for _, layer := range layers {
+		covered += layer.Quantity
+	}
+	if uncovered := stock - covered; uncovered > 0 {
+		perBase, err := p.itemCost(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		receivedAt := item.CreatedAt
+		if receivedAt.IsZero() {
+			receivedAt = time.Now().UTC()
+		}
+		opening := &domain.CostLayer{
+			ItemID:          item.ID,
+			ReceivedAt:      receivedAt,
+			UnitCost:        perBase,
+			InitialQuantity: uncovered,
+			Quantity:        uncovered,
+		}
+		p.openings = append(p.openings, opening)
+		layers = append([]*domain.CostLayer{opening}, layers...)
+	}
+	p.layers[item.ID] = layers
+	return layers, nil
+}
+
+// incomingCost is the cost per base unit of stock a movement brings in
+func (p *stockPlan) incomingCost(ctx context.Context, item *domain.Item, movement *domain.StockMovement, layers []*domain.CostLayer, unitCost *float64) (float64, error) {
+	if original := p.reversing; original != nil && original.TotalCost != nil {
+		if moved := original.PreviousStock - original.NewStock; moved > 0 {
+			return *original.TotalCost / float64(moved), nil
+		}
+	}
+	if unitCost != nil {
+		factor, err := p.costFactor(ctx, item)
+		if err != nil {
+			return 0, err
+		}
+		return *unitCost / factor, nil
+	}
+	if movement.MovementType == domain.MovementTypeAdjustment {
+		quantity, value := 0, 0.0
+		for _, layer := range layers {
+			quantity += layer.Quantity
+			value += float64(layer.Quantity) * layer.UnitCost
+		}
+		if quantity > 0 {
+			return value / float64(quantity), nil
+		}
+	}
+	return p.itemCost(ctx, item)
+}
+
+// consume takes quantity off the item's open layers, oldest first, and
+// returns what it cost. A reversal takes from the layer its original added
+// first. Stock beyond the layers is costed at the item's unit cost.
+func (p *stockPlan) consume(ctx context.Context, item *domain.Item, quantity int) (float64, error) {
+	layers := p.layers[item.ID]
+	if original := p.reversing; original != nil {
+		sort.SliceStable(layers, func(i, j int) bool {
+			return layers[i].MovementID != nil && *layers[i].MovementID == original.ID &&
+				(layers[j].MovementID == nil || *layers[j].MovementID != original.ID)
+		})
+	}
+
+	total := 0.0
+	for len(layers) > 0 && quantity > 0 {
+		layer := layers[0]
+		taken := min(layer.Quantity, quantity)
+		layer.Quantity -= taken
+		quantity -= taken
+		total += float64(taken) * layer.UnitCost
+		p.costed[layer] = true
+		if layer.Quantity == 0 {
+			layers = layers[1:]
+		}
+	}
+	p.layers[item.ID] = layers
+
+	if quantity > 0 {
+		perBase, err := p.itemCost(ctx, item)
+		if err != nil {
+			return 0, err
+		}
+		total += float64(quantity) * perBase
+	}
+	return total, nil
+}
+
+// average merges the open layers of an item into the oldest at their
+// weighted average cost
+func (p *stockPlan) average(itemID uuid.UUID) {
+	layers := p.layers[itemID]
+	if len(layers) < 2 {
+		return
+	}
+
+	quantity, value := 0, 0.0
+	for _, layer := range layers {
+		quantity += layer.Quantity
+		value += float64(layer.Quantity) * layer.UnitCost
+	}
+	first := layers[0]
+	first.Quantity = quantity
+	if quantity > 0 {
+		first.UnitCost = value / float64(quantity)
+	}
+	p.costed[first] = true
+	for _, layer := range layers[1:] {
+		layer.Quantity = 0
+		p.costed[layer] = true
+	}
+	p.layers[itemID] = layers[:1]
+}
+
+// itemCost is the item's unit cost per base unit, zero without a cost
+func (p *stockPlan) itemCost(ctx context.Context, item *domain.Item) (float64, error) {
+	if item.UnitCost == nil {
+		return 0, nil
+	}
+	factor, err := p.costFactor(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+	return *item.UnitCost / factor, nil
+}
+
+// costFactor is how many base units the item's unit of measurement holds;
+// an item measured in an unknown unit is costed per base unit
+func (p *stockPlan) costFactor(ctx context.Context, item *domain.Item) (float64, error) {
+	registry, err := p.units(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+	unit, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil || unit.Factor <= 0 {
+		return 1, nil
+	}
+	return float64(unit.Factor), nil
+}
+
+// receivedLot validates the lot details of a movement and returns the lot an
+// IN movement creates; the received date defaults to now. Other movement
+// types must not carry lot details.
+func receivedLot(req *domain.CreateMovementRequest) (*domain.StockLot, string, error) {
+	if req.MovementType != domain.MovementTypeIn {
+		switch {
+		case req.LotNumber != nil:
+			return nil, "lotNumber", ErrLotNotAllowed
+		case req.ReceivedAt != nil:
+			return nil, "receivedAt", ErrLotNotAllowed
+		case req.ExpiresAt != nil:
+			return nil, "expiresAt", ErrLotNotAllowed
+		}
+		return nil, "", nil
+	}
+
+	lot := &domain.StockLot{ReceivedAt: time.Now().UTC()}
+	if req.LotNumber != nil {
+		if number := strings.TrimSpace(*req.LotNumber); number != "" {
+			if len(number) > 100 {
+				return nil, "lotNumber", ErrInvalidLotNumber
+			}
+			lot.LotNumber = &number
+		}
+	}
+	if req.ReceivedAt != nil {
+		lot.ReceivedAt = req.ReceivedAt.UTC()
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		if expiresAt.Before(lot.ReceivedAt) {
+			return nil, "expiresAt", ErrInvalidExpiry
+		}
+		lot.ExpiresAt = &expiresAt
+	}
+	return lot, "", nil
+}
+
+// reason looks up a movement reason of the organization by code; it is nil
+// for a code the organization does not have
+func (p *stockPlan) reason(ctx context.Context, code string) (*domain.MovementReason, error) {
+	if p.reasons == nil {
+		reasons, err := p.s.ensureMovementReasons(ctx, p.orgID)
+		if err != nil {
+			return nil, err
+		}
+		p.reasons = make(map[string]*domain.MovementReason, len(reasons))
+		for _, reason := range reasons {
+			p.reasons[reason.Code] = reason
+		}
+	}
+	return p.reasons[code], nil
+}
+
+// activeLocation resolves a location that can still receive movements
+func (p *stockPlan) activeLocation(ctx context.Context, id *uuid.UUID) (*domain.Location, error) {
+	location, err := p.location(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !location.IsActive {
+		return nil, ErrLocationInactive
+	}
+	return location, nil
+}
+
+// locationField reports validation errors against field and leaves
+// repository errors unattributed
+func locationField(err error, field string) string {
+	if errors.Is(err, ErrLocationNotFound) || errors.Is(err, ErrLocationInactive) {
+		return field
+	}
+	return ""
+}
+
+// apply writes the planned movements in order, then re-evaluates alerts once
+// per item against its final stock
+func (p *stockPlan) apply(ctx context.Context) error {
+	for _, layer := range p.openings {
+		if _, err := p.s.costingRepo.CreateLayer(ctx, layer); err != nil {
+			return fmt.Errorf("failed to create cost layer: %w", err)
+		}
+	}
+
+	for _, movement := range p.movements {
+		item := p.items[movement.ItemID]
+		if !p.booked[movement] {
+			if err := p.s.itemRepo.UpdateStock(ctx, movement.ItemID, movement.NewStock, item.Version); err != nil {
+				return fmt.Errorf("failed to update stock: %w", err)
+			}
+			item.Version++
+		}
+
+		movementID, err := p.s.movementRepo.Create(ctx, movement)
+		if err != nil {
+			return fmt.Errorf("failed to create movement: %w", err)
+		}
+		movement.ID = movementID
+		movement.Item = item
+
+		if err := p.applyLots(ctx, movement); err != nil {
+			return err
+		}
+		if layer, ok := p.costLayers[movement]; ok {
+			layer.MovementID = &movement.ID
+			if _, err := p.s.costingRepo.CreateLayer(ctx, layer); err != nil {
+				return fmt.Errorf("failed to create cost layer: %w", err)
+			}
+		}
+	}
+
+	for layer := range p.costed {
+		if err := p.s.costingRepo.UpdateLayer(ctx, layer); err != nil {
+			return fmt.Errorf("failed to update cost layer: %w", err)
+		}
+	}
+
+	for key := range p.touched {
+		if err := p.s.stockLevelRepo.SetQuantity(ctx, key.itemID, key.locationID, p.levels[key]); err != nil {
+			return fmt.Errorf("failed to update stock level: %w", err)
+		}
+	}
+
+	for itemID, item := range p.items {
+		if err := p.s.refreshLowStockAlert(ctx, item, p.openingStock[itemID], item.CurrentStock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLots records the lot effects of a written movement. An IN creates its
+// lot. Any drop at the source location is taken from the location's lots
+// first-expiry-first-out, and a TRANSFER recreates what it took as lots at
+// the destination with the same lot number and dates. Whatever the lots
+// cannot cover comes from stock outside any lot. A reversal instead puts
+// stock back into the lots the original movement took it from.
+func (p *stockPlan) applyLots(ctx context.Context, movement *domain.StockMovement) error {
+	if lot, ok := p.receipts[movement]; ok {
+		lot.MovementID = &movement.ID
+		if _, err := p.s.lotRepo.Create(ctx, lot); err != nil {
+			return fmt.Errorf("failed to create lot: %w", err)
+		}
+		if err := p.s.lotRepo.RecordMovement(ctx, movement.ID, lot.ID, lot.Quantity); err != nil {
+			return fmt.Errorf("failed to record lot movement: %w", err)
+		}
+		movement.Lots = append(movement.Lots, &domain.MovementLot{
+			LotID: lot.ID, Quantity: lot.Quantity, LotNumber: lot.LotNumber, ExpiresAt: lot.ExpiresAt,
+		})
+	}
+
+	restores, restoring := p.restores[movement]
+	for _, lot := range restores {
+		if err := p.s.lotRepo.AddQuantity(ctx, lot.LotID, lot.Quantity); err != nil {
+			return fmt.Errorf("failed to update lot: %w", err)
+		}
+		if err := p.s.lotRepo.RecordMovement(ctx, movement.ID, lot.LotID, lot.Quantity); err != nil {
+			return fmt.Errorf("failed to record lot movement: %w", err)
+		}
+		movement.Lots = append(movement.Lots, lot)
+	}
+
+	remaining := p.drops[movement]
+	if remaining == 0 {
+		return nil
+	}
+	lots, err := p.s.lotRepo.ListAvailable(ctx, movement.ItemID, *movement.LocationID)
+	if err != nil {
+		return err
+	}
+	if original, ok := p.preferred[movement]; ok {
+		sort.SliceStable(lots, func(i, j int) bool {
+			return lots[i].MovementID != nil && *lots[i].MovementID == original &&
+				(lots[j].MovementID == nil || *lots[j].MovementID != original)
+		})
+	}
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+		taken := min(lot.Quantity, remaining)
+		remaining -= taken
+
+		if err := p.s.lotRepo.UpdateQuantity(ctx, lot.ID, lot.Quantity-taken); err != nil {
+			return fmt.Errorf("failed to update lot: %w", err)
+		}
+		if err := p.s.lotRepo.RecordMovement(ctx, movement.ID, lot.ID, taken); err != nil {
+			return fmt.Errorf("failed to record lot movement: %w", err)
+		}
+		movement.Lots = append(movement.Lots, &domain.MovementLot{
+			LotID: lot.ID, Quantity: taken, LotNumber: lot.LotNumber, ExpiresAt: lot.ExpiresAt,
+		})
+
+		if movement.ToLocationID != nil && !restoring {
+			moved := &domain.StockLot{
+				ItemID:          movement.ItemID,
+				LocationID:      *movement.ToLocationID,
+				LotNumber:       lot.LotNumber,
+				ReceivedAt:      lot.ReceivedAt,
+				ExpiresAt:       lot.ExpiresAt,
+				InitialQuantity: taken,
+				Quantity:        taken,
+				MovementID:      &movement.ID,
+			}
+			if _, err := p.s.lotRepo.Create(ctx, moved); err != nil {
+				return fmt.Errorf("failed to create lot: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateMovementType rejects the movement types callers cannot post:
+// OPENING is only posted when an item is created
+func validateMovementType(movementType domain.MovementType) error {
+	if movementType == domain.MovementTypeOpening {
+		return fmt.Errorf("%w: %s", ErrInvalidMovementType, movementType)
+	}
+	return nil
+}
+
+// validateMovementQuantity checks the quantity rules for a movement type.
+// For ADJUSTMENT type, quantity represents the exact new stock value (can be 0 or positive).
+// For IN/OUT/TRANSFER/OPENING types, quantity must be positive.
+func validateMovementQuantity(movementType domain.MovementType, quantity int) error {
+	if movementType != domain.MovementTypeAdjustment && quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	if movementType == domain.MovementTypeAdjustment && quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	return nil
+}
+
+// calculateNewStock returns the stock level after applying a movement. For a
+// TRANSFER it is the level left at the source location.
+func calculateNewStock(movementType domain.MovementType, previousStock, quantity int) (int, error) {
+	switch movementType {
+	case domain.MovementTypeIn, domain.MovementTypeOpening:
+		return previousStock + quantity, nil
+	case domain.MovementTypeOut, domain.MovementTypeTransfer:
+		if previousStock < quantity {
+			return 0, ErrInsufficientStock
+		}
+		return previousStock - quantity, nil
+	case domain.MovementTypeAdjustment:
+		// For adjustments, quantity is the exact new stock value, not a delta
+		return quantity, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrInvalidMovementType, movementType)
+	}
+}
+
+// Category methods
+
+// CreateCategory creates a new category
+func (s *InventoryService) CreateCategory(ctx context.Context, category *domain.Category) (uuid.UUID, error) {
+	return s.categoryRepo.Create(ctx, category)
+}
+
+// GetCategory retrieves a category by ID
+func (s *InventoryService) GetCategory(ctx context.Context, id uuid.UUID) (*domain.Category, error) {
+	category, err := s.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// ListCategories retrieves all categories for an organization
+func (s *InventoryService) ListCategories(ctx context.Context, orgID uuid.UUID) ([]*domain.Category, error) {
+	return s.categoryRepo.List(ctx, orgID)
+}
+
+// UpdateCategory updates an existing category
+func (s *InventoryService) UpdateCategory(ctx context.Context, category *domain.Category) error {
+	existing, err := s.categoryRepo.GetByID(ctx, category.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrCategoryNotFound
+	}
+
+	return s.categoryRepo.Update(ctx, category)
+}
+
+// DeleteCategory deletes a category with optional reassignment.
+// Reassigning the items and deleting the category happen in one transaction.
+func (s *InventoryService) DeleteCategory(ctx context.Context, id uuid.UUID, targetCategoryID *uuid.UUID) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		category, err := s.categoryRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			return ErrCategoryNotFound
+		}
+
+		count, err := s.itemRepo.CountByCategory(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			if targetCategoryID == nil {
+				return ErrCategoryHasItems
+			}
+			if *targetCategoryID == id {
+				return errors.New("cannot reassign items to the same category")
+			}
+
+			targetCategory, err := s.categoryRepo.GetByID(ctx, *targetCategoryID)
+			if err != nil {
+				return err
+			}
+			if targetCategory == nil {
+				return ErrCategoryNotFound
+			}
+			if targetCategory.OrganizationID != category.OrganizationID {
+				return fmt.Errorf("target category must belong to the same organization")
+			}
+
+			if err := s.itemRepo.ReassignCategory(ctx, id, *targetCategoryID); err != nil {
+				return err
+			}
+		}
+
+		return s.categoryRepo.Delete(ctx, id)
+	})
+}
+
+// Location methods
+
+// DefaultLocationName names the location created for organizations that have none
+const DefaultLocationName = "Main Store"
+
+// ensureDefaultLocation returns the organization's default location,
+// creating it on first use
+func (s *InventoryService) ensureDefaultLocation(ctx context.Context, orgID uuid.UUID) (*domain.Location, error) {
+	location, err := s.locationRepo.GetDefault(ctx, orgID)
+	if err != nil || location != nil {
+		return location, err
+	}
+
+	location = &domain.Location{
+		OrganizationID: orgID,
+		Name:           DefaultLocationName,
+		IsDefault:      true,
+		IsActive:       true,
+	}
+	if _, err := s.locationRepo.Create(ctx, location); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// CreateLocation creates a location. A new default location replaces the
+// previous one.
+func (s *InventoryService) CreateLocation(ctx context.Context, location *domain.Location) (uuid.UUID, error) {
+	var locationID uuid.UUID
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		location.IsActive = true
+		if location.IsDefault {
+			if err := s.locationRepo.ClearDefault(ctx, location.OrganizationID); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		locationID, err = s.locationRepo.Create(ctx, location)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return locationID, nil
+}
+
+// GetLocation retrieves a location by ID
+func (s *InventoryService) GetLocation(ctx context.Context, id uuid.UUID) (*domain.Location, error) {
+	location, err := s.locationRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+	return location, nil
+}
+
+// ListLocations retrieves all locations for an organization, default first
+func (s *InventoryService) ListLocations(ctx context.Context, orgID uuid.UUID) ([]*domain.Location, error) {
+	return s.locationRepo.List(ctx, orgID)
+}
+
+// UpdateLocation updates an existing location. Making a location the default
+// clears the flag on the previous default; the default location itself can
+// only be replaced, not unset or deactivated.
+func (s *InventoryService) UpdateLocation(ctx context.Context, location *domain.Location) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.locationRepo.GetByID(ctx, location.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrLocationNotFound
+		}
+
+		if existing.IsDefault && (!location.IsDefault || !location.IsActive) {
+			return ErrDefaultLocation
+		}
+		if location.IsDefault && !location.IsActive {
+			return ErrLocationInactive
+		}
+		if location.IsDefault && !existing.IsDefault {
+			if err := s.locationRepo.ClearDefault(ctx, existing.OrganizationID); err != nil {
+				return err
+			}
+		}
+
+		return s.locationRepo.Update(ctx, location)
+	})
+}
+
+// DeleteLocation deletes a location that holds no stock and has no movement
+// history. The default location cannot be deleted.
+func (s *InventoryService) DeleteLocation(ctx context.Context, id uuid.UUID) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		location, err := s.locationRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if location == nil {
+			return ErrLocationNotFound
+		}
+		if location.IsDefault {
+			return ErrDefaultLocation
+		}
+
+		count, err := s.stockLevelRepo.CountStockedAtLocation(ctx, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrLocationHasStock
+		}
+
+		used, err := s.locationRepo.HasMovements(ctx, id)
+		if err != nil {
+			return err
+		}
+		if used {
+			return ErrLocationInUse
+		}
+
+		if err := s.stockLevelRepo.DeleteByLocation(ctx, id); err != nil {
+			return err
+		}
+		return s.locationRepo.Delete(ctx, id)
+	})
+}
+
+// ListStockLevels retrieves the per-location stock of an item
+func (s *InventoryService) ListStockLevels(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLevel, error) {
+	return s.stockLevelRepo.ListByItem(ctx, itemID)
+}
+
+// StockAtLocation resolves an active location of the organization, the
+// default location when locationID is nil, and returns the stock of each of
+// the items there in base units. Unassigned stock counts towards the default
+// location, as it does for movements.
+func (s *InventoryService) StockAtLocation(ctx context.Context, orgID uuid.UUID, locationID *uuid.UUID, items []*domain.Item) (*domain.Location, map[uuid.UUID]int, error) {
+	plan := s.newStockPlan(orgID)
+	location, err := plan.activeLocation(ctx, locationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stock := make(map[uuid.UUID]int, len(items))
+	for _, item := range items {
+		if err := plan.addItem(ctx, item); err != nil {
+			return nil, nil, err
+		}
+		stock[item.ID] = plan.levels[stockKey{item.ID, location.ID}]
+	}
+	return location, stock, nil
+}
+
+// SetLocationThreshold sets the minimum threshold of an item at a location.
+// A nil threshold falls back to the item's own threshold.
+func (s *InventoryService) SetLocationThreshold(ctx context.Context, itemID, locationID uuid.UUID, threshold *int) (*domain.StockLevel, error) {
+	var level *domain.StockLevel
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		item, err := s.itemRepo.GetByID(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrItemNotFound
+		}
+
+		location, err := s.locationRepo.GetByID(ctx, locationID)
+		if err != nil {
+			return err
+		}
+		if location == nil || location.OrganizationID != item.OrganizationID {
+			return ErrLocationNotFound
+		}
+
+		if err := s.stockLevelRepo.SetThreshold(ctx, itemID, locationID, threshold); err != nil {
+			return err
+		}
+		level, err = s.stockLevelRepo.Get(ctx, itemID, locationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return level, nil
+}
+
+// Unit methods
+
+// Units returns the units the organization measures in: the built-in units
+// and its own
+func (s *InventoryService) Units(ctx context.Context, orgID uuid.UUID) (*units.Registry, error) {
+	list, err := s.unitRepo.List(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	measures := make([]units.Unit, 0, len(list))
+	for _, unit := range list {
+		measures = append(measures, unit.Measure())
+	}
+	return units.NewRegistry(measures...), nil
+}
+
+// ItemUnits returns the units quantities of an item can be entered in: the
+// organization's units and the item's own purchase units
+func (s *InventoryService) ItemUnits(ctx context.Context, item *domain.Item) (*units.Registry, error) {
+	registry, err := s.Units(ctx, item.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	measure, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil {
+		// Purchase units are kept in base units of the item's unit, so an
+		// item measured in an unknown unit has none
+		return registry, nil
+	}
+
+	conversions, err := s.unitRepo.ListItemConversions(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	packs := make([]units.Unit, 0, len(conversions))
+	for _, conversion := range conversions {
+		packs = append(packs, conversion.Measure(measure.BaseUnit))
+	}
+	return registry.With(packs...), nil
+}
+
+// ListUnits retrieves the organization's own units, ordered by code
+func (s *InventoryService) ListUnits(ctx context.Context, orgID uuid.UUID) ([]*domain.Unit, error) {
+	return s.unitRepo.List(ctx, orgID)
+}
+
+// GetUnit retrieves a unit by ID
+func (s *InventoryService) GetUnit(ctx context.Context, id uuid.UUID) (*domain.Unit, error) {
+	unit, err := s.unitRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if unit == nil {
+		return nil, ErrUnitNotFound
+	}
+	return unit, nil
+}
+
+// CreateUnit defines a unit of the organization. A unit based on another
+// unit must use a base unit that is already measured, so a new dimension
+// such as rolls starts with a unit that is its own base unit.
+func (s *InventoryService) CreateUnit(ctx context.Context, orgID uuid.UUID, req *domain.CreateUnitRequest) (*domain.Unit, error) {
+	unit := &domain.Unit{
+		OrganizationID: orgID,
+		Code:           strings.TrimSpace(req.Code),
+		Name:           strings.TrimSpace(req.Name),
+		Factor:         1,
+		Precision:      req.Precision,
+	}
+	unit.BaseUnit = unit.Code
+	if req.BaseUnit != nil {
+		unit.BaseUnit = strings.TrimSpace(*req.BaseUnit)
+	}
+	if req.Factor != nil {
+		unit.Factor = *req.Factor
+	}
+
+	if _, builtin := units.SupportedUnits[unit.Code]; builtin || !validUnitCode(unit.Code) {
+		return nil, ErrInvalidUnitCode
+	}
+	if unit.Name == "" || len(unit.Name) > 100 {
+		return nil, ErrInvalidUnitName
+	}
+	if unit.Factor <= 0 || (unit.BaseUnit == unit.Code && unit.Factor != 1) {
+		return nil, ErrInvalidFactor
+	}
+	if unit.Precision < 0 || unit.Precision > 6 {
+		return nil, ErrInvalidPrecision
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		registry, err := s.Units(ctx, orgID)
+		if err != nil {
+			return err
+		}
+
+		if registry.Validate(unit.Code) == nil {
+			return ErrUnitCodeTaken
+		}
+		bases := make(map[string]bool)
+		for _, measure := range registry.Units() {
+			bases[measure.BaseUnit] = true
+		}
+		if bases[unit.Code] {
+			return ErrInvalidUnitCode
+		}
+		if unit.BaseUnit != unit.Code && !bases[unit.BaseUnit] {
+			return ErrInvalidBaseUnit
+		}
+
+		_, err = s.unitRepo.Create(ctx, unit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return unit, nil
+}
+
+// UpdateUnit renames a unit or changes its display precision
+func (s *InventoryService) UpdateUnit(ctx context.Context, unit *domain.Unit, req *domain.UpdateUnitRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return ErrInvalidUnitName
+		}
+		unit.Name = name
+	}
+	if req.Precision != nil {
+		if *req.Precision < 0 || *req.Precision > 6 {
+			return ErrInvalidPrecision
+		}
+		unit.Precision = *req.Precision
+	}
+
+	return s.unitRepo.Update(ctx, unit)
+}
+
+// DeleteUnit deletes a unit no item, recipe or other unit measures in
+func (s *InventoryService) DeleteUnit(ctx context.Context, id uuid.UUID) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		unit, err := s.unitRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if unit == nil {
+			return ErrUnitNotFound
+		}
+
+		used, err := s.unitRepo.IsInUse(ctx, unit.OrganizationID, unit.Code)
+		if err != nil {
+			return err
+		}
+		if used {
+			return ErrUnitInUse
+		}
+
+		return s.unitRepo.Delete(ctx, id)
+	})
+}
+
+// ListItemConversions retrieves the purchase units of an item
+func (s *InventoryService) ListItemConversions(ctx context.Context, itemID uuid.UUID) ([]*domain.ItemUnitConversion, error) {
+	return s.unitRepo.ListItemConversions(ctx, itemID)
+}
+
+// SetItemConversion sets how much of item one of its purchase units holds,
+// such as 24 pcs in a case or 25 kg in a sack. The purchase unit cannot
+// shadow a unit of the organization.
+func (s *InventoryService) SetItemConversion(ctx context.Context, item *domain.Item, code string, req *domain.SetItemUnitConversionRequest) (*domain.ItemUnitConversion, error) {
+	code = strings.TrimSpace(code)
+	if _, builtin := units.SupportedUnits[code]; builtin || !validUnitCode(code) {
+		return nil, ErrInvalidUnitCode
+	}
+	if req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	registry, err := s.Units(ctx, item.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if registry.Validate(code) == nil {
+		return nil, ErrUnitCodeTaken
+	}
+
+	measure, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil {
+		return nil, err
+	}
+	unit := item.UnitOfMeasurement
+	if req.Unit != nil {
+		unit = *req.Unit
+	}
+	contents, err := registry.GetUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+	if contents.BaseUnit != measure.BaseUnit {
+		return nil, fmt.Errorf("%w: %s and %s", units.ErrIncompatibleUnits, unit, item.UnitOfMeasurement)
+	}
+	quantity, err := registry.ToBaseUnit(req.Quantity, unit)
+	if err != nil {
+		return nil, err
+	}
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	conversion := &domain.ItemUnitConversion{
+		ItemID:   item.ID,
+		Unit:     code,
+		Quantity: quantity,
+	}
+	if err := s.unitRepo.SetItemConversion(ctx, conversion); err != nil {
+		return nil, err
+	}
+	return conversion, nil
+}
+
+// DeleteItemConversion removes a purchase unit of an item
+func (s *InventoryService) DeleteItemConversion(ctx context.Context, itemID uuid.UUID, code string) error {
+	conversions, err := s.unitRepo.ListItemConversions(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	for _, conversion := range conversions {
+		if conversion.Unit == code {
+			return s.unitRepo.DeleteItemConversion(ctx, itemID, code)
+		}
+	}
+	return ErrUnitNotFound
+}
+
+// validUnitCode reports whether code is 1 to 20 characters without spaces
+func validUnitCode(code string) bool {
+	return code != "" && len(code) <= 20 && !strings.ContainsAny(code, " \t\r\n")
+}
+
+// Movement reason methods
+
+// ensureMovementReasons returns the organization's movement reasons, giving
+// it the default reasons on first use
+func (s *InventoryService) ensureMovementReasons(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error) {
+	reasons, err := s.reasonRepo.List(ctx, orgID)
+	if err != nil || len(reasons) > 0 {
+		return reasons, err
+	}
+
+	for _, reason := range domain.DefaultMovementReasons {
+		reason.OrganizationID = orgID
+		reason.IsActive = true
+		if _, err := s.reasonRepo.Create(ctx, &reason); err != nil {
+			return nil, err
+		}
+	}
+	return s.reasonRepo.List(ctx, orgID)
+}
+
+// ListMovementReasons retrieves the organization's movement reasons,
+// ordered by code
+func (s *InventoryService) ListMovementReasons(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error) {
+	return s.ensureMovementReasons(ctx, orgID)
+}
+
+// GetMovementReason retrieves a movement reason by ID
+func (s *InventoryService) GetMovementReason(ctx context.Context, id uuid.UUID) (*domain.MovementReason, error) {
+	reason, err := s.reasonRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reason == nil {
+		return nil, ErrMovementReasonNotFound
+	}
+	return reason, nil
+}
+
+// CreateMovementReason defines a movement reason of the organization
+func (s *InventoryService) CreateMovementReason(ctx context.Context, orgID uuid.UUID, req *domain.CreateMovementReasonRequest) (*domain.MovementReason, error) {
+	reason := &domain.MovementReason{
+		OrganizationID: orgID,
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Name:           strings.TrimSpace(req.Name),
+		IsWaste:        req.IsWaste,
+		IsActive:       true,
+	}
+	if !validReasonCode(reason.Code) {
+		return nil, ErrInvalidReasonCode
+	}
+	if reason.Name == "" || len(reason.Name) > 100 {
+		return nil, ErrInvalidReasonName
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		// Seed the defaults first so that they are not skipped for an
+		// organization whose first reason is its own
+		if _, err := s.ensureMovementReasons(ctx, orgID); err != nil {
+			return err
+		}
+
+		created, err := s.reasonRepo.Create(ctx, reason)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return ErrReasonCodeTaken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reason, nil
+}
+
+// UpdateMovementReason renames a movement reason, changes whether it counts
+// as waste or (de)activates it. Movements already recorded with a
+// deactivated reason keep it.
+func (s *InventoryService) UpdateMovementReason(ctx context.Context, reason *domain.MovementReason, req *domain.UpdateMovementReasonRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return ErrInvalidReasonName
+		}
+		reason.Name = name
+	}
+	if req.IsWaste != nil {
+		reason.IsWaste = *req.IsWaste
+	}
+	if req.IsActive != nil {
+		reason.IsActive = *req.IsActive
+	}
+
+	return s.reasonRepo.Update(ctx, reason)
+}
+
+// validReasonCode reports whether code is 1 to 30 upper case letters, digits
+// and underscores starting with a letter
+func validReasonCode(code string) bool {
+	if code == "" || len(code) > 30 || code[0] < 'A' || code[0] > 'Z' {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Costing methods
+
+// costingMethod returns the organization's costing method, FIFO unless it
+// chose otherwise
+func (s *InventoryService) costingMethod(ctx context.Context, orgID uuid.UUID) (domain.CostingMethod, error) {
+	method, err := s.costingRepo.GetMethod(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	if method == "" {
+		return domain.CostingFIFO, nil
+	}
+	return method, nil
+}
+
+// GetCostingSettings returns how the organization costs its stock
+func (s *InventoryService) GetCostingSettings(ctx context.Context, orgID uuid.UUID) (*domain.CostingSettings, error) {
+	method, err := s.costingMethod(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.CostingSettings{Method: method}, nil
+}
+
+// UpdateCostingSettings changes the organization's costing method. Stock
+// already consumed keeps its cost; switching to WEIGHTED_AVERAGE merges each
+// item's layers at the next movement of the item.
+func (s *InventoryService) UpdateCostingSettings(ctx context.Context, orgID uuid.UUID, settings *domain.CostingSettings) error {
+	switch settings.Method {
+	case domain.CostingFIFO, domain.CostingWeightedAverage:
+	default:
+		return ErrInvalidCostingMethod
+	}
+	return s.costingRepo.SetMethod(ctx, orgID, settings.Method)
 }
 
 // Movement methods
 
-// CreateMovement creates a stock movement
-func (s *InventoryService) CreateMovement(ctx context.Context, req *domain.CreateMovementRequest, userID uuid.UUID) (*domain.StockMovement, error) {
-	return s.AdjustStock(ctx, req.ItemID, req.MovementType, req.Quantity, userID, req.Reference, req.Notes)
+// CreateMovement creates a stock movement. When expectedVersion is set the
+// item must still be at that version or ErrItemVersionMismatch is returned.
+func (s *InventoryService) CreateMovement(ctx context.Context, req *domain.CreateMovementRequest, userID uuid.UUID, expectedVersion *int) (*domain.StockMovement, error) {
+	return s.adjustStock(ctx, req, userID, expectedVersion)
 }
 
 // GetMovement retrieves a movement by ID
@@ -373,8 +2172,82 @@ func (s *InventoryService) GetMovement(ctx context.Context, id uuid.UUID) (*doma
 	return s.movementRepo.GetByID(ctx, id)
 }
 
+// ReverseMovement undoes a movement of the organization by posting its
+// inverse, linked to it through ReversalOf, and marks the original voided by
+// userID. The reversal is checked against current stock like any other
+// movement, and policy limits which movements the caller may reverse.
+func (s *InventoryService) ReverseMovement(ctx context.Context, orgID, id, userID uuid.UUID, policy ReversalPolicy, req *domain.ReverseMovementRequest) (*domain.StockMovement, error) {
+	var reversal *domain.StockMovement
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		original, err := s.movementRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if original == nil {
+			return ErrMovementNotFound
+		}
+		item, err := s.itemRepo.GetByID(ctx, original.ItemID)
+		if err != nil {
+			return err
+		}
+		if item == nil || item.OrganizationID != orgID {
+			return ErrMovementNotFound
+		}
+		if original.ReversalOf != nil {
+			return ErrReversalOfReversal
+		}
+		if isLedgerRepair(original) {
+			return ErrReversalOfLedgerRepair
+		}
+		if isUnitConversion(original) {
+			return ErrReversalOfUnitConversion
+		}
+		if original.VoidedAt != nil {
+			return ErrMovementVoided
+		}
+
+		now := time.Now().UTC()
+		if err := policy.check(original, userID, now); err != nil {
+			return err
+		}
+		// Voiding first makes a concurrent reversal of the same movement
+		// wait for this one and then find it voided
+		voided, err := s.movementRepo.Void(ctx, original.ID, userID, now)
+		if err != nil {
+			return fmt.Errorf("failed to void movement: %w", err)
+		}
+		if !voided {
+			return ErrMovementVoided
+		}
+
+		plan := s.newStockPlan(orgID)
+		if err := plan.addItem(ctx, item); err != nil {
+			return err
+		}
+		reversal, err = plan.reverse(ctx, original)
+		if err != nil {
+			return err
+		}
+		reversal.Reference = original.Reference
+		if req != nil {
+			reversal.Notes = req.Notes
+		}
+		reversal.CreatedBy = userID
+
+		return plan.apply(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
 // ListMovementsByItem retrieves movements for a specific item
 func (s *InventoryService) ListMovementsByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
+	if _, err := s.GetItem(ctx, itemID); err != nil {
+		return nil, err
+	}
 	return s.movementRepo.ListByItem(ctx, itemID, limit, offset)
 }
 
@@ -383,8 +2256,29 @@ func (s *InventoryService) ListMovements(ctx context.Context, orgID uuid.UUID, l
 	return s.movementRepo.ListByOrganization(ctx, orgID, limit, offset)
 }
 
+// stockAlertTypes are the alerts that follow the stock level; expiry alerts
+// follow lots and are left alone when stock changes
+var stockAlertTypes = []domain.AlertType{domain.AlertTypeLowStock, domain.AlertTypeOutOfStock}
+
+// refreshLowStockAlert creates or clears low stock alerts after a stock change
+func (s *InventoryService) refreshLowStockAlert(ctx context.Context, item *domain.Item, previousStock, newStock int) error {
+	if !item.TrackStock {
+		// Ensure no lingering alerts for untracked items
+		return s.alertRepo.DeleteByItemID(ctx, item.ID, stockAlertTypes...)
+	}
+
+	if newStock < item.MinimumThreshold {
+		return s.createLowStockAlert(ctx, item.ID, item.OrganizationID, item.Name, newStock, item.MinimumThreshold)
+	}
+	if previousStock < item.MinimumThreshold {
+		// Stock is now above threshold, delete any existing alerts
+		return s.alertRepo.DeleteByItemID(ctx, item.ID, stockAlertTypes...)
+	}
+	return nil
+}
+
 // createLowStockAlert creates a low stock alert for an item
-func (s *InventoryService) createLowStockAlert(ctx context.Context, itemID, orgID uuid.UUID, itemName string, currentStock, threshold int) {
+func (s *InventoryService) createLowStockAlert(ctx context.Context, itemID, orgID uuid.UUID, itemName string, currentStock, threshold int) error {
 	alert := &domain.Alert{
 		OrganizationID: orgID,
 		Type:           domain.AlertTypeLowStock,
@@ -395,6 +2289,69 @@ func (s *InventoryService) createLowStockAlert(ctx context.Context, itemID, orgI
 		IsRead:         false,
 	}
 
-	// Create alert (ignore errors as this is not critical)
-	s.alertRepo.Create(ctx, alert)
+	_, err := s.alertRepo.Create(ctx, alert)
+	return err
+}
+
+// Lot methods
+
+// ListLots retrieves the lots of an item that still hold stock, in the order
+// they will be consumed
+func (s *InventoryService) ListLots(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLot, error) {
+	return s.lotRepo.ListByItem(ctx, itemID)
+}
+
+// RaiseExpiryAlerts creates an EXPIRY alert for every lot that expires
+// within the given window and has not been alerted on yet, across all
+// organizations. Lots already past their expiry date get a critical alert.
+// It returns the number of alerts created.
+func (s *InventoryService) RaiseExpiryAlerts(ctx context.Context, within time.Duration) (int, error) {
+	now := time.Now().UTC()
+	created := 0
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		lots, err := s.lotRepo.ListExpiringUnalerted(ctx, now.Add(within))
+		if err != nil {
+			return err
+		}
+
+		for _, lot := range lots {
+			if _, err := s.alertRepo.Create(ctx, expiryAlert(lot, now)); err != nil {
+				return err
+			}
+			if err := s.lotRepo.MarkExpiryAlerted(ctx, lot.ID, now); err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// expiryAlert builds the alert for a lot that has expired or is about to
+func expiryAlert(lot *domain.StockLot, now time.Time) *domain.Alert {
+	label := "received " + lot.ReceivedAt.Format("2006-01-02")
+	if lot.LotNumber != nil {
+		label = *lot.LotNumber
+	}
+	expiry := lot.ExpiresAt.Format("2006-01-02")
+
+	alert := &domain.Alert{
+		OrganizationID: lot.OrganizationID,
+		ItemID:         &lot.ItemID,
+		Type:           domain.AlertTypeExpiry,
+		Severity:       domain.AlertSeverityWarning,
+		Title:          fmt.Sprintf("Expiring Soon: %s", lot.ItemName),
+		Message:        fmt.Sprintf("Lot '%s' of '%s' at %s expires on %s. Remaining: %d", label, lot.ItemName, lot.LocationName, expiry, lot.Quantity),
+	}
+	if !lot.ExpiresAt.After(now) {
+		alert.Severity = domain.AlertSeverityCritical
+		alert.Title = fmt.Sprintf("Expired: %s", lot.ItemName)
+		alert.Message = fmt.Sprintf("Lot '%s' of '%s' at %s expired on %s. Remaining: %d", label, lot.ItemName, lot.LocationName, expiry, lot.Quantity)
+	}
+	return alert
 }
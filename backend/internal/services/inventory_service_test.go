@@ -2,12 +2,18 @@ package services_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
 	"hasufel.kj/internal/services"
+	"hasufel.kj/pkg/units"
 )
 
 // Mock repository for testing
@@ -48,7 +54,7 @@ func (m *mockItemRepo) Update(ctx context.Context, item *domain.Item) error {
 	return nil
 }
 
-func (m *mockItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock int) error {
+func (m *mockItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
 	return nil
 }
 
@@ -60,6 +66,10 @@ func (m *mockItemRepo) ReassignCategory(ctx context.Context, fromCategoryID, toC
 	return nil
 }
 
+func (m *mockItemRepo) UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
 func (m *mockItemRepo) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
@@ -96,6 +106,10 @@ func (m *mockMovementRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.S
 	return nil, nil
 }
 
+func (m *mockMovementRepo) Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error) {
+	return true, nil
+}
+
 func (m *mockMovementRepo) ListByItem(ctx context.Context, itemID uuid.UUID, limit, offset int) ([]*domain.StockMovement, error) {
 	return []*domain.StockMovement{}, nil
 }
@@ -108,9 +122,12 @@ func (m *mockMovementRepo) ListRecent(ctx context.Context, orgID uuid.UUID, limi
 	return []*domain.StockMovement{}, nil
 }
 
-type mockAlertRepo struct{}
+type mockAlertRepo struct {
+	created []*domain.Alert
+}
 
 func (m *mockAlertRepo) Create(ctx context.Context, alert *domain.Alert) (uuid.UUID, error) {
+	m.created = append(m.created, alert)
 	return uuid.New(), nil
 }
 
@@ -130,10 +147,445 @@ func (m *mockAlertRepo) MarkAsRead(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (m *mockAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID) error {
+func (m *mockAlertRepo) DeleteByItemID(ctx context.Context, itemID uuid.UUID, types ...domain.AlertType) error {
+	return nil
+}
+
+// mockLocationRepo keeps locations in memory
+type mockLocationRepo struct {
+	locations map[uuid.UUID]*domain.Location
+}
+
+func newMockLocationRepo() *mockLocationRepo {
+	return &mockLocationRepo{locations: make(map[uuid.UUID]*domain.Location)}
+}
+
+func (m *mockLocationRepo) Create(ctx context.Context, location *domain.Location) (uuid.UUID, error) {
+	if location.ID == uuid.Nil {
+		location.ID = uuid.New()
+	}
+	copied := *location
+	m.locations[location.ID] = &copied
+	return location.ID, nil
+}
+
+func (m *mockLocationRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Location, error) {
+	if location, ok := m.locations[id]; ok {
+		copied := *location
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *mockLocationRepo) GetDefault(ctx context.Context, orgID uuid.UUID) (*domain.Location, error) {
+	for _, location := range m.locations {
+		if location.OrganizationID == orgID && location.IsDefault {
+			copied := *location
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockLocationRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Location, error) {
+	var locations []*domain.Location
+	for _, location := range m.locations {
+		if location.OrganizationID == orgID {
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+func (m *mockLocationRepo) Update(ctx context.Context, location *domain.Location) error {
+	copied := *location
+	m.locations[location.ID] = &copied
+	return nil
+}
+
+func (m *mockLocationRepo) ClearDefault(ctx context.Context, orgID uuid.UUID) error {
+	for _, location := range m.locations {
+		if location.OrganizationID == orgID {
+			location.IsDefault = false
+		}
+	}
+	return nil
+}
+
+func (m *mockLocationRepo) HasMovements(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (m *mockLocationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.locations, id)
+	return nil
+}
+
+// mockStockLevelRepo keeps per-location quantities in memory
+type mockStockLevelRepo struct {
+	levels map[[2]uuid.UUID]*domain.StockLevel
+}
+
+func newMockStockLevelRepo() *mockStockLevelRepo {
+	return &mockStockLevelRepo{levels: make(map[[2]uuid.UUID]*domain.StockLevel)}
+}
+
+func (m *mockStockLevelRepo) level(itemID, locationID uuid.UUID) *domain.StockLevel {
+	key := [2]uuid.UUID{itemID, locationID}
+	if _, ok := m.levels[key]; !ok {
+		m.levels[key] = &domain.StockLevel{ItemID: itemID, LocationID: locationID}
+	}
+	return m.levels[key]
+}
+
+func (m *mockStockLevelRepo) Get(ctx context.Context, itemID, locationID uuid.UUID) (*domain.StockLevel, error) {
+	return m.levels[[2]uuid.UUID{itemID, locationID}], nil
+}
+
+func (m *mockStockLevelRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLevel, error) {
+	var levels []*domain.StockLevel
+	for key, level := range m.levels {
+		if key[0] == itemID {
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+func (m *mockStockLevelRepo) SetQuantity(ctx context.Context, itemID, locationID uuid.UUID, quantity int) error {
+	m.level(itemID, locationID).Quantity = quantity
+	return nil
+}
+
+func (m *mockStockLevelRepo) SetThreshold(ctx context.Context, itemID, locationID uuid.UUID, threshold *int) error {
+	m.level(itemID, locationID).MinimumThreshold = threshold
+	return nil
+}
+
+func (m *mockStockLevelRepo) CountStockedAtLocation(ctx context.Context, locationID uuid.UUID) (int, error) {
+	count := 0
+	for key, level := range m.levels {
+		if key[1] == locationID && level.Quantity > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockStockLevelRepo) DeleteByLocation(ctx context.Context, locationID uuid.UUID) error {
+	for key := range m.levels {
+		if key[1] == locationID {
+			delete(m.levels, key)
+		}
+	}
+	return nil
+}
+
+// mockStockLotRepo keeps lots and their movement records in memory
+type mockStockLotRepo struct {
+	lots  []*domain.StockLot
+	moves map[[2]uuid.UUID]int
+}
+
+func newMockStockLotRepo() *mockStockLotRepo {
+	return &mockStockLotRepo{moves: make(map[[2]uuid.UUID]int)}
+}
+
+func (m *mockStockLotRepo) Create(ctx context.Context, lot *domain.StockLot) (uuid.UUID, error) {
+	lot.ID = uuid.New()
+	m.lots = append(m.lots, lot)
+	return lot.ID, nil
+}
+
+func (m *mockStockLotRepo) ListAvailable(ctx context.Context, itemID, locationID uuid.UUID) ([]*domain.StockLot, error) {
+	var lots []*domain.StockLot
+	for _, lot := range m.lots {
+		if lot.ItemID == itemID && lot.LocationID == locationID && lot.Quantity > 0 {
+			copied := *lot
+			lots = append(lots, &copied)
+		}
+	}
+	sort.SliceStable(lots, func(i, j int) bool {
+		a, b := lots[i].ExpiresAt, lots[j].ExpiresAt
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Before(*b)
+	})
+	return lots, nil
+}
+
+func (m *mockStockLotRepo) ListByItem(ctx context.Context, itemID uuid.UUID) ([]*domain.StockLot, error) {
+	var lots []*domain.StockLot
+	for _, lot := range m.lots {
+		if lot.ItemID == itemID && lot.Quantity > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	return lots, nil
+}
+
+func (m *mockStockLotRepo) UpdateQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	for _, lot := range m.lots {
+		if lot.ID == id {
+			lot.Quantity = quantity
+		}
+	}
+	return nil
+}
+
+func (m *mockStockLotRepo) AddQuantity(ctx context.Context, id uuid.UUID, quantity int) error {
+	for _, lot := range m.lots {
+		if lot.ID == id {
+			lot.Quantity += quantity
+		}
+	}
+	return nil
+}
+
+func (m *mockStockLotRepo) RecordMovement(ctx context.Context, movementID, lotID uuid.UUID, quantity int) error {
+	m.moves[[2]uuid.UUID{movementID, lotID}] = quantity
+	return nil
+}
+
+func (m *mockStockLotRepo) ListMovementLots(ctx context.Context, movementID uuid.UUID) ([]*domain.MovementLot, error) {
+	var lots []*domain.MovementLot
+	for move, quantity := range m.moves {
+		if move[0] == movementID {
+			lots = append(lots, &domain.MovementLot{LotID: move[1], Quantity: quantity})
+		}
+	}
+	return lots, nil
+}
+
+func (m *mockStockLotRepo) ListExpiringUnalerted(ctx context.Context, before time.Time) ([]*domain.StockLot, error) {
+	var lots []*domain.StockLot
+	for _, lot := range m.lots {
+		if lot.Quantity > 0 && lot.ExpiresAt != nil && !lot.ExpiresAt.After(before) && lot.ExpiryAlertedAt == nil {
+			lots = append(lots, lot)
+		}
+	}
+	return lots, nil
+}
+
+func (m *mockStockLotRepo) MarkExpiryAlerted(ctx context.Context, id uuid.UUID, at time.Time) error {
+	for _, lot := range m.lots {
+		if lot.ID == id {
+			lot.ExpiryAlertedAt = &at
+		}
+	}
+	return nil
+}
+
+// mockUnitRepo keeps units and item conversions in memory
+type mockUnitRepo struct {
+	units       map[uuid.UUID]*domain.Unit
+	conversions map[uuid.UUID][]*domain.ItemUnitConversion
+}
+
+func newMockUnitRepo() *mockUnitRepo {
+	return &mockUnitRepo{
+		units:       make(map[uuid.UUID]*domain.Unit),
+		conversions: make(map[uuid.UUID][]*domain.ItemUnitConversion),
+	}
+}
+
+func (m *mockUnitRepo) Create(ctx context.Context, unit *domain.Unit) (uuid.UUID, error) {
+	unit.ID = uuid.New()
+	copied := *unit
+	m.units[unit.ID] = &copied
+	return unit.ID, nil
+}
+
+func (m *mockUnitRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Unit, error) {
+	unit, ok := m.units[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *unit
+	return &copied, nil
+}
+
+func (m *mockUnitRepo) GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.Unit, error) {
+	for _, unit := range m.units {
+		if unit.OrganizationID == orgID && unit.Code == code {
+			copied := *unit
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockUnitRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Unit, error) {
+	var list []*domain.Unit
+	for _, unit := range m.units {
+		if unit.OrganizationID == orgID {
+			list = append(list, unit)
+		}
+	}
+	return list, nil
+}
+
+func (m *mockUnitRepo) Update(ctx context.Context, unit *domain.Unit) error {
+	copied := *unit
+	m.units[unit.ID] = &copied
+	return nil
+}
+
+func (m *mockUnitRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.units, id)
+	return nil
+}
+
+func (m *mockUnitRepo) IsInUse(ctx context.Context, orgID uuid.UUID, code string) (bool, error) {
+	for _, unit := range m.units {
+		if unit.OrganizationID == orgID && unit.BaseUnit == code && unit.Code != code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUnitRepo) ListItemConversions(ctx context.Context, itemID uuid.UUID) ([]*domain.ItemUnitConversion, error) {
+	return m.conversions[itemID], nil
+}
+
+func (m *mockUnitRepo) SetItemConversion(ctx context.Context, conversion *domain.ItemUnitConversion) error {
+	list := m.conversions[conversion.ItemID]
+	for i, existing := range list {
+		if existing.Unit == conversion.Unit {
+			list[i] = conversion
+			return nil
+		}
+	}
+	m.conversions[conversion.ItemID] = append(list, conversion)
+	return nil
+}
+
+func (m *mockUnitRepo) DeleteItemConversion(ctx context.Context, itemID uuid.UUID, unit string) error {
+	list := m.conversions[itemID]
+	for i, existing := range list {
+		if existing.Unit == unit {
+			m.conversions[itemID] = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// mockMovementReasonRepo keeps movement reasons in memory
+type mockMovementReasonRepo struct {
+	reasons map[uuid.UUID]*domain.MovementReason
+}
+
+func newMockMovementReasonRepo() *mockMovementReasonRepo {
+	return &mockMovementReasonRepo{reasons: make(map[uuid.UUID]*domain.MovementReason)}
+}
+
+func (m *mockMovementReasonRepo) Create(ctx context.Context, reason *domain.MovementReason) (bool, error) {
+	for _, existing := range m.reasons {
+		if existing.OrganizationID == reason.OrganizationID && existing.Code == reason.Code {
+			return false, nil
+		}
+	}
+	reason.ID = uuid.New()
+	copied := *reason
+	m.reasons[reason.ID] = &copied
+	return true, nil
+}
+
+func (m *mockMovementReasonRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.MovementReason, error) {
+	reason, ok := m.reasons[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *reason
+	return &copied, nil
+}
+
+func (m *mockMovementReasonRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.MovementReason, error) {
+	var list []*domain.MovementReason
+	for _, reason := range m.reasons {
+		if reason.OrganizationID == orgID {
+			copied := *reason
+			list = append(list, &copied)
+		}
+	}
+	return list, nil
+}
+
+func (m *mockMovementReasonRepo) Update(ctx context.Context, reason *domain.MovementReason) error {
+	copied := *reason
+	m.reasons[reason.ID] = &copied
+	return nil
+}
+
+// mockCostingRepo keeps cost layers in memory, handing out copies as a
+// database would
+type mockCostingRepo struct {
+	method domain.CostingMethod
+	layers []*domain.CostLayer
+}
+
+func newMockCostingRepo() *mockCostingRepo {
+	return &mockCostingRepo{}
+}
+
+func (m *mockCostingRepo) GetMethod(ctx context.Context, orgID uuid.UUID) (domain.CostingMethod, error) {
+	return m.method, nil
+}
+
+func (m *mockCostingRepo) SetMethod(ctx context.Context, orgID uuid.UUID, method domain.CostingMethod) error {
+	m.method = method
+	return nil
+}
+
+func (m *mockCostingRepo) CreateLayer(ctx context.Context, layer *domain.CostLayer) (uuid.UUID, error) {
+	layer.ID = uuid.New()
+	copied := *layer
+	m.layers = append(m.layers, &copied)
+	return layer.ID, nil
+}
+
+func (m *mockCostingRepo) ListOpenLayers(ctx context.Context, itemID uuid.UUID) ([]*domain.CostLayer, error) {
+	var list []*domain.CostLayer
+	for _, layer := range m.layers {
+		if layer.ItemID == itemID && layer.Quantity > 0 {
+			copied := *layer
+			list = append(list, &copied)
+		}
+	}
+	return list, nil
+}
+
+func (m *mockCostingRepo) UpdateLayer(ctx context.Context, layer *domain.CostLayer) error {
+	for _, stored := range m.layers {
+		if stored.ID == layer.ID {
+			stored.Quantity = layer.Quantity
+			stored.UnitCost = layer.UnitCost
+		}
+	}
 	return nil
 }
 
+// newInventoryService wires an inventory service to the given items, unit
+// conversions and alerts, with empty mocks for the remaining repositories
+func newInventoryService(db *sql.DB, items repository.ItemRepository, units *mockUnitRepo, alerts *mockAlertRepo) *services.InventoryService {
+	return services.NewInventoryService(
+		items,
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		alerts,
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		units,
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+}
+
 func TestInventoryService_ListItemsWithFiltersPaginated(t *testing.T) {
 	ctx := context.Background()
 	orgID := uuid.New()
@@ -157,6 +609,12 @@ func TestInventoryService_ListItemsWithFiltersPaginated(t *testing.T) {
 		&mockCategoryRepo{},
 		&mockMovementRepo{},
 		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
 		nil,
 	)
 
@@ -210,6 +668,12 @@ func TestInventoryService_ListItemsWithFiltersPaginated_EmptyResults(t *testing.
 		&mockCategoryRepo{},
 		&mockMovementRepo{},
 		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
 		nil,
 	)
 
@@ -244,7 +708,9 @@ func (m *mockItemRepoWithStock) Create(ctx context.Context, item *domain.Item) (
 
 func (m *mockItemRepoWithStock) GetByID(ctx context.Context, id uuid.UUID) (*domain.Item, error) {
 	if m.item != nil && m.item.ID == id {
-		return m.item, nil
+		// Return a copy like a real repository would
+		copied := *m.item
+		return &copied, nil
 	}
 	return nil, services.ErrItemNotFound
 }
@@ -265,9 +731,13 @@ func (m *mockItemRepoWithStock) Update(ctx context.Context, item *domain.Item) e
 	return nil
 }
 
-func (m *mockItemRepoWithStock) UpdateStock(ctx context.Context, id uuid.UUID, newStock int) error {
+func (m *mockItemRepoWithStock) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
 	if m.item != nil && m.item.ID == id {
+		if m.item.Version != expectedVersion {
+			return repository.ErrVersionConflict
+		}
 		m.item.CurrentStock = newStock
+		m.item.Version++
 		return nil
 	}
 	return services.ErrItemNotFound
@@ -281,6 +751,10 @@ func (m *mockItemRepoWithStock) ReassignCategory(ctx context.Context, fromCatego
 	return nil
 }
 
+func (m *mockItemRepoWithStock) UsedInRecipes(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
 func (m *mockItemRepoWithStock) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
@@ -318,6 +792,12 @@ func TestInventoryService_AdjustStock_ShouldSetExactValue(t *testing.T) {
 		&mockCategoryRepo{},
 		&mockMovementRepo{},
 		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
 		db,
 	)
 
@@ -393,6 +873,12 @@ func TestInventoryService_AdjustStock_ShouldHandleZeroAdjustment(t *testing.T) {
 		&mockCategoryRepo{},
 		&mockMovementRepo{},
 		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
 		db,
 	)
 
@@ -429,3 +915,1257 @@ func TestInventoryService_AdjustStock_ShouldHandleZeroAdjustment(t *testing.T) {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestInventoryService_BulkAdjustStock_AppliesLinesInOrder(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	itemID := uuid.New()
+	userID := uuid.New()
+
+	item := &domain.Item{
+		ID:               itemID,
+		OrganizationID:   orgID,
+		Name:             "Test Item",
+		CurrentStock:     10,
+		MinimumThreshold: 5,
+		TrackStock:       true,
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	reference := "DELIVERY-42"
+	req := &domain.BulkAdjustRequest{
+		Reference: &reference,
+		Adjustments: []domain.BulkAdjustLine{
+			{ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 20},
+			{ItemID: itemID, MovementType: domain.MovementTypeOut, Quantity: 25},
+		},
+	}
+
+	movements, err := service.BulkAdjustStock(ctx, orgID, req, userID)
+	if err != nil {
+		t.Fatalf("BulkAdjustStock failed: %v", err)
+	}
+
+	if len(movements) != 2 {
+		t.Fatalf("expected 2 movements, got %d", len(movements))
+	}
+	if movements[0].PreviousStock != 10 || movements[0].NewStock != 30 {
+		t.Errorf("expected first line 10 -> 30, got %d -> %d", movements[0].PreviousStock, movements[0].NewStock)
+	}
+	if movements[1].PreviousStock != 30 || movements[1].NewStock != 5 {
+		t.Errorf("expected second line 30 -> 5, got %d -> %d", movements[1].PreviousStock, movements[1].NewStock)
+	}
+	if movements[1].Reference == nil || *movements[1].Reference != reference {
+		t.Errorf("expected batch reference to be applied to lines")
+	}
+	if item.CurrentStock != 5 {
+		t.Errorf("expected item current stock to be 5, got %d", item.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_BulkAdjustStock_RejectsWholeBatchOnInvalidLine(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	itemID := uuid.New()
+	userID := uuid.New()
+
+	item := &domain.Item{
+		ID:             itemID,
+		OrganizationID: orgID,
+		Name:           "Test Item",
+		CurrentStock:   10,
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// No commit: the transaction must be rolled back
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	req := &domain.BulkAdjustRequest{
+		Adjustments: []domain.BulkAdjustLine{
+			{ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 5},
+			{ItemID: itemID, MovementType: domain.MovementTypeOut, Quantity: 50},
+			{ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 0},
+		},
+	}
+
+	_, err = service.BulkAdjustStock(ctx, orgID, req, userID)
+
+	var bulkErr *services.BulkAdjustError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected BulkAdjustError, got %v", err)
+	}
+	if len(bulkErr.Lines) != 2 {
+		t.Fatalf("expected 2 line errors, got %d", len(bulkErr.Lines))
+	}
+	if bulkErr.Lines[0].Field != "adjustments[1].quantity" {
+		t.Errorf("expected error on adjustments[1].quantity, got %s", bulkErr.Lines[0].Field)
+	}
+	if item.CurrentStock != 10 {
+		t.Errorf("expected stock to be untouched, got %d", item.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// racingItemRepo simulates another writer bumping the item between the
+// service's read and its stock write
+type racingItemRepo struct {
+	*mockItemRepoWithStock
+}
+
+func (m *racingItemRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
+	m.item.Version++
+	return m.mockItemRepoWithStock.UpdateStock(ctx, id, newStock, expectedVersion)
+}
+
+func TestInventoryService_AdjustStock_ReturnsConflictOnConcurrentWrite(t *testing.T) {
+	ctx := context.Background()
+	itemID := uuid.New()
+
+	item := &domain.Item{
+		ID:             itemID,
+		OrganizationID: uuid.New(),
+		Name:           "Test Item",
+		CurrentStock:   10,
+		Version:        4,
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	service := services.NewInventoryService(
+		&racingItemRepo{&mockItemRepoWithStock{item: item}},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	_, err = service.AdjustStock(ctx, itemID, domain.MovementTypeOut, 3, uuid.New(), nil, nil)
+	if !errors.Is(err, services.ErrItemConflict) {
+		t.Fatalf("expected ErrItemConflict, got %v", err)
+	}
+	if item.CurrentStock != 10 {
+		t.Errorf("expected stock to be untouched, got %d", item.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_CreateMovement_ChecksExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	itemID := uuid.New()
+
+	item := &domain.Item{
+		ID:             itemID,
+		OrganizationID: uuid.New(),
+		Name:           "Test Item",
+		CurrentStock:   10,
+		Version:        3,
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+	req := &domain.CreateMovementRequest{ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 5}
+
+	stale := 2
+	if _, err := service.CreateMovement(ctx, req, uuid.New(), &stale); err != services.ErrItemVersionMismatch {
+		t.Fatalf("expected ErrItemVersionMismatch, got %v", err)
+	}
+	if item.CurrentStock != 10 {
+		t.Fatalf("expected stock to be untouched, got %d", item.CurrentStock)
+	}
+
+	current := 3
+	movement, err := service.CreateMovement(ctx, req, uuid.New(), &current)
+	if err != nil {
+		t.Fatalf("CreateMovement failed: %v", err)
+	}
+	if movement.Item == nil || movement.Item.Version != 4 {
+		t.Fatalf("expected movement to carry item version 4, got %+v", movement.Item)
+	}
+	if item.CurrentStock != 15 {
+		t.Errorf("expected stock 15, got %d", item.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_TransferStock_MovesStockBetweenLocations(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", CurrentStock: 8000, MinimumThreshold: 1000, TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	locations := newMockLocationRepo()
+	levels := newMockStockLevelRepo()
+	store := &domain.Location{OrganizationID: orgID, Name: "Main Store", IsDefault: true, IsActive: true}
+	cooler := &domain.Location{OrganizationID: orgID, Name: "Cooler", IsActive: true}
+	locations.Create(ctx, store)
+	locations.Create(ctx, cooler)
+	// 6000 is recorded at the store; the remaining 2000 predates locations
+	levels.SetQuantity(ctx, item.ID, store.ID, 6000)
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		locations,
+		levels,
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	movement, err := service.TransferStock(ctx, item.ID, store.ID, cooler.ID, 7500, uuid.New(), nil, nil)
+	if err != nil {
+		t.Fatalf("TransferStock failed: %v", err)
+	}
+	if movement.PreviousStock != 8000 || movement.NewStock != 8000 || item.CurrentStock != 8000 {
+		t.Errorf("expected total stock to stay 8000, got %d -> %d (item %d)", movement.PreviousStock, movement.NewStock, item.CurrentStock)
+	}
+	if movement.ToLocationID == nil || *movement.ToLocationID != cooler.ID {
+		t.Errorf("expected transfer to the cooler, got %v", movement.ToLocationID)
+	}
+	if got, _ := levels.Get(ctx, item.ID, store.ID); got.Quantity != 500 {
+		t.Errorf("expected 500 left at the store, got %d", got.Quantity)
+	}
+	if got, _ := levels.Get(ctx, item.ID, cooler.ID); got.Quantity != 7500 {
+		t.Errorf("expected 7500 at the cooler, got %d", got.Quantity)
+	}
+
+	// The store only holds 500 now, even though the item holds 8000 in total
+	_, err = service.TransferStock(ctx, item.ID, store.ID, cooler.ID, 600, uuid.New(), nil, nil)
+	if err != services.ErrInsufficientStock {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_BulkAdjustStock_ValidatesLocations(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", CurrentStock: 1000, TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	locations := newMockLocationRepo()
+	closed := &domain.Location{OrganizationID: orgID, Name: "Old Bar", IsActive: false}
+	foreign := &domain.Location{OrganizationID: uuid.New(), Name: "Elsewhere", IsActive: true}
+	locations.Create(ctx, closed)
+	locations.Create(ctx, foreign)
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		locations,
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	req := &domain.BulkAdjustRequest{Adjustments: []domain.BulkAdjustLine{
+		{ItemID: item.ID, MovementType: domain.MovementTypeIn, Quantity: 10, LocationID: &closed.ID},
+		{ItemID: item.ID, MovementType: domain.MovementTypeOut, Quantity: 10, LocationID: &foreign.ID},
+		{ItemID: item.ID, MovementType: domain.MovementTypeTransfer, Quantity: 10},
+		{ItemID: item.ID, MovementType: domain.MovementTypeIn, Quantity: 10, ToLocationID: &closed.ID},
+	}}
+
+	_, err = service.BulkAdjustStock(ctx, orgID, req, uuid.New())
+	var bulkErr *services.BulkAdjustError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected *BulkAdjustError, got %v", err)
+	}
+
+	want := []string{
+		"adjustments[0].locationId",
+		"adjustments[1].locationId",
+		"adjustments[2].toLocationId",
+		"adjustments[3].toLocationId",
+	}
+	if len(bulkErr.Lines) != len(want) {
+		t.Fatalf("expected %d line errors, got %+v", len(want), bulkErr.Lines)
+	}
+	for i, field := range want {
+		if bulkErr.Lines[i].Field != field {
+			t.Errorf("line %d: expected field %s, got %s", i, field, bulkErr.Lines[i].Field)
+		}
+	}
+	if item.CurrentStock != 1000 {
+		t.Errorf("expected stock to be untouched, got %d", item.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_AdjustStock_CountsAtOneLocation(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", CurrentStock: 3000, TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	locations := newMockLocationRepo()
+	levels := newMockStockLevelRepo()
+	store := &domain.Location{OrganizationID: orgID, Name: "Main Store", IsDefault: true, IsActive: true}
+	line := &domain.Location{OrganizationID: orgID, Name: "Line", IsActive: true}
+	locations.Create(ctx, store)
+	locations.Create(ctx, line)
+	levels.SetQuantity(ctx, item.ID, store.ID, 2000)
+	levels.SetQuantity(ctx, item.ID, line.ID, 1000)
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		locations,
+		levels,
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	// A count of 400 on the line is a 600 shrink of the total
+	req := &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeAdjustment, Quantity: 400, LocationID: &line.ID}
+	movement, err := service.CreateMovement(ctx, req, uuid.New(), nil)
+	if err != nil {
+		t.Fatalf("CreateMovement failed: %v", err)
+	}
+	if movement.PreviousStock != 3000 || movement.NewStock != 2400 {
+		t.Errorf("expected total 3000 -> 2400, got %d -> %d", movement.PreviousStock, movement.NewStock)
+	}
+	if got, _ := levels.Get(ctx, item.ID, line.ID); got.Quantity != 400 {
+		t.Errorf("expected 400 on the line, got %d", got.Quantity)
+	}
+	if got, _ := levels.Get(ctx, item.ID, store.ID); got.Quantity != 2000 {
+		t.Errorf("expected the store to be untouched at 2000, got %d", got.Quantity)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_Movements_ConsumeLotsFirstExpiryFirstOut(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	locations := newMockLocationRepo()
+	store := &domain.Location{OrganizationID: orgID, Name: "Main Store", IsDefault: true, IsActive: true}
+	cooler := &domain.Location{OrganizationID: orgID, Name: "Cooler", IsActive: true}
+	locations.Create(ctx, store)
+	locations.Create(ctx, cooler)
+	lots := newMockStockLotRepo()
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		locations,
+		newMockStockLevelRepo(),
+		lots,
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	create := func(req *domain.CreateMovementRequest) *domain.StockMovement {
+		t.Helper()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		req.ItemID = item.ID
+		movement, err := service.CreateMovement(ctx, req, uuid.New(), nil)
+		if err != nil {
+			t.Fatalf("CreateMovement %s failed: %v", req.MovementType, err)
+		}
+		return movement
+	}
+
+	now := time.Now().UTC()
+	late, early := now.Add(10*24*time.Hour), now.Add(2*24*time.Hour)
+	lotNumber := "B-0412"
+	lateIn := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 1000, ExpiresAt: &late})
+	earlyIn := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 1000, ExpiresAt: &early, LotNumber: &lotNumber})
+	undatedIn := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 500})
+	if len(earlyIn.Lots) != 1 || earlyIn.Lots[0].Quantity != 1000 || *earlyIn.Lots[0].LotNumber != lotNumber {
+		t.Fatalf("expected IN to receive one lot of 1000, got %+v", earlyIn.Lots)
+	}
+	lateLot, earlyLot, undatedLot := lateIn.Lots[0].LotID, earlyIn.Lots[0].LotID, undatedIn.Lots[0].LotID
+
+	quantityOf := func(id uuid.UUID) int {
+		for _, lot := range lots.lots {
+			if lot.ID == id {
+				return lot.Quantity
+			}
+		}
+		t.Fatalf("lot %s not found", id)
+		return 0
+	}
+
+	out := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeOut, Quantity: 1500})
+	if len(out.Lots) != 2 || out.Lots[0].LotID != earlyLot || out.Lots[0].Quantity != 1000 ||
+		out.Lots[1].LotID != lateLot || out.Lots[1].Quantity != 500 {
+		t.Fatalf("expected OUT to take 1000 from the earliest lot then 500 from the next, got %+v", out.Lots)
+	}
+	if quantityOf(earlyLot) != 0 || quantityOf(lateLot) != 500 || quantityOf(undatedLot) != 500 {
+		t.Errorf("unexpected lot quantities after OUT: %d, %d, %d", quantityOf(earlyLot), quantityOf(lateLot), quantityOf(undatedLot))
+	}
+
+	transfer := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeTransfer, Quantity: 600, ToLocationID: &cooler.ID})
+	if len(transfer.Lots) != 2 || transfer.Lots[0].LotID != lateLot || transfer.Lots[1].Quantity != 100 {
+		t.Fatalf("expected TRANSFER to take the rest of the dated lot then 100 undated, got %+v", transfer.Lots)
+	}
+	atCooler, _ := lots.ListAvailable(ctx, item.ID, cooler.ID)
+	if len(atCooler) != 2 || atCooler[0].ExpiresAt == nil || !atCooler[0].ExpiresAt.Equal(late) || atCooler[0].Quantity != 500 ||
+		atCooler[1].ExpiresAt != nil || atCooler[1].Quantity != 100 {
+		t.Fatalf("expected the transferred lots to keep their expiry at the cooler, got %+v", atCooler)
+	}
+
+	// Counting the store down to zero uses up what is left of its lots
+	create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeAdjustment, Quantity: 0})
+	if quantityOf(undatedLot) != 0 {
+		t.Errorf("expected the adjustment to use up the undated lot, got %d", quantityOf(undatedLot))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_CreateMovement_ValidatesLotDetails(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", CurrentStock: 1000, TrackStock: true}
+	lotNumber := "B-0412"
+	received := time.Now().UTC()
+	expired := received.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		req  *domain.CreateMovementRequest
+		want error
+	}{
+		{"lot number on OUT", &domain.CreateMovementRequest{MovementType: domain.MovementTypeOut, Quantity: 100, LotNumber: &lotNumber}, services.ErrLotNotAllowed},
+		{"expiry on ADJUSTMENT", &domain.CreateMovementRequest{MovementType: domain.MovementTypeAdjustment, Quantity: 100, ExpiresAt: &received}, services.ErrLotNotAllowed},
+		{"expiry before receipt", &domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 100, ReceivedAt: &received, ExpiresAt: &expired}, services.ErrInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+
+			lots := newMockStockLotRepo()
+			service := services.NewInventoryService(
+				&mockItemRepoWithStock{item: item},
+				&mockCategoryRepo{},
+				&mockMovementRepo{},
+				&mockAlertRepo{},
+				newMockLocationRepo(),
+				newMockStockLevelRepo(),
+				lots,
+				newMockUnitRepo(),
+				newMockMovementReasonRepo(),
+				newMockCostingRepo(),
+				db,
+			)
+
+			tt.req.ItemID = item.ID
+			if _, err := service.CreateMovement(ctx, tt.req, uuid.New(), nil); err != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if len(lots.lots) != 0 {
+				t.Errorf("expected no lots to be created, got %d", len(lots.lots))
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestInventoryService_RaiseExpiryAlerts(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	now := time.Now().UTC()
+	expired, soon, later := now.Add(-24*time.Hour), now.Add(24*time.Hour), now.Add(10*24*time.Hour)
+	lots := newMockStockLotRepo()
+	for _, expiresAt := range []*time.Time{&expired, &soon, &later, nil} {
+		lots.Create(ctx, &domain.StockLot{
+			ItemID: uuid.New(), OrganizationID: orgID, ItemName: "Paneer", LocationName: "Cooler",
+			ReceivedAt: now.Add(-48 * time.Hour), ExpiresAt: expiresAt, InitialQuantity: 1000, Quantity: 1000,
+		})
+	}
+
+	alerts := &mockAlertRepo{}
+	service := services.NewInventoryService(
+		&mockItemRepo{},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		alerts,
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		lots,
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	n, err := service.RaiseExpiryAlerts(ctx, 2*24*time.Hour)
+	if err != nil {
+		t.Fatalf("RaiseExpiryAlerts failed: %v", err)
+	}
+	if n != 2 || len(alerts.created) != 2 {
+		t.Fatalf("expected alerts for the expired and the soon-to-expire lot, got %d", len(alerts.created))
+	}
+	for i, want := range []domain.AlertSeverity{domain.AlertSeverityCritical, domain.AlertSeverityWarning} {
+		alert := alerts.created[i]
+		if alert.Type != domain.AlertTypeExpiry || alert.Severity != want || alert.OrganizationID != orgID {
+			t.Errorf("alert %d: expected %s EXPIRY alert for the organization, got %+v", i, want, alert)
+		}
+	}
+
+	if n, err := service.RaiseExpiryAlerts(ctx, 2*24*time.Hour); err != nil || n != 0 {
+		t.Fatalf("expected each lot to be alerted once, got %d more (%v)", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_CreateUnit_ValidatesDefinitions(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewInventoryService(
+		&mockItemRepo{},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	pcs, dozen, zero := "pcs", 12, 0
+	sack := "sack"
+	// Definitions that pass the field checks are compared to the existing
+	// units inside a transaction
+	tests := []struct {
+		name string
+		req  *domain.CreateUnitRequest
+		tx   bool
+		want error
+	}{
+		{"roll is its own base unit", &domain.CreateUnitRequest{Code: "roll", Name: "Roll"}, true, nil},
+		{"dozen of pieces", &domain.CreateUnitRequest{Code: "dozen", Name: "Dozen", BaseUnit: &pcs, Factor: &dozen}, true, nil},
+		{"built-in code", &domain.CreateUnitRequest{Code: "kg", Name: "Kilo"}, false, services.ErrInvalidUnitCode},
+		{"base unit code", &domain.CreateUnitRequest{Code: "g", Name: "Gram"}, true, services.ErrInvalidUnitCode},
+		{"code taken", &domain.CreateUnitRequest{Code: "roll", Name: "Another roll"}, true, services.ErrUnitCodeTaken},
+		{"unknown base unit", &domain.CreateUnitRequest{Code: "bag", Name: "Bag", BaseUnit: &sack, Factor: &dozen}, true, services.ErrInvalidBaseUnit},
+		{"zero factor", &domain.CreateUnitRequest{Code: "box", Name: "Box", BaseUnit: &pcs, Factor: &zero}, false, services.ErrInvalidFactor},
+		{"own base unit with a factor", &domain.CreateUnitRequest{Code: "tray", Name: "Tray", Factor: &dozen}, false, services.ErrInvalidFactor},
+		{"precision too fine", &domain.CreateUnitRequest{Code: "tin", Name: "Tin", Precision: 7}, false, services.ErrInvalidPrecision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tx {
+				mock.ExpectBegin()
+				if tt.want == nil {
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+			if _, err := service.CreateUnit(ctx, orgID, tt.req); err != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	registry, err := service.Units(ctx, orgID)
+	if err != nil {
+		t.Fatalf("Units failed: %v", err)
+	}
+	if got, err := registry.ToBaseUnit(2, "dozen"); err != nil || got != 24 {
+		t.Errorf("expected 2 dozen to be 24 pcs, got %d, %v", got, err)
+	}
+
+	// The seed data keeps foil in rolls, which only the organization's
+	// units can display
+	foil := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Foil", UnitOfMeasurement: "roll", CurrentStock: 15}
+	display, err := foil.ToDisplay(registry)
+	if err != nil || display.CurrentStock != 15 {
+		t.Errorf("expected foil to display 15 rolls, got %+v, %v", display, err)
+	}
+	if _, err := foil.ToDisplay(nil); err == nil {
+		t.Error("expected rolls to be unknown without the organization's units")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_CreateMovement_ConvertsPurchaseUnits(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Tissue", UnitOfMeasurement: "pcs", TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	unitRepo := newMockUnitRepo()
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		unitRepo,
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	if _, err := service.CreateUnit(ctx, orgID, &domain.CreateUnitRequest{Code: "roll", Name: "Roll"}); err != nil {
+		t.Fatalf("CreateUnit failed: %v", err)
+	}
+
+	// 1 case = 24 pcs
+	conversion, err := service.SetItemConversion(ctx, item, "case", &domain.SetItemUnitConversionRequest{Quantity: 24})
+	if err != nil || conversion.Quantity != 24 {
+		t.Fatalf("expected a case of 24 pcs, got %+v, %v", conversion, err)
+	}
+	if _, err := service.SetItemConversion(ctx, item, "roll", &domain.SetItemUnitConversionRequest{Quantity: 10}); err != services.ErrUnitCodeTaken {
+		t.Errorf("expected a pack named after an organization unit to be rejected, got %v", err)
+	}
+	roll := "roll"
+	if _, err := service.SetItemConversion(ctx, item, "bale", &domain.SetItemUnitConversionRequest{Quantity: 10, Unit: &roll}); !errors.Is(err, units.ErrIncompatibleUnits) {
+		t.Errorf("expected a pack of rolls to be rejected for an item in pcs, got %v", err)
+	}
+
+	// 1 sack = 25 kg, kept in grams
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg"}
+	sack, err := service.SetItemConversion(ctx, rice, "sack", &domain.SetItemUnitConversionRequest{Quantity: 25})
+	if err != nil || sack.Quantity != 25000 {
+		t.Errorf("expected a sack of 25000 g, got %+v, %v", sack, err)
+	}
+
+	caseUnit := "case"
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	movement, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeIn, Quantity: 2, Unit: &caseUnit}, uuid.New(), nil)
+	if err != nil {
+		t.Fatalf("CreateMovement in cases failed: %v", err)
+	}
+	if movement.Quantity != 48 || item.CurrentStock != 48 {
+		t.Errorf("expected 2 cases to receive 48 pcs, got movement %d and stock %d", movement.Quantity, item.CurrentStock)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	_, err = service.CreateMovement(ctx, &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeOut, Quantity: 1, Unit: &roll}, uuid.New(), nil)
+	if !errors.Is(err, units.ErrIncompatibleUnits) {
+		t.Errorf("expected rolls of tissue to be rejected, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// ledgerMovementRepo keeps the movements it creates so they can be read back
+// and voided
+type ledgerMovementRepo struct {
+	mockMovementRepo
+	movements map[uuid.UUID]*domain.StockMovement
+}
+
+func (m *ledgerMovementRepo) Create(ctx context.Context, movement *domain.StockMovement) (uuid.UUID, error) {
+	movement.ID = uuid.New()
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now().UTC()
+	}
+	m.movements[movement.ID] = movement
+	return movement.ID, nil
+}
+
+func (m *ledgerMovementRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.StockMovement, error) {
+	movement, ok := m.movements[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *movement
+	return &copied, nil
+}
+
+func (m *ledgerMovementRepo) Void(ctx context.Context, id, voidedBy uuid.UUID, at time.Time) (bool, error) {
+	movement := m.movements[id]
+	if movement.VoidedAt != nil {
+		return false, nil
+	}
+	movement.VoidedAt, movement.VoidedBy = &at, &voidedBy
+	return true, nil
+}
+
+func TestInventoryService_ReverseMovement_RestoresStockAndLots(t *testing.T) {
+	ctx := context.Background()
+	orgID, staffID, otherID := uuid.New(), uuid.New(), uuid.New()
+	item := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", TrackStock: true}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	locations := newMockLocationRepo()
+	store := &domain.Location{OrganizationID: orgID, Name: "Main Store", IsDefault: true, IsActive: true}
+	cooler := &domain.Location{OrganizationID: orgID, Name: "Cooler", IsActive: true}
+	locations.Create(ctx, store)
+	locations.Create(ctx, cooler)
+	lots := newMockStockLotRepo()
+	movements := &ledgerMovementRepo{movements: make(map[uuid.UUID]*domain.StockMovement)}
+
+	service := services.NewInventoryService(
+		&mockItemRepoWithStock{item: item},
+		&mockCategoryRepo{},
+		movements,
+		&mockAlertRepo{},
+		locations,
+		newMockStockLevelRepo(),
+		lots,
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	create := func(req *domain.CreateMovementRequest) *domain.StockMovement {
+		t.Helper()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		req.ItemID = item.ID
+		movement, err := service.CreateMovement(ctx, req, staffID, nil)
+		if err != nil {
+			t.Fatalf("CreateMovement %s failed: %v", req.MovementType, err)
+		}
+		return movement
+	}
+	quantityOf := func(id uuid.UUID) int {
+		for _, lot := range lots.lots {
+			if lot.ID == id {
+				return lot.Quantity
+			}
+		}
+		t.Fatalf("lot %s not found", id)
+		return 0
+	}
+
+	staff := services.ReversalPolicy{MaxAge: 24 * time.Hour, OwnOnly: true}
+	admin := services.ReversalPolicy{MaxAge: 30 * 24 * time.Hour}
+	reverse := func(id, userID uuid.UUID, policy services.ReversalPolicy) (*domain.StockMovement, error) {
+		return service.ReverseMovement(ctx, orgID, id, userID, policy, &domain.ReverseMovementRequest{})
+	}
+
+	late := time.Now().UTC().Add(10 * 24 * time.Hour)
+	in := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 1000, ExpiresAt: &late})
+	storeLot := in.Lots[0].LotID
+	out := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeOut, Quantity: 400})
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := reverse(out.ID, otherID, staff); err != services.ErrReversalForbidden {
+		t.Fatalf("expected staff not to reverse another user's movement, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	reversal, err := reverse(out.ID, staffID, staff)
+	if err != nil {
+		t.Fatalf("ReverseMovement failed: %v", err)
+	}
+	if reversal.MovementType != domain.MovementTypeIn || reversal.Quantity != 400 || reversal.ReversalOf == nil || *reversal.ReversalOf != out.ID {
+		t.Fatalf("expected an IN of 400 reversing the OUT, got %+v", reversal)
+	}
+	if item.CurrentStock != 1000 || quantityOf(storeLot) != 1000 || len(lots.lots) != 1 {
+		t.Errorf("expected the 400 back in the lot it came from, got stock %d and lot %d", item.CurrentStock, quantityOf(storeLot))
+	}
+	if voided := movements.movements[out.ID]; voided.VoidedAt == nil || *voided.VoidedBy != staffID {
+		t.Errorf("expected the OUT to be voided by the staff member, got %+v", voided)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := reverse(out.ID, staffID, staff); err != services.ErrMovementVoided {
+		t.Errorf("expected a voided movement not to be reversed twice, got %v", err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := reverse(reversal.ID, staffID, staff); err != services.ErrReversalOfReversal {
+		t.Errorf("expected a reversal not to be reversible, got %v", err)
+	}
+
+	// The cooler has an earlier lot of its own, but the reversal takes back
+	// the transferred lot
+	early := time.Now().UTC().Add(2 * 24 * time.Hour)
+	coolerIn := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeIn, Quantity: 200, LocationID: &cooler.ID, ExpiresAt: &early})
+	transfer := create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeTransfer, Quantity: 300, ToLocationID: &cooler.ID})
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	reversal, err = reverse(transfer.ID, otherID, admin)
+	if err != nil {
+		t.Fatalf("ReverseMovement of the transfer failed: %v", err)
+	}
+	if *reversal.LocationID != cooler.ID || *reversal.ToLocationID != store.ID {
+		t.Errorf("expected the reversal to transfer from the cooler to the store, got %+v", reversal)
+	}
+	atCooler, _ := lots.ListAvailable(ctx, item.ID, cooler.ID)
+	if len(atCooler) != 1 || atCooler[0].ID != coolerIn.Lots[0].LotID || atCooler[0].Quantity != 200 || quantityOf(storeLot) != 1000 {
+		t.Errorf("expected the transferred 300 back in the store lot, got cooler lots %+v and store lot %d", atCooler, quantityOf(storeLot))
+	}
+
+	// The delivery has been used since, so it can no longer be taken back
+	create(&domain.CreateMovementRequest{MovementType: domain.MovementTypeOut, Quantity: 600})
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := reverse(in.ID, staffID, staff); err != services.ErrInsufficientStock {
+		t.Errorf("expected reversing a used delivery to fail with insufficient stock, got %v", err)
+	}
+
+	movements.movements[coolerIn.ID].CreatedAt = time.Now().UTC().Add(-48 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := reverse(coolerIn.ID, staffID, staff); err != services.ErrReversalTooOld {
+		t.Errorf("expected a two day old movement to be out of the staff window, got %v", err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := service.ReverseMovement(ctx, uuid.New(), coolerIn.ID, staffID, admin, nil); err != services.ErrMovementNotFound {
+		t.Errorf("expected another organization's movement not to be found, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryService_CreateMovement_CostsGoodsByMethod(t *testing.T) {
+	ctx := context.Background()
+	closeTo := func(got, want float64) bool {
+		return got-want < 1e-6 && want-got < 1e-6
+	}
+
+	// 1 kg of rice from before costing at 50/kg, 2 kg bought at 80/kg, then
+	// 2 kg used
+	for _, tc := range []struct {
+		method    domain.CostingMethod
+		used      float64
+		remaining float64
+	}{
+		{domain.CostingFIFO, 130, 80},
+		{domain.CostingWeightedAverage, 140, 70},
+	} {
+		t.Run(string(tc.method), func(t *testing.T) {
+			riceCost := 50.0
+			item := &domain.Item{ID: uuid.New(), OrganizationID: uuid.New(), Name: "Rice", UnitOfMeasurement: "kg", CurrentStock: 1000, UnitCost: &riceCost, TrackStock: true}
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			costing := newMockCostingRepo()
+			costing.method = tc.method
+			service := services.NewInventoryService(
+				&mockItemRepoWithStock{item: item},
+				&mockCategoryRepo{},
+				&mockMovementRepo{},
+				&mockAlertRepo{},
+				newMockLocationRepo(),
+				newMockStockLevelRepo(),
+				newMockStockLotRepo(),
+				newMockUnitRepo(),
+				newMockMovementReasonRepo(),
+				costing,
+				db,
+			)
+
+			price := 80.0
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+			if _, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeOut, Quantity: 100, UnitCost: &price}, uuid.New(), nil); err != services.ErrUnitCostNotAllowed {
+				t.Fatalf("expected a unit cost on OUT to be rejected, got %v", err)
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectCommit()
+			in, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeIn, Quantity: 2000, UnitCost: &price}, uuid.New(), nil)
+			if err != nil {
+				t.Fatalf("CreateMovement IN failed: %v", err)
+			}
+			if in.TotalCost == nil || !closeTo(*in.TotalCost, 160) {
+				t.Fatalf("expected the IN to cost 160, got %v", in.TotalCost)
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectCommit()
+			out, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{ItemID: item.ID, MovementType: domain.MovementTypeOut, Quantity: 2000}, uuid.New(), nil)
+			if err != nil {
+				t.Fatalf("CreateMovement OUT failed: %v", err)
+			}
+			if out.TotalCost == nil || !closeTo(*out.TotalCost, tc.used) {
+				t.Fatalf("expected the OUT to cost %v, got %v", tc.used, out.TotalCost)
+			}
+
+			quantity, value := 0, 0.0
+			for _, layer := range costing.layers {
+				quantity += layer.Quantity
+				value += float64(layer.Quantity) * layer.UnitCost
+			}
+			if quantity != 1000 || !closeTo(value, tc.remaining) {
+				t.Errorf("expected 1 kg left worth %v, got %d g worth %v", tc.remaining, quantity, value)
+			}
+			if len(costing.layers) != 2 || costing.layers[0].MovementID != nil || costing.layers[1].MovementID == nil || *costing.layers[1].MovementID != in.ID {
+				t.Errorf("expected an opening layer and a layer for the IN, got %d layers", len(costing.layers))
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// creatingItemRepo keeps the item it creates, as a database would
+type creatingItemRepo struct {
+	mockItemRepoWithStock
+}
+
+func (m *creatingItemRepo) Create(ctx context.Context, item *domain.Item) (uuid.UUID, error) {
+	item.ID = uuid.New()
+	item.Version = 1
+	copied := *item
+	m.item = &copied
+	return item.ID, nil
+}
+
+func (m *creatingItemRepo) Update(ctx context.Context, item *domain.Item) error {
+	if m.item == nil || m.item.ID != item.ID {
+		return services.ErrItemNotFound
+	}
+	if m.item.Version != item.Version {
+		return repository.ErrVersionConflict
+	}
+	item.Version++
+	copied := *item
+	m.item = &copied
+	return nil
+}
+
+func TestInventoryService_CreateItem_PostsOpeningMovementAndConvertsUnits(t *testing.T) {
+	ctx := context.Background()
+	orgID, adminID := uuid.New(), uuid.New()
+	riceCost := 60.0
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	items := &creatingItemRepo{}
+	movements := &ledgerMovementRepo{movements: make(map[uuid.UUID]*domain.StockMovement)}
+	levels := newMockStockLevelRepo()
+	costing := newMockCostingRepo()
+	service := services.NewInventoryService(
+		items,
+		&mockCategoryRepo{},
+		movements,
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		levels,
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		costing,
+		db,
+	)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	itemID, err := service.CreateItem(ctx, &domain.Item{
+		OrganizationID: orgID, CategoryID: uuid.New(), Name: "Rice", UnitOfMeasurement: "kg",
+		CurrentStock: 5000, UnitCost: &riceCost, TrackStock: true,
+	}, adminID)
+	if err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	if len(movements.movements) != 1 {
+		t.Fatalf("expected one movement, got %d", len(movements.movements))
+	}
+	var opening *domain.StockMovement
+	for _, mv := range movements.movements {
+		opening = mv
+	}
+	if opening.MovementType != domain.MovementTypeOpening || opening.ItemID != itemID || opening.PreviousStock != 0 ||
+		opening.NewStock != 5000 || opening.LocationID == nil || opening.CreatedBy != adminID {
+		t.Fatalf("expected an OPENING movement of 5000 by the admin at a location, got %+v", opening)
+	}
+	if items.item.CurrentStock != 5000 || levels.level(itemID, *opening.LocationID).Quantity != 5000 {
+		t.Fatalf("expected 5000 at the default location, got %d in total", items.item.CurrentStock)
+	}
+	if len(costing.layers) != 1 || costing.layers[0].Quantity != 5000 || *opening.TotalCost != 300 {
+		t.Fatalf("expected the opening stock costed at 60/kg, got %v", opening.TotalCost)
+	}
+
+	if _, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{
+		ItemID: itemID, MovementType: domain.MovementTypeOpening, Quantity: 100,
+	}, adminID, nil); !errors.Is(err, services.ErrInvalidMovementType) {
+		t.Fatalf("expected OPENING to be refused from callers, got %v", err)
+	}
+
+	// kg and gm both measure grams, so the stock converts; pcs does not
+	update := func(unit string) error {
+		item, err := service.GetItem(ctx, itemID)
+		if err != nil {
+			t.Fatalf("GetItem failed: %v", err)
+		}
+		item.UnitOfMeasurement = unit
+		mock.ExpectBegin()
+		if unit == "pcs" {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectCommit()
+		}
+		return service.UpdateItem(ctx, item, adminID)
+	}
+	if err := update("gm"); err != nil {
+		t.Fatalf("UpdateItem to gm failed: %v", err)
+	}
+	if len(movements.movements) != 2 {
+		t.Fatalf("expected the conversion to be recorded, got %d movements", len(movements.movements))
+	}
+	var conversion *domain.StockMovement
+	for _, mv := range movements.movements {
+		if mv.ID != opening.ID {
+			conversion = mv
+		}
+	}
+	if conversion.MovementType != domain.MovementTypeAdjustment || conversion.PreviousStock != 5000 || conversion.NewStock != 5000 ||
+		*conversion.Reference != domain.UnitConversionReference || *conversion.Notes != "Unit changed from kg to gm: 5 kg is 5000 gm; unit cost 60 per kg is 0.06 per gm" {
+		t.Fatalf("expected a UNIT_CONVERSION adjustment keeping 5000, got %+v", conversion)
+	}
+	if items.item.UnitCost == nil || *items.item.UnitCost != 0.06 {
+		t.Fatalf("expected the unit cost to be rescaled to 0.06/gm, got %v", items.item.UnitCost)
+	}
+	if err := update("pcs"); !errors.Is(err, services.ErrIncompatibleUnitChange) {
+		t.Fatalf("expected gm to pcs to be refused, got %v", err)
+	}
+
+	reverse := func(id uuid.UUID) error {
+		_, err := service.ReverseMovement(ctx, orgID, id, adminID, services.ReversalPolicy{MaxAge: time.Hour}, &domain.ReverseMovementRequest{})
+		return err
+	}
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := reverse(conversion.ID); !errors.Is(err, services.ErrReversalOfUnitConversion) {
+		t.Fatalf("expected the conversion not to be reversible, got %v", err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	if err := reverse(opening.ID); err != nil {
+		t.Fatalf("expected the opening to be reversible, got %v", err)
+	}
+	if items.item.CurrentStock != 0 {
+		t.Fatalf("expected reversing the opening to empty the item, got %d", items.item.CurrentStock)
+	}
+
+	// Stock brought in without a cost is valued at the rescaled unit cost
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	received, err := service.CreateMovement(ctx, &domain.CreateMovementRequest{
+		ItemID: itemID, MovementType: domain.MovementTypeIn, Quantity: 1000,
+	}, adminID, nil)
+	if err != nil {
+		t.Fatalf("CreateMovement failed: %v", err)
+	}
+	if received.TotalCost == nil || *received.TotalCost != 60 {
+		t.Fatalf("expected 1000 gm to cost 60, got %v", received.TotalCost)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
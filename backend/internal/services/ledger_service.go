@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+// LedgerService checks that each item's movements account for its stock.
+// Replaying an item's ledger from zero, every movement should start where
+// the one before it ended and the last should end at the item's current
+// stock, and the item's stock levels should add up to it. A repair takes the
+// current stock as right and closes the ledger around it with ADJUSTMENT
+// movements at the default location, then plans the ADJUSTMENTs that bring
+// the stock levels and cost layers in line with it.
+type LedgerService struct {
+	ledgerRepo repository.LedgerRepository
+	inventory  *InventoryService
+	db         *sql.DB
+}
+
+func NewLedgerService(ledgerRepo repository.LedgerRepository, inventory *InventoryService, db *sql.DB) *LedgerService {
+	return &LedgerService{
+		ledgerRepo: ledgerRepo,
+		inventory:  inventory,
+		db:         db,
+	}
+}
+
+// ListOrganizations returns the organizations that have a ledger to check
+func (s *LedgerService) ListOrganizations(ctx context.Context) ([]uuid.UUID, error) {
+	return s.ledgerRepo.ListOrganizations(ctx)
+}
+
+// Check replays the ledger of every item of the organization and reports
+// where it does not account for the stock
+func (s *LedgerService) Check(ctx context.Context, orgID uuid.UUID) (*domain.LedgerCheck, error) {
+	return s.check(ctx, orgID, nil)
+}
+
+// Repair checks the organization's ledger and posts, as userID, a movement
+// closing each issue found. The repairs commit together.
+func (s *LedgerService) Repair(ctx context.Context, orgID, userID uuid.UUID) (*domain.LedgerCheck, error) {
+	var check *domain.LedgerCheck
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		var err error
+		check, err = s.check(ctx, orgID, &userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// check replays the organization's ledger, repairing it as repairAs when
+// set
+func (s *LedgerService) check(ctx context.Context, orgID uuid.UUID, repairAs *uuid.UUID) (*domain.LedgerCheck, error) {
+	now := time.Now().UTC()
+	items, err := s.ledgerRepo.ListItems(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &domain.LedgerCheck{
+		OrganizationID: orgID,
+		CheckedAt:      now,
+		ItemsChecked:   len(items),
+		Repaired:       repairAs != nil,
+		Issues:         []*domain.LedgerIssue{},
+	}
+	for _, item := range items {
+		movements, err := s.ledgerRepo.ListMovements(ctx, item.ID)
+		if err != nil {
+			return nil, err
+		}
+		check.MovementsChecked += len(movements)
+
+		issues := replayLedger(item, ledgerOrder(movements), now)
+		if item.LocationStock != item.CurrentStock {
+			issues = append(issues, &domain.LedgerIssue{
+				Type:     domain.LedgerIssueLocationMismatch,
+				ItemID:   item.ID,
+				ItemName: item.Name,
+				Expected: item.CurrentStock,
+				Actual:   item.LocationStock,
+			})
+		}
+		if len(issues) == 0 {
+			continue
+		}
+		if err := s.planRepairs(ctx, orgID, item, issues, repairAs); err != nil {
+			return nil, err
+		}
+		check.Issues = append(check.Issues, issues...)
+	}
+
+	return check, nil
+}
+
+// planRepairs plans the movements repairing an item's issues through the
+// stock planner and, when repairAs is set, posts them as repairAs
+func (s *LedgerService) planRepairs(ctx context.Context, orgID uuid.UUID, ledgerItem *domain.LedgerItem, issues []*domain.LedgerIssue, repairAs *uuid.UUID) error {
+	item, err := s.inventory.itemRepo.GetByID(ctx, ledgerItem.ID)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrItemNotFound
+	}
+
+	plan := s.inventory.newStockPlan(orgID)
+	if err := plan.addItem(ctx, item); err != nil {
+		return err
+	}
+	reference := domain.LedgerRepairReference
+	for _, issue := range issues {
+		if issue.Type != domain.LedgerIssueLocationMismatch {
+			if err := plan.closeLedger(ctx, issue.Repair); err != nil {
+				return err
+			}
+			continue
+		}
+
+		movements, err := plan.reconcile(ctx, item.ID)
+		if err != nil {
+			return err
+		}
+		note := "Stock levels reconciled with the item's stock"
+		for _, movement := range movements {
+			movement.Reference = &reference
+			movement.Notes = &note
+		}
+		issue.Repair = movements[0]
+	}
+
+	if repairAs == nil {
+		return nil
+	}
+	for _, movement := range plan.movements {
+		movement.CreatedBy = *repairAs
+	}
+	return plan.apply(ctx)
+}
+
+// replayLedger walks an item's movements from zero and returns an issue,
+// with the movement that would repair it, for every place the ledger does
+// not account for the stock
+func replayLedger(item *domain.LedgerItem, movements []*domain.StockMovement, now time.Time) []*domain.LedgerIssue {
+	var issues []*domain.LedgerIssue
+	issue := func(issueType domain.LedgerIssueType, at *domain.StockMovement, expected, actual int, repairAt time.Time, note string) {
+		reference := domain.LedgerRepairReference
+		found := &domain.LedgerIssue{
+			Type:     issueType,
+			ItemID:   item.ID,
+			ItemName: item.Name,
+			Expected: expected,
+			Actual:   actual,
+			Repair: &domain.StockMovement{
+				ItemID:        item.ID,
+				MovementType:  domain.MovementTypeAdjustment,
+				Quantity:      actual,
+				PreviousStock: expected,
+				NewStock:      actual,
+				Reference:     &reference,
+				Notes:         &note,
+				CreatedAt:     repairAt,
+				RecordedAt:    repairAt,
+			},
+		}
+		if at != nil {
+			found.MovementID = &at.ID
+		}
+		issues = append(issues, found)
+	}
+
+	stock := 0
+	var last *domain.StockMovement
+	for _, mv := range movements {
+		if mv.PreviousStock != stock {
+			if last == nil {
+				// The opening balance goes in when the item was created, or
+				// just before its first movement if that was earlier
+				at := item.CreatedAt
+				if !at.Before(mv.CreatedAt) {
+					at = mv.CreatedAt.Add(-time.Second)
+				}
+				issue(domain.LedgerIssueGap, mv, stock, mv.PreviousStock, at, "Opening balance")
+			} else {
+				at := last.CreatedAt.Add(mv.CreatedAt.Sub(last.CreatedAt) / 2)
+				issue(domain.LedgerIssueBreak, mv, stock, mv.PreviousStock, at, "Stock moved without a movement")
+			}
+		}
+		stock = mv.NewStock
+		last = mv
+	}
+
+	switch {
+	case last == nil && item.CurrentStock != 0:
+		issue(domain.LedgerIssueGap, nil, 0, item.CurrentStock, item.CreatedAt, "Opening balance")
+	case last != nil && stock != item.CurrentStock:
+		issue(domain.LedgerIssueMismatch, last, stock, item.CurrentStock, now, "Stock moved without a movement")
+	}
+	return issues
+}
+
+// ledgerOrder orders movements recorded at the same time so that each starts
+// where the one before it ended, where they can. Movements are otherwise in
+// the order they were recorded.
+func ledgerOrder(movements []*domain.StockMovement) []*domain.StockMovement {
+	ordered := make([]*domain.StockMovement, 0, len(movements))
+	stock := 0
+	for start := 0; start < len(movements); {
+		end := start + 1
+		for end < len(movements) && movements[end].CreatedAt.Equal(movements[start].CreatedAt) {
+			end++
+		}
+
+		group := append([]*domain.StockMovement(nil), movements[start:end]...)
+		for len(group) > 0 {
+			next := 0
+			for i, mv := range group {
+				if mv.PreviousStock == stock {
+					next = i
+					break
+				}
+			}
+			ordered = append(ordered, group[next])
+			stock = group[next].NewStock
+			group = append(group[:next], group[next+1:]...)
+		}
+		start = end
+	}
+	return ordered
+}
+
+// isLedgerRepair reports whether a movement was posted to repair the ledger
+func isLedgerRepair(mv *domain.StockMovement) bool {
+	return mv.MovementType == domain.MovementTypeAdjustment && mv.Reference != nil && *mv.Reference == domain.LedgerRepairReference
+}
@@ -0,0 +1,237 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockLedgerRepo returns fixed items and their movements, oldest first
+type mockLedgerRepo struct {
+	items     []*domain.LedgerItem
+	movements map[uuid.UUID][]*domain.StockMovement
+}
+
+func (m *mockLedgerRepo) ListOrganizations(ctx context.Context) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerRepo) ListItems(ctx context.Context, orgID uuid.UUID) ([]*domain.LedgerItem, error) {
+	return m.items, nil
+}
+
+func (m *mockLedgerRepo) ListMovements(ctx context.Context, itemID uuid.UUID) ([]*domain.StockMovement, error) {
+	return m.movements[itemID], nil
+}
+
+func TestLedgerService_Check_FindsGapsBreaksAndMismatches(t *testing.T) {
+	ctx := context.Background()
+	orgID, adminID := uuid.New(), uuid.New()
+	day := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+
+	rice := &domain.LedgerItem{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", CurrentStock: 4000, LocationStock: 4000, CreatedAt: day}
+	salt := &domain.LedgerItem{ID: uuid.New(), OrganizationID: orgID, Name: "Salt", CurrentStock: 500, LocationStock: 500, CreatedAt: day}
+	sugar := &domain.LedgerItem{ID: uuid.New(), OrganizationID: orgID, Name: "Sugar", CurrentStock: 100, LocationStock: 100, CreatedAt: day}
+	movement := func(itemID uuid.UUID, previous, next int, at time.Time) *domain.StockMovement {
+		return &domain.StockMovement{ID: uuid.New(), ItemID: itemID, PreviousStock: previous, NewStock: next, CreatedAt: at}
+	}
+	breakAt := movement(rice.ID, 2200, 3200, day.AddDate(0, 0, 4))
+	ledger := &mockLedgerRepo{
+		items: []*domain.LedgerItem{rice, salt, sugar},
+		movements: map[uuid.UUID][]*domain.StockMovement{
+			rice.ID: {
+				// 1000 g were there before the first movement
+				movement(rice.ID, 1000, 3000, day.AddDate(0, 0, 1)),
+				movement(rice.ID, 3000, 2500, day.AddDate(0, 0, 2)),
+				// Recorded at the same time and listed out of order
+				movement(rice.ID, 2700, 2000, day.AddDate(0, 0, 3)),
+				movement(rice.ID, 2500, 2700, day.AddDate(0, 0, 3)),
+				// 200 g appeared between these two, and 800 g after the last
+				breakAt,
+			},
+			sugar.ID: {movement(sugar.ID, 0, 100, day)},
+		},
+	}
+	movements := &recordingMovementRepo{}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	locations := newMockLocationRepo()
+	service := services.NewLedgerService(ledger, newLedgerInventory(orgID, ledger.items, movements, locations, newMockStockLevelRepo(), newMockCostingRepo()), db)
+
+	check, err := service.Check(ctx, orgID)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if check.ItemsChecked != 3 || check.MovementsChecked != 6 || check.Repaired || len(movements.created) != 0 {
+		t.Fatalf("expected 3 items and 6 movements checked without repairs, got %+v", check)
+	}
+	if len(check.Issues) != 4 {
+		t.Fatalf("expected 4 issues, got %d", len(check.Issues))
+	}
+
+	gap, broken, mismatch, unopened := check.Issues[0], check.Issues[1], check.Issues[2], check.Issues[3]
+	if gap.Type != domain.LedgerIssueGap || gap.Expected != 0 || gap.Actual != 1000 || !gap.Repair.CreatedAt.Equal(day) {
+		t.Errorf("expected an opening balance of 1000 when rice was created, got %+v", gap)
+	}
+	if broken.Type != domain.LedgerIssueBreak || *broken.MovementID != breakAt.ID || broken.Expected != 2000 || broken.Actual != 2200 ||
+		!broken.Repair.CreatedAt.Equal(day.AddDate(0, 0, 3).Add(12*time.Hour)) {
+		t.Errorf("expected a break from 2000 to 2200 bridged halfway, got %+v", broken)
+	}
+	if mismatch.Type != domain.LedgerIssueMismatch || mismatch.Expected != 3200 || mismatch.Actual != 4000 {
+		t.Errorf("expected the ledger to end at 3200 instead of 4000, got %+v", mismatch)
+	}
+	if unopened.Type != domain.LedgerIssueGap || unopened.ItemID != salt.ID || unopened.MovementID != nil || unopened.Actual != 500 {
+		t.Errorf("expected salt to have stock without movements, got %+v", unopened)
+	}
+
+	repaired, err := service.Repair(ctx, orgID, adminID)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if !repaired.Repaired || len(movements.created) != 4 {
+		t.Fatalf("expected 4 repairs posted, got %d", len(movements.created))
+	}
+	defaultLocation, _ := locations.GetDefault(ctx, orgID)
+	for _, mv := range movements.created {
+		if mv.MovementType != domain.MovementTypeAdjustment || mv.LocationID == nil || *mv.LocationID != defaultLocation.ID ||
+			mv.CreatedBy != adminID || mv.Reference == nil || *mv.Reference != domain.LedgerRepairReference || mv.Quantity != mv.NewStock {
+			t.Errorf("expected an ADJUSTMENT at the default location posted by the admin, got %+v", mv)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the repairs in one transaction: %v", err)
+	}
+}
+
+func TestLedgerService_Repair_ReconcilesStockLevelsAndCostLayers(t *testing.T) {
+	ctx := context.Background()
+	orgID, adminID := uuid.New(), uuid.New()
+	day := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+
+	// Flour's levels hold 300 pcs more than its stock, all in the kitchen,
+	// and so do its cost layers. Oil's 500 pcs are in no level or layer.
+	flour := &domain.LedgerItem{ID: uuid.New(), OrganizationID: orgID, Name: "Flour", CurrentStock: 1000, LocationStock: 1300, CreatedAt: day}
+	oil := &domain.LedgerItem{ID: uuid.New(), OrganizationID: orgID, Name: "Oil", CurrentStock: 500, CreatedAt: day}
+	ledger := &mockLedgerRepo{
+		items: []*domain.LedgerItem{flour, oil},
+		movements: map[uuid.UUID][]*domain.StockMovement{
+			flour.ID: {{ID: uuid.New(), ItemID: flour.ID, PreviousStock: 0, NewStock: 1000, CreatedAt: day}},
+			oil.ID:   {{ID: uuid.New(), ItemID: oil.ID, PreviousStock: 0, NewStock: 500, CreatedAt: day}},
+		},
+	}
+
+	locations := newMockLocationRepo()
+	kitchen := &domain.Location{OrganizationID: orgID, Name: "Kitchen", IsActive: true}
+	if _, err := locations.Create(ctx, kitchen); err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	levels := newMockStockLevelRepo()
+	levels.level(flour.ID, kitchen.ID).Quantity = 1300
+	costing := newMockCostingRepo()
+	costing.layers = []*domain.CostLayer{{ID: uuid.New(), ItemID: flour.ID, UnitCost: 1, InitialQuantity: 1300, Quantity: 1300}}
+	movements := &recordingMovementRepo{}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := services.NewLedgerService(ledger, newLedgerInventory(orgID, ledger.items, movements, locations, levels, costing), db)
+
+	check, err := service.Check(ctx, orgID)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(check.Issues) != 2 {
+		t.Fatalf("expected the levels of both items to be reported, got %+v", check.Issues)
+	}
+	if issue := check.Issues[0]; issue.Type != domain.LedgerIssueLocationMismatch || issue.ItemID != flour.ID || issue.Expected != 1000 || issue.Actual != 1300 {
+		t.Errorf("expected flour's levels to add up to 1300 instead of 1000, got %+v", issue)
+	}
+	if issue := check.Issues[1]; issue.Type != domain.LedgerIssueLocationMismatch || issue.ItemID != oil.ID || issue.Actual != 0 {
+		t.Errorf("expected oil to be in no level, got %+v", issue)
+	}
+	if len(movements.created) != 0 || levels.level(flour.ID, kitchen.ID).Quantity != 1300 {
+		t.Fatal("expected a check to change nothing")
+	}
+
+	if _, err := service.Repair(ctx, orgID, adminID); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(movements.created) != 2 {
+		t.Fatalf("expected an ADJUSTMENT per item, got %+v", movements.created)
+	}
+
+	// The kitchen gives up the 300 pcs along with the layer that cost them
+	taken := movements.created[0]
+	if taken.ItemID != flour.ID || *taken.LocationID != kitchen.ID || taken.Quantity != 1000 ||
+		taken.PreviousStock != 1000 || taken.NewStock != 1000 || *taken.TotalCost != -300 {
+		t.Errorf("expected flour's kitchen level set to 1000 at a cost of -300, got %+v", taken)
+	}
+	if levels.level(flour.ID, kitchen.ID).Quantity != 1000 || costing.layers[0].Quantity != 1000 {
+		t.Errorf("expected 1000 pcs of flour left in the kitchen and its layer, got %d and %d",
+			levels.level(flour.ID, kitchen.ID).Quantity, costing.layers[0].Quantity)
+	}
+
+	// Oil's stock is put at the default location at its unit cost
+	defaultLocation, _ := locations.GetDefault(ctx, orgID)
+	placed := movements.created[1]
+	if placed.ItemID != oil.ID || *placed.LocationID != defaultLocation.ID || placed.Quantity != 500 || *placed.TotalCost != 1000 {
+		t.Errorf("expected 500 pcs of oil worth 1000 at the default location, got %+v", placed)
+	}
+	if levels.level(oil.ID, defaultLocation.ID).Quantity != 500 {
+		t.Errorf("expected oil's level at the default location to be 500, got %d", levels.level(oil.ID, defaultLocation.ID).Quantity)
+	}
+	if len(costing.layers) != 2 || costing.layers[1].ItemID != oil.ID || costing.layers[1].Quantity != 500 {
+		t.Errorf("expected an opening layer of 500 pcs of oil, got %+v", costing.layers)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the repairs in one transaction: %v", err)
+	}
+}
+
+// newLedgerInventory plans repairs over the items of a ledger, measured in
+// pcs; oil costs 2 a piece
+func newLedgerInventory(orgID uuid.UUID, ledgerItems []*domain.LedgerItem, movements *recordingMovementRepo, locations *mockLocationRepo, levels *mockStockLevelRepo, costing *mockCostingRepo) *services.InventoryService {
+	oilCost := 2.0
+	items := newMockItemsRepo()
+	for _, ledgerItem := range ledgerItems {
+		item := &domain.Item{
+			ID: ledgerItem.ID, OrganizationID: orgID, Name: ledgerItem.Name, UnitOfMeasurement: "pcs",
+			CurrentStock: ledgerItem.CurrentStock, IsActive: true, TrackStock: true, CreatedAt: ledgerItem.CreatedAt,
+		}
+		if item.Name == "Oil" {
+			item.UnitCost = &oilCost
+		}
+		items.byID[item.ID] = item
+	}
+	return services.NewInventoryService(
+		items,
+		&mockCategoryRepo{},
+		movements,
+		&mockAlertRepo{},
+		locations,
+		levels,
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		costing,
+		nil,
+	)
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+var (
+	ErrOrganizationNotFound    = errors.New("organization not found")
+	ErrInvalidOrganizationName = errors.New("organization name must not be empty")
+	ErrInvalidSlug             = errors.New("slug must be lowercase letters, digits and dashes, at most 100 characters")
+	ErrSlugExists              = errors.New("slug is already taken")
+	ErrInvalidCurrency         = errors.New("currency must be a 3-letter ISO 4217 code")
+	ErrInvalidTimezone         = errors.New("timezone must be an IANA timezone name")
+	// ErrOrganizationHasMembers means an organization was to be deleted
+	// while other users still belong to it
+	ErrOrganizationHasMembers = errors.New("remove the other members before deleting the organization")
+	// ErrLastOrganization means a user was to be left without an
+	// organization to work in
+	ErrLastOrganization = errors.New("you must belong to another organization first")
+	ErrAlreadyMember    = errors.New("user is already a member of the organization")
+	// ErrRemoveSelf means an admin tried to remove themselves from the
+	// organization
+	ErrRemoveSelf = errors.New("you cannot remove yourself from the organization")
+	// ErrHomeOrganization means a user was to be removed from their home
+	// organization; they are deactivated there instead
+	ErrHomeOrganization = errors.New("users can't be removed from their home organization; deactivate them instead")
+)
+
+var (
+	slugRe        = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugInvalidRe = regexp.MustCompile(`[^a-z0-9]+`)
+	currencyRe    = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// OrganizationService manages the organizations of a group and who belongs
+// to them. Any user may list the organizations they belong to; creating one
+// makes its creator its first admin. Existing users are invited to an
+// organization by email and become members, with a role there, when they
+// next sign in; new people are invited through UserService.
+type OrganizationService struct {
+	orgRepo  repository.OrganizationRepository
+	userRepo repository.UserRepository
+	users    *UserService
+	auth     *AuthService
+	db       *sql.DB
+}
+
+func NewOrganizationService(orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, users *UserService, auth *AuthService, db *sql.DB) *OrganizationService {
+	return &OrganizationService{
+		orgRepo:  orgRepo,
+		userRepo: userRepo,
+		users:    users,
+		auth:     auth,
+		db:       db,
+	}
+}
+
+// Organization methods
+
+// ListOrganizations lists the organizations the user is an active member
+// of, with their role in each
+func (s *OrganizationService) ListOrganizations(ctx context.Context, userID uuid.UUID) ([]*domain.Organization, error) {
+	return s.orgRepo.ListByUser(ctx, userID)
+}
+
+func (s *OrganizationService) GetOrganization(ctx context.Context, id uuid.UUID) (*domain.Organization, error) {
+	org, err := s.orgRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// CreateOrganization creates an organization with userID as its admin
+func (s *OrganizationService) CreateOrganization(ctx context.Context, userID uuid.UUID, req *domain.CreateOrganizationRequest) (*domain.Organization, error) {
+	org := &domain.Organization{
+		Name: strings.TrimSpace(req.Name),
+		Slug: strings.TrimSpace(req.Slug),
+		Role: domain.RoleAdmin,
+	}
+	if org.Name == "" {
+		return nil, ErrInvalidOrganizationName
+	}
+	if org.Slug == "" {
+		org.Slug = strings.Trim(slugInvalidRe.ReplaceAllString(strings.ToLower(org.Name), "-"), "-")
+	}
+	if !validSlug(org.Slug) {
+		return nil, ErrInvalidSlug
+	}
+	org.Settings = domain.DefaultOrganizationSettings
+	if req.Settings != nil {
+		if err := applySettings(&org.Settings, req.Settings); err != nil {
+			return nil, err
+		}
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		if err := s.checkSlugFree(ctx, org.Slug, uuid.Nil); err != nil {
+			return err
+		}
+		if _, err := s.orgRepo.Create(ctx, org); err != nil {
+			return err
+		}
+		return s.orgRepo.AddMember(ctx, &domain.Membership{
+			OrganizationID: org.ID,
+			UserID:         userID,
+			Role:           domain.RoleAdmin,
+			IsActive:       true,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// UpdateOrganization changes the organization's name, slug and settings
+func (s *OrganizationService) UpdateOrganization(ctx context.Context, id uuid.UUID, req *domain.UpdateOrganizationRequest) (*domain.Organization, error) {
+	var org *domain.Organization
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		var err error
+		if org, err = s.GetOrganization(ctx, id); err != nil {
+			return err
+		}
+
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				return ErrInvalidOrganizationName
+			}
+			org.Name = name
+		}
+		if req.Slug != nil {
+			slug := strings.TrimSpace(*req.Slug)
+			if !validSlug(slug) {
+				return ErrInvalidSlug
+			}
+			if err := s.checkSlugFree(ctx, slug, org.ID); err != nil {
+				return err
+			}
+			org.Slug = slug
+		}
+		if req.Settings != nil {
+			if err := applySettings(&org.Settings, req.Settings); err != nil {
+				return err
+			}
+		}
+
+		return s.orgRepo.Update(ctx, org)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// DeleteOrganization deletes the organization with everything it holds.
+// Only its last member, userID, can delete it, and only while they belong to
+// another organization, which becomes their home organization if this one
+// was. Their access tokens expire and a session is started for them in that
+// other organization; the user is returned as a member of it.
+func (s *OrganizationService) DeleteOrganization(ctx context.Context, id, userID uuid.UUID) (*domain.AuthTokens, *domain.User, error) {
+	var tokens *domain.AuthTokens
+	var member *domain.User
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		if _, err := s.GetOrganization(ctx, id); err != nil {
+			return err
+		}
+		members, err := s.orgRepo.CountMembers(ctx, id)
+		if err != nil {
+			return err
+		}
+		if members > 1 {
+			return ErrOrganizationHasMembers
+		}
+
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+		orgs, err := s.orgRepo.ListByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		var next *domain.Organization
+		for _, org := range orgs {
+			if org.ID != id {
+				next = org
+				break
+			}
+		}
+		if next == nil {
+			return ErrLastOrganization
+		}
+		if user.OrganizationID == id {
+			if err := s.userRepo.SetHomeOrganization(ctx, userID, next.ID, next.Role); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orgRepo.Delete(ctx, id); err != nil {
+			return err
+		}
+
+		if err := s.auth.ExpireAccessTokens(ctx, userID); err != nil {
+			return err
+		}
+		if member, err = s.auth.member(ctx, next.ID, userID); err != nil {
+			return err
+		}
+		tokens, err = s.auth.issueTokens(ctx, member, uuid.New())
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, member, nil
+}
+
+// checkSlugFree returns ErrSlugExists when an organization other than id
+// has the slug
+func (s *OrganizationService) checkSlugFree(ctx context.Context, slug string, id uuid.UUID) error {
+	existing, err := s.orgRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != id {
+		return ErrSlugExists
+	}
+	return nil
+}
+
+// Member methods
+
+// AddMember invites the account of the email, as invitedBy, to join the
+// organization with a role, USER unless given. The account accepts the
+// invitation when its user next signs in or refreshes their session, so
+// nobody is added without signing in, and the invitation is the same whether
+// or not the email has an account. Only a member of the organization is
+// refused, with ErrAlreadyMember.
+func (s *OrganizationService) AddMember(ctx context.Context, orgID, invitedBy uuid.UUID, req *domain.AddMemberRequest) (*domain.UserInvitation, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		return nil, ErrInvalidEmail
+	}
+	role := req.Role
+	if role == "" {
+		role = domain.RoleUser
+	}
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	email := strings.ToLower(addr.Address)
+
+	var invitation *domain.UserInvitation
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if user != nil {
+			existing, err := s.orgRepo.GetMember(ctx, orgID, user.ID)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return ErrAlreadyMember
+			}
+		}
+
+		created, err := s.users.invite(ctx, orgID, invitedBy, email, role)
+		if err != nil {
+			return err
+		}
+		invitation = created.UserInvitation
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// RemoveMember removes a user from the admin actorID's organization. Their
+// access tokens expire, and their session in the organization ends at the
+// next refresh.
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, actorID, userID uuid.UUID) error {
+	if userID == actorID {
+		return ErrRemoveSelf
+	}
+
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		member, err := s.userRepo.GetMember(ctx, orgID, userID)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return ErrUserNotFound
+		}
+		account, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if account.OrganizationID == orgID {
+			return ErrHomeOrganization
+		}
+
+		if err := s.orgRepo.RemoveMember(ctx, orgID, userID); err != nil {
+			return err
+		}
+		return s.auth.ExpireAccessTokens(ctx, userID)
+	})
+}
+
+// applySettings applies the settings changes to settings, validating them
+func applySettings(settings *domain.OrganizationSettings, req *domain.UpdateOrganizationSettings) error {
+	if req.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyRe.MatchString(currency) {
+			return ErrInvalidCurrency
+		}
+		settings.Currency = currency
+	}
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		if timezone == "" || strings.EqualFold(timezone, "local") {
+			return ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+		settings.Timezone = timezone
+	}
+	if req.CostingMethod != nil {
+		switch *req.CostingMethod {
+		case domain.CostingFIFO, domain.CostingWeightedAverage:
+		default:
+			return ErrInvalidCostingMethod
+		}
+		settings.CostingMethod = *req.CostingMethod
+	}
+	return nil
+}
+
+func validSlug(slug string) bool {
+	return len(slug) <= 100 && slugRe.MatchString(slug)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrAdminPermissionsFixed means an organization tried to change what
+	// admins may do; admins always hold every permission
+	ErrAdminPermissionsFixed = errors.New("admin permissions can't be changed")
+	// ErrPermissionAdminOnly means an organization tried to grant a
+	// permission only admins may hold to another role
+	ErrPermissionAdminOnly = errors.New("only admins can hold users.manage and settings.manage")
+)
+
+// PermissionService resolves what each role of an organization may do. A
+// role holds its default permissions, as domain.DefaultPermissions defines
+// them, with the organization's overrides applied on top. Overrides are
+// stored as differences from the defaults, so a default that changes in a
+// later release reaches every organization that left it alone.
+type PermissionService struct {
+	permissionRepo repository.PermissionRepository
+	db             *sql.DB
+}
+
+func NewPermissionService(permissionRepo repository.PermissionRepository, db *sql.DB) *PermissionService {
+	return &PermissionService{
+		permissionRepo: permissionRepo,
+		db:             db,
+	}
+}
+
+// RolePermissions returns the permissions a role of the organization holds
+func (s *PermissionService) RolePermissions(ctx context.Context, orgID uuid.UUID, role domain.UserRole) (domain.PermissionSet, error) {
+	set := domain.DefaultPermissions(role)
+	if role == domain.RoleAdmin {
+		return set, nil
+	}
+
+	overrides, err := s.permissionRepo.ListRoleOverrides(ctx, orgID, role)
+	if err != nil {
+		return nil, err
+	}
+	applyOverrides(set, overrides)
+	return set, nil
+}
+
+// Matrix returns the organization's permissions of every role
+func (s *PermissionService) Matrix(ctx context.Context, orgID uuid.UUID) (*domain.PermissionMatrix, error) {
+	overrides, err := s.permissionRepo.ListOverrides(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	byRole := map[domain.UserRole][]*domain.PermissionOverride{}
+	for _, o := range overrides {
+		byRole[o.Role] = append(byRole[o.Role], o)
+	}
+
+	matrix := &domain.PermissionMatrix{Permissions: domain.Permissions}
+	for _, role := range domain.Roles {
+		matrix.Roles = append(matrix.Roles, rolePermissions(role, byRole[role]))
+	}
+	return matrix, nil
+}
+
+// UpdateRole sets every permission the role of the organization holds.
+// Permissions matching the role's default are stored as no override.
+func (s *PermissionService) UpdateRole(ctx context.Context, orgID uuid.UUID, role domain.UserRole, permissions []domain.Permission) (*domain.RolePermissions, error) {
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if role == domain.RoleAdmin {
+		return nil, ErrAdminPermissionsFixed
+	}
+
+	wanted := domain.PermissionSet{}
+	for _, p := range permissions {
+		if !p.IsValid() {
+			return nil, ErrUnknownPermission
+		}
+		if p.AdminOnly() {
+			return nil, ErrPermissionAdminOnly
+		}
+		wanted[p] = true
+	}
+
+	defaults := domain.DefaultPermissions(role)
+	var overrides []*domain.PermissionOverride
+	for _, info := range domain.Permissions {
+		p := info.Permission
+		if wanted.Has(p) != defaults.Has(p) {
+			overrides = append(overrides, &domain.PermissionOverride{Role: role, Permission: p, Granted: wanted.Has(p)})
+		}
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		return s.permissionRepo.ReplaceRoleOverrides(ctx, orgID, role, overrides)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rolePermissions(role, overrides), nil
+}
+
+// rolePermissions applies a role's overrides to its defaults
+func rolePermissions(role domain.UserRole, overrides []*domain.PermissionOverride) *domain.RolePermissions {
+	set := domain.DefaultPermissions(role)
+	if role == domain.RoleAdmin {
+		overrides = nil
+	}
+	applyOverrides(set, overrides)
+
+	rp := &domain.RolePermissions{
+		Role:        role,
+		Permissions: set.List(),
+		Overridden:  []domain.Permission{},
+	}
+	for _, o := range overrides {
+		rp.Overridden = append(rp.Overridden, o.Permission)
+	}
+	return rp
+}
+
+func applyOverrides(set domain.PermissionSet, overrides []*domain.PermissionOverride) {
+	for _, o := range overrides {
+		if o.Permission.IsValid() && !(o.Granted && o.Permission.AdminOnly()) {
+			set[o.Permission] = o.Granted
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+var (
+	ErrPOSMappingNotFound = errors.New("POS mapping not found")
+	ErrInvalidPOSCode     = errors.New("code is required")
+	// ErrInvalidSalesFile means a sales file is not CSV or lacks a required column
+	ErrInvalidSalesFile = errors.New("sales file must be CSV with bill, code, quantity and timestamp columns")
+	ErrEmptySalesFile   = errors.New("sales file has no rows")
+	// ErrUnmappedCodes means a sales file sells dish codes that map to no
+	// recipe; the import result lists them
+	ErrUnmappedCodes = errors.New("sales file has dish codes without a mapping")
+	// ErrImportRejected means rows or bills of a sales file failed; the
+	// import result lists them and nothing was posted
+	ErrImportRejected = errors.New("sales import rejected")
+)
+
+// errDryRun rolls back the transaction of a dry run once it has been previewed
+var errDryRun = errors.New("dry run")
+
+// salesColumns lists the accepted header names of each column of a sales file
+var salesColumns = map[string][]string{
+	"bill":      {"bill", "bill_number", "bill_no"},
+	"code":      {"code", "dish_code"},
+	"quantity":  {"quantity", "qty"},
+	"timestamp": {"timestamp", "time", "date"},
+}
+
+var salesTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// POSImportService maps POS dish codes to recipes and posts the ingredient
+// movements of the sales files exported by the POS
+type POSImportService struct {
+	mappingRepo repository.POSMappingRepository
+	importRepo  repository.POSImportRepository
+	recipeRepo  repository.RecipeRepository
+	recipes     *RecipeService
+	db          *sql.DB
+}
+
+func NewPOSImportService(mappingRepo repository.POSMappingRepository, importRepo repository.POSImportRepository, recipeRepo repository.RecipeRepository, recipes *RecipeService, db *sql.DB) *POSImportService {
+	return &POSImportService{
+		mappingRepo: mappingRepo,
+		importRepo:  importRepo,
+		recipeRepo:  recipeRepo,
+		recipes:     recipes,
+		db:          db,
+	}
+}
+
+func (s *POSImportService) ListMappings(ctx context.Context, orgID uuid.UUID) ([]*domain.POSMapping, error) {
+	return s.mappingRepo.List(ctx, orgID)
+}
+
+// SetMapping maps the dish code to a recipe of the organization, replacing
+// any previous mapping of the code
+func (s *POSImportService) SetMapping(ctx context.Context, orgID uuid.UUID, code string, req *domain.SetPOSMappingRequest) (*domain.POSMapping, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, ErrInvalidPOSCode
+	}
+
+	portions := 1.0
+	if req.Portions != nil {
+		portions = *req.Portions
+	}
+	if portions <= 0 {
+		return nil, ErrInvalidPortions
+	}
+
+	recipe, err := s.recipeRepo.GetByID(ctx, req.RecipeID)
+	if err != nil {
+		return nil, err
+	}
+	if recipe == nil || recipe.OrganizationID != orgID {
+		return nil, ErrRecipeNotFound
+	}
+
+	mapping := &domain.POSMapping{
+		OrganizationID: orgID,
+		Code:           code,
+		RecipeID:       recipe.ID,
+		Portions:       portions,
+	}
+	if err := s.mappingRepo.Upsert(ctx, mapping); err != nil {
+		return nil, err
+	}
+	return s.mappingRepo.GetByCode(ctx, orgID, code)
+}
+
+func (s *POSImportService) DeleteMapping(ctx context.Context, orgID uuid.UUID, code string) error {
+	mapping, err := s.mappingRepo.GetByCode(ctx, orgID, strings.TrimSpace(code))
+	if err != nil {
+		return err
+	}
+	if mapping == nil {
+		return ErrPOSMappingNotFound
+	}
+	return s.mappingRepo.Delete(ctx, orgID, mapping.Code)
+}
+
+// Import posts the sales of a POS export. The rows of each bill are mapped
+// to recipes and recorded as one sale whose movements carry the bill number
+// as their reference. A bill that was imported before is skipped, so
+// importing the same file twice posts it once.
+//
+// Every bill is posted in a single transaction: when a row cannot be read or
+// a bill cannot be depleted, nothing is posted and ErrImportRejected is
+// returned with the result listing the errors. Codes without a mapping
+// reject the file with ErrUnmappedCodes unless req.SkipUnmapped is set, in
+// which case bills with such codes are held: neither posted nor marked
+// imported, so importing the file again once the codes are mapped posts
+// them whole. Movements are dated at the last sale of their bill. A dry run
+// goes through the same steps, then rolls back and returns the preview with
+// any errors in it.
+func (s *POSImportService) Import(ctx context.Context, orgID, userID uuid.UUID, file io.Reader, req *domain.POSImportRequest) (*domain.POSImportResult, error) {
+	rows, rowErrors, err := parseSalesFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		return nil, ErrEmptySalesFile
+	}
+
+	result := &domain.POSImportResult{
+		DryRun:        req.DryRun,
+		Rows:          len(rows) + len(rowErrors),
+		PostedBills:   []string{},
+		SkippedBills:  []string{},
+		HeldBills:     []string{},
+		UnmappedCodes: []domain.POSUnmappedCode{},
+		Errors:        rowErrors,
+		Movements:     []*domain.StockMovement{},
+	}
+	if result.Errors == nil {
+		result.Errors = []domain.POSImportError{}
+	}
+
+	mappings, err := s.mappingRepo.List(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]*domain.POSMapping, len(mappings))
+	for _, mapping := range mappings {
+		byCode[mapping.Code] = mapping
+	}
+
+	bills := newBillSales()
+	unmapped := make(map[string]int)
+	for _, row := range rows {
+		if result.From == nil || row.SoldAt.Before(*result.From) {
+			soldAt := row.SoldAt
+			result.From = &soldAt
+		}
+		if result.To == nil || row.SoldAt.After(*result.To) {
+			soldAt := row.SoldAt
+			result.To = &soldAt
+		}
+
+		mapping, ok := byCode[row.Code]
+		if !ok {
+			bills.hold(row.BillNumber)
+			i, seen := unmapped[row.Code]
+			if !seen {
+				i = len(result.UnmappedCodes)
+				unmapped[row.Code] = i
+				result.UnmappedCodes = append(result.UnmappedCodes, domain.POSUnmappedCode{Code: row.Code})
+			}
+			result.UnmappedCodes[i].Rows++
+			result.UnmappedCodes[i].Quantity += row.Quantity
+			continue
+		}
+		bills.add(row.BillNumber, mapping.RecipeID, row.Quantity*mapping.Portions, row.SoldAt)
+	}
+
+	if len(result.UnmappedCodes) > 0 && !req.DryRun && !req.SkipUnmapped {
+		return result, ErrUnmappedCodes
+	}
+
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		locationReported := false
+
+		for _, bill := range bills.order {
+			if bills.held[bill] {
+				result.HeldBills = append(result.HeldBills, bill)
+				continue
+			}
+			imported, err := s.importRepo.MarkBillImported(ctx, orgID, bill, userID)
+			if err != nil {
+				return err
+			}
+			if !imported {
+				result.SkippedBills = append(result.SkippedBills, bill)
+				continue
+			}
+
+			reference := bill
+			movements, err := s.recipes.RecordSales(ctx, orgID, bills.sales[bill], req.LocationID, userID, &reference, nil, bills.soldAt[bill])
+			var bulkErr *BulkAdjustError
+			switch {
+			case errors.As(err, &bulkErr):
+				for _, line := range bulkErr.Lines {
+					if line.Field == "locationId" {
+						if !locationReported {
+							result.Errors = append(result.Errors, domain.POSImportError{Field: line.Field, Message: line.Message})
+							locationReported = true
+						}
+						continue
+					}
+					result.Errors = append(result.Errors, domain.POSImportError{
+						Field:   fmt.Sprintf("bills[%s].%s", bill, line.Field),
+						Message: line.Message,
+					})
+				}
+				continue
+			case err == ErrRecipeInactive || err == ErrInvalidPortions:
+				result.Errors = append(result.Errors, domain.POSImportError{
+					Field:   fmt.Sprintf("bills[%s]", bill),
+					Message: err.Error(),
+				})
+				continue
+			case err != nil:
+				return err
+			}
+
+			result.PostedBills = append(result.PostedBills, bill)
+			result.Movements = append(result.Movements, movements...)
+		}
+
+		if req.DryRun {
+			return errDryRun
+		}
+		if len(result.Errors) > 0 {
+			return ErrImportRejected
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return result, nil
+	}
+	if err == ErrImportRejected {
+		result.PostedBills = []string{}
+		result.Movements = []*domain.StockMovement{}
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// billSales sums the portions sold per recipe on each bill, keeping bills and
+// recipes in the order they first appear in the file. A bill is dated by its
+// last row, and held when any of its rows has a code without a mapping.
+type billSales struct {
+	order  []string
+	sales  map[string][]domain.RecipeSale
+	soldAt map[string]*time.Time
+	held   map[string]bool
+}
+
+func newBillSales() *billSales {
+	return &billSales{
+		sales:  make(map[string][]domain.RecipeSale),
+		soldAt: make(map[string]*time.Time),
+		held:   make(map[string]bool),
+	}
+}
+
+func (b *billSales) add(bill string, recipeID uuid.UUID, portions float64, soldAt time.Time) {
+	b.seen(bill)
+	if last := b.soldAt[bill]; last == nil || soldAt.After(*last) {
+		b.soldAt[bill] = &soldAt
+	}
+
+	sales := b.sales[bill]
+	for i := range sales {
+		if sales[i].RecipeID == recipeID {
+			sales[i].Portions += portions
+			return
+		}
+	}
+	b.sales[bill] = append(sales, domain.RecipeSale{RecipeID: recipeID, Portions: portions})
+}
+
+// hold keeps the bill from being posted until all of its codes are mapped
+func (b *billSales) hold(bill string) {
+	b.seen(bill)
+	b.held[bill] = true
+}
+
+func (b *billSales) seen(bill string) {
+	if _, ok := b.sales[bill]; !ok && !b.held[bill] {
+		b.order = append(b.order, bill)
+		b.sales[bill] = nil
+	}
+}
+
+// parseSalesFile reads a CSV sales export. Columns are found by header name,
+// in any order and case. Rows that cannot be read are returned as errors
+// naming their line in the file; an unreadable file or missing column is
+// ErrInvalidSalesFile.
+func parseSalesFile(file io.Reader) ([]domain.POSSaleRow, []domain.POSImportError, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, ErrEmptySalesFile
+	}
+	if err != nil {
+		return nil, nil, salesFileError(err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for column, names := range salesColumns {
+			for _, accepted := range names {
+				if name == accepted {
+					if _, ok := columns[column]; !ok {
+						columns[column] = i
+					}
+				}
+			}
+		}
+	}
+	if len(columns) < len(salesColumns) {
+		return nil, nil, ErrInvalidSalesFile
+	}
+
+	var rows []domain.POSSaleRow
+	var rowErrors []domain.POSImportError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, salesFileError(err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i := columns[column]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		row := domain.POSSaleRow{
+			Line:       line,
+			BillNumber: field("bill"),
+			Code:       field("code"),
+		}
+		rowErr := func(column, message string) {
+			rowErrors = append(rowErrors, domain.POSImportError{
+				Field:   fmt.Sprintf("lines[%d].%s", line, column),
+				Message: message,
+			})
+		}
+		valid := true
+
+		if row.BillNumber == "" {
+			rowErr("bill", "bill number is required")
+			valid = false
+		}
+		if row.Code == "" {
+			rowErr("code", "dish code is required")
+			valid = false
+		}
+		quantity, err := strconv.ParseFloat(field("quantity"), 64)
+		if err != nil || quantity <= 0 {
+			rowErr("quantity", "quantity must be a positive number")
+			valid = false
+		}
+		row.Quantity = quantity
+		soldAt, ok := parseSaleTime(field("timestamp"))
+		if !ok {
+			rowErr("timestamp", "timestamp must look like 2006-01-02 15:04:05 or RFC 3339")
+			valid = false
+		}
+		row.SoldAt = soldAt
+
+		if valid {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, rowErrors, nil
+}
+
+// salesFileError reports malformed CSV as ErrInvalidSalesFile and passes on
+// errors reading the upload itself
+func salesFileError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return ErrInvalidSalesFile
+	}
+	return err
+}
+
+func parseSaleTime(value string) (time.Time, bool) {
+	for _, layout := range salesTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
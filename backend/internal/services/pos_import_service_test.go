@@ -0,0 +1,320 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockPOSMappingRepo keeps mappings in memory, keyed by code
+type mockPOSMappingRepo struct {
+	mappings map[string]*domain.POSMapping
+}
+
+func (m *mockPOSMappingRepo) Upsert(ctx context.Context, mapping *domain.POSMapping) error {
+	copied := *mapping
+	m.mappings[mapping.Code] = &copied
+	return nil
+}
+
+func (m *mockPOSMappingRepo) GetByCode(ctx context.Context, orgID uuid.UUID, code string) (*domain.POSMapping, error) {
+	mapping, ok := m.mappings[code]
+	if !ok || mapping.OrganizationID != orgID {
+		return nil, nil
+	}
+	return mapping, nil
+}
+
+func (m *mockPOSMappingRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.POSMapping, error) {
+	var mappings []*domain.POSMapping
+	for _, mapping := range m.mappings {
+		if mapping.OrganizationID == orgID {
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+func (m *mockPOSMappingRepo) Delete(ctx context.Context, orgID uuid.UUID, code string) error {
+	delete(m.mappings, code)
+	return nil
+}
+
+// mockPOSImportRepo records imported bills in memory
+type mockPOSImportRepo struct {
+	bills map[string]bool
+}
+
+func (m *mockPOSImportRepo) MarkBillImported(ctx context.Context, orgID uuid.UUID, billNumber string, userID uuid.UUID) (bool, error) {
+	key := orgID.String() + "/" + billNumber
+	if m.bills[key] {
+		return false, nil
+	}
+	m.bills[key] = true
+	return true, nil
+}
+
+const posSalesFile = `Bill_No,Dish_Code,Qty,Timestamp
+B1,PBM,2,2026-10-15 20:15:00
+B1,PBM-H,1,2026-10-15 20:15:00
+B2,PBM,1,2026-10-15 21:40:00
+`
+
+func TestPOSImportService_Import_PostsEachBillOnce(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// PBM is a plate of paneer butter masala using 150 g of paneer, and
+	// PBM-H half a plate
+	paneer := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", UnitOfMeasurement: "kg", CurrentStock: 5000, TrackStock: true}
+	items := newMockItemsRepo(paneer)
+	recipes := newMockRecipeRepo()
+	dish := &domain.Recipe{
+		ID: uuid.New(), OrganizationID: orgID, Name: "Paneer Butter Masala",
+		YieldQuantity: 1, YieldUnit: "pcs", IsActive: true,
+		Components: []*domain.RecipeComponent{{ItemID: &paneer.ID, Quantity: 150, Unit: "kg"}},
+	}
+	recipes.recipes[dish.ID] = dish
+	mappings := &mockPOSMappingRepo{mappings: map[string]*domain.POSMapping{
+		"PBM":   {OrganizationID: orgID, Code: "PBM", RecipeID: dish.ID, Portions: 1},
+		"PBM-H": {OrganizationID: orgID, Code: "PBM-H", RecipeID: dish.ID, Portions: 0.5},
+	}}
+	imports := &mockPOSImportRepo{bills: make(map[string]bool)}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewPOSImportService(mappings, imports, recipes, newRecipeService(db, items, recipes), db)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	result, err := service.Import(ctx, orgID, uuid.New(), strings.NewReader(posSalesFile), &domain.POSImportRequest{})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if strings.Join(result.PostedBills, ",") != "B1,B2" || len(result.Movements) != 2 {
+		t.Fatalf("expected one movement per bill, got bills %v and %d movements", result.PostedBills, len(result.Movements))
+	}
+	// Two and a half plates on B1, one on B2
+	for i, want := range []struct {
+		bill     string
+		quantity int
+		soldAt   time.Time
+	}{
+		{"B1", 375, time.Date(2026, 10, 15, 20, 15, 0, 0, time.UTC)},
+		{"B2", 150, time.Date(2026, 10, 15, 21, 40, 0, 0, time.UTC)},
+	} {
+		movement := result.Movements[i]
+		if movement.Reference == nil || *movement.Reference != want.bill || movement.Quantity != want.quantity {
+			t.Errorf("expected %d g OUT for bill %s, got %d with reference %v", want.quantity, want.bill, movement.Quantity, movement.Reference)
+		}
+		// The sales of the evening are dated then, not when imported
+		if !movement.CreatedAt.Equal(want.soldAt) {
+			t.Errorf("expected bill %s to be dated %v, got %v", want.bill, want.soldAt, movement.CreatedAt)
+		}
+	}
+	if result.From == nil || result.To == nil || result.From.Hour() != 20 || result.To.Hour() != 21 {
+		t.Errorf("expected the file to span 20:15 to 21:40, got %v to %v", result.From, result.To)
+	}
+	if paneer.CurrentStock != 4475 {
+		t.Errorf("expected 4475 g of paneer left, got %d", paneer.CurrentStock)
+	}
+
+	again, err := service.Import(ctx, orgID, uuid.New(), strings.NewReader(posSalesFile), &domain.POSImportRequest{})
+	if err != nil {
+		t.Fatalf("re-import failed: %v", err)
+	}
+	if len(again.PostedBills) != 0 || strings.Join(again.SkippedBills, ",") != "B1,B2" || len(again.Movements) != 0 {
+		t.Errorf("expected every bill to be skipped on re-import, got %+v", again)
+	}
+	if paneer.CurrentStock != 4475 {
+		t.Errorf("expected re-import to leave stock at 4475, got %d", paneer.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPOSImportService_Import_ReportsUnmappedCodes(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// PBM is a plate of paneer butter masala using 150 g of paneer, and
+	// PBM-H half a plate
+	paneer := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", UnitOfMeasurement: "kg", CurrentStock: 5000, TrackStock: true}
+	items := newMockItemsRepo(paneer)
+	recipes := newMockRecipeRepo()
+	dish := &domain.Recipe{
+		ID: uuid.New(), OrganizationID: orgID, Name: "Paneer Butter Masala",
+		YieldQuantity: 1, YieldUnit: "pcs", IsActive: true,
+		Components: []*domain.RecipeComponent{{ItemID: &paneer.ID, Quantity: 150, Unit: "kg"}},
+	}
+	recipes.recipes[dish.ID] = dish
+	mappings := &mockPOSMappingRepo{mappings: map[string]*domain.POSMapping{
+		"PBM":   {OrganizationID: orgID, Code: "PBM", RecipeID: dish.ID, Portions: 1},
+		"PBM-H": {OrganizationID: orgID, Code: "PBM-H", RecipeID: dish.ID, Portions: 0.5},
+	}}
+	imports := &mockPOSImportRepo{bills: make(map[string]bool)}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewPOSImportService(mappings, imports, recipes, newRecipeService(db, items, recipes), db)
+	file := posSalesFile + "B2,CHAI,3,2026-10-15 21:40:00\nB3,CHAI,1,2026-10-15 22:05:00\n"
+
+	// A dry run previews the fully mapped bills and rolls back
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	// The import with skipUnmapped posts them, and the import after CHAI
+	// is mapped posts the rest
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	preview, err := service.Import(ctx, orgID, uuid.New(), strings.NewReader(file), &domain.POSImportRequest{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !preview.DryRun || len(preview.Movements) != 1 || preview.Rows != 5 {
+		t.Fatalf("expected a preview of 5 rows and 1 movement, got %+v", preview)
+	}
+	if strings.Join(preview.HeldBills, ",") != "B2,B3" {
+		t.Errorf("expected the bills selling CHAI to be held, got %v", preview.HeldBills)
+	}
+	if len(preview.UnmappedCodes) != 1 || preview.UnmappedCodes[0] != (domain.POSUnmappedCode{Code: "CHAI", Rows: 2, Quantity: 4}) {
+		t.Errorf("expected CHAI to be summarized as unmapped, got %+v", preview.UnmappedCodes)
+	}
+
+	result, err := service.Import(ctx, orgID, uuid.New(), strings.NewReader(file), &domain.POSImportRequest{})
+	if err != services.ErrUnmappedCodes {
+		t.Fatalf("expected ErrUnmappedCodes, got %v", err)
+	}
+	if len(result.UnmappedCodes) != 1 {
+		t.Errorf("expected the rejected result to list unmapped codes, got %+v", result.UnmappedCodes)
+	}
+
+	// The dry run marked nothing for real, but the in-memory repo cannot
+	// roll back
+	imports.bills = make(map[string]bool)
+
+	stock := paneer.CurrentStock
+	result, err = service.Import(ctx, orgID, uuid.New(), strings.NewReader(file), &domain.POSImportRequest{SkipUnmapped: true})
+	if err != nil {
+		t.Fatalf("Import with skipUnmapped failed: %v", err)
+	}
+	if strings.Join(result.PostedBills, ",") != "B1" || strings.Join(result.HeldBills, ",") != "B2,B3" {
+		t.Errorf("expected only bills whose codes are all mapped to be posted, got %v posted and %v held", result.PostedBills, result.HeldBills)
+	}
+	if used := stock - paneer.CurrentStock; used != 375 {
+		t.Errorf("expected B1 to use 375 g of paneer, got %d", used)
+	}
+
+	// Held bills were not marked imported, so they post whole once CHAI is
+	// mapped
+	mappings.mappings["CHAI"] = &domain.POSMapping{OrganizationID: orgID, Code: "CHAI", RecipeID: dish.ID, Portions: 0.1}
+	stock = paneer.CurrentStock
+	result, err = service.Import(ctx, orgID, uuid.New(), strings.NewReader(file), &domain.POSImportRequest{})
+	if err != nil {
+		t.Fatalf("re-import failed: %v", err)
+	}
+	if strings.Join(result.PostedBills, ",") != "B2,B3" || strings.Join(result.SkippedBills, ",") != "B1" {
+		t.Errorf("expected the held bills to be posted and B1 skipped, got %v posted and %v skipped", result.PostedBills, result.SkippedBills)
+	}
+	// B2 sells a plate and three tenths, B3 a tenth
+	if used := stock - paneer.CurrentStock; used != 210 {
+		t.Errorf("expected the held bills to use 210 g of paneer, got %d", used)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPOSImportService_Import_RejectsBadRowsAndShortStock(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// PBM is a plate of paneer butter masala using 150 g of paneer, and
+	// PBM-H half a plate
+	paneer := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", UnitOfMeasurement: "kg", CurrentStock: 400, TrackStock: true}
+	items := newMockItemsRepo(paneer)
+	recipes := newMockRecipeRepo()
+	dish := &domain.Recipe{
+		ID: uuid.New(), OrganizationID: orgID, Name: "Paneer Butter Masala",
+		YieldQuantity: 1, YieldUnit: "pcs", IsActive: true,
+		Components: []*domain.RecipeComponent{{ItemID: &paneer.ID, Quantity: 150, Unit: "kg"}},
+	}
+	recipes.recipes[dish.ID] = dish
+	mappings := &mockPOSMappingRepo{mappings: map[string]*domain.POSMapping{
+		"PBM":   {OrganizationID: orgID, Code: "PBM", RecipeID: dish.ID, Portions: 1},
+		"PBM-H": {OrganizationID: orgID, Code: "PBM-H", RecipeID: dish.ID, Portions: 0.5},
+	}}
+	imports := &mockPOSImportRepo{bills: make(map[string]bool)}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewPOSImportService(mappings, imports, recipes, newRecipeService(db, items, recipes), db)
+	file := posSalesFile + "B3,PBM,two,2026-10-15 22:05:00\nB4,PBM,1,yesterday\n"
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	result, err := service.Import(ctx, orgID, uuid.New(), strings.NewReader(file), &domain.POSImportRequest{})
+	if err != services.ErrImportRejected {
+		t.Fatalf("expected ErrImportRejected, got %v", err)
+	}
+
+	want := []string{"lines[5].quantity", "lines[6].timestamp", "bills[B2].ingredients[0].quantity"}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), result.Errors)
+	}
+	for i, field := range want {
+		if result.Errors[i].Field != field {
+			t.Errorf("expected error %d on %s, got %+v", i, field, result.Errors[i])
+		}
+	}
+	if len(result.PostedBills) != 0 || len(result.Movements) != 0 {
+		t.Errorf("expected a rejected import to post nothing, got %+v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPOSImportService_Import_RejectsFilesWithoutColumns(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	recipes := newMockRecipeRepo()
+	service := services.NewPOSImportService(&mockPOSMappingRepo{}, &mockPOSImportRepo{}, recipes, newRecipeService(db, newMockItemsRepo(), recipes), db)
+
+	_, err = service.Import(context.Background(), uuid.New(), uuid.New(), strings.NewReader("bill,item,qty\nB1,PBM,1\n"), &domain.POSImportRequest{})
+	if err != services.ErrInvalidSalesFile {
+		t.Errorf("expected ErrInvalidSalesFile, got %v", err)
+	}
+}
@@ -0,0 +1,659 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
+)
+
+var (
+	ErrSupplierNotFound    = errors.New("supplier not found")
+	ErrSupplierNameTaken   = errors.New("a supplier with this name already exists")
+	ErrInvalidSupplierName = errors.New("supplier name is required")
+	ErrInvalidLeadTime     = errors.New("lead time must not be negative")
+	ErrSupplierInactive    = errors.New("supplier is inactive")
+	// ErrSupplierInUse means purchase orders were placed with the supplier
+	ErrSupplierInUse         = errors.New("supplier has purchase orders")
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	// ErrPurchaseOrderNotDraft means an order was changed after it was sent
+	ErrPurchaseOrderNotDraft = errors.New("only draft purchase orders can be changed")
+	// ErrPurchaseOrderNotOpen means goods were received against an order
+	// that is not sent or already fully received
+	ErrPurchaseOrderNotOpen = errors.New("purchase order is not open for receiving")
+	ErrNoOrderLines         = errors.New("purchase order needs at least one line")
+	ErrNoReceiptLines       = errors.New("goods receipt needs at least one line")
+	// ErrUnknownOrderLine means a receipt line names a line of another order
+	ErrUnknownOrderLine = errors.New("line is not on the purchase order")
+	ErrInvalidPrice     = errors.New("price must not be negative")
+)
+
+// PurchaseOrderError is returned when one or more fields of a purchase order
+// or goods receipt fail validation
+type PurchaseOrderError struct {
+	Lines []BulkAdjustLineError
+}
+
+func (e *PurchaseOrderError) Error() string {
+	return fmt.Sprintf("purchase order rejected: %d invalid field(s)", len(e.Lines))
+}
+
+func (e *PurchaseOrderError) add(field string, err error) {
+	e.Lines = append(e.Lines, BulkAdjustLineError{Field: field, Message: err.Error()})
+}
+
+// PurchasingService manages suppliers and purchase orders, and posts the
+// goods received against an order as IN movements through the
+// InventoryService
+type PurchasingService struct {
+	supplierRepo repository.SupplierRepository
+	poRepo       repository.PurchaseOrderRepository
+	itemRepo     repository.ItemRepository
+	inventory    *InventoryService
+	db           *sql.DB
+}
+
+func NewPurchasingService(supplierRepo repository.SupplierRepository, poRepo repository.PurchaseOrderRepository, itemRepo repository.ItemRepository, inventory *InventoryService, db *sql.DB) *PurchasingService {
+	return &PurchasingService{
+		supplierRepo: supplierRepo,
+		poRepo:       poRepo,
+		itemRepo:     itemRepo,
+		inventory:    inventory,
+		db:           db,
+	}
+}
+
+// Supplier methods
+
+func (s *PurchasingService) ListSuppliers(ctx context.Context, orgID uuid.UUID) ([]*domain.Supplier, error) {
+	return s.supplierRepo.List(ctx, orgID)
+}
+
+func (s *PurchasingService) GetSupplier(ctx context.Context, id uuid.UUID) (*domain.Supplier, error) {
+	supplier, err := s.supplierRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if supplier == nil {
+		return nil, ErrSupplierNotFound
+	}
+	return supplier, nil
+}
+
+func (s *PurchasingService) CreateSupplier(ctx context.Context, orgID uuid.UUID, req *domain.CreateSupplierRequest) (*domain.Supplier, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrInvalidSupplierName
+	}
+	if req.LeadTimeDays < 0 {
+		return nil, ErrInvalidLeadTime
+	}
+
+	supplier := &domain.Supplier{
+		OrganizationID: orgID,
+		Name:           name,
+		ContactName:    trimmedOrNil(req.ContactName),
+		Email:          trimmedOrNil(req.Email),
+		Phone:          trimmedOrNil(req.Phone),
+		LeadTimeDays:   req.LeadTimeDays,
+		PaymentTerms:   trimmedOrNil(req.PaymentTerms),
+		Notes:          trimmedOrNil(req.Notes),
+		IsActive:       true,
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.supplierRepo.GetByName(ctx, orgID, name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrSupplierNameTaken
+		}
+
+		_, err = s.supplierRepo.Create(ctx, supplier)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return supplier, nil
+}
+
+func (s *PurchasingService) UpdateSupplier(ctx context.Context, supplier *domain.Supplier, req *domain.UpdateSupplierRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return ErrInvalidSupplierName
+		}
+		supplier.Name = name
+	}
+	if req.LeadTimeDays != nil {
+		if *req.LeadTimeDays < 0 {
+			return ErrInvalidLeadTime
+		}
+		supplier.LeadTimeDays = *req.LeadTimeDays
+	}
+	if req.ContactName != nil {
+		supplier.ContactName = trimmedOrNil(req.ContactName)
+	}
+	if req.Email != nil {
+		supplier.Email = trimmedOrNil(req.Email)
+	}
+	if req.Phone != nil {
+		supplier.Phone = trimmedOrNil(req.Phone)
+	}
+	if req.PaymentTerms != nil {
+		supplier.PaymentTerms = trimmedOrNil(req.PaymentTerms)
+	}
+	if req.Notes != nil {
+		supplier.Notes = trimmedOrNil(req.Notes)
+	}
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.supplierRepo.GetByName(ctx, supplier.OrganizationID, supplier.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.ID != supplier.ID {
+			return ErrSupplierNameTaken
+		}
+		return s.supplierRepo.Update(ctx, supplier)
+	})
+}
+
+// DeleteSupplier deletes a supplier no purchase order was placed with;
+// deactivate the others instead
+func (s *PurchasingService) DeleteSupplier(ctx context.Context, id uuid.UUID) error {
+	used, err := s.supplierRepo.HasPurchaseOrders(ctx, id)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrSupplierInUse
+	}
+	return s.supplierRepo.Delete(ctx, id)
+}
+
+// Purchase order methods
+
+// ListPurchaseOrders lists the organization's orders, only those in status
+// when it is given
+func (s *PurchasingService) ListPurchaseOrders(ctx context.Context, orgID uuid.UUID, status *domain.PurchaseOrderStatus) ([]*domain.PurchaseOrder, error) {
+	return s.poRepo.List(ctx, orgID, status)
+}
+
+func (s *PurchasingService) GetPurchaseOrder(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error) {
+	po, err := s.poRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if po == nil {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	return po, nil
+}
+
+// CreatePurchaseOrder creates a DRAFT order with the next number of the
+// organization. Invalid fields are reported together as a
+// *PurchaseOrderError.
+func (s *PurchasingService) CreatePurchaseOrder(ctx context.Context, orgID, userID uuid.UUID, req *domain.CreatePurchaseOrderRequest) (*domain.PurchaseOrder, error) {
+	if len(req.Lines) == 0 {
+		return nil, ErrNoOrderLines
+	}
+
+	po := &domain.PurchaseOrder{
+		OrganizationID: orgID,
+		SupplierID:     req.SupplierID,
+		Status:         domain.PurchaseOrderDraft,
+		ExpectedAt:     req.ExpectedAt,
+		Notes:          trimmedOrNil(req.Notes),
+		CreatedBy:      userID,
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		poErr := &PurchaseOrderError{}
+		if err := s.checkSupplier(ctx, po, poErr); err != nil {
+			return err
+		}
+		lines, err := s.orderLines(ctx, orgID, req.Lines, poErr)
+		if err != nil {
+			return err
+		}
+		if len(poErr.Lines) > 0 {
+			return poErr
+		}
+		po.Lines = lines
+
+		po.Number, err = s.poRepo.NextNumber(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		_, err = s.poRepo.Create(ctx, po)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+// UpdatePurchaseOrder changes a DRAFT order. Lines, when given, replace all
+// of its lines.
+func (s *PurchasingService) UpdatePurchaseOrder(ctx context.Context, po *domain.PurchaseOrder, req *domain.UpdatePurchaseOrderRequest) (*domain.PurchaseOrder, error) {
+	if po.Status != domain.PurchaseOrderDraft {
+		return nil, ErrPurchaseOrderNotDraft
+	}
+	if req.Lines != nil && len(req.Lines) == 0 {
+		return nil, ErrNoOrderLines
+	}
+
+	if req.SupplierID != nil {
+		po.SupplierID = *req.SupplierID
+	}
+	if req.ExpectedAt != nil {
+		po.ExpectedAt = req.ExpectedAt
+	}
+	if req.Notes != nil {
+		po.Notes = trimmedOrNil(req.Notes)
+	}
+
+	var updated *domain.PurchaseOrder
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		poErr := &PurchaseOrderError{}
+		if req.SupplierID != nil {
+			if err := s.checkSupplier(ctx, po, poErr); err != nil {
+				return err
+			}
+		}
+		var lines []*domain.PurchaseOrderLine
+		if req.Lines != nil {
+			var err error
+			lines, err = s.orderLines(ctx, po.OrganizationID, req.Lines, poErr)
+			if err != nil {
+				return err
+			}
+		}
+		if len(poErr.Lines) > 0 {
+			return poErr
+		}
+
+		if err := s.poRepo.Update(ctx, po); err != nil {
+			return err
+		}
+		if req.Lines != nil {
+			po.Lines = lines
+			if err := s.poRepo.ReplaceLines(ctx, po); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		updated, err = s.poRepo.GetByID(ctx, po.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeletePurchaseOrder deletes a DRAFT order
+func (s *PurchasingService) DeletePurchaseOrder(ctx context.Context, po *domain.PurchaseOrder) error {
+	if po.Status != domain.PurchaseOrderDraft {
+		return ErrPurchaseOrderNotDraft
+	}
+	return s.poRepo.Delete(ctx, po.ID)
+}
+
+// SendPurchaseOrder marks a DRAFT order as sent to the supplier; it can no
+// longer be changed and goods can be received against it
+func (s *PurchasingService) SendPurchaseOrder(ctx context.Context, po *domain.PurchaseOrder) error {
+	if po.Status != domain.PurchaseOrderDraft {
+		return ErrPurchaseOrderNotDraft
+	}
+
+	now := time.Now().UTC()
+	po.Status = domain.PurchaseOrderSent
+	po.SentAt = &now
+	return s.poRepo.Update(ctx, po)
+}
+
+// ClosePurchaseOrder marks an order that is still being received as
+// RECEIVED. Whatever was not delivered stays recorded as short.
+func (s *PurchasingService) ClosePurchaseOrder(ctx context.Context, po *domain.PurchaseOrder) error {
+	if po.Status != domain.PurchaseOrderSent && po.Status != domain.PurchaseOrderPartiallyReceived {
+		return ErrPurchaseOrderNotOpen
+	}
+
+	now := time.Now().UTC()
+	po.Status = domain.PurchaseOrderReceived
+	po.ReceivedAt = &now
+	return s.poRepo.Update(ctx, po)
+}
+
+func (s *PurchasingService) ListReceipts(ctx context.Context, poID uuid.UUID) ([]*domain.GoodsReceipt, error) {
+	return s.poRepo.ListReceipts(ctx, poID)
+}
+
+// ReceivePurchaseOrder posts a delivery against a SENT or PARTIALLY_RECEIVED
+// order. Each line becomes an IN movement referencing the order and sets the
+// unit cost of its item from the price paid. The order becomes RECEIVED once
+// every line has been delivered in full, and PARTIALLY_RECEIVED until then;
+// more than ordered is accepted and reported as over delivered. Invalid
+// lines are reported together as a *PurchaseOrderError and nothing is
+// posted.
+func (s *PurchasingService) ReceivePurchaseOrder(ctx context.Context, orgID, poID, userID uuid.UUID, req *domain.ReceivePurchaseOrderRequest) (*domain.GoodsReceiptResult, error) {
+	if req == nil || len(req.Lines) == 0 {
+		return nil, ErrNoReceiptLines
+	}
+
+	receivedAt := time.Now().UTC()
+	if req.ReceivedAt != nil {
+		receivedAt = req.ReceivedAt.UTC()
+	}
+
+	var result *domain.GoodsReceiptResult
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		po, err := s.poRepo.GetByID(ctx, poID)
+		if err != nil {
+			return err
+		}
+		if po == nil || po.OrganizationID != orgID {
+			return ErrPurchaseOrderNotFound
+		}
+		if po.Status != domain.PurchaseOrderSent && po.Status != domain.PurchaseOrderPartiallyReceived {
+			return ErrPurchaseOrderNotOpen
+		}
+
+		orderLines := make(map[uuid.UUID]*domain.PurchaseOrderLine, len(po.Lines))
+		for _, line := range po.Lines {
+			orderLines[line.ID] = line
+		}
+
+		poErr := &PurchaseOrderError{}
+		var (
+			adjustments []domain.BulkAdjustLine
+			received    []*domain.PurchaseOrderLine
+			prices      []float64
+			indexes     []int
+		)
+		for i, input := range req.Lines {
+			field := fmt.Sprintf("lines[%d]", i)
+
+			line := orderLines[input.LineID]
+			if line == nil {
+				poErr.add(field+".lineId", ErrUnknownOrderLine)
+				continue
+			}
+			quantity := int(math.Round(input.Quantity * float64(line.UnitFactor)))
+			if input.Quantity <= 0 || quantity <= 0 {
+				poErr.add(field+".quantity", ErrInvalidQuantity)
+				continue
+			}
+			price := line.UnitPrice
+			if input.UnitPrice != nil {
+				if *input.UnitPrice < 0 {
+					poErr.add(field+".unitPrice", ErrInvalidPrice)
+					continue
+				}
+				price = *input.UnitPrice
+			}
+			// The stock is costed at what was paid for it; a missing item
+			// is reported by the movement
+			item, err := s.itemRepo.GetByID(ctx, line.ItemID)
+			if err != nil {
+				return err
+			}
+			var unitCost *float64
+			if item != nil {
+				if unitCost, err = s.itemUnitCost(ctx, item, line, price); err != nil {
+					return err
+				}
+			}
+
+			adjustments = append(adjustments, domain.BulkAdjustLine{
+				ItemID:       line.ItemID,
+				MovementType: domain.MovementTypeIn,
+				Quantity:     quantity,
+				LocationID:   req.LocationID,
+				LotNumber:    input.LotNumber,
+				ReceivedAt:   &receivedAt,
+				ExpiresAt:    input.ExpiresAt,
+				Notes:        req.Notes,
+				UnitCost:     unitCost,
+			})
+			received = append(received, line)
+			prices = append(prices, price)
+			indexes = append(indexes, i)
+		}
+		if len(poErr.Lines) > 0 {
+			return poErr
+		}
+
+		reference := po.Reference()
+		movements, err := s.inventory.BulkAdjustStock(ctx, orgID, &domain.BulkAdjustRequest{
+			Reference:   &reference,
+			Adjustments: adjustments,
+		}, userID)
+		if err != nil {
+			var bulkErr *BulkAdjustError
+			if errors.As(err, &bulkErr) {
+				return receiptErrors(bulkErr, indexes)
+			}
+			return err
+		}
+
+		receipt := &domain.GoodsReceipt{
+			PurchaseOrderID: po.ID,
+			ReceivedBy:      userID,
+			ReceivedAt:      receivedAt,
+			Notes:           trimmedOrNil(req.Notes),
+		}
+		for i, movement := range movements {
+			line := received[i]
+			line.ReceivedQuantity += movement.Quantity
+			if err := s.poRepo.SetReceivedQuantity(ctx, line.ID, line.ReceivedQuantity); err != nil {
+				return err
+			}
+			if err := s.updateUnitCost(ctx, line, prices[i]); err != nil {
+				return err
+			}
+			receipt.Lines = append(receipt.Lines, &domain.GoodsReceiptLine{
+				LineID:     line.ID,
+				MovementID: movement.ID,
+				Quantity:   movement.Quantity,
+				UnitPrice:  prices[i],
+			})
+		}
+		if _, err := s.poRepo.CreateReceipt(ctx, receipt); err != nil {
+			return err
+		}
+
+		po.Status = domain.PurchaseOrderReceived
+		for _, line := range po.Lines {
+			line.Tally()
+			if line.ShortQuantity > 0 {
+				po.Status = domain.PurchaseOrderPartiallyReceived
+			}
+		}
+		if po.Status == domain.PurchaseOrderReceived {
+			po.ReceivedAt = &receivedAt
+		}
+		if err := s.poRepo.Update(ctx, po); err != nil {
+			return err
+		}
+
+		result = &domain.GoodsReceiptResult{Receipt: receipt, PurchaseOrder: po, Movements: movements}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkSupplier reports the order's supplier as invalid unless it is an
+// active supplier of the order's organization
+func (s *PurchasingService) checkSupplier(ctx context.Context, po *domain.PurchaseOrder, poErr *PurchaseOrderError) error {
+	supplier, err := s.supplierRepo.GetByID(ctx, po.SupplierID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case supplier == nil || supplier.OrganizationID != po.OrganizationID:
+		poErr.add("supplierId", ErrSupplierNotFound)
+	case !supplier.IsActive:
+		poErr.add("supplierId", ErrSupplierInactive)
+	default:
+		po.SupplierName = supplier.Name
+	}
+	return nil
+}
+
+// orderLines turns the entered lines into order lines in base units of each
+// item, adding what is invalid to poErr
+func (s *PurchasingService) orderLines(ctx context.Context, orgID uuid.UUID, inputs []domain.PurchaseOrderLineInput, poErr *PurchaseOrderError) ([]*domain.PurchaseOrderLine, error) {
+	lines := make([]*domain.PurchaseOrderLine, 0, len(inputs))
+	for i, input := range inputs {
+		field := fmt.Sprintf("lines[%d]", i)
+
+		item, err := s.itemRepo.GetByID(ctx, input.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil || item.OrganizationID != orgID {
+			poErr.add(field+".itemId", ErrItemNotFound)
+			continue
+		}
+
+		unit := strings.TrimSpace(input.Unit)
+		if unit == "" {
+			unit = item.UnitOfMeasurement
+		}
+		measure, err := s.orderUnit(ctx, item, unit)
+		if err != nil {
+			if errors.Is(err, units.ErrInvalidUnit) || errors.Is(err, units.ErrIncompatibleUnits) {
+				poErr.add(field+".unit", err)
+				continue
+			}
+			return nil, err
+		}
+
+		ordered := int(math.Round(input.Quantity * float64(measure.Factor)))
+		if input.Quantity <= 0 || ordered <= 0 {
+			poErr.add(field+".quantity", ErrInvalidQuantity)
+			continue
+		}
+		if input.UnitPrice < 0 {
+			poErr.add(field+".unitPrice", ErrInvalidPrice)
+			continue
+		}
+
+		lines = append(lines, &domain.PurchaseOrderLine{
+			ItemID:          item.ID,
+			Unit:            measure.Code,
+			UnitFactor:      measure.Factor,
+			OrderedQuantity: ordered,
+			UnitPrice:       input.UnitPrice,
+			ItemName:        item.Name,
+		})
+	}
+	for _, line := range lines {
+		line.Tally()
+	}
+	return lines, nil
+}
+
+// orderUnit resolves a unit the item can be ordered in: any unit measuring
+// the same quantity as the item's own, including its purchase units
+func (s *PurchasingService) orderUnit(ctx context.Context, item *domain.Item, unit string) (units.Unit, error) {
+	registry, err := s.inventory.ItemUnits(ctx, item)
+	if err != nil {
+		return units.Unit{}, err
+	}
+	measure, err := registry.GetUnit(unit)
+	if err != nil {
+		return units.Unit{}, err
+	}
+	own, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil || own.BaseUnit != measure.BaseUnit {
+		return units.Unit{}, fmt.Errorf("%w: %s and %s", units.ErrIncompatibleUnits, unit, item.UnitOfMeasurement)
+	}
+	return measure, nil
+}
+
+// updateUnitCost sets the unit cost of the line's item to price, the price of
+// one unit of the line, restated per unit of the item
+func (s *PurchasingService) updateUnitCost(ctx context.Context, line *domain.PurchaseOrderLine, price float64) error {
+	item, err := s.itemRepo.GetByID(ctx, line.ItemID)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrItemNotFound
+	}
+
+	cost, err := s.itemUnitCost(ctx, item, line, price)
+	if err != nil || cost == nil {
+		return err
+	}
+	rounded := math.Round(*cost*100) / 100
+	item.UnitCost = &rounded
+	return s.itemRepo.Update(ctx, item)
+}
+
+// itemUnitCost restates price, the price of one unit of the line, per unit
+// of the item. It is nil for an item measured in an unknown unit, which has
+// no cost per unit.
+func (s *PurchasingService) itemUnitCost(ctx context.Context, item *domain.Item, line *domain.PurchaseOrderLine, price float64) (*float64, error) {
+	own, err := s.orderUnit(ctx, item, item.UnitOfMeasurement)
+	if err != nil {
+		if errors.Is(err, units.ErrInvalidUnit) || errors.Is(err, units.ErrIncompatibleUnits) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cost := price / float64(line.UnitFactor) * float64(own.Factor)
+	return &cost, nil
+}
+
+// receiptErrors restates the line errors of the IN movements in terms of
+// the receipt lines they were posted for. A location error applies to every
+// line and is reported once.
+func receiptErrors(bulkErr *BulkAdjustError, indexes []int) error {
+	result := &PurchaseOrderError{}
+	locationReported := false
+
+	for _, line := range bulkErr.Lines {
+		var index int
+		var field string
+		if _, err := fmt.Sscanf(line.Field, "adjustments[%d].%s", &index, &field); err != nil || index >= len(indexes) {
+			result.Lines = append(result.Lines, line)
+			continue
+		}
+
+		if field == "locationId" {
+			if !locationReported {
+				result.Lines = append(result.Lines, BulkAdjustLineError{Field: "locationId", Message: line.Message})
+				locationReported = true
+			}
+			continue
+		}
+		result.Lines = append(result.Lines, BulkAdjustLineError{
+			Field:   fmt.Sprintf("lines[%d].%s", indexes[index], field),
+			Message: line.Message,
+		})
+	}
+	return result
+}
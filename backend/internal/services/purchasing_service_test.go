@@ -0,0 +1,339 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockSupplierRepo keeps suppliers in memory
+type mockSupplierRepo struct {
+	suppliers map[uuid.UUID]*domain.Supplier
+}
+
+func (m *mockSupplierRepo) Create(ctx context.Context, supplier *domain.Supplier) (uuid.UUID, error) {
+	if supplier.ID == uuid.Nil {
+		supplier.ID = uuid.New()
+	}
+	copied := *supplier
+	m.suppliers[supplier.ID] = &copied
+	return supplier.ID, nil
+}
+
+func (m *mockSupplierRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Supplier, error) {
+	supplier, ok := m.suppliers[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *supplier
+	return &copied, nil
+}
+
+func (m *mockSupplierRepo) GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Supplier, error) {
+	for _, supplier := range m.suppliers {
+		if supplier.OrganizationID == orgID && supplier.Name == name {
+			copied := *supplier
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockSupplierRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Supplier, error) {
+	var suppliers []*domain.Supplier
+	for _, supplier := range m.suppliers {
+		if supplier.OrganizationID == orgID {
+			suppliers = append(suppliers, supplier)
+		}
+	}
+	return suppliers, nil
+}
+
+func (m *mockSupplierRepo) Update(ctx context.Context, supplier *domain.Supplier) error {
+	copied := *supplier
+	m.suppliers[supplier.ID] = &copied
+	return nil
+}
+
+func (m *mockSupplierRepo) HasPurchaseOrders(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (m *mockSupplierRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.suppliers, id)
+	return nil
+}
+
+// mockPurchaseOrderRepo keeps orders and receipts in memory, handing out
+// copies as a database would
+type mockPurchaseOrderRepo struct {
+	orders   map[uuid.UUID]*domain.PurchaseOrder
+	receipts []*domain.GoodsReceipt
+}
+
+func copyPurchaseOrder(po *domain.PurchaseOrder) *domain.PurchaseOrder {
+	copied := *po
+	copied.Lines = make([]*domain.PurchaseOrderLine, 0, len(po.Lines))
+	for _, line := range po.Lines {
+		lineCopy := *line
+		lineCopy.Tally()
+		copied.Lines = append(copied.Lines, &lineCopy)
+	}
+	return &copied
+}
+
+func (m *mockPurchaseOrderRepo) Create(ctx context.Context, po *domain.PurchaseOrder) (uuid.UUID, error) {
+	po.ID = uuid.New()
+	for i, line := range po.Lines {
+		line.ID = uuid.New()
+		line.PurchaseOrderID = po.ID
+		line.Position = i
+	}
+	m.orders[po.ID] = copyPurchaseOrder(po)
+	return po.ID, nil
+}
+
+func (m *mockPurchaseOrderRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error) {
+	po, ok := m.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyPurchaseOrder(po), nil
+}
+
+func (m *mockPurchaseOrderRepo) List(ctx context.Context, orgID uuid.UUID, status *domain.PurchaseOrderStatus) ([]*domain.PurchaseOrder, error) {
+	var orders []*domain.PurchaseOrder
+	for _, po := range m.orders {
+		if po.OrganizationID == orgID && (status == nil || po.Status == *status) {
+			orders = append(orders, copyPurchaseOrder(po))
+		}
+	}
+	return orders, nil
+}
+
+func (m *mockPurchaseOrderRepo) NextNumber(ctx context.Context, orgID uuid.UUID) (int, error) {
+	number := 1
+	for _, po := range m.orders {
+		if po.OrganizationID == orgID && po.Number >= number {
+			number = po.Number + 1
+		}
+	}
+	return number, nil
+}
+
+func (m *mockPurchaseOrderRepo) Update(ctx context.Context, po *domain.PurchaseOrder) error {
+	stored := m.orders[po.ID]
+	lines := stored.Lines
+	*stored = *po
+	stored.Lines = lines
+	return nil
+}
+
+func (m *mockPurchaseOrderRepo) ReplaceLines(ctx context.Context, po *domain.PurchaseOrder) error {
+	m.orders[po.ID].Lines = copyPurchaseOrder(po).Lines
+	return nil
+}
+
+func (m *mockPurchaseOrderRepo) SetReceivedQuantity(ctx context.Context, lineID uuid.UUID, quantity int) error {
+	for _, po := range m.orders {
+		for _, line := range po.Lines {
+			if line.ID == lineID {
+				line.ReceivedQuantity = quantity
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockPurchaseOrderRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.orders, id)
+	return nil
+}
+
+func (m *mockPurchaseOrderRepo) CreateReceipt(ctx context.Context, receipt *domain.GoodsReceipt) (uuid.UUID, error) {
+	receipt.ID = uuid.New()
+	m.receipts = append(m.receipts, receipt)
+	return receipt.ID, nil
+}
+
+func (m *mockPurchaseOrderRepo) ListReceipts(ctx context.Context, poID uuid.UUID) ([]*domain.GoodsReceipt, error) {
+	var receipts []*domain.GoodsReceipt
+	for _, receipt := range m.receipts {
+		if receipt.PurchaseOrderID == poID {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func TestPurchasingService_ReceivePurchaseOrder_TracksShortAndOverDeliveries(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	// Rice is kept in kg and bought in bags of 25 kg
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", TrackStock: true}
+	items := newMockItemsRepo(rice)
+	unitRepo := newMockUnitRepo()
+	unitRepo.conversions[rice.ID] = []*domain.ItemUnitConversion{{ItemID: rice.ID, Unit: "bag", Quantity: 25000}}
+
+	supplier := &domain.Supplier{ID: uuid.New(), OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 2, IsActive: true}
+	suppliers := &mockSupplierRepo{suppliers: map[uuid.UUID]*domain.Supplier{supplier.ID: supplier}}
+	orders := &mockPurchaseOrderRepo{orders: make(map[uuid.UUID]*domain.PurchaseOrder)}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewPurchasingService(suppliers, orders, items, newInventoryService(db, items, unitRepo, &mockAlertRepo{}), db)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	// Receiving a draft is rejected inside the transaction
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	po, err := service.CreatePurchaseOrder(ctx, orgID, userID, &domain.CreatePurchaseOrderRequest{
+		SupplierID: supplier.ID,
+		Lines:      []domain.PurchaseOrderLineInput{{ItemID: rice.ID, Quantity: 4, Unit: "bag", UnitPrice: 1500}},
+	})
+	if err != nil {
+		t.Fatalf("CreatePurchaseOrder failed: %v", err)
+	}
+	if po.Number != 1 || po.Status != domain.PurchaseOrderDraft || po.Reference() != "PO-00001" {
+		t.Fatalf("expected draft PO-00001, got %+v", po)
+	}
+	line := po.Lines[0]
+	if line.UnitFactor != 25000 || line.OrderedQuantity != 100000 {
+		t.Fatalf("expected 4 bags to be 100 kg, got %+v", line)
+	}
+
+	receive := func(quantity float64, price *float64) (*domain.GoodsReceiptResult, error) {
+		return service.ReceivePurchaseOrder(ctx, orgID, po.ID, userID, &domain.ReceivePurchaseOrderRequest{
+			Lines: []domain.ReceiveLineInput{{LineID: line.ID, Quantity: quantity, UnitPrice: price}},
+		})
+	}
+
+	if _, err := receive(1, nil); err != services.ErrPurchaseOrderNotOpen {
+		t.Fatalf("expected a draft to be closed for receiving, got %v", err)
+	}
+	if err := service.SendPurchaseOrder(ctx, po); err != nil || po.SentAt == nil {
+		t.Fatalf("SendPurchaseOrder failed: %v", err)
+	}
+
+	// One and a half bags arrive, invoiced below the order price
+	invoiced := 1400.0
+	result, err := receive(1.5, &invoiced)
+	if err != nil {
+		t.Fatalf("first receipt failed: %v", err)
+	}
+	movement := result.Movements[0]
+	if movement.MovementType != domain.MovementTypeIn || movement.Quantity != 37500 || movement.Reference == nil || *movement.Reference != "PO-00001" {
+		t.Errorf("expected a 37.5 kg IN movement referencing the order, got %+v", movement)
+	}
+	if result.PurchaseOrder.Status != domain.PurchaseOrderPartiallyReceived || result.PurchaseOrder.Lines[0].ShortQuantity != 62500 {
+		t.Errorf("expected the order to be partially received with 62.5 kg short, got %+v", result.PurchaseOrder.Lines[0])
+	}
+	if result.Receipt.Lines[0].MovementID != movement.ID || result.Receipt.Lines[0].UnitPrice != 1400 {
+		t.Errorf("expected the receipt to record the movement and price, got %+v", result.Receipt.Lines[0])
+	}
+	if rice.CurrentStock != 37500 || rice.UnitCost == nil || *rice.UnitCost != 56 {
+		t.Errorf("expected 37.5 kg of rice at 56 per kg, got %d at %v", rice.CurrentStock, rice.UnitCost)
+	}
+
+	// Three more bags arrive at the order price, half a bag more than ordered
+	result, err = receive(3, nil)
+	if err != nil {
+		t.Fatalf("second receipt failed: %v", err)
+	}
+	received := result.PurchaseOrder.Lines[0]
+	if result.PurchaseOrder.Status != domain.PurchaseOrderReceived || result.PurchaseOrder.ReceivedAt == nil {
+		t.Errorf("expected the order to be received, got %+v", result.PurchaseOrder)
+	}
+	if received.ReceivedQuantity != 112500 || received.ShortQuantity != 0 || received.OverQuantity != 12500 {
+		t.Errorf("expected 12.5 kg over delivered, got %+v", received)
+	}
+	if rice.CurrentStock != 112500 || *rice.UnitCost != 60 {
+		t.Errorf("expected 112.5 kg of rice at 60 per kg, got %d at %v", rice.CurrentStock, *rice.UnitCost)
+	}
+	if stored := orders.orders[po.ID]; stored.Status != domain.PurchaseOrderReceived || stored.Lines[0].ReceivedQuantity != 112500 {
+		t.Errorf("expected the received order to be stored, got %+v", stored)
+	}
+
+	if _, err := receive(1, nil); err != services.ErrPurchaseOrderNotOpen {
+		t.Errorf("expected a received order to be closed for receiving, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPurchasingService_CreatePurchaseOrder_ReportsInvalidFields(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	// Rice is kept in kg and bought in bags of 25 kg
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", TrackStock: true}
+	items := newMockItemsRepo(rice)
+	unitRepo := newMockUnitRepo()
+	unitRepo.conversions[rice.ID] = []*domain.ItemUnitConversion{{ItemID: rice.ID, Unit: "bag", Quantity: 25000}}
+
+	supplier := &domain.Supplier{ID: uuid.New(), OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 2, IsActive: false}
+	suppliers := &mockSupplierRepo{suppliers: map[uuid.UUID]*domain.Supplier{supplier.ID: supplier}}
+	orders := &mockPurchaseOrderRepo{orders: make(map[uuid.UUID]*domain.PurchaseOrder)}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewPurchasingService(suppliers, orders, items, newInventoryService(db, items, unitRepo, &mockAlertRepo{}), db)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err = service.CreatePurchaseOrder(ctx, orgID, userID, &domain.CreatePurchaseOrderRequest{
+		SupplierID: supplier.ID,
+		Lines: []domain.PurchaseOrderLineInput{
+			{ItemID: uuid.New(), Quantity: 1},
+			{ItemID: rice.ID, Quantity: 1, Unit: "ltr"},
+			{ItemID: rice.ID, Quantity: 0, Unit: "bag"},
+			{ItemID: rice.ID, Quantity: 2, UnitPrice: -1},
+		},
+	})
+	var poErr *services.PurchaseOrderError
+	if !errors.As(err, &poErr) {
+		t.Fatalf("expected a PurchaseOrderError, got %v", err)
+	}
+
+	want := []string{"supplierId", "lines[0].itemId", "lines[1].unit", "lines[2].quantity", "lines[3].unitPrice"}
+	if len(poErr.Lines) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), poErr.Lines)
+	}
+	for i, field := range want {
+		if poErr.Lines[i].Field != field {
+			t.Errorf("expected error %d on %s, got %+v", i, field, poErr.Lines[i])
+		}
+	}
+	if len(orders.orders) != 0 {
+		t.Errorf("expected nothing to be stored, got %d orders", len(orders.orders))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
+)
+
+var (
+	ErrRecipeNotFound  = errors.New("recipe not found")
+	ErrRecipeNameTaken = errors.New("a recipe with this name already exists")
+	ErrRecipeInactive  = errors.New("recipe is inactive")
+	// ErrRecipeInUse means another recipe uses the recipe as a sub-recipe
+	ErrRecipeInUse = errors.New("recipe is used as a sub-recipe")
+	// ErrRecipeCycle means a recipe would end up containing itself
+	ErrRecipeCycle = errors.New("a recipe cannot contain itself, directly or through sub-recipes")
+	// ErrInvalidComponent means a component names neither or both of an item and a sub-recipe
+	ErrInvalidComponent = errors.New("component needs exactly one of itemId or subRecipeId")
+	// ErrNoComponents means a recipe has nothing to deplete
+	ErrNoComponents = errors.New("recipe needs at least one component")
+	// ErrUnitMismatch means a quantity's unit measures something other than
+	// the item or yield it refers to, such as litres of an item kept in kg
+	ErrUnitMismatch = errors.New("unit does not measure the same quantity as the ingredient")
+	// ErrInvalidYield means a recipe yield is not a positive quantity of a known unit
+	ErrInvalidYield = errors.New("yield must be a positive quantity of a supported unit")
+	// ErrYieldUnitInUse means the yield unit of a sub-recipe would change
+	// what it measures and break the recipes that use it
+	ErrYieldUnitInUse = errors.New("the yield of a sub-recipe must keep measuring the same quantity")
+	// ErrInvalidPortions means a sale is not a positive quantity of the recipe's yield unit
+	ErrInvalidPortions = errors.New("portions must be a positive quantity of the recipe's yield unit")
+	ErrNoSales         = errors.New("no sales provided")
+)
+
+// RecipeError is returned when one or more fields of a recipe fail validation
+type RecipeError struct {
+	Lines []BulkAdjustLineError
+}
+
+func (e *RecipeError) Error() string {
+	return fmt.Sprintf("recipe rejected: %d invalid field(s)", len(e.Lines))
+}
+
+func (e *RecipeError) add(field string, err error) {
+	e.Lines = append(e.Lines, BulkAdjustLineError{Field: field, Message: err.Error()})
+}
+
+// RecipeService manages recipes and turns recipe sales into ingredient
+// movements through the InventoryService
+type RecipeService struct {
+	recipeRepo repository.RecipeRepository
+	itemRepo   repository.ItemRepository
+	inventory  *InventoryService
+	db         *sql.DB
+}
+
+func NewRecipeService(recipeRepo repository.RecipeRepository, itemRepo repository.ItemRepository, inventory *InventoryService, db *sql.DB) *RecipeService {
+	return &RecipeService{
+		recipeRepo: recipeRepo,
+		itemRepo:   itemRepo,
+		inventory:  inventory,
+		db:         db,
+	}
+}
+
+// CreateRecipe validates and stores a new recipe. A recipe without a yield
+// yields 1 pcs, as a dish does.
+func (s *RecipeService) CreateRecipe(ctx context.Context, orgID uuid.UUID, req *domain.CreateRecipeRequest) (*domain.Recipe, error) {
+	recipe := &domain.Recipe{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Description:    trimmedOrNil(req.Description),
+		IsActive:       true,
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		registry, err := s.inventory.Units(ctx, orgID)
+		if err != nil {
+			return err
+		}
+
+		recipeErr := &RecipeError{}
+		s.setName(recipe, req.Name, recipeErr)
+		s.setYield(registry, recipe, req.YieldQuantity, req.YieldUnit, recipeErr)
+		s.setComponents(ctx, registry, recipe, req.Components, recipeErr)
+		if len(recipeErr.Lines) > 0 {
+			return recipeErr
+		}
+		if err := s.checkName(ctx, recipe); err != nil {
+			return err
+		}
+
+		_, err = s.recipeRepo.Create(ctx, recipe)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.recipeRepo.GetByID(ctx, recipe.ID)
+}
+
+// GetRecipe retrieves a recipe with its components
+func (s *RecipeService) GetRecipe(ctx context.Context, id uuid.UUID) (*domain.Recipe, error) {
+	recipe, err := s.recipeRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if recipe == nil {
+		return nil, ErrRecipeNotFound
+	}
+	return recipe, nil
+}
+
+// ListRecipes lists the organization's recipes with their components
+func (s *RecipeService) ListRecipes(ctx context.Context, orgID uuid.UUID) ([]*domain.Recipe, error) {
+	return s.recipeRepo.List(ctx, orgID)
+}
+
+// UpdateRecipe applies the given changes to a recipe. New components replace
+// the old ones and may not make the recipe contain itself.
+func (s *RecipeService) UpdateRecipe(ctx context.Context, recipe *domain.Recipe, req *domain.UpdateRecipeRequest) (*domain.Recipe, error) {
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		registry, err := s.inventory.Units(ctx, recipe.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		recipeErr := &RecipeError{}
+		if req.Name != nil {
+			s.setName(recipe, *req.Name, recipeErr)
+		}
+		if req.Description != nil {
+			recipe.Description = trimmedOrNil(req.Description)
+		}
+		if req.YieldQuantity != nil || req.YieldUnit != nil {
+			if err := s.updateYield(ctx, registry, recipe, req, recipeErr); err != nil {
+				return err
+			}
+		}
+		if req.IsActive != nil {
+			recipe.IsActive = *req.IsActive
+		}
+		if req.Components != nil {
+			s.setComponents(ctx, registry, recipe, req.Components, recipeErr)
+		}
+		if len(recipeErr.Lines) > 0 {
+			return recipeErr
+		}
+		if err := s.checkName(ctx, recipe); err != nil {
+			return err
+		}
+
+		return s.recipeRepo.Update(ctx, recipe)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.recipeRepo.GetByID(ctx, recipe.ID)
+}
+
+// DeleteRecipe deletes a recipe that no other recipe uses
+func (s *RecipeService) DeleteRecipe(ctx context.Context, id uuid.UUID) error {
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		recipe, err := s.recipeRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if recipe == nil {
+			return ErrRecipeNotFound
+		}
+
+		used, err := s.recipeRepo.IsSubRecipe(ctx, id)
+		if err != nil {
+			return err
+		}
+		if used {
+			return ErrRecipeInUse
+		}
+
+		return s.recipeRepo.Delete(ctx, id)
+	})
+}
+
+func (s *RecipeService) setName(recipe *domain.Recipe, name string, recipeErr *RecipeError) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		recipeErr.add("name", errors.New("name must be 1 to 255 characters"))
+		return
+	}
+	recipe.Name = name
+}
+
+// checkName rejects a name another recipe of the organization already has
+func (s *RecipeService) checkName(ctx context.Context, recipe *domain.Recipe) error {
+	existing, err := s.recipeRepo.GetByName(ctx, recipe.OrganizationID, recipe.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != recipe.ID {
+		return ErrRecipeNameTaken
+	}
+	return nil
+}
+
+func (s *RecipeService) setYield(registry *units.Registry, recipe *domain.Recipe, quantity float64, unit string, recipeErr *RecipeError) {
+	if unit == "" {
+		unit = "pcs"
+	}
+	if quantity == 0 {
+		quantity = 1
+	}
+
+	yield, err := registry.ToBaseUnit(quantity, unit)
+	if err != nil || yield <= 0 {
+		recipeErr.add("yieldQuantity", ErrInvalidYield)
+		return
+	}
+	recipe.YieldQuantity = yield
+	recipe.YieldUnit = unit
+}
+
+// updateYield changes the yield of an existing recipe. Recipes using it as a
+// sub-recipe hold quantities in its base unit, so that cannot change.
+func (s *RecipeService) updateYield(ctx context.Context, registry *units.Registry, recipe *domain.Recipe, req *domain.UpdateRecipeRequest, recipeErr *RecipeError) error {
+	previousUnit := recipe.YieldUnit
+	quantity, _ := registry.FromBaseUnit(recipe.YieldQuantity, recipe.YieldUnit)
+	if req.YieldQuantity != nil {
+		quantity = *req.YieldQuantity
+	}
+	unit := recipe.YieldUnit
+	if req.YieldUnit != nil {
+		unit = *req.YieldUnit
+	}
+
+	s.setYield(registry, recipe, quantity, unit, recipeErr)
+	if recipe.YieldUnit == previousUnit || sameBaseUnit(registry, recipe.YieldUnit, previousUnit) {
+		return nil
+	}
+
+	used, err := s.recipeRepo.IsSubRecipe(ctx, recipe.ID)
+	if err != nil {
+		return err
+	}
+	if used {
+		recipeErr.add("yieldUnit", ErrYieldUnitInUse)
+	}
+	return nil
+}
+
+// setComponents validates the components entered for a recipe and converts
+// their quantities to base units
+func (s *RecipeService) setComponents(ctx context.Context, registry *units.Registry, recipe *domain.Recipe, inputs []domain.RecipeComponentInput, recipeErr *RecipeError) {
+	if len(inputs) == 0 {
+		recipeErr.add("components", ErrNoComponents)
+		return
+	}
+
+	components := make([]*domain.RecipeComponent, 0, len(inputs))
+	for i, input := range inputs {
+		field := fmt.Sprintf("components[%d]", i)
+		component, componentField, err := s.component(ctx, registry, recipe, input)
+		if err != nil {
+			if componentField == "" {
+				recipeErr.add(field, err)
+			} else {
+				recipeErr.add(field+"."+componentField, err)
+			}
+			continue
+		}
+		components = append(components, component)
+	}
+	recipe.Components = components
+}
+
+// component resolves one entered component. The returned field names the
+// offending input on failure.
+func (s *RecipeService) component(ctx context.Context, registry *units.Registry, recipe *domain.Recipe, input domain.RecipeComponentInput) (*domain.RecipeComponent, string, error) {
+	if (input.ItemID == nil) == (input.SubRecipeID == nil) {
+		return nil, "", ErrInvalidComponent
+	}
+
+	// measure is the unit the ingredient is kept in, or the sub-recipe yields
+	var measure string
+	if input.ItemID != nil {
+		item, err := s.itemRepo.GetByID(ctx, *input.ItemID)
+		if err != nil {
+			return nil, "itemId", err
+		}
+		if item == nil || item.OrganizationID != recipe.OrganizationID {
+			return nil, "itemId", ErrItemNotFound
+		}
+		measure = item.UnitOfMeasurement
+	} else {
+		sub, err := s.recipeRepo.GetByID(ctx, *input.SubRecipeID)
+		if err != nil {
+			return nil, "subRecipeId", err
+		}
+		if sub == nil || sub.OrganizationID != recipe.OrganizationID {
+			return nil, "subRecipeId", ErrRecipeNotFound
+		}
+		contains, err := s.contains(ctx, sub, recipe.ID, make(map[uuid.UUID]bool))
+		if err != nil {
+			return nil, "subRecipeId", err
+		}
+		if contains {
+			return nil, "subRecipeId", ErrRecipeCycle
+		}
+		measure = sub.YieldUnit
+	}
+
+	unit := input.Unit
+	if unit == "" {
+		unit = measure
+	}
+	if err := registry.Validate(unit); err != nil {
+		return nil, "unit", err
+	}
+	if !sameBaseUnit(registry, unit, measure) {
+		return nil, "unit", ErrUnitMismatch
+	}
+
+	quantity, err := registry.ToBaseUnit(input.Quantity, unit)
+	if err != nil || quantity <= 0 {
+		return nil, "quantity", ErrInvalidQuantity
+	}
+
+	return &domain.RecipeComponent{
+		ItemID:      input.ItemID,
+		SubRecipeID: input.SubRecipeID,
+		Quantity:    quantity,
+		Unit:        unit,
+	}, "", nil
+}
+
+// contains reports whether recipe is target or uses target, directly or
+// through its sub-recipes
+func (s *RecipeService) contains(ctx context.Context, recipe *domain.Recipe, target uuid.UUID, seen map[uuid.UUID]bool) (bool, error) {
+	if recipe.ID == target {
+		return true, nil
+	}
+	seen[recipe.ID] = true
+
+	for _, component := range recipe.Components {
+		if component.SubRecipeID == nil || seen[*component.SubRecipeID] {
+			continue
+		}
+		sub, err := s.recipeRepo.GetByID(ctx, *component.SubRecipeID)
+		if err != nil {
+			return false, err
+		}
+		if sub == nil {
+			continue
+		}
+		found, err := s.contains(ctx, sub, target, seen)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// sameBaseUnit reports whether two units of registry measure the same quantity
+func sameBaseUnit(registry *units.Registry, a, b string) bool {
+	ua, errA := registry.GetUnit(a)
+	ub, errB := registry.GetUnit(b)
+	return errA == nil && errB == nil && ua.BaseUnit == ub.BaseUnit
+}
+
+// RecordSales depletes the ingredients of the recipes sold. Each sale is
+// scaled by the recipe's yield and exploded through its sub-recipes down to
+// ingredient items; the needs of every sale are summed per item and posted
+// as one OUT movement per item, all in a single transaction. Ingredients
+// that do not track stock are skipped. Stock shortfalls are reported per
+// ingredient as a *BulkAdjustError. The movements are dated soldAt, or now
+// when it is nil.
+func (s *RecipeService) RecordSales(ctx context.Context, orgID uuid.UUID, sales []domain.RecipeSale, locationID *uuid.UUID, userID uuid.UUID, reference, notes *string, soldAt *time.Time) ([]*domain.StockMovement, error) {
+	if len(sales) == 0 {
+		return nil, ErrNoSales
+	}
+
+	var movements []*domain.StockMovement
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		registry, err := s.inventory.Units(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		needs := newIngredientNeeds()
+		var sold []string
+
+		for _, sale := range sales {
+			recipe, err := s.recipeRepo.GetByID(ctx, sale.RecipeID)
+			if err != nil {
+				return err
+			}
+			if recipe == nil || recipe.OrganizationID != orgID {
+				return ErrRecipeNotFound
+			}
+			if !recipe.IsActive {
+				return ErrRecipeInactive
+			}
+
+			portions, err := soldQuantity(registry, recipe, sale.Portions)
+			if err != nil {
+				return err
+			}
+			scale := portions / float64(recipe.YieldQuantity)
+			if err := s.explode(ctx, recipe, scale, needs, make(map[uuid.UUID]bool)); err != nil {
+				return err
+			}
+			sold = append(sold, fmt.Sprintf("%g %s %s", sale.Portions, recipe.YieldUnit, recipe.Name))
+		}
+
+		if notes == nil {
+			summary := "Sold " + strings.Join(sold, ", ")
+			notes = &summary
+		}
+
+		var lines []domain.BulkAdjustLine
+		var used []*domain.Item
+		for _, itemID := range needs.order {
+			item := needs.items[itemID]
+			quantity := int(math.Round(needs.quantities[itemID]))
+			if quantity <= 0 || !item.TrackStock {
+				continue
+			}
+			lines = append(lines, domain.BulkAdjustLine{
+				ItemID:       itemID,
+				MovementType: domain.MovementTypeOut,
+				Quantity:     quantity,
+				LocationID:   locationID,
+				Notes:        notes,
+			})
+			used = append(used, item)
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+
+		movements, err = s.inventory.BulkAdjustStock(ctx, orgID, &domain.BulkAdjustRequest{
+			Reference:   reference,
+			Adjustments: lines,
+			OccurredAt:  soldAt,
+		}, userID)
+		var bulkErr *BulkAdjustError
+		if errors.As(err, &bulkErr) {
+			return ingredientErrors(bulkErr, used)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+// soldQuantity converts portions sold to base units of the recipe's yield
+// unit. It is not rounded: half a plate of a dish yielding 1 pcs scales the
+// recipe by 0.5.
+func soldQuantity(registry *units.Registry, recipe *domain.Recipe, portions float64) (float64, error) {
+	unit, err := registry.GetUnit(recipe.YieldUnit)
+	if err != nil {
+		return 0, err
+	}
+	if portions <= 0 {
+		return 0, ErrInvalidPortions
+	}
+	return portions * float64(unit.Factor), nil
+}
+
+// ingredientNeeds sums the base-unit quantity of each item a sale consumes,
+// in the order the items were first reached
+type ingredientNeeds struct {
+	order      []uuid.UUID
+	items      map[uuid.UUID]*domain.Item
+	quantities map[uuid.UUID]float64
+}
+
+func newIngredientNeeds() *ingredientNeeds {
+	return &ingredientNeeds{
+		items:      make(map[uuid.UUID]*domain.Item),
+		quantities: make(map[uuid.UUID]float64),
+	}
+}
+
+// explode adds scale times the recipe's components to needs. A sub-recipe
+// component is itself exploded, scaled by how much of its yield it uses.
+// path holds the recipes being exploded and guards against cycles.
+func (s *RecipeService) explode(ctx context.Context, recipe *domain.Recipe, scale float64, needs *ingredientNeeds, path map[uuid.UUID]bool) error {
+	if path[recipe.ID] {
+		return ErrRecipeCycle
+	}
+	path[recipe.ID] = true
+	defer delete(path, recipe.ID)
+
+	for _, component := range recipe.Components {
+		quantity := float64(component.Quantity) * scale
+
+		if component.SubRecipeID != nil {
+			sub, err := s.recipeRepo.GetByID(ctx, *component.SubRecipeID)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				return ErrRecipeNotFound
+			}
+			if err := s.explode(ctx, sub, quantity/float64(sub.YieldQuantity), needs, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		itemID := *component.ItemID
+		if _, ok := needs.items[itemID]; !ok {
+			item, err := s.itemRepo.GetByID(ctx, itemID)
+			if err != nil {
+				return err
+			}
+			if item == nil {
+				return ErrItemNotFound
+			}
+			needs.items[itemID] = item
+			needs.order = append(needs.order, itemID)
+		}
+		needs.quantities[itemID] += quantity
+	}
+	return nil
+}
+
+// ingredientErrors restates the line errors of the ingredient movements in
+// terms of the ingredients. A location error applies to every line and is
+// reported once.
+func ingredientErrors(bulkErr *BulkAdjustError, used []*domain.Item) error {
+	result := &BulkAdjustError{}
+	locationReported := false
+
+	for _, line := range bulkErr.Lines {
+		var index int
+		var field string
+		if _, err := fmt.Sscanf(line.Field, "adjustments[%d].%s", &index, &field); err != nil || index >= len(used) {
+			result.Lines = append(result.Lines, line)
+			continue
+		}
+
+		if field == "locationId" {
+			if !locationReported {
+				result.Lines = append(result.Lines, BulkAdjustLineError{Field: "locationId", Message: line.Message})
+				locationReported = true
+			}
+			continue
+		}
+		result.Lines = append(result.Lines, BulkAdjustLineError{
+			Field:   fmt.Sprintf("ingredients[%d].%s", index, field),
+			Message: used[index].Name + ": " + line.Message,
+		})
+	}
+	return result
+}
+
+// trimmedOrNil trims s and returns nil when nothing is left
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
@@ -0,0 +1,372 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockItemsRepo keeps several items in memory and tracks their stock
+type mockItemsRepo struct {
+	mockItemRepo
+	byID map[uuid.UUID]*domain.Item
+}
+
+func newMockItemsRepo(items ...*domain.Item) *mockItemsRepo {
+	m := &mockItemsRepo{byID: make(map[uuid.UUID]*domain.Item)}
+	for _, item := range items {
+		m.byID[item.ID] = item
+	}
+	return m
+}
+
+func (m *mockItemsRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Item, error) {
+	item, ok := m.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *item
+	return &copied, nil
+}
+
+// Update writes into the stored item so tests holding it see the change
+func (m *mockItemsRepo) Update(ctx context.Context, item *domain.Item) error {
+	*m.byID[item.ID] = *item
+	return nil
+}
+
+func (m *mockItemsRepo) UpdateStock(ctx context.Context, id uuid.UUID, newStock, expectedVersion int) error {
+	item := m.byID[id]
+	item.CurrentStock = newStock
+	item.Version++
+	return nil
+}
+
+// mockRecipeRepo keeps recipes in memory
+type mockRecipeRepo struct {
+	recipes map[uuid.UUID]*domain.Recipe
+}
+
+func newMockRecipeRepo() *mockRecipeRepo {
+	return &mockRecipeRepo{recipes: make(map[uuid.UUID]*domain.Recipe)}
+}
+
+func (m *mockRecipeRepo) Create(ctx context.Context, recipe *domain.Recipe) (uuid.UUID, error) {
+	if recipe.ID == uuid.Nil {
+		recipe.ID = uuid.New()
+	}
+	copied := *recipe
+	m.recipes[recipe.ID] = &copied
+	return recipe.ID, nil
+}
+
+func (m *mockRecipeRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Recipe, error) {
+	recipe, ok := m.recipes[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *recipe
+	return &copied, nil
+}
+
+func (m *mockRecipeRepo) GetByName(ctx context.Context, orgID uuid.UUID, name string) (*domain.Recipe, error) {
+	for _, recipe := range m.recipes {
+		if recipe.OrganizationID == orgID && recipe.Name == name {
+			return recipe, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRecipeRepo) List(ctx context.Context, orgID uuid.UUID) ([]*domain.Recipe, error) {
+	var recipes []*domain.Recipe
+	for _, recipe := range m.recipes {
+		if recipe.OrganizationID == orgID {
+			recipes = append(recipes, recipe)
+		}
+	}
+	return recipes, nil
+}
+
+func (m *mockRecipeRepo) Update(ctx context.Context, recipe *domain.Recipe) error {
+	copied := *recipe
+	m.recipes[recipe.ID] = &copied
+	return nil
+}
+
+func (m *mockRecipeRepo) IsSubRecipe(ctx context.Context, id uuid.UUID) (bool, error) {
+	for _, recipe := range m.recipes {
+		for _, component := range recipe.Components {
+			if component.SubRecipeID != nil && *component.SubRecipeID == id {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRecipeRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.recipes, id)
+	return nil
+}
+
+func newRecipeService(db *sql.DB, items *mockItemsRepo, recipes *mockRecipeRepo) *services.RecipeService {
+	inventory := newInventoryService(db, items, newMockUnitRepo(), &mockAlertRepo{})
+	return services.NewRecipeService(recipes, items, inventory, db)
+}
+
+func TestRecipeService_RecordSales_ExplodesSubRecipes(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	paneer := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", UnitOfMeasurement: "kg", CurrentStock: 5000, TrackStock: true}
+	tomato := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Tomato", UnitOfMeasurement: "kg", CurrentStock: 10000, TrackStock: true}
+	jeera := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Jeera", UnitOfMeasurement: "gm", CurrentStock: 1000, TrackStock: true}
+	water := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Water", UnitOfMeasurement: "ltr", TrackStock: false}
+	items := newMockItemsRepo(paneer, tomato, jeera, water)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	service := newRecipeService(db, items, newMockRecipeRepo())
+
+	// 2 kg of gravy base from 1.5 kg tomato, 100 g jeera and 1 litre of water
+	gravy, err := service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name:          "Makhani Gravy",
+		YieldQuantity: 2,
+		YieldUnit:     "kg",
+		Components: []domain.RecipeComponentInput{
+			{ItemID: &tomato.ID, Quantity: 1.5, Unit: "kg"},
+			{ItemID: &jeera.ID, Quantity: 0.1, Unit: "kg"},
+			{ItemID: &water.ID, Quantity: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create gravy: %v", err)
+	}
+	if gravy.YieldQuantity != 2000 || gravy.Components[1].Quantity != 100 || gravy.Components[2].Unit != "ltr" {
+		t.Fatalf("expected quantities in base units, got yield %d and %+v", gravy.YieldQuantity, gravy.Components)
+	}
+
+	// One plate: 150 g paneer, 250 g gravy and 20 g jeera
+	dish, err := service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name: "Paneer Makhani",
+		Components: []domain.RecipeComponentInput{
+			{ItemID: &paneer.ID, Quantity: 0.15, Unit: "kg"},
+			{SubRecipeID: &gravy.ID, Quantity: 250, Unit: "gm"},
+			{ItemID: &jeera.ID, Quantity: 20},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create dish: %v", err)
+	}
+	if dish.YieldQuantity != 1 || dish.YieldUnit != "pcs" {
+		t.Fatalf("expected a dish to yield 1 pcs by default, got %d %s", dish.YieldQuantity, dish.YieldUnit)
+	}
+
+	reference := "BILL-1001"
+	movements, err := service.RecordSales(ctx, orgID, []domain.RecipeSale{{RecipeID: dish.ID, Portions: 4}}, nil, userID, &reference, nil, nil)
+	if err != nil {
+		t.Fatalf("RecordSales failed: %v", err)
+	}
+
+	// 4 plates use 1 kg of gravy, half a batch
+	want := map[uuid.UUID]int{paneer.ID: 600, tomato.ID: 750, jeera.ID: 130}
+	if len(movements) != len(want) {
+		t.Fatalf("expected one movement per stocked ingredient (%d), got %d", len(want), len(movements))
+	}
+	for _, movement := range movements {
+		if movement.MovementType != domain.MovementTypeOut {
+			t.Errorf("expected OUT movements, got %s", movement.MovementType)
+		}
+		if movement.Quantity != want[movement.ItemID] {
+			t.Errorf("expected %d of %s, got %d", want[movement.ItemID], items.byID[movement.ItemID].Name, movement.Quantity)
+		}
+		if movement.Reference == nil || *movement.Reference != reference {
+			t.Errorf("expected reference %s on every movement", reference)
+		}
+		if movement.Notes == nil || *movement.Notes != "Sold 4 pcs Paneer Makhani" {
+			t.Errorf("expected a sale summary in notes, got %v", movement.Notes)
+		}
+	}
+	if paneer.CurrentStock != 4400 || tomato.CurrentStock != 9250 || jeera.CurrentStock != 870 {
+		t.Errorf("unexpected stock after sale: paneer %d, tomato %d, jeera %d", paneer.CurrentStock, tomato.CurrentStock, jeera.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecipeService_RecordSales_ReportsShortIngredients(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	paneer := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Paneer", UnitOfMeasurement: "kg", CurrentStock: 200, TrackStock: true}
+	butter := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Butter", UnitOfMeasurement: "kg", CurrentStock: 5000, TrackStock: true}
+	items := newMockItemsRepo(paneer, butter)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	service := newRecipeService(db, items, newMockRecipeRepo())
+	dish, err := service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name: "Paneer Butter Masala",
+		Components: []domain.RecipeComponentInput{
+			{ItemID: &butter.ID, Quantity: 30, Unit: "gm"},
+			{ItemID: &paneer.ID, Quantity: 150, Unit: "gm"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create dish: %v", err)
+	}
+
+	_, err = service.RecordSales(ctx, orgID, []domain.RecipeSale{{RecipeID: dish.ID, Portions: 2}}, nil, uuid.New(), nil, nil, nil)
+
+	var bulkErr *services.BulkAdjustError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("expected BulkAdjustError, got %v", err)
+	}
+	if len(bulkErr.Lines) != 1 || bulkErr.Lines[0].Field != "ingredients[1].quantity" ||
+		!strings.HasPrefix(bulkErr.Lines[0].Message, "Paneer: ") {
+		t.Fatalf("expected the paneer shortfall to be reported, got %+v", bulkErr.Lines)
+	}
+	if butter.CurrentStock != 5000 || paneer.CurrentStock != 200 {
+		t.Errorf("expected stock to be untouched, got butter %d, paneer %d", butter.CurrentStock, paneer.CurrentStock)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecipeService_CreateRecipe_ValidatesComponents(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	oil := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Oil", UnitOfMeasurement: "ltr", TrackStock: true}
+	foreign := &domain.Item{ID: uuid.New(), OrganizationID: uuid.New(), Name: "Saffron", UnitOfMeasurement: "gm", TrackStock: true}
+	items := newMockItemsRepo(oil, foreign)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	service := newRecipeService(db, items, newMockRecipeRepo())
+	_, err = service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name: "Tadka",
+		Components: []domain.RecipeComponentInput{
+			{ItemID: &oil.ID, Quantity: 50, Unit: "gm"},
+			{ItemID: &foreign.ID, Quantity: 1},
+			{Quantity: 1, Unit: "pcs"},
+			{ItemID: &oil.ID, Quantity: 0},
+		},
+	})
+
+	var recipeErr *services.RecipeError
+	if !errors.As(err, &recipeErr) {
+		t.Fatalf("expected RecipeError, got %v", err)
+	}
+	want := []struct {
+		field string
+		err   error
+	}{
+		{"components[0].unit", services.ErrUnitMismatch},
+		{"components[1].itemId", services.ErrItemNotFound},
+		{"components[2]", services.ErrInvalidComponent},
+		{"components[3].quantity", services.ErrInvalidQuantity},
+	}
+	if len(recipeErr.Lines) != len(want) {
+		t.Fatalf("expected %d field errors, got %+v", len(want), recipeErr.Lines)
+	}
+	for i, w := range want {
+		if recipeErr.Lines[i].Field != w.field || recipeErr.Lines[i].Message != w.err.Error() {
+			t.Errorf("expected %s: %v, got %+v", w.field, w.err, recipeErr.Lines[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecipeService_UpdateRecipe_RejectsCycles(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	ghee := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Ghee", UnitOfMeasurement: "kg", TrackStock: true}
+	items := newMockItemsRepo(ghee)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	service := newRecipeService(db, items, newMockRecipeRepo())
+	base, err := service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name: "Onion Base", YieldQuantity: 1, YieldUnit: "kg",
+		Components: []domain.RecipeComponentInput{{ItemID: &ghee.ID, Quantity: 100, Unit: "gm"}},
+	})
+	if err != nil {
+		t.Fatalf("create base: %v", err)
+	}
+	dish, err := service.CreateRecipe(ctx, orgID, &domain.CreateRecipeRequest{
+		Name:       "Kadai Paneer",
+		Components: []domain.RecipeComponentInput{{SubRecipeID: &base.ID, Quantity: 200, Unit: "gm"}},
+	})
+	if err != nil {
+		t.Fatalf("create dish: %v", err)
+	}
+
+	_, err = service.UpdateRecipe(ctx, base, &domain.UpdateRecipeRequest{
+		Components: []domain.RecipeComponentInput{{SubRecipeID: &dish.ID, Quantity: 1}},
+	})
+
+	var recipeErr *services.RecipeError
+	if !errors.As(err, &recipeErr) || len(recipeErr.Lines) != 1 ||
+		recipeErr.Lines[0].Field != "components[0].subRecipeId" || recipeErr.Lines[0].Message != services.ErrRecipeCycle.Error() {
+		t.Fatalf("expected a cycle error on components[0].subRecipeId, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
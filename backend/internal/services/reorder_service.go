@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
+)
+
+// MaxVelocityDays bounds the window the consumption velocity is averaged over
+const MaxVelocityDays = 365
+
+var (
+	ErrInvalidVelocityDays = fmt.Errorf("velocity window must be between 1 and %d days", MaxVelocityDays)
+	ErrInvalidParLevel     = errors.New("par level must not be negative")
+)
+
+// ReorderService suggests what to order for each item from its reorder
+// settings, its stock and what it consumed recently.
+//
+// An item's lead time demand is its average daily OUT quantity over the
+// velocity window times its lead time. It needs reordering once its stock
+// plus what is on order falls to its reorder point, the minimum threshold
+// plus the lead time demand; the suggested quantity then brings it back to
+// the larger of its par level and its reorder point once the order arrives.
+type ReorderService struct {
+	reorderRepo  repository.ReorderRepository
+	itemRepo     repository.ItemRepository
+	supplierRepo repository.SupplierRepository
+	alertRepo    repository.AlertRepository
+	inventory    *InventoryService
+	db           *sql.DB
+}
+
+func NewReorderService(reorderRepo repository.ReorderRepository, itemRepo repository.ItemRepository, supplierRepo repository.SupplierRepository, alertRepo repository.AlertRepository, inventory *InventoryService, db *sql.DB) *ReorderService {
+	return &ReorderService{
+		reorderRepo:  reorderRepo,
+		itemRepo:     itemRepo,
+		supplierRepo: supplierRepo,
+		alertRepo:    alertRepo,
+		inventory:    inventory,
+		db:           db,
+	}
+}
+
+// UpdateSettings replaces the par level, lead time and preferred supplier of
+// an item of the organization
+func (s *ReorderService) UpdateSettings(ctx context.Context, orgID, itemID uuid.UUID, req *domain.ReorderSettingsRequest) (*domain.Item, error) {
+	var item *domain.Item
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		var err error
+		item, err = s.itemRepo.GetByID(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		if item == nil || item.OrganizationID != orgID {
+			return ErrItemNotFound
+		}
+
+		item.ParLevel = nil
+		if req.ParLevel != nil {
+			par, err := s.parLevel(ctx, item, *req.ParLevel, req.Unit)
+			if err != nil {
+				return err
+			}
+			item.ParLevel = &par
+		}
+
+		if req.LeadTimeDays != nil && *req.LeadTimeDays < 0 {
+			return ErrInvalidLeadTime
+		}
+		item.LeadTimeDays = req.LeadTimeDays
+
+		if req.PreferredSupplierID != nil {
+			supplier, err := s.supplierRepo.GetByID(ctx, *req.PreferredSupplierID)
+			if err != nil {
+				return err
+			}
+			if supplier == nil || supplier.OrganizationID != orgID {
+				return ErrSupplierNotFound
+			}
+		}
+		item.PreferredSupplierID = req.PreferredSupplierID
+
+		return s.itemRepo.Update(ctx, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// parLevel converts a par level entered in unit, or in the item's unit when
+// unit is nil, to base units of the item
+func (s *ReorderService) parLevel(ctx context.Context, item *domain.Item, value float64, unit *string) (int, error) {
+	if value < 0 {
+		return 0, ErrInvalidParLevel
+	}
+
+	registry, err := s.inventory.ItemUnits(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+	code := item.UnitOfMeasurement
+	if unit != nil {
+		code = *unit
+	}
+	measure, err := registry.GetUnit(code)
+	if err != nil {
+		return 0, err
+	}
+	own, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil || own.BaseUnit != measure.BaseUnit {
+		return 0, fmt.Errorf("%w: %s and %s", units.ErrIncompatibleUnits, code, item.UnitOfMeasurement)
+	}
+	return registry.ToBaseUnit(value, code)
+}
+
+// Suggestions runs the reorder engine for the organization, averaging
+// consumption over the last velocityDays days, and groups what should be
+// ordered by preferred supplier
+func (s *ReorderService) Suggestions(ctx context.Context, orgID uuid.UUID, velocityDays int) (*domain.ReorderList, error) {
+	if velocityDays < 1 || velocityDays > MaxVelocityDays {
+		return nil, ErrInvalidVelocityDays
+	}
+
+	now := time.Now().UTC()
+	candidates, err := s.reorderRepo.ListCandidates(ctx, &orgID, now.AddDate(0, 0, -velocityDays))
+	if err != nil {
+		return nil, err
+	}
+	registry, err := s.inventory.Units(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &domain.ReorderList{GeneratedAt: now, VelocityDays: velocityDays, Groups: []*domain.ReorderGroup{}}
+	groups := make(map[uuid.UUID]*domain.ReorderGroup)
+	for _, candidate := range candidates {
+		plan := planReorder(candidate, velocityDays)
+		if plan.quantity <= 0 {
+			continue
+		}
+		suggestion, err := plan.suggestion(candidate, registry)
+		if err != nil {
+			return nil, err
+		}
+
+		key := uuid.Nil
+		if candidate.SupplierID != nil {
+			key = *candidate.SupplierID
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &domain.ReorderGroup{SupplierID: candidate.SupplierID, SupplierName: candidate.SupplierName}
+			groups[key] = group
+			list.Groups = append(list.Groups, group)
+		}
+		group.Lines = append(group.Lines, suggestion)
+		if suggestion.EstimatedCost != nil {
+			group.EstimatedCost = math.Round((group.EstimatedCost+*suggestion.EstimatedCost)*100) / 100
+		}
+	}
+
+	// Suppliers by name, then the items without a preferred supplier
+	sort.SliceStable(list.Groups, func(i, j int) bool {
+		a, b := list.Groups[i].SupplierName, list.Groups[j].SupplierName
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return *a < *b
+	})
+
+	return list, nil
+}
+
+// RaiseReorderAlerts raises a REORDER alert, across all organizations, for
+// every item that needs reordering and has not been alerted on yet, and
+// withdraws the alert of items that no longer need it. It returns the number
+// of alerts created.
+func (s *ReorderService) RaiseReorderAlerts(ctx context.Context, velocityDays int) (int, error) {
+	if velocityDays < 1 || velocityDays > MaxVelocityDays {
+		return 0, ErrInvalidVelocityDays
+	}
+
+	now := time.Now().UTC()
+	created := 0
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		candidates, err := s.reorderRepo.ListCandidates(ctx, nil, now.AddDate(0, 0, -velocityDays))
+		if err != nil {
+			return err
+		}
+
+		registries := make(map[uuid.UUID]*units.Registry)
+		for _, candidate := range candidates {
+			plan := planReorder(candidate, velocityDays)
+			alerted := candidate.ReorderAlertedAt != nil
+
+			if plan.quantity <= 0 {
+				if !alerted {
+					continue
+				}
+				if err := s.alertRepo.DeleteByItemID(ctx, candidate.ItemID, domain.AlertTypeReorder); err != nil {
+					return err
+				}
+				if err := s.reorderRepo.MarkAlerted(ctx, candidate.ItemID, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			if alerted {
+				continue
+			}
+
+			registry, ok := registries[candidate.OrganizationID]
+			if !ok {
+				registry, err = s.inventory.Units(ctx, candidate.OrganizationID)
+				if err != nil {
+					return err
+				}
+				registries[candidate.OrganizationID] = registry
+			}
+			suggestion, err := plan.suggestion(candidate, registry)
+			if err != nil {
+				// An item measured in an unknown unit cannot be described
+				continue
+			}
+
+			if _, err := s.alertRepo.Create(ctx, reorderAlert(candidate, suggestion)); err != nil {
+				return err
+			}
+			if err := s.reorderRepo.MarkAlerted(ctx, candidate.ItemID, &now); err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// reorderPlan is the outcome of the reorder engine for one item, in base units
+type reorderPlan struct {
+	dailyUsage   float64
+	leadTimeDays int
+	reorderPoint int
+	quantity     int
+}
+
+// planReorder works out whether and how much of the candidate to order
+func planReorder(c *domain.ReorderCandidate, velocityDays int) reorderPlan {
+	plan := reorderPlan{dailyUsage: float64(c.Consumed) / float64(velocityDays)}
+	switch {
+	case c.LeadTimeDays != nil:
+		plan.leadTimeDays = *c.LeadTimeDays
+	case c.SupplierLeadTimeDays != nil:
+		plan.leadTimeDays = *c.SupplierLeadTimeDays
+	}
+
+	leadTimeDemand := int(math.Ceil(plan.dailyUsage * float64(plan.leadTimeDays)))
+	plan.reorderPoint = c.MinimumThreshold + leadTimeDemand
+
+	position := c.CurrentStock + c.OnOrder
+	if position > plan.reorderPoint {
+		return plan
+	}
+
+	target := plan.reorderPoint
+	if c.ParLevel != nil && *c.ParLevel > target {
+		target = *c.ParLevel
+	}
+	plan.quantity = target + leadTimeDemand - position
+	return plan
+}
+
+// suggestion states the plan in the item's display unit
+func (p reorderPlan) suggestion(c *domain.ReorderCandidate, registry *units.Registry) (*domain.ReorderSuggestion, error) {
+	display := func(base int) (float64, error) {
+		return registry.FromBaseUnit(base, c.UnitOfMeasurement)
+	}
+
+	suggestion := &domain.ReorderSuggestion{
+		ItemID:       c.ItemID,
+		ItemName:     c.ItemName,
+		SKU:          c.SKU,
+		Unit:         c.UnitOfMeasurement,
+		LeadTimeDays: p.leadTimeDays,
+		UnitCost:     c.UnitCost,
+	}
+	fields := []struct {
+		base int
+		dest *float64
+	}{
+		{c.CurrentStock, &suggestion.CurrentStock},
+		{c.OnOrder, &suggestion.OnOrder},
+		{c.MinimumThreshold, &suggestion.MinimumThreshold},
+		{p.reorderPoint, &suggestion.ReorderPoint},
+		{p.quantity, &suggestion.SuggestedQuantity},
+	}
+	for _, field := range fields {
+		value, err := display(field.base)
+		if err != nil {
+			return nil, err
+		}
+		*field.dest = value
+	}
+	if c.ParLevel != nil {
+		par, err := display(*c.ParLevel)
+		if err != nil {
+			return nil, err
+		}
+		suggestion.ParLevel = &par
+	}
+
+	// Usage per day rarely comes to whole base units, so it is converted
+	// through the unit factor rather than rounded to the unit's precision
+	unit, err := registry.GetUnit(c.UnitOfMeasurement)
+	if err != nil {
+		return nil, err
+	}
+	suggestion.DailyUsage = math.Round(p.dailyUsage/float64(unit.Factor)*1000) / 1000
+
+	if c.UnitCost != nil {
+		cost := math.Round(suggestion.SuggestedQuantity**c.UnitCost*100) / 100
+		suggestion.EstimatedCost = &cost
+	}
+	return suggestion, nil
+}
+
+// reorderAlert builds the alert for an item that reached its reorder point
+func reorderAlert(c *domain.ReorderCandidate, suggestion *domain.ReorderSuggestion) *domain.Alert {
+	from := ""
+	if c.SupplierName != nil {
+		from = " from " + *c.SupplierName
+	}
+	return &domain.Alert{
+		OrganizationID: c.OrganizationID,
+		ItemID:         &c.ItemID,
+		Type:           domain.AlertTypeReorder,
+		Severity:       domain.AlertSeverityInfo,
+		Title:          fmt.Sprintf("Reorder: %s", c.ItemName),
+		Message: fmt.Sprintf("Item '%s' reached its reorder point (Stock: %g %s, On order: %g %s). Suggested order: %g %s%s",
+			c.ItemName, suggestion.CurrentStock, c.UnitOfMeasurement, suggestion.OnOrder, c.UnitOfMeasurement,
+			suggestion.SuggestedQuantity, c.UnitOfMeasurement, from),
+	}
+}
@@ -0,0 +1,242 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockReorderRepo returns fixed candidates and records alert marks
+type mockReorderRepo struct {
+	candidates []*domain.ReorderCandidate
+	marked     map[uuid.UUID]*time.Time
+}
+
+func (m *mockReorderRepo) ListCandidates(ctx context.Context, orgID *uuid.UUID, since time.Time) ([]*domain.ReorderCandidate, error) {
+	var candidates []*domain.ReorderCandidate
+	for _, c := range m.candidates {
+		if orgID == nil || c.OrganizationID == *orgID {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+func (m *mockReorderRepo) MarkAlerted(ctx context.Context, itemID uuid.UUID, at *time.Time) error {
+	m.marked[itemID] = at
+	return nil
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestReorderService_Suggestions_GroupsBySupplier(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// Rice is kept in kg and bought in bags of 25 kg
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", TrackStock: true, Version: 1}
+	items := newMockItemsRepo(rice)
+	unitRepo := newMockUnitRepo()
+	unitRepo.conversions[rice.ID] = []*domain.ItemUnitConversion{{ItemID: rice.ID, Unit: "bag", Quantity: 25000}}
+
+	supplier := &domain.Supplier{ID: uuid.New(), OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 2, IsActive: true}
+	suppliers := &mockSupplierRepo{suppliers: map[uuid.UUID]*domain.Supplier{supplier.ID: supplier}}
+	reorder := &mockReorderRepo{marked: make(map[uuid.UUID]*time.Time)}
+	alerts := &mockAlertRepo{}
+
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewReorderService(reorder, items, suppliers, alerts, newInventoryService(db, items, unitRepo, alerts), db)
+
+	cost := 60.0
+	reorder.candidates = []*domain.ReorderCandidate{
+		// 1 kg a day over a 2 day supplier lead time: reorder point 5 + 2 kg,
+		// ordered back up to par plus what is used while waiting
+		{
+			ItemID: rice.ID, OrganizationID: orgID, ItemName: "Rice", UnitOfMeasurement: "kg",
+			CurrentStock: 6000, MinimumThreshold: 5000, ParLevel: intPtr(40000), UnitCost: &cost,
+			SupplierID: &supplier.ID, SupplierName: &supplier.Name, SupplierLeadTimeDays: intPtr(2),
+			Consumed: 28000,
+		},
+		// No supplier and no par level: the item's own lead time applies and
+		// the order covers the reorder point plus the lead time demand
+		{
+			ItemID: uuid.New(), OrganizationID: orgID, ItemName: "Oil", UnitOfMeasurement: "ltr",
+			CurrentStock: 0, MinimumThreshold: 2000, LeadTimeDays: intPtr(3), Consumed: 14000,
+		},
+		// Enough is on order already
+		{
+			ItemID: uuid.New(), OrganizationID: orgID, ItemName: "Salt", UnitOfMeasurement: "kg",
+			CurrentStock: 1000, MinimumThreshold: 2000, OnOrder: 5000,
+		},
+	}
+
+	list, err := service.Suggestions(ctx, orgID, 28)
+	if err != nil {
+		t.Fatalf("Suggestions failed: %v", err)
+	}
+	if len(list.Groups) != 2 {
+		t.Fatalf("expected a supplier group and an unassigned group, got %d groups", len(list.Groups))
+	}
+
+	metro := list.Groups[0]
+	if metro.SupplierID == nil || *metro.SupplierID != supplier.ID || len(metro.Lines) != 1 {
+		t.Fatalf("expected the supplier group first with rice, got %+v", metro)
+	}
+	line := metro.Lines[0]
+	if line.DailyUsage != 1 || line.LeadTimeDays != 2 || line.ReorderPoint != 7 || line.SuggestedQuantity != 36 {
+		t.Fatalf("expected 36 kg of rice at 1 kg/day, got %+v", line)
+	}
+	if line.EstimatedCost == nil || *line.EstimatedCost != 2160 || metro.EstimatedCost != 2160 {
+		t.Fatalf("expected an estimated cost of 2160, got %+v", line.EstimatedCost)
+	}
+
+	unassigned := list.Groups[1]
+	if unassigned.SupplierID != nil || len(unassigned.Lines) != 1 || unassigned.Lines[0].ItemName != "Oil" {
+		t.Fatalf("expected oil without a supplier last, got %+v", unassigned)
+	}
+	if oil := unassigned.Lines[0]; oil.ReorderPoint != 3.5 || oil.SuggestedQuantity != 5 || oil.EstimatedCost != nil {
+		t.Fatalf("expected 5 ltr of oil, got %+v", oil)
+	}
+
+	if _, err := service.Suggestions(ctx, orgID, 0); !errors.Is(err, services.ErrInvalidVelocityDays) {
+		t.Fatalf("expected ErrInvalidVelocityDays, got %v", err)
+	}
+}
+
+func TestReorderService_RaiseReorderAlerts_AlertsOnceAndWithdraws(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// Rice is kept in kg and bought in bags of 25 kg
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", TrackStock: true, Version: 1}
+	items := newMockItemsRepo(rice)
+	unitRepo := newMockUnitRepo()
+	unitRepo.conversions[rice.ID] = []*domain.ItemUnitConversion{{ItemID: rice.ID, Unit: "bag", Quantity: 25000}}
+
+	supplier := &domain.Supplier{ID: uuid.New(), OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 2, IsActive: true}
+	suppliers := &mockSupplierRepo{suppliers: map[uuid.UUID]*domain.Supplier{supplier.ID: supplier}}
+	reorder := &mockReorderRepo{marked: make(map[uuid.UUID]*time.Time)}
+	alerts := &mockAlertRepo{}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewReorderService(reorder, items, suppliers, alerts, newInventoryService(db, items, unitRepo, alerts), db)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	alertedAt := time.Now().UTC().Add(-time.Hour)
+	restocked := uuid.New()
+	reorder.candidates = []*domain.ReorderCandidate{
+		{
+			ItemID: rice.ID, OrganizationID: orgID, ItemName: "Rice", UnitOfMeasurement: "kg",
+			CurrentStock: 1000, MinimumThreshold: 5000, SupplierName: &supplier.Name,
+		},
+		// Already alerted and still short
+		{
+			ItemID: uuid.New(), OrganizationID: orgID, ItemName: "Oil", UnitOfMeasurement: "ltr",
+			CurrentStock: 0, MinimumThreshold: 2000, ReorderAlertedAt: &alertedAt,
+		},
+		// Alerted before it was restocked
+		{
+			ItemID: restocked, OrganizationID: orgID, ItemName: "Salt", UnitOfMeasurement: "kg",
+			CurrentStock: 9000, MinimumThreshold: 2000, ReorderAlertedAt: &alertedAt,
+		},
+	}
+
+	created, err := service.RaiseReorderAlerts(ctx, 28)
+	if err != nil {
+		t.Fatalf("RaiseReorderAlerts failed: %v", err)
+	}
+	if created != 1 || len(alerts.created) != 1 {
+		t.Fatalf("expected one new alert, got %d", created)
+	}
+	alert := alerts.created[0]
+	if alert.Type != domain.AlertTypeReorder || alert.ItemID == nil || *alert.ItemID != rice.ID {
+		t.Fatalf("expected a reorder alert for rice, got %+v", alert)
+	}
+	if alert.Message != "Item 'Rice' reached its reorder point (Stock: 1 kg, On order: 0 kg). Suggested order: 4 kg from Metro Wholesale" {
+		t.Fatalf("unexpected message %q", alert.Message)
+	}
+
+	if at, ok := reorder.marked[rice.ID]; !ok || at == nil {
+		t.Fatalf("expected rice to be marked as alerted")
+	}
+	if at, ok := reorder.marked[restocked]; !ok || at != nil {
+		t.Fatalf("expected the restocked item's mark to be cleared")
+	}
+	if len(reorder.marked) != 2 {
+		t.Fatalf("expected the already alerted item to be left alone, got %d marks", len(reorder.marked))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sqlmock expectations: %v", err)
+	}
+}
+
+func TestReorderService_UpdateSettings_ConvertsParLevelAndChecksSupplier(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	// Rice is kept in kg and bought in bags of 25 kg
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", TrackStock: true, Version: 1}
+	items := newMockItemsRepo(rice)
+	unitRepo := newMockUnitRepo()
+	unitRepo.conversions[rice.ID] = []*domain.ItemUnitConversion{{ItemID: rice.ID, Unit: "bag", Quantity: 25000}}
+
+	supplier := &domain.Supplier{ID: uuid.New(), OrganizationID: orgID, Name: "Metro Wholesale", LeadTimeDays: 2, IsActive: true}
+	suppliers := &mockSupplierRepo{suppliers: map[uuid.UUID]*domain.Supplier{supplier.ID: supplier}}
+	reorder := &mockReorderRepo{marked: make(map[uuid.UUID]*time.Time)}
+	alerts := &mockAlertRepo{}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	service := services.NewReorderService(reorder, items, suppliers, alerts, newInventoryService(db, items, unitRepo, alerts), db)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	par, bag := 2.0, "bag"
+	item, err := service.UpdateSettings(ctx, orgID, rice.ID, &domain.ReorderSettingsRequest{
+		ParLevel: &par, Unit: &bag, LeadTimeDays: intPtr(4), PreferredSupplierID: &supplier.ID,
+	})
+	if err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+	if item.ParLevel == nil || *item.ParLevel != 50000 || *item.LeadTimeDays != 4 || *item.PreferredSupplierID != supplier.ID {
+		t.Fatalf("expected a par level of two 25 kg bags, got %+v", item)
+	}
+
+	other := uuid.New()
+	if _, err := service.UpdateSettings(ctx, orgID, rice.ID, &domain.ReorderSettingsRequest{PreferredSupplierID: &other}); err != services.ErrSupplierNotFound {
+		t.Fatalf("expected ErrSupplierNotFound, got %v", err)
+	}
+	if _, err := service.UpdateSettings(ctx, uuid.New(), rice.ID, &domain.ReorderSettingsRequest{}); err != services.ErrItemNotFound {
+		t.Fatalf("expected ErrItemNotFound for another organization, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sqlmock expectations: %v", err)
+	}
+}
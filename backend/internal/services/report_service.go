@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
+)
+
+// MaxReportDays bounds the number of days a report covers
+const MaxReportDays = 366
+
+var (
+	ErrInvalidReportRange  = fmt.Errorf("report range must end on or after its start and cover at most %d days", MaxReportDays)
+	ErrInvalidReportPeriod = errors.New("period must be day, week or month")
+)
+
+// ReportService builds reports over the movement ledger
+type ReportService struct {
+	reportRepo repository.ReportRepository
+	inventory  *InventoryService
+	db         *sql.DB
+}
+
+func NewReportService(reportRepo repository.ReportRepository, inventory *InventoryService, db *sql.DB) *ReportService {
+	return &ReportService{
+		reportRepo: reportRepo,
+		inventory:  inventory,
+		db:         db,
+	}
+}
+
+// wastageRowKey identifies one row of the wastage report
+type wastageRowKey struct {
+	period string
+	reason string
+	itemID uuid.UUID
+}
+
+// wastageItem accumulates the base quantities of one item
+type wastageItem struct {
+	outflow           *domain.OutflowTotal
+	lost, waste, used int
+}
+
+// Wastage totals what the organization lost to each movement reason between
+// filter.From and filter.To by reason, item and period, and sets the waste
+// against usage. A reason filter narrows the losses; usage is still every
+// OUT movement without a reason.
+func (s *ReportService) Wastage(ctx context.Context, orgID uuid.UUID, filter *domain.WastageReportFilter) (*domain.WastageReport, error) {
+	from, to := truncateDay(filter.From), truncateDay(filter.To)
+	if to.Before(from) || to.Sub(from) >= MaxReportDays*24*time.Hour {
+		return nil, ErrInvalidReportRange
+	}
+	periodOf, err := reportPeriod(filter.Period)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons, err := s.inventory.ListMovementReasons(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]*domain.MovementReason, len(reasons))
+	for _, reason := range reasons {
+		byCode[reason.Code] = reason
+	}
+	if filter.ReasonCode != nil && byCode[*filter.ReasonCode] == nil {
+		return nil, ErrInvalidReason
+	}
+
+	registry, err := s.inventory.Units(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	outflows, err := s.reportRepo.ListOutflows(ctx, orgID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.WastageReport{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Period:   filter.Period,
+		ByReason: []*domain.WastageReasonTotal{},
+		ByItem:   []*domain.WastageItemTotal{},
+		ByPeriod: []*domain.WastagePeriodTotal{},
+		Rows:     []*domain.WastageRow{},
+	}
+	periods := make(map[string]*domain.WastagePeriodTotal)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		label := periodOf(day)
+		if periods[label] == nil {
+			periods[label] = &domain.WastagePeriodTotal{Period: label}
+			report.ByPeriod = append(report.ByPeriod, periods[label])
+		}
+	}
+
+	rows := make(map[wastageRowKey]int)
+	items := make(map[uuid.UUID]*wastageItem)
+	reasonCost := make(map[string]float64)
+	for _, o := range outflows {
+		if filter.ItemID != nil && o.ItemID != *filter.ItemID {
+			continue
+		}
+		if o.ReasonCode != nil && filter.ReasonCode != nil && *o.ReasonCode != *filter.ReasonCode {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", o.Day)
+		if err != nil {
+			return nil, fmt.Errorf("movement day %q: %w", o.Day, err)
+		}
+		period := periods[periodOf(day)]
+		if period == nil {
+			continue
+		}
+		cost, err := outflowCost(registry, o, o.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		item := items[o.ItemID]
+		if item == nil {
+			item = &wastageItem{outflow: o}
+			items[o.ItemID] = item
+		}
+		if o.ReasonCode == nil {
+			item.used += o.Quantity
+			period.UsageCost += cost
+			report.UsageCost += cost
+			continue
+		}
+
+		code := *o.ReasonCode
+		isWaste := byCode[code] != nil && byCode[code].IsWaste
+		item.lost += o.Quantity
+		period.LossCost += cost
+		report.LossCost += cost
+		if isWaste {
+			item.waste += o.Quantity
+			period.WasteCost += cost
+			report.WasteCost += cost
+		}
+		reasonCost[code] += cost
+		rows[wastageRowKey{period.Period, code, o.ItemID}] += o.Quantity
+	}
+
+	for key, quantity := range rows {
+		o := items[key.itemID].outflow
+		row := &domain.WastageRow{
+			Period:     key.period,
+			ReasonCode: key.reason,
+			ItemID:     o.ItemID,
+			ItemName:   o.ItemName,
+			Unit:       o.UnitOfMeasurement,
+		}
+		if row.Quantity, row.Cost, err = outflowDisplay(registry, o, quantity); err != nil {
+			return nil, err
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.ReasonCode != b.ReasonCode {
+			return a.ReasonCode < b.ReasonCode
+		}
+		return a.ItemName < b.ItemName
+	})
+
+	for code, cost := range reasonCost {
+		total := &domain.WastageReasonTotal{Code: code, Name: code, Cost: roundCost(cost)}
+		if reason := byCode[code]; reason != nil {
+			total.Name = reason.Name
+			total.IsWaste = reason.IsWaste
+		}
+		report.ByReason = append(report.ByReason, total)
+	}
+	sort.Slice(report.ByReason, func(i, j int) bool {
+		a, b := report.ByReason[i], report.ByReason[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.Code < b.Code
+	})
+
+	for _, item := range items {
+		if item.lost == 0 {
+			continue
+		}
+		o := item.outflow
+		total := &domain.WastageItemTotal{ItemID: o.ItemID, ItemName: o.ItemName, Unit: o.UnitOfMeasurement}
+		if total.Quantity, total.Cost, err = outflowDisplay(registry, o, item.lost); err != nil {
+			return nil, err
+		}
+		if total.WasteQuantity, total.WasteCost, err = outflowDisplay(registry, o, item.waste); err != nil {
+			return nil, err
+		}
+		if total.UsedQuantity, total.UsedCost, err = outflowDisplay(registry, o, item.used); err != nil {
+			return nil, err
+		}
+		total.WastePercent = wastePercent(float64(item.waste), float64(item.used))
+		report.ByItem = append(report.ByItem, total)
+	}
+	sort.Slice(report.ByItem, func(i, j int) bool {
+		a, b := report.ByItem[i], report.ByItem[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.ItemName < b.ItemName
+	})
+
+	for _, period := range report.ByPeriod {
+		period.WastePercent = wastePercent(period.WasteCost, period.UsageCost)
+		period.LossCost = roundCost(period.LossCost)
+		period.WasteCost = roundCost(period.WasteCost)
+		period.UsageCost = roundCost(period.UsageCost)
+	}
+	report.WastePercent = wastePercent(report.WasteCost, report.UsageCost)
+	report.LossCost = roundCost(report.LossCost)
+	report.WasteCost = roundCost(report.WasteCost)
+	report.UsageCost = roundCost(report.UsageCost)
+
+	return report, nil
+}
+
+// Valuation values the organization's stock at the end of asOf's day (UTC).
+// Items without stock on the day are left out.
+func (s *ReportService) Valuation(ctx context.Context, orgID uuid.UUID, asOf time.Time) (*domain.ValuationReport, error) {
+	day := truncateDay(asOf)
+	report, err := s.StockAt(ctx, orgID, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	report.AsOf = day.Format("2006-01-02")
+	return report, nil
+}
+
+// StockAt works out the organization's stock and its value at a time from
+// its last snapshot before then, moving forward through the movements
+// recorded since. Items the snapshot does not cover are worked back from
+// their open cost layers through the movements recorded after the time.
+// Stock no layer covers is valued at the item's current unit cost. Items
+// without stock at the time are left out.
+func (s *ReportService) StockAt(ctx context.Context, orgID uuid.UUID, at time.Time) (*domain.ValuationReport, error) {
+	at = at.UTC()
+	settings, err := s.inventory.GetCostingSettings(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := s.inventory.Units(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	snapshotAt, err := s.reportRepo.LatestSnapshotAt(ctx, orgID, at)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.reportRepo.ListValuation(ctx, orgID, snapshotAt, at)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.ValuationReport{
+		AsOf:       at.Format(time.RFC3339),
+		Method:     settings.Method,
+		Categories: []*domain.CategoryValuation{},
+		Items:      []*domain.ItemValuation{},
+	}
+	categories := make(map[uuid.UUID]*domain.CategoryValuation)
+	for _, row := range rows {
+		unit, err := registry.GetUnit(row.UnitOfMeasurement)
+		if err != nil {
+			return nil, err
+		}
+		stock, value := valuationStock(row, unit.Factor)
+		if stock <= 0 {
+			continue
+		}
+
+		quantity, err := registry.FromBaseUnit(stock, row.UnitOfMeasurement)
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, &domain.ItemValuation{
+			ItemID:       row.ItemID,
+			ItemName:     row.ItemName,
+			CategoryID:   row.CategoryID,
+			CategoryName: row.CategoryName,
+			Unit:         row.UnitOfMeasurement,
+			Quantity:     quantity,
+			Value:        value,
+			AverageCost:  roundCost(value / float64(stock) * float64(unit.Factor)),
+		})
+
+		category := categories[row.CategoryID]
+		if category == nil {
+			category = &domain.CategoryValuation{CategoryID: row.CategoryID, CategoryName: row.CategoryName}
+			categories[row.CategoryID] = category
+			report.Categories = append(report.Categories, category)
+		}
+		category.ItemCount++
+		category.Value += value
+		report.TotalValue += value
+	}
+
+	for _, category := range report.Categories {
+		category.Value = roundCost(category.Value)
+	}
+	report.TotalValue = roundCost(report.TotalValue)
+	return report, nil
+}
+
+// TakeStockSnapshots snapshots the stock of every organization at the start
+// of now's day (UTC), unless it has been snapshotted already, and returns
+// the number of items snapshotted. Items the snapshot misses are worked back
+// from their current stock until the next one. Each organization is
+// snapshotted whole in its own transaction: one that fails is left without
+// a snapshot for the day, the others are still taken, and the failures are
+// returned together.
+func (s *ReportService) TakeStockSnapshots(ctx context.Context, now time.Time) (int, error) {
+	takenAt := truncateDay(now)
+	orgIDs, err := s.reportRepo.ListUnsnapshottedOrganizations(ctx, takenAt)
+	if err != nil {
+		return 0, err
+	}
+
+	taken := 0
+	var errs []error
+	for _, orgID := range orgIDs {
+		var snapshotted int
+		err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+			snapshotted = 0
+			registry, err := s.inventory.Units(ctx, orgID)
+			if err != nil {
+				return err
+			}
+			rows, err := s.reportRepo.ListValuation(ctx, orgID, nil, takenAt)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				unit, err := registry.GetUnit(row.UnitOfMeasurement)
+				if err != nil {
+					return err
+				}
+				stock, value := valuationStock(row, unit.Factor)
+				if _, err := s.reportRepo.CreateSnapshot(ctx, &domain.StockSnapshot{
+					OrganizationID: orgID,
+					ItemID:         row.ItemID,
+					TakenAt:        takenAt,
+					Quantity:       stock,
+					Value:          value,
+				}); err != nil {
+					return err
+				}
+				snapshotted++
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot organization %s: %w", orgID, err))
+			continue
+		}
+		taken += snapshotted
+	}
+
+	return taken, errors.Join(errs...)
+}
+
+// valuationStock works out an item's stock in base units and its rounded
+// value from its valuation row, forward from its snapshot when it has one
+// and back from its current stock otherwise. factor is the number of base
+// units in the item's unit.
+func valuationStock(row *domain.ValuationRow, factor int) (int, float64) {
+	perBase := 0.0
+	if row.UnitCost != nil {
+		perBase = *row.UnitCost / float64(factor)
+	}
+	moved := row.MovedCost + float64(row.MovedUncosted)*perBase
+
+	if row.SnapshotQuantity != nil {
+		value := *row.SnapshotValue + moved
+		return *row.SnapshotQuantity + row.MovedStock, math.Max(roundCost(value), 0)
+	}
+
+	value := row.LayerValue
+	if uncovered := row.CurrentStock - row.LayerQuantity; uncovered > 0 {
+		value += float64(uncovered) * perBase
+	}
+	value -= moved
+	return row.CurrentStock - row.MovedStock, math.Max(roundCost(value), 0)
+}
+
+// reportPeriod returns the function labelling the period a day falls in:
+// the day itself, the Monday starting its week, or its month as YYYY-MM
+func reportPeriod(period domain.ReportPeriod) (func(time.Time) string, error) {
+	switch period {
+	case domain.ReportPeriodDay:
+		return func(day time.Time) string { return day.Format("2006-01-02") }, nil
+	case domain.ReportPeriodWeek:
+		return func(day time.Time) string {
+			return day.AddDate(0, 0, -(int(day.Weekday())+6)%7).Format("2006-01-02")
+		}, nil
+	case domain.ReportPeriodMonth:
+		return func(day time.Time) string { return day.Format("2006-01") }, nil
+	default:
+		return nil, ErrInvalidReportPeriod
+	}
+}
+
+// truncateDay returns the start of t's day in UTC
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// outflowCost is the unrounded cost of quantity base units of the item
+func outflowCost(registry *units.Registry, o *domain.OutflowTotal, quantity int) (float64, error) {
+	if o.UnitCost == nil {
+		return 0, nil
+	}
+	unit, err := registry.GetUnit(o.UnitOfMeasurement)
+	if err != nil {
+		return 0, err
+	}
+	return float64(quantity) / float64(unit.Factor) * *o.UnitCost, nil
+}
+
+// outflowDisplay states quantity base units of the item in its display unit
+// together with their cost
+func outflowDisplay(registry *units.Registry, o *domain.OutflowTotal, quantity int) (float64, float64, error) {
+	display, err := registry.FromBaseUnit(quantity, o.UnitOfMeasurement)
+	if err != nil {
+		return 0, 0, err
+	}
+	cost, err := outflowCost(registry, o, quantity)
+	if err != nil {
+		return 0, 0, err
+	}
+	return display, roundCost(cost), nil
+}
+
+// wastePercent is waste as a percentage of waste plus usage, nil when both
+// are zero
+func wastePercent(waste, usage float64) *float64 {
+	if waste+usage <= 0 {
+		return nil
+	}
+	percent := math.Round(waste/(waste+usage)*10000) / 100
+	return &percent
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*100) / 100
+}
@@ -0,0 +1,416 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockReportRepo returns the fixed outflows of the days asked for and the
+// fixed valuation rows, and keeps the snapshots taken. orgValuation, when
+// set, holds the valuation rows of each organization in orgOrder instead.
+type mockReportRepo struct {
+	outflows     []*domain.OutflowTotal
+	valuation    []*domain.ValuationRow
+	orgOrder     []uuid.UUID
+	orgValuation map[uuid.UUID][]*domain.ValuationRow
+	snapshotAt   *time.Time
+	snapshots    []*domain.StockSnapshot
+}
+
+func (m *mockReportRepo) ListOutflows(ctx context.Context, orgID uuid.UUID, from, to time.Time) ([]*domain.OutflowTotal, error) {
+	var outflows []*domain.OutflowTotal
+	for _, o := range m.outflows {
+		if o.Day >= from.Format("2006-01-02") && o.Day < to.Format("2006-01-02") {
+			outflows = append(outflows, o)
+		}
+	}
+	return outflows, nil
+}
+
+func (m *mockReportRepo) ListValuation(ctx context.Context, orgID uuid.UUID, snapshotAt *time.Time, asOf time.Time) ([]*domain.ValuationRow, error) {
+	if m.orgValuation != nil {
+		return m.orgValuation[orgID], nil
+	}
+	return m.valuation, nil
+}
+
+func (m *mockReportRepo) LatestSnapshotAt(ctx context.Context, orgID uuid.UUID, asOf time.Time) (*time.Time, error) {
+	if m.snapshotAt == nil || m.snapshotAt.After(asOf) {
+		return nil, nil
+	}
+	return m.snapshotAt, nil
+}
+
+func (m *mockReportRepo) ListUnsnapshottedOrganizations(ctx context.Context, takenAt time.Time) ([]uuid.UUID, error) {
+	var orgIDs []uuid.UUID
+	for _, snapshot := range m.snapshots {
+		if snapshot.TakenAt.Equal(takenAt) {
+			return nil, nil
+		}
+	}
+	if m.orgValuation != nil {
+		return m.orgOrder, nil
+	}
+	if len(m.valuation) > 0 {
+		orgIDs = append(orgIDs, uuid.New())
+	}
+	return orgIDs, nil
+}
+
+func (m *mockReportRepo) CreateSnapshot(ctx context.Context, snapshot *domain.StockSnapshot) (uuid.UUID, error) {
+	snapshot.ID = uuid.New()
+	m.snapshots = append(m.snapshots, snapshot)
+	return snapshot.ID, nil
+}
+
+func TestReportService_Wastage_TotalsByReasonItemAndPeriod(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	riceCost, milkCost := 60.0, 50.0
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", CurrentStock: 10000, UnitCost: &riceCost, IsActive: true, TrackStock: true, Version: 1}
+	milk := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Milk", UnitOfMeasurement: "ltr", CurrentStock: 5000, UnitCost: &milkCost, IsActive: true, TrackStock: true, Version: 1}
+	items := newMockItemsRepo(rice, milk)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	movements := &recordingMovementRepo{}
+	inventory := services.NewInventoryService(
+		items,
+		&mockCategoryRepo{},
+		movements,
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+
+	adjust := func(lines ...domain.BulkAdjustLine) error {
+		_, err := inventory.BulkAdjustStock(ctx, orgID, &domain.BulkAdjustRequest{Adjustments: lines}, userID)
+		return err
+	}
+	spoiled, unknown, theft := "WASTE_SPOILED", "MISPLACED", "THEFT"
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = adjust(
+		domain.BulkAdjustLine{ItemID: rice.ID, MovementType: domain.MovementTypeIn, Quantity: 1000, ReasonCode: &spoiled},
+		domain.BulkAdjustLine{ItemID: rice.ID, MovementType: domain.MovementTypeOut, Quantity: 1000, ReasonCode: &unknown},
+	)
+	var bulkErr *services.BulkAdjustError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Lines) != 2 ||
+		bulkErr.Lines[0].Field != "adjustments[0].reasonCode" || bulkErr.Lines[1].Field != "adjustments[1].reasonCode" {
+		t.Fatalf("expected a reason on IN and an unknown reason to be rejected, got %v", err)
+	}
+
+	reasons, err := inventory.ListMovementReasons(ctx, orgID)
+	if err != nil || len(reasons) != len(domain.DefaultMovementReasons) {
+		t.Fatalf("expected the default reasons, got %d (%v)", len(reasons), err)
+	}
+	for _, reason := range reasons {
+		if reason.Code == theft {
+			active := false
+			if err := inventory.UpdateMovementReason(ctx, reason, &domain.UpdateMovementReasonRequest{IsActive: &active}); err != nil {
+				t.Fatalf("UpdateMovementReason failed: %v", err)
+			}
+		}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := adjust(domain.BulkAdjustLine{ItemID: rice.ID, MovementType: domain.MovementTypeOut, Quantity: 1000, ReasonCode: &theft}); !errors.As(err, &bulkErr) {
+		t.Fatalf("expected a deactivated reason to be rejected, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	if err := adjust(domain.BulkAdjustLine{ItemID: rice.ID, MovementType: domain.MovementTypeOut, Quantity: 2000, ReasonCode: &spoiled}); err != nil {
+		t.Fatalf("BulkAdjustStock failed: %v", err)
+	}
+	if len(movements.created) != 1 || movements.created[0].ReasonCode == nil || *movements.created[0].ReasonCode != spoiled {
+		t.Fatalf("expected one OUT recorded as spoiled, got %+v", movements.created)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if _, err := inventory.CreateMovementReason(ctx, orgID, &domain.CreateMovementReasonRequest{Code: "expired", Name: "Expired", IsWaste: true}); err != nil {
+		t.Fatalf("CreateMovementReason failed: %v", err)
+	}
+	if _, err := inventory.CreateMovementReason(ctx, orgID, &domain.CreateMovementReasonRequest{Code: "EXPIRED", Name: "Past its date"}); err != services.ErrReasonCodeTaken {
+		t.Fatalf("expected EXPIRED to be taken, got %v", err)
+	}
+
+	meal, dropped := "STAFF_MEAL", "WASTE_DROPPED"
+	reports := &mockReportRepo{outflows: []*domain.OutflowTotal{
+		{Day: "2026-10-04", ReasonCode: &spoiled, ItemID: rice.ID, ItemName: "Rice", UnitOfMeasurement: "kg", UnitCost: &riceCost, Quantity: 9000},
+		{Day: "2026-10-05", ReasonCode: &spoiled, ItemID: rice.ID, ItemName: "Rice", UnitOfMeasurement: "kg", UnitCost: &riceCost, Quantity: 2000},
+		{Day: "2026-10-05", ItemID: rice.ID, ItemName: "Rice", UnitOfMeasurement: "kg", UnitCost: &riceCost, Quantity: 8000},
+		{Day: "2026-10-07", ReasonCode: &meal, ItemID: milk.ID, ItemName: "Milk", UnitOfMeasurement: "ltr", UnitCost: &milkCost, Quantity: 500},
+		{Day: "2026-10-13", ReasonCode: &dropped, ItemID: milk.ID, ItemName: "Milk", UnitOfMeasurement: "ltr", UnitCost: &milkCost, Quantity: 1000},
+		{Day: "2026-10-18", ItemID: milk.ID, ItemName: "Milk", UnitOfMeasurement: "ltr", UnitCost: &milkCost, Quantity: 3000},
+	}}
+	service := services.NewReportService(reports, inventory, db)
+
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	report, err := service.Wastage(ctx, orgID, &domain.WastageReportFilter{From: from, To: to, Period: domain.ReportPeriodWeek})
+	if err != nil {
+		t.Fatalf("Wastage failed: %v", err)
+	}
+
+	// Spoiled rice 120 and dropped milk 50 are waste; the staff meal of 25
+	// is a loss but not waste. Usage is 480 of rice and 150 of milk.
+	if report.LossCost != 195 || report.WasteCost != 170 || report.UsageCost != 630 || *report.WastePercent != 21.25 {
+		t.Fatalf("expected 195 lost, 170 wasted against 630 used (21.25%%), got %+v", report)
+	}
+	if len(report.ByPeriod) != 2 || report.ByPeriod[0].Period != "2026-10-05" || report.ByPeriod[1].Period != "2026-10-12" {
+		t.Fatalf("expected the weeks of 5 and 12 October, got %+v", report.ByPeriod)
+	}
+	if week := report.ByPeriod[0]; week.LossCost != 145 || week.WasteCost != 120 || *week.WastePercent != 20 {
+		t.Errorf("expected 120 of waste against 480 used in the first week, got %+v", week)
+	}
+	if len(report.ByReason) != 3 || report.ByReason[0].Code != spoiled || report.ByReason[0].Cost != 120 || report.ByReason[2].IsWaste {
+		t.Errorf("expected spoiled, dropped and staff meals by cost, got %+v", report.ByReason)
+	}
+	if len(report.ByItem) != 2 || report.ByItem[1].ItemID != milk.ID {
+		t.Fatalf("expected rice then milk, got %+v", report.ByItem)
+	}
+	if item := report.ByItem[1]; item.Quantity != 1.5 || item.Cost != 75 || item.WasteQuantity != 1 || item.UsedQuantity != 3 || *item.WastePercent != 25 {
+		t.Errorf("expected 1.5 ltr of milk lost, 1 ltr of it wasted against 3 ltr used, got %+v", item)
+	}
+	if len(report.Rows) != 3 || report.Rows[1].ReasonCode != spoiled || report.Rows[1].Quantity != 2 || report.Rows[1].Cost != 120 {
+		t.Errorf("expected 2 kg of spoiled rice after the staff meal of the first week, got %+v", report.Rows)
+	}
+
+	report, err = service.Wastage(ctx, orgID, &domain.WastageReportFilter{From: from, To: to, Period: domain.ReportPeriodMonth, ReasonCode: &meal})
+	if err != nil {
+		t.Fatalf("Wastage failed: %v", err)
+	}
+	if report.LossCost != 25 || report.WasteCost != 0 || report.UsageCost != 630 || len(report.ByPeriod) != 1 {
+		t.Errorf("expected only staff meals against all usage in one month, got %+v", report)
+	}
+
+	if _, err := service.Wastage(ctx, orgID, &domain.WastageReportFilter{From: from, To: to, Period: "year"}); err != services.ErrInvalidReportPeriod {
+		t.Errorf("expected a yearly report to be rejected, got %v", err)
+	}
+	if _, err := service.Wastage(ctx, orgID, &domain.WastageReportFilter{From: to, To: from, Period: domain.ReportPeriodDay}); err != services.ErrInvalidReportRange {
+		t.Errorf("expected a backwards range to be rejected, got %v", err)
+	}
+	if _, err := service.Wastage(ctx, orgID, &domain.WastageReportFilter{From: from, To: to, Period: domain.ReportPeriodDay, ReasonCode: &unknown}); err != services.ErrInvalidReason {
+		t.Errorf("expected an unknown reason to be rejected, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestReportService_Valuation_WorksBackFromCostLayers(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	inventory := services.NewInventoryService(
+		newMockItemsRepo(),
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		nil,
+	)
+
+	riceCost, milkCost, oilCost := 80.0, 40.0, 100.0
+	dry, dairy := uuid.New(), uuid.New()
+	reports := &mockReportRepo{valuation: []*domain.ValuationRow{
+		// 3 kg now: 1 kg at 50, 1 kg at 60 and 1 kg no layer covers. Since
+		// the day, 2 kg came in for 120 and 1 kg went out for 50.
+		{ItemID: uuid.New(), ItemName: "Rice", CategoryID: dry, CategoryName: "Dry Goods", UnitOfMeasurement: "kg", UnitCost: &riceCost,
+			CurrentStock: 3000, LayerQuantity: 2000, LayerValue: 110, MovedStock: 1000, MovedCost: 70},
+		// Half a litre was used since the day, before costing started
+		{ItemID: uuid.New(), ItemName: "Milk", CategoryID: dairy, CategoryName: "Dairy", UnitOfMeasurement: "ltr", UnitCost: &milkCost,
+			MovedStock: -500, MovedUncosted: -500},
+		// All of the oil came in after the day
+		{ItemID: uuid.New(), ItemName: "Oil", CategoryID: dry, CategoryName: "Dry Goods", UnitOfMeasurement: "ltr", UnitCost: &oilCost,
+			CurrentStock: 1000, LayerQuantity: 1000, LayerValue: 100, MovedStock: 1000, MovedCost: 100},
+	}}
+	service := services.NewReportService(reports, inventory, nil)
+
+	report, err := service.Valuation(ctx, orgID, time.Date(2026, 10, 5, 15, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Valuation failed: %v", err)
+	}
+
+	if report.AsOf != "2026-10-05" || report.Method != domain.CostingFIFO {
+		t.Errorf("expected a FIFO valuation as of 2026-10-05, got %s %s", report.Method, report.AsOf)
+	}
+	if len(report.Items) != 2 {
+		t.Fatalf("expected rice and milk, got %d items", len(report.Items))
+	}
+	rice, milk := report.Items[0], report.Items[1]
+	if rice.Quantity != 2 || rice.Value != 120 || rice.AverageCost != 60 {
+		t.Errorf("expected 2 kg of rice worth 120 at 60/kg, got %+v", rice)
+	}
+	if milk.Quantity != 0.5 || milk.Value != 20 || milk.AverageCost != 40 {
+		t.Errorf("expected 0.5 ltr of milk worth 20 at 40/ltr, got %+v", milk)
+	}
+	if report.TotalValue != 140 || len(report.Categories) != 2 || report.Categories[0].Value != 120 || report.Categories[1].ItemCount != 1 {
+		t.Errorf("expected 140 over two categories, got %+v", report)
+	}
+}
+
+func TestReportService_StockAt_WorksForwardFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	inventory := services.NewInventoryService(
+		newMockItemsRepo(),
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		nil,
+	)
+
+	riceCost, oilCost := 80.0, 100.0
+	dry := uuid.New()
+	snapshotAt := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	snapshotQuantity, snapshotValue := 2000, 100.0
+	reports := &mockReportRepo{snapshotAt: &snapshotAt, valuation: []*domain.ValuationRow{
+		// 2 kg worth 100 at the snapshot; since then 1 kg came in for 60 and
+		// half a kilo was used before costing started
+		{ItemID: uuid.New(), ItemName: "Rice", CategoryID: dry, CategoryName: "Dry Goods", UnitOfMeasurement: "kg", UnitCost: &riceCost,
+			CurrentStock: 9000, SnapshotQuantity: &snapshotQuantity, SnapshotValue: &snapshotValue,
+			MovedStock: 500, MovedCost: 60, MovedUncosted: -500},
+		// Oil was added after the snapshot, so it is worked back from now
+		{ItemID: uuid.New(), ItemName: "Oil", CategoryID: dry, CategoryName: "Dry Goods", UnitOfMeasurement: "ltr", UnitCost: &oilCost,
+			CurrentStock: 2000, LayerQuantity: 2000, LayerValue: 200, MovedStock: 1000, MovedCost: 100},
+	}}
+	service := services.NewReportService(reports, inventory, db)
+
+	report, err := service.StockAt(ctx, orgID, time.Date(2026, 10, 6, 12, 30, 0, 0, time.FixedZone("IST", 19800)))
+	if err != nil {
+		t.Fatalf("StockAt failed: %v", err)
+	}
+
+	if report.AsOf != "2026-10-06T07:00:00Z" {
+		t.Errorf("expected the time in UTC, got %s", report.AsOf)
+	}
+	if len(report.Items) != 2 {
+		t.Fatalf("expected rice and oil, got %d items", len(report.Items))
+	}
+	rice, oil := report.Items[0], report.Items[1]
+	if rice.Quantity != 2.5 || rice.Value != 120 || rice.AverageCost != 48 {
+		t.Errorf("expected 2.5 kg of rice worth 120 at 48/kg, got %+v", rice)
+	}
+	if oil.Quantity != 1 || oil.Value != 100 {
+		t.Errorf("expected 1 ltr of oil worth 100, got %+v", oil)
+	}
+	if report.TotalValue != 220 || len(report.Categories) != 1 || report.Categories[0].ItemCount != 2 {
+		t.Errorf("expected 220 in one category, got %+v", report)
+	}
+
+	// The snapshot is taken once a day, at its start, from the current stock
+	reports.valuation = reports.valuation[1:]
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	taken, err := service.TakeStockSnapshots(ctx, time.Date(2026, 10, 7, 1, 0, 0, 0, time.UTC))
+	if err != nil || taken != 1 {
+		t.Fatalf("expected one item snapshotted, got %d (%v)", taken, err)
+	}
+	snapshot := reports.snapshots[0]
+	if !snapshot.TakenAt.Equal(time.Date(2026, 10, 7, 0, 0, 0, 0, time.UTC)) || snapshot.Quantity != 1000 || snapshot.Value != 100 {
+		t.Errorf("expected 1000 ml of oil worth 100 at the start of the day, got %+v", snapshot)
+	}
+	if taken, err := service.TakeStockSnapshots(ctx, time.Date(2026, 10, 7, 2, 0, 0, 0, time.UTC)); err != nil || taken != 0 {
+		t.Errorf("expected the day to be snapshotted once, got %d (%v)", taken, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestReportService_TakeStockSnapshots_ContinuesPastFailedOrganization(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	inventory := services.NewInventoryService(
+		newMockItemsRepo(),
+		&mockCategoryRepo{},
+		&mockMovementRepo{},
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		nil,
+	)
+
+	// The first organization has an item in a unit it does not know, so it
+	// cannot be snapshotted; the second is still snapshotted
+	broken, healthy := uuid.New(), uuid.New()
+	reports := &mockReportRepo{
+		orgOrder: []uuid.UUID{broken, healthy},
+		orgValuation: map[uuid.UUID][]*domain.ValuationRow{
+			broken:  {{ItemID: uuid.New(), ItemName: "Flour", UnitOfMeasurement: "bushel", CurrentStock: 10}},
+			healthy: {{ItemID: uuid.New(), ItemName: "Oil", UnitOfMeasurement: "ltr", CurrentStock: 2000}},
+		},
+	}
+	service := services.NewReportService(reports, inventory, db)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	taken, err := service.TakeStockSnapshots(ctx, time.Date(2026, 10, 7, 1, 0, 0, 0, time.UTC))
+	if err == nil {
+		t.Fatal("expected the failed organization to be reported")
+	}
+	if taken != 1 || len(reports.snapshots) != 1 || reports.snapshots[0].OrganizationID != healthy {
+		t.Errorf("expected the second organization to be snapshotted, got %d (%+v)", taken, reports.snapshots)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
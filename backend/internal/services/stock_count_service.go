@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+	"hasufel.kj/pkg/units"
+)
+
+var (
+	ErrStockCountNotFound = errors.New("stock count not found")
+	// ErrStockCountNotOpen means counts were entered into, or a decision was
+	// made on, a session that was already approved or cancelled
+	ErrStockCountNotOpen = errors.New("stock count is not open")
+	// ErrNothingToCount means no active, tracked item is in the session's scope
+	ErrNothingToCount = errors.New("no items to count")
+	ErrNoCountLines   = errors.New("counts need at least one line")
+	// ErrItemNotCounted means a count names an item that is not on the session
+	ErrItemNotCounted = errors.New("item is not on the stock count")
+)
+
+// countPageSize is how many items are loaded at a time when opening a session
+const countPageSize = 500
+
+// StockCountError is returned when one or more counted lines fail validation
+type StockCountError struct {
+	Lines []BulkAdjustLineError
+}
+
+func (e *StockCountError) Error() string {
+	return fmt.Sprintf("stock count rejected: %d invalid line(s)", len(e.Lines))
+}
+
+func (e *StockCountError) add(field string, err error) {
+	e.Lines = append(e.Lines, BulkAdjustLineError{Field: field, Message: err.Error()})
+}
+
+// StockCountService runs counting sessions. Opening a session snapshots the
+// expected stock of every item in scope at the location; approving it posts
+// the counted variances as ADJUSTMENT movements through the
+// InventoryService.
+type StockCountService struct {
+	countRepo repository.StockCountRepository
+	itemRepo  repository.ItemRepository
+	inventory *InventoryService
+	db        *sql.DB
+}
+
+func NewStockCountService(countRepo repository.StockCountRepository, itemRepo repository.ItemRepository, inventory *InventoryService, db *sql.DB) *StockCountService {
+	return &StockCountService{
+		countRepo: countRepo,
+		itemRepo:  itemRepo,
+		inventory: inventory,
+		db:        db,
+	}
+}
+
+// ListStockCounts lists the organization's sessions, only those in status
+// when it is given
+func (s *StockCountService) ListStockCounts(ctx context.Context, orgID uuid.UUID, status *domain.StockCountStatus) ([]*domain.StockCount, error) {
+	counts, err := s.countRepo.List(ctx, orgID, status)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := s.inventory.Units(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		if err := reviewStockCount(count, registry); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func (s *StockCountService) GetStockCount(ctx context.Context, id uuid.UUID) (*domain.StockCount, error) {
+	count, err := s.countRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if count == nil {
+		return nil, ErrStockCountNotFound
+	}
+	return s.review(ctx, count)
+}
+
+// OpenStockCount opens a session for the active, tracked items at the
+// location, or at the default location when none is given, snapshotting
+// their expected stock and unit cost
+func (s *StockCountService) OpenStockCount(ctx context.Context, orgID, userID uuid.UUID, req *domain.CreateStockCountRequest) (*domain.StockCount, error) {
+	count := &domain.StockCount{
+		OrganizationID: orgID,
+		CategoryID:     req.CategoryID,
+		Status:         domain.StockCountOpen,
+		Notes:          trimmedOrNil(req.Notes),
+		CreatedBy:      userID,
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		if req.CategoryID != nil {
+			category, err := s.inventory.GetCategory(ctx, *req.CategoryID)
+			if err != nil {
+				return err
+			}
+			if category.OrganizationID != orgID {
+				return ErrCategoryNotFound
+			}
+		}
+
+		items, err := s.countableItems(ctx, orgID, req.CategoryID)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return ErrNothingToCount
+		}
+
+		location, stock, err := s.inventory.StockAtLocation(ctx, orgID, req.LocationID, items)
+		if err != nil {
+			return err
+		}
+		count.LocationID = location.ID
+
+		for _, item := range items {
+			count.Lines = append(count.Lines, &domain.StockCountLine{
+				ItemID:           item.ID,
+				ExpectedQuantity: stock[item.ID],
+				UnitCost:         item.UnitCost,
+				ItemName:         item.Name,
+				Unit:             item.UnitOfMeasurement,
+			})
+		}
+		_, err = s.countRepo.Create(ctx, count)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetStockCount(ctx, count.ID)
+}
+
+// countableItems lists the active, tracked items of the organization, only
+// those of categoryID when it is given, by name
+func (s *StockCountService) countableItems(ctx context.Context, orgID uuid.UUID, categoryID *uuid.UUID) ([]*domain.Item, error) {
+	var items []*domain.Item
+	for offset := 0; ; offset += countPageSize {
+		page, err := s.itemRepo.ListWithFilters(ctx, orgID, "", categoryID, false, countPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			if item.IsActive && item.TrackStock {
+				items = append(items, item)
+			}
+		}
+		if len(page) < countPageSize {
+			break
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// EnterCounts records counted quantities on an OPEN session. Invalid lines
+// are reported together as a *StockCountError and nothing is recorded.
+func (s *StockCountService) EnterCounts(ctx context.Context, orgID, countID, userID uuid.UUID, req *domain.EnterCountsRequest) (*domain.StockCount, error) {
+	if req == nil || len(req.Lines) == 0 {
+		return nil, ErrNoCountLines
+	}
+
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		count, err := s.openCount(ctx, orgID, countID)
+		if err != nil {
+			return err
+		}
+
+		lines := make(map[uuid.UUID]*domain.StockCountLine, len(count.Lines))
+		for _, line := range count.Lines {
+			lines[line.ItemID] = line
+		}
+
+		now := time.Now().UTC()
+		countErr := &StockCountError{}
+		var counted []*domain.StockCountLine
+		for i, entry := range req.Lines {
+			field := fmt.Sprintf("lines[%d]", i)
+
+			line := lines[entry.ItemID]
+			if line == nil {
+				countErr.add(field+".itemId", ErrItemNotCounted)
+				continue
+			}
+			quantity, lineField, err := s.countedQuantity(ctx, line, entry)
+			if err != nil {
+				if lineField == "" {
+					return err
+				}
+				countErr.add(field+"."+lineField, err)
+				continue
+			}
+
+			if entry.Add && line.CountedQuantity != nil {
+				quantity += *line.CountedQuantity
+			}
+			line.CountedQuantity = &quantity
+			line.CountedBy = &userID
+			line.CountedAt = &now
+			counted = append(counted, line)
+		}
+		if len(countErr.Lines) > 0 {
+			return countErr
+		}
+
+		for _, line := range counted {
+			if err := s.countRepo.SetCounted(ctx, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetStockCount(ctx, countID)
+}
+
+// countedQuantity converts an entered count to base units of the line's
+// item. On failure the returned field names the offending input; it is
+// empty for errors that are not the caller's fault.
+func (s *StockCountService) countedQuantity(ctx context.Context, line *domain.StockCountLine, entry domain.StockCountEntry) (int, string, error) {
+	if entry.Quantity < 0 {
+		return 0, "quantity", ErrInvalidQuantity
+	}
+
+	item, err := s.itemRepo.GetByID(ctx, line.ItemID)
+	if err != nil {
+		return 0, "", err
+	}
+	if item == nil {
+		return 0, "itemId", ErrItemNotFound
+	}
+	registry, err := s.inventory.ItemUnits(ctx, item)
+	if err != nil {
+		return 0, "", err
+	}
+
+	code := item.UnitOfMeasurement
+	if entry.Unit != nil {
+		code = *entry.Unit
+	}
+	measure, err := registry.GetUnit(code)
+	if err != nil {
+		return 0, "unit", err
+	}
+	own, err := registry.GetUnit(item.UnitOfMeasurement)
+	if err != nil || own.BaseUnit != measure.BaseUnit {
+		return 0, "unit", fmt.Errorf("%w: %s and %s", units.ErrIncompatibleUnits, code, item.UnitOfMeasurement)
+	}
+
+	quantity, err := registry.ToBaseUnit(entry.Quantity, code)
+	if err != nil {
+		return 0, "quantity", ErrInvalidQuantity
+	}
+	return quantity, "", nil
+}
+
+// ApproveStockCount posts the variance of every counted line as an
+// ADJUSTMENT at the session's location, all in one transaction and with the
+// session ID as their reference, and marks the session APPROVED. The
+// variance is applied to the stock at approval, so movements posted while
+// counting are kept. Lines that were not counted are left alone.
+func (s *StockCountService) ApproveStockCount(ctx context.Context, orgID, countID, userID uuid.UUID) (*domain.StockCount, error) {
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		count, err := s.openCount(ctx, orgID, countID)
+		if err != nil {
+			return err
+		}
+
+		var (
+			items []*domain.Item
+			lines []*domain.StockCountLine
+		)
+		for _, line := range count.Lines {
+			variance := line.VarianceQuantity()
+			if variance == nil || *variance == 0 {
+				continue
+			}
+			item, err := s.itemRepo.GetByID(ctx, line.ItemID)
+			if err != nil {
+				return err
+			}
+			if item == nil {
+				return ErrItemNotFound
+			}
+			items = append(items, item)
+			lines = append(lines, line)
+		}
+
+		if len(lines) > 0 {
+			_, stock, err := s.inventory.StockAtLocation(ctx, orgID, &count.LocationID, items)
+			if err != nil {
+				return err
+			}
+
+			notes := "Stock count"
+			var (
+				adjustments []domain.BulkAdjustLine
+				adjusted    []*domain.StockCountLine
+			)
+			for i, line := range lines {
+				current := stock[items[i].ID]
+				target := max(current+*line.VarianceQuantity(), 0)
+				if target == current {
+					continue
+				}
+				adjustments = append(adjustments, domain.BulkAdjustLine{
+					ItemID:       line.ItemID,
+					MovementType: domain.MovementTypeAdjustment,
+					Quantity:     target,
+					LocationID:   &count.LocationID,
+					Notes:        &notes,
+				})
+				adjusted = append(adjusted, line)
+			}
+
+			if len(adjustments) > 0 {
+				reference := count.ID.String()
+				movements, err := s.inventory.BulkAdjustStock(ctx, orgID, &domain.BulkAdjustRequest{
+					Reference:   &reference,
+					Adjustments: adjustments,
+				}, userID)
+				if err != nil {
+					return err
+				}
+				for i, movement := range movements {
+					if err := s.countRepo.SetMovement(ctx, adjusted[i].ID, movement.ID); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		now := time.Now().UTC()
+		count.Status = domain.StockCountApproved
+		count.ApprovedBy = &userID
+		count.ApprovedAt = &now
+		return s.countRepo.Update(ctx, count)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetStockCount(ctx, countID)
+}
+
+// CancelStockCount abandons an OPEN session without posting anything
+func (s *StockCountService) CancelStockCount(ctx context.Context, count *domain.StockCount) error {
+	if count.Status != domain.StockCountOpen {
+		return ErrStockCountNotOpen
+	}
+	count.Status = domain.StockCountCancelled
+	return s.countRepo.Update(ctx, count)
+}
+
+// openCount loads an OPEN session of the organization
+func (s *StockCountService) openCount(ctx context.Context, orgID, countID uuid.UUID) (*domain.StockCount, error) {
+	count, err := s.countRepo.GetByID(ctx, countID)
+	if err != nil {
+		return nil, err
+	}
+	if count == nil || count.OrganizationID != orgID {
+		return nil, ErrStockCountNotFound
+	}
+	if count.Status != domain.StockCountOpen {
+		return nil, ErrStockCountNotOpen
+	}
+	return count, nil
+}
+
+func (s *StockCountService) review(ctx context.Context, count *domain.StockCount) (*domain.StockCount, error) {
+	registry, err := s.inventory.Units(ctx, count.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := reviewStockCount(count, registry); err != nil {
+		return nil, err
+	}
+	return count, nil
+}
+
+// reviewStockCount states the session's quantities in the unit of each item
+// and totals the lines counted, the lines off and the cost of the variances
+func reviewStockCount(count *domain.StockCount, registry *units.Registry) error {
+	display := func(base int, unit string) (float64, error) {
+		if base < 0 {
+			value, err := registry.FromBaseUnit(-base, unit)
+			return -value, err
+		}
+		return registry.FromBaseUnit(base, unit)
+	}
+
+	totalCost := 0.0
+	count.CountedLines, count.VarianceLines = 0, 0
+	for _, line := range count.Lines {
+		expected, err := display(line.ExpectedQuantity, line.Unit)
+		if err != nil {
+			return err
+		}
+		line.Expected = expected
+		line.Counted, line.Variance, line.VarianceCost = nil, nil, nil
+
+		if line.CountedQuantity == nil {
+			continue
+		}
+		count.CountedLines++
+		counted, err := display(*line.CountedQuantity, line.Unit)
+		if err != nil {
+			return err
+		}
+		variance, err := display(*line.VarianceQuantity(), line.Unit)
+		if err != nil {
+			return err
+		}
+		line.Counted = &counted
+		line.Variance = &variance
+		if variance != 0 {
+			count.VarianceLines++
+		}
+		if line.UnitCost != nil {
+			cost := math.Round(variance**line.UnitCost*100) / 100
+			line.VarianceCost = &cost
+			totalCost += cost
+		}
+	}
+
+	totalCost = math.Round(totalCost*100) / 100
+	count.VarianceCost = &totalCost
+	return nil
+}
@@ -0,0 +1,245 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/services"
+)
+
+// mockStockCountRepo keeps sessions in memory, handing out copies as a
+// database would
+type mockStockCountRepo struct {
+	counts map[uuid.UUID]*domain.StockCount
+}
+
+func copyStockCount(count *domain.StockCount) *domain.StockCount {
+	copied := *count
+	copied.Lines = make([]*domain.StockCountLine, 0, len(count.Lines))
+	for _, line := range count.Lines {
+		lineCopy := *line
+		copied.Lines = append(copied.Lines, &lineCopy)
+	}
+	return &copied
+}
+
+func (m *mockStockCountRepo) Create(ctx context.Context, count *domain.StockCount) (uuid.UUID, error) {
+	count.ID = uuid.New()
+	for i, line := range count.Lines {
+		line.ID = uuid.New()
+		line.StockCountID = count.ID
+		line.Position = i
+	}
+	m.counts[count.ID] = copyStockCount(count)
+	return count.ID, nil
+}
+
+func (m *mockStockCountRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.StockCount, error) {
+	count, ok := m.counts[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyStockCount(count), nil
+}
+
+func (m *mockStockCountRepo) List(ctx context.Context, orgID uuid.UUID, status *domain.StockCountStatus) ([]*domain.StockCount, error) {
+	var counts []*domain.StockCount
+	for _, count := range m.counts {
+		if count.OrganizationID == orgID && (status == nil || count.Status == *status) {
+			counts = append(counts, copyStockCount(count))
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockStockCountRepo) Update(ctx context.Context, count *domain.StockCount) error {
+	stored := m.counts[count.ID]
+	lines := stored.Lines
+	*stored = *count
+	stored.Lines = lines
+	return nil
+}
+
+func (m *mockStockCountRepo) line(id uuid.UUID) *domain.StockCountLine {
+	for _, count := range m.counts {
+		for _, line := range count.Lines {
+			if line.ID == id {
+				return line
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockStockCountRepo) SetCounted(ctx context.Context, line *domain.StockCountLine) error {
+	stored := m.line(line.ID)
+	stored.CountedQuantity = line.CountedQuantity
+	stored.CountedBy = line.CountedBy
+	stored.CountedAt = line.CountedAt
+	return nil
+}
+
+func (m *mockStockCountRepo) SetMovement(ctx context.Context, lineID, movementID uuid.UUID) error {
+	m.line(lineID).MovementID = &movementID
+	return nil
+}
+
+// recordingMovementRepo keeps the movements it is asked to create
+type recordingMovementRepo struct {
+	mockMovementRepo
+	created []*domain.StockMovement
+}
+
+func (m *recordingMovementRepo) Create(ctx context.Context, movement *domain.StockMovement) (uuid.UUID, error) {
+	m.created = append(m.created, movement)
+	return uuid.New(), nil
+}
+
+func TestStockCountService_CountAndApprove_PostsVariances(t *testing.T) {
+	ctx := context.Background()
+	orgID, userID := uuid.New(), uuid.New()
+
+	riceCost, oilCost := 60.0, 100.0
+	rice := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Rice", UnitOfMeasurement: "kg", CurrentStock: 10000, UnitCost: &riceCost, IsActive: true, TrackStock: true, Version: 1}
+	oil := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Oil", UnitOfMeasurement: "ltr", CurrentStock: 5000, UnitCost: &oilCost, IsActive: true, TrackStock: true, Version: 1}
+	retired := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Saffron", UnitOfMeasurement: "gm", TrackStock: true, Version: 1}
+	napkins := &domain.Item{ID: uuid.New(), OrganizationID: orgID, Name: "Napkins", UnitOfMeasurement: "pcs", IsActive: true, Version: 1}
+	items := newMockItemsRepo(rice, oil, retired, napkins)
+	items.items = []*domain.Item{rice, oil, retired, napkins}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	movements := &recordingMovementRepo{}
+	inventory := services.NewInventoryService(
+		items,
+		&mockCategoryRepo{},
+		movements,
+		&mockAlertRepo{},
+		newMockLocationRepo(),
+		newMockStockLevelRepo(),
+		newMockStockLotRepo(),
+		newMockUnitRepo(),
+		newMockMovementReasonRepo(),
+		newMockCostingRepo(),
+		db,
+	)
+	counts := &mockStockCountRepo{counts: make(map[uuid.UUID]*domain.StockCount)}
+	service := services.NewStockCountService(counts, items, inventory, db)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	// A count for an item outside the session rolls the whole entry back
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	// Rice is used while the count is under review
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	count, err := service.OpenStockCount(ctx, orgID, userID, &domain.CreateStockCountRequest{})
+	if err != nil {
+		t.Fatalf("OpenStockCount failed: %v", err)
+	}
+	if len(count.Lines) != 2 || count.Lines[0].ItemID != oil.ID || count.Lines[1].ItemID != rice.ID {
+		t.Fatalf("expected oil and rice by name, got %d lines", len(count.Lines))
+	}
+	if count.Lines[1].ExpectedQuantity != 10000 || *count.Lines[1].UnitCost != 60 {
+		t.Fatalf("expected a 10 kg snapshot of rice at 60, got %+v", count.Lines[1])
+	}
+
+	enter := func(entries ...domain.StockCountEntry) (*domain.StockCount, error) {
+		return service.EnterCounts(ctx, orgID, count.ID, userID, &domain.EnterCountsRequest{Lines: entries})
+	}
+
+	_, err = enter(
+		domain.StockCountEntry{ItemID: rice.ID, Quantity: 8},
+		domain.StockCountEntry{ItemID: retired.ID, Quantity: 1},
+	)
+	var countErr *services.StockCountError
+	if !errors.As(err, &countErr) || len(countErr.Lines) != 1 || countErr.Lines[0].Field != "lines[1].itemId" {
+		t.Fatalf("expected lines[1].itemId to be rejected, got %v", err)
+	}
+
+	// Two people count rice on different shelves
+	if _, err := enter(
+		domain.StockCountEntry{ItemID: rice.ID, Quantity: 8},
+		domain.StockCountEntry{ItemID: oil.ID, Quantity: 6},
+	); err != nil {
+		t.Fatalf("EnterCounts failed: %v", err)
+	}
+	ml := "ml"
+	if _, err := enter(domain.StockCountEntry{ItemID: rice.ID, Quantity: 500, Unit: &ml, Add: true}); !errors.As(err, &countErr) || countErr.Lines[0].Field != "lines[0].unit" {
+		t.Fatalf("expected millilitres of rice to be rejected, got %v", err)
+	}
+	gm := "gm"
+	count, err = enter(domain.StockCountEntry{ItemID: rice.ID, Quantity: 500, Unit: &gm, Add: true})
+	if err != nil {
+		t.Fatalf("adding to the rice count failed: %v", err)
+	}
+
+	riceLine := count.Lines[1]
+	if riceLine.Counted == nil || *riceLine.Counted != 8.5 || *riceLine.Variance != -1.5 || *riceLine.VarianceCost != -90 {
+		t.Fatalf("expected 8.5 kg of rice counted, 1.5 kg short at a cost of 90, got %+v", riceLine)
+	}
+	if count.CountedLines != 2 || count.VarianceLines != 2 || *count.VarianceCost != 10 {
+		t.Fatalf("expected a net variance of 10 over two lines, got %+v", count)
+	}
+
+	if _, err := inventory.BulkAdjustStock(ctx, orgID, &domain.BulkAdjustRequest{Adjustments: []domain.BulkAdjustLine{
+		{ItemID: rice.ID, MovementType: domain.MovementTypeOut, Quantity: 2000},
+	}}, userID); err != nil {
+		t.Fatalf("BulkAdjustStock failed: %v", err)
+	}
+	movements.created = nil
+
+	count, err = service.ApproveStockCount(ctx, orgID, count.ID, userID)
+	if err != nil {
+		t.Fatalf("ApproveStockCount failed: %v", err)
+	}
+	if count.Status != domain.StockCountApproved || count.ApprovedBy == nil || *count.ApprovedBy != userID {
+		t.Fatalf("expected the count to be approved, got %+v", count)
+	}
+	if len(movements.created) != 2 {
+		t.Fatalf("expected two adjustments, got %d", len(movements.created))
+	}
+	for _, movement := range movements.created {
+		if movement.MovementType != domain.MovementTypeAdjustment || movement.Reference == nil || *movement.Reference != count.ID.String() {
+			t.Errorf("expected an ADJUSTMENT referencing the count, got %+v", movement)
+		}
+	}
+	// The shortfall is taken off what was left after the rice used since
+	// the snapshot
+	if rice.CurrentStock != 6500 || oil.CurrentStock != 6000 {
+		t.Errorf("expected 6.5 kg of rice and 6 ltr of oil, got %d and %d", rice.CurrentStock, oil.CurrentStock)
+	}
+	for _, line := range count.Lines {
+		if line.MovementID == nil {
+			t.Errorf("expected %s to record its adjustment", line.ItemName)
+		}
+	}
+
+	if _, err := service.ApproveStockCount(ctx, orgID, count.ID, userID); err != services.ErrStockCountNotOpen {
+		t.Errorf("expected an approved count to be closed, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
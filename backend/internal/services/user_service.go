@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"hasufel.kj/internal/domain"
+	"hasufel.kj/internal/repository"
+)
+
+var (
+	ErrInvalidRole  = errors.New("role must be ADMIN, MANAGER or USER")
+	ErrInvalidEmail = errors.New("a valid email address is required")
+	ErrInvalidName  = errors.New("first and last name must not be empty")
+	// ErrLastAdmin means a change would leave the organization without an
+	// active admin
+	ErrLastAdmin = errors.New("the organization needs at least one active admin")
+	// ErrDeactivateSelf means an admin tried to deactivate their own account
+	ErrDeactivateSelf = errors.New("you cannot deactivate your own account")
+	// ErrNameNotEditable means an admin tried to rename a user whose account
+	// belongs to another organization; the name is shared by all of them
+	ErrNameNotEditable      = errors.New("only the user's home organization can change their name")
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvitationNotPending = errors.New("invitation was already accepted, revoked or has expired")
+)
+
+// DefaultInvitationLifetime is how long an invitation can be accepted when
+// no lifetime is configured
+const DefaultInvitationLifetime = 7 * 24 * time.Hour
+
+// UserService lets admins manage the users of their organization: invite
+// new users, change their names and roles, and deactivate them. Roles and
+// deactivation apply to the user's membership of the organization. Users
+// are never deleted, as the movements they posted refer to them. A role
+// change expires the user's access tokens so their clients refresh them
+// with the new role; deactivation revokes every session at once.
+type UserService struct {
+	userRepo       repository.UserRepository
+	orgRepo        repository.OrganizationRepository
+	invitationRepo repository.InvitationRepository
+	auth           *AuthService
+	db             *sql.DB
+	invitationTTL  time.Duration
+}
+
+func NewUserService(userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, invitationRepo repository.InvitationRepository, auth *AuthService, db *sql.DB, invitationTTL time.Duration) *UserService {
+	if invitationTTL <= 0 {
+		invitationTTL = DefaultInvitationLifetime
+	}
+	return &UserService{
+		userRepo:       userRepo,
+		orgRepo:        orgRepo,
+		invitationRepo: invitationRepo,
+		auth:           auth,
+		db:             db,
+		invitationTTL:  invitationTTL,
+	}
+}
+
+// User methods
+
+// ListUsers lists the organization's users, newest first
+func (s *UserService) ListUsers(ctx context.Context, orgID uuid.UUID) ([]*domain.User, error) {
+	return s.userRepo.List(ctx, orgID)
+}
+
+// GetUser returns a user as a member of the organization
+func (s *UserService) GetUser(ctx context.Context, orgID, id uuid.UUID) (*domain.User, error) {
+	user, err := s.userRepo.GetMember(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// UpdateUser applies the changes the admin actorID makes to a user, as a
+// member of their organization. The name belongs to the account, so only the
+// organization the account was registered in can change it.
+func (s *UserService) UpdateUser(ctx context.Context, actorID uuid.UUID, user *domain.User, req *domain.UpdateUserRequest) error {
+	wasAdmin := user.Role == domain.RoleAdmin && user.IsActive
+	roleChanged, deactivated := false, false
+
+	if req.FirstName != nil {
+		name := strings.TrimSpace(*req.FirstName)
+		if name == "" {
+			return ErrInvalidName
+		}
+		user.FirstName = name
+	}
+	if req.LastName != nil {
+		name := strings.TrimSpace(*req.LastName)
+		if name == "" {
+			return ErrInvalidName
+		}
+		user.LastName = name
+	}
+	if req.Role != nil && *req.Role != user.Role {
+		if !validRole(*req.Role) {
+			return ErrInvalidRole
+		}
+		user.Role = *req.Role
+		roleChanged = true
+	}
+	if req.IsActive != nil && *req.IsActive != user.IsActive {
+		if !*req.IsActive && user.ID == actorID {
+			return ErrDeactivateSelf
+		}
+		user.IsActive = *req.IsActive
+		deactivated = !user.IsActive
+	}
+
+	return repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		if wasAdmin && (user.Role != domain.RoleAdmin || !user.IsActive) {
+			admins, err := s.activeAdmins(ctx, user.OrganizationID)
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return ErrLastAdmin
+			}
+		}
+
+		account, err := s.userRepo.GetByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if account == nil {
+			return ErrUserNotFound
+		}
+		if account.FirstName != user.FirstName || account.LastName != user.LastName {
+			if account.OrganizationID != user.OrganizationID {
+				return ErrNameNotEditable
+			}
+			account.FirstName, account.LastName = user.FirstName, user.LastName
+			if err := s.userRepo.Update(ctx, account); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orgRepo.UpdateMember(ctx, &domain.Membership{
+			OrganizationID: user.OrganizationID,
+			UserID:         user.ID,
+			Role:           user.Role,
+			IsActive:       user.IsActive,
+		}); err != nil {
+			return err
+		}
+
+		switch {
+		case deactivated:
+			return s.auth.RevokeOrganizationSessions(ctx, user.ID, user.OrganizationID)
+		case roleChanged:
+			return s.auth.ExpireAccessTokens(ctx, user.ID)
+		}
+		return nil
+	})
+}
+
+// DeactivateUser deactivates a user's membership of the admin actorID's
+// organization and revokes the user's sessions in it
+func (s *UserService) DeactivateUser(ctx context.Context, actorID uuid.UUID, user *domain.User) error {
+	inactive := false
+	return s.UpdateUser(ctx, actorID, user, &domain.UpdateUserRequest{IsActive: &inactive})
+}
+
+// activeAdmins counts the organization's active admins
+func (s *UserService) activeAdmins(ctx context.Context, orgID uuid.UUID) (int, error) {
+	users, err := s.userRepo.List(ctx, orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	admins := 0
+	for _, u := range users {
+		if u.Role == domain.RoleAdmin && u.IsActive {
+			admins++
+		}
+	}
+	return admins, nil
+}
+
+// Invitation methods
+
+// InviteUser invites the email to join the organization with a role,
+// USER unless given. Earlier invitations of the email still open are
+// revoked. The token of the new invitation is returned with it, and only
+// here; the invitee registers with it.
+func (s *UserService) InviteUser(ctx context.Context, orgID, invitedBy uuid.UUID, req *domain.InviteUserRequest) (*domain.CreatedInvitation, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		return nil, ErrInvalidEmail
+	}
+	role := req.Role
+	if role == "" {
+		role = domain.RoleUser
+	}
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	email := strings.ToLower(addr.Address)
+
+	var invitation *domain.CreatedInvitation
+	err = repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		existing, err := s.userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrEmailExists
+		}
+
+		invitation, err = s.invite(ctx, orgID, invitedBy, email, role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// invite revokes the invitations of the email to the organization still
+// open and creates a new one, returned with its token
+func (s *UserService) invite(ctx context.Context, orgID, invitedBy uuid.UUID, email string, role domain.UserRole) (*domain.CreatedInvitation, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	inv := &domain.UserInvitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      hashToken(token),
+		InvitedBy:      invitedBy,
+		ExpiresAt:      now.Add(s.invitationTTL),
+	}
+	if err := s.invitationRepo.RevokeOpen(ctx, orgID, email, now); err != nil {
+		return nil, err
+	}
+	if err := s.invitationRepo.Create(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	inv.Status = domain.InvitationPending
+	return &domain.CreatedInvitation{UserInvitation: inv, Token: token}, nil
+}
+
+// ListInvitations lists the organization's invitations, newest first
+func (s *UserService) ListInvitations(ctx context.Context, orgID uuid.UUID) ([]*domain.UserInvitation, error) {
+	invitations, err := s.invitationRepo.List(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for _, inv := range invitations {
+		inv.Status = inv.StatusAt(now)
+	}
+	return invitations, nil
+}
+
+func (s *UserService) GetInvitation(ctx context.Context, id uuid.UUID) (*domain.UserInvitation, error) {
+	inv, err := s.invitationRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil {
+		return nil, ErrInvitationNotFound
+	}
+	inv.Status = inv.StatusAt(time.Now().UTC())
+	return inv, nil
+}
+
+// RevokeInvitation revokes an invitation that is still pending
+func (s *UserService) RevokeInvitation(ctx context.Context, inv *domain.UserInvitation) error {
+	now := time.Now().UTC()
+	if inv.StatusAt(now) != domain.InvitationPending {
+		return ErrInvitationNotPending
+	}
+	if err := s.invitationRepo.Revoke(ctx, inv.ID, now); err != nil {
+		return err
+	}
+
+	inv.RevokedAt = &now
+	inv.Status = domain.InvitationRevoked
+	return nil
+}
+
+func validRole(role domain.UserRole) bool {
+	for _, r := range domain.Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
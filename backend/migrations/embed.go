@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations for every supported dialect.
+package migrations
+
+import "embed"
+
+// FS holds sqlite/*.sql and postgres/*.sql, applied by database.Migrator
+//
+//go:embed sqlite/*.sql postgres/*.sql
+var FS embed.FS
@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS check_low_stock_alert ON items;
+DROP TRIGGER IF EXISTS update_items_updated_at ON items;
+DROP TRIGGER IF EXISTS update_categories_updated_at ON categories;
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
+
+DROP FUNCTION IF EXISTS check_low_stock_alert();
+DROP FUNCTION IF EXISTS set_updated_at();
+
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS stock_movements;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,17 @@
+-- Transfers cannot be represented without locations and are dropped
+DELETE FROM stock_movements WHERE movement_type = 'TRANSFER';
+
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_movement_type_check;
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_movement_type_check
+    CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT'));
+
+DROP INDEX IF EXISTS idx_movements_location;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS to_location_id;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS location_id;
+
+DROP INDEX IF EXISTS idx_stock_levels_location;
+DROP TABLE IF EXISTS stock_levels;
+
+DROP TRIGGER IF EXISTS update_locations_updated_at ON locations;
+DROP INDEX IF EXISTS idx_locations_default;
+DROP TABLE IF EXISTS locations;
@@ -0,0 +1,57 @@
+-- Storage locations (walk-in cooler, dry store, line, bar, ...)
+CREATE TABLE IF NOT EXISTS locations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name)
+);
+
+-- At most one default location per organization
+CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_default ON locations(organization_id) WHERE is_default = TRUE;
+
+CREATE TRIGGER update_locations_updated_at
+    BEFORE UPDATE ON locations
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Per-location stock in base units. items.current_stock stays the total
+-- across locations.
+CREATE TABLE IF NOT EXISTS stock_levels (
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE RESTRICT,
+    quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    minimum_threshold INTEGER CHECK (minimum_threshold >= 0),
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, location_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_levels_location ON stock_levels(location_id);
+
+ALTER TABLE stock_movements
+    ADD COLUMN location_id UUID REFERENCES locations(id) ON DELETE RESTRICT,
+    ADD COLUMN to_location_id UUID REFERENCES locations(id) ON DELETE RESTRICT;
+
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_movement_type_check;
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_movement_type_check
+    CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT', 'TRANSFER'));
+
+CREATE INDEX IF NOT EXISTS idx_movements_location ON stock_movements(location_id);
+
+-- Every existing organization gets a default location holding all its stock
+INSERT INTO locations (organization_id, name, description, is_default)
+SELECT id, 'Main Store', 'Default location', TRUE FROM organizations;
+
+INSERT INTO stock_levels (item_id, location_id, quantity)
+SELECT i.id, l.id, COALESCE(i.current_stock, 0)
+FROM items i
+JOIN locations l ON l.organization_id = i.organization_id AND l.is_default = TRUE;
+
+UPDATE stock_movements sm
+SET location_id = l.id
+FROM items i
+JOIN locations l ON l.organization_id = i.organization_id AND l.is_default = TRUE
+WHERE sm.item_id = i.id;
@@ -0,0 +1,12 @@
+-- Expiry alerts cannot be represented without the new type and are dropped
+DELETE FROM alerts WHERE type = 'EXPIRY';
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_type_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_type_check
+    CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK'));
+
+DROP INDEX IF EXISTS idx_stock_movement_lots_lot;
+DROP TABLE IF EXISTS stock_movement_lots;
+DROP INDEX IF EXISTS idx_stock_lots_expires_at;
+DROP INDEX IF EXISTS idx_stock_lots_item_location;
+DROP TABLE IF EXISTS stock_lots;
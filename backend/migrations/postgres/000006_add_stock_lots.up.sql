@@ -0,0 +1,32 @@
+-- Lots of received stock with optional expiry, consumed first-expiry-first-out.
+-- quantity is what is left of the lot at its location, in base units.
+CREATE TABLE IF NOT EXISTS stock_lots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE RESTRICT,
+    lot_number VARCHAR(100),
+    received_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ,
+    initial_quantity INTEGER NOT NULL CHECK (initial_quantity >= 0),
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    movement_id UUID REFERENCES stock_movements(id) ON DELETE SET NULL,
+    expiry_alerted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_lots_item_location ON stock_lots(item_id, location_id, expires_at);
+CREATE INDEX IF NOT EXISTS idx_stock_lots_expires_at ON stock_lots(expires_at);
+
+-- How much of each lot a movement consumed
+CREATE TABLE IF NOT EXISTS stock_movement_lots (
+    movement_id UUID NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    lot_id UUID NOT NULL REFERENCES stock_lots(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (movement_id, lot_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movement_lots_lot ON stock_movement_lots(lot_id);
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_type_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_type_check
+    CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK', 'EXPIRY'));
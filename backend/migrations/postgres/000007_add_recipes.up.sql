@@ -0,0 +1,37 @@
+-- Recipes (bills of materials). A recipe yields yield_quantity of yield_unit,
+-- in base units, from its components; dishes usually yield 1 pcs and
+-- preparations such as a gravy base yield a weight or volume.
+CREATE TABLE IF NOT EXISTS recipes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    yield_quantity INTEGER NOT NULL CHECK (yield_quantity > 0),
+    yield_unit VARCHAR(20) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name)
+);
+
+CREATE TRIGGER update_recipes_updated_at
+    BEFORE UPDATE ON recipes
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- A component is either an ingredient item or a sub-recipe. quantity is in
+-- base units of the item's unit or the sub-recipe's yield unit; unit is the
+-- unit it was entered in.
+CREATE TABLE IF NOT EXISTS recipe_components (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    item_id UUID REFERENCES items(id) ON DELETE RESTRICT,
+    sub_recipe_id UUID REFERENCES recipes(id) ON DELETE RESTRICT,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    CHECK ((item_id IS NULL) <> (sub_recipe_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_recipe_components_recipe ON recipe_components(recipe_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_components_item ON recipe_components(item_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_components_sub_recipe ON recipe_components(sub_recipe_id);
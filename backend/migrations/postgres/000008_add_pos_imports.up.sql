@@ -0,0 +1,27 @@
+-- Dish codes exported by the POS, mapped to recipes. Every unit sold under a
+-- code is portions of the recipe's yield unit, so a half plate maps to 0.5.
+CREATE TABLE IF NOT EXISTS pos_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    code VARCHAR(100) NOT NULL,
+    recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    portions DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (portions > 0),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pos_mappings_recipe ON pos_mappings(recipe_id);
+
+CREATE TRIGGER update_pos_mappings_updated_at
+    BEFORE UPDATE ON pos_mappings
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- POS bills whose sales were posted; a bill is imported at most once
+CREATE TABLE IF NOT EXISTS pos_imported_bills (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    bill_number VARCHAR(100) NOT NULL,
+    imported_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    imported_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, bill_number)
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_item_unit_conversions_updated_at ON item_unit_conversions;
+DROP TABLE IF EXISTS item_unit_conversions;
+DROP TRIGGER IF EXISTS update_units_updated_at ON units;
+DROP TABLE IF EXISTS units;
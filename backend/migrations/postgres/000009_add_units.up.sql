@@ -0,0 +1,43 @@
+-- Units defined by an organization on top of the built-in kg, gm, ltr and
+-- pcs. A unit measures factor of its base unit; a unit that is its own base
+-- unit, such as a roll, counts something no built-in unit measures.
+CREATE TABLE IF NOT EXISTS units (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    code VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    base_unit VARCHAR(20) NOT NULL,
+    factor INTEGER NOT NULL CHECK (factor > 0),
+    display_precision INTEGER NOT NULL DEFAULT 0 CHECK (display_precision BETWEEN 0 AND 6),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, code)
+);
+
+CREATE TRIGGER update_units_updated_at
+    BEFORE UPDATE ON units
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Purchase units of a single item, such as a case of 24 pcs or a 25 kg sack.
+-- quantity is how many base units of the item one unit holds.
+CREATE TABLE IF NOT EXISTS item_unit_conversions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    unit VARCHAR(20) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (item_id, unit)
+);
+
+CREATE TRIGGER update_item_unit_conversions_updated_at
+    BEFORE UPDATE ON item_unit_conversions
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Items already kept in units that are not built in, such as the seeded
+-- roll and pack, get a counting unit of that name
+INSERT INTO units (organization_id, code, name, base_unit, factor, display_precision)
+SELECT DISTINCT organization_id, unit_of_measurement, unit_of_measurement, unit_of_measurement, 1, 0
+FROM items
+WHERE unit_of_measurement NOT IN ('kg', 'gm', 'ltr', 'pcs')
+ON CONFLICT DO NOTHING;
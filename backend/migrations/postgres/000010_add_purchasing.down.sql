@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS goods_receipt_lines;
+DROP TABLE IF EXISTS goods_receipts;
+DROP TABLE IF EXISTS purchase_order_lines;
+DROP TRIGGER IF EXISTS update_purchase_orders_updated_at ON purchase_orders;
+DROP TABLE IF EXISTS purchase_orders;
+DROP TRIGGER IF EXISTS update_suppliers_updated_at ON suppliers;
+DROP TABLE IF EXISTS suppliers;
@@ -0,0 +1,13 @@
+-- Reorder alerts cannot be represented without the new type and are dropped
+DELETE FROM alerts WHERE type = 'REORDER';
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_type_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_type_check
+    CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK', 'EXPIRY'));
+
+DROP INDEX IF EXISTS idx_items_preferred_supplier;
+ALTER TABLE items
+    DROP COLUMN IF EXISTS reorder_alerted_at,
+    DROP COLUMN IF EXISTS preferred_supplier_id,
+    DROP COLUMN IF EXISTS lead_time_days,
+    DROP COLUMN IF EXISTS par_level;
@@ -0,0 +1,15 @@
+-- Reorder settings of an item. par_level is the stock, in base units, an
+-- order should bring the item back up to; lead_time_days overrides the lead
+-- time of the preferred supplier. reorder_alerted_at is set while a reorder
+-- alert for the item is outstanding.
+ALTER TABLE items
+    ADD COLUMN par_level INTEGER CHECK (par_level IS NULL OR par_level >= 0),
+    ADD COLUMN lead_time_days INTEGER CHECK (lead_time_days IS NULL OR lead_time_days >= 0),
+    ADD COLUMN preferred_supplier_id UUID REFERENCES suppliers(id) ON DELETE SET NULL,
+    ADD COLUMN reorder_alerted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_items_preferred_supplier ON items(preferred_supplier_id);
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_type_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_type_check
+    CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK', 'EXPIRY', 'REORDER'));
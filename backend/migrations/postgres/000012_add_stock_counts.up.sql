@@ -0,0 +1,41 @@
+-- A stock count session counts the items of a location, optionally only
+-- those of one category. It stays OPEN while staff enter counts and is then
+-- APPROVED, posting the variances as ADJUSTMENT movements, or CANCELLED.
+CREATE TABLE IF NOT EXISTS stock_counts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    category_id UUID REFERENCES categories(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'APPROVED', 'CANCELLED')),
+    notes TEXT,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    approved_by UUID REFERENCES users(id) ON DELETE RESTRICT,
+    approved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_stock_counts_updated_at
+    BEFORE UPDATE ON stock_counts
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_stock_counts_status ON stock_counts(organization_id, status);
+
+-- Quantities are in base units of the item. expected_quantity and unit_cost
+-- are snapshots taken when the session was opened; movement_id is the
+-- ADJUSTMENT posted for the line on approval.
+CREATE TABLE IF NOT EXISTS stock_count_lines (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    stock_count_id UUID NOT NULL REFERENCES stock_counts(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    expected_quantity INTEGER NOT NULL CHECK (expected_quantity >= 0),
+    counted_quantity INTEGER CHECK (counted_quantity >= 0),
+    counted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    counted_at TIMESTAMPTZ,
+    unit_cost DECIMAL(10, 2),
+    movement_id UUID REFERENCES stock_movements(id) ON DELETE SET NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (stock_count_id, item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_count_lines_item ON stock_count_lines(item_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_stock_movements_reason;
+ALTER TABLE stock_movements
+    DROP COLUMN IF EXISTS reason_code;
+DROP TRIGGER IF EXISTS update_movement_reasons_updated_at ON movement_reasons;
+DROP TABLE IF EXISTS movement_reasons;
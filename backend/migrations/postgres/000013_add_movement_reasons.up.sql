@@ -0,0 +1,26 @@
+-- Reasons an organization records stock leaving other than through sales and
+-- production, such as spoilage, staff meals or theft. is_waste marks the
+-- reasons that count as food waste. Reasons are deactivated rather than
+-- deleted, so the movements recorded with them keep their meaning.
+CREATE TABLE IF NOT EXISTS movement_reasons (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    code VARCHAR(30) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    is_waste BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, code)
+);
+
+CREATE TRIGGER update_movement_reasons_updated_at
+    BEFORE UPDATE ON movement_reasons
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- The reason an OUT movement was recorded with; OUT movements without one
+-- are usage, such as sales and production
+ALTER TABLE stock_movements
+    ADD COLUMN reason_code VARCHAR(30);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reason ON stock_movements(reason_code, created_at);
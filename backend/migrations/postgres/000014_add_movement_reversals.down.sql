@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_stock_movements_reversal_of;
+ALTER TABLE stock_movements
+    DROP COLUMN IF EXISTS voided_by;
+ALTER TABLE stock_movements
+    DROP COLUMN IF EXISTS voided_at;
+ALTER TABLE stock_movements
+    DROP COLUMN IF EXISTS reversal_of;
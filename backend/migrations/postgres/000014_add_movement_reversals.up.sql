@@ -0,0 +1,12 @@
+-- A reversal is a movement posted to undo another one. reversal_of links it
+-- to the movement it undoes, which is marked voided by whoever reversed it;
+-- movements are never deleted. The unique index lets a movement be reversed
+-- once.
+ALTER TABLE stock_movements
+    ADD COLUMN reversal_of UUID REFERENCES stock_movements(id) ON DELETE RESTRICT;
+ALTER TABLE stock_movements
+    ADD COLUMN voided_at TIMESTAMPTZ;
+ALTER TABLE stock_movements
+    ADD COLUMN voided_by UUID REFERENCES users(id) ON DELETE RESTRICT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_movements_reversal_of ON stock_movements(reversal_of);
@@ -0,0 +1,6 @@
+ALTER TABLE stock_movements
+    DROP COLUMN IF EXISTS total_cost;
+DROP INDEX IF EXISTS idx_cost_layers_item;
+DROP TABLE IF EXISTS cost_layers;
+ALTER TABLE organizations
+    DROP COLUMN IF EXISTS costing_method;
@@ -0,0 +1,27 @@
+-- How the organization costs the stock it uses: FIFO consumes the oldest
+-- cost layer first, WEIGHTED_AVERAGE keeps one layer at the moving average
+ALTER TABLE organizations
+    ADD COLUMN costing_method VARCHAR(20) NOT NULL DEFAULT 'FIFO' CHECK (costing_method IN ('FIFO', 'WEIGHTED_AVERAGE'));
+
+-- Cost layers hold the item's stock at the cost it came in at. Stock coming
+-- in adds a layer and stock going out consumes layers, so together they
+-- value the item's stock. quantity is in base units and unit_cost is per
+-- base unit. A layer without a movement holds the stock the item had when
+-- costing started, at the item's unit cost.
+CREATE TABLE IF NOT EXISTS cost_layers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    movement_id UUID REFERENCES stock_movements(id) ON DELETE SET NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    unit_cost DOUBLE PRECISION NOT NULL CHECK (unit_cost >= 0),
+    initial_quantity INTEGER NOT NULL CHECK (initial_quantity >= 0),
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_layers_item ON cost_layers(item_id, received_at);
+
+-- The cost of the goods a movement brought in or took out; for OUT this is
+-- the cost of goods used. Movements recorded before costing have none.
+ALTER TABLE stock_movements
+    ADD COLUMN total_cost DOUBLE PRECISION;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_stock_snapshots_org;
+DROP TABLE IF EXISTS stock_snapshots;
@@ -0,0 +1,15 @@
+-- A stock snapshot records an item's stock and its value at the start of a
+-- day (UTC), so stock at an earlier time is worked out from the nearest
+-- snapshot instead of the whole movement ledger. quantity is in base units.
+CREATE TABLE IF NOT EXISTS stock_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    taken_at TIMESTAMPTZ NOT NULL,
+    quantity INTEGER NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (item_id, taken_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_snapshots_org ON stock_snapshots(organization_id, taken_at);
@@ -0,0 +1,5 @@
+-- OPENING movements become the IN movements they would have been before
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_movement_type_check;
+UPDATE stock_movements SET movement_type = 'IN' WHERE movement_type = 'OPENING';
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_movement_type_check
+    CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT', 'TRANSFER'));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_invitations_email;
+DROP INDEX IF EXISTS idx_user_invitations_organization;
+DROP TABLE IF EXISTS user_invitations;
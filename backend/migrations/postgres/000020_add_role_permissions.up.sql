@@ -0,0 +1,11 @@
+-- Each role holds a default set of permissions, defined in code. An
+-- organization overrides them per role here: a row grants or denies one
+-- permission whatever the role's default. ADMIN can't be overridden.
+CREATE TABLE IF NOT EXISTS role_permissions (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('MANAGER', 'USER')),
+    permission VARCHAR(50) NOT NULL,
+    granted BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, role, permission)
+);
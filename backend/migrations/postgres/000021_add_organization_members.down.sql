@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS organization_id;
+
+UPDATE users SET is_active = m.is_active
+FROM organization_members m
+WHERE m.organization_id = users.organization_id AND m.user_id = users.id;
+
+DROP INDEX IF EXISTS idx_organization_members_user;
+DROP TABLE IF EXISTS organization_members;
@@ -0,0 +1,3 @@
+-- Row version for optimistic concurrency; bumped on every write to an item
+ALTER TABLE items
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,53 @@
+-- Transfers cannot be represented without locations and are dropped
+CREATE TABLE stock_movements_old (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    item_id TEXT NOT NULL,
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT')),
+    quantity INTEGER NOT NULL,
+    previous_stock INTEGER NOT NULL,
+    new_stock INTEGER NOT NULL,
+    reference VARCHAR(255),
+    notes TEXT,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+INSERT INTO stock_movements_old (
+    id, item_id, movement_type, quantity, previous_stock, new_stock,
+    reference, notes, created_by, created_at
+)
+SELECT
+    id, item_id, movement_type, quantity, previous_stock, new_stock,
+    reference, notes, created_by, created_at
+FROM stock_movements
+WHERE movement_type <> 'TRANSFER';
+
+DROP INDEX IF EXISTS idx_movements_location;
+DROP INDEX IF EXISTS idx_movements_created_at;
+DROP INDEX IF EXISTS idx_movements_item;
+DROP TABLE stock_movements;
+ALTER TABLE stock_movements_old RENAME TO stock_movements;
+
+CREATE INDEX IF NOT EXISTS idx_movements_item ON stock_movements(item_id);
+CREATE INDEX IF NOT EXISTS idx_movements_created_at ON stock_movements(created_at);
+
+DROP INDEX IF EXISTS idx_stock_levels_location;
+DROP TABLE IF EXISTS stock_levels;
+
+DROP TRIGGER IF EXISTS update_locations_updated_at;
+DROP INDEX IF EXISTS idx_locations_default;
+DROP TABLE IF EXISTS locations;
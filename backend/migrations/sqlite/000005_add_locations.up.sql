@@ -0,0 +1,109 @@
+-- Storage locations (walk-in cooler, dry store, line, bar, ...)
+CREATE TABLE IF NOT EXISTS locations (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    UNIQUE(organization_id, name)
+);
+
+-- At most one default location per organization
+CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_default ON locations(organization_id) WHERE is_default = TRUE;
+
+CREATE TRIGGER IF NOT EXISTS update_locations_updated_at
+    AFTER UPDATE ON locations
+    BEGIN
+        UPDATE locations SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- Per-location stock in base units. items.current_stock stays the total
+-- across locations.
+CREATE TABLE IF NOT EXISTS stock_levels (
+    item_id TEXT NOT NULL,
+    location_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    minimum_threshold INTEGER CHECK (minimum_threshold >= 0),
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, location_id),
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_levels_location ON stock_levels(location_id);
+
+-- Rebuild stock_movements to add the locations and allow TRANSFER
+CREATE TABLE stock_movements_new (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    item_id TEXT NOT NULL,
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT', 'TRANSFER')),
+    quantity INTEGER NOT NULL,
+    previous_stock INTEGER NOT NULL,
+    new_stock INTEGER NOT NULL,
+    location_id TEXT,
+    to_location_id TEXT,
+    reference VARCHAR(255),
+    notes TEXT,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE RESTRICT,
+    FOREIGN KEY (to_location_id) REFERENCES locations(id) ON DELETE RESTRICT,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+-- Every existing organization gets a default location holding all its stock
+INSERT INTO locations (organization_id, name, description, is_default)
+SELECT id, 'Main Store', 'Default location', TRUE FROM organizations;
+
+INSERT INTO stock_levels (item_id, location_id, quantity)
+SELECT i.id, l.id, COALESCE(i.current_stock, 0)
+FROM items i
+JOIN locations l ON l.organization_id = i.organization_id AND l.is_default = TRUE;
+
+INSERT INTO stock_movements_new (
+    id, item_id, movement_type, quantity, previous_stock, new_stock,
+    location_id, reference, notes, created_by, created_at
+)
+SELECT
+    sm.id, sm.item_id, sm.movement_type, sm.quantity, sm.previous_stock, sm.new_stock,
+    (SELECT l.id FROM items i JOIN locations l ON l.organization_id = i.organization_id AND l.is_default = TRUE WHERE i.id = sm.item_id),
+    sm.reference, sm.notes, sm.created_by, sm.created_at
+FROM stock_movements sm;
+
+DROP INDEX IF EXISTS idx_movements_item;
+DROP INDEX IF EXISTS idx_movements_created_at;
+DROP TABLE stock_movements;
+ALTER TABLE stock_movements_new RENAME TO stock_movements;
+
+CREATE INDEX IF NOT EXISTS idx_movements_item ON stock_movements(item_id);
+CREATE INDEX IF NOT EXISTS idx_movements_created_at ON stock_movements(created_at);
+CREATE INDEX IF NOT EXISTS idx_movements_location ON stock_movements(location_id);
@@ -0,0 +1,106 @@
+-- Lots of received stock with optional expiry, consumed first-expiry-first-out.
+-- quantity is what is left of the lot at its location, in base units.
+CREATE TABLE IF NOT EXISTS stock_lots (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    item_id TEXT NOT NULL,
+    location_id TEXT NOT NULL,
+    lot_number VARCHAR(100),
+    received_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    initial_quantity INTEGER NOT NULL CHECK (initial_quantity >= 0),
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    movement_id TEXT,
+    expiry_alerted_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE RESTRICT,
+    FOREIGN KEY (movement_id) REFERENCES stock_movements(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_lots_item_location ON stock_lots(item_id, location_id, expires_at);
+CREATE INDEX IF NOT EXISTS idx_stock_lots_expires_at ON stock_lots(expires_at);
+
+-- How much of each lot a movement consumed
+CREATE TABLE IF NOT EXISTS stock_movement_lots (
+    movement_id TEXT NOT NULL,
+    lot_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (movement_id, lot_id),
+    FOREIGN KEY (movement_id) REFERENCES stock_movements(id) ON DELETE CASCADE,
+    FOREIGN KEY (lot_id) REFERENCES stock_lots(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movement_lots_lot ON stock_movement_lots(lot_id);
+
+-- Rebuild alerts to allow EXPIRY. The low stock trigger inserts into alerts,
+-- so it is dropped while the table is swapped and then recreated.
+DROP TRIGGER IF EXISTS check_low_stock_alert;
+
+CREATE TABLE alerts_new (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    item_id TEXT,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK', 'EXPIRY')),
+    severity VARCHAR(20) NOT NULL CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+    title TEXT NOT NULL,
+    message TEXT NOT NULL,
+    is_read BOOLEAN DEFAULT false,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE
+);
+
+INSERT INTO alerts_new (id, organization_id, item_id, type, severity, title, message, is_read, created_at)
+SELECT id, organization_id, item_id, type, severity, title, message, is_read, created_at FROM alerts;
+
+DROP TABLE alerts;
+ALTER TABLE alerts_new RENAME TO alerts;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_organization ON alerts(organization_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_unread ON alerts(is_read, created_at);
+
+-- Trigger to automatically create alerts when stock goes below threshold
+CREATE TRIGGER IF NOT EXISTS check_low_stock_alert
+    AFTER UPDATE OF current_stock ON items
+    WHEN NEW.current_stock <= NEW.minimum_threshold AND OLD.current_stock > OLD.minimum_threshold
+    BEGIN
+        INSERT INTO alerts (organization_id, item_id, type, severity, title, message)
+        VALUES (
+            NEW.organization_id,
+            NEW.id,
+            CASE WHEN NEW.current_stock = 0 THEN 'OUT_OF_STOCK' ELSE 'LOW_STOCK' END,
+            CASE WHEN NEW.current_stock = 0 THEN 'CRITICAL' ELSE 'WARNING' END,
+            CASE
+                WHEN NEW.current_stock = 0 THEN 'Out of Stock: ' || NEW.name
+                ELSE 'Low Stock: ' || NEW.name
+            END,
+            CASE
+                WHEN NEW.current_stock = 0 THEN 'Item "' || NEW.name || '" is out of stock!'
+                ELSE 'Item "' || NEW.name || '" is running low (Current: ' || NEW.current_stock || ', Minimum: ' || NEW.minimum_threshold || ')'
+            END
+        );
+    END;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_recipe_components_sub_recipe;
+DROP INDEX IF EXISTS idx_recipe_components_item;
+DROP INDEX IF EXISTS idx_recipe_components_recipe;
+DROP TABLE IF EXISTS recipe_components;
+DROP TRIGGER IF EXISTS update_recipes_updated_at;
+DROP TABLE IF EXISTS recipes;
@@ -0,0 +1,67 @@
+-- Recipes (bills of materials). A recipe yields yield_quantity of yield_unit,
+-- in base units, from its components; dishes usually yield 1 pcs and
+-- preparations such as a gravy base yield a weight or volume.
+CREATE TABLE IF NOT EXISTS recipes (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    yield_quantity INTEGER NOT NULL CHECK (yield_quantity > 0),
+    yield_unit VARCHAR(20) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    UNIQUE(organization_id, name)
+);
+
+CREATE TRIGGER IF NOT EXISTS update_recipes_updated_at
+    AFTER UPDATE ON recipes
+    BEGIN
+        UPDATE recipes SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- A component is either an ingredient item or a sub-recipe. quantity is in
+-- base units of the item's unit or the sub-recipe's yield unit; unit is the
+-- unit it was entered in.
+CREATE TABLE IF NOT EXISTS recipe_components (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    recipe_id TEXT NOT NULL,
+    item_id TEXT,
+    sub_recipe_id TEXT,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE RESTRICT,
+    FOREIGN KEY (sub_recipe_id) REFERENCES recipes(id) ON DELETE RESTRICT,
+    CHECK ((item_id IS NULL) <> (sub_recipe_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_recipe_components_recipe ON recipe_components(recipe_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_components_item ON recipe_components(item_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_components_sub_recipe ON recipe_components(sub_recipe_id);
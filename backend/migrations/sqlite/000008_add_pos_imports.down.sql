@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS pos_imported_bills;
+DROP TRIGGER IF EXISTS update_pos_mappings_updated_at;
+DROP INDEX IF EXISTS idx_pos_mappings_recipe;
+DROP TABLE IF EXISTS pos_mappings;
@@ -0,0 +1,45 @@
+-- Dish codes exported by the POS, mapped to recipes. Every unit sold under a
+-- code is portions of the recipe's yield unit, so a half plate maps to 0.5.
+CREATE TABLE IF NOT EXISTS pos_mappings (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    code VARCHAR(100) NOT NULL,
+    recipe_id TEXT NOT NULL,
+    portions REAL NOT NULL DEFAULT 1 CHECK (portions > 0),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipe_id) REFERENCES recipes(id) ON DELETE CASCADE,
+    UNIQUE(organization_id, code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pos_mappings_recipe ON pos_mappings(recipe_id);
+
+CREATE TRIGGER IF NOT EXISTS update_pos_mappings_updated_at
+    AFTER UPDATE ON pos_mappings
+    BEGIN
+        UPDATE pos_mappings SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- POS bills whose sales were posted; a bill is imported at most once
+CREATE TABLE IF NOT EXISTS pos_imported_bills (
+    organization_id TEXT NOT NULL,
+    bill_number VARCHAR(100) NOT NULL,
+    imported_by TEXT NOT NULL,
+    imported_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, bill_number),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (imported_by) REFERENCES users(id) ON DELETE RESTRICT
+);
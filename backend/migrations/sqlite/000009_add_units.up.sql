@@ -0,0 +1,72 @@
+-- Units defined by an organization on top of the built-in kg, gm, ltr and
+-- pcs. A unit measures factor of its base unit; a unit that is its own base
+-- unit, such as a roll, counts something no built-in unit measures.
+CREATE TABLE IF NOT EXISTS units (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    code VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    base_unit VARCHAR(20) NOT NULL,
+    factor INTEGER NOT NULL CHECK (factor > 0),
+    display_precision INTEGER NOT NULL DEFAULT 0 CHECK (display_precision BETWEEN 0 AND 6),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    UNIQUE(organization_id, code)
+);
+
+CREATE TRIGGER IF NOT EXISTS update_units_updated_at
+    AFTER UPDATE ON units
+    BEGIN
+        UPDATE units SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- Purchase units of a single item, such as a case of 24 pcs or a 25 kg sack.
+-- quantity is how many base units of the item one unit holds.
+CREATE TABLE IF NOT EXISTS item_unit_conversions (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    item_id TEXT NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    UNIQUE(item_id, unit)
+);
+
+CREATE TRIGGER IF NOT EXISTS update_item_unit_conversions_updated_at
+    AFTER UPDATE ON item_unit_conversions
+    BEGIN
+        UPDATE item_unit_conversions SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- Items already kept in units that are not built in, such as the seeded
+-- roll and pack, get a counting unit of that name
+INSERT OR IGNORE INTO units (organization_id, code, name, base_unit, factor, display_precision)
+SELECT DISTINCT organization_id, unit_of_measurement, unit_of_measurement, unit_of_measurement, 1, 0
+FROM items
+WHERE unit_of_measurement NOT IN ('kg', 'gm', 'ltr', 'pcs');
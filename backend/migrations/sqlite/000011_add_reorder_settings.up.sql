@@ -0,0 +1,75 @@
+-- Reorder settings of an item. par_level is the stock, in base units, an
+-- order should bring the item back up to; lead_time_days overrides the lead
+-- time of the preferred supplier. reorder_alerted_at is set while a reorder
+-- alert for the item is outstanding.
+ALTER TABLE items
+    ADD COLUMN par_level INTEGER CHECK (par_level IS NULL OR par_level >= 0);
+ALTER TABLE items
+    ADD COLUMN lead_time_days INTEGER CHECK (lead_time_days IS NULL OR lead_time_days >= 0);
+ALTER TABLE items
+    ADD COLUMN preferred_supplier_id TEXT REFERENCES suppliers(id) ON DELETE SET NULL;
+ALTER TABLE items
+    ADD COLUMN reorder_alerted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_items_preferred_supplier ON items(preferred_supplier_id);
+
+-- Rebuild alerts to allow REORDER. The low stock trigger inserts into alerts,
+-- so it is dropped while the table is swapped and then recreated.
+DROP TRIGGER IF EXISTS check_low_stock_alert;
+
+CREATE TABLE alerts_new (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    item_id TEXT,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('LOW_STOCK', 'OUT_OF_STOCK', 'EXPIRY', 'REORDER')),
+    severity VARCHAR(20) NOT NULL CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+    title TEXT NOT NULL,
+    message TEXT NOT NULL,
+    is_read BOOLEAN DEFAULT false,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE
+);
+
+INSERT INTO alerts_new (id, organization_id, item_id, type, severity, title, message, is_read, created_at)
+SELECT id, organization_id, item_id, type, severity, title, message, is_read, created_at FROM alerts;
+
+DROP TABLE alerts;
+ALTER TABLE alerts_new RENAME TO alerts;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_organization ON alerts(organization_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_unread ON alerts(is_read, created_at);
+
+-- Trigger to automatically create alerts when stock goes below threshold
+CREATE TRIGGER IF NOT EXISTS check_low_stock_alert
+    AFTER UPDATE OF current_stock ON items
+    WHEN NEW.current_stock <= NEW.minimum_threshold AND OLD.current_stock > OLD.minimum_threshold
+    BEGIN
+        INSERT INTO alerts (organization_id, item_id, type, severity, title, message)
+        VALUES (
+            NEW.organization_id,
+            NEW.id,
+            CASE WHEN NEW.current_stock = 0 THEN 'OUT_OF_STOCK' ELSE 'LOW_STOCK' END,
+            CASE WHEN NEW.current_stock = 0 THEN 'CRITICAL' ELSE 'WARNING' END,
+            CASE
+                WHEN NEW.current_stock = 0 THEN 'Out of Stock: ' || NEW.name
+                ELSE 'Low Stock: ' || NEW.name
+            END,
+            CASE
+                WHEN NEW.current_stock = 0 THEN 'Item "' || NEW.name || '" is out of stock!'
+                ELSE 'Item "' || NEW.name || '" is running low (Current: ' || NEW.current_stock || ', Minimum: ' || NEW.minimum_threshold || ')'
+            END
+        );
+    END;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stock_count_lines;
+DROP TRIGGER IF EXISTS update_stock_counts_updated_at;
+DROP TABLE IF EXISTS stock_counts;
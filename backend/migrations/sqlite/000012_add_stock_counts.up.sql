@@ -0,0 +1,76 @@
+-- A stock count session counts the items of a location, optionally only
+-- those of one category. It stays OPEN while staff enter counts and is then
+-- APPROVED, posting the variances as ADJUSTMENT movements, or CANCELLED.
+CREATE TABLE IF NOT EXISTS stock_counts (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    location_id TEXT NOT NULL,
+    category_id TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'APPROVED', 'CANCELLED')),
+    notes TEXT,
+    created_by TEXT NOT NULL,
+    approved_by TEXT,
+    approved_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT,
+    FOREIGN KEY (approved_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+CREATE TRIGGER IF NOT EXISTS update_stock_counts_updated_at
+    AFTER UPDATE ON stock_counts
+    BEGIN
+        UPDATE stock_counts SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+CREATE INDEX IF NOT EXISTS idx_stock_counts_status ON stock_counts(organization_id, status);
+
+-- Quantities are in base units of the item. expected_quantity and unit_cost
+-- are snapshots taken when the session was opened; movement_id is the
+-- ADJUSTMENT posted for the line on approval.
+CREATE TABLE IF NOT EXISTS stock_count_lines (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    stock_count_id TEXT NOT NULL,
+    item_id TEXT NOT NULL,
+    expected_quantity INTEGER NOT NULL CHECK (expected_quantity >= 0),
+    counted_quantity INTEGER CHECK (counted_quantity >= 0),
+    counted_by TEXT,
+    counted_at DATETIME,
+    unit_cost DECIMAL(10, 2),
+    movement_id TEXT,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (stock_count_id) REFERENCES stock_counts(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (counted_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (movement_id) REFERENCES stock_movements(id) ON DELETE SET NULL,
+    UNIQUE(stock_count_id, item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_count_lines_item ON stock_count_lines(item_id);
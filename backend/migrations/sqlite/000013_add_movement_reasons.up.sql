@@ -0,0 +1,41 @@
+-- Reasons an organization records stock leaving other than through sales and
+-- production, such as spoilage, staff meals or theft. is_waste marks the
+-- reasons that count as food waste. Reasons are deactivated rather than
+-- deleted, so the movements recorded with them keep their meaning.
+CREATE TABLE IF NOT EXISTS movement_reasons (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    code VARCHAR(30) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    is_waste BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    UNIQUE(organization_id, code)
+);
+
+CREATE TRIGGER IF NOT EXISTS update_movement_reasons_updated_at
+    AFTER UPDATE ON movement_reasons
+    BEGIN
+        UPDATE movement_reasons SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+    END;
+
+-- The reason an OUT movement was recorded with; OUT movements without one
+-- are usage, such as sales and production
+ALTER TABLE stock_movements
+    ADD COLUMN reason_code VARCHAR(30);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reason ON stock_movements(reason_code, created_at);
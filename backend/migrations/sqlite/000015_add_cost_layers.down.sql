@@ -0,0 +1,6 @@
+ALTER TABLE stock_movements
+    DROP COLUMN total_cost;
+DROP INDEX IF EXISTS idx_cost_layers_item;
+DROP TABLE IF EXISTS cost_layers;
+ALTER TABLE organizations
+    DROP COLUMN costing_method;
@@ -0,0 +1,29 @@
+-- A stock snapshot records an item's stock and its value at the start of a
+-- day (UTC), so stock at an earlier time is worked out from the nearest
+-- snapshot instead of the whole movement ledger. quantity is in base units.
+CREATE TABLE IF NOT EXISTS stock_snapshots (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    organization_id TEXT NOT NULL,
+    item_id TEXT NOT NULL,
+    taken_at DATETIME NOT NULL,
+    quantity INTEGER NOT NULL,
+    value REAL NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (item_id, taken_at),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_snapshots_org ON stock_snapshots(organization_id, taken_at);
@@ -0,0 +1,86 @@
+-- OPENING movements become the IN movements they would have been before.
+-- The links pointing at movements are set aside while the table is rebuilt,
+-- as in the up migration.
+CREATE TABLE stock_movements_new (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    item_id TEXT NOT NULL,
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT', 'TRANSFER')),
+    quantity INTEGER NOT NULL,
+    previous_stock INTEGER NOT NULL,
+    new_stock INTEGER NOT NULL,
+    location_id TEXT,
+    to_location_id TEXT,
+    reference VARCHAR(255),
+    notes TEXT,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    reason_code VARCHAR(30),
+    reversal_of TEXT REFERENCES stock_movements_new(id) ON DELETE RESTRICT,
+    voided_at DATETIME,
+    voided_by TEXT REFERENCES users(id) ON DELETE RESTRICT,
+    total_cost REAL,
+    FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE RESTRICT,
+    FOREIGN KEY (to_location_id) REFERENCES locations(id) ON DELETE RESTRICT,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+INSERT INTO stock_movements_new (
+    id, item_id, movement_type, quantity, previous_stock, new_stock,
+    location_id, to_location_id, reference, notes, created_by, created_at,
+    reason_code, reversal_of, voided_at, voided_by, total_cost
+)
+SELECT
+    sm.id, sm.item_id, CASE sm.movement_type WHEN 'OPENING' THEN 'IN' ELSE sm.movement_type END, sm.quantity, sm.previous_stock, sm.new_stock,
+    sm.location_id, sm.to_location_id, sm.reference, sm.notes, sm.created_by, sm.created_at,
+    sm.reason_code, sm.reversal_of, sm.voided_at, sm.voided_by, sm.total_cost
+FROM stock_movements sm;
+
+CREATE TEMP TABLE kept_movement_lots AS SELECT * FROM stock_movement_lots;
+CREATE TEMP TABLE kept_goods_receipt_lines AS SELECT * FROM goods_receipt_lines;
+CREATE TEMP TABLE kept_lot_movements AS SELECT id, movement_id FROM stock_lots WHERE movement_id IS NOT NULL;
+CREATE TEMP TABLE kept_count_movements AS SELECT id, movement_id FROM stock_count_lines WHERE movement_id IS NOT NULL;
+CREATE TEMP TABLE kept_layer_movements AS SELECT id, movement_id FROM cost_layers WHERE movement_id IS NOT NULL;
+
+DELETE FROM stock_movement_lots;
+DELETE FROM goods_receipt_lines;
+UPDATE stock_lots SET movement_id = NULL WHERE movement_id IS NOT NULL;
+UPDATE stock_count_lines SET movement_id = NULL WHERE movement_id IS NOT NULL;
+UPDATE cost_layers SET movement_id = NULL WHERE movement_id IS NOT NULL;
+UPDATE stock_movements SET reversal_of = NULL WHERE reversal_of IS NOT NULL;
+
+DROP TABLE stock_movements;
+ALTER TABLE stock_movements_new RENAME TO stock_movements;
+
+INSERT INTO stock_movement_lots SELECT * FROM kept_movement_lots;
+INSERT INTO goods_receipt_lines SELECT * FROM kept_goods_receipt_lines;
+UPDATE stock_lots SET movement_id = (SELECT k.movement_id FROM kept_lot_movements k WHERE k.id = stock_lots.id)
+WHERE id IN (SELECT id FROM kept_lot_movements);
+UPDATE stock_count_lines SET movement_id = (SELECT k.movement_id FROM kept_count_movements k WHERE k.id = stock_count_lines.id)
+WHERE id IN (SELECT id FROM kept_count_movements);
+UPDATE cost_layers SET movement_id = (SELECT k.movement_id FROM kept_layer_movements k WHERE k.id = cost_layers.id)
+WHERE id IN (SELECT id FROM kept_layer_movements);
+
+DROP TABLE kept_movement_lots;
+DROP TABLE kept_goods_receipt_lines;
+DROP TABLE kept_lot_movements;
+DROP TABLE kept_count_movements;
+DROP TABLE kept_layer_movements;
+
+CREATE INDEX IF NOT EXISTS idx_movements_item ON stock_movements(item_id);
+CREATE INDEX IF NOT EXISTS idx_movements_created_at ON stock_movements(created_at);
+CREATE INDEX IF NOT EXISTS idx_movements_location ON stock_movements(location_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reason ON stock_movements(reason_code, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_movements_reversal_of ON stock_movements(reversal_of);
@@ -0,0 +1,8 @@
+-- The seeded users keep their UUIDs
+ALTER TABLE users
+    DROP COLUMN token_version;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_expires_at;
+DROP INDEX IF EXISTS idx_refresh_tokens_family;
+DROP INDEX IF EXISTS idx_refresh_tokens_user;
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,40 @@
+-- Refresh tokens are stored as their SHA-256 hash. Each refresh rotates the
+-- token: it is marked used and a new token of the same family, one per
+-- sign-in, is issued. A used token presented again revokes its family.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY DEFAULT (
+        lower(
+            printf(
+            '%s-%s-4%s-%s%s-%s',
+            hex(randomblob(4)),
+            hex(randomblob(2)),
+            substr(hex(randomblob(2)), 2),
+            substr('89ab', 1 + abs(random()) % 4, 1),
+            substr(hex(randomblob(2)), 2),
+            hex(randomblob(6))
+            )
+       )
+    ),
+    user_id TEXT NOT NULL,
+    family_id TEXT NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+
+-- Access tokens carry the token version of their user; bumping it revokes
+-- every access token issued before
+ALTER TABLE users
+    ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- Tokens are tied to user IDs, so the seeded users get the UUIDs they have
+-- on Postgres
+UPDATE users SET id = '5f0c2f7e-3b7a-4c1e-9d2a-0a6f4f1b2c01' WHERE id = 'default-admin-id';
+UPDATE users SET id = '5f0c2f7e-3b7a-4c1e-9d2a-0a6f4f1b2c02' WHERE id = 'default-staff-id';
@@ -0,0 +1,29 @@
+-- A user can belong to several organizations, with a role in each, and
+-- switches between them. The organization of users.organization_id is the
+-- user's home organization, where they land on sign-in, and users.role
+-- mirrors their role there.
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'USER' CHECK (role IN ('ADMIN', 'MANAGER', 'USER')),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user ON organization_members(user_id);
+
+INSERT OR IGNORE INTO organization_members (organization_id, user_id, role, is_active, created_at, updated_at)
+SELECT organization_id, id, role, COALESCE(is_active, TRUE), created_at, updated_at FROM users;
+
+-- Deactivation now applies to a membership; the account itself stays
+-- active so the user keeps their other organizations
+UPDATE users SET is_active = TRUE;
+
+-- A session stays in the organization it was switched to across refreshes;
+-- NULL is the user's home organization
+ALTER TABLE refresh_tokens
+    ADD COLUMN organization_id TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_stock_movements_item_recorded;
+ALTER TABLE stock_movements
+    DROP COLUMN recorded_at;
@@ -0,0 +1,9 @@
+-- created_at is when the stock moved, which for sales imported from the POS
+-- is when they were sold. recorded_at is when the movement was written, the
+-- order previous_stock and new_stock chain in.
+ALTER TABLE stock_movements
+    ADD COLUMN recorded_at DATETIME;
+
+UPDATE stock_movements SET recorded_at = created_at;
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_item_recorded ON stock_movements(item_id, recorded_at);
@@ -1,15 +1,14 @@
 package units
 
-import (
-	"errors"
-	"fmt"
-	"math"
-)
+import "errors"
 
 var (
 	ErrInvalidUnit     = errors.New("invalid unit")
 	ErrNegativeValue   = errors.New("negative value not allowed")
 	ErrInvalidBaseUnit = errors.New("invalid base unit value")
+	// ErrIncompatibleUnits means two units measure different base units,
+	// such as litres and grams
+	ErrIncompatibleUnits = errors.New("units measure different base units")
 )
 
 // Unit represents a measurement unit with its base unit conversion
@@ -61,66 +60,27 @@ var SupportedUnits = map[string]Unit{
 // ToBaseUnit converts a display value to base unit (integer)
 // Example: 1.5 kg → 1500 grams
 func ToBaseUnit(value float64, unitCode string) (int, error) {
-	if value < 0 {
-		return 0, ErrNegativeValue
-	}
-
-	unit, ok := SupportedUnits[unitCode]
-	if !ok {
-		return 0, fmt.Errorf("%w: %s", ErrInvalidUnit, unitCode)
-	}
-
-	// Convert to base unit and round to nearest integer
-	baseValue := value * float64(unit.Factor)
-	return int(math.Round(baseValue)), nil
+	return builtin.ToBaseUnit(value, unitCode)
 }
 
 // FromBaseUnit converts base unit (integer) to display value (float64)
 // Example: 1500 grams → 1.5 kg
 func FromBaseUnit(baseValue int, unitCode string) (float64, error) {
-	if baseValue < 0 {
-		return 0, ErrNegativeValue
-	}
-
-	unit, ok := SupportedUnits[unitCode]
-	if !ok {
-		return 0, fmt.Errorf("%w: %s", ErrInvalidUnit, unitCode)
-	}
-
-	// Convert from base unit to display unit
-	displayValue := float64(baseValue) / float64(unit.Factor)
-
-	// Round to unit's precision
-	multiplier := math.Pow(10, float64(unit.Precision))
-	return math.Round(displayValue*multiplier) / multiplier, nil
+	return builtin.FromBaseUnit(baseValue, unitCode)
 }
 
 // Validate checks if a unit code is valid
 func Validate(unitCode string) error {
-	if _, ok := SupportedUnits[unitCode]; !ok {
-		return fmt.Errorf("%w: %s", ErrInvalidUnit, unitCode)
-	}
-	return nil
+	return builtin.Validate(unitCode)
 }
 
 // GetUnit returns the unit configuration for a given code
 func GetUnit(unitCode string) (Unit, error) {
-	unit, ok := SupportedUnits[unitCode]
-	if !ok {
-		return Unit{}, fmt.Errorf("%w: %s", ErrInvalidUnit, unitCode)
-	}
-	return unit, nil
+	return builtin.GetUnit(unitCode)
 }
 
 // ConvertBetweenUnits converts a value from one unit to another
 // Example: 1500 grams (kg) → 1500 grams (gm)
 func ConvertBetweenUnits(value float64, fromUnit, toUnit string) (float64, error) {
-	// Convert to base unit first
-	baseValue, err := ToBaseUnit(value, fromUnit)
-	if err != nil {
-		return 0, err
-	}
-
-	// Convert from base unit to target unit
-	return FromBaseUnit(baseValue, toUnit)
+	return builtin.ConvertBetweenUnits(value, fromUnit, toUnit)
 }
@@ -0,0 +1,136 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// builtin resolves only the SupportedUnits
+var builtin *Registry
+
+// Registry resolves unit codes to units: the SupportedUnits plus any custom
+// units it was given, such as an organization's own units or the pack sizes
+// of one item. A nil *Registry knows only the SupportedUnits.
+type Registry struct {
+	custom map[string]Unit
+}
+
+// NewRegistry returns a registry of the SupportedUnits and custom. Custom
+// units cannot replace a supported unit; later units replace earlier ones
+// of the same code.
+func NewRegistry(custom ...Unit) *Registry {
+	return builtin.With(custom...)
+}
+
+// With returns a copy of the registry that also resolves custom
+func (r *Registry) With(custom ...Unit) *Registry {
+	extended := &Registry{custom: make(map[string]Unit)}
+	if r != nil {
+		for code, unit := range r.custom {
+			extended.custom[code] = unit
+		}
+	}
+	for _, unit := range custom {
+		if _, ok := SupportedUnits[unit.Code]; ok {
+			continue
+		}
+		extended.custom[unit.Code] = unit
+	}
+	return extended
+}
+
+// GetUnit returns the unit configuration for a given code
+func (r *Registry) GetUnit(unitCode string) (Unit, error) {
+	if unit, ok := SupportedUnits[unitCode]; ok {
+		return unit, nil
+	}
+	if r != nil {
+		if unit, ok := r.custom[unitCode]; ok {
+			return unit, nil
+		}
+	}
+	return Unit{}, fmt.Errorf("%w: %s", ErrInvalidUnit, unitCode)
+}
+
+// Units lists the units the registry resolves, ordered by code
+func (r *Registry) Units() []Unit {
+	var list []Unit
+	for _, unit := range SupportedUnits {
+		list = append(list, unit)
+	}
+	if r != nil {
+		for _, unit := range r.custom {
+			list = append(list, unit)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Validate checks if a unit code is valid
+func (r *Registry) Validate(unitCode string) error {
+	_, err := r.GetUnit(unitCode)
+	return err
+}
+
+// ToBaseUnit converts a display value to base unit (integer)
+func (r *Registry) ToBaseUnit(value float64, unitCode string) (int, error) {
+	if value < 0 {
+		return 0, ErrNegativeValue
+	}
+
+	unit, err := r.GetUnit(unitCode)
+	if err != nil {
+		return 0, err
+	}
+
+	// Convert to base unit and round to nearest integer
+	baseValue := value * float64(unit.Factor)
+	return int(math.Round(baseValue)), nil
+}
+
+// FromBaseUnit converts base unit (integer) to display value (float64),
+// rounded to the unit's precision
+func (r *Registry) FromBaseUnit(baseValue int, unitCode string) (float64, error) {
+	if baseValue < 0 {
+		return 0, ErrNegativeValue
+	}
+
+	unit, err := r.GetUnit(unitCode)
+	if err != nil {
+		return 0, err
+	}
+
+	// Convert from base unit to display unit
+	displayValue := float64(baseValue) / float64(unit.Factor)
+
+	// Round to unit's precision
+	multiplier := math.Pow(10, float64(unit.Precision))
+	return math.Round(displayValue*multiplier) / multiplier, nil
+}
+
+// ConvertBetweenUnits converts a value from one unit to another of the same
+// base unit. Units of different base units are ErrIncompatibleUnits.
+func (r *Registry) ConvertBetweenUnits(value float64, fromUnit, toUnit string) (float64, error) {
+	from, err := r.GetUnit(fromUnit)
+	if err != nil {
+		return 0, err
+	}
+	to, err := r.GetUnit(toUnit)
+	if err != nil {
+		return 0, err
+	}
+	if from.BaseUnit != to.BaseUnit {
+		return 0, fmt.Errorf("%w: %s and %s", ErrIncompatibleUnits, fromUnit, toUnit)
+	}
+
+	// Convert to base unit first
+	baseValue, err := r.ToBaseUnit(value, fromUnit)
+	if err != nil {
+		return 0, err
+	}
+
+	// Convert from base unit to target unit
+	return r.FromBaseUnit(baseValue, toUnit)
+}
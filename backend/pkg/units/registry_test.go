@@ -0,0 +1,56 @@
+package units
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryCustomUnits(t *testing.T) {
+	registry := NewRegistry(
+		Unit{Code: "roll", Name: "Roll", BaseUnit: "roll", Factor: 1, Precision: 0},
+		Unit{Code: "dozen", Name: "Dozen", BaseUnit: "pcs", Factor: 12, Precision: 2, AllowFloat: true},
+		// Custom units cannot replace a built-in unit
+		Unit{Code: "kg", Name: "Kilo", BaseUnit: "g", Factor: 999},
+	)
+
+	tests := []struct {
+		name  string
+		value float64
+		unit  string
+		want  int
+	}{
+		{"rolls are their own base unit", 3, "roll", 3},
+		{"dozens to pieces", 2.5, "dozen", 30},
+		{"kg keeps its built-in factor", 1.5, "kg", 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.ToBaseUnit(tt.value, tt.unit)
+			if err != nil {
+				t.Fatalf("ToBaseUnit() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ToBaseUnit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, err := registry.ConvertBetweenUnits(3, "dozen", "pcs"); err != nil || got != 36 {
+		t.Errorf("ConvertBetweenUnits(3 dozen, pcs) = %v, %v, want 36", got, err)
+	}
+	if _, err := registry.ConvertBetweenUnits(1, "roll", "pcs"); !errors.Is(err, ErrIncompatibleUnits) {
+		t.Errorf("ConvertBetweenUnits(roll, pcs) error = %v, want ErrIncompatibleUnits", err)
+	}
+
+	// Extending a registry leaves the original untouched
+	packs := registry.With(Unit{Code: "case", Name: "case", BaseUnit: "pcs", Factor: 24})
+	if err := packs.Validate("case"); err != nil {
+		t.Errorf("extended registry should resolve case: %v", err)
+	}
+	if err := registry.Validate("case"); !errors.Is(err, ErrInvalidUnit) {
+		t.Errorf("original registry should not resolve case, got %v", err)
+	}
+	if err := Validate("roll"); !errors.Is(err, ErrInvalidUnit) {
+		t.Errorf("package Validate should only know built-in units, got %v", err)
+	}
+}
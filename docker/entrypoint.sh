@@ -10,7 +10,7 @@ chown -R appuser:appgroup /app/data /app/logs || true
 UMASK_VALUE="${UMASK:-002}"
 umask "${UMASK_VALUE}"
 
-# Note: Migrations are now run by deploy.sh BEFORE container starts
-# This avoids race conditions when scaling horizontally
+# Note: deploy.sh runs "./server --migrate-only" BEFORE the container starts.
+# The server also applies any pending migrations on startup, which is then a no-op.
 
 exec su-exec appuser "$@"
@@ -27,10 +27,10 @@ export function InventoryPage() {
   const { data: categories, isLoading: categoriesLoading } = useCategories();
   const { data: items, isLoading: itemsLoading } = useItems(filters.queryParams);
   const categoryMap = useCategoryMap(categories);
-  const userRole = useAuthStore((state) => state.user?.role ?? null);
-  const allowItemEdits = canEditItems(userRole);
-  const showUnitCost = canViewUnitCost(userRole);
-  const allowCategoryManagement = canManageCategories(userRole);
+  const permissions = useAuthStore((state) => state.permissions);
+  const allowItemEdits = canEditItems(permissions);
+  const showUnitCost = canViewUnitCost(permissions);
+  const allowCategoryManagement = canManageCategories(permissions);
 
   const [showAddModal, setShowAddModal] = useState(false);
   const [selectedItem, setSelectedItem] = useState<Item | null>(null);
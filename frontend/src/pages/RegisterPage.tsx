@@ -1,21 +1,22 @@
 // Register page component
 
 import { useState } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
 import { useAuthStore } from '../store/authStore';
 import { authService } from '../services/auth';
 import { Package } from 'lucide-react';
 
 export function RegisterPage() {
   const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
   const { setUser } = useAuthStore();
 
+  // Invitation links carry the token as ?token=
   const [formData, setFormData] = useState({
-    email: '',
+    invitationToken: searchParams.get('token') ?? '',
     password: '',
     firstName: '',
     lastName: '',
-    organizationId: '',
   });
   const [error, setError] = useState('');
   const [isSubmitting, setIsSubmitting] = useState(false);
@@ -88,20 +89,6 @@ export function RegisterPage() {
               </div>
             </div>
 
-            <div>
-              <label htmlFor="email" className="block text-sm font-medium text-gray-700">
-                Email address
-              </label>
-              <input
-                id="email"
-                type="email"
-                required
-                value={formData.email}
-                onChange={(e) => setFormData({ ...formData, email: e.target.value })}
-                className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-indigo-500 focus:border-indigo-500"
-              />
-            </div>
-
             <div>
               <label htmlFor="password" className="block text-sm font-medium text-gray-700">
                 Password
@@ -117,19 +104,19 @@ export function RegisterPage() {
             </div>
 
             <div>
-              <label htmlFor="organizationId" className="block text-sm font-medium text-gray-700">
-                Organization ID
+              <label htmlFor="invitationToken" className="block text-sm font-medium text-gray-700">
+                Invitation code
               </label>
               <input
-                id="organizationId"
+                id="invitationToken"
                 type="text"
                 required
-                value={formData.organizationId}
-                onChange={(e) => setFormData({ ...formData, organizationId: e.target.value })}
+                value={formData.invitationToken}
+                onChange={(e) => setFormData({ ...formData, invitationToken: e.target.value })}
                 className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-indigo-500 focus:border-indigo-500"
               />
               <p className="mt-1 text-xs text-gray-500">
-                Contact your administrator for your organization ID
+                Ask your administrator to invite you
               </p>
             </div>
 
@@ -25,11 +25,14 @@ export class ApiError extends Error {
 class ApiClient {
   private baseUrl: string;
   private token: string | null = null;
+  private refreshToken: string | null = null;
+  private refreshing: Promise<boolean> | null = null;
 
   constructor(baseUrl: string) {
     this.baseUrl = baseUrl;
-    // Load token from localStorage on init
+    // Load tokens from localStorage on init
     this.token = localStorage.getItem('auth_token');
+    this.refreshToken = localStorage.getItem('refresh_token');
   }
 
   setToken(token: string | null) {
@@ -45,9 +48,57 @@ class ApiClient {
     return this.token;
   }
 
+  setRefreshToken(refreshToken: string | null) {
+    this.refreshToken = refreshToken;
+    if (refreshToken) {
+      localStorage.setItem('refresh_token', refreshToken);
+    } else {
+      localStorage.removeItem('refresh_token');
+    }
+  }
+
+  getRefreshToken(): string | null {
+    return this.refreshToken;
+  }
+
+  // Exchange the refresh token for new tokens. Concurrent callers share one
+  // exchange, as a refresh token can only be used once.
+  private refreshTokens(): Promise<boolean> {
+    if (!this.refreshing) {
+      const refreshToken = this.refreshToken;
+      this.refreshing = (async () => {
+        if (!refreshToken) {
+          return false;
+        }
+        try {
+          const response = await fetch(`${this.baseUrl}/auth/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refreshToken }),
+          });
+          if (!response.ok) {
+            this.setToken(null);
+            this.setRefreshToken(null);
+            return false;
+          }
+          const { data } = await response.json();
+          this.setToken(data.token);
+          this.setRefreshToken(data.refreshToken);
+          return true;
+        } catch {
+          return false;
+        } finally {
+          this.refreshing = null;
+        }
+      })();
+    }
+    return this.refreshing;
+  }
+
   private async request<T>(
     endpoint: string,
-    options: RequestInit = {}
+    options: RequestInit = {},
+    retried = false
   ): Promise<T> {
     const url = `${this.baseUrl}${endpoint}`;
 
@@ -69,6 +120,17 @@ class ApiClient {
         headers,
       });
 
+      // The access token expired or was revoked: refresh it and retry once
+      if (
+        response.status === 401 &&
+        !retried &&
+        this.token &&
+        !endpoint.startsWith('/auth/') &&
+        (await this.refreshTokens())
+      ) {
+        return this.request<T>(endpoint, options, true);
+      }
+
       const data = await response.json();
 
       if (!response.ok) {
@@ -5,14 +5,22 @@ import type {
   LoginRequest,
   RegisterRequest,
   AuthResponse,
+  AuthTokens,
+  Organization,
+  RolePermissions,
   User,
 } from '../types/inventory';
 
+const storeTokens = (tokens: AuthTokens) => {
+  apiClient.setToken(tokens.token);
+  apiClient.setRefreshToken(tokens.refreshToken);
+};
+
 export const authService = {
   async login(credentials: LoginRequest): Promise<AuthResponse> {
     const response = await apiClient.post<AuthResponse>('/auth/login', credentials);
     if (response.token) {
-      apiClient.setToken(response.token);
+      storeTokens(response);
     }
     return response;
   },
@@ -20,24 +28,51 @@ export const authService = {
   async register(data: RegisterRequest): Promise<AuthResponse> {
     const response = await apiClient.post<AuthResponse>('/auth/register', data);
     if (response.token) {
-      apiClient.setToken(response.token);
+      storeTokens(response);
     }
     return response;
   },
 
+  // Switching exchanges the session's refresh token for tokens in another
+  // organization of the user
+  async switchOrganization(organizationId: string): Promise<AuthResponse> {
+    const response = await apiClient.post<AuthResponse>('/auth/switch-organization', {
+      refreshToken: apiClient.getRefreshToken(),
+      organizationId,
+    });
+    storeTokens(response);
+    return response;
+  },
+
+  async getOrganizations(): Promise<Organization[]> {
+    return apiClient.get<Organization[]>('/organizations');
+  },
+
   async getProfile(): Promise<User> {
     return apiClient.get<User>('/auth/profile');
   },
 
+  async getPermissions(): Promise<RolePermissions> {
+    return apiClient.get<RolePermissions>('/auth/permissions');
+  },
+
+  // Changing the password revokes every session, so the new session's
+  // tokens replace the current ones
   async changePassword(currentPassword: string, newPassword: string): Promise<void> {
-    return apiClient.post<void>('/auth/change-password', {
-      currentPassword,
+    const tokens = await apiClient.post<AuthTokens>('/auth/change-password', {
+      oldPassword: currentPassword,
       newPassword,
     });
+    storeTokens(tokens);
   },
 
   logout() {
+    const refreshToken = apiClient.getRefreshToken();
+    if (refreshToken) {
+      apiClient.post('/auth/logout', { refreshToken }).catch(() => undefined);
+    }
     apiClient.setToken(null);
+    apiClient.setRefreshToken(null);
   },
 
   getToken(): string | null {
@@ -1,11 +1,12 @@
 // Authentication state management
 
 import { create } from 'zustand';
-import type { User } from '../types/inventory';
+import type { Permission, User } from '../types/inventory';
 import { authService } from '../services/auth';
 
 interface AuthState {
   user: User | null;
+  permissions: Permission[];
   isAuthenticated: boolean;
   isLoading: boolean;
   error: string | null;
@@ -15,15 +16,25 @@ interface AuthState {
   setError: (error: string | null) => void;
   logout: () => void;
   checkAuth: () => Promise<void>;
+  loadPermissions: () => Promise<void>;
+  switchOrganization: (organizationId: string) => Promise<void>;
 }
 
-export const useAuthStore = create<AuthState>((set) => ({
+export const useAuthStore = create<AuthState>((set, get) => ({
   user: null,
+  permissions: [],
   isAuthenticated: authService.isAuthenticated(),
   isLoading: false,
   error: null,
 
-  setUser: (user) => set({ user, isAuthenticated: !!user, error: null }),
+  setUser: (user) => {
+    set({ user, isAuthenticated: !!user, error: null });
+    if (user) {
+      get().loadPermissions();
+    } else {
+      set({ permissions: [] });
+    }
+  },
 
   setLoading: (isLoading) => set({ isLoading }),
 
@@ -31,7 +42,7 @@ export const useAuthStore = create<AuthState>((set) => ({
 
   logout: () => {
     authService.logout();
-    set({ user: null, isAuthenticated: false, error: null });
+    set({ user: null, permissions: [], isAuthenticated: false, error: null });
   },
 
   checkAuth: async () => {
@@ -42,11 +53,31 @@ export const useAuthStore = create<AuthState>((set) => ({
 
     try {
       set({ isLoading: true });
-      const user = await authService.getProfile();
-      set({ user, isAuthenticated: true, isLoading: false, error: null });
+      const [user, { permissions }] = await Promise.all([
+        authService.getProfile(),
+        authService.getPermissions(),
+      ]);
+      set({ user, permissions, isAuthenticated: true, isLoading: false, error: null });
     } catch (error) {
       authService.logout();
-      set({ user: null, isAuthenticated: false, isLoading: false, error: null });
+      set({ user: null, permissions: [], isAuthenticated: false, isLoading: false, error: null });
+    }
+  },
+
+  // The user's role, and so their permissions, differ between organizations
+  switchOrganization: async (organizationId) => {
+    const { user } = await authService.switchOrganization(organizationId);
+    get().setUser(user);
+  },
+
+  // The permissions of the user's role decide what the UI offers; the API
+  // enforces them regardless
+  loadPermissions: async () => {
+    try {
+      const { permissions } = await authService.getPermissions();
+      set({ permissions });
+    } catch (error) {
+      set({ permissions: [] });
     }
   },
 }));
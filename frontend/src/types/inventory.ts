@@ -2,10 +2,40 @@
 
 export type Unit = 'pcs' | 'kg' | 'gm' | 'ltr';
 
-export type MovementType = 'IN' | 'OUT' | 'ADJUSTMENT';
+export type MovementType = 'IN' | 'OUT' | 'ADJUSTMENT' | 'TRANSFER' | 'OPENING';
 
 export type Role = 'ADMIN' | 'MANAGER' | 'USER';
 
+// What a role may do; the organization can override the defaults of each
+// role but ADMIN
+export type Permission =
+  | 'items.write'
+  | 'categories.manage'
+  | 'locations.manage'
+  | 'units.manage'
+  | 'reasons.manage'
+  | 'movements.create'
+  | 'movements.adjust'
+  | 'movements.reverse'
+  | 'recipes.manage'
+  | 'sales.record'
+  | 'pos.manage'
+  | 'suppliers.manage'
+  | 'purchasing.manage'
+  | 'reorder.view'
+  | 'stockcounts.count'
+  | 'stockcounts.manage'
+  | 'costs.view'
+  | 'reports.view'
+  | 'ledger.manage'
+  | 'settings.manage'
+  | 'users.manage';
+
+export interface RolePermissions {
+  role: Role;
+  permissions: Permission[];
+}
+
 export interface User {
   id: string;
   organizationId: string;
@@ -18,6 +48,25 @@ export interface User {
   updatedAt: string;
 }
 
+export type CostingMethod = 'FIFO' | 'WEIGHTED_AVERAGE';
+
+export interface OrganizationSettings {
+  currency: string;
+  timezone: string;
+  costingMethod: CostingMethod;
+}
+
+// An outlet of the group; role is the user's role in it
+export interface Organization {
+  id: string;
+  name: string;
+  slug: string;
+  settings: OrganizationSettings;
+  role?: Role;
+  createdAt: string;
+  updatedAt: string;
+}
+
 export interface Category {
   id: string;
   organizationId: string;
@@ -52,6 +101,8 @@ export interface StockMovement {
   quantity: number;
   previousStock: number;
   newStock: number;
+  locationId?: string;
+  toLocationId?: string;
   reference?: string;
   notes?: string;
   createdBy: string;
@@ -100,17 +151,22 @@ export interface LoginRequest {
   password: string;
 }
 
+// Registering accepts an invitation, which sets the email, organization and
+// role of the account
 export interface RegisterRequest {
-  email: string;
+  invitationToken: string;
   password: string;
   firstName: string;
   lastName: string;
-  organizationId: string;
-  role?: Role;
 }
 
-export interface AuthResponse {
+export interface AuthTokens {
   token: string;
+  refreshToken: string;
+  expiresAt: string;
+}
+
+export interface AuthResponse extends AuthTokens {
   user: User;
 }
 
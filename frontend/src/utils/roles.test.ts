@@ -1,5 +1,9 @@
 import { describe, expect, it } from 'vitest';
-import { canEditItems, canManageCategories, canViewUnitCost, isAdmin } from './roles';
+import type { Permission } from '../types/inventory';
+import { canEditItems, canManageCategories, canViewUnitCost, hasPermission, isAdmin } from './roles';
+
+const managerDefaults: Permission[] = ['items.write', 'categories.manage', 'costs.view'];
+const userDefaults: Permission[] = ['movements.create', 'movements.adjust', 'movements.reverse', 'sales.record', 'stockcounts.count'];
 
 describe('role helpers', () => {
   describe('isAdmin', () => {
@@ -14,37 +18,44 @@ describe('role helpers', () => {
     });
   });
 
+  describe('hasPermission', () => {
+    it('checks the permission is granted', () => {
+      expect(hasPermission(userDefaults, 'movements.adjust')).toBe(true);
+      expect(hasPermission(userDefaults, 'costs.view')).toBe(false);
+      expect(hasPermission(undefined, 'costs.view')).toBe(false);
+    });
+  });
+
   describe('canEditItems', () => {
-    it('allows editing for admins', () => {
-      expect(canEditItems('ADMIN')).toBe(true);
+    it('allows editing with items.write', () => {
+      expect(canEditItems(managerDefaults)).toBe(true);
     });
 
-    it('blocks editing for non-admin roles', () => {
-      expect(canEditItems('MANAGER')).toBe(false);
-      expect(canEditItems('USER')).toBe(false);
+    it('blocks editing without items.write', () => {
+      expect(canEditItems(userDefaults)).toBe(false);
+      expect(canEditItems(null)).toBe(false);
     });
   });
 
   describe('canViewUnitCost', () => {
-    it('allows admins to view unit cost', () => {
-      expect(canViewUnitCost('ADMIN')).toBe(true);
+    it('shows unit cost with costs.view', () => {
+      expect(canViewUnitCost(managerDefaults)).toBe(true);
+      expect(canViewUnitCost([...userDefaults, 'costs.view'])).toBe(true);
     });
 
-    it('hides unit cost for non-admin roles', () => {
-      expect(canViewUnitCost('MANAGER')).toBe(false);
-      expect(canViewUnitCost('USER')).toBe(false);
+    it('hides unit cost without costs.view', () => {
+      expect(canViewUnitCost(userDefaults)).toBe(false);
       expect(canViewUnitCost(undefined)).toBe(false);
     });
   });
 
   describe('canManageCategories', () => {
-    it('allows admins to manage categories', () => {
-      expect(canManageCategories('ADMIN')).toBe(true);
+    it('allows category management with categories.manage', () => {
+      expect(canManageCategories(managerDefaults)).toBe(true);
     });
 
-    it('blocks category management for non-admin roles', () => {
-      expect(canManageCategories('MANAGER')).toBe(false);
-      expect(canManageCategories('USER')).toBe(false);
+    it('blocks category management without categories.manage', () => {
+      expect(canManageCategories(userDefaults)).toBe(false);
     });
   });
 });
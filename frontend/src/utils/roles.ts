@@ -1,17 +1,21 @@
-import type { Role } from '../types/inventory';
+import type { Permission, Role } from '../types/inventory';
 
 export function isAdmin(role?: Role | null): boolean {
   return role === 'ADMIN';
 }
 
-export function canEditItems(role?: Role | null): boolean {
-  return isAdmin(role);
+export function hasPermission(permissions: Permission[] | null | undefined, permission: Permission): boolean {
+  return Array.isArray(permissions) && permissions.includes(permission);
 }
 
-export function canViewUnitCost(role?: Role | null): boolean {
-  return isAdmin(role);
+export function canEditItems(permissions?: Permission[] | null): boolean {
+  return hasPermission(permissions, 'items.write');
 }
 
-export function canManageCategories(role?: Role | null): boolean {
-  return isAdmin(role);
+export function canViewUnitCost(permissions?: Permission[] | null): boolean {
+  return hasPermission(permissions, 'costs.view');
+}
+
+export function canManageCategories(permissions?: Permission[] | null): boolean {
+  return hasPermission(permissions, 'categories.manage');
 }
@@ -19,10 +19,6 @@ pnpm run build
 cp -r dist ../dist/frontend
 cd ..
 
-# Copy migrations
-echo "Copying database migrations..."
-cp -r backend/internal/database/migrations dist/
-
 # Copy config example
 cp .env.example dist/
 
@@ -31,7 +27,6 @@ echo ""
 echo "Build artifacts:"
 echo "• Backend binary: ./dist/inventory-server"
 echo "• Frontend files: ./dist/frontend/"
-echo "• Database migrations: ./dist/migrations/"
 echo "• Config template: ./dist/.env.example"
 echo ""
 echo "To deploy:"
@@ -172,7 +172,6 @@ run_migrations() {
     log_info "Running database migrations..."
 
     local db_file="${DATA_DIR}/inventory.db"
-    local migrations_path="/app/migrations/sqlite"
 
     # Ensure database file exists with proper permissions
     if [ ! -f "${db_file}" ]; then
@@ -181,19 +180,17 @@ run_migrations() {
         chown kjinventory:kjinventory "${db_file}" 2>/dev/null || true
     fi
 
-    # Run migrations using the migrate binary from the container
-    # We'll use docker run with a temporary container to execute migrations
+    # Run the embedded migrations with a temporary container of the new image
     local image_name="${DOCKER_IMAGE:-ghcr.io/yashanshu/kj-inventory:latest}"
 
     log_info "Running migrations with image: ${image_name}"
 
     if docker run --rm \
         -v "${DATA_DIR}:/app/data" \
+        -e DATABASE_DRIVER=sqlite3 \
+        -e DATABASE_URL="file:/app/data/inventory.db?_fk=1" \
         "${image_name}" \
-        /usr/local/bin/migrate \
-        -path /app/migrations/sqlite \
-        -database "sqlite3:///app/data/inventory.db?_fk=1" \
-        up; then
+        ./server --migrate-only; then
         log_success "Migrations completed successfully"
     else
         local exit_code=$?